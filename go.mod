@@ -3,10 +3,12 @@ module timeseriesdb
 go 1.24
 
 require (
+	github.com/golang/snappy v0.0.4
 	github.com/joho/godotenv v1.6.0-pre.2
 	github.com/prometheus/client_golang v1.19.0
 	github.com/sirupsen/logrus v1.9.3
 	github.com/stretchr/testify v1.10.0
+	google.golang.org/protobuf v1.32.0
 )
 
 require (
@@ -19,6 +21,5 @@ require (
 	github.com/prometheus/common v0.48.0 // indirect
 	github.com/prometheus/procfs v0.12.0 // indirect
 	golang.org/x/sys v0.35.0 // indirect
-	google.golang.org/protobuf v1.32.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
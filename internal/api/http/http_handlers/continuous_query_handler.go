@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/query"
+	"timeseriesdb/internal/storage"
+)
+
+// ContinuousQueryHandler handles the /continuous_queries endpoint for managing
+// continuous queries
+type ContinuousQueryHandler struct {
+	BaseHandler
+	storage *storage.Storage
+}
+
+// ContinuousQuery is the JSON form of a continuous query and of how far it
+// has rolled up its source
+type ContinuousQuery struct {
+	Name          string     `json:"name"`
+	Source        string     `json:"source"`
+	Target        string     `json:"target"`
+	Fields        []string   `json:"fields,omitempty"`
+	Function      string     `json:"function"`
+	Percentile    float64    `json:"percentile,omitempty"`
+	Interval      string     `json:"interval"`
+	Every         string     `json:"every"`
+	For           string     `json:"for"`
+	ComputedFrom  *time.Time `json:"computed_from,omitempty"`
+	ComputedUntil *time.Time `json:"computed_until,omitempty"`
+	LastRun       *time.Time `json:"last_run,omitempty"`
+}
+
+// ContinuousQueriesResponse is the JSON body listing the continuous queries of a database
+type ContinuousQueriesResponse struct {
+	Database          string            `json:"database"`
+	ContinuousQueries []ContinuousQuery `json:"continuous_queries"`
+}
+
+// NewContinuousQueryHandler creates a new continuous query handler instance
+func NewContinuousQueryHandler(storage *storage.Storage) *ContinuousQueryHandler {
+	return &ContinuousQueryHandler{
+		storage: storage,
+	}
+}
+
+// Handle lists the continuous queries of the database named by the db
+// parameter on GET, creates one on POST and drops the one named by the name
+// parameter on DELETE
+func (h *ContinuousQueryHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	db, err := h.storage.GetDatabase(params.Get("db"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.list(w, db)
+	case http.MethodPost:
+		cq, err := parseContinuousQuery(params)
+		if err != nil {
+			h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+			return
+		}
+		if err := db.CreateContinuousQuery(cq); err != nil {
+			h.writeError(w, err)
+			return
+		}
+		h.list(w, db)
+	case http.MethodDelete:
+		name := params.Get("name")
+		if name == "" {
+			h.WriteError(w, http.StatusBadRequest, "Bad request: missing name")
+			return
+		}
+		if err := db.DropContinuousQuery(name); err != nil {
+			h.writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		h.MethodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+// parseContinuousQuery reads the definition of a continuous query from the
+// request parameters
+func parseContinuousQuery(params url.Values) (storage.ContinuousQuery, error) {
+	cq := storage.ContinuousQuery{
+		Name:   params.Get("name"),
+		Source: params.Get("source"),
+		Target: params.Get("target"),
+		Fields: parseFieldsParam(params["fields"]),
+	}
+	for _, required := range []string{"name", "source", "target", "function", "interval"} {
+		if params.Get(required) == "" {
+			return cq, fmt.Errorf("missing %s", required)
+		}
+	}
+
+	function, err := storage.ParseAggregateFunction(params.Get("function"))
+	if err != nil {
+		return cq, err
+	}
+	cq.Function = function
+
+	if raw := params.Get("percentile"); raw != "" {
+		if cq.Percentile, err = strconv.ParseFloat(raw, 64); err != nil {
+			return cq, fmt.Errorf("invalid percentile '%s'", raw)
+		}
+	}
+
+	for _, d := range []struct {
+		name string
+		dst  *time.Duration
+	}{{"interval", &cq.Interval}, {"every", &cq.Every}, {"for", &cq.For}} {
+		raw := params.Get(d.name)
+		if raw == "" {
+			continue
+		}
+		if *d.dst, err = query.ParseDuration(raw); err != nil {
+			return cq, fmt.Errorf("%s: %w", d.name, err)
+		}
+	}
+
+	return cq, nil
+}
+
+// list writes the continuous queries of a database
+func (h *ContinuousQueryHandler) list(w http.ResponseWriter, db *storage.Database) {
+	queries := db.ContinuousQueries()
+
+	resp := ContinuousQueriesResponse{
+		Database:          db.Name(),
+		ContinuousQueries: make([]ContinuousQuery, 0, len(queries)),
+	}
+	optionalTime := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+	for _, cq := range queries {
+		resp.ContinuousQueries = append(resp.ContinuousQueries, ContinuousQuery{
+			Name:          cq.Name,
+			Source:        cq.Source,
+			Target:        cq.Target,
+			Fields:        cq.Fields,
+			Function:      string(cq.Function),
+			Percentile:    cq.Percentile,
+			Interval:      query.FormatDuration(cq.Interval),
+			Every:         query.FormatDuration(cq.Every),
+			For:           query.FormatDuration(cq.For),
+			ComputedFrom:  optionalTime(cq.ComputedFrom),
+			ComputedUntil: optionalTime(cq.ComputedUntil),
+			LastRun:       optionalTime(cq.LastRun),
+		})
+	}
+	h.WriteJSON(w, http.StatusOK, resp)
+}
+
+// writeError maps a storage error onto a response status
+func (h *ContinuousQueryHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.IsType(err, errors.ErrorTypeValidation):
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+	case errors.IsType(err, errors.ErrorTypeNotFound):
+		h.WriteError(w, http.StatusNotFound, "Not found: "+err.Error())
+	default:
+		logger.Errorf("Continuous query operation failed: %v", err)
+		h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
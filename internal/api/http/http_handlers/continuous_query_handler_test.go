@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+)
+
+func TestContinuousQueryHandler_Handle(t *testing.T) {
+	logger.Init()
+
+	storageInstance := storage.NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	defer storageInstance.Close()
+	if _, err := storageInstance.CreateDatabase("metrics"); err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	handler := NewContinuousQueryHandler(storageInstance)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Handle(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	w := do(http.MethodPost, "/continuous_queries?db=metrics&name=cpu_1h&source=cpu&target=cpu_1h&fields=usage_user,usage_system&function=max&interval=1h&for=3h")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Create: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp ContinuousQueriesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Database != "metrics" || len(resp.ContinuousQueries) != 1 {
+		t.Fatalf("Unexpected response %+v", resp)
+	}
+	cq := resp.ContinuousQueries[0]
+	if cq.Function != "max" || cq.Interval != "1h" || cq.Every != "1h" || cq.For != "3h" || len(cq.Fields) != 2 || cq.ComputedUntil != nil {
+		t.Errorf("Unexpected continuous query %+v", cq)
+	}
+
+	// Queries belong to their database
+	if w := do(http.MethodGet, "/continuous_queries"); !strings.Contains(w.Body.String(), `"continuous_queries":[]`) {
+		t.Errorf("Expected no continuous queries in the default database, got %s", w.Body.String())
+	}
+
+	if w := do(http.MethodDelete, "/continuous_queries?db=metrics&name=cpu_1h"); w.Code != http.StatusNoContent {
+		t.Errorf("Drop: expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		status int
+		body   string
+	}{
+		{"missing name", http.MethodPost, "/continuous_queries?source=cpu&target=cpu_1m&function=mean&interval=1m", http.StatusBadRequest, "missing name"},
+		{"missing interval", http.MethodPost, "/continuous_queries?name=q&source=cpu&target=cpu_1m&function=mean", http.StatusBadRequest, "missing interval"},
+		{"unknown function", http.MethodPost, "/continuous_queries?name=q&source=cpu&target=cpu_1m&function=median&interval=1m", http.StatusBadRequest, "unknown aggregate function"},
+		{"invalid duration", http.MethodPost, "/continuous_queries?name=q&source=cpu&target=cpu_1m&function=mean&interval=1m&for=soon", http.StatusBadRequest, "for: invalid duration"},
+		{"invalid percentile", http.MethodPost, "/continuous_queries?name=q&source=cpu&target=cpu_1m&function=percentile&percentile=high&interval=1m", http.StatusBadRequest, "invalid percentile"},
+		{"same target", http.MethodPost, "/continuous_queries?name=q&source=cpu&target=cpu&function=mean&interval=1m", http.StatusBadRequest, "must differ"},
+		{"drop without name", http.MethodDelete, "/continuous_queries", http.StatusBadRequest, "missing name"},
+		{"drop missing", http.MethodDelete, "/continuous_queries?name=cpu_1h", http.StatusNotFound, "not found"},
+		{"unknown database", http.MethodGet, "/continuous_queries?db=missing", http.StatusNotFound, "not found"},
+		{"method not allowed", http.MethodPut, "/continuous_queries", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(tt.method, tt.target)
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.body) {
+				t.Errorf("Expected body to contain %q, got %s", tt.body, w.Body.String())
+			}
+		})
+	}
+}
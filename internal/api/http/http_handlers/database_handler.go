@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+)
+
+// DatabaseHandler handles the /databases endpoint for managing databases
+type DatabaseHandler struct {
+	BaseHandler
+	storage *storage.Storage
+}
+
+// DatabasesResponse is the JSON body listing the databases
+type DatabasesResponse struct {
+	Databases []string `json:"databases"`
+}
+
+// DatabaseResponse is the JSON body returned when a database is created
+type DatabaseResponse struct {
+	Database string `json:"database"`
+	Created  bool   `json:"created"`
+}
+
+// NewDatabaseHandler creates a new database handler instance
+func NewDatabaseHandler(storage *storage.Storage) *DatabaseHandler {
+	return &DatabaseHandler{
+		storage: storage,
+	}
+}
+
+// Handle lists databases on GET, creates the database named by the db
+// parameter on POST and drops it on DELETE
+func (h *DatabaseHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.list(w)
+	case http.MethodPost:
+		h.create(w, r.URL.Query().Get("db"))
+	case http.MethodDelete:
+		h.drop(w, r.URL.Query().Get("db"))
+	default:
+		h.MethodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+// list writes the names of all databases
+func (h *DatabaseHandler) list(w http.ResponseWriter) {
+	names, err := h.storage.ListDatabases()
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.WriteJSON(w, http.StatusOK, DatabasesResponse{Databases: names})
+}
+
+// create creates a database, answering 201 if it is new and 200 if it existed
+func (h *DatabaseHandler) create(w http.ResponseWriter, name string) {
+	if name == "" {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: missing db")
+		return
+	}
+
+	created, err := h.storage.CreateDatabase(name)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	h.WriteJSON(w, status, DatabaseResponse{Database: name, Created: created})
+}
+
+// drop drops a database and all of its data
+func (h *DatabaseHandler) drop(w http.ResponseWriter, name string) {
+	if name == "" {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: missing db")
+		return
+	}
+
+	if err := h.storage.DropDatabase(name); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeError maps a storage error onto a response status
+func (h *DatabaseHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.IsType(err, errors.ErrorTypeValidation):
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+	case errors.IsType(err, errors.ErrorTypeNotFound):
+		h.WriteError(w, http.StatusNotFound, "Not found: "+err.Error())
+	default:
+		logger.Errorf("Database operation failed: %v", err)
+		h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
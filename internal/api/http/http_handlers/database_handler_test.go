@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+)
+
+func TestDatabaseHandler_Handle(t *testing.T) {
+	logger.Init()
+
+	storageInstance := storage.NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	defer storageInstance.Close()
+
+	handler := NewDatabaseHandler(storageInstance)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Handle(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	if w := do(http.MethodPost, "/databases?db=metrics"); w.Code != http.StatusCreated {
+		t.Errorf("Create: expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	w := do(http.MethodPost, "/databases?db=metrics")
+	if w.Code != http.StatusOK {
+		t.Errorf("Create existing: expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var created DatabaseResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.Database != "metrics" || created.Created {
+		t.Errorf("Create existing: unexpected body %q", w.Body.String())
+	}
+
+	w = do(http.MethodGet, "/databases")
+	var list DatabasesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", w.Body.String(), err)
+	}
+	if want := []string{"default", "metrics"}; !reflect.DeepEqual(list.Databases, want) {
+		t.Errorf("List: got %v, want %v", list.Databases, want)
+	}
+
+	if w := do(http.MethodDelete, "/databases?db=metrics"); w.Code != http.StatusNoContent {
+		t.Errorf("Drop: expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	errorCases := []struct {
+		name   string
+		method string
+		target string
+		status int
+		body   string
+	}{
+		{"drop missing", http.MethodDelete, "/databases?db=metrics", http.StatusNotFound, "not found"},
+		{"drop default", http.MethodDelete, "/databases?db=default", http.StatusBadRequest, "cannot be dropped"},
+		{"create without name", http.MethodPost, "/databases", http.StatusBadRequest, "missing db"},
+		{"create invalid name", http.MethodPost, "/databases?db=a/b", http.StatusBadRequest, "invalid database name"},
+		{"method not allowed", http.MethodPut, "/databases", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do(tc.method, tc.target)
+			if w.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tc.body) {
+				t.Errorf("Expected body to contain %q, got %q", tc.body, w.Body.String())
+			}
+		})
+	}
+}
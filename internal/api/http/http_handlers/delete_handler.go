@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+)
+
+// DeleteHandler handles the /delete endpoint for deleting points
+type DeleteHandler struct {
+	BaseHandler
+	storage *storage.Storage
+}
+
+// DeleteResponse is the JSON body describing a completed delete
+type DeleteResponse struct {
+	Database    string `json:"database"`
+	Measurement string `json:"measurement"`
+	Series      int    `json:"series"`
+}
+
+// NewDeleteHandler creates a new delete handler instance
+func NewDeleteHandler(storage *storage.Storage) *DeleteHandler {
+	return &DeleteHandler{
+		storage: storage,
+	}
+}
+
+// Handle deletes the points of a measurement in the database named by the db
+// parameter. The tags parameter restricts the delete to the series with those
+// tags, and the start and end parameters to a time range. A missing start or
+// end leaves that side of the range unbounded.
+func (h *DeleteHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		h.MethodNotAllowed(w, http.MethodDelete, http.MethodPost)
+		return
+	}
+
+	// ParseForm merges URL query parameters with a form-encoded POST body
+	if err := r.ParseForm(); err != nil {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: invalid form data")
+		return
+	}
+
+	db, err := h.storage.GetDatabase(r.Form.Get("db"))
+	if err != nil {
+		h.WriteDatabaseError(w, err)
+		return
+	}
+
+	measurement := r.Form.Get("measurement")
+	if measurement == "" {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: missing measurement")
+		return
+	}
+
+	tags, err := parseTagsParam(r.Form["tags"])
+	if err != nil {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+		return
+	}
+
+	filter, err := tagsFilter(measurement, tags)
+	if err != nil {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+		return
+	}
+
+	if filter.Start, err = parseOptionalTime(r.Form.Get("start")); err != nil {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: invalid start time '"+r.Form.Get("start")+"'")
+		return
+	}
+	if filter.End, err = parseOptionalTime(r.Form.Get("end")); err != nil {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: invalid end time '"+r.Form.Get("end")+"'")
+		return
+	}
+
+	series, err := db.Delete(r.Context(), filter)
+	if err != nil {
+		if errors.IsType(err, errors.ErrorTypeValidation) {
+			h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+			return
+		}
+		if h.WriteContextError(w, err) {
+			return
+		}
+		logger.Errorf("Failed to delete points: %v", err)
+		h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	h.WriteJSON(w, http.StatusOK, DeleteResponse{
+		Database:    db.Name(),
+		Measurement: measurement,
+		Series:      series,
+	})
+}
+
+// parseOptionalTime parses a time parameter, returning the zero time if it is empty
+func parseOptionalTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return parseTimeParam(value)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+	"timeseriesdb/internal/types"
+)
+
+func TestDeleteHandler_Handle(t *testing.T) {
+	logger.Init()
+
+	storageInstance := storage.NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	defer storageInstance.Close()
+
+	base := time.Unix(0, 1434055562000000000)
+	for _, host := range []string{"a", "b"} {
+		for i := 0; i < 4; i++ {
+			err := storageInstance.WritePoint(context.Background(), types.Point{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host": host},
+				Fields:      map[string]interface{}{"value": float64(i)},
+				Timestamp:   base.Add(time.Duration(i) * time.Second),
+			})
+			if err != nil {
+				t.Fatalf("Failed to write point: %v", err)
+			}
+		}
+	}
+
+	handler := NewDeleteHandler(storageInstance)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Handle(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+	count := func(host string) int {
+		points, err := storageInstance.ReadPoints(context.Background(), "cpu", map[string]string{"host": host}, "value", base, base.Add(time.Minute), 0)
+		if err != nil {
+			t.Fatalf("ReadPoints failed: %v", err)
+		}
+		return len(points)
+	}
+
+	// Delete the last two points of host a
+	w := do(http.MethodDelete, "/delete?measurement=cpu&tags=host=a&start="+base.Add(2*time.Second).Format(time.RFC3339Nano))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp DeleteResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", w.Body.String(), err)
+	}
+	if want := (DeleteResponse{Database: "default", Measurement: "cpu", Series: 1}); resp != want {
+		t.Errorf("Got %+v, want %+v", resp, want)
+	}
+	if a, b := count("a"), count("b"); a != 2 || b != 4 {
+		t.Errorf("Expected 2 points of host a and 4 of host b, got %d and %d", a, b)
+	}
+
+	// Without tags or a range every series of the measurement is cleared
+	if w := do(http.MethodPost, "/delete?measurement=cpu"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"series":2`) {
+		t.Errorf("Expected both series to be deleted, got %d: %s", w.Code, w.Body.String())
+	}
+	if a, b := count("a"), count("b"); a != 0 || b != 0 {
+		t.Errorf("Expected no points left, got %d and %d", a, b)
+	}
+
+	errorCases := []struct {
+		name   string
+		method string
+		target string
+		status int
+		body   string
+	}{
+		{"missing measurement", http.MethodDelete, "/delete", http.StatusBadRequest, "missing measurement"},
+		{"malformed tags", http.MethodDelete, "/delete?measurement=cpu&tags=host", http.StatusBadRequest, "malformed tag filter"},
+		{"invalid start", http.MethodDelete, "/delete?measurement=cpu&start=yesterday", http.StatusBadRequest, "invalid start time"},
+		{"inverted range", http.MethodDelete, "/delete?measurement=cpu&start=10&end=5", http.StatusBadRequest, "invalid delete range"},
+		{"unknown database", http.MethodDelete, "/delete?db=missing&measurement=cpu", http.StatusNotFound, "not found"},
+		{"method not allowed", http.MethodGet, "/delete?measurement=cpu", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do(tc.method, tc.target)
+			if w.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tc.body) {
+				t.Errorf("Expected body to contain %q, got %q", tc.body, w.Body.String())
+			}
+		})
+	}
+}
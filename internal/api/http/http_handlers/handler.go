@@ -1,7 +1,13 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
 	"net/http"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
 )
 
 // Handler defines the interface for all API handlers
@@ -18,13 +24,56 @@ type BaseHandler struct {
 func (h *BaseHandler) WriteJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	// In a real implementation, you'd use json.Marshal here
+
+	if data == nil {
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logger.Errorf("Failed to encode JSON response: %v", err)
+	}
 }
 
 func (h *BaseHandler) WriteError(w http.ResponseWriter, statusCode int, message string) {
 	http.Error(w, message, statusCode)
 }
 
+// WriteDatabaseError writes the response for a failed database lookup: 404 for
+// an unknown database and 500 otherwise
+func (h *BaseHandler) WriteDatabaseError(w http.ResponseWriter, err error) {
+	if errors.IsType(err, errors.ErrorTypeNotFound) {
+		h.WriteError(w, http.StatusNotFound, "Not found: "+err.Error())
+		return
+	}
+	logger.Errorf("Failed to open database: %v", err)
+	h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+}
+
+// WriteContextError writes the response for an operation stopped by its
+// context and reports whether err was such an error: 503 when a query timed
+// out or its client went away
+func (h *BaseHandler) WriteContextError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.IsType(err, errors.ErrorTypeTimeout):
+		h.WriteError(w, http.StatusServiceUnavailable, "Service unavailable: "+err.Error())
+		return true
+	case stderrors.Is(err, context.Canceled):
+		logger.Debugf("Request canceled: %v", err)
+		h.WriteError(w, http.StatusServiceUnavailable, "Service unavailable: request canceled")
+		return true
+	}
+	return false
+}
+
+// queryContext returns the context of a request bounded by a query timeout.
+// A zero timeout leaves the request context unbounded.
+func queryContext(r *http.Request, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
 func (h *BaseHandler) MethodNotAllowed(w http.ResponseWriter, allowedMethods ...string) {
 	w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
 	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+)
+
+// LastHandler handles the /last endpoint returning the newest value of series
+type LastHandler struct {
+	BaseHandler
+	storage *storage.Storage
+}
+
+// LastResponse is the JSON body listing the newest point of each series
+type LastResponse struct {
+	Database    string       `json:"database"`
+	Measurement string       `json:"measurement"`
+	Count       int          `json:"count"`
+	Series      []LastSeries `json:"series"`
+}
+
+// LastSeries is the newest point of one series in a last response
+type LastSeries struct {
+	Field     string            `json:"field"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+	Value     interface{}       `json:"value"`
+}
+
+// NewLastHandler creates a new last handler instance
+func NewLastHandler(storage *storage.Storage) *LastHandler {
+	return &LastHandler{
+		storage: storage,
+	}
+}
+
+// Handle returns the newest point of every series of a measurement in the
+// database named by the db parameter. The tags parameter restricts the series
+// to those carrying the given tags, and the field parameter to one field;
+// without it the newest point of every field is returned.
+func (h *LastHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		h.MethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+
+	// ParseForm merges URL query parameters with a form-encoded POST body
+	if err := r.ParseForm(); err != nil {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: invalid form data")
+		return
+	}
+
+	db, err := h.storage.GetDatabase(r.Form.Get("db"))
+	if err != nil {
+		h.WriteDatabaseError(w, err)
+		return
+	}
+
+	measurement := r.Form.Get("measurement")
+	if measurement == "" {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: missing measurement")
+		return
+	}
+
+	tags, err := parseTagsParam(r.Form["tags"])
+	if err != nil {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+		return
+	}
+	filter, err := tagsFilter(measurement, tags)
+	if err != nil {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+		return
+	}
+
+	points, err := db.LastPoints(r.Context(), filter, r.Form.Get("field"))
+	if err != nil {
+		if errors.IsType(err, errors.ErrorTypeValidation) {
+			h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+			return
+		}
+		if h.WriteContextError(w, err) {
+			return
+		}
+		logger.Errorf("Failed to read last points: %v", err)
+		h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	resp := LastResponse{
+		Database:    db.Name(),
+		Measurement: measurement,
+		Count:       len(points),
+		Series:      make([]LastSeries, 0, len(points)),
+	}
+	for _, p := range points {
+		resp.Series = append(resp.Series, LastSeries{
+			Field:     p.Key.Field,
+			Tags:      p.Key.Tags,
+			Timestamp: p.Timestamp,
+			Value:     p.Value,
+		})
+	}
+
+	h.WriteJSON(w, http.StatusOK, resp)
+}
+
+// tagsFilter builds the filter selecting the series of a measurement that
+// carry every given tag
+func tagsFilter(measurement string, tags map[string]string) (storage.SeriesFilter, error) {
+	filter := storage.SeriesFilter{Measurement: measurement}
+	for key, value := range tags {
+		matcher, err := storage.NewTagMatcher(storage.MatchEqual, key, value)
+		if err != nil {
+			return storage.SeriesFilter{}, err
+		}
+		filter.Matchers = append(filter.Matchers, matcher)
+	}
+	return filter, nil
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+	"timeseriesdb/internal/types"
+)
+
+func TestLastHandler_Handle(t *testing.T) {
+	logger.Init()
+
+	storageInstance := storage.NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	defer storageInstance.Close()
+
+	base := time.Unix(0, 1434055562000000000)
+	for _, host := range []string{"a", "b"} {
+		for i := 0; i < 3; i++ {
+			err := storageInstance.WritePoint(context.Background(), types.Point{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host": host},
+				Fields:      map[string]interface{}{"value": float64(i), "idle": int64(10 * i)},
+				Timestamp:   base.Add(time.Duration(i) * time.Second),
+			})
+			if err != nil {
+				t.Fatalf("Failed to write point: %v", err)
+			}
+		}
+	}
+
+	handler := NewLastHandler(storageInstance)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Handle(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	w := do(http.MethodGet, "/last?measurement=cpu&field=value&tags=host=b")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp LastResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", w.Body.String(), err)
+	}
+	if resp.Database != "default" || resp.Count != 1 || len(resp.Series) != 1 {
+		t.Fatalf("Unexpected response %+v", resp)
+	}
+	if s := resp.Series[0]; s.Field != "value" || s.Tags["host"] != "b" || s.Value != 2.0 || !s.Timestamp.Equal(base.Add(2*time.Second)) {
+		t.Errorf("Unexpected last point %+v", s)
+	}
+
+	// Without a field the newest point of every field of every series is returned
+	w = do(http.MethodGet, "/last?measurement=cpu")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", w.Body.String(), err)
+	}
+	if resp.Count != 4 || resp.Series[0].Field != "idle" || resp.Series[0].Value != 20.0 {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+
+	errorCases := []struct {
+		name   string
+		method string
+		target string
+		status int
+		body   string
+	}{
+		{"missing measurement", http.MethodGet, "/last", http.StatusBadRequest, "missing measurement"},
+		{"malformed tags", http.MethodGet, "/last?measurement=cpu&tags=host", http.StatusBadRequest, "malformed tag filter"},
+		{"unknown database", http.MethodGet, "/last?db=missing&measurement=cpu", http.StatusNotFound, "not found"},
+		{"method not allowed", http.MethodDelete, "/last?measurement=cpu", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do(tc.method, tc.target)
+			if w.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tc.body) {
+				t.Errorf("Expected body to contain %q, got %q", tc.body, w.Body.String())
+			}
+		})
+	}
+}
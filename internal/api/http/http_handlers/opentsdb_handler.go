@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"timeseriesdb/internal/ingestion"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+	"timeseriesdb/internal/types"
+)
+
+// maxOpenTSDBBodySize is the largest /api/put body accepted
+const maxOpenTSDBBodySize = 32 << 20
+
+// OpenTSDBHandler handles the /api/put endpoint of the OpenTSDB HTTP API
+type OpenTSDBHandler struct {
+	BaseHandler
+	storage *storage.Storage
+}
+
+// NewOpenTSDBHandler creates a new OpenTSDB handler instance
+func NewOpenTSDBHandler(storage *storage.Storage) *OpenTSDBHandler {
+	return &OpenTSDBHandler{
+		storage: storage,
+	}
+}
+
+// openTSDBSummary is the response to an /api/put request with the summary
+// parameter
+type openTSDBSummary struct {
+	Success int `json:"success"`
+	Failed  int `json:"failed"`
+}
+
+// openTSDBDetails is the response to an /api/put request with the details
+// parameter
+type openTSDBDetails struct {
+	openTSDBSummary
+	Errors []openTSDBPutFailed `json:"errors"`
+}
+
+// openTSDBPutFailed is a data point the storage rejected, listed in the
+// response to an /api/put request with the details parameter
+type openTSDBPutFailed struct {
+	DataPoint openTSDBDataPoint `json:"datapoint"`
+	Error     string            `json:"error"`
+}
+
+// openTSDBDataPoint is a data point echoed in an /api/put response
+type openTSDBDataPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp int64             `json:"timestamp"`
+	Value     interface{}       `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// Handle stores the data points of an /api/put request. As for /write, a
+// malformed data point fails the whole request with 400 and nothing is
+// written. Otherwise the response is 204, or 400 when the storage rejected
+// some data points. The summary and details parameters ask for a JSON body
+// counting the data points written and rejected, details also listing the
+// rejected ones.
+func (h *OpenTSDBHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxOpenTSDBBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if stderrors.As(err, &tooLarge) {
+			h.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request entity too large: the body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		logger.Errorf("Failed to read request body: %v", err)
+		h.WriteError(w, http.StatusBadRequest, "Bad request: incomplete body")
+		return
+	}
+
+	db, err := h.storage.GetDatabase(r.URL.Query().Get("db"))
+	if err != nil {
+		h.WriteDatabaseError(w, err)
+		return
+	}
+
+	points, err := ingestion.ParseOpenTSDBJSON(body)
+	if err != nil {
+		logger.Errorf("Failed to parse OpenTSDB data points: %v", err)
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+		return
+	}
+
+	successCount, failed, ok := h.writePoints(w, r, db, points)
+	if !ok {
+		return
+	}
+	logger.Infof("Wrote %d OpenTSDB data points successfully", successCount)
+
+	status := http.StatusOK
+	if len(failed) > 0 {
+		status = http.StatusBadRequest
+	}
+
+	query := r.URL.Query()
+	switch {
+	case query.Has("details"):
+		details := openTSDBDetails{
+			openTSDBSummary: openTSDBSummary{Success: successCount, Failed: len(failed)},
+			Errors:          make([]openTSDBPutFailed, 0, len(failed)),
+		}
+		for _, f := range failed {
+			details.Errors = append(details.Errors, openTSDBPutFailed{DataPoint: newOpenTSDBDataPoint(f.point), Error: f.err.Error()})
+		}
+		h.WriteJSON(w, status, details)
+	case query.Has("summary"):
+		h.WriteJSON(w, status, openTSDBSummary{Success: successCount, Failed: len(failed)})
+	case len(failed) > 0:
+		h.WriteError(w, http.StatusBadRequest, fmt.Sprintf("Bad request: %d of %d data points rejected: %v", len(failed), len(points), failed[0].err))
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// newOpenTSDBDataPoint returns a stored point as a data point, with its
+// timestamp in seconds unless it has milliseconds
+func newOpenTSDBDataPoint(p types.Point) openTSDBDataPoint {
+	ts := p.Timestamp.UnixMilli()
+	if p.Timestamp.Nanosecond() == 0 {
+		ts = p.Timestamp.Unix()
+	}
+	return openTSDBDataPoint{
+		Metric:    p.Measurement,
+		Timestamp: ts,
+		Value:     p.Fields[ingestion.OpenTSDBField],
+		Tags:      p.Tags,
+	}
+}
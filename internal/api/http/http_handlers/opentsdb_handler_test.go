@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+	"timeseriesdb/internal/types"
+)
+
+// newOpenTSDBTestHandler creates a handler over an empty storage
+func newOpenTSDBTestHandler(t *testing.T) *OpenTSDBHandler {
+	t.Helper()
+
+	logger.Init()
+
+	storageInstance := storage.NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	t.Cleanup(func() { storageInstance.Close() })
+
+	return NewOpenTSDBHandler(storageInstance)
+}
+
+// doOpenTSDBPut posts an /api/put body
+func doOpenTSDBPut(handler *OpenTSDBHandler, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+	return w
+}
+
+// TestOpenTSDBHandler_Put tests that data points are read back by the Prometheus query API
+func TestOpenTSDBHandler_Put(t *testing.T) {
+	handler := newOpenTSDBTestHandler(t)
+
+	body := `[
+		{"metric": "sys_load", "timestamp": 1700000000, "value": 0.5, "tags": {"host": "web01"}},
+		{"metric": "sys_load", "timestamp": 1700000015000, "value": "0.75", "tags": {"host": "web01"}}
+	]`
+	w := doOpenTSDBPut(handler, "/api/put", body)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	params := url.Values{}
+	params.Set("query", `sys_load{host="web01"}`)
+	params.Set("time", "1700000020")
+	code, resp := doPromRequest(t, NewPrometheusHandler(handler.storage).HandleQuery, "/api/v1/query", params)
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", code, resp.Error)
+	}
+
+	var data struct {
+		Result []promSample `json:"result"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatalf("Failed to decode data: %v", err)
+	}
+	if len(data.Result) != 1 || data.Result[0].Value[1] != "0.75" {
+		t.Errorf("Unexpected result %+v", data.Result)
+	}
+}
+
+// TestOpenTSDBHandler_PutErrors tests malformed and rejected data points
+func TestOpenTSDBHandler_PutErrors(t *testing.T) {
+	handler := newOpenTSDBTestHandler(t)
+
+	// A string value makes the float data points of the metric conflict
+	err := handler.storage.WritePoint(context.Background(), types.Point{
+		Measurement: "build_info",
+		Fields:      map[string]interface{}{"value": "v1"},
+		Timestamp:   time.Unix(1700000000, 0),
+	})
+	if err != nil {
+		t.Fatalf("Failed to write point: %v", err)
+	}
+
+	conflicting := `[
+		{"metric": "build_info", "timestamp": 1700000001, "value": 1},
+		{"metric": "up", "timestamp": 1700000000, "value": 1}
+	]`
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		code   int
+		error  string
+	}{
+		{"not JSON", "/api/put", "put up 1700000000 1", http.StatusBadRequest, "invalid JSON body"},
+		{"invalid data point", "/api/put", `[{"metric": "up", "timestamp": 1700000000, "value": 1}, {"metric": "up", "value": 1}]`, http.StatusBadRequest, "data point 2: missing timestamp"},
+		{"rejected data points", "/api/put", conflicting, http.StatusBadRequest, "1 of 2 data points rejected"},
+		{"unknown database", "/api/put?db=missing", conflicting, http.StatusNotFound, "missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doOpenTSDBPut(handler, tt.target, tt.body)
+			if w.Code != tt.code {
+				t.Fatalf("Expected status %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.error) {
+				t.Errorf("Expected body to contain %q, got %q", tt.error, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestOpenTSDBHandler_PutSummary tests the summary and details parameters
+func TestOpenTSDBHandler_PutSummary(t *testing.T) {
+	handler := newOpenTSDBTestHandler(t)
+
+	w := doOpenTSDBPut(handler, "/api/put?summary", `{"metric": "up", "timestamp": 1700000000, "value": 1}`)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"success":1,"failed":0}` {
+		t.Errorf("Unexpected summary response %d: %s", w.Code, w.Body.String())
+	}
+
+	// An integer value conflicts with the float data points of the metric
+	err := handler.storage.WritePoint(context.Background(), types.Point{
+		Measurement: "build_info",
+		Fields:      map[string]interface{}{"value": int64(1)},
+		Timestamp:   time.Unix(1700000000, 0),
+	})
+	if err != nil {
+		t.Fatalf("Failed to write point: %v", err)
+	}
+
+	w = doOpenTSDBPut(handler, "/api/put?details", `[
+		{"metric": "build_info", "timestamp": 1700000000500, "value": 2, "tags": {"version": "1.2"}},
+		{"metric": "up", "timestamp": 1700000010, "value": 1}
+	]`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var details struct {
+		Success int `json:"success"`
+		Failed  int `json:"failed"`
+		Errors  []struct {
+			DataPoint struct {
+				Metric    string            `json:"metric"`
+				Timestamp int64             `json:"timestamp"`
+				Value     float64           `json:"value"`
+				Tags      map[string]string `json:"tags"`
+			} `json:"datapoint"`
+			Error string `json:"error"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &details); err != nil {
+		t.Fatalf("Failed to decode details: %v", err)
+	}
+	if details.Success != 1 || details.Failed != 1 || len(details.Errors) != 1 {
+		t.Fatalf("Unexpected details %+v", details)
+	}
+	dp := details.Errors[0].DataPoint
+	if dp.Metric != "build_info" || dp.Timestamp != 1700000000500 || dp.Value != 2 || dp.Tags["version"] != "1.2" {
+		t.Errorf("Unexpected rejected data point %+v", dp)
+	}
+	if details.Errors[0].Error == "" {
+		t.Error("Expected the rejected data point to have an error")
+	}
+}
+
+// TestOpenTSDBHandler_InvalidMethod tests that only POST is accepted
+func TestOpenTSDBHandler_InvalidMethod(t *testing.T) {
+	handler := newOpenTSDBTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/put", nil)
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", w.Code)
+	}
+}
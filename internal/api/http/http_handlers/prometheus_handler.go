@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	stderrors "errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/promql"
+	"timeseriesdb/internal/storage"
+)
+
+// PrometheusHandler serves the Prometheus HTTP query API under /api/v1
+type PrometheusHandler struct {
+	BaseHandler
+	storage *storage.Storage
+	now     func() time.Time
+	// timeout bounds the time spent on each query, zero for no limit
+	timeout time.Duration
+}
+
+// promResponse is the envelope of every Prometheus API response
+type promResponse struct {
+	Status    string      `json:"status"`
+	Data      interface{} `json:"data,omitempty"`
+	ErrorType string      `json:"errorType,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// promQueryData is the data of a query or query_range response
+type promQueryData struct {
+	ResultType promql.ValueType `json:"resultType"`
+	Result     interface{}      `json:"result"`
+}
+
+// promSample is an element of a vector result
+type promSample struct {
+	Metric promql.Labels  `json:"metric"`
+	Value  [2]interface{} `json:"value"`
+}
+
+// promSeries is an element of a matrix result
+type promSeries struct {
+	Metric promql.Labels    `json:"metric"`
+	Values [][2]interface{} `json:"values"`
+}
+
+// NewPrometheusHandler creates a new Prometheus API handler instance without
+// a query timeout
+func NewPrometheusHandler(storage *storage.Storage) *PrometheusHandler {
+	return NewPrometheusHandlerWithTimeout(storage, 0)
+}
+
+// NewPrometheusHandlerWithTimeout creates a Prometheus API handler that stops
+// each query after the given timeout, zero for no limit
+func NewPrometheusHandlerWithTimeout(storage *storage.Storage, timeout time.Duration) *PrometheusHandler {
+	return &PrometheusHandler{
+		storage: storage,
+		now:     time.Now,
+		timeout: timeout,
+	}
+}
+
+// HandleQuery processes instant queries on /api/v1/query
+func (h *PrometheusHandler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	engine, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ts := h.now()
+	if raw := r.Form.Get("time"); raw != "" {
+		t, err := parsePromTime(raw)
+		if err != nil {
+			h.writePromError(w, errors.NewValidationError("invalid parameter \"time\": "+err.Error()))
+			return
+		}
+		ts = t
+	}
+
+	ctx, cancel := queryContext(r, h.timeout)
+	defer cancel()
+
+	val, err := engine.Instant(ctx, r.Form.Get("query"), ts)
+	if err != nil {
+		h.writePromError(w, err)
+		return
+	}
+
+	h.WriteJSON(w, http.StatusOK, promResponse{Status: "success", Data: formatPromValue(val)})
+}
+
+// HandleQueryRange processes range queries on /api/v1/query_range
+func (h *PrometheusHandler) HandleQueryRange(w http.ResponseWriter, r *http.Request) {
+	engine, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var params [2]time.Time
+	for i, name := range []string{"start", "end"} {
+		t, err := parsePromTime(r.Form.Get(name))
+		if err != nil {
+			h.writePromError(w, errors.NewValidationError("invalid parameter \""+name+"\": "+err.Error()))
+			return
+		}
+		params[i] = t
+	}
+
+	step, err := parsePromDuration(r.Form.Get("step"))
+	if err != nil {
+		h.writePromError(w, errors.NewValidationError("invalid parameter \"step\": "+err.Error()))
+		return
+	}
+
+	ctx, cancel := queryContext(r, h.timeout)
+	defer cancel()
+
+	matrix, err := engine.Range(ctx, r.Form.Get("query"), params[0], params[1], step)
+	if err != nil {
+		h.writePromError(w, err)
+		return
+	}
+
+	h.WriteJSON(w, http.StatusOK, promResponse{Status: "success", Data: formatPromValue(matrix)})
+}
+
+// HandleLabels returns all label names on /api/v1/labels
+func (h *PrometheusHandler) HandleLabels(w http.ResponseWriter, r *http.Request) {
+	engine, selectors, ok := h.parseSelectors(w, r, false)
+	if !ok {
+		return
+	}
+
+	names, err := engine.LabelNames(selectors)
+	if err != nil {
+		h.writePromError(w, err)
+		return
+	}
+	h.WriteJSON(w, http.StatusOK, promResponse{Status: "success", Data: nonNilStrings(names)})
+}
+
+// HandleLabelValues returns the values of one label on /api/v1/label/{name}/values
+func (h *PrometheusHandler) HandleLabelValues(w http.ResponseWriter, r *http.Request) {
+	engine, selectors, ok := h.parseSelectors(w, r, false)
+	if !ok {
+		return
+	}
+
+	values, err := engine.LabelValues(r.PathValue("name"), selectors)
+	if err != nil {
+		h.writePromError(w, err)
+		return
+	}
+	h.WriteJSON(w, http.StatusOK, promResponse{Status: "success", Data: nonNilStrings(values)})
+}
+
+// HandleSeries returns the label sets of matching series on /api/v1/series
+func (h *PrometheusHandler) HandleSeries(w http.ResponseWriter, r *http.Request) {
+	engine, selectors, ok := h.parseSelectors(w, r, true)
+	if !ok {
+		return
+	}
+
+	series, err := engine.Series(selectors)
+	if err != nil {
+		h.writePromError(w, err)
+		return
+	}
+	if series == nil {
+		series = []promql.Labels{}
+	}
+	h.WriteJSON(w, http.StatusOK, promResponse{Status: "success", Data: series})
+}
+
+// parseRequest checks the method, parses the form and returns an engine over
+// the database named by the db parameter, writing an error response on failure
+func (h *PrometheusHandler) parseRequest(w http.ResponseWriter, r *http.Request) (*promql.Engine, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		h.MethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return nil, false
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.writePromError(w, errors.NewValidationError("invalid form data"))
+		return nil, false
+	}
+
+	db, err := h.storage.GetDatabase(r.Form.Get("db"))
+	if err != nil {
+		h.writePromError(w, err)
+		return nil, false
+	}
+	return promql.NewEngine(db), true
+}
+
+// parseSelectors parses the repeated match[] parameter
+func (h *PrometheusHandler) parseSelectors(w http.ResponseWriter, r *http.Request, required bool) (*promql.Engine, [][]*promql.Matcher, bool) {
+	engine, ok := h.parseRequest(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	raw := r.Form["match[]"]
+	if required && len(raw) == 0 {
+		h.writePromError(w, errors.NewValidationError("no match[] parameter provided"))
+		return nil, nil, false
+	}
+
+	selectors := make([][]*promql.Matcher, 0, len(raw))
+	for _, s := range raw {
+		matchers, err := promql.ParseMetricSelector(s)
+		if err != nil {
+			h.writePromError(w, err)
+			return nil, nil, false
+		}
+		selectors = append(selectors, matchers)
+	}
+	return engine, selectors, true
+}
+
+// writePromError writes an error in the Prometheus response envelope
+func (h *PrometheusHandler) writePromError(w http.ResponseWriter, err error) {
+	status, errorType := http.StatusInternalServerError, "internal"
+	switch {
+	case errors.IsType(err, errors.ErrorTypeValidation):
+		status, errorType = http.StatusBadRequest, "bad_data"
+	case errors.IsType(err, errors.ErrorTypeNotFound):
+		status, errorType = http.StatusNotFound, "not_found"
+	case errors.IsType(err, errors.ErrorTypeTimeout):
+		status, errorType = http.StatusServiceUnavailable, "timeout"
+	case stderrors.Is(err, context.Canceled):
+		status, errorType = http.StatusServiceUnavailable, "canceled"
+	default:
+		logger.Errorf("Prometheus API request failed: %v", err)
+	}
+
+	h.WriteJSON(w, status, promResponse{Status: "error", ErrorType: errorType, Error: err.Error()})
+}
+
+// formatPromValue converts an evaluation result into the Prometheus JSON result shape
+func formatPromValue(val promql.Value) promQueryData {
+	data := promQueryData{ResultType: val.Type()}
+
+	switch v := val.(type) {
+	case promql.Scalar:
+		data.Result = promPair(v.T, formatPromFloat(v.V))
+	case promql.String:
+		data.Result = promPair(v.T, v.V)
+	case promql.Vector:
+		samples := make([]promSample, 0, len(v))
+		for _, s := range v {
+			samples = append(samples, promSample{Metric: s.Metric, Value: promPair(s.T, formatPromFloat(s.V))})
+		}
+		data.Result = samples
+	case promql.Matrix:
+		series := make([]promSeries, 0, len(v))
+		for _, s := range v {
+			values := make([][2]interface{}, 0, len(s.Points))
+			for _, p := range s.Points {
+				values = append(values, promPair(p.T, formatPromFloat(p.V)))
+			}
+			series = append(series, promSeries{Metric: s.Metric, Values: values})
+		}
+		data.Result = series
+	}
+
+	return data
+}
+
+// promPair returns a [unix seconds, value] pair
+func promPair(ts int64, value string) [2]interface{} {
+	return [2]interface{}{float64(ts) / float64(time.Second), value}
+}
+
+// formatPromFloat formats a sample value the way Prometheus does
+func formatPromFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// parsePromTime parses a timestamp given as Unix seconds with optional fraction or as RFC3339
+func parsePromTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, errors.NewValidationError("missing timestamp")
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(math.Round(frac*1e9))).UTC(), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.NewValidationError("cannot parse \"" + s + "\" to a valid timestamp")
+}
+
+// parsePromDuration parses a duration given as seconds with optional fraction or in PromQL notation
+func parsePromDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, errors.NewValidationError("missing duration")
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		d := f * float64(time.Second)
+		if d > math.MaxInt64 || d < math.MinInt64 {
+			return 0, errors.NewValidationError("duration \"" + s + "\" is out of range")
+		}
+		return time.Duration(d), nil
+	}
+	if d, err := promql.ParseDuration(s); err == nil {
+		return d, nil
+	}
+	return 0, errors.NewValidationError("cannot parse \"" + s + "\" to a valid duration")
+}
+
+// nonNilStrings ensures an empty list is encoded as [] rather than null
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+	"timeseriesdb/internal/types"
+)
+
+// promTestResponse decodes a Prometheus API response
+type promTestResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType"`
+	Error     string          `json:"error"`
+}
+
+// newPrometheusTestHandler creates a handler over a storage with an
+// http_requests counter for two hosts sampled every 10 seconds
+func newPrometheusTestHandler(t *testing.T) *PrometheusHandler {
+	t.Helper()
+
+	logger.Init()
+
+	storageInstance := storage.NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	t.Cleanup(func() { storageInstance.Close() })
+
+	base := time.Unix(1700000000, 0)
+	for _, host := range []string{"a", "b"} {
+		for i := 0; i <= 30; i++ {
+			err := storageInstance.WritePoint(context.Background(), types.Point{
+				Measurement: "http_requests",
+				Tags:        map[string]string{"host": host},
+				Fields:      map[string]interface{}{"value": float64(i * 10)},
+				Timestamp:   base.Add(time.Duration(i) * 10 * time.Second),
+			})
+			if err != nil {
+				t.Fatalf("Failed to write point: %v", err)
+			}
+		}
+	}
+
+	return NewPrometheusHandler(storageInstance)
+}
+
+// doPromRequest sends a GET request with the given parameters and decodes the response
+func doPromRequest(t *testing.T, handle http.HandlerFunc, path string, params url.Values) (int, promTestResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, path+"?"+params.Encode(), nil)
+	w := httptest.NewRecorder()
+	handle(w, req)
+
+	var resp promTestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+// TestPrometheusHandler_Query tests an instant query returning a vector
+func TestPrometheusHandler_Query(t *testing.T) {
+	handler := newPrometheusTestHandler(t)
+
+	params := url.Values{}
+	params.Set("query", `rate(http_requests{host="a"}[1m])`)
+	params.Set("time", "1700000300")
+
+	code, resp := doPromRequest(t, handler.HandleQuery, "/api/v1/query", params)
+	if code != http.StatusOK || resp.Status != "success" {
+		t.Fatalf("Expected success, got %d: %+v", code, resp)
+	}
+
+	var data struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]interface{}    `json:"value"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatalf("Failed to decode data: %v", err)
+	}
+
+	if data.ResultType != "vector" || len(data.Result) != 1 {
+		t.Fatalf("Expected a vector with 1 sample, got %+v", data)
+	}
+	if data.Result[0].Metric["host"] != "a" {
+		t.Errorf("Expected host a, got %v", data.Result[0].Metric)
+	}
+	if data.Result[0].Value[0] != 1700000300.0 || data.Result[0].Value[1] != "1" {
+		t.Errorf("Expected [1700000300, \"1\"], got %v", data.Result[0].Value)
+	}
+}
+
+// TestPrometheusHandler_QueryScalar tests the scalar result shape
+func TestPrometheusHandler_QueryScalar(t *testing.T) {
+	handler := newPrometheusTestHandler(t)
+
+	params := url.Values{}
+	params.Set("query", "1+1")
+	params.Set("time", "2023-11-14T22:13:20Z")
+
+	code, resp := doPromRequest(t, handler.HandleQuery, "/api/v1/query", params)
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+
+	want := `{"resultType":"scalar","result":[1700000000,"2"]}`
+	if string(resp.Data) != want {
+		t.Errorf("Expected data %s, got %s", want, resp.Data)
+	}
+}
+
+// TestPrometheusHandler_QueryRange tests a range query returning a matrix
+func TestPrometheusHandler_QueryRange(t *testing.T) {
+	handler := newPrometheusTestHandler(t)
+
+	params := url.Values{}
+	params.Set("query", "sum(http_requests)")
+	params.Set("start", "1700000100")
+	params.Set("end", "1700000160")
+	params.Set("step", "30s")
+
+	code, resp := doPromRequest(t, handler.HandleQueryRange, "/api/v1/query_range", params)
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %+v", code, resp)
+	}
+
+	var data struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][2]interface{}  `json:"values"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatalf("Failed to decode data: %v", err)
+	}
+
+	if data.ResultType != "matrix" || len(data.Result) != 1 {
+		t.Fatalf("Expected a matrix with 1 series, got %+v", data)
+	}
+	values := data.Result[0].Values
+	if len(values) != 3 {
+		t.Fatalf("Expected 3 values, got %d", len(values))
+	}
+	for i, want := range []string{"200", "260", "320"} {
+		if values[i][1] != want {
+			t.Errorf("Value %d: expected %s, got %v", i, want, values[i][1])
+		}
+	}
+}
+
+// TestPrometheusHandler_BadRequests tests the error envelope for invalid parameters
+func TestPrometheusHandler_BadRequests(t *testing.T) {
+	handler := newPrometheusTestHandler(t)
+
+	tests := []struct {
+		name   string
+		handle http.HandlerFunc
+		params map[string]string
+	}{
+		{"missing query", handler.HandleQuery, map[string]string{}},
+		{"syntax error", handler.HandleQuery, map[string]string{"query": "sum("}},
+		{"invalid time", handler.HandleQuery, map[string]string{"query": "up", "time": "yesterday"}},
+		{"missing start", handler.HandleQueryRange, map[string]string{"query": "up", "end": "1", "step": "1"}},
+		{"invalid step", handler.HandleQueryRange, map[string]string{"query": "up", "start": "1", "end": "2", "step": "fast"}},
+		{"too many points", handler.HandleQueryRange, map[string]string{"query": "up", "start": "0", "end": "100000", "step": "1"}},
+		{"series without match", handler.HandleSeries, map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := url.Values{}
+			for k, v := range tt.params {
+				params.Set(k, v)
+			}
+
+			code, resp := doPromRequest(t, tt.handle, "/api/v1/", params)
+			if code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", code)
+			}
+			if resp.Status != "error" || resp.ErrorType != "bad_data" || resp.Error == "" {
+				t.Errorf("Unexpected error envelope %+v", resp)
+			}
+		})
+	}
+}
+
+// TestPrometheusHandler_Metadata tests the labels, label values and series endpoints
+func TestPrometheusHandler_Metadata(t *testing.T) {
+	handler := newPrometheusTestHandler(t)
+
+	code, resp := doPromRequest(t, handler.HandleLabels, "/api/v1/labels", url.Values{})
+	if code != http.StatusOK || string(resp.Data) != `["__name__","host"]` {
+		t.Errorf("Unexpected labels response %d %s", code, resp.Data)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/label/host/values", nil)
+	req.SetPathValue("name", "host")
+	w := httptest.NewRecorder()
+	handler.HandleLabelValues(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"data":["a","b"]`) {
+		t.Errorf("Unexpected label values response %d %s", w.Code, w.Body.String())
+	}
+
+	params := url.Values{}
+	params.Add("match[]", `http_requests{host="b"}`)
+	code, resp = doPromRequest(t, handler.HandleSeries, "/api/v1/series", params)
+	if code != http.StatusOK || string(resp.Data) != `[{"__name__":"http_requests","host":"b"}]` {
+		t.Errorf("Unexpected series response %d %s", code, resp.Data)
+	}
+}
+
+// TestPrometheusHandler_InvalidMethod tests that only GET and POST are allowed
+func TestPrometheusHandler_InvalidMethod(t *testing.T) {
+	handler := newPrometheusTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/query?query=up", nil)
+	w := httptest.NewRecorder()
+	handler.HandleQuery(w, req)
+
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", w.Code)
+	}
+}
@@ -0,0 +1,568 @@
+package handlers
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/ingestion"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/prompb"
+	"timeseriesdb/internal/promql"
+	"timeseriesdb/internal/storage"
+	"timeseriesdb/internal/types"
+)
+
+// maxRemoteWriteBodySize is the largest compressed remote write body accepted
+const maxRemoteWriteBodySize = 32 << 20
+
+// maxRemoteWriteDecodedSize is the largest decompressed remote write body
+// accepted
+const maxRemoteWriteDecodedSize = 256 << 20
+
+// maxRemoteReadBodySize is the largest compressed remote read body accepted
+const maxRemoteReadBodySize = 1 << 20
+
+// maxRemoteReadDecodedSize is the largest decompressed remote read body
+// accepted
+const maxRemoteReadDecodedSize = 16 << 20
+
+// remoteReadFrameSize is the size of chunk data past which the chunks of a
+// series are sent in a new frame of a streamed remote read response
+const remoteReadFrameSize = 1 << 20
+
+// remoteContentType is the media type of remote storage bodies
+const remoteContentType = "application/x-protobuf"
+
+// HandleWrite receives samples from Prometheus remote write on /api/v1/write.
+// Prometheus retries requests failing with a 5xx status and drops those
+// failing with a 4xx status, so malformed bodies and rejected samples get a
+// 4xx status and only failures of the storage or timeouts get a 5xx status.
+func (h *PrometheusHandler) HandleWrite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	defer r.Body.Close()
+
+	if err := checkRemoteHeaders(r, "prometheus.WriteRequest"); err != nil {
+		h.WriteError(w, http.StatusUnsupportedMediaType, "Unsupported media type: "+err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRemoteWriteBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if stderrors.As(err, &tooLarge) {
+			h.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request entity too large: the body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		logger.Errorf("Failed to read request body: %v", err)
+		h.WriteError(w, http.StatusBadRequest, "Bad request: incomplete body")
+		return
+	}
+
+	db, err := h.storage.GetDatabase(r.URL.Query().Get("db"))
+	if err != nil {
+		h.WriteDatabaseError(w, err)
+		return
+	}
+
+	points, err := ingestion.ParseRemoteWrite(body, maxRemoteWriteDecodedSize)
+	if err != nil {
+		logger.Errorf("Failed to decode remote write request: %v", err)
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+		return
+	}
+
+	// A request failing part way through is resent whole, so the samples
+	// already stored are skipped rather than stored twice
+	total := len(points)
+	points, err = skipStoredSamples(r.Context(), db, points)
+	if err != nil {
+		if h.WriteContextError(w, err) {
+			logger.Warnf("Remote write canceled before writing %d samples", total)
+			return
+		}
+		logger.Errorf("Failed to read stored samples: %v", err)
+		h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	// Samples rejected by validation are reported once the others are
+	// written, since retrying would not accept them. A storage failure stops
+	// the request so that Prometheus retries it.
+	successCount := 0
+	var rejected error
+	for _, p := range points {
+		err := db.WritePoint(r.Context(), p)
+		switch {
+		case err == nil:
+			successCount++
+		case h.WriteContextError(w, err):
+			logger.Warnf("Remote write canceled after %d of %d samples", successCount, len(points))
+			return
+		case errors.IsType(err, errors.ErrorTypeValidation):
+			if rejected == nil {
+				rejected = err
+			}
+		default:
+			logger.Errorf("Failed to write sample: %v", err)
+			h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+	}
+
+	logger.Infof("Wrote %d remote write samples successfully, skipped %d already stored", successCount, total-len(points))
+	if rejected != nil {
+		h.WriteError(w, http.StatusBadRequest, fmt.Sprintf("Bad request: %d of %d samples rejected: %v", len(points)-successCount, len(points), rejected))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// skipStoredSamples returns the samples of a remote write batch that are not
+// stored yet. A sample is skipped when its series already holds a point with
+// the same timestamp and value, or when it repeats an earlier sample of the
+// batch. A series is only read when the batch reaches back to its newest
+// point, as when a batch is resent.
+func skipStoredSamples(ctx context.Context, db *storage.Database, points []types.Point) ([]types.Point, error) {
+	type batchSeries struct {
+		key     storage.SeriesKey
+		indexes []int
+		oldest  time.Time
+	}
+	series := make(map[string]*batchSeries)
+	for i, p := range points {
+		key := storage.SeriesKey{Measurement: p.Measurement, Field: ingestion.RemoteWriteField, Tags: p.Tags}
+		id := key.String()
+		s, ok := series[id]
+		if !ok {
+			s = &batchSeries{key: key, oldest: p.Timestamp}
+			series[id] = s
+		} else if p.Timestamp.Before(s.oldest) {
+			s.oldest = p.Timestamp
+		}
+		s.indexes = append(s.indexes, i)
+	}
+
+	skip := make([]bool, len(points))
+	skipped := 0
+	for _, s := range series {
+		seen := make(map[int64][]interface{})
+		last, found, err := db.LastPoint(ctx, s.key)
+		if err != nil {
+			return nil, err
+		}
+		if found && !s.oldest.After(last.Timestamp) {
+			stored, err := db.ReadSeries(ctx, s.key, s.oldest, last.Timestamp, 0)
+			if err != nil {
+				return nil, err
+			}
+			for _, p := range stored {
+				ts := p.Timestamp.UnixNano()
+				seen[ts] = append(seen[ts], p.Fields[s.key.Field])
+			}
+		}
+
+		for _, i := range s.indexes {
+			ts := points[i].Timestamp.UnixNano()
+			value := points[i].Fields[ingestion.RemoteWriteField]
+			if containsSample(seen[ts], value) {
+				skip[i] = true
+				skipped++
+				continue
+			}
+			seen[ts] = append(seen[ts], value)
+		}
+	}
+
+	if skipped == 0 {
+		return points, nil
+	}
+	kept := make([]types.Point, 0, len(points)-skipped)
+	for i, p := range points {
+		if !skip[i] {
+			kept = append(kept, p)
+		}
+	}
+	return kept, nil
+}
+
+// containsSample reports whether values holds the float value v, comparing
+// bits so that NaN values match
+func containsSample(values []interface{}, v interface{}) bool {
+	f, ok := v.(float64)
+	if !ok {
+		return false
+	}
+	for _, value := range values {
+		if stored, ok := value.(float64); ok && math.Float64bits(stored) == math.Float64bits(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRemoteHeaders checks that a remote storage request carries a snappy
+// compressed protobuf message of the first version of the protocol. Missing
+// headers are accepted.
+func checkRemoteHeaders(r *http.Request, message string) error {
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "snappy") {
+		return fmt.Errorf("content encoding %q, expected snappy", encoding)
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != remoteContentType {
+		return fmt.Errorf("content type %q, expected %s", contentType, remoteContentType)
+	}
+	if proto := params["proto"]; proto != "" && proto != message {
+		return fmt.Errorf("protobuf message %q, only %s is supported", proto, message)
+	}
+	return nil
+}
+
+// HandleRead answers Prometheus remote read requests on /api/v1/read with the
+// samples of the series matching each query. The response is a snappy
+// compressed ReadResponse, or a stream of ChunkedReadResponse frames of XOR
+// chunks when the client accepts them first.
+func (h *PrometheusHandler) HandleRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	defer r.Body.Close()
+
+	if err := checkRemoteHeaders(r, "prometheus.ReadRequest"); err != nil {
+		h.WriteError(w, http.StatusUnsupportedMediaType, "Unsupported media type: "+err.Error())
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRemoteReadBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if stderrors.As(err, &tooLarge) {
+			h.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request entity too large: the body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
+		logger.Errorf("Failed to read request body: %v", err)
+		h.WriteError(w, http.StatusBadRequest, "Bad request: incomplete body")
+		return
+	}
+
+	db, err := h.storage.GetDatabase(r.URL.Query().Get("db"))
+	if err != nil {
+		h.WriteDatabaseError(w, err)
+		return
+	}
+
+	req, streamed, err := parseRemoteRead(body)
+	if err != nil {
+		logger.Errorf("Failed to decode remote read request: %v", err)
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+		return
+	}
+	queries := make([]remoteQuery, len(req.Queries))
+	for i, q := range req.Queries {
+		if queries[i], err = newRemoteQuery(q); err != nil {
+			h.WriteError(w, http.StatusBadRequest, fmt.Sprintf("Bad request: query %d: %v", i+1, err))
+			return
+		}
+	}
+
+	ctx, cancel := queryContext(r, h.timeout)
+	defer cancel()
+	engine := promql.NewEngine(db)
+
+	if streamed {
+		h.streamRemoteRead(ctx, w, db, engine, queries)
+		return
+	}
+
+	resp := prompb.ReadResponse{Results: make([]prompb.QueryResult, len(queries))}
+	for i, q := range queries {
+		matrix, err := engine.Select(ctx, q.matchers, q.start, q.end)
+		if err != nil {
+			h.writeRemoteReadError(w, err)
+			return
+		}
+		for _, series := range matrix {
+			resp.Results[i].Timeseries = append(resp.Results[i].Timeseries, prompb.TimeSeries{
+				Labels:  remoteLabels(series.Metric),
+				Samples: remoteSamples(series.Points),
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", remoteContentType)
+	w.Header().Set("Content-Encoding", "snappy")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(prompb.EncodeSnappy(resp.Marshal())); err != nil {
+		logger.Debugf("Failed to write remote read response: %v", err)
+	}
+}
+
+// streamRemoteRead writes the series of each query as ChunkedReadResponse
+// frames. Each series is read through a chunked iterator and its XOR chunks
+// are written as they fill up, so no more than a frame of samples is held at
+// a time. A read failing once the response has started aborts the
+// connection, so the client sees a broken stream rather than a truncated
+// result.
+func (h *PrometheusHandler) streamRemoteRead(ctx context.Context, w http.ResponseWriter, db *storage.Database, engine *promql.Engine, queries []remoteQuery) {
+	flusher, _ := w.(http.Flusher)
+	started := false
+	start := func() {
+		if !started {
+			w.Header().Set("Content-Type", prompb.ChunkedReadContentType)
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+	}
+	fail := func(err error) {
+		if !started {
+			h.writeRemoteReadError(w, err)
+			return
+		}
+		logger.Errorf("Streamed remote read failed: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	var frame []byte
+	for i, q := range queries {
+		keys, err := engine.FindSeries(q.matchers)
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		for _, key := range keys {
+			it, err := db.IterateSeries(ctx, key, q.start, q.end)
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			labels := remoteLabels(promql.SeriesLabels(key))
+			var writeErr error
+			stream := remoteChunkStream{emit: func(chunks []prompb.Chunk) bool {
+				start()
+				resp := prompb.ChunkedReadResponse{
+					ChunkedSeries: []prompb.ChunkedSeries{{Labels: labels, Chunks: chunks}},
+					QueryIndex:    int64(i),
+				}
+				frame = prompb.AppendChunkedFrame(frame[:0], resp.Marshal())
+				if _, writeErr = w.Write(frame); writeErr != nil {
+					return false
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+				return true
+			}}
+
+			for it.Next() {
+				// Remote read only has float samples, so boolean and string fields are skipped
+				p := it.Point()
+				v, ok := types.NumericValue(p.Fields[key.Field])
+				if !ok {
+					continue
+				}
+				if !stream.add(prompb.Sample{Value: v, Timestamp: p.Timestamp.UnixMilli()}) {
+					break
+				}
+			}
+			stream.close()
+			if writeErr != nil {
+				logger.Debugf("Failed to write streamed remote read response: %v", writeErr)
+				return
+			}
+			if err := it.Err(); err != nil {
+				fail(err)
+				return
+			}
+		}
+	}
+
+	start()
+}
+
+// remoteChunkStream encodes the samples of a series in XOR chunks of up to
+// prompb.MaxChunkSamples samples as they are added, keeping the last sample
+// of each millisecond. The chunks are handed to emit whenever their data
+// reaches remoteReadFrameSize, and emit reports false to stop the stream.
+type remoteChunkStream struct {
+	emit    func(chunks []prompb.Chunk) bool
+	samples []prompb.Sample
+	chunks  []prompb.Chunk
+	size    int
+	stopped bool
+}
+
+// add appends a sample, reporting false once the stream is stopped
+func (s *remoteChunkStream) add(sample prompb.Sample) bool {
+	if n := len(s.samples); n > 0 && s.samples[n-1].Timestamp == sample.Timestamp {
+		s.samples[n-1] = sample
+		return !s.stopped
+	}
+
+	// A full chunk is only cut once a later millisecond shows its last
+	// sample is final
+	if len(s.samples) == prompb.MaxChunkSamples {
+		s.cut()
+	}
+	s.samples = append(s.samples, sample)
+	return !s.stopped
+}
+
+// close cuts the remaining samples and emits the last chunks
+func (s *remoteChunkStream) close() {
+	if len(s.samples) > 0 {
+		s.cut()
+	}
+	if len(s.chunks) > 0 {
+		s.flush()
+	}
+}
+
+// cut encodes the buffered samples in a chunk, emitting the chunks once
+// their data reaches remoteReadFrameSize
+func (s *remoteChunkStream) cut() {
+	chunk := prompb.NewXORChunk()
+	for _, sample := range s.samples {
+		chunk.Append(sample.Timestamp, sample.Value)
+	}
+	s.chunks = append(s.chunks, prompb.Chunk{
+		MinTimeMs: s.samples[0].Timestamp,
+		MaxTimeMs: s.samples[len(s.samples)-1].Timestamp,
+		Type:      prompb.ChunkEncodingXOR,
+		Data:      chunk.Bytes(),
+	})
+	s.samples = s.samples[:0]
+
+	s.size += len(chunk.Bytes())
+	if s.size >= remoteReadFrameSize {
+		s.flush()
+	}
+}
+
+// flush emits the encoded chunks
+func (s *remoteChunkStream) flush() {
+	if !s.stopped && !s.emit(s.chunks) {
+		s.stopped = true
+	}
+	s.chunks, s.size = nil, 0
+}
+
+// writeRemoteReadError writes the response of a failed remote read
+func (h *PrometheusHandler) writeRemoteReadError(w http.ResponseWriter, err error) {
+	if h.WriteContextError(w, err) {
+		return
+	}
+	logger.Errorf("Failed to read series: %v", err)
+	h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+}
+
+// remoteQuery is a remote read query with its matchers compiled
+type remoteQuery struct {
+	matchers   []*promql.Matcher
+	start, end time.Time
+}
+
+// remoteMatchTypes maps remote read matcher types to PromQL matcher types
+var remoteMatchTypes = map[prompb.LabelMatcherType]promql.MatchType{
+	prompb.LabelMatcherEqual:     promql.MatchEqual,
+	prompb.LabelMatcherNotEqual:  promql.MatchNotEqual,
+	prompb.LabelMatcherRegexp:    promql.MatchRegexp,
+	prompb.LabelMatcherNotRegexp: promql.MatchNotRegexp,
+}
+
+// newRemoteQuery compiles the matchers of a remote read query
+func newRemoteQuery(q prompb.Query) (remoteQuery, error) {
+	if q.EndTimestampMs < q.StartTimestampMs {
+		return remoteQuery{}, fmt.Errorf("end timestamp %d is before start timestamp %d", q.EndTimestampMs, q.StartTimestampMs)
+	}
+
+	rq := remoteQuery{
+		start: time.UnixMilli(q.StartTimestampMs),
+		// The end is inclusive down to the last nanosecond of its millisecond
+		end: time.UnixMilli(q.EndTimestampMs).Add(time.Millisecond - time.Nanosecond),
+	}
+	for _, m := range q.Matchers {
+		t, ok := remoteMatchTypes[m.Type]
+		if !ok {
+			return remoteQuery{}, fmt.Errorf("unknown matcher type %d", m.Type)
+		}
+		matcher, err := promql.NewMatcher(t, m.Name, m.Value)
+		if err != nil {
+			return remoteQuery{}, fmt.Errorf("invalid regex in matcher %s%s%q: %v", m.Name, t, m.Value, err)
+		}
+		rq.matchers = append(rq.matchers, matcher)
+	}
+	return rq, nil
+}
+
+// parseRemoteRead decodes the snappy compressed ReadRequest of a remote read
+// and reports whether the response is streamed: the first accepted response
+// type that is supported is used, and samples when none is listed
+func parseRemoteRead(body []byte) (prompb.ReadRequest, bool, error) {
+	var req prompb.ReadRequest
+	data, err := prompb.DecodeSnappy(body, maxRemoteReadDecodedSize)
+	if err != nil {
+		return req, false, err
+	}
+	if err := req.Unmarshal(data); err != nil {
+		return req, false, fmt.Errorf("invalid ReadRequest: %v", err)
+	}
+
+	if len(req.AcceptedResponseTypes) == 0 {
+		return req, false, nil
+	}
+	for _, t := range req.AcceptedResponseTypes {
+		switch t {
+		case prompb.ReadResponseSamples:
+			return req, false, nil
+		case prompb.ReadResponseStreamedXORChunks:
+			return req, true, nil
+		}
+	}
+	return req, false, fmt.Errorf("none of the accepted response types %v is supported", req.AcceptedResponseTypes)
+}
+
+// remoteLabels returns the labels of a series sorted by name, as remote read
+// clients expect
+func remoteLabels(metric promql.Labels) []prompb.Label {
+	labels := make([]prompb.Label, 0, len(metric))
+	for name, value := range metric {
+		labels = append(labels, prompb.Label{Name: name, Value: value})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return labels
+}
+
+// remoteSamples converts points to samples with millisecond timestamps,
+// keeping the last point of each millisecond
+func remoteSamples(points []promql.Point) []prompb.Sample {
+	samples := make([]prompb.Sample, 0, len(points))
+	for _, p := range points {
+		s := prompb.Sample{Value: p.V, Timestamp: time.Unix(0, p.T).UnixMilli()}
+		if n := len(samples); n > 0 && samples[n-1].Timestamp == s.Timestamp {
+			samples[n-1] = s
+			continue
+		}
+		samples = append(samples, s)
+	}
+	return samples
+}
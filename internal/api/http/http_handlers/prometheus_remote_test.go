@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"timeseriesdb/internal/prompb"
+	"timeseriesdb/internal/types"
+)
+
+// remoteWriteBody returns the snappy compressed body of a remote write request
+func remoteWriteBody(series ...prompb.TimeSeries) []byte {
+	req := prompb.WriteRequest{Timeseries: series}
+	return prompb.EncodeSnappy(req.Marshal())
+}
+
+// doRemoteWrite posts a remote write body with the headers Prometheus sends
+func doRemoteWrite(handler *PrometheusHandler, target string, body []byte, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	handler.HandleWrite(w, req)
+	return w
+}
+
+// TestPrometheusHandler_Write tests that written samples are read back by the query API
+func TestPrometheusHandler_Write(t *testing.T) {
+	handler := newPrometheusTestHandler(t)
+
+	body := remoteWriteBody(prompb.TimeSeries{
+		Labels: []prompb.Label{{Name: "__name__", Value: "node_load1"}, {Name: "instance", Value: "host1:9100"}},
+		Samples: []prompb.Sample{
+			{Value: 0.5, Timestamp: 1700000000000},
+			{Value: 0.75, Timestamp: 1700000015000},
+		},
+	})
+	w := doRemoteWrite(handler, "/api/v1/write", body, nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	params := url.Values{}
+	params.Set("query", `node_load1{instance="host1:9100"}`)
+	params.Set("time", "1700000020")
+	code, resp := doPromRequest(t, handler.HandleQuery, "/api/v1/query", params)
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", code, resp.Error)
+	}
+
+	var data struct {
+		Result []promSample `json:"result"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatalf("Failed to decode data: %v", err)
+	}
+	if len(data.Result) != 1 || data.Result[0].Value[1] != "0.75" || data.Result[0].Metric["__name__"] != "node_load1" {
+		t.Errorf("Unexpected result %+v", data.Result)
+	}
+}
+
+// TestPrometheusHandler_WriteErrors tests the status codes telling Prometheus
+// whether to retry a request
+func TestPrometheusHandler_WriteErrors(t *testing.T) {
+	handler := newPrometheusTestHandler(t)
+
+	// A string value makes the float samples of the metric conflict
+	err := handler.storage.WritePoint(context.Background(), types.Point{
+		Measurement: "build_info",
+		Fields:      map[string]interface{}{"value": "v1"},
+		Timestamp:   time.Unix(1700000000, 0),
+	})
+	if err != nil {
+		t.Fatalf("Failed to write point: %v", err)
+	}
+
+	valid := remoteWriteBody(prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1700000000000}},
+	})
+	conflicting := remoteWriteBody(
+		prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: "build_info"}}, Samples: []prompb.Sample{{Value: 1, Timestamp: 1700000000000}}},
+		prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: "up"}}, Samples: []prompb.Sample{{Value: 1, Timestamp: 1700000000000}}},
+	)
+
+	tests := []struct {
+		name   string
+		target string
+		body   []byte
+		header http.Header
+		code   int
+		error  string
+	}{
+		{"not snappy", "/api/v1/write", []byte("up 1"), nil, http.StatusBadRequest, "snappy"},
+		{"not protobuf", "/api/v1/write", prompb.EncodeSnappy([]byte("up 1")), nil, http.StatusBadRequest, "invalid WriteRequest"},
+		{"missing name", "/api/v1/write", remoteWriteBody(prompb.TimeSeries{Samples: []prompb.Sample{{Value: 1}}}), nil, http.StatusBadRequest, "missing metric name"},
+		{"rejected samples", "/api/v1/write", conflicting, nil, http.StatusBadRequest, "1 of 2 samples rejected"},
+		{"unknown database", "/api/v1/write?db=missing", valid, nil, http.StatusNotFound, "missing"},
+		{"content encoding", "/api/v1/write", valid, http.Header{"Content-Encoding": {"gzip"}}, http.StatusUnsupportedMediaType, "expected snappy"},
+		{"content type", "/api/v1/write", valid, http.Header{"Content-Type": {"application/json"}}, http.StatusUnsupportedMediaType, "expected application/x-protobuf"},
+		{"remote write 2.0", "/api/v1/write", valid, http.Header{"Content-Type": {"application/x-protobuf;proto=io.prometheus.write.v2.Request"}}, http.StatusUnsupportedMediaType, "only prometheus.WriteRequest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRemoteWrite(handler, tt.target, tt.body, tt.header)
+			if w.Code != tt.code {
+				t.Fatalf("Expected status %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.error) {
+				t.Errorf("Expected the response to contain %q, got %q", tt.error, w.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/write", nil)
+	w := httptest.NewRecorder()
+	handler.HandleWrite(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for GET, got %d", w.Code)
+	}
+}
+
+// TestPrometheusHandler_WriteNonFinite tests that NaN and infinite samples,
+// such as the quantiles of a summary without observations, are stored
+func TestPrometheusHandler_WriteNonFinite(t *testing.T) {
+	handler := newPrometheusTestHandler(t)
+
+	body := remoteWriteBody(prompb.TimeSeries{
+		Labels: []prompb.Label{{Name: "__name__", Value: "rpc_duration_seconds"}, {Name: "quantile", Value: "0.99"}},
+		Samples: []prompb.Sample{
+			{Value: math.NaN(), Timestamp: 1700000000000},
+			{Value: math.Inf(1), Timestamp: 1700000015000},
+			{Value: 0.25, Timestamp: 1700000030000},
+		},
+	})
+	w := doRemoteWrite(handler, "/api/v1/write", body, nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	points, err := handler.storage.ReadPoints(context.Background(), "rpc_duration_seconds", map[string]string{"quantile": "0.99"}, "value", time.Unix(1700000000, 0), time.Unix(1700000060, 0), 0)
+	if err != nil {
+		t.Fatalf("ReadPoints failed: %v", err)
+	}
+	if len(points) != 3 || !math.IsNaN(points[0].Fields["value"].(float64)) || !math.IsInf(points[1].Fields["value"].(float64), 1) || points[2].Fields["value"] != 0.25 {
+		t.Errorf("Unexpected points %+v", points)
+	}
+}
+
+// TestPrometheusHandler_WriteRetried tests that resending a batch written in
+// part stores each sample once
+func TestPrometheusHandler_WriteRetried(t *testing.T) {
+	handler := newPrometheusTestHandler(t)
+
+	labels := []prompb.Label{{Name: "__name__", Value: "node_load1"}, {Name: "instance", Value: "host1:9100"}}
+	samples := []prompb.Sample{
+		{Value: 0.5, Timestamp: 1700000000000},
+		{Value: 0.75, Timestamp: 1700000015000},
+		{Value: 0.75, Timestamp: 1700000015000},
+		{Value: 1.25, Timestamp: 1700000030000},
+	}
+
+	// The first request failed after writing the first two samples
+	w := doRemoteWrite(handler, "/api/v1/write", remoteWriteBody(prompb.TimeSeries{Labels: labels, Samples: samples[:2]}), nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := handler.storage.ForceCompaction(); err != nil {
+		t.Fatalf("ForceCompaction failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		w = doRemoteWrite(handler, "/api/v1/write", remoteWriteBody(prompb.TimeSeries{Labels: labels, Samples: samples}), nil)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	points, err := handler.storage.ReadPoints(context.Background(), "node_load1", map[string]string{"instance": "host1:9100"}, "value", time.Unix(1700000000, 0), time.Unix(1700000060, 0), 0)
+	if err != nil {
+		t.Fatalf("ReadPoints failed: %v", err)
+	}
+	var values []float64
+	for _, p := range points {
+		values = append(values, p.Fields["value"].(float64))
+	}
+	if expected := []float64{0.5, 0.75, 1.25}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("Got values %v, want %v", values, expected)
+	}
+}
+
+// TestPrometheusHandler_WriteCanceled tests that a write stopped by its
+// client gets a retryable status
+func TestPrometheusHandler_WriteCanceled(t *testing.T) {
+	handler := newPrometheusTestHandler(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	body := remoteWriteBody(prompb.TimeSeries{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1700000000000}},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body)).WithContext(ctx)
+	w := httptest.NewRecorder()
+	handler.HandleWrite(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// doRemoteRead posts a remote read request with the headers Prometheus sends
+func doRemoteRead(handler *PrometheusHandler, req prompb.ReadRequest) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/read", bytes.NewReader(prompb.EncodeSnappy(req.Marshal())))
+	r.Header.Set("Content-Encoding", "snappy")
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	r.Header.Set("X-Prometheus-Remote-Read-Version", "0.1.0")
+	w := httptest.NewRecorder()
+	handler.HandleRead(w, r)
+	return w
+}
+
+// remoteReadQueries are two queries over the http_requests series written by
+// newPrometheusTestHandler, from 1700000000 to 1700000300
+var remoteReadQueries = []prompb.Query{
+	{
+		StartTimestampMs: 1700000000000,
+		EndTimestampMs:   1700000020000,
+		Matchers: []prompb.LabelMatcher{
+			{Type: prompb.LabelMatcherEqual, Name: "__name__", Value: "http_requests"},
+			{Type: prompb.LabelMatcherNotEqual, Name: "host", Value: "b"},
+		},
+	},
+	{
+		StartTimestampMs: 1700000290000,
+		EndTimestampMs:   1700000400000,
+		Matchers: []prompb.LabelMatcher{
+			{Type: prompb.LabelMatcherRegexp, Name: "__name__", Value: "http_.*"},
+			{Type: prompb.LabelMatcherNotRegexp, Name: "host", Value: "x|y"},
+		},
+	},
+}
+
+// expectedRemoteRead is the result of remoteReadQueries
+var expectedRemoteRead = []prompb.QueryResult{
+	{Timeseries: []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "http_requests"}, {Name: "host", Value: "a"}},
+			Samples: []prompb.Sample{{Value: 0, Timestamp: 1700000000000}, {Value: 10, Timestamp: 1700000010000}, {Value: 20, Timestamp: 1700000020000}},
+		},
+	}},
+	{Timeseries: []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "http_requests"}, {Name: "host", Value: "a"}},
+			Samples: []prompb.Sample{{Value: 290, Timestamp: 1700000290000}, {Value: 300, Timestamp: 1700000300000}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "http_requests"}, {Name: "host", Value: "b"}},
+			Samples: []prompb.Sample{{Value: 290, Timestamp: 1700000290000}, {Value: 300, Timestamp: 1700000300000}},
+		},
+	}},
+}
+
+// TestPrometheusHandler_Read tests a remote read answered with samples
+func TestPrometheusHandler_Read(t *testing.T) {
+	handler := newPrometheusTestHandler(t)
+
+	w := doRemoteRead(handler, prompb.ReadRequest{Queries: remoteReadQueries})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct, ce := w.Header().Get("Content-Type"), w.Header().Get("Content-Encoding"); ct != "application/x-protobuf" || ce != "snappy" {
+		t.Errorf("Unexpected content type %q and encoding %q", ct, ce)
+	}
+
+	data, err := prompb.DecodeSnappy(w.Body.Bytes(), 1<<20)
+	if err != nil {
+		t.Fatalf("DecodeSnappy failed: %v", err)
+	}
+	var resp prompb.ReadResponse
+	if err := resp.Unmarshal(data); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Results, expectedRemoteRead) {
+		t.Errorf("Got results %+v, want %+v", resp.Results, expectedRemoteRead)
+	}
+}
+
+// TestPrometheusHandler_ReadStreamed tests a remote read answered with
+// streamed XOR chunks
+func TestPrometheusHandler_ReadStreamed(t *testing.T) {
+	handler := newPrometheusTestHandler(t)
+
+	w := doRemoteRead(handler, prompb.ReadRequest{
+		Queries:               remoteReadQueries,
+		AcceptedResponseTypes: []prompb.ReadResponseType{prompb.ReadResponseStreamedXORChunks, prompb.ReadResponseSamples},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse" {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+
+	results := make([]prompb.QueryResult, len(remoteReadQueries))
+	r := bufio.NewReader(w.Body)
+	for {
+		frame, err := prompb.ReadChunkedFrame(r, 1<<20)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadChunkedFrame failed: %v", err)
+		}
+
+		var resp prompb.ChunkedReadResponse
+		if err := resp.Unmarshal(frame); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		for _, series := range resp.ChunkedSeries {
+			ts := prompb.TimeSeries{Labels: series.Labels}
+			for _, chunk := range series.Chunks {
+				samples, err := prompb.DecodeXORChunk(chunk.Data)
+				if err != nil {
+					t.Fatalf("DecodeXORChunk failed: %v", err)
+				}
+				if chunk.Type != prompb.ChunkEncodingXOR || chunk.MinTimeMs != samples[0].Timestamp || chunk.MaxTimeMs != samples[len(samples)-1].Timestamp {
+					t.Errorf("Unexpected chunk %+v of samples %v", chunk, samples)
+				}
+				ts.Samples = append(ts.Samples, samples...)
+			}
+			results[resp.QueryIndex].Timeseries = append(results[resp.QueryIndex].Timeseries, ts)
+		}
+	}
+
+	if !reflect.DeepEqual(results, expectedRemoteRead) {
+		t.Errorf("Got results %+v, want %+v", results, expectedRemoteRead)
+	}
+}
+
+// TestRemoteChunkStream tests that long series are cut into full chunks
+// and that samples of the same millisecond are merged across a chunk
+// boundary
+func TestRemoteChunkStream(t *testing.T) {
+	var frames [][]prompb.Chunk
+	stream := remoteChunkStream{emit: func(chunks []prompb.Chunk) bool {
+		frames = append(frames, chunks)
+		return true
+	}}
+	for i := 0; i < 250; i++ {
+		stream.add(prompb.Sample{Value: float64(i), Timestamp: int64(i) * 1000})
+		if i == 119 {
+			stream.add(prompb.Sample{Value: -1, Timestamp: int64(i) * 1000})
+		}
+	}
+	stream.close()
+
+	if len(frames) != 1 || len(frames[0]) != 3 {
+		t.Fatalf("Expected 1 frame of 3 chunks, got %v", frames)
+	}
+	for i, want := range []int{120, 120, 10} {
+		decoded, err := prompb.DecodeXORChunk(frames[0][i].Data)
+		if err != nil {
+			t.Fatalf("DecodeXORChunk failed: %v", err)
+		}
+		if len(decoded) != want || frames[0][i].MinTimeMs != int64(i*120*1000) {
+			t.Errorf("Chunk %d: got %d samples from %d, want %d", i, len(decoded), frames[0][i].MinTimeMs, want)
+		}
+		if i == 0 && decoded[119].Value != -1 {
+			t.Errorf("Expected the last sample of a millisecond to be kept, got %v", decoded[119])
+		}
+	}
+}
+
+// TestPrometheusHandler_ReadErrors tests the responses to invalid remote reads
+func TestPrometheusHandler_ReadErrors(t *testing.T) {
+	handler := newPrometheusTestHandler(t)
+
+	tests := []struct {
+		name  string
+		req   prompb.ReadRequest
+		code  int
+		error string
+	}{
+		{
+			"invalid regex",
+			prompb.ReadRequest{Queries: []prompb.Query{{Matchers: []prompb.LabelMatcher{{Type: prompb.LabelMatcherRegexp, Name: "job", Value: "("}}}}},
+			http.StatusBadRequest, "query 1: invalid regex",
+		},
+		{
+			"unknown matcher type",
+			prompb.ReadRequest{Queries: []prompb.Query{{Matchers: []prompb.LabelMatcher{{Type: 7, Name: "job", Value: "a"}}}}},
+			http.StatusBadRequest, "unknown matcher type 7",
+		},
+		{
+			"reversed range",
+			prompb.ReadRequest{Queries: []prompb.Query{{StartTimestampMs: 2000, EndTimestampMs: 1000}}},
+			http.StatusBadRequest, "before start timestamp",
+		},
+		{
+			"unsupported response type",
+			prompb.ReadRequest{AcceptedResponseTypes: []prompb.ReadResponseType{5}},
+			http.StatusBadRequest, "none of the accepted response types",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRemoteRead(handler, tt.req)
+			if w.Code != tt.code {
+				t.Fatalf("Expected status %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.error) {
+				t.Errorf("Expected the response to contain %q, got %q", tt.error, w.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/read", strings.NewReader("not snappy"))
+	w := httptest.NewRecorder()
+	handler.HandleRead(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a corrupt body, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/read", nil)
+	req.Header.Set("Content-Type", "application/x-protobuf; proto=prometheus.WriteRequest")
+	w = httptest.NewRecorder()
+	handler.HandleRead(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415 for a write request, got %d", w.Code)
+	}
+}
@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/query"
+	"timeseriesdb/internal/storage"
+	"timeseriesdb/internal/types"
+)
+
+// QueryHandler handles the /query endpoint for reading stored series
+type QueryHandler struct {
+	BaseHandler
+	storage *storage.Storage
+	// timeout bounds the time spent on each query, zero for no limit
+	timeout time.Duration
+}
+
+// QueryResponse is the JSON body returned by the /query endpoint
+type QueryResponse struct {
+	Measurement string            `json:"measurement"`
+	Field       string            `json:"field"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Start       time.Time         `json:"start"`
+	End         time.Time         `json:"end"`
+	Count       int               `json:"count"`
+	Points      []QueryPoint      `json:"points"`
+}
+
+// QueryPoint is a single point in a query response
+type QueryPoint struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Value     interface{}       `json:"value"`
+}
+
+// RowsResponse is the JSON body returned by the /query endpoint when several
+// fields are requested. Each row holds one value per field, in the order of
+// Fields, with null where the point has no value for a field.
+type RowsResponse struct {
+	Measurement string            `json:"measurement"`
+	Fields      []string          `json:"fields"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Start       time.Time         `json:"start"`
+	End         time.Time         `json:"end"`
+	Count       int               `json:"count"`
+	Rows        []QueryRow        `json:"rows"`
+}
+
+// QueryRow is a single row in a multi-field query response
+type QueryRow struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Values    []interface{}     `json:"values"`
+}
+
+// NewQueryHandler creates a new query handler instance without a query timeout
+func NewQueryHandler(storage *storage.Storage) *QueryHandler {
+	return NewQueryHandlerWithTimeout(storage, 0)
+}
+
+// NewQueryHandlerWithTimeout creates a query handler that stops each query
+// after the given timeout, zero for no limit
+func NewQueryHandlerWithTimeout(storage *storage.Storage, timeout time.Duration) *QueryHandler {
+	return &QueryHandler{
+		storage: storage,
+		timeout: timeout,
+	}
+}
+
+// Handle processes query requests
+func (h *QueryHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		h.MethodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+
+	// ParseForm merges URL query parameters with a form-encoded POST body
+	if err := r.ParseForm(); err != nil {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: invalid form data")
+		return
+	}
+
+	format, explicit, err := responseFormat(r)
+	if err != nil {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+		return
+	}
+	// Only single field reads are streamed. A format negotiated through the
+	// Accept header falls back to JSON for the others.
+	streamable := r.Form.Get("q") == "" && len(r.Form["fields"]) == 0 && r.Form.Get("mode") == ""
+	if !streamable && format != formatJSON {
+		if explicit {
+			h.WriteError(w, http.StatusBadRequest, "Bad request: format '"+format+"' is only supported for single field reads")
+			return
+		}
+		format = formatJSON
+	}
+
+	db, err := h.storage.GetDatabase(r.Form.Get("db"))
+	if err != nil {
+		h.WriteDatabaseError(w, err)
+		return
+	}
+
+	ctx, cancel := queryContext(r, h.timeout)
+	defer cancel()
+
+	// A q parameter carries an InfluxQL statement instead of the series parameters
+	if q := r.Form.Get("q"); q != "" {
+		h.handleStatement(ctx, w, db, q)
+		return
+	}
+
+	measurement := r.Form.Get("measurement")
+	if measurement == "" {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: missing measurement")
+		return
+	}
+
+	field := r.Form.Get("field")
+	fields, multiField := r.Form["fields"]
+	if multiField && field != "" {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: field and fields cannot be combined")
+		return
+	}
+	if field == "" {
+		field = "value"
+	}
+
+	tags, err := parseTagsParam(r.Form["tags"])
+	if err != nil {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+		return
+	}
+
+	start, end, err := parseTimeRange(r.Form.Get("start"), r.Form.Get("end"))
+	if err != nil {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+		return
+	}
+
+	limit := 0
+	if raw := r.Form.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			h.WriteError(w, http.StatusBadRequest, "Bad request: invalid limit")
+			return
+		}
+	}
+
+	switch mode := r.Form.Get("mode"); mode {
+	case "":
+	case "last":
+		if multiField {
+			h.WriteError(w, http.StatusBadRequest, "Bad request: mode=last takes a single field")
+			return
+		}
+		h.handleLast(ctx, w, db, measurement, field, tags, start, end)
+		return
+	default:
+		h.WriteError(w, http.StatusBadRequest, "Bad request: unknown mode '"+mode+"'")
+		return
+	}
+
+	if multiField {
+		h.handleRows(ctx, w, db, measurement, parseFieldsParam(fields), tags, start, end, limit)
+		return
+	}
+
+	if format != formatJSON {
+		it, err := db.IteratePoints(ctx, measurement, tags, field, start, end, limit)
+		if err != nil {
+			if h.WriteContextError(w, err) {
+				return
+			}
+			logger.Errorf("Failed to read points: %v", err)
+			h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		h.streamPoints(w, it, format, field)
+		return
+	}
+
+	points, err := db.ReadPoints(ctx, measurement, tags, field, start, end, limit)
+	if err != nil {
+		if h.WriteContextError(w, err) {
+			return
+		}
+		logger.Errorf("Failed to read points: %v", err)
+		h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	h.WriteJSON(w, http.StatusOK, newQueryResponse(measurement, field, tags, start, end, points))
+}
+
+// handleRows reads several fields of a measurement as merged rows
+func (h *QueryHandler) handleRows(ctx context.Context, w http.ResponseWriter, db *storage.Database, measurement string, fields []string, tags map[string]string, start, end time.Time, limit int) {
+	rows, err := db.ReadRows(ctx, measurement, tags, fields, start, end, limit)
+	if err != nil {
+		if errors.IsType(err, errors.ErrorTypeValidation) {
+			h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+			return
+		}
+		if h.WriteContextError(w, err) {
+			return
+		}
+		logger.Errorf("Failed to read rows: %v", err)
+		h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	resp := RowsResponse{
+		Measurement: measurement,
+		Fields:      rows.Fields,
+		Tags:        tags,
+		Start:       start,
+		End:         end,
+		Count:       len(rows.Rows),
+		Rows:        make([]QueryRow, 0, len(rows.Rows)),
+	}
+	for _, row := range rows.Rows {
+		resp.Rows = append(resp.Rows, QueryRow{
+			Timestamp: row.Timestamp,
+			Tags:      row.Tags,
+			Values:    row.Values,
+		})
+	}
+
+	h.WriteJSON(w, http.StatusOK, resp)
+}
+
+// handleLast writes the newest point of every series carrying the given tags,
+// served from the last-value cache. The time range and limit do not apply.
+func (h *QueryHandler) handleLast(ctx context.Context, w http.ResponseWriter, db *storage.Database, measurement, field string, tags map[string]string, start, end time.Time) {
+	filter, err := tagsFilter(measurement, tags)
+	if err != nil {
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+		return
+	}
+
+	last, err := db.LastPoints(ctx, filter, field)
+	if err != nil {
+		if h.WriteContextError(w, err) {
+			return
+		}
+		logger.Errorf("Failed to read last points: %v", err)
+		h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	points := make([]types.Point, 0, len(last))
+	for _, p := range last {
+		points = append(points, types.Point{
+			Measurement: measurement,
+			Tags:        p.Key.Tags,
+			Fields:      map[string]interface{}{field: p.Value},
+			Timestamp:   p.Timestamp,
+		})
+	}
+
+	h.WriteJSON(w, http.StatusOK, newQueryResponse(measurement, field, tags, start, end, points))
+}
+
+// handleStatement executes an InfluxQL statement against a database and
+// writes its result
+func (h *QueryHandler) handleStatement(ctx context.Context, w http.ResponseWriter, db *storage.Database, q string) {
+	result, err := query.NewExecutor(db).ExecuteQuery(ctx, q)
+	if err != nil {
+		if errors.IsType(err, errors.ErrorTypeValidation) {
+			h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+			return
+		}
+		if h.WriteContextError(w, err) {
+			return
+		}
+		logger.Errorf("Failed to execute query %q: %v", q, err)
+		h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	h.WriteJSON(w, http.StatusOK, result)
+}
+
+// newQueryResponse converts storage points into the JSON response shape
+func newQueryResponse(measurement, field string, tags map[string]string, start, end time.Time, points []types.Point) QueryResponse {
+	resp := QueryResponse{
+		Measurement: measurement,
+		Field:       field,
+		Tags:        tags,
+		Start:       start,
+		End:         end,
+		Count:       len(points),
+		Points:      make([]QueryPoint, 0, len(points)),
+	}
+
+	for _, p := range points {
+		resp.Points = append(resp.Points, QueryPoint{
+			Timestamp: p.Timestamp,
+			Tags:      p.Tags,
+			Value:     p.Fields[field],
+		})
+	}
+
+	return resp
+}
+
+// parseTagsParam parses tag filters given as "key=value" pairs separated by commas.
+// The parameter may be repeated.
+func parseTagsParam(values []string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, value := range values {
+		for _, pair := range strings.Split(value, ",") {
+			if pair == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+				return nil, errors.NewValidationError("malformed tag filter '" + pair + "'")
+			}
+			tags[kv[0]] = kv[1]
+		}
+	}
+	return tags, nil
+}
+
+// parseFieldsParam parses field names separated by commas. An empty list or
+// "*" selects every field.
+func parseFieldsParam(values []string) []string {
+	var fields []string
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil
+			}
+			if name != "" {
+				fields = append(fields, name)
+			}
+		}
+	}
+	return fields
+}
+
+// parseTimeRange parses the start and end parameters of a query.
+// A missing start defaults to the earliest representable time, so points
+// written before 1970 are included, and a missing end defaults to now.
+func parseTimeRange(startParam, endParam string) (time.Time, time.Time, error) {
+	start := time.Unix(0, math.MinInt64)
+	end := time.Now()
+
+	if startParam != "" {
+		t, err := parseTimeParam(startParam)
+		if err != nil {
+			return start, end, errors.NewValidationError("invalid start time '" + startParam + "'")
+		}
+		start = t
+	}
+
+	if endParam != "" {
+		t, err := parseTimeParam(endParam)
+		if err != nil {
+			return start, end, errors.NewValidationError("invalid end time '" + endParam + "'")
+		}
+		end = t
+	}
+
+	if end.Before(start) {
+		return start, end, errors.NewValidationError("invalid time range: end is before start")
+	}
+
+	return start, end, nil
+}
+
+// parseTimeParam parses a time given either as Unix nanoseconds or as RFC3339
+func parseTimeParam(value string) (time.Time, error) {
+	if ns, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, ns), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
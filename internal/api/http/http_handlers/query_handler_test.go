@@ -0,0 +1,441 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/query"
+	"timeseriesdb/internal/storage"
+	"timeseriesdb/internal/types"
+)
+
+// newQueryTestStorage creates a storage instance seeded with a few cpu points
+func newQueryTestStorage(t *testing.T) *storage.Storage {
+	t.Helper()
+
+	logger.Init()
+
+	storageInstance := storage.NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	t.Cleanup(func() { storageInstance.Close() })
+
+	tags := map[string]string{"host": "server01", "region": "us-west"}
+	for i := 0; i < 3; i++ {
+		err := storageInstance.WritePoint(context.Background(), types.Point{
+			Measurement: "cpu",
+			Tags:        tags,
+			Fields:      map[string]interface{}{"value": float64(i)},
+			Timestamp:   time.Unix(0, 1434055562000000000+int64(i)*int64(time.Second)),
+		})
+		if err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+
+	return storageInstance
+}
+
+// TestQueryHandler_Handle_ValidRequest tests a query returning stored points
+func TestQueryHandler_Handle_ValidRequest(t *testing.T) {
+	handler := NewQueryHandler(newQueryTestStorage(t))
+
+	params := url.Values{}
+	params.Set("measurement", "cpu")
+	params.Set("field", "value")
+	params.Set("tags", "host=server01,region=us-west")
+	params.Set("start", "1434055562000000000")
+	params.Set("end", "1434055572000000000")
+
+	req := httptest.NewRequest(http.MethodGet, "/query?"+params.Encode(), nil)
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected JSON content type, got '%s'", w.Header().Get("Content-Type"))
+	}
+
+	var resp QueryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Count != 3 || len(resp.Points) != 3 {
+		t.Fatalf("Expected 3 points, got count=%d points=%d", resp.Count, len(resp.Points))
+	}
+
+	for i, p := range resp.Points {
+		if p.Value != float64(i) {
+			t.Errorf("Expected point %d to have value %d, got %f", i, i, p.Value)
+		}
+	}
+}
+
+// TestQueryHandler_Handle_PostForm tests a query sent as a form-encoded POST body
+func TestQueryHandler_Handle_PostForm(t *testing.T) {
+	handler := NewQueryHandler(newQueryTestStorage(t))
+
+	form := url.Values{}
+	form.Set("measurement", "cpu")
+	form.Set("tags", "region=us-west,host=server01")
+	form.Set("start", "2015-06-11T20:46:02Z")
+	form.Set("end", "2015-06-11T20:46:10Z")
+	form.Set("limit", "2")
+
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp QueryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Count != 2 {
+		t.Errorf("Expected limit to cap results at 2, got %d", resp.Count)
+	}
+}
+
+// TestQueryHandler_Handle_BadRequests tests parameter validation
+func TestQueryHandler_Handle_BadRequests(t *testing.T) {
+	handler := NewQueryHandler(newQueryTestStorage(t))
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"missing measurement", "field=value"},
+		{"end before start", "measurement=cpu&start=2000&end=1000"},
+		{"invalid start", "measurement=cpu&start=yesterday"},
+		{"invalid end", "measurement=cpu&end=tomorrow"},
+		{"negative limit", "measurement=cpu&limit=-1"},
+		{"invalid limit", "measurement=cpu&limit=ten"},
+		{"malformed tags", "measurement=cpu&tags=host"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/query?"+tt.query, nil)
+			w := httptest.NewRecorder()
+			handler.Handle(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", w.Code)
+			}
+		})
+	}
+}
+
+// TestQueryHandler_Handle_InvalidMethod tests that only GET and POST are allowed
+func TestQueryHandler_Handle_InvalidMethod(t *testing.T) {
+	handler := NewQueryHandler(newQueryTestStorage(t))
+
+	for _, method := range []string{"PUT", "DELETE", "PATCH"} {
+		t.Run(method, func(t *testing.T) {
+			req := httptest.NewRequest(method, "/query?measurement=cpu", nil)
+			w := httptest.NewRecorder()
+			handler.Handle(w, req)
+
+			if w.Code != http.StatusMethodNotAllowed {
+				t.Errorf("Expected status 405, got %d", w.Code)
+			}
+		})
+	}
+}
+
+// TestQueryHandler_Handle_EmptyResult tests a query matching no series
+func TestQueryHandler_Handle_EmptyResult(t *testing.T) {
+	handler := NewQueryHandler(newQueryTestStorage(t))
+
+	req := httptest.NewRequest(http.MethodGet, "/query?measurement=memory", nil)
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var resp QueryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Count != 0 || resp.Points == nil {
+		t.Errorf("Expected an empty points array, got %+v", resp.Points)
+	}
+}
+
+// TestQueryHandler_Handle_Statement tests an InfluxQL statement passed in the q parameter
+func TestQueryHandler_Handle_Statement(t *testing.T) {
+	handler := NewQueryHandler(newQueryTestStorage(t))
+
+	params := url.Values{}
+	params.Set("q", "SELECT mean(value) FROM cpu WHERE host = 'server01' GROUP BY region")
+
+	req := httptest.NewRequest(http.MethodGet, "/query?"+params.Encode(), nil)
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result query.Result
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(result.Series) != 1 {
+		t.Fatalf("Expected 1 series, got %d", len(result.Series))
+	}
+	row := result.Series[0]
+	if row.Name != "cpu" || row.Tags["region"] != "us-west" {
+		t.Errorf("Unexpected series name %q and tags %v", row.Name, row.Tags)
+	}
+	if len(row.Values) != 1 || row.Values[0][1] != 1.0 {
+		t.Errorf("Expected mean 1, got %v", row.Values)
+	}
+}
+
+// TestQueryHandler_Handle_ShowStatement tests a schema exploration statement passed in the q parameter
+func TestQueryHandler_Handle_ShowStatement(t *testing.T) {
+	handler := NewQueryHandler(newQueryTestStorage(t))
+
+	params := url.Values{}
+	params.Set("q", "SHOW TAG VALUES WITH KEY = region")
+
+	req := httptest.NewRequest(http.MethodGet, "/query?"+params.Encode(), nil)
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result query.Result
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(result.Series) != 1 || result.Series[0].Name != "cpu" {
+		t.Fatalf("Expected one cpu row, got %+v", result.Series)
+	}
+	values := result.Series[0].Values
+	if len(values) != 1 || values[0][0] != "region" || values[0][1] != "us-west" {
+		t.Errorf("Expected region us-west, got %v", values)
+	}
+}
+
+// TestQueryHandler_Handle_InvalidStatement tests that malformed statements are rejected
+func TestQueryHandler_Handle_InvalidStatement(t *testing.T) {
+	handler := NewQueryHandler(newQueryTestStorage(t))
+
+	params := url.Values{}
+	params.Set("q", "SELECT value FROM")
+
+	req := httptest.NewRequest(http.MethodGet, "/query?"+params.Encode(), nil)
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "expected identifier") {
+		t.Errorf("Expected parse error in body, got %q", w.Body.String())
+	}
+}
+
+// TestQueryHandler_Handle_Database tests that the db parameter selects the database queried
+func TestQueryHandler_Handle_Database(t *testing.T) {
+	storageInstance := newQueryTestStorage(t)
+	if _, err := storageInstance.CreateDatabase("empty"); err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	handler := NewQueryHandler(storageInstance)
+
+	req := httptest.NewRequest(http.MethodGet, "/query?db=empty&measurement=cpu", nil)
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	var resp QueryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", w.Body.String(), err)
+	}
+	if resp.Count != 0 {
+		t.Errorf("Expected no points from the empty database, got %+v", resp.Points)
+	}
+
+	params := url.Values{}
+	params.Set("db", "missing")
+	params.Set("q", "SHOW MEASUREMENTS")
+	req = httptest.NewRequest(http.MethodGet, "/query?"+params.Encode(), nil)
+	w = httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing database, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// TestQueryHandler_Handle_Fields tests reading several fields as merged rows
+func TestQueryHandler_Handle_Fields(t *testing.T) {
+	storageInstance := newQueryTestStorage(t)
+	err := storageInstance.WritePoint(context.Background(), types.Point{
+		Measurement: "cpu",
+		Tags:        map[string]string{"host": "server01", "region": "us-west"},
+		Fields:      map[string]interface{}{"value": 9.0, "idle": 91.0},
+		Timestamp:   time.Unix(0, 1434055562000000000+int64(3*time.Second)),
+	})
+	if err != nil {
+		t.Fatalf("Failed to write point: %v", err)
+	}
+	handler := NewQueryHandler(storageInstance)
+
+	req := httptest.NewRequest(http.MethodGet, "/query?measurement=cpu&fields=value,idle&start=0", nil)
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp RowsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", w.Body.String(), err)
+	}
+	if len(resp.Fields) != 2 || resp.Fields[0] != "value" || resp.Fields[1] != "idle" {
+		t.Errorf("Expected fields [value idle], got %v", resp.Fields)
+	}
+	if resp.Count != 4 || len(resp.Rows) != 4 {
+		t.Fatalf("Expected 4 rows, got %d", resp.Count)
+	}
+	if resp.Rows[0].Values[1] != nil || resp.Rows[3].Values[0] != 9.0 || resp.Rows[3].Values[1] != 91.0 {
+		t.Errorf("Unexpected row values %v and %v", resp.Rows[0].Values, resp.Rows[3].Values)
+	}
+
+	// A wildcard selects every field, sorted by name
+	req = httptest.NewRequest(http.MethodGet, "/query?measurement=cpu&fields=*&start=0&limit=1", nil)
+	w = httptest.NewRecorder()
+	handler.Handle(w, req)
+	if !strings.Contains(w.Body.String(), `"fields":["idle","value"]`) || !strings.Contains(w.Body.String(), `"values":[null,0]`) {
+		t.Errorf("Unexpected wildcard response %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/query?measurement=cpu&field=value&fields=idle", nil)
+	w = httptest.NewRecorder()
+	handler.Handle(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 when combining field and fields, got %d", w.Code)
+	}
+}
+
+// TestQueryHandler_Handle_Last tests the last mode returning the newest point of each series
+func TestQueryHandler_Handle_Last(t *testing.T) {
+	handler := NewQueryHandler(newQueryTestStorage(t))
+
+	req := httptest.NewRequest(http.MethodGet, "/query?measurement=cpu&field=value&tags=host=server01&mode=last", nil)
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp QueryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Count != 1 || len(resp.Points) != 1 || resp.Points[0].Value != 2.0 {
+		t.Fatalf("Expected the point with value 2, got %+v", resp.Points)
+	}
+
+	for _, target := range []string{
+		"/query?measurement=cpu&fields=value&mode=last",
+		"/query?measurement=cpu&mode=first",
+	} {
+		w := httptest.NewRecorder()
+		handler.Handle(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", target, w.Code)
+		}
+	}
+}
+
+// TestQueryHandler_Handle_DefaultStart tests that a query without start returns points written before 1970
+func TestQueryHandler_Handle_DefaultStart(t *testing.T) {
+	storageInstance := newQueryTestStorage(t)
+	handler := NewQueryHandler(storageInstance)
+
+	err := storageInstance.WritePoint(context.Background(), types.Point{
+		Measurement: "cpu",
+		Tags:        map[string]string{"host": "server01", "region": "us-west"},
+		Fields:      map[string]interface{}{"value": -1.0},
+		Timestamp:   time.Date(1969, 7, 20, 20, 17, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("Failed to write point: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/query?measurement=cpu&field=value&tags=host=server01", nil)
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp QueryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Count != 4 || len(resp.Points) != 4 || resp.Points[0].Value != -1.0 {
+		t.Fatalf("Expected the pre-1970 point followed by 3 points, got %+v", resp.Points)
+	}
+}
+
+// TestQueryHandler_Handle_Timeout tests that a query stopped by its context returns 503
+func TestQueryHandler_Handle_Timeout(t *testing.T) {
+	storageInstance := newQueryTestStorage(t)
+	target := "/query?measurement=cpu&field=value&start=0"
+
+	// A query outliving the configured timeout is abandoned
+	handler := NewQueryHandlerWithTimeout(storageInstance, time.Nanosecond)
+	w := httptest.NewRecorder()
+	handler.Handle(w, httptest.NewRequest(http.MethodGet, target, nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "timed out") {
+		t.Errorf("Expected status 503 for a timed out query, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// So is the query of a client that went away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	handler = NewQueryHandler(storageInstance)
+	w = httptest.NewRecorder()
+	handler.Handle(w, httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "canceled") {
+		t.Errorf("Expected status 503 for a canceled query, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Streamed formats fail the same way
+	for _, format := range []string{"ndjson", "csv", "line"} {
+		w = httptest.NewRecorder()
+		handler.Handle(w, httptest.NewRequest(http.MethodGet, target+"&format="+format, nil).WithContext(ctx))
+		if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "canceled") {
+			t.Errorf("Expected status 503 for a canceled %s query, got %d: %s", format, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"net/http"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/query"
+	"timeseriesdb/internal/storage"
+)
+
+// RetentionHandler handles the /retention endpoint for managing retention policies
+type RetentionHandler struct {
+	BaseHandler
+	storage *storage.Storage
+}
+
+// RetentionPolicy is the JSON form of a retention policy. An empty
+// measurement means the policy covers the whole database.
+type RetentionPolicy struct {
+	Measurement string `json:"measurement,omitempty"`
+	Duration    string `json:"duration"`
+}
+
+// RetentionResponse is the JSON body listing the retention policies of a database
+type RetentionResponse struct {
+	Database string            `json:"database"`
+	Policies []RetentionPolicy `json:"policies"`
+}
+
+// NewRetentionHandler creates a new retention handler instance
+func NewRetentionHandler(storage *storage.Storage) *RetentionHandler {
+	return &RetentionHandler{
+		storage: storage,
+	}
+}
+
+// Handle lists the retention policies of the database named by the db
+// parameter on GET, sets a policy on POST and removes one on DELETE. The
+// measurement parameter selects a measurement policy, and without it the
+// database-wide policy is used.
+func (h *RetentionHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	db, err := h.storage.GetDatabase(params.Get("db"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	measurement := params.Get("measurement")
+
+	switch r.Method {
+	case http.MethodGet:
+		h.list(w, db)
+	case http.MethodPost:
+		raw := params.Get("duration")
+		if raw == "" {
+			h.WriteError(w, http.StatusBadRequest, "Bad request: missing duration")
+			return
+		}
+		duration, err := query.ParseDuration(raw)
+		if err != nil {
+			h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+			return
+		}
+		if err := db.SetRetentionPolicy(measurement, duration); err != nil {
+			h.writeError(w, err)
+			return
+		}
+		h.list(w, db)
+	case http.MethodDelete:
+		if err := db.DeleteRetentionPolicy(measurement); err != nil {
+			h.writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		h.MethodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+// list writes the retention policies of a database
+func (h *RetentionHandler) list(w http.ResponseWriter, db *storage.Database) {
+	policies := db.RetentionPolicies()
+
+	resp := RetentionResponse{
+		Database: db.Name(),
+		Policies: make([]RetentionPolicy, 0, len(policies)),
+	}
+	for _, p := range policies {
+		resp.Policies = append(resp.Policies, RetentionPolicy{
+			Measurement: p.Measurement,
+			Duration:    query.FormatDuration(p.Duration),
+		})
+	}
+	h.WriteJSON(w, http.StatusOK, resp)
+}
+
+// writeError maps a storage error onto a response status
+func (h *RetentionHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.IsType(err, errors.ErrorTypeValidation):
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+	case errors.IsType(err, errors.ErrorTypeNotFound):
+		h.WriteError(w, http.StatusNotFound, "Not found: "+err.Error())
+	default:
+		logger.Errorf("Retention policy operation failed: %v", err)
+		h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+)
+
+func TestRetentionHandler_Handle(t *testing.T) {
+	logger.Init()
+
+	storageInstance := storage.NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	defer storageInstance.Close()
+	if _, err := storageInstance.CreateDatabase("metrics"); err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	handler := NewRetentionHandler(storageInstance)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Handle(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	if w := do(http.MethodPost, "/retention?db=metrics&duration=30d"); w.Code != http.StatusOK {
+		t.Fatalf("Set database policy: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w := do(http.MethodPost, "/retention?db=metrics&measurement=cpu&duration=1w")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Set measurement policy: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp RetentionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", w.Body.String(), err)
+	}
+	want := RetentionResponse{Database: "metrics", Policies: []RetentionPolicy{{Duration: "30d"}, {Measurement: "cpu", Duration: "1w"}}}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("Got %+v, want %+v", resp, want)
+	}
+
+	// The default database is unaffected
+	w = do(http.MethodGet, "/retention")
+	resp = RetentionResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Database != "default" || len(resp.Policies) != 0 {
+		t.Errorf("Expected no policies on the default database, got %q", w.Body.String())
+	}
+
+	if w := do(http.MethodDelete, "/retention?db=metrics&measurement=cpu"); w.Code != http.StatusNoContent {
+		t.Errorf("Delete: expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	errorCases := []struct {
+		name   string
+		method string
+		target string
+		status int
+		body   string
+	}{
+		{"delete missing", http.MethodDelete, "/retention?db=metrics&measurement=cpu", http.StatusNotFound, "no retention policy"},
+		{"missing duration", http.MethodPost, "/retention?db=metrics", http.StatusBadRequest, "missing duration"},
+		{"invalid duration", http.MethodPost, "/retention?duration=soon", http.StatusBadRequest, "invalid duration"},
+		{"zero duration", http.MethodPost, "/retention?duration=0s", http.StatusBadRequest, "must be positive"},
+		{"unknown database", http.MethodGet, "/retention?db=missing", http.StatusNotFound, "not found"},
+		{"method not allowed", http.MethodPut, "/retention", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do(tc.method, tc.target)
+			if w.Code != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tc.body) {
+				t.Errorf("Expected body to contain %q, got %q", tc.body, w.Body.String())
+			}
+		})
+	}
+}
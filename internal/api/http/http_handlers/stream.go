@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"timeseriesdb/internal/ingestion"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+	"timeseriesdb/internal/types"
+)
+
+// Formats of /query responses. Every format but JSON is streamed.
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+	formatLine   = "line"
+)
+
+// formatContentTypes maps each response format to its content type
+var formatContentTypes = map[string]string{
+	formatJSON:   "application/json",
+	formatNDJSON: "application/x-ndjson",
+	formatCSV:    "text/csv; charset=utf-8",
+	formatLine:   "text/plain; charset=utf-8",
+}
+
+// acceptedFormats maps the media types of an Accept header to response formats
+var acceptedFormats = map[string]string{
+	"application/json":     formatJSON,
+	"application/x-ndjson": formatNDJSON,
+	"application/ndjson":   formatNDJSON,
+	"text/csv":             formatCSV,
+	"text/plain":           formatLine,
+}
+
+// streamFlushPoints is the number of points written between two flushes of a
+// streamed response
+const streamFlushPoints = 1000
+
+// streamErrorTrailer is the trailer reporting a read that failed after a
+// streamed response started
+const streamErrorTrailer = "X-Stream-Error"
+
+// responseFormat returns the format of a /query response and whether it was
+// requested explicitly with the format parameter. Otherwise the first media
+// type of the Accept header naming a format is used, and JSON by default.
+func responseFormat(r *http.Request) (string, bool, error) {
+	if format := r.Form.Get("format"); format != "" {
+		format = strings.ToLower(format)
+		if _, ok := formatContentTypes[format]; !ok {
+			return "", true, fmt.Errorf("unknown format '%s'", format)
+		}
+		return format, true, nil
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		if format, ok := acceptedFormats[mediaType]; ok {
+			return format, false, nil
+		}
+	}
+	return formatJSON, false, nil
+}
+
+// pointEncoder writes points in one streamed format
+type pointEncoder interface {
+	encode(p types.Point) error
+}
+
+// ndjsonEncoder writes each point as a JSON object on its own line
+type ndjsonEncoder struct {
+	enc   *json.Encoder
+	field string
+}
+
+func (e *ndjsonEncoder) encode(p types.Point) error {
+	return e.enc.Encode(QueryPoint{Timestamp: p.Timestamp, Tags: p.Tags, Value: p.Fields[e.field]})
+}
+
+// csvEncoder writes each point as a CSV record of its time, its tags and its value
+type csvEncoder struct {
+	w       *csv.Writer
+	tagKeys []string
+	field   string
+	record  []string
+}
+
+func (e *csvEncoder) encode(p types.Point) error {
+	e.record = e.record[:0]
+	e.record = append(e.record, p.Timestamp.UTC().Format(time.RFC3339Nano))
+	for _, k := range e.tagKeys {
+		e.record = append(e.record, p.Tags[k])
+	}
+	e.record = append(e.record, formatCSVValue(p.Fields[e.field]))
+	return e.w.Write(e.record)
+}
+
+// formatCSVValue formats a field value as a CSV cell
+func formatCSVValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+// lineEncoder writes each point as a line of line protocol
+type lineEncoder struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+func (e *lineEncoder) encode(p types.Point) error {
+	e.buf = ingestion.AppendLineProtocol(e.buf[:0], p)
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+// streamPoints writes the points of an iterator in a streamed format. The
+// response is flushed every streamFlushPoints points, so it is sent in chunks
+// as the points are read. A read failing before the first point is written
+// gets an error response; once the response has started, the failure is
+// reported in the X-Stream-Error trailer instead.
+func (h *QueryHandler) streamPoints(w http.ResponseWriter, it *storage.PointIterator, format, field string) {
+	more := it.Next()
+	if err := it.Err(); err != nil {
+		if h.WriteContextError(w, err) {
+			return
+		}
+		logger.Errorf("Failed to read points: %v", err)
+		h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	w.Header().Set("Trailer", streamErrorTrailer)
+	w.WriteHeader(http.StatusOK)
+
+	out := bufio.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+	flush := func() error {
+		if err := out.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	var enc pointEncoder
+	var csvWriter *csv.Writer
+	switch format {
+	case formatNDJSON:
+		enc = &ndjsonEncoder{enc: json.NewEncoder(out), field: field}
+	case formatCSV:
+		csvWriter = csv.NewWriter(out)
+		header := append(append([]string{"time"}, it.TagKeys()...), field)
+		if err := csvWriter.Write(header); err != nil {
+			logger.Debugf("Failed to write streamed response: %v", err)
+			return
+		}
+		enc = &csvEncoder{w: csvWriter, tagKeys: it.TagKeys(), field: field}
+	default:
+		enc = &lineEncoder{w: out}
+	}
+
+	for n := 1; more; n++ {
+		if err := enc.encode(it.Point()); err != nil {
+			// The client went away
+			logger.Debugf("Failed to write streamed response: %v", err)
+			return
+		}
+		if n%streamFlushPoints == 0 {
+			if csvWriter != nil {
+				csvWriter.Flush()
+			}
+			if err := flush(); err != nil {
+				logger.Debugf("Failed to write streamed response: %v", err)
+				return
+			}
+		}
+		more = it.Next()
+	}
+
+	if csvWriter != nil {
+		csvWriter.Flush()
+	}
+	if err := flush(); err != nil {
+		logger.Debugf("Failed to write streamed response: %v", err)
+		return
+	}
+
+	if err := it.Err(); err != nil {
+		logger.Errorf("Streamed read failed: %v", err)
+		w.Header().Set(streamErrorTrailer, err.Error())
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"timeseriesdb/internal/ingestion"
+)
+
+// streamRequest runs a single field read of the seeded cpu points
+func streamRequest(t *testing.T, handler *QueryHandler, params url.Values, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	params.Set("measurement", "cpu")
+	params.Set("start", "1434055562000000000")
+	params.Set("end", "1434055572000000000")
+
+	req := httptest.NewRequest(http.MethodGet, "/query?"+params.Encode(), nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+	return w
+}
+
+func TestQueryHandler_Stream_NDJSON(t *testing.T) {
+	handler := NewQueryHandler(newQueryTestStorage(t))
+
+	w := streamRequest(t, handler, url.Values{"format": {"ndjson"}}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected an NDJSON content type, got %q", ct)
+	}
+
+	scanner := bufio.NewScanner(w.Body)
+	var points []QueryPoint
+	for scanner.Scan() {
+		var p QueryPoint
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			t.Fatalf("Failed to decode line %q: %v", scanner.Text(), err)
+		}
+		points = append(points, p)
+	}
+	if len(points) != 3 {
+		t.Fatalf("Expected 3 lines, got %d", len(points))
+	}
+	for i, p := range points {
+		if p.Value != float64(i) || p.Tags["host"] != "server01" || !p.Timestamp.Equal(time.Unix(1434055562+int64(i), 0)) {
+			t.Errorf("Unexpected point %d: %+v", i, p)
+		}
+	}
+}
+
+func TestQueryHandler_Stream_CSV(t *testing.T) {
+	handler := NewQueryHandler(newQueryTestStorage(t))
+
+	w := streamRequest(t, handler, url.Values{"limit": {"2"}}, "text/csv")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Expected a CSV content type, got %q", ct)
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	want := [][]string{
+		{"time", "host", "region", "value"},
+		{"2015-06-11T20:46:02Z", "server01", "us-west", "0"},
+		{"2015-06-11T20:46:03Z", "server01", "us-west", "1"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Got %v, want %v", records, want)
+	}
+	for i := range want {
+		if strings.Join(records[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("Record %d is %v, want %v", i, records[i], want[i])
+		}
+	}
+}
+
+func TestQueryHandler_Stream_LineProtocol(t *testing.T) {
+	handler := NewQueryHandler(newQueryTestStorage(t))
+
+	w := streamRequest(t, handler, url.Values{"format": {"line"}}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The response can be written back as is
+	points, err := ingestion.ParseLineProtocol(w.Body.String())
+	if err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(points) != 3 {
+		t.Fatalf("Expected 3 points, got %d", len(points))
+	}
+	if p := points[2]; p.Measurement != "cpu" || p.Tags["region"] != "us-west" || p.Fields["value"] != float64(2) {
+		t.Errorf("Unexpected point %+v", p)
+	}
+}
+
+func TestQueryHandler_Stream_Formats(t *testing.T) {
+	handler := NewQueryHandler(newQueryTestStorage(t))
+
+	tests := []struct {
+		name        string
+		params      url.Values
+		accept      string
+		status      int
+		contentType string
+	}{
+		{"default", url.Values{}, "", http.StatusOK, "application/json"},
+		{"accept json", url.Values{}, "application/json", http.StatusOK, "application/json"},
+		{"accept list", url.Values{}, "text/html, application/x-ndjson;q=0.9", http.StatusOK, "application/x-ndjson"},
+		{"unknown accept", url.Values{}, "text/html", http.StatusOK, "application/json"},
+		{"format wins over accept", url.Values{"format": {"CSV"}}, "application/x-ndjson", http.StatusOK, "text/csv; charset=utf-8"},
+		{"unknown format", url.Values{"format": {"xml"}}, "", http.StatusBadRequest, ""},
+		{"accept falls back for multiple fields", url.Values{"fields": {"value"}}, "text/csv", http.StatusOK, "application/json"},
+		{"format with multiple fields", url.Values{"fields": {"value"}, "format": {"csv"}}, "", http.StatusBadRequest, ""},
+		{"format with mode=last", url.Values{"mode": {"last"}, "format": {"ndjson"}}, "", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := streamRequest(t, handler, tt.params, tt.accept)
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.contentType != "" && w.Header().Get("Content-Type") != tt.contentType {
+				t.Errorf("Expected content type %q, got %q", tt.contentType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -4,21 +4,34 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
+	"timeseriesdb/internal/errors"
 	"timeseriesdb/internal/ingestion"
 	"timeseriesdb/internal/logger"
 	"timeseriesdb/internal/storage"
+	"timeseriesdb/internal/types"
 )
 
 // WriteHandler handles the /write endpoint for InfluxDB line protocol
 type WriteHandler struct {
 	BaseHandler
 	storage *storage.Storage
+	// precision is the timestamp unit of requests without a precision parameter
+	precision time.Duration
 }
 
-// NewWriteHandler creates a new write handler instance
+// NewWriteHandler creates a new write handler instance that defaults to
+// nanosecond timestamps
 func NewWriteHandler(storage *storage.Storage) *WriteHandler {
+	return NewWriteHandlerWithPrecision(storage, time.Nanosecond)
+}
+
+// NewWriteHandlerWithPrecision creates a write handler whose requests default
+// to the given timestamp precision
+func NewWriteHandlerWithPrecision(storage *storage.Storage, precision time.Duration) *WriteHandler {
 	return &WriteHandler{
-		storage: storage,
+		storage:   storage,
+		precision: precision,
 	}
 }
 
@@ -31,6 +44,15 @@ func (h *WriteHandler) Handle(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 
+	precision := h.precision
+	if name := r.URL.Query().Get("precision"); name != "" {
+		var err error
+		if precision, err = ingestion.ParsePrecision(name); err != nil {
+			h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
+			return
+		}
+	}
+
 	// Handle negative or zero ContentLength
 	if r.ContentLength <= 0 {
 		h.WriteError(w, http.StatusBadRequest, "Bad request")
@@ -49,25 +71,70 @@ func (h *WriteHandler) Handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	db, err := h.storage.GetDatabase(r.URL.Query().Get("db"))
+	if err != nil {
+		h.WriteDatabaseError(w, err)
+		return
+	}
+
 	// Parse the full body
-	points, err := ingestion.ParseLineProtocol(string(lines[:n]))
+	points, err := ingestion.ParseLineProtocolWithPrecision(string(lines[:n]), precision)
 	if err != nil {
 		logger.Errorf("Failed to parse line protocol: %v", err)
-		h.WriteError(w, http.StatusBadRequest, "Bad request")
+		h.WriteError(w, http.StatusBadRequest, "Bad request: "+err.Error())
 		return
 	}
 
-	// Write points to storage
+	successCount, failed, ok := h.writePoints(w, r, db, points)
+	if !ok {
+		return
+	}
+
+	logger.Infof("Wrote %d points successfully", successCount)
+	if len(failed) > 0 {
+		h.writeRejected(w, failed, len(points))
+		return
+	}
+	fmt.Fprint(w, "OK")
+}
+
+// writeRejected answers a write whose points were not all stored: 400 when
+// the storage rejected them, such as for a field type conflict, and 500 when
+// it failed to write any of them. The other points of the request are stored.
+func (h *BaseHandler) writeRejected(w http.ResponseWriter, failed []pointError, total int) {
+	for _, f := range failed {
+		if !errors.IsType(f.err, errors.ErrorTypeValidation) {
+			h.WriteError(w, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+	}
+	h.WriteError(w, http.StatusBadRequest, fmt.Sprintf("Bad request: %d of %d points rejected: %v", len(failed), total, failed[0].err))
+}
+
+// pointError is the failure to write one point of a request
+type pointError struct {
+	point types.Point
+	err   error
+}
+
+// writePoints writes points to db in order, logging those the storage
+// rejects and carrying on with the others. It stops if the client goes away
+// or the request times out, reporting false once it has answered the request.
+func (h *BaseHandler) writePoints(w http.ResponseWriter, r *http.Request, db *storage.Database, points []types.Point) (int, []pointError, bool) {
 	successCount := 0
+	var failed []pointError
 	for _, p := range points {
-		err := h.storage.WritePoint(p)
+		err := db.WritePoint(r.Context(), p)
 		if err != nil {
+			if h.WriteContextError(w, err) {
+				logger.Warnf("Write canceled after %d of %d points", successCount, len(points))
+				return successCount, failed, false
+			}
 			logger.Errorf("Failed to write point: %v", err)
+			failed = append(failed, pointError{point: p, err: err})
 		} else {
 			successCount++
 		}
 	}
-
-	logger.Infof("Wrote %d points successfully", successCount)
-	fmt.Fprint(w, "OK")
+	return successCount, failed, true
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 	"timeseriesdb/internal/config"
 	"timeseriesdb/internal/logger"
 	"timeseriesdb/internal/storage"
@@ -86,6 +88,133 @@ func TestWriteHandler_Handle_ValidRequest(t *testing.T) {
 	}
 }
 
+// TestWriteHandler_Handle_MissingTimestamp tests that points without a
+// timestamp are stored at the server time
+func TestWriteHandler_Handle_MissingTimestamp(t *testing.T) {
+	logger.Init()
+
+	storageInstance := storage.NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	defer storageInstance.Close()
+
+	handler := NewWriteHandler(storageInstance)
+
+	data := "cpu,host=server01 value=0.64"
+	req := httptest.NewRequest("POST", "/write", strings.NewReader(data))
+	req.ContentLength = int64(len(data))
+
+	before := time.Now()
+	w := httptest.NewRecorder()
+	handler.Handle(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	points, err := storageInstance.ReadPoints(context.Background(), "cpu", map[string]string{"host": "server01"}, "value", before, time.Now(), 0)
+	if err != nil {
+		t.Fatalf("Failed to read points: %v", err)
+	}
+	if len(points) != 1 {
+		t.Errorf("Expected 1 point stamped with the server time, got %d", len(points))
+	}
+}
+
+// TestWriteHandler_Handle_FieldTypeConflict tests that points rejected by the
+// storage fail the request while the others are written
+func TestWriteHandler_Handle_FieldTypeConflict(t *testing.T) {
+	logger.Init()
+
+	storageInstance := storage.NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	defer storageInstance.Close()
+
+	handler := NewWriteHandler(storageInstance)
+	write := func(data string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/write", strings.NewReader(data))
+		req.ContentLength = int64(len(data))
+		w := httptest.NewRecorder()
+		handler.Handle(w, req)
+		return w
+	}
+
+	if w := write("cpu value=1 1000"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := write("cpu value=\"x\" 2000\nmem value=2 2000")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if body := w.Body.String(); !strings.Contains(body, "1 of 2 points rejected") || !strings.Contains(body, "field type conflict") {
+		t.Errorf("Expected a field type conflict error, got %q", body)
+	}
+
+	points, err := storageInstance.ReadPoints(context.Background(), "mem", nil, "value", time.Unix(0, 0), time.Unix(1, 0), 0)
+	if err != nil {
+		t.Fatalf("Failed to read points: %v", err)
+	}
+	if len(points) != 1 {
+		t.Errorf("Expected the other point to be written, got %d points", len(points))
+	}
+}
+
+// TestWriteHandler_Handle_Precision tests the precision parameter and the
+// handler default
+func TestWriteHandler_Handle_Precision(t *testing.T) {
+	logger.Init()
+
+	storageInstance := storage.NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	defer storageInstance.Close()
+
+	tests := []struct {
+		name     string
+		handler  *WriteHandler
+		query    string
+		host     string
+		data     string
+		want     time.Time
+		wantCode int
+	}{
+		{"seconds", NewWriteHandler(storageInstance), "?precision=s", "a", "cpu,host=a value=1 1434055562", time.Unix(1434055562, 0), http.StatusOK},
+		{"milliseconds", NewWriteHandler(storageInstance), "?precision=ms", "b", "cpu,host=b value=1 1434055562123", time.Unix(1434055562, 123000000), http.StatusOK},
+		{"handler default", NewWriteHandlerWithPrecision(storageInstance, time.Microsecond), "", "c", "cpu,host=c value=1 1434055562000001", time.Unix(1434055562, 1000), http.StatusOK},
+		{"parameter overrides default", NewWriteHandlerWithPrecision(storageInstance, time.Second), "?precision=ns", "d", "cpu,host=d value=1 1434055562000000001", time.Unix(1434055562, 1), http.StatusOK},
+		{"invalid precision", NewWriteHandler(storageInstance), "?precision=days", "e", "cpu,host=e value=1 1", time.Time{}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/write"+tt.query, strings.NewReader(tt.data))
+			req.ContentLength = int64(len(tt.data))
+			w := httptest.NewRecorder()
+			tt.handler.Handle(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			points, err := storageInstance.ReadPoints(context.Background(), "cpu", map[string]string{"host": tt.host}, "value", tt.want, tt.want, 0)
+			if err != nil {
+				t.Fatalf("Failed to read points: %v", err)
+			}
+			if len(points) != 1 {
+				t.Errorf("Expected a point at %v, got %+v", tt.want, points)
+			}
+		})
+	}
+}
+
 // TestWriteHandler_Handle_InvalidMethod tests that only POST method is allowed
 func TestWriteHandler_Handle_InvalidMethod(t *testing.T) {
 	// Initialize logger for testing
@@ -299,8 +428,8 @@ func TestWriteHandler_Handle_MalformedLineProtocol(t *testing.T) {
 
 	handler := NewWriteHandler(storageInstance)
 
-	// Malformed line protocol data (missing timestamp)
-	malformedData := "cpu,host=server01 value=0.64"
+	// Malformed line protocol data (missing field value)
+	malformedData := "cpu,host=server01 value="
 	req := httptest.NewRequest("POST", "/write", strings.NewReader(malformedData))
 	req.ContentLength = int64(len(malformedData))
 
@@ -311,6 +440,9 @@ func TestWriteHandler_Handle_MalformedLineProtocol(t *testing.T) {
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status 400, got %d", w.Code)
 	}
+	if body := w.Body.String(); !strings.Contains(body, "line 1, column 25") {
+		t.Errorf("Expected the error position in the response, got %q", body)
+	}
 }
 
 // TestWriteHandler_Handle_EmptyLineProtocol tests handling of empty line protocol
@@ -736,6 +868,9 @@ func TestWriteHandler_Handle_WithQueryParameters(t *testing.T) {
 		os.RemoveAll("test_backups_query_params")
 	}()
 
+	if _, err := storageInstance.CreateDatabase("mydb"); err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
 	handler := NewWriteHandler(storageInstance)
 
 	// Valid line protocol data with query parameters in URL
@@ -2,6 +2,7 @@ package http
 
 import (
 	"net/http"
+	"time"
 	handlers "timeseriesdb/internal/api/http/http_handlers"
 	"timeseriesdb/internal/api/middleware"
 	"timeseriesdb/internal/metrics"
@@ -13,15 +14,49 @@ import (
 // Router manages all API routes and handlers
 type Router struct {
 	writeHandler      *handlers.WriteHandler
+	queryHandler      *handlers.QueryHandler
 	healthHandler     *handlers.HealthHandler
+	databaseHandler   *handlers.DatabaseHandler
+	retentionHandler  *handlers.RetentionHandler
+	cqHandler         *handlers.ContinuousQueryHandler
+	deleteHandler     *handlers.DeleteHandler
+	lastHandler       *handlers.LastHandler
+	prometheusHandler *handlers.PrometheusHandler
+	openTSDBHandler   *handlers.OpenTSDBHandler
 	metricsMiddleware *middleware.MetricsMiddleware
 }
 
+// RouterOptions configures the handlers of a router
+type RouterOptions struct {
+	// WritePrecision is the timestamp precision of /write requests without a
+	// precision parameter, nanoseconds when zero
+	WritePrecision time.Duration
+	// QueryTimeout bounds the time spent on each query, zero for no limit
+	QueryTimeout time.Duration
+}
+
 // NewRouter creates a new router instance with all handlers
 func NewRouter(storage *storage.Storage) *Router {
+	return NewRouterWithOptions(storage, RouterOptions{})
+}
+
+// NewRouterWithOptions creates a new router whose handlers are configured by opts
+func NewRouterWithOptions(storage *storage.Storage, opts RouterOptions) *Router {
+	if opts.WritePrecision <= 0 {
+		opts.WritePrecision = time.Nanosecond
+	}
+
 	return &Router{
-		writeHandler:      handlers.NewWriteHandler(storage),
+		writeHandler:      handlers.NewWriteHandlerWithPrecision(storage, opts.WritePrecision),
+		queryHandler:      handlers.NewQueryHandlerWithTimeout(storage, opts.QueryTimeout),
 		healthHandler:     handlers.NewHealthHandler(),
+		databaseHandler:   handlers.NewDatabaseHandler(storage),
+		retentionHandler:  handlers.NewRetentionHandler(storage),
+		cqHandler:         handlers.NewContinuousQueryHandler(storage),
+		deleteHandler:     handlers.NewDeleteHandler(storage),
+		lastHandler:       handlers.NewLastHandler(storage),
+		prometheusHandler: handlers.NewPrometheusHandlerWithTimeout(storage, opts.QueryTimeout),
+		openTSDBHandler:   handlers.NewOpenTSDBHandler(storage),
 		metricsMiddleware: middleware.NewMetricsMiddleware(),
 	}
 }
@@ -30,7 +65,22 @@ func NewRouter(storage *storage.Storage) *Router {
 func (r *Router) RegisterRoutes() {
 	// Wrap handlers with metrics middleware
 	http.Handle("/write", r.metricsMiddleware.Wrap(http.HandlerFunc(r.writeHandler.Handle)))
+	http.Handle("/query", r.metricsMiddleware.Wrap(http.HandlerFunc(r.queryHandler.Handle)))
 	http.Handle("/health", r.metricsMiddleware.Wrap(http.HandlerFunc(r.healthHandler.Handle)))
+	http.Handle("/databases", r.metricsMiddleware.Wrap(http.HandlerFunc(r.databaseHandler.Handle)))
+	http.Handle("/retention", r.metricsMiddleware.Wrap(http.HandlerFunc(r.retentionHandler.Handle)))
+	http.Handle("/continuous_queries", r.metricsMiddleware.Wrap(http.HandlerFunc(r.cqHandler.Handle)))
+	http.Handle("/delete", r.metricsMiddleware.Wrap(http.HandlerFunc(r.deleteHandler.Handle)))
+	http.Handle("/last", r.metricsMiddleware.Wrap(http.HandlerFunc(r.lastHandler.Handle)))
+	// Prometheus-compatible query API
+	http.Handle("/api/v1/query", r.metricsMiddleware.Wrap(http.HandlerFunc(r.prometheusHandler.HandleQuery)))
+	http.Handle("/api/v1/query_range", r.metricsMiddleware.Wrap(http.HandlerFunc(r.prometheusHandler.HandleQueryRange)))
+	http.Handle("/api/v1/labels", r.metricsMiddleware.Wrap(http.HandlerFunc(r.prometheusHandler.HandleLabels)))
+	http.Handle("/api/v1/label/{name}/values", r.metricsMiddleware.Wrap(http.HandlerFunc(r.prometheusHandler.HandleLabelValues)))
+	http.Handle("/api/v1/series", r.metricsMiddleware.Wrap(http.HandlerFunc(r.prometheusHandler.HandleSeries)))
+	http.Handle("/api/v1/write", r.metricsMiddleware.Wrap(http.HandlerFunc(r.prometheusHandler.HandleWrite)))
+	http.Handle("/api/v1/read", r.metricsMiddleware.Wrap(http.HandlerFunc(r.prometheusHandler.HandleRead)))
+	http.Handle("/api/put", r.metricsMiddleware.Wrap(http.HandlerFunc(r.openTSDBHandler.Handle)))
 	// Expose Prometheus metrics endpoint
 	http.Handle("/metrics", promhttp.HandlerFor(metrics.GetRegistry(), promhttp.HandlerOpts{}))
 }
@@ -40,7 +90,22 @@ func (r *Router) GetMux() *http.ServeMux {
 	mux := http.NewServeMux()
 	// Wrap handlers with metrics middleware
 	mux.Handle("/write", r.metricsMiddleware.Wrap(http.HandlerFunc(r.writeHandler.Handle)))
+	mux.Handle("/query", r.metricsMiddleware.Wrap(http.HandlerFunc(r.queryHandler.Handle)))
 	mux.Handle("/health", r.metricsMiddleware.Wrap(http.HandlerFunc(r.healthHandler.Handle)))
+	mux.Handle("/databases", r.metricsMiddleware.Wrap(http.HandlerFunc(r.databaseHandler.Handle)))
+	mux.Handle("/retention", r.metricsMiddleware.Wrap(http.HandlerFunc(r.retentionHandler.Handle)))
+	mux.Handle("/continuous_queries", r.metricsMiddleware.Wrap(http.HandlerFunc(r.cqHandler.Handle)))
+	mux.Handle("/delete", r.metricsMiddleware.Wrap(http.HandlerFunc(r.deleteHandler.Handle)))
+	mux.Handle("/last", r.metricsMiddleware.Wrap(http.HandlerFunc(r.lastHandler.Handle)))
+	// Prometheus-compatible query API
+	mux.Handle("/api/v1/query", r.metricsMiddleware.Wrap(http.HandlerFunc(r.prometheusHandler.HandleQuery)))
+	mux.Handle("/api/v1/query_range", r.metricsMiddleware.Wrap(http.HandlerFunc(r.prometheusHandler.HandleQueryRange)))
+	mux.Handle("/api/v1/labels", r.metricsMiddleware.Wrap(http.HandlerFunc(r.prometheusHandler.HandleLabels)))
+	mux.Handle("/api/v1/label/{name}/values", r.metricsMiddleware.Wrap(http.HandlerFunc(r.prometheusHandler.HandleLabelValues)))
+	mux.Handle("/api/v1/series", r.metricsMiddleware.Wrap(http.HandlerFunc(r.prometheusHandler.HandleSeries)))
+	mux.Handle("/api/v1/write", r.metricsMiddleware.Wrap(http.HandlerFunc(r.prometheusHandler.HandleWrite)))
+	mux.Handle("/api/v1/read", r.metricsMiddleware.Wrap(http.HandlerFunc(r.prometheusHandler.HandleRead)))
+	mux.Handle("/api/put", r.metricsMiddleware.Wrap(http.HandlerFunc(r.openTSDBHandler.Handle)))
 	// Expose Prometheus metrics endpoint
 	mux.Handle("/metrics", promhttp.HandlerFor(metrics.GetRegistry(), promhttp.HandlerOpts{}))
 	return mux
@@ -67,6 +67,28 @@ func TestRouter_RegisterRoutes(t *testing.T) {
 		t.Errorf("Expected write endpoint to return 405 for GET, got %d", resp.StatusCode)
 	}
 
+	// Test query endpoint (should return 400 without a measurement)
+	resp, err = http.Get(server.URL + "/query")
+	if err != nil {
+		t.Fatalf("Failed to make request to query endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected query endpoint to return 400 without measurement, got %d", resp.StatusCode)
+	}
+
+	// Test Prometheus query endpoint (should return 400 without a query)
+	resp, err = http.Get(server.URL + "/api/v1/query")
+	if err != nil {
+		t.Fatalf("Failed to make request to Prometheus query endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected Prometheus query endpoint to return 400 without query, got %d", resp.StatusCode)
+	}
+
 	// Test metrics endpoint
 	resp, err = http.Get(server.URL + "/metrics")
 	if err != nil {
@@ -0,0 +1,192 @@
+// Package opentsdb implements the telnet protocol of OpenTSDB, in which
+// clients write data points with one `put <metric> <timestamp> <value>
+// <tagk=tagv>...` command per line over a TCP connection.
+package opentsdb
+
+import (
+	"bufio"
+	"context"
+	stderrors "errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/ingestion"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+)
+
+// maxLineLength is the longest command accepted, past which the connection
+// is closed
+const maxLineLength = 64 << 10
+
+// version is the reply to the version command
+const version = "timeseriesdb OpenTSDB telnet listener\n"
+
+// help is the reply to the help command
+const help = "available commands: exit help put version\n"
+
+// TelnetServer writes the data points put by OpenTSDB telnet clients to the
+// default database. Successful puts get no reply, as in OpenTSDB, while
+// failed ones are answered with a "put: " line giving the error.
+type TelnetServer struct {
+	storage *storage.Storage
+	// ctx is canceled on Close to stop writes in progress
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewTelnetServer creates a telnet server writing to storage
+func NewTelnetServer(storage *storage.Storage) *TelnetServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &TelnetServer{
+		storage:   storage,
+		ctx:       ctx,
+		cancel:    cancel,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// Serve accepts connections on ln until it fails or the server is closed,
+// returning nil in the latter case. ln is closed on return.
+func (s *TelnetServer) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return nil
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, ln)
+		s.mu.Unlock()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return errors.WrapWithType(err, errors.ErrorTypeNetwork, "failed to accept OpenTSDB telnet connection")
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops accepting connections, closes those open and waits for their
+// commands to finish
+func (s *TelnetServer) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.cancel()
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+// track registers an accepted connection, reporting false once the server
+// is closed
+func (s *TelnetServer) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+// serveConn runs the commands of a connection, one per line, until the
+// client exits or disconnects
+func (s *TelnetServer) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineLength)
+	for number := 1; scanner.Scan(); number++ {
+		reply, exit := s.runCommand(scanner.Text(), number)
+		if reply != "" {
+			if _, err := io.WriteString(conn, reply); err != nil {
+				return
+			}
+		}
+		if exit {
+			return
+		}
+	}
+
+	if err := scanner.Err(); stderrors.Is(err, bufio.ErrTooLong) {
+		logger.Warnf("Closing OpenTSDB telnet connection from %s: line longer than %d bytes", conn.RemoteAddr(), maxLineLength)
+		io.WriteString(conn, "put: line too long\n")
+	}
+}
+
+// runCommand runs the command on a line, returning its reply and whether the
+// connection should be closed
+func (s *TelnetServer) runCommand(line string, number int) (string, bool) {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return "", false
+	}
+
+	switch words[0] {
+	case "put":
+		p, err := ingestion.ParseOpenTSDBPut(line, number)
+		if err == nil {
+			err = s.storage.WritePoint(s.ctx, p)
+			if err != nil && !errors.IsType(err, errors.ErrorTypeValidation) {
+				logger.Errorf("Failed to write OpenTSDB data point: %v", err)
+			}
+		}
+		if err != nil {
+			return "put: " + err.Error() + "\n", false
+		}
+		return "", false
+	case "version":
+		return version, false
+	case "help":
+		return help, false
+	case "exit":
+		return "", true
+	}
+	return "unknown command: " + words[0] + ".  Try `help'.\n", false
+}
@@ -0,0 +1,144 @@
+package opentsdb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+)
+
+// startTelnetServer serves a telnet server over an empty storage on a local
+// port, returning the server and its address
+func startTelnetServer(t *testing.T) (*TelnetServer, *storage.Storage, string) {
+	t.Helper()
+
+	logger.Init()
+
+	storageInstance := storage.NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	t.Cleanup(func() { storageInstance.Close() })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	server := NewTelnetServer(storageInstance)
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(ln) }()
+	t.Cleanup(func() {
+		server.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve failed: %v", err)
+		}
+	})
+
+	return server, storageInstance, ln.Addr().String()
+}
+
+// sendCommands writes lines to a connection followed by a version command,
+// returning the replies read up to the version reply
+func sendCommands(t *testing.T, conn net.Conn, r *bufio.Reader, lines ...string) []string {
+	t.Helper()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := fmt.Fprint(conn, strings.Join(append(lines, "version"), "\n")+"\n"); err != nil {
+		t.Fatalf("Failed to send commands: %v", err)
+	}
+
+	var replies []string
+	for {
+		reply, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read reply: %v", err)
+		}
+		if reply == version {
+			return replies
+		}
+		replies = append(replies, strings.TrimSuffix(reply, "\n"))
+	}
+}
+
+func TestTelnetServerPut(t *testing.T) {
+	_, storageInstance, addr := startTelnetServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	replies := sendCommands(t, conn, r,
+		"put sys.cpu.user 1700000000 42.5 host=web01 cpu=0",
+		"",
+		"put sys.cpu.user 1700000010000 43 host=web01 cpu=0\r",
+		"put sys.cpu.user 1700000020 high host=web01",
+		"get sys.cpu.user",
+	)
+	expected := []string{
+		`put: line 4, column 29: invalid value 'high': strconv.ParseFloat: parsing "high": invalid syntax`,
+		"unknown command: get.  Try `help'.",
+	}
+	if strings.Join(replies, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Got replies %q, want %q", replies, expected)
+	}
+
+	points, err := storageInstance.ReadPoints(context.Background(), "sys.cpu.user", map[string]string{"host": "web01", "cpu": "0"}, "value", time.Unix(1700000000, 0), time.Unix(1700000060, 0), 0)
+	if err != nil {
+		t.Fatalf("ReadPoints failed: %v", err)
+	}
+	if len(points) != 2 || points[1].Fields["value"] != 43.0 || !points[1].Timestamp.Equal(time.Unix(1700000010, 0)) {
+		t.Errorf("Unexpected points %+v", points)
+	}
+}
+
+func TestTelnetServerExit(t *testing.T) {
+	_, _, addr := startTelnetServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	if replies := sendCommands(t, conn, r, "help"); len(replies) != 1 || replies[0]+"\n" != help {
+		t.Errorf("Unexpected help replies %q", replies)
+	}
+
+	fmt.Fprint(conn, "exit\n")
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Error("Expected the connection to be closed after exit")
+	}
+}
+
+func TestTelnetServerClose(t *testing.T) {
+	server, _, addr := startTelnetServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	sendCommands(t, conn, r)
+
+	if err := server.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Error("Expected open connections to be closed")
+	}
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("Expected the listener to be closed")
+	}
+}
@@ -60,6 +60,9 @@ func (c *Config) String() string {
 		"  ReadTimeout: " + c.Server.ReadTimeout.String() + "\n" +
 		"  WriteTimeout: " + c.Server.WriteTimeout.String() + "\n" +
 		"  IdleTimeout: " + c.Server.IdleTimeout.String() + "\n" +
+		"  WritePrecision: " + c.Server.WritePrecision + "\n" +
+		"  QueryTimeout: " + c.Server.QueryTimeout.String() + "\n" +
+		"  OpenTSDBBindAddress: " + c.Server.OpenTSDBBindAddress + "\n" +
 		"Storage:\n" +
 		"  DataFile: " + c.Storage.DataFile + "\n" +
 		"  MaxFileSize: " + strconv.FormatInt(c.Storage.MaxFileSize, 10) + "\n" +
@@ -13,6 +13,14 @@ type ServerConfig struct {
 	WriteTimeout    time.Duration
 	IdleTimeout     time.Duration
 	ShutdownTimeout time.Duration
+	// WritePrecision is the timestamp precision of /write requests that do
+	// not give one: ns, us, ms, s, m or h
+	WritePrecision string
+	// QueryTimeout bounds the time spent on each query, zero for no limit
+	QueryTimeout time.Duration
+	// OpenTSDBBindAddress is the TCP address of the OpenTSDB telnet listener,
+	// such as :4242, empty to disable it
+	OpenTSDBBindAddress string
 }
 
 // NewServerConfig creates a new ServerConfig with default values
@@ -25,5 +33,9 @@ func NewServerConfig() ServerConfig {
 		WriteTimeout:    parser.Duration(envvars.WriteTimeout, envvars.DefaultWriteTimeout),
 		IdleTimeout:     parser.Duration(envvars.IdleTimeout, envvars.DefaultIdleTimeout),
 		ShutdownTimeout: parser.Duration(envvars.ShutdownTimeout, envvars.DefaultShutdownTimeout),
+		WritePrecision:  parser.String(envvars.WritePrecision, envvars.DefaultWritePrecision),
+		QueryTimeout:    parser.Duration(envvars.QueryTimeout, envvars.DefaultQueryTimeout),
+
+		OpenTSDBBindAddress: parser.String(envvars.OpenTSDBBindAddress, envvars.DefaultOpenTSDBBindAddress),
 	}
 }
@@ -16,6 +16,8 @@ func TestNewServerConfig(t *testing.T) {
 	assert.Equal(t, 30*time.Second, cfg.WriteTimeout)
 	assert.Equal(t, 120*time.Second, cfg.IdleTimeout)
 	assert.Equal(t, 30*time.Second, cfg.ShutdownTimeout)
+	assert.Equal(t, "ns", cfg.WritePrecision)
+	assert.Equal(t, "", cfg.OpenTSDBBindAddress)
 }
 
 func TestServerConfig(t *testing.T) {
@@ -33,11 +35,15 @@ func TestServerConfig(t *testing.T) {
 		os.Setenv("READ_TIMEOUT", "60")
 		os.Setenv("WRITE_TIMEOUT", "45")
 		os.Setenv("IDLE_TIMEOUT", "180")
+		os.Setenv("WRITE_PRECISION", "ms")
+		os.Setenv("OPENTSDB_BIND_ADDRESS", ":4242")
 		defer func() {
 			os.Unsetenv("PORT")
 			os.Unsetenv("READ_TIMEOUT")
 			os.Unsetenv("WRITE_TIMEOUT")
 			os.Unsetenv("IDLE_TIMEOUT")
+			os.Unsetenv("WRITE_PRECISION")
+			os.Unsetenv("OPENTSDB_BIND_ADDRESS")
 		}()
 
 		cfg := NewServerConfig()
@@ -45,6 +51,8 @@ func TestServerConfig(t *testing.T) {
 		assert.Equal(t, 60*time.Second, cfg.ReadTimeout)
 		assert.Equal(t, 45*time.Second, cfg.WriteTimeout)
 		assert.Equal(t, 180*time.Second, cfg.IdleTimeout)
+		assert.Equal(t, "ms", cfg.WritePrecision)
+		assert.Equal(t, ":4242", cfg.OpenTSDBBindAddress)
 	})
 
 	t.Run("NewServerConfig with invalid environment variables", func(t *testing.T) {
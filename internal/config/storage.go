@@ -22,6 +22,8 @@ type StorageConfig struct {
 	MaxSegmentSize           int64         // Maximum segment size
 	CompactionInterval       time.Duration // Interval between compaction checks
 	MaxConcurrentCompactions int           // Maximum concurrent compaction operations
+	RetentionCheckInterval   time.Duration // Interval between retention enforcement runs, 0 disables them
+	ContinuousQueryInterval  time.Duration // Interval between checks for due continuous queries, 0 disables them
 
 	// Sharding configuration
 	ShardCount     int      // Number of storage shards
@@ -64,6 +66,8 @@ func NewStorageConfig() StorageConfig {
 		MaxSegmentSize:           parser.Int64(envvars.MaxSegmentSize, envvars.DefaultMaxSegmentSize),
 		CompactionInterval:       parser.Duration(envvars.CompactionInterval, envvars.DefaultCompactionInterval),
 		MaxConcurrentCompactions: parser.Int(envvars.MaxConcurrentCompactions, envvars.DefaultMaxConcurrentCompactions),
+		RetentionCheckInterval:   parser.Duration(envvars.RetentionCheckInterval, envvars.DefaultRetentionCheckInterval),
+		ContinuousQueryInterval:  parser.Duration(envvars.ContinuousQueryInterval, envvars.DefaultContinuousQueryInterval),
 
 		// Sharding configuration
 		ShardCount:     parser.Int(envvars.ShardCount, envvars.DefaultShardCount),
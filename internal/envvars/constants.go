@@ -8,6 +8,11 @@ const (
 	WriteTimeout    = "WRITE_TIMEOUT"
 	IdleTimeout     = "IDLE_TIMEOUT"
 	ShutdownTimeout = "SHUTDOWN_TIMEOUT"
+	WritePrecision  = "WRITE_PRECISION"
+	QueryTimeout    = "QUERY_TIMEOUT"
+
+	// OpenTSDB Telnet Configuration
+	OpenTSDBBindAddress = "OPENTSDB_BIND_ADDRESS"
 )
 
 // Environment variable keys for storage configuration
@@ -27,6 +32,8 @@ const (
 	MaxSegmentSize           = "MAX_SEGMENT_SIZE"
 	CompactionInterval       = "COMPACTION_INTERVAL"
 	MaxConcurrentCompactions = "MAX_CONCURRENT_COMPACTIONS"
+	RetentionCheckInterval   = "RETENTION_CHECK_INTERVAL"
+	ContinuousQueryInterval  = "CONTINUOUS_QUERY_INTERVAL"
 
 	// Sharding Configuration
 	ShardCount     = "SHARD_COUNT"
@@ -10,6 +10,11 @@ var (
 	DefaultWriteTimeout    = 30 * time.Second
 	DefaultIdleTimeout     = 120 * time.Second
 	DefaultShutdownTimeout = 30 * time.Second
+	DefaultWritePrecision  = "ns"
+	DefaultQueryTimeout    = 30 * time.Second
+
+	// OpenTSDB Telnet Defaults, disabled unless an address is set
+	DefaultOpenTSDBBindAddress = ""
 
 	// Storage Configuration Defaults
 	DefaultDataFile    = "/tmp/data.tsv"
@@ -26,6 +31,8 @@ var (
 	DefaultMaxSegmentSize           = int64(256 * 1024 * 1024) // 256MB
 	DefaultCompactionInterval       = 30 * time.Second
 	DefaultMaxConcurrentCompactions = 2
+	DefaultRetentionCheckInterval   = time.Minute
+	DefaultContinuousQueryInterval  = 10 * time.Second
 
 	// Sharding Configuration Defaults
 	DefaultShardCount     = 1
@@ -0,0 +1,77 @@
+package ingestion
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"timeseriesdb/internal/types"
+)
+
+// Escapers for each part of a line, the counterparts of the escapes the
+// scanner resolves
+var (
+	measurementEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// AppendLineProtocol appends a point to buf as a line of line protocol ending
+// with a newline, with its tags and fields sorted by key and its timestamp in
+// nanoseconds. Tags with an empty value are left out, as line protocol cannot
+// express them.
+func AppendLineProtocol(buf []byte, p types.Point) []byte {
+	buf = append(buf, measurementEscaper.Replace(p.Measurement)...)
+
+	tagKeys := make([]string, 0, len(p.Tags))
+	for k, v := range p.Tags {
+		if k != "" && v != "" {
+			tagKeys = append(tagKeys, k)
+		}
+	}
+	sort.Strings(tagKeys)
+	for _, k := range tagKeys {
+		buf = append(buf, ',')
+		buf = append(buf, keyEscaper.Replace(k)...)
+		buf = append(buf, '=')
+		buf = append(buf, keyEscaper.Replace(p.Tags[k])...)
+	}
+
+	fieldKeys := make([]string, 0, len(p.Fields))
+	for k := range p.Fields {
+		fieldKeys = append(fieldKeys, k)
+	}
+	sort.Strings(fieldKeys)
+	for i, k := range fieldKeys {
+		if i == 0 {
+			buf = append(buf, ' ')
+		} else {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, keyEscaper.Replace(k)...)
+		buf = append(buf, '=')
+		buf = appendFieldValue(buf, p.Fields[k])
+	}
+
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, p.Timestamp.UnixNano(), 10)
+	return append(buf, '\n')
+}
+
+// appendFieldValue appends a field value with the suffix or quoting of its type
+func appendFieldValue(buf []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case float64:
+		return strconv.AppendFloat(buf, v, 'g', -1, 64)
+	case int64:
+		return append(strconv.AppendInt(buf, v, 10), 'i')
+	case uint64:
+		return append(strconv.AppendUint(buf, v, 10), 'u')
+	case bool:
+		return strconv.AppendBool(buf, v)
+	case string:
+		buf = append(buf, '"')
+		buf = append(buf, stringEscaper.Replace(v)...)
+		return append(buf, '"')
+	}
+	return append(buf, '"', '"')
+}
@@ -0,0 +1,60 @@
+package ingestion
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"timeseriesdb/internal/types"
+)
+
+func TestAppendLineProtocol(t *testing.T) {
+	ts := time.Unix(0, 1434055562000000001)
+
+	tests := []struct {
+		name  string
+		point types.Point
+		want  string
+	}{
+		{
+			name:  "sorted tags and fields",
+			point: types.Point{Measurement: "cpu", Tags: map[string]string{"region": "us-west", "host": "server01"}, Fields: map[string]interface{}{"value": 0.64, "count": int64(3)}, Timestamp: ts},
+			want:  "cpu,host=server01,region=us-west count=3i,value=0.64 1434055562000000001\n",
+		},
+		{
+			name:  "field types",
+			point: types.Point{Measurement: "m", Fields: map[string]interface{}{"a": uint64(7), "b": true, "c": "ok", "d": float64(2)}, Timestamp: ts},
+			want:  "m a=7u,b=true,c=\"ok\",d=2 1434055562000000001\n",
+		},
+		{
+			name:  "escapes",
+			point: types.Point{Measurement: "my cpu,1", Tags: map[string]string{"host name": "a=b,c", "empty": ""}, Fields: map[string]interface{}{"msg": `say "hi" \o/`}, Timestamp: ts},
+			want:  `my\ cpu\,1,host\ name=a\=b\,c msg="say \"hi\" \\o/" 1434055562000000001` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(AppendLineProtocol(nil, tt.point))
+			if got != tt.want {
+				t.Fatalf("Got %q, want %q", got, tt.want)
+			}
+
+			// Every line parses back to the point it was encoded from
+			points, err := ParseLineProtocol(got)
+			if err != nil {
+				t.Fatalf("Failed to parse %q: %v", got, err)
+			}
+			want := tt.point
+			want.Tags = map[string]string{}
+			for k, v := range tt.point.Tags {
+				if v != "" {
+					want.Tags[k] = v
+				}
+			}
+			if len(points) != 1 || !reflect.DeepEqual(points[0].Tags, want.Tags) || !reflect.DeepEqual(points[0].Fields, want.Fields) ||
+				points[0].Measurement != want.Measurement || !points[0].Timestamp.Equal(want.Timestamp) {
+				t.Errorf("Parsed %+v, want %+v", points, want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package ingestion
 
 import (
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -8,81 +9,92 @@ import (
 	"timeseriesdb/internal/types"
 )
 
-// ParseLineProtocol parses InfluxDB line protocol into []types.Point
+// ParseLineProtocol parses InfluxDB line protocol with nanosecond timestamps
+// into []types.Point. Points without a timestamp are stamped with the current
+// time. The first malformed line fails the whole batch with a validation
+// error giving its position.
 func ParseLineProtocol(input string) ([]types.Point, error) {
-	lines := strings.Split(strings.TrimSpace(input), "\n")
-	var points []types.Point
+	return ParseLineProtocolWithPrecision(input, time.Nanosecond)
+}
 
-	for _, line := range lines {
-		// Skip empty lines
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
+// ParseLineProtocolWithPrecision parses line protocol whose timestamps count
+// units of precision since the Unix epoch. Points without a timestamp are
+// stamped with the current time truncated to the precision.
+func ParseLineProtocolWithPrecision(input string, precision time.Duration) ([]types.Point, error) {
+	s := newLineScanner(input, time.Now(), precision)
 
-		parts := strings.SplitN(line, " ", 3)
-		if len(parts) < 3 {
-			return nil, errors.NewValidationError("invalid line format: expected 3 parts, got " + strconv.Itoa(len(parts)))
+	var points []types.Point
+	for {
+		p, ok, err := s.Next()
+		if err != nil {
+			return nil, err
 		}
-
-		// Parse measurement and tags
-		measurementAndTags := strings.Split(parts[0], ",")
-		measurement := measurementAndTags[0]
-		if measurement == "" {
-			return nil, errors.NewValidationError("missing measurement name")
+		if !ok {
+			return points, nil
 		}
+		points = append(points, p)
+	}
+}
 
-		tags := map[string]string{}
-		for _, tag := range measurementAndTags[1:] {
-			kv := strings.SplitN(tag, "=", 2)
-			if len(kv) != 2 {
-				return nil, errors.NewValidationError("malformed tag: " + tag)
-			}
-			if kv[0] == "" || kv[1] == "" {
-				return nil, errors.NewValidationError("invalid tag key or value: " + tag)
-			}
-			tags[kv[0]] = kv[1]
-		}
+// precisions maps the names accepted for a write precision to their unit
+var precisions = map[string]time.Duration{
+	"n":  time.Nanosecond,
+	"ns": time.Nanosecond,
+	"u":  time.Microsecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
 
-		// Parse fields
-		fields := map[string]float64{}
-		fieldPairs := strings.Split(parts[1], ",")
-		if len(fieldPairs) == 0 {
-			return nil, errors.NewValidationError("no fields provided")
-		}
+// ParsePrecision returns the unit of a timestamp precision name: ns, us, ms,
+// s, m or h, with n, u and µs accepted as aliases
+func ParsePrecision(name string) (time.Duration, error) {
+	precision, ok := precisions[name]
+	if !ok {
+		return 0, errors.NewValidationError("invalid precision '" + name + "', expected one of ns, us, ms, s, m, h")
+	}
+	return precision, nil
+}
 
-		for _, fieldPair := range fieldPairs {
-			kv := strings.SplitN(fieldPair, "=", 2)
-			if len(kv) != 2 {
-				return nil, errors.NewValidationError("malformed field: " + fieldPair)
-			}
-			if kv[0] == "" {
-				return nil, errors.NewValidationError("empty field name")
-			}
+// parseFieldValue parses an unquoted line protocol field value: a boolean, an
+// integer with an i suffix, an unsigned integer with a u suffix or otherwise
+// a float
+func parseFieldValue(raw string) (interface{}, error) {
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
 
-			val, err := strconv.ParseFloat(strings.TrimSuffix(kv[1], "i"), 64)
-			if err != nil {
-				return nil, errors.WrapWithType(err, errors.ErrorTypeValidation, "invalid field value '"+kv[1]+"'")
-			}
-			fields[kv[0]] = val
-		}
+	switch raw[len(raw)-1] {
+	case 'i':
+		return strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+	case 'u':
+		return strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+	}
 
-		// Parse timestamp
-		if len(parts[2]) != 19 {
-			return nil, errors.NewValidationError("invalid timestamp length, expected 19 digits for nanoseconds")
-		}
-		tsInt, err := strconv.ParseInt(parts[2], 10, 64)
-		if err != nil {
-			return nil, errors.WrapWithType(err, errors.ErrorTypeValidation, "invalid timestamp")
-		}
-		timestamp := time.Unix(0, tsInt)
+	return parseFloat(raw)
+}
 
-		points = append(points, types.Point{
-			Measurement: measurement,
-			Tags:        tags,
-			Fields:      fields,
-			Timestamp:   timestamp,
-		})
+// parseFloat parses a decimal float. ParseFloat also accepts forms such as
+// NaN, Inf and hex floats, which neither line protocol nor OpenTSDB do.
+func parseFloat(raw string) (float64, error) {
+	if strings.Trim(raw, "0123456789+-.eE") != "" {
+		return 0, &strconv.NumError{Func: "ParseFloat", Num: raw, Err: strconv.ErrSyntax}
 	}
+	return strconv.ParseFloat(raw, 64)
+}
 
-	return points, nil
+// scaleTimestamp returns the time of a Unix timestamp counting units of
+// precision, reporting false when it overflows nanoseconds
+func scaleTimestamp(ts int64, precision time.Duration) (time.Time, bool) {
+	unit := int64(precision)
+	if ts > math.MaxInt64/unit || ts < math.MinInt64/unit {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ts*unit), true
 }
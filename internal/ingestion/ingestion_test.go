@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 	"time"
+	"timeseriesdb/internal/errors"
 	"timeseriesdb/internal/types"
 )
 
@@ -26,7 +27,7 @@ func TestParseLineProtocol(t *testing.T) {
 						"host":   "server01",
 						"region": "us-west",
 					},
-					Fields: map[string]float64{
+					Fields: map[string]interface{}{
 						"value": 0.64,
 					},
 					Timestamp: time.Unix(0, 1434055562000000000),
@@ -45,7 +46,7 @@ cpu,host=server01,region=us-west value=0.65 1434055563000000000`,
 						"host":   "server01",
 						"region": "us-west",
 					},
-					Fields: map[string]float64{
+					Fields: map[string]interface{}{
 						"value": 0.64,
 					},
 					Timestamp: time.Unix(0, 1434055562000000000),
@@ -56,7 +57,7 @@ cpu,host=server01,region=us-west value=0.65 1434055563000000000`,
 						"host":   "server01",
 						"region": "us-west",
 					},
-					Fields: map[string]float64{
+					Fields: map[string]interface{}{
 						"value": 0.65,
 					},
 					Timestamp: time.Unix(0, 1434055563000000000),
@@ -73,7 +74,7 @@ cpu,host=server01,region=us-west value=0.65 1434055563000000000`,
 					Tags: map[string]string{
 						"host": "server01",
 					},
-					Fields: map[string]float64{
+					Fields: map[string]interface{}{
 						"value": 0.64,
 						"load":  0.85,
 					},
@@ -91,8 +92,28 @@ cpu,host=server01,region=us-west value=0.65 1434055563000000000`,
 					Tags: map[string]string{
 						"host": "server01",
 					},
-					Fields: map[string]float64{
-						"value": 64.0,
+					Fields: map[string]interface{}{
+						"value": int64(64),
+					},
+					Timestamp: time.Unix(0, 1434055562000000000),
+				},
+			},
+			expectError: false,
+		},
+		{
+			name:  "Point with typed field values",
+			input: `status,host=server01 code=-12i,count=7u,up=t,down=FALSE,msg="\"ok\"",load=1e3 1434055562000000000`,
+			expected: []types.Point{
+				{
+					Measurement: "status",
+					Tags:        map[string]string{"host": "server01"},
+					Fields: map[string]interface{}{
+						"code":  int64(-12),
+						"count": uint64(7),
+						"up":    true,
+						"down":  false,
+						"msg":   `"ok"`,
+						"load":  1000.0,
 					},
 					Timestamp: time.Unix(0, 1434055562000000000),
 				},
@@ -115,67 +136,86 @@ cpu,host=server01,region=us-west value=0.65 1434055563000000000`,
 			name:        "Single measurement only",
 			input:       "cpu",
 			expectError: true,
-			errorMsg:    "invalid line format: expected 3 parts, got 1",
+			errorMsg:    "line 1, column 4: missing fields",
 		},
 		{
 			name:        "Missing fields",
 			input:       "cpu,host=server01 1434055562000000000",
 			expectError: true,
-			errorMsg:    "invalid line format: expected 3 parts, got 2",
+			errorMsg:    "line 1, column 38: missing value for field \"1434055562000000000\"",
 		},
 		{
 			name:        "Empty measurement",
 			input:       ",host=server01 value=0.64 1434055562000000000",
 			expectError: true,
-			errorMsg:    "missing measurement name",
+			errorMsg:    "line 1, column 1: missing measurement name",
 		},
 		{
 			name:        "Malformed tag",
 			input:       "cpu,host=server01, value=0.64 1434055562000000000",
 			expectError: true,
-			errorMsg:    "malformed tag: ",
+			errorMsg:    "line 1, column 19: empty tag key",
 		},
 		{
 			name:        "Empty tag key",
 			input:       "cpu,=server01 value=0.64 1434055562000000000",
 			expectError: true,
-			errorMsg:    "invalid tag key or value: =server01",
+			errorMsg:    "line 1, column 5: empty tag key",
 		},
 		{
 			name:        "Empty tag value",
 			input:       "cpu,host= value=0.64 1434055562000000000",
 			expectError: true,
-			errorMsg:    "invalid tag key or value: host=",
+			errorMsg:    "line 1, column 10: empty value for tag \"host\"",
 		},
 		{
 			name:        "No fields",
 			input:       "cpu,host=server01  1434055562000000000",
 			expectError: true,
-			errorMsg:    "malformed field: ",
+			errorMsg:    "line 1, column 39: missing value for field \"1434055562000000000\"",
 		},
 		{
 			name:        "Empty field name",
 			input:       "cpu,host=server01 =0.64 1434055562000000000",
 			expectError: true,
-			errorMsg:    "empty field name",
+			errorMsg:    "line 1, column 19: empty field name",
 		},
 		{
 			name:        "Invalid field value",
 			input:       "cpu,host=server01 value=abc 1434055562000000000",
 			expectError: true,
-			errorMsg:    "invalid field value 'abc': strconv.ParseFloat: parsing \"abc\": invalid syntax",
+			errorMsg:    "line 1, column 25: invalid field value 'abc': strconv.ParseFloat: parsing \"abc\": invalid syntax",
 		},
 		{
-			name:        "Invalid timestamp length",
-			input:       "cpu,host=server01 value=0.64 143405556200000000",
+			name:        "Invalid integer field value",
+			input:       "cpu,host=server01 value=1.5i 1434055562000000000",
 			expectError: true,
-			errorMsg:    "invalid timestamp length, expected 19 digits for nanoseconds",
+			errorMsg:    "line 1, column 25: invalid field value '1.5i': strconv.ParseInt: parsing \"1.5\": invalid syntax",
+		},
+		{
+			name:        "Negative unsigned field value",
+			input:       "cpu,host=server01 value=-1u 1434055562000000000",
+			expectError: true,
+			errorMsg:    "line 1, column 25: invalid field value '-1u': strconv.ParseUint: parsing \"-1\": invalid syntax",
+		},
+		{
+			name:  "Timestamp before 2001",
+			input: "cpu,host=server01 value=0.64 143405556200000000",
+			expected: []types.Point{
+				{
+					Measurement: "cpu",
+					Tags:        map[string]string{"host": "server01"},
+					Fields:      map[string]interface{}{"value": 0.64},
+					Timestamp:   time.Unix(0, 143405556200000000),
+				},
+			},
+			expectError: false,
 		},
 		{
 			name:        "Invalid timestamp format",
 			input:       "cpu,host=server01 value=0.64 143405556200000000a",
 			expectError: true,
-			errorMsg:    "invalid timestamp: strconv.ParseInt: parsing \"143405556200000000a\": invalid syntax",
+			errorMsg:    "line 1, column 30: invalid timestamp '143405556200000000a': strconv.ParseInt: parsing \"143405556200000000a\": invalid syntax",
 		},
 		{
 			name: "Mixed valid and invalid lines",
@@ -183,7 +223,7 @@ cpu,host=server01,region=us-west value=0.65 1434055563000000000`,
 invalid_line
 cpu,host=server02 value=0.65 1434055563000000000`,
 			expectError: true,
-			errorMsg:    "invalid line format: expected 3 parts, got 1",
+			errorMsg:    "line 2, column 13: missing fields",
 		},
 	}
 
@@ -238,7 +278,7 @@ cpu,host=server02 value=0.65 1434055563000000000`,
 				} else {
 					for k, v := range expected.Fields {
 						if actual.Fields[k] != v {
-							t.Errorf("Point %d: expected field '%s'=%f, got %f", i, k, v, actual.Fields[k])
+							t.Errorf("Point %d: expected field '%s'=%v (%T), got %v (%T)", i, k, v, v, actual.Fields[k], actual.Fields[k])
 						}
 					}
 				}
@@ -251,6 +291,35 @@ cpu,host=server02 value=0.65 1434055563000000000`,
 	}
 }
 
+func TestParsePrecision(t *testing.T) {
+	for name, want := range map[string]time.Duration{
+		"ns": time.Nanosecond, "n": time.Nanosecond,
+		"us": time.Microsecond, "u": time.Microsecond, "µs": time.Microsecond,
+		"ms": time.Millisecond, "s": time.Second, "m": time.Minute, "h": time.Hour,
+	} {
+		got, err := ParsePrecision(name)
+		if err != nil || got != want {
+			t.Errorf("ParsePrecision(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+
+	for _, name := range []string{"", "d", "MS", "rfc3339"} {
+		if _, err := ParsePrecision(name); !errors.IsType(err, errors.ErrorTypeValidation) {
+			t.Errorf("ParsePrecision(%q) returned %v, want a validation error", name, err)
+		}
+	}
+}
+
+func TestParseLineProtocolWithPrecision(t *testing.T) {
+	points, err := ParseLineProtocolWithPrecision("cpu value=1 1434055562\ncpu value=2 1434055563", time.Second)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if len(points) != 2 || !points[0].Timestamp.Equal(time.Unix(1434055562, 0)) || !points[1].Timestamp.Equal(time.Unix(1434055563, 0)) {
+		t.Errorf("Unexpected points %+v", points)
+	}
+}
+
 func TestParseLineProtocol_EdgeCases(t *testing.T) {
 	tests := []struct {
 		name        string
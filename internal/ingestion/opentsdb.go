@@ -0,0 +1,244 @@
+package ingestion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/types"
+	"unicode"
+	"unicode/utf8"
+)
+
+// OpenTSDBField is the field OpenTSDB data points are stored in, the same as
+// Prometheus samples so that the Prometheus query API reads both back under
+// the bare metric name
+const OpenTSDBField = RemoteWriteField
+
+// OpenTSDB reads timestamps up to maxOpenTSDBSeconds as seconds and larger
+// ones as milliseconds, up to maxOpenTSDBMillis
+const (
+	maxOpenTSDBSeconds = 1<<32 - 1
+	maxOpenTSDBMillis  = 9999999999999
+)
+
+// openTSDBDataPoint is a data point of an /api/put body. The timestamp and
+// value may be JSON numbers or strings holding numbers.
+type openTSDBDataPoint struct {
+	Metric    string            `json:"metric"`
+	Timestamp json.Number       `json:"timestamp"`
+	Value     json.Number       `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// ParseOpenTSDBJSON parses the body of an OpenTSDB /api/put request, a data
+// point object or an array of them, into points. Each data point becomes a
+// point of its metric with its tags and a single float value field. The
+// first invalid data point fails the whole batch with a validation error
+// giving its index, as a malformed line does for line protocol.
+func ParseOpenTSDBJSON(body []byte) ([]types.Point, error) {
+	var dataPoints []openTSDBDataPoint
+	var err error
+	if trimmed := bytes.TrimLeft(body, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(body, &dataPoints)
+	} else {
+		dataPoints = make([]openTSDBDataPoint, 1)
+		err = json.Unmarshal(body, &dataPoints[0])
+	}
+	if err != nil {
+		return nil, errors.WrapWithType(err, errors.ErrorTypeValidation, "invalid JSON body")
+	}
+
+	points := make([]types.Point, 0, len(dataPoints))
+	for i, dp := range dataPoints {
+		p, err := openTSDBPoint(dp)
+		if err != nil {
+			return nil, errors.NewValidationError(fmt.Sprintf("data point %d: %v", i+1, err)).
+				WithContext("data_point", i+1)
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+// openTSDBPoint validates a JSON data point, checking its tags in key order so
+// that the same error is always reported first
+func openTSDBPoint(dp openTSDBDataPoint) (types.Point, error) {
+	if err := checkOpenTSDBName("metric name", dp.Metric); err != nil {
+		return types.Point{}, err
+	}
+	ts, err := parseOpenTSDBTimestamp(dp.Timestamp.String())
+	if err != nil {
+		return types.Point{}, err
+	}
+	value, err := parseOpenTSDBValue(dp.Value.String())
+	if err != nil {
+		return types.Point{}, err
+	}
+
+	keys := make([]string, 0, len(dp.Tags))
+	for key := range dp.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tags := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if err := checkOpenTSDBName("tag key", key); err != nil {
+			return types.Point{}, err
+		}
+		if err := checkOpenTSDBName(fmt.Sprintf("value for tag %q", key), dp.Tags[key]); err != nil {
+			return types.Point{}, err
+		}
+		tags[key] = dp.Tags[key]
+	}
+
+	return newOpenTSDBPoint(dp.Metric, ts, value, tags), nil
+}
+
+// ParseOpenTSDBPut parses a telnet `put <metric> <timestamp> <value>
+// <tagk=tagv>...` command into a point, as ParseOpenTSDBJSON does a data
+// point. Errors are validation errors located at the given line number and
+// the column of the offending word.
+func ParseOpenTSDBPut(line string, number int) (types.Point, error) {
+	line = strings.TrimRight(line, "\r\n")
+	words, columns := splitOpenTSDBWords(line)
+	errorf := func(word int, format string, args ...interface{}) error {
+		column := utf8.RuneCountInString(line) + 1
+		if word < len(columns) {
+			column = columns[word]
+		}
+		return positionErrorf(number, column, format, args...)
+	}
+
+	if len(words) == 0 || words[0] != "put" {
+		return types.Point{}, errorf(0, "expected put command")
+	}
+	for i, what := range []string{"metric name", "timestamp", "value"} {
+		if len(words) <= i+1 {
+			return types.Point{}, errorf(i+1, "missing %s", what)
+		}
+	}
+
+	metric := words[1]
+	if err := checkOpenTSDBName("metric name", metric); err != nil {
+		return types.Point{}, errorf(1, "%v", err)
+	}
+	ts, err := parseOpenTSDBTimestamp(words[2])
+	if err != nil {
+		return types.Point{}, errorf(2, "%v", err)
+	}
+	value, err := parseOpenTSDBValue(words[3])
+	if err != nil {
+		return types.Point{}, errorf(3, "%v", err)
+	}
+
+	tags := make(map[string]string, len(words)-4)
+	for i := 4; i < len(words); i++ {
+		key, tagValue, ok := strings.Cut(words[i], "=")
+		if err := checkOpenTSDBName("tag key", key); err != nil {
+			return types.Point{}, errorf(i, "%v", err)
+		}
+		if !ok {
+			return types.Point{}, errorf(i, "missing value for tag %q", key)
+		}
+		if err := checkOpenTSDBName(fmt.Sprintf("value for tag %q", key), tagValue); err != nil {
+			return types.Point{}, errorf(i, "%v", err)
+		}
+		if _, dup := tags[key]; dup {
+			return types.Point{}, errorf(i, "duplicate tag %q", key)
+		}
+		tags[key] = tagValue
+	}
+
+	return newOpenTSDBPoint(metric, ts, value, tags), nil
+}
+
+// splitOpenTSDBWords splits a telnet command at runs of spaces and tabs,
+// returning the 1-based character column of each word
+func splitOpenTSDBWords(line string) ([]string, []int) {
+	var words []string
+	var columns []int
+	column := 1
+	start := -1
+	for i, r := range line {
+		if r == ' ' || r == '\t' {
+			if start >= 0 {
+				words = append(words, line[start:i])
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+			columns = append(columns, column)
+		}
+		column++
+	}
+	if start >= 0 {
+		words = append(words, line[start:])
+	}
+	return words, columns
+}
+
+// newOpenTSDBPoint returns the point of a validated data point
+func newOpenTSDBPoint(metric string, ts time.Time, value float64, tags map[string]string) types.Point {
+	return types.Point{
+		Measurement: metric,
+		Tags:        tags,
+		Fields:      map[string]interface{}{OpenTSDBField: value},
+		Timestamp:   ts,
+	}
+}
+
+// checkOpenTSDBName checks that a metric name, tag key or tag value is not
+// empty and holds only the characters OpenTSDB allows: letters, digits, -,
+// _, . and /
+func checkOpenTSDBName(what, name string) error {
+	if name == "" {
+		return fmt.Errorf("empty %s", what)
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("-_./", r) {
+			return fmt.Errorf("invalid character %q in %s '%s'", r, what, name)
+		}
+	}
+	return nil
+}
+
+// parseOpenTSDBTimestamp parses a Unix timestamp in seconds, or in
+// milliseconds when it is too large to count seconds
+func parseOpenTSDBTimestamp(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, fmt.Errorf("missing timestamp")
+	}
+	ts, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp '%s': %w", raw, err)
+	}
+
+	precision := time.Second
+	switch {
+	case ts < 0:
+		return time.Time{}, fmt.Errorf("timestamp '%s' is negative", raw)
+	case ts > maxOpenTSDBMillis:
+		return time.Time{}, fmt.Errorf("timestamp '%s' is out of range", raw)
+	case ts > maxOpenTSDBSeconds:
+		precision = time.Millisecond
+	}
+	t, _ := scaleTimestamp(ts, precision)
+	return t, nil
+}
+
+// parseOpenTSDBValue parses the integer or float value of a data point
+func parseOpenTSDBValue(raw string) (float64, error) {
+	if raw == "" {
+		return 0, fmt.Errorf("missing value")
+	}
+	value, err := parseFloat(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s': %w", raw, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,124 @@
+package ingestion
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/types"
+)
+
+func TestParseOpenTSDBJSON(t *testing.T) {
+	body := `[
+		{"metric": "sys.cpu.nice", "timestamp": 1700000000, "value": 18, "tags": {"host": "web01", "dc": "lga"}},
+		{"metric": "sys.cpu.nice", "timestamp": 1700000000123, "value": "9.5", "tags": {"host": "web02"}},
+		{"metric": "sys.uptime", "timestamp": "1700000000", "value": -1.5e3}
+	]`
+
+	points, err := ParseOpenTSDBJSON([]byte(body))
+	if err != nil {
+		t.Fatalf("ParseOpenTSDBJSON failed: %v", err)
+	}
+
+	expected := []types.Point{
+		{Measurement: "sys.cpu.nice", Tags: map[string]string{"host": "web01", "dc": "lga"}, Fields: map[string]interface{}{"value": 18.0}, Timestamp: time.Unix(1700000000, 0)},
+		{Measurement: "sys.cpu.nice", Tags: map[string]string{"host": "web02"}, Fields: map[string]interface{}{"value": 9.5}, Timestamp: time.Unix(1700000000, 123000000)},
+		{Measurement: "sys.uptime", Tags: map[string]string{}, Fields: map[string]interface{}{"value": -1500.0}, Timestamp: time.Unix(1700000000, 0)},
+	}
+	if !reflect.DeepEqual(points, expected) {
+		t.Errorf("Got points %+v, want %+v", points, expected)
+	}
+
+	// A single data point may be sent without an array
+	points, err = ParseOpenTSDBJSON([]byte(` {"metric": "up", "timestamp": 1700000000, "value": 1}`))
+	if err != nil {
+		t.Fatalf("ParseOpenTSDBJSON failed: %v", err)
+	}
+	if len(points) != 1 || points[0].Measurement != "up" {
+		t.Errorf("Unexpected points %+v", points)
+	}
+}
+
+func TestParseOpenTSDBJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		err  string
+	}{
+		{"not JSON", "put up 1700000000 1", "invalid JSON body"},
+		{"empty body", "", "invalid JSON body"},
+		{"value not a number", `{"metric": "up", "timestamp": 1700000000, "value": "high"}`, "invalid JSON body"},
+		{"missing metric", `[{"metric": "up", "timestamp": 1700000000, "value": 1}, {"timestamp": 1700000000, "value": 1}]`, "data point 2: empty metric name"},
+		{"missing timestamp", `{"metric": "up", "value": 1}`, "data point 1: missing timestamp"},
+		{"missing value", `{"metric": "up", "timestamp": 1700000000}`, "data point 1: missing value"},
+		{"float timestamp", `{"metric": "up", "timestamp": 1700000000.5, "value": 1}`, "data point 1: invalid timestamp '1700000000.5'"},
+		{"negative timestamp", `{"metric": "up", "timestamp": -1, "value": 1}`, "data point 1: timestamp '-1' is negative"},
+		{"timestamp out of range", `{"metric": "up", "timestamp": 17000000000000, "value": 1}`, "data point 1: timestamp '17000000000000' is out of range"},
+		{"metric character", `{"metric": "cpu load", "timestamp": 1700000000, "value": 1}`, `data point 1: invalid character ' ' in metric name 'cpu load'`},
+		{"tags checked in key order", `{"metric": "up", "timestamp": 1700000000, "value": 1, "tags": {"host": "", "dc": "a,b"}}`, `data point 1: invalid character ',' in value for tag "dc" 'a,b'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseOpenTSDBJSON([]byte(tt.body))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Expected an error containing %q, got %v", tt.err, err)
+			}
+			if !errors.IsType(err, errors.ErrorTypeValidation) {
+				t.Errorf("Expected a validation error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseOpenTSDBPut(t *testing.T) {
+	p, err := ParseOpenTSDBPut("put sys.cpu.user  1700000000 42.5 host=web01\tcpu=0\r\n", 1)
+	if err != nil {
+		t.Fatalf("ParseOpenTSDBPut failed: %v", err)
+	}
+
+	expected := types.Point{
+		Measurement: "sys.cpu.user",
+		Tags:        map[string]string{"host": "web01", "cpu": "0"},
+		Fields:      map[string]interface{}{"value": 42.5},
+		Timestamp:   time.Unix(1700000000, 0),
+	}
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("Got point %+v, want %+v", p, expected)
+	}
+}
+
+func TestParseOpenTSDBPutErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"other command", "get up", "line 3, column 1: expected put command"},
+		{"missing timestamp", "put up", "line 3, column 7: missing timestamp"},
+		{"missing value", "put up 1700000000 ", "line 3, column 19: missing value"},
+		{"invalid timestamp", "put up 17e8 1", `line 3, column 8: invalid timestamp '17e8': strconv.ParseInt: parsing "17e8": invalid syntax`},
+		{"NaN", "put up 1700000000 NaN", `line 3, column 19: invalid value 'NaN': strconv.ParseFloat: parsing "NaN": invalid syntax`},
+		{"missing tag value", "put up 1700000000 1 host", `line 3, column 21: missing value for tag "host"`},
+		{"empty tag value", "put up 1700000000 1 host=", `line 3, column 21: empty value for tag "host"`},
+		{"empty tag key", "put up 1700000000 1 =web01", "line 3, column 21: empty tag key"},
+		{"duplicate tag", "put up 1700000000 1 host=a host=b", `line 3, column 28: duplicate tag "host"`},
+		{"unicode column", "put 温度 1700000000 1 位置=东 京", `line 3, column 26: missing value for tag "京"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseOpenTSDBPut(tt.line, 3)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Error = %q, want %q", err.Error(), tt.want)
+			}
+			if !errors.IsType(err, errors.ErrorTypeValidation) {
+				t.Errorf("Expected a validation error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package ingestion
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/prompb"
+	"timeseriesdb/internal/promql"
+	"timeseriesdb/internal/types"
+)
+
+// RemoteWriteField is the field Prometheus samples are stored in, which the
+// Prometheus query API reads back under the bare metric name
+const RemoteWriteField = "value"
+
+// staleNaN is the NaN Prometheus writes to mark a series as stale
+const staleNaN uint64 = 0x7ff0000000000002
+
+// ParseRemoteWrite decodes the snappy compressed protobuf body of a
+// Prometheus remote write request into points. The __name__ label of each
+// series becomes the measurement and its other labels the tags, and each
+// sample a point with a single value field. Labels with empty values are
+// dropped as Prometheus does, and stale markers are skipped. Bodies
+// decompressing to more than maxLen bytes and malformed series fail the
+// whole request with a validation error.
+func ParseRemoteWrite(body []byte, maxLen int) ([]types.Point, error) {
+	data, err := prompb.DecodeSnappy(body, maxLen)
+	if err != nil {
+		return nil, errors.NewValidationError(err.Error())
+	}
+
+	var req prompb.WriteRequest
+	if err := req.Unmarshal(data); err != nil {
+		return nil, errors.NewValidationError("invalid WriteRequest: " + err.Error())
+	}
+
+	var points []types.Point
+	for i, ts := range req.Timeseries {
+		measurement, tags, err := seriesFromLabels(ts.Labels)
+		if err != nil {
+			return nil, errors.NewValidationError(fmt.Sprintf("series %d: %v", i+1, err))
+		}
+
+		for _, s := range ts.Samples {
+			if math.Float64bits(s.Value) == staleNaN {
+				continue
+			}
+			points = append(points, types.Point{
+				Measurement: measurement,
+				Tags:        tags,
+				Fields:      map[string]interface{}{RemoteWriteField: s.Value},
+				Timestamp:   time.UnixMilli(s.Timestamp).UTC(),
+			})
+		}
+	}
+	return points, nil
+}
+
+// seriesFromLabels returns the measurement and tags of a series from its
+// Prometheus labels
+func seriesFromLabels(labels []prompb.Label) (string, map[string]string, error) {
+	var measurement string
+	tags := make(map[string]string, len(labels))
+	seen := make(map[string]bool, len(labels))
+	for _, l := range labels {
+		if l.Name == "" {
+			return "", nil, fmt.Errorf("empty label name")
+		}
+		if seen[l.Name] {
+			return "", nil, fmt.Errorf("duplicate label %q", l.Name)
+		}
+		seen[l.Name] = true
+
+		switch {
+		case l.Name == promql.MetricNameLabel:
+			measurement = l.Value
+		case l.Value != "":
+			tags[l.Name] = l.Value
+		}
+	}
+	if measurement == "" {
+		return "", nil, fmt.Errorf("missing metric name label %s", promql.MetricNameLabel)
+	}
+	return measurement, tags, nil
+}
@@ -0,0 +1,77 @@
+package ingestion
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/prompb"
+	"timeseriesdb/internal/types"
+)
+
+// encodeWriteRequest returns the remote write body of a set of series
+func encodeWriteRequest(series ...prompb.TimeSeries) []byte {
+	req := prompb.WriteRequest{Timeseries: series}
+	return prompb.EncodeSnappy(req.Marshal())
+}
+
+func TestParseRemoteWrite(t *testing.T) {
+	body := encodeWriteRequest(
+		prompb.TimeSeries{
+			Labels: []prompb.Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "job", Value: "api"}, {Name: "env", Value: ""}},
+			Samples: []prompb.Sample{
+				{Value: 10, Timestamp: 1700000000000},
+				{Value: math.Float64frombits(staleNaN), Timestamp: 1700000015000},
+				{Value: 12.5, Timestamp: 1700000030123},
+			},
+		},
+		prompb.TimeSeries{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "up"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1700000000000}},
+		},
+	)
+
+	points, err := ParseRemoteWrite(body, 1<<20)
+	if err != nil {
+		t.Fatalf("ParseRemoteWrite failed: %v", err)
+	}
+
+	tags := map[string]string{"job": "api"}
+	expected := []types.Point{
+		{Measurement: "http_requests_total", Tags: tags, Fields: map[string]interface{}{"value": 10.0}, Timestamp: time.Unix(1700000000, 0).UTC()},
+		{Measurement: "http_requests_total", Tags: tags, Fields: map[string]interface{}{"value": 12.5}, Timestamp: time.Unix(1700000030, 123000000).UTC()},
+		{Measurement: "up", Tags: map[string]string{}, Fields: map[string]interface{}{"value": 1.0}, Timestamp: time.Unix(1700000000, 0).UTC()},
+	}
+	if !reflect.DeepEqual(points, expected) {
+		t.Errorf("Got points %+v, want %+v", points, expected)
+	}
+}
+
+func TestParseRemoteWriteErrors(t *testing.T) {
+	sample := []prompb.Sample{{Value: 1, Timestamp: 1700000000000}}
+	tests := []struct {
+		name string
+		body []byte
+		err  string
+	}{
+		{"not snappy", []byte("plain text"), "snappy"},
+		{"not protobuf", prompb.EncodeSnappy([]byte{0xff, 0xff}), "invalid WriteRequest"},
+		{"too large", prompb.EncodeSnappy(make([]byte, 2048)), "exceeds the limit"},
+		{"missing name", encodeWriteRequest(prompb.TimeSeries{Labels: []prompb.Label{{Name: "job", Value: "api"}}, Samples: sample}), "series 1: missing metric name label __name__"},
+		{"duplicate label", encodeWriteRequest(prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "a"}, {Name: "job", Value: "b"}}, Samples: sample}), `series 1: duplicate label "job"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRemoteWrite(tt.body, 1024)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Expected an error containing %q, got %v", tt.err, err)
+			}
+			if !errors.IsType(err, errors.ErrorTypeValidation) {
+				t.Errorf("Expected a validation error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package ingestion
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/types"
+	"unicode/utf8"
+)
+
+// Characters that may be escaped with a backslash in each part of a line.
+// A backslash before any other character is kept literally.
+const (
+	measurementEscapes = ", \\"
+	keyEscapes         = ",= \\"
+	stringEscapes      = "\"\\"
+)
+
+// lineScanner reads points from line protocol input. Lines are separated by
+// newlines, except inside quoted string field values, and lines whose first
+// non-blank character is # are comments.
+type lineScanner struct {
+	input string
+	pos   int
+	// line is the 1-based number of the line being scanned and lineStart the
+	// offset of its first byte, used to report error positions
+	line      int
+	lineStart int
+	// now is the timestamp given to points without one
+	now time.Time
+	// precision is the unit of the timestamps in the input
+	precision time.Duration
+}
+
+// newLineScanner returns a scanner over input whose timestamps count units of
+// precision, stamping points without a timestamp with now truncated to the
+// precision
+func newLineScanner(input string, now time.Time, precision time.Duration) *lineScanner {
+	return &lineScanner{input: input, line: 1, now: now.Truncate(precision), precision: precision}
+}
+
+// Next returns the next point, reporting false once the input is exhausted
+func (s *lineScanner) Next() (types.Point, bool, error) {
+	for s.pos < len(s.input) {
+		s.skipBlanks()
+		switch {
+		case s.atLineEnd():
+			s.endLine()
+		case s.input[s.pos] == '#':
+			s.skipLine()
+		default:
+			p, err := s.scanPoint()
+			return p, err == nil, err
+		}
+	}
+	return types.Point{}, false, nil
+}
+
+// scanPoint scans one line holding a point, consuming its line ending
+func (s *lineScanner) scanPoint() (types.Point, error) {
+	p := types.Point{
+		Tags:   map[string]string{},
+		Fields: map[string]interface{}{},
+	}
+
+	start := s.pos
+	p.Measurement = s.scanUntil(", ", measurementEscapes)
+	if p.Measurement == "" {
+		return p, s.errorf(start, "missing measurement name")
+	}
+
+	for s.peek() == ',' {
+		s.pos++
+		if err := s.scanTag(p.Tags); err != nil {
+			return p, err
+		}
+	}
+
+	if !s.skipSpaces() || s.atLineEnd() {
+		return p, s.errorf(s.pos, "missing fields")
+	}
+
+	for {
+		if err := s.scanField(p.Fields); err != nil {
+			return p, err
+		}
+		if s.peek() != ',' {
+			break
+		}
+		s.pos++
+	}
+
+	p.Timestamp = s.now
+	if s.skipSpaces() && !s.atLineEnd() {
+		ts, err := s.scanTimestamp()
+		if err != nil {
+			return p, err
+		}
+		p.Timestamp = ts
+	}
+
+	s.skipBlanks()
+	if !s.atLineEnd() {
+		return p, s.errorf(s.pos, "unexpected text %q after point", s.restOfLine())
+	}
+	s.endLine()
+
+	return p, nil
+}
+
+// scanTag scans a key=value tag pair into tags
+func (s *lineScanner) scanTag(tags map[string]string) error {
+	start := s.pos
+	key := s.scanUntil(",= ", keyEscapes)
+	if key == "" {
+		return s.errorf(start, "empty tag key")
+	}
+	if s.peek() != '=' {
+		return s.errorf(s.pos, "missing value for tag %q", key)
+	}
+	s.pos++
+
+	valueStart := s.pos
+	value := s.scanUntil(", ", keyEscapes)
+	if value == "" {
+		return s.errorf(valueStart, "empty value for tag %q", key)
+	}
+
+	tags[key] = value
+	return nil
+}
+
+// scanField scans a key=value field pair into fields
+func (s *lineScanner) scanField(fields map[string]interface{}) error {
+	start := s.pos
+	key := s.scanUntil(",= ", keyEscapes)
+	if key == "" {
+		return s.errorf(start, "empty field name")
+	}
+	if s.peek() != '=' {
+		return s.errorf(s.pos, "missing value for field %q", key)
+	}
+	s.pos++
+
+	valueStart := s.pos
+	if s.peek() == '"' {
+		value, err := s.scanString()
+		if err != nil {
+			return err
+		}
+		fields[key] = value
+		return nil
+	}
+
+	raw := s.scanUntil(", ", "")
+	if raw == "" {
+		return s.errorf(valueStart, "missing value for field %q", key)
+	}
+	value, err := parseFieldValue(raw)
+	if err != nil {
+		return s.wrapf(err, valueStart, "invalid field value '%s'", raw)
+	}
+
+	fields[key] = value
+	return nil
+}
+
+// scanString scans a double-quoted string field value, which may contain
+// spaces, commas and newlines
+func (s *lineScanner) scanString() (string, error) {
+	// The position of the opening quote is taken before newlines in the
+	// string move the current line past it
+	line, column := s.position(s.pos)
+	s.pos++
+
+	var b strings.Builder
+	for {
+		if s.pos >= len(s.input) {
+			return "", positionErrorf(line, column, "unterminated string field value")
+		}
+
+		c := s.input[s.pos]
+		switch {
+		case c == '"':
+			s.pos++
+			if next := s.peek(); next != ',' && next != ' ' && !s.atLineEnd() {
+				return "", s.errorf(s.pos, "unexpected text after string field value")
+			}
+			return b.String(), nil
+		case c == '\\' && s.pos+1 < len(s.input) && strings.IndexByte(stringEscapes, s.input[s.pos+1]) >= 0:
+			b.WriteByte(s.input[s.pos+1])
+			s.pos += 2
+		case c == '\n':
+			b.WriteByte(c)
+			s.pos++
+			s.line++
+			s.lineStart = s.pos
+		default:
+			b.WriteByte(c)
+			s.pos++
+		}
+	}
+}
+
+// scanTimestamp scans a signed Unix timestamp in units of the precision
+func (s *lineScanner) scanTimestamp() (time.Time, error) {
+	start := s.pos
+	raw := s.scanUntil(" \t", "")
+
+	ts, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}, s.wrapf(err, start, "invalid timestamp '%s'", raw)
+	}
+
+	t, ok := scaleTimestamp(ts, s.precision)
+	if !ok {
+		return time.Time{}, s.errorf(start, "timestamp '%s' is out of range for precision %s", raw, s.precision)
+	}
+	return t, nil
+}
+
+// scanUntil reads up to the first unescaped byte in stops or the end of the
+// line, resolving backslash escapes of the bytes in escapes
+func (s *lineScanner) scanUntil(stops, escapes string) string {
+	var b strings.Builder
+	for s.pos < len(s.input) && !s.atLineEnd() {
+		c := s.input[s.pos]
+		if strings.IndexByte(stops, c) >= 0 {
+			break
+		}
+		if c == '\\' && s.pos+1 < len(s.input) && strings.IndexByte(escapes, s.input[s.pos+1]) >= 0 {
+			c = s.input[s.pos+1]
+			s.pos++
+		}
+		b.WriteByte(c)
+		s.pos++
+	}
+	return b.String()
+}
+
+// peek returns the byte at the current position, or 0 at the end of the input
+func (s *lineScanner) peek() byte {
+	if s.pos >= len(s.input) {
+		return 0
+	}
+	return s.input[s.pos]
+}
+
+// atLineEnd reports whether the scanner is at a newline, a carriage return
+// ending the line or the end of the input
+func (s *lineScanner) atLineEnd() bool {
+	if s.pos >= len(s.input) {
+		return true
+	}
+	switch s.input[s.pos] {
+	case '\n':
+		return true
+	case '\r':
+		return s.pos+1 >= len(s.input) || s.input[s.pos+1] == '\n'
+	}
+	return false
+}
+
+// endLine consumes the line ending at the current position
+func (s *lineScanner) endLine() {
+	if s.peek() == '\r' {
+		s.pos++
+	}
+	if s.peek() == '\n' {
+		s.pos++
+		s.line++
+		s.lineStart = s.pos
+	}
+}
+
+// skipLine skips the rest of the current line, including its line ending
+func (s *lineScanner) skipLine() {
+	for !s.atLineEnd() {
+		s.pos++
+	}
+	s.endLine()
+}
+
+// skipSpaces skips the spaces separating the parts of a line, reporting
+// whether there were any
+func (s *lineScanner) skipSpaces() bool {
+	start := s.pos
+	for s.peek() == ' ' {
+		s.pos++
+	}
+	return s.pos > start
+}
+
+// skipBlanks skips spaces and tabs
+func (s *lineScanner) skipBlanks() {
+	for c := s.peek(); c == ' ' || c == '\t'; c = s.peek() {
+		s.pos++
+	}
+}
+
+// restOfLine returns the text from the current position to the end of the line
+func (s *lineScanner) restOfLine() string {
+	end := s.pos
+	for end < len(s.input) && s.input[end] != '\n' {
+		end++
+	}
+	return strings.TrimRight(s.input[s.pos:end], "\r")
+}
+
+// errorf returns a validation error located at the given offset
+func (s *lineScanner) errorf(pos int, format string, args ...interface{}) error {
+	line, column := s.position(pos)
+	return positionErrorf(line, column, format, args...)
+}
+
+// wrapf wraps err as a validation error located at the given offset
+func (s *lineScanner) wrapf(err error, pos int, format string, args ...interface{}) error {
+	line, column := s.position(pos)
+	return positionWrapf(err, line, column, format, args...)
+}
+
+// positionErrorf returns a validation error located at a 1-based line and
+// column of the input
+func positionErrorf(line, column int, format string, args ...interface{}) error {
+	return errors.NewValidationError(fmt.Sprintf("line %d, column %d: ", line, column)+fmt.Sprintf(format, args...)).
+		WithContext("line", line).
+		WithContext("column", column)
+}
+
+// positionWrapf wraps err as a validation error located at a 1-based line and
+// column of the input
+func positionWrapf(err error, line, column int, format string, args ...interface{}) error {
+	return errors.WrapWithType(err, errors.ErrorTypeValidation, fmt.Sprintf("line %d, column %d: ", line, column)+fmt.Sprintf(format, args...)).
+		WithContext("line", line).
+		WithContext("column", column)
+}
+
+// position returns the 1-based line and character column of an offset on the
+// current line
+func (s *lineScanner) position(pos int) (int, int) {
+	return s.line, utf8.RuneCountInString(s.input[s.lineStart:pos]) + 1
+}
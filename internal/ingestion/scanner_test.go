@@ -0,0 +1,199 @@
+package ingestion
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/types"
+)
+
+// scanAll returns every point of input with nanosecond timestamps, stamping
+// points without a timestamp with now
+func scanAll(input string, now time.Time) ([]types.Point, error) {
+	return scanAllWithPrecision(input, now, time.Nanosecond)
+}
+
+// scanAllWithPrecision returns every point of input with timestamps in units
+// of precision
+func scanAllWithPrecision(input string, now time.Time, precision time.Duration) ([]types.Point, error) {
+	s := newLineScanner(input, now, precision)
+	var points []types.Point
+	for {
+		p, ok, err := s.Next()
+		if err != nil || !ok {
+			return points, err
+		}
+		points = append(points, p)
+	}
+}
+
+func TestLineScanner(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ts := time.Unix(0, 1434055562000000000)
+
+	tests := []struct {
+		name  string
+		input string
+		want  []types.Point
+	}{
+		{
+			name:  "escaped measurement",
+			input: `disk\ usage\,total value=1 1434055562000000000`,
+			want:  []types.Point{{Measurement: "disk usage,total", Tags: map[string]string{}, Fields: map[string]interface{}{"value": 1.0}, Timestamp: ts}},
+		},
+		{
+			name:  "escaped tags and field keys",
+			input: `cpu,host\ name=server\,01,path=C:\\temp\=x,dir=a\b free\ space=1 1434055562000000000`,
+			want: []types.Point{{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host name": "server,01", "path": `C:\temp=x`, "dir": `a\b`},
+				Fields:      map[string]interface{}{"free space": 1.0},
+				Timestamp:   ts,
+			}},
+		},
+		{
+			name:  "string field with spaces, commas and newlines",
+			input: "log,host=a msg=\"disk full, retry in 5s\nnext\",code=3i 1434055562000000000",
+			want: []types.Point{{
+				Measurement: "log",
+				Tags:        map[string]string{"host": "a"},
+				Fields:      map[string]interface{}{"msg": "disk full, retry in 5s\nnext", "code": int64(3)},
+				Timestamp:   ts,
+			}},
+		},
+		{
+			name:  "string escapes",
+			input: `log msg="say \"hi\" C:\\ \n" 1434055562000000000`,
+			want:  []types.Point{{Measurement: "log", Tags: map[string]string{}, Fields: map[string]interface{}{"msg": `say "hi" C:\ \n`}, Timestamp: ts}},
+		},
+		{
+			name:  "comments, blank lines and CRLF",
+			input: "# header\r\n\r\n  cpu value=1 1434055562000000000\r\n\t# cpu value=2\ncpu value=3\r\n",
+			want: []types.Point{
+				{Measurement: "cpu", Tags: map[string]string{}, Fields: map[string]interface{}{"value": 1.0}, Timestamp: ts},
+				{Measurement: "cpu", Tags: map[string]string{}, Fields: map[string]interface{}{"value": 3.0}, Timestamp: now},
+			},
+		},
+		{
+			name:  "missing timestamp with trailing spaces",
+			input: "cpu,host=a value=1   ",
+			want:  []types.Point{{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: map[string]interface{}{"value": 1.0}, Timestamp: now}},
+		},
+		{
+			name:  "negative and short timestamps",
+			input: "cpu value=1 -1000000000\ncpu value=2 0\ncpu value=3 5",
+			want: []types.Point{
+				{Measurement: "cpu", Tags: map[string]string{}, Fields: map[string]interface{}{"value": 1.0}, Timestamp: time.Unix(-1, 0)},
+				{Measurement: "cpu", Tags: map[string]string{}, Fields: map[string]interface{}{"value": 2.0}, Timestamp: time.Unix(0, 0)},
+				{Measurement: "cpu", Tags: map[string]string{}, Fields: map[string]interface{}{"value": 3.0}, Timestamp: time.Unix(0, 5)},
+			},
+		},
+		{
+			name:  "numeric forms",
+			input: "m a=-1.5e-3,b=+2,c=.5,d=9223372036854775807i,e=18446744073709551615u 1434055562000000000",
+			want: []types.Point{{
+				Measurement: "m",
+				Tags:        map[string]string{},
+				Fields: map[string]interface{}{
+					"a": -1.5e-3, "b": 2.0, "c": 0.5,
+					"d": int64(9223372036854775807), "e": uint64(18446744073709551615),
+				},
+				Timestamp: ts,
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scanAll(tt.input, now)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %d points, got %+v", len(tt.want), got)
+			}
+			for i := range got {
+				if !got[i].Timestamp.Equal(tt.want[i].Timestamp) {
+					t.Errorf("Point %d: timestamp %v, want %v", i, got[i].Timestamp, tt.want[i].Timestamp)
+				}
+				got[i].Timestamp, tt.want[i].Timestamp = time.Time{}, time.Time{}
+				if !reflect.DeepEqual(got[i], tt.want[i]) {
+					t.Errorf("Point %d: got %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLineScannerErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"unterminated string", `log msg="oops 1434055562000000000`, `line 1, column 9: unterminated string field value`},
+		{"unterminated multiline string", "m f=\"abc\ndef", `line 1, column 5: unterminated string field value`},
+		{"text after string", `log msg="a"b 1`, `line 1, column 12: unexpected text after string field value`},
+		{"text after timestamp", "cpu value=1 1434055562000000000 extra", `line 1, column 33: unexpected text "extra" after point`},
+		{"NaN", "cpu value=NaN", `line 1, column 11: invalid field value 'NaN': strconv.ParseFloat: parsing "NaN": invalid syntax`},
+		{"hex float", "cpu value=0x1p-2", `line 1, column 11: invalid field value '0x1p-2': strconv.ParseFloat: parsing "0x1p-2": invalid syntax`},
+		{"unquoted string", "cpu value=running", `line 1, column 11: invalid field value 'running': strconv.ParseFloat: parsing "running": invalid syntax`},
+		{"missing field value", "cpu value=,idle=1", `line 1, column 11: missing value for field "value"`},
+		{"missing tag value", "cpu,host value=1", `line 1, column 9: missing value for tag "host"`},
+		{"position after comments", "# comment\ncpu value=1\n\ncpu,host=a", `line 4, column 11: missing fields`},
+		{"position after multi-line string", "log msg=\"a\nb\" x", `line 2, column 4: invalid timestamp 'x': strconv.ParseInt: parsing "x": invalid syntax`},
+		{"unicode column", "温度,位置=东京 值=abc", `line 1, column 12: invalid field value 'abc': strconv.ParseFloat: parsing "abc": invalid syntax`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := scanAll(tt.input, time.Now())
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Error = %q, want %q", err.Error(), tt.want)
+			}
+			if !errors.IsType(err, errors.ErrorTypeValidation) {
+				t.Errorf("Expected a validation error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLineScannerPrecision(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 34, 56, 789, time.UTC)
+
+	tests := []struct {
+		precision time.Duration
+		input     string
+		want      time.Time
+	}{
+		{time.Nanosecond, "cpu value=1 1434055562000000001", time.Unix(0, 1434055562000000001)},
+		{time.Microsecond, "cpu value=1 1434055562000001", time.Unix(0, 1434055562000001000)},
+		{time.Millisecond, "cpu value=1 1434055562001", time.Unix(0, 1434055562001000000)},
+		{time.Second, "cpu value=1 1434055562", time.Unix(1434055562, 0)},
+		{time.Second, "cpu value=1 -86400", time.Unix(-86400, 0)},
+		{time.Minute, "cpu value=1 23900926", time.Unix(23900926*60, 0)},
+		{time.Hour, "cpu value=1 398348", time.Unix(398348*3600, 0)},
+		{time.Second, "cpu value=1", time.Date(2024, 1, 1, 12, 34, 56, 0, time.UTC)},
+		{time.Hour, "cpu value=1", time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		points, err := scanAllWithPrecision(tt.input, now, tt.precision)
+		if err != nil {
+			t.Fatalf("%s at %s: %v", tt.input, tt.precision, err)
+		}
+		if len(points) != 1 || !points[0].Timestamp.Equal(tt.want) {
+			t.Errorf("%s at %s = %+v, want timestamp %v", tt.input, tt.precision, points, tt.want)
+		}
+	}
+
+	_, err := scanAllWithPrecision("cpu value=1 9223372036855", now, time.Millisecond)
+	want := "line 1, column 13: timestamp '9223372036855' is out of range for precision 1ms"
+	if err == nil || err.Error() != want {
+		t.Errorf("Error = %v, want %q", err, want)
+	}
+}
@@ -52,6 +52,10 @@ func unregisterFromDefaultRegistry() {
 		storage.StorageShardCount,
 		storage.WALWriteOperations,
 		storage.WALReplayOperations,
+		storage.RetentionRuns,
+		storage.RetentionSegmentsDeleted,
+		storage.RetentionPointsReclaimed,
+		storage.RetentionBytesReclaimed,
 	}
 
 	// Unregister each metric from the default registry
@@ -79,6 +83,10 @@ func registerStorageMetrics() {
 		storage.StorageShardCount,
 		storage.WALWriteOperations,
 		storage.WALReplayOperations,
+		storage.RetentionRuns,
+		storage.RetentionSegmentsDeleted,
+		storage.RetentionPointsReclaimed,
+		storage.RetentionBytesReclaimed,
 	}
 
 	for _, metric := range storageMetrics {
@@ -170,6 +178,17 @@ func initializeMetricsWithDefaults() {
 	if storage.WALReplayOperations != nil {
 		storage.WALReplayOperations.WithLabelValues("success").Add(0)
 	}
+	if storage.RetentionRuns != nil {
+		storage.RetentionRuns.WithLabelValues("success").Add(0)
+	}
+	if storage.RetentionPointsReclaimed != nil {
+		storage.RetentionPointsReclaimed.WithLabelValues("segment").Add(0)
+		storage.RetentionPointsReclaimed.WithLabelValues("compaction").Add(0)
+	}
+	if storage.RetentionBytesReclaimed != nil {
+		storage.RetentionBytesReclaimed.WithLabelValues("segment").Add(0)
+		storage.RetentionBytesReclaimed.WithLabelValues("compaction").Add(0)
+	}
 
 	// Initialize server metrics with default values
 	if ServerStatus != nil {
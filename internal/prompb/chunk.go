@@ -0,0 +1,291 @@
+package prompb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// MaxChunkSamples is the number of samples of a full chunk, as Prometheus cuts
+// its own chunks
+const MaxChunkSamples = 120
+
+// errCorruptChunk is returned for chunk data that is not a valid XOR chunk
+var errCorruptChunk = errors.New("xor chunk: corrupt data")
+
+// XORChunk encodes samples in the Gorilla XOR chunk format of Prometheus: a
+// two byte big-endian sample count, then the first timestamp as a varint and
+// value as raw bits, the second timestamp as a delta and every later one as
+// a delta of deltas, and each value XORed with the previous one.
+type XORChunk struct {
+	b        bitWriter
+	count    uint16
+	t        int64
+	v        float64
+	tDelta   uint64
+	leading  uint8
+	trailing uint8
+}
+
+// NewXORChunk returns an empty chunk
+func NewXORChunk() *XORChunk {
+	return &XORChunk{b: bitWriter{stream: []byte{0, 0}}, leading: 0xff}
+}
+
+// NumSamples returns the number of samples appended
+func (c *XORChunk) NumSamples() int {
+	return int(c.count)
+}
+
+// Bytes returns the encoded chunk
+func (c *XORChunk) Bytes() []byte {
+	return c.b.stream
+}
+
+// Append adds a sample, with a timestamp in milliseconds after those of the
+// samples already appended
+func (c *XORChunk) Append(t int64, v float64) {
+	switch c.count {
+	case 0:
+		c.b.stream = binary.AppendVarint(c.b.stream, t)
+		c.b.writeBits(math.Float64bits(v), 64)
+	case 1:
+		c.tDelta = uint64(t - c.t)
+		c.b.stream = binary.AppendUvarint(c.b.stream, c.tDelta)
+		c.writeValue(v)
+	default:
+		tDelta := uint64(t - c.t)
+		dod := int64(tDelta - c.tDelta)
+		switch {
+		case dod == 0:
+			c.b.writeBit(false)
+		case bitRange(dod, 14):
+			c.b.writeBits(0b10, 2)
+			c.b.writeBits(uint64(dod), 14)
+		case bitRange(dod, 17):
+			c.b.writeBits(0b110, 3)
+			c.b.writeBits(uint64(dod), 17)
+		case bitRange(dod, 20):
+			c.b.writeBits(0b1110, 4)
+			c.b.writeBits(uint64(dod), 20)
+		default:
+			c.b.writeBits(0b1111, 4)
+			c.b.writeBits(uint64(dod), 64)
+		}
+		c.tDelta = tDelta
+		c.writeValue(v)
+	}
+
+	c.t, c.v = t, v
+	c.count++
+	binary.BigEndian.PutUint16(c.b.stream, c.count)
+}
+
+// writeValue writes the XOR of a value with the previous one, reusing the
+// leading and trailing zero counts of the previous XOR when its meaningful
+// bits fit within them
+func (c *XORChunk) writeValue(v float64) {
+	delta := math.Float64bits(v) ^ math.Float64bits(c.v)
+	if delta == 0 {
+		c.b.writeBit(false)
+		return
+	}
+	c.b.writeBit(true)
+
+	leading := uint8(bits.LeadingZeros64(delta))
+	trailing := uint8(bits.TrailingZeros64(delta))
+	// The leading zero count is stored in 5 bits
+	if leading >= 32 {
+		leading = 31
+	}
+
+	if c.leading != 0xff && leading >= c.leading && trailing >= c.trailing {
+		c.b.writeBit(false)
+		c.b.writeBits(delta>>c.trailing, 64-int(c.leading)-int(c.trailing))
+		return
+	}
+
+	c.leading, c.trailing = leading, trailing
+	c.b.writeBit(true)
+	c.b.writeBits(uint64(leading), 5)
+	// 64 meaningful bits are stored as 0 in 6 bits
+	sigbits := 64 - leading - trailing
+	c.b.writeBits(uint64(sigbits), 6)
+	c.b.writeBits(delta>>trailing, int(sigbits))
+}
+
+// bitRange reports whether a delta of deltas fits in nbits bits
+func bitRange(x int64, nbits uint8) bool {
+	return -((1<<(nbits-1))-1) <= x && x <= 1<<(nbits-1)
+}
+
+// DecodeXORChunk returns the samples of an XOR chunk
+func DecodeXORChunk(data []byte) ([]Sample, error) {
+	if len(data) < 2 {
+		return nil, errCorruptChunk
+	}
+	count := int(binary.BigEndian.Uint16(data))
+	r := bitReader{stream: data[2:]}
+
+	samples := make([]Sample, 0, count)
+	var t int64
+	var tDelta uint64
+	var v uint64
+	var leading, trailing uint8
+	for i := 0; i < count; i++ {
+		switch i {
+		case 0:
+			ts, n := binary.Varint(r.stream)
+			if n <= 0 {
+				return nil, errCorruptChunk
+			}
+			r.stream = r.stream[n:]
+			t = ts
+			var ok bool
+			if v, ok = r.readBits(64); !ok {
+				return nil, errCorruptChunk
+			}
+		case 1:
+			d, n := binary.Uvarint(r.stream)
+			if n <= 0 {
+				return nil, errCorruptChunk
+			}
+			r.stream = r.stream[n:]
+			tDelta = d
+			t += int64(tDelta)
+			if !r.readValue(&v, &leading, &trailing) {
+				return nil, errCorruptChunk
+			}
+		default:
+			// The prefix of ones selects the width of the delta of deltas
+			var prefix int
+			for prefix < 4 {
+				bit, ok := r.readBit()
+				if !ok {
+					return nil, errCorruptChunk
+				}
+				if !bit {
+					break
+				}
+				prefix++
+			}
+			var dod int64
+			if width := [...]int{0, 14, 17, 20, 64}[prefix]; width > 0 {
+				raw, ok := r.readBits(width)
+				if !ok {
+					return nil, errCorruptChunk
+				}
+				dod = int64(raw)
+				// Deltas range from -(2^(width-1) - 1) to 2^(width-1)
+				if width < 64 && raw > 1<<(width-1) {
+					dod -= 1 << width
+				}
+			}
+			tDelta = uint64(int64(tDelta) + dod)
+			t += int64(tDelta)
+			if !r.readValue(&v, &leading, &trailing) {
+				return nil, errCorruptChunk
+			}
+		}
+		samples = append(samples, Sample{Value: math.Float64frombits(v), Timestamp: t})
+	}
+	return samples, nil
+}
+
+// bitWriter appends bits to a byte stream, most significant bit first
+type bitWriter struct {
+	stream []byte
+	// free is the number of bits left unwritten in the last byte
+	free uint8
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.stream = append(w.stream, 0)
+		w.free = 8
+	}
+	w.free--
+	if bit {
+		w.stream[len(w.stream)-1] |= 1 << w.free
+	}
+}
+
+// writeBits writes the nbits low bits of u
+func (w *bitWriter) writeBits(u uint64, nbits int) {
+	for i := nbits - 1; i >= 0; i-- {
+		w.writeBit(u>>uint(i)&1 == 1)
+	}
+}
+
+// bitReader reads bits from a byte stream, most significant bit first
+type bitReader struct {
+	stream []byte
+	// pos is the number of bits read from the first byte of stream
+	pos uint8
+}
+
+func (r *bitReader) readBit() (bool, bool) {
+	if len(r.stream) == 0 {
+		return false, false
+	}
+	bit := r.stream[0]>>(7-r.pos)&1 == 1
+	r.pos++
+	if r.pos == 8 {
+		r.stream, r.pos = r.stream[1:], 0
+	}
+	return bit, true
+}
+
+func (r *bitReader) readBits(nbits int) (uint64, bool) {
+	var u uint64
+	for i := 0; i < nbits; i++ {
+		bit, ok := r.readBit()
+		if !ok {
+			return 0, false
+		}
+		u <<= 1
+		if bit {
+			u |= 1
+		}
+	}
+	return u, true
+}
+
+// readValue reads the XOR of a value with the previous one into v
+func (r *bitReader) readValue(v *uint64, leading, trailing *uint8) bool {
+	changed, ok := r.readBit()
+	if !ok {
+		return false
+	}
+	if !changed {
+		return true
+	}
+
+	newWindow, ok := r.readBit()
+	if !ok {
+		return false
+	}
+	if newWindow {
+		l, ok := r.readBits(5)
+		if !ok {
+			return false
+		}
+		sigbits, ok := r.readBits(6)
+		if !ok {
+			return false
+		}
+		if sigbits == 0 {
+			sigbits = 64
+		}
+		*leading, *trailing = uint8(l), uint8(64-l-sigbits)
+	}
+
+	sigbits := 64 - int(*leading) - int(*trailing)
+	delta, ok := r.readBits(sigbits)
+	if !ok {
+		return false
+	}
+	*v ^= delta << *trailing
+	return true
+}
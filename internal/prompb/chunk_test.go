@@ -0,0 +1,91 @@
+package prompb
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestXORChunkEncoding(t *testing.T) {
+	c := NewXORChunk()
+	c.Append(1000, 1)
+	c.Append(2000, 1)
+	c.Append(3000, 1)
+
+	// Count, varint 1000, raw 1.0, uvarint delta 1000, then one bit for the
+	// unchanged value and two for the third sample
+	want := []byte{0x00, 0x03, 0xd0, 0x0f, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0, 0xe8, 0x07, 0x00}
+	if !bytes.Equal(c.Bytes(), want) {
+		t.Errorf("Got chunk % x, want % x", c.Bytes(), want)
+	}
+	if c.NumSamples() != 3 {
+		t.Errorf("Expected 3 samples, got %d", c.NumSamples())
+	}
+}
+
+func TestXORChunkRoundTrip(t *testing.T) {
+	tests := map[string][]Sample{
+		"single": {{Value: 42, Timestamp: -5}},
+		"regular": func() []Sample {
+			var s []Sample
+			for i := 0; i < MaxChunkSamples; i++ {
+				s = append(s, Sample{Value: float64(i * 10), Timestamp: 1700000000000 + int64(i)*15000})
+			}
+			return s
+		}(),
+		"irregular": {
+			{Value: 1, Timestamp: 0},
+			{Value: 1, Timestamp: 10},
+			{Value: 2, Timestamp: 20},
+			// Deltas of deltas at the edges of each width
+			{Value: -2, Timestamp: 20 + 10 + 8192},
+			{Value: 0.1, Timestamp: 20 + 10 + 8192 + 10 + 8192 - 8191},
+			{Value: 1e300, Timestamp: 1 << 20},
+			{Value: math.Inf(-1), Timestamp: 1<<20 + 1<<19},
+			{Value: math.NaN(), Timestamp: 1 << 40},
+			{Value: 3.25, Timestamp: 1<<40 + 1},
+			{Value: 3.25, Timestamp: 1<<40 + 2},
+		},
+	}
+
+	for name, samples := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := NewXORChunk()
+			for _, s := range samples {
+				c.Append(s.Timestamp, s.Value)
+			}
+
+			got, err := DecodeXORChunk(c.Bytes())
+			if err != nil {
+				t.Fatalf("DecodeXORChunk failed: %v", err)
+			}
+			if len(got) != len(samples) {
+				t.Fatalf("Expected %d samples, got %d", len(samples), len(got))
+			}
+			for i := range samples {
+				if got[i].Timestamp != samples[i].Timestamp || math.Float64bits(got[i].Value) != math.Float64bits(samples[i].Value) {
+					t.Errorf("Sample %d: got %+v, want %+v", i, got[i], samples[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeXORChunkErrors(t *testing.T) {
+	c := NewXORChunk()
+	c.Append(1000, 1)
+	c.Append(2000, 2.5)
+	c.Append(3100, 7)
+	data := c.Bytes()
+
+	for _, input := range [][]byte{nil, {0x00}, data[:len(data)-2], data[:6]} {
+		if _, err := DecodeXORChunk(input); err == nil {
+			t.Errorf("Expected an error decoding % x", input)
+		}
+	}
+
+	empty, err := DecodeXORChunk(NewXORChunk().Bytes())
+	if err != nil || len(empty) != 0 {
+		t.Errorf("Expected an empty chunk to decode to no samples, got %v, %v", empty, err)
+	}
+}
@@ -0,0 +1,60 @@
+package prompb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ChunkedReadContentType is the content type of streamed remote read
+// responses
+const ChunkedReadContentType = "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse"
+
+// castagnoliTable is the CRC32 table of the checksums of streamed frames
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// AppendChunkedFrame appends a message framed as in streamed remote read
+// responses: its length as a uvarint, the big-endian CRC32 Castagnoli
+// checksum of the message, then the message
+func AppendChunkedFrame(dst, msg []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(msg)))
+	dst = binary.BigEndian.AppendUint32(dst, crc32.Checksum(msg, castagnoliTable))
+	return append(dst, msg...)
+}
+
+// ReadChunkedFrame reads the message of the next frame of a streamed remote
+// read response, returning io.EOF once the stream ends between frames.
+// Frames larger than maxSize bytes are rejected.
+func ReadChunkedFrame(r *bufio.Reader, maxSize int) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(maxSize) {
+		return nil, fmt.Errorf("chunked frame of %d bytes exceeds the limit of %d bytes", size, maxSize)
+	}
+
+	var checksum [4]byte
+	if _, err := io.ReadFull(r, checksum[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if crc32.Checksum(msg, castagnoliTable) != binary.BigEndian.Uint32(checksum[:]) {
+		return nil, errors.New("chunked frame checksum mismatch")
+	}
+	return msg, nil
+}
+
+// unexpectedEOF reports the end of the stream within a frame as an error
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package prompb
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestChunkedFrames(t *testing.T) {
+	messages := [][]byte{[]byte("first"), {}, bytes.Repeat([]byte("x"), 300)}
+
+	var stream []byte
+	for _, msg := range messages {
+		stream = AppendChunkedFrame(stream, msg)
+	}
+
+	r := bufio.NewReader(bytes.NewReader(stream))
+	for i, want := range messages {
+		got, err := ReadChunkedFrame(r, 1024)
+		if err != nil {
+			t.Fatalf("Frame %d: ReadChunkedFrame failed: %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Frame %d: got %q, want %q", i, got, want)
+		}
+	}
+	if _, err := ReadChunkedFrame(r, 1024); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last frame, got %v", err)
+	}
+}
+
+func TestReadChunkedFrameErrors(t *testing.T) {
+	frame := AppendChunkedFrame(nil, []byte("message"))
+	corrupted := append([]byte{}, frame...)
+	corrupted[len(corrupted)-1] ^= 0xff
+
+	tests := []struct {
+		name  string
+		input []byte
+		check func(error) bool
+	}{
+		{"checksum mismatch", corrupted, func(err error) bool { return err != nil && err.Error() == "chunked frame checksum mismatch" }},
+		{"truncated message", frame[:len(frame)-1], func(err error) bool { return errors.Is(err, io.ErrUnexpectedEOF) }},
+		{"truncated checksum", frame[:3], func(err error) bool { return errors.Is(err, io.ErrUnexpectedEOF) }},
+		{"too large", AppendChunkedFrame(nil, make([]byte, 2048)), func(err error) bool { return err != nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadChunkedFrame(bufio.NewReader(bytes.NewReader(tt.input)), 1024)
+			if !tt.check(err) {
+				t.Errorf("Unexpected error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package prompb
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ReadResponseType is a response type a remote read client accepts
+type ReadResponseType int32
+
+const (
+	// ReadResponseSamples is a snappy compressed ReadResponse of raw samples
+	ReadResponseSamples ReadResponseType = 0
+	// ReadResponseStreamedXORChunks is a stream of ChunkedReadResponse frames
+	// holding XOR encoded chunks
+	ReadResponseStreamedXORChunks ReadResponseType = 1
+)
+
+// LabelMatcherType is the comparison of a label matcher
+type LabelMatcherType int32
+
+const (
+	// LabelMatcherEqual is =
+	LabelMatcherEqual LabelMatcherType = 0
+	// LabelMatcherNotEqual is !=
+	LabelMatcherNotEqual LabelMatcherType = 1
+	// LabelMatcherRegexp is =~
+	LabelMatcherRegexp LabelMatcherType = 2
+	// LabelMatcherNotRegexp is !~
+	LabelMatcherNotRegexp LabelMatcherType = 3
+)
+
+// ChunkEncoding is the encoding of the samples of a chunk
+type ChunkEncoding int32
+
+// ChunkEncodingXOR is the Gorilla XOR encoding of Prometheus chunks
+const ChunkEncodingXOR ChunkEncoding = 1
+
+// ReadRequest is the body of a remote read request. The response types are
+// listed in order of preference.
+type ReadRequest struct {
+	Queries               []Query
+	AcceptedResponseTypes []ReadResponseType
+}
+
+// Query selects the series matching every matcher between two timestamps in
+// milliseconds, inclusive. Hints are skipped.
+type Query struct {
+	StartTimestampMs int64
+	EndTimestampMs   int64
+	Matchers         []LabelMatcher
+}
+
+// LabelMatcher compares the value of a label
+type LabelMatcher struct {
+	Type  LabelMatcherType
+	Name  string
+	Value string
+}
+
+// ReadResponse is the samples response of a remote read request, with one
+// result per query
+type ReadResponse struct {
+	Results []QueryResult
+}
+
+// QueryResult holds the series matched by a query
+type QueryResult struct {
+	Timeseries []TimeSeries
+}
+
+// ChunkedReadResponse is one frame of a streamed remote read response,
+// holding series of the query at QueryIndex
+type ChunkedReadResponse struct {
+	ChunkedSeries []ChunkedSeries
+	QueryIndex    int64
+}
+
+// ChunkedSeries is a series with its samples encoded in chunks
+type ChunkedSeries struct {
+	Labels []Label
+	Chunks []Chunk
+}
+
+// Chunk holds the encoded samples of a series between two timestamps in
+// milliseconds, inclusive
+type Chunk struct {
+	MinTimeMs int64
+	MaxTimeMs int64
+	Type      ChunkEncoding
+	Data      []byte
+}
+
+// Unmarshal decodes a protobuf encoded ReadRequest
+func (m *ReadRequest) Unmarshal(b []byte) error {
+	*m = ReadRequest{}
+	return decodeFields(b, "ReadRequest", func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			var q Query
+			return decodeMessage(b, "ReadRequest.queries", q.unmarshal, func() { m.Queries = append(m.Queries, q) })
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return 0, fmt.Errorf("ReadRequest.accepted_response_types: %w", protowire.ParseError(n))
+			}
+			m.AcceptedResponseTypes = append(m.AcceptedResponseTypes, ReadResponseType(v))
+			return n, nil
+		case num == 2 && typ == protowire.BytesType:
+			// Repeated enums are packed by default
+			packed, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return 0, fmt.Errorf("ReadRequest.accepted_response_types: %w", protowire.ParseError(n))
+			}
+			for len(packed) > 0 {
+				v, vn := protowire.ConsumeVarint(packed)
+				if vn < 0 {
+					return 0, fmt.Errorf("ReadRequest.accepted_response_types: %w", protowire.ParseError(vn))
+				}
+				m.AcceptedResponseTypes = append(m.AcceptedResponseTypes, ReadResponseType(v))
+				packed = packed[vn:]
+			}
+			return n, nil
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// Marshal encodes the ReadRequest in protobuf
+func (m *ReadRequest) Marshal() []byte {
+	var b []byte
+	for i := range m.Queries {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Queries[i].marshal(nil))
+	}
+	if len(m.AcceptedResponseTypes) > 0 {
+		var packed []byte
+		for _, t := range m.AcceptedResponseTypes {
+			packed = protowire.AppendVarint(packed, uint64(t))
+		}
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	}
+	return b
+}
+
+func (m *Query) unmarshal(b []byte) error {
+	*m = Query{}
+	return decodeFields(b, "Query", func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			return consumeInt64(b, "Query.start_timestamp_ms", &m.StartTimestampMs)
+		case num == 2 && typ == protowire.VarintType:
+			return consumeInt64(b, "Query.end_timestamp_ms", &m.EndTimestampMs)
+		case num == 3 && typ == protowire.BytesType:
+			var lm LabelMatcher
+			return decodeMessage(b, "Query.matchers", lm.unmarshal, func() { m.Matchers = append(m.Matchers, lm) })
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *Query) marshal(b []byte) []byte {
+	b = appendInt64(b, 1, m.StartTimestampMs)
+	b = appendInt64(b, 2, m.EndTimestampMs)
+	for _, lm := range m.Matchers {
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, lm.marshal(nil))
+	}
+	return b
+}
+
+func (m *LabelMatcher) unmarshal(b []byte) error {
+	*m = LabelMatcher{}
+	return decodeFields(b, "LabelMatcher", func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			var v int64
+			n, err := consumeInt64(b, "LabelMatcher.type", &v)
+			m.Type = LabelMatcherType(v)
+			return n, err
+		case num == 2 && typ == protowire.BytesType:
+			return consumeString(b, "LabelMatcher.name", &m.Name)
+		case num == 3 && typ == protowire.BytesType:
+			return consumeString(b, "LabelMatcher.value", &m.Value)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *LabelMatcher) marshal(b []byte) []byte {
+	b = appendInt64(b, 1, int64(m.Type))
+	b = appendString(b, 2, m.Name)
+	return appendString(b, 3, m.Value)
+}
+
+// Unmarshal decodes a protobuf encoded ReadResponse
+func (m *ReadResponse) Unmarshal(b []byte) error {
+	*m = ReadResponse{}
+	return decodeFields(b, "ReadResponse", func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != 1 || typ != protowire.BytesType {
+			return skipField(num, typ, b)
+		}
+		var r QueryResult
+		return decodeMessage(b, "ReadResponse.results", r.unmarshal, func() { m.Results = append(m.Results, r) })
+	})
+}
+
+// Marshal encodes the ReadResponse in protobuf
+func (m *ReadResponse) Marshal() []byte {
+	var b []byte
+	for i := range m.Results {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Results[i].marshal(nil))
+	}
+	return b
+}
+
+func (m *QueryResult) unmarshal(b []byte) error {
+	*m = QueryResult{}
+	return decodeFields(b, "QueryResult", func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != 1 || typ != protowire.BytesType {
+			return skipField(num, typ, b)
+		}
+		var ts TimeSeries
+		return decodeMessage(b, "QueryResult.timeseries", ts.unmarshal, func() { m.Timeseries = append(m.Timeseries, ts) })
+	})
+}
+
+func (m *QueryResult) marshal(b []byte) []byte {
+	for i := range m.Timeseries {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Timeseries[i].marshal(nil))
+	}
+	return b
+}
+
+// Unmarshal decodes a protobuf encoded ChunkedReadResponse
+func (m *ChunkedReadResponse) Unmarshal(b []byte) error {
+	*m = ChunkedReadResponse{}
+	return decodeFields(b, "ChunkedReadResponse", func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			var cs ChunkedSeries
+			return decodeMessage(b, "ChunkedReadResponse.chunked_series", cs.unmarshal, func() { m.ChunkedSeries = append(m.ChunkedSeries, cs) })
+		case num == 2 && typ == protowire.VarintType:
+			return consumeInt64(b, "ChunkedReadResponse.query_index", &m.QueryIndex)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+// Marshal encodes the ChunkedReadResponse in protobuf
+func (m *ChunkedReadResponse) Marshal() []byte {
+	var b []byte
+	for i := range m.ChunkedSeries {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.ChunkedSeries[i].marshal(nil))
+	}
+	return appendInt64(b, 2, m.QueryIndex)
+}
+
+func (m *ChunkedSeries) unmarshal(b []byte) error {
+	*m = ChunkedSeries{}
+	return decodeFields(b, "ChunkedSeries", func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			var l Label
+			return decodeMessage(b, "ChunkedSeries.labels", l.unmarshal, func() { m.Labels = append(m.Labels, l) })
+		case num == 2 && typ == protowire.BytesType:
+			var c Chunk
+			return decodeMessage(b, "ChunkedSeries.chunks", c.unmarshal, func() { m.Chunks = append(m.Chunks, c) })
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *ChunkedSeries) marshal(b []byte) []byte {
+	for _, l := range m.Labels {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, l.marshal(nil))
+	}
+	for i := range m.Chunks {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Chunks[i].marshal(nil))
+	}
+	return b
+}
+
+func (m *Chunk) unmarshal(b []byte) error {
+	*m = Chunk{}
+	return decodeFields(b, "Chunk", func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			return consumeInt64(b, "Chunk.min_time_ms", &m.MinTimeMs)
+		case num == 2 && typ == protowire.VarintType:
+			return consumeInt64(b, "Chunk.max_time_ms", &m.MaxTimeMs)
+		case num == 3 && typ == protowire.VarintType:
+			var v int64
+			n, err := consumeInt64(b, "Chunk.type", &v)
+			m.Type = ChunkEncoding(v)
+			return n, err
+		case num == 4 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return 0, fmt.Errorf("Chunk.data: %w", protowire.ParseError(n))
+			}
+			m.Data = append([]byte(nil), v...)
+			return n, nil
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *Chunk) marshal(b []byte) []byte {
+	b = appendInt64(b, 1, m.MinTimeMs)
+	b = appendInt64(b, 2, m.MaxTimeMs)
+	b = appendInt64(b, 3, int64(m.Type))
+	if len(m.Data) > 0 {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Data)
+	}
+	return b
+}
+
+// consumeInt64 decodes an int64 or enum field value into v
+func consumeInt64(b []byte, field string, v *int64) (int, error) {
+	u, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, fmt.Errorf("%s: %w", field, protowire.ParseError(n))
+	}
+	*v = int64(u)
+	return n, nil
+}
+
+// consumeString decodes a string field value into v
+func consumeString(b []byte, field string, v *string) (int, error) {
+	s, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, fmt.Errorf("%s: %w", field, protowire.ParseError(n))
+	}
+	*v = string(s)
+	return n, nil
+}
+
+// appendInt64 appends an int64 or enum field, which proto3 leaves out when zero
+func appendInt64(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// appendString appends a string field, which proto3 leaves out when empty
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
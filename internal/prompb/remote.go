@@ -0,0 +1,172 @@
+// Package prompb implements the messages of the Prometheus remote storage
+// protocol, the snappy compression of their bodies, and the XOR chunks and
+// frames of streamed remote read responses. Messages are encoded
+// and decoded field by field with protowire, so only the fields the
+// protocol defines are read and unknown fields are skipped.
+package prompb
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// WriteRequest is the body of a remote write request. Metadata is skipped.
+type WriteRequest struct {
+	Timeseries []TimeSeries
+}
+
+// TimeSeries is a series identified by its labels with its samples. Exemplars
+// and native histograms are skipped.
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// Label is a label name and value pair
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a value at a timestamp in milliseconds since the Unix epoch
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// Unmarshal decodes a protobuf encoded WriteRequest
+func (m *WriteRequest) Unmarshal(b []byte) error {
+	*m = WriteRequest{}
+	return decodeFields(b, "WriteRequest", func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != 1 || typ != protowire.BytesType {
+			return skipField(num, typ, b)
+		}
+		var ts TimeSeries
+		return decodeMessage(b, "WriteRequest.timeseries", ts.unmarshal, func() { m.Timeseries = append(m.Timeseries, ts) })
+	})
+}
+
+// Marshal encodes the WriteRequest in protobuf
+func (m *WriteRequest) Marshal() []byte {
+	var b []byte
+	for i := range m.Timeseries {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, m.Timeseries[i].marshal(nil))
+	}
+	return b
+}
+
+func (m *TimeSeries) unmarshal(b []byte) error {
+	*m = TimeSeries{}
+	return decodeFields(b, "TimeSeries", func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			var l Label
+			return decodeMessage(b, "TimeSeries.labels", l.unmarshal, func() { m.Labels = append(m.Labels, l) })
+		case num == 2 && typ == protowire.BytesType:
+			var s Sample
+			return decodeMessage(b, "TimeSeries.samples", s.unmarshal, func() { m.Samples = append(m.Samples, s) })
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *TimeSeries) marshal(b []byte) []byte {
+	for _, l := range m.Labels {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, l.marshal(nil))
+	}
+	for _, s := range m.Samples {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, s.marshal(nil))
+	}
+	return b
+}
+
+func (m *Label) unmarshal(b []byte) error {
+	*m = Label{}
+	return decodeFields(b, "Label", func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return consumeString(b, "Label.name", &m.Name)
+		case num == 2 && typ == protowire.BytesType:
+			return consumeString(b, "Label.value", &m.Value)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *Label) marshal(b []byte) []byte {
+	b = appendString(b, 1, m.Name)
+	return appendString(b, 2, m.Value)
+}
+
+func (m *Sample) unmarshal(b []byte) error {
+	*m = Sample{}
+	return decodeFields(b, "Sample", func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				return 0, fmt.Errorf("Sample.value: %w", protowire.ParseError(n))
+			}
+			m.Value = math.Float64frombits(v)
+			return n, nil
+		case num == 2 && typ == protowire.VarintType:
+			return consumeInt64(b, "Sample.timestamp", &m.Timestamp)
+		}
+		return skipField(num, typ, b)
+	})
+}
+
+func (m *Sample) marshal(b []byte) []byte {
+	if m.Value != 0 || math.Signbit(m.Value) {
+		b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(m.Value))
+	}
+	return appendInt64(b, 2, m.Timestamp)
+}
+
+// decodeFields calls field for each field of an encoded message, with the
+// bytes following its tag. field returns the length of the value it consumed.
+func decodeFields(b []byte, message string, field func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("%s: %w", message, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		n, err := field(num, typ, b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// decodeMessage decodes an embedded message with unmarshal, then calls done
+// to keep it, returning the length consumed
+func decodeMessage(b []byte, field string, unmarshal func([]byte) error, done func()) (int, error) {
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, fmt.Errorf("%s: %w", field, protowire.ParseError(n))
+	}
+	if err := unmarshal(v); err != nil {
+		return 0, err
+	}
+	done()
+	return n, nil
+}
+
+// skipField returns the length of the value of a field that is not decoded
+func skipField(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+	n := protowire.ConsumeFieldValue(num, typ, b)
+	if n < 0 {
+		return 0, fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+	}
+	return n, nil
+}
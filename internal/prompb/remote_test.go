@@ -0,0 +1,136 @@
+package prompb
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestWriteRequestRoundTrip(t *testing.T) {
+	req := WriteRequest{Timeseries: []TimeSeries{
+		{
+			Labels:  []Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "node"}},
+			Samples: []Sample{{Value: 1, Timestamp: 1700000000000}, {Value: 0, Timestamp: 1700000015000}},
+		},
+		{
+			Labels:  []Label{{Name: "__name__", Value: "temperature"}},
+			Samples: []Sample{{Value: -12.5, Timestamp: -1000}, {Value: math.Inf(1), Timestamp: 0}},
+		},
+	}}
+
+	var got WriteRequest
+	if err := got.Unmarshal(req.Marshal()); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, req) {
+		t.Errorf("Got %+v, want %+v", got, req)
+	}
+}
+
+func TestWriteRequestSkipsUnknownFields(t *testing.T) {
+	ts := TimeSeries{Labels: []Label{{Name: "__name__", Value: "up"}}, Samples: []Sample{{Value: 1, Timestamp: 5}}}
+	series := ts.marshal(nil)
+	// An exemplar of the series
+	series = protowire.AppendTag(series, 3, protowire.BytesType)
+	series = protowire.AppendBytes(series, []byte{0x11, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f})
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, series)
+	// Metadata of the request
+	b = protowire.AppendTag(b, 3, protowire.BytesType)
+	b = protowire.AppendBytes(b, []byte{0x08, 0x01})
+
+	var got WriteRequest
+	if err := got.Unmarshal(b); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if want := (WriteRequest{Timeseries: []TimeSeries{ts}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteRequestUnmarshalErrors(t *testing.T) {
+	valid := (&WriteRequest{Timeseries: []TimeSeries{{
+		Labels:  []Label{{Name: "__name__", Value: "up"}},
+		Samples: []Sample{{Value: 1, Timestamp: 5}},
+	}}}).Marshal()
+
+	inputs := map[string][]byte{
+		"truncated":    valid[:len(valid)-3],
+		"invalid tag":  {0x80},
+		"invalid wire": {0x0f},
+	}
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			var req WriteRequest
+			if err := req.Unmarshal(input); err == nil {
+				t.Error("Expected a decoding error")
+			}
+		})
+	}
+}
+
+func TestReadRequestRoundTrip(t *testing.T) {
+	req := ReadRequest{
+		Queries: []Query{{
+			StartTimestampMs: 1700000000000,
+			EndTimestampMs:   1700003600000,
+			Matchers: []LabelMatcher{
+				{Type: LabelMatcherEqual, Name: "__name__", Value: "up"},
+				{Type: LabelMatcherNotRegexp, Name: "job", Value: "node|api"},
+			},
+		}},
+		AcceptedResponseTypes: []ReadResponseType{ReadResponseStreamedXORChunks, ReadResponseSamples},
+	}
+
+	var got ReadRequest
+	if err := got.Unmarshal(req.Marshal()); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, req) {
+		t.Errorf("Got %+v, want %+v", got, req)
+	}
+
+	// Response types may also be sent unpacked
+	var unpacked []byte
+	unpacked = protowire.AppendTag(unpacked, 2, protowire.VarintType)
+	unpacked = protowire.AppendVarint(unpacked, uint64(ReadResponseStreamedXORChunks))
+	if err := got.Unmarshal(unpacked); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(got.AcceptedResponseTypes, []ReadResponseType{ReadResponseStreamedXORChunks}) {
+		t.Errorf("Got response types %v", got.AcceptedResponseTypes)
+	}
+}
+
+func TestReadResponsesRoundTrip(t *testing.T) {
+	resp := ReadResponse{Results: []QueryResult{
+		{Timeseries: []TimeSeries{{Labels: []Label{{Name: "__name__", Value: "up"}}, Samples: []Sample{{Value: 1, Timestamp: 1000}}}}},
+		{},
+	}}
+	var gotResp ReadResponse
+	if err := gotResp.Unmarshal(resp.Marshal()); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(gotResp, resp) {
+		t.Errorf("Got %+v, want %+v", gotResp, resp)
+	}
+
+	chunked := ChunkedReadResponse{
+		ChunkedSeries: []ChunkedSeries{{
+			Labels: []Label{{Name: "__name__", Value: "up"}},
+			Chunks: []Chunk{{MinTimeMs: 1000, MaxTimeMs: 3000, Type: ChunkEncodingXOR, Data: []byte{0x00, 0x01, 0x02}}},
+		}},
+		QueryIndex: 2,
+	}
+	var gotChunked ChunkedReadResponse
+	if err := gotChunked.Unmarshal(chunked.Marshal()); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !reflect.DeepEqual(gotChunked, chunked) {
+		t.Errorf("Got %+v, want %+v", gotChunked, chunked)
+	}
+}
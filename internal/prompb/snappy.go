@@ -0,0 +1,26 @@
+package prompb
+
+import (
+	"fmt"
+
+	"github.com/golang/snappy"
+)
+
+// DecodeSnappy decompresses a block in the snappy block format, the framing
+// Prometheus remote storage uses without the stream format. Blocks that would
+// decompress to more than maxLen bytes are rejected before any allocation.
+func DecodeSnappy(src []byte, maxLen int) ([]byte, error) {
+	n, err := snappy.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxLen {
+		return nil, fmt.Errorf("snappy: decoded length %d exceeds the limit of %d bytes", n, maxLen)
+	}
+	return snappy.Decode(nil, src)
+}
+
+// EncodeSnappy compresses src in the snappy block format
+func EncodeSnappy(src []byte) []byte {
+	return snappy.Encode(nil, src)
+}
@@ -0,0 +1,90 @@
+package prompb
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDecodeSnappy(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"empty", []byte{0x00}, ""},
+		{"literal", []byte("\x06\x14abcdef"), "abcdef"},
+		{"one byte copy", []byte("\x09\x08abc\x09\x03"), "abcabcabc"},
+		{"two byte copy", []byte("\x05\x00a\x0e\x01\x00"), "aaaaa"},
+		{"four byte copy", []byte("\x05\x04ab\x0b\x02\x00\x00\x00"), "ababa"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeSnappy(tt.input, 1024)
+			if err != nil {
+				t.Fatalf("DecodeSnappy failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeSnappyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		err   string
+	}{
+		{"no length", nil, "corrupt"},
+		{"truncated literal", []byte("\x06\x14abc"), "corrupt"},
+		{"short output", []byte("\x07\x14abcdef"), "corrupt"},
+		{"long output", []byte("\x05\x14abcdef"), "corrupt"},
+		{"offset before start", []byte("\x09\x08abc\x09\x04"), "corrupt"},
+		{"zero offset", []byte("\x09\x08abc\x09\x00"), "corrupt"},
+		{"truncated copy", []byte("\x09\x08abc\x0a\x01"), "corrupt"},
+		{"too large", []byte("\x81\x08"), "exceeds the limit of 1024 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeSnappy(tt.input, 1024)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestEncodeSnappyRoundTrip(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	inputs := map[string][]byte{
+		"empty":      {},
+		"short":      []byte("abc"),
+		"repeated":   bytes.Repeat([]byte("a"), 1000),
+		"labels":     bytes.Repeat([]byte("__name__http_requests_totalinstancelocalhost:9090jobprometheus"), 500),
+		"random":     random,
+		"long match": append(append([]byte{}, random[:70000]...), random[:70000]...),
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			encoded := EncodeSnappy(input)
+			decoded, err := DecodeSnappy(encoded, len(input))
+			if err != nil {
+				t.Fatalf("DecodeSnappy failed: %v", err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Errorf("Round trip changed the input of %d bytes", len(input))
+			}
+			if name == "labels" && len(encoded) > len(input)/10 {
+				t.Errorf("Expected repetitive input to compress, got %d bytes from %d", len(encoded), len(input))
+			}
+		})
+	}
+}
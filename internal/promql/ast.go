@@ -0,0 +1,422 @@
+package promql
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValueType is the type an expression evaluates to
+type ValueType string
+
+const (
+	// ValueTypeScalar is a single number
+	ValueTypeScalar ValueType = "scalar"
+	// ValueTypeVector is a set of samples sharing one timestamp
+	ValueTypeVector ValueType = "vector"
+	// ValueTypeMatrix is a set of series with a range of samples each
+	ValueTypeMatrix ValueType = "matrix"
+	// ValueTypeString is a string literal
+	ValueTypeString ValueType = "string"
+)
+
+// Expr is a node of a parsed PromQL expression
+type Expr interface {
+	// Type returns the type the expression evaluates to
+	Type() ValueType
+	// String returns the expression rendered back into PromQL
+	String() string
+}
+
+// MatchType is the kind of comparison a label matcher performs
+type MatchType int
+
+const (
+	// MatchEqual is =
+	MatchEqual MatchType = iota
+	// MatchNotEqual is !=
+	MatchNotEqual
+	// MatchRegexp is =~
+	MatchRegexp
+	// MatchNotRegexp is !~
+	MatchNotRegexp
+)
+
+// String returns the operator of the match type
+func (m MatchType) String() string {
+	switch m {
+	case MatchEqual:
+		return "="
+	case MatchNotEqual:
+		return "!="
+	case MatchRegexp:
+		return "=~"
+	default:
+		return "!~"
+	}
+}
+
+// Matcher compares a label value against a string or anchored regex
+type Matcher struct {
+	Type  MatchType
+	Name  string
+	Value string
+	re    *regexp.Regexp
+}
+
+// NewMatcher creates a label matcher, compiling the regex for regex match types
+func NewMatcher(t MatchType, name, value string) (*Matcher, error) {
+	m := &Matcher{Type: t, Name: name, Value: value}
+	if t == MatchRegexp || t == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, err
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches reports whether a label value satisfies the matcher.
+// A missing label is matched as the empty string.
+func (m *Matcher) Matches(value string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+// String returns the matcher rendered back into PromQL
+func (m *Matcher) String() string {
+	return m.Name + m.Type.String() + strconv.Quote(m.Value)
+}
+
+// NumberLiteral is a scalar literal
+type NumberLiteral struct {
+	Val float64
+}
+
+// Type returns ValueTypeScalar
+func (*NumberLiteral) Type() ValueType { return ValueTypeScalar }
+
+// String returns the formatted number
+func (n *NumberLiteral) String() string {
+	return strconv.FormatFloat(n.Val, 'g', -1, 64)
+}
+
+// StringLiteral is a string literal
+type StringLiteral struct {
+	Val string
+}
+
+// Type returns ValueTypeString
+func (*StringLiteral) Type() ValueType { return ValueTypeString }
+
+// String returns the quoted string
+func (s *StringLiteral) String() string {
+	return strconv.Quote(s.Val)
+}
+
+// VectorSelector selects the latest sample of every matching series
+type VectorSelector struct {
+	Name     string
+	Matchers []*Matcher
+	Offset   time.Duration
+}
+
+// Type returns ValueTypeVector
+func (*VectorSelector) Type() ValueType { return ValueTypeVector }
+
+// String returns the selector rendered back into PromQL
+func (v *VectorSelector) String() string {
+	var matchers []string
+	for _, m := range v.Matchers {
+		if m.Name == MetricNameLabel && m.Type == MatchEqual && v.Name != "" {
+			continue
+		}
+		matchers = append(matchers, m.String())
+	}
+
+	s := v.Name
+	if len(matchers) > 0 || s == "" {
+		s += "{" + strings.Join(matchers, ",") + "}"
+	}
+	if v.Offset != 0 {
+		s += " offset " + formatDuration(v.Offset)
+	}
+	return s
+}
+
+// MatrixSelector selects a range of samples of every matching series
+type MatrixSelector struct {
+	VectorSelector *VectorSelector
+	Range          time.Duration
+}
+
+// Type returns ValueTypeMatrix
+func (*MatrixSelector) Type() ValueType { return ValueTypeMatrix }
+
+// String returns the selector rendered back into PromQL
+func (m *MatrixSelector) String() string {
+	vs := *m.VectorSelector
+	vs.Offset = 0
+	s := vs.String() + "[" + formatDuration(m.Range) + "]"
+	if m.VectorSelector.Offset != 0 {
+		s += " offset " + formatDuration(m.VectorSelector.Offset)
+	}
+	return s
+}
+
+// Call is a function call
+type Call struct {
+	Func *Function
+	Args []Expr
+}
+
+// Type returns the return type of the function
+func (c *Call) Type() ValueType { return c.Func.ReturnType }
+
+// String returns the call rendered back into PromQL
+func (c *Call) String() string {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = arg.String()
+	}
+	return c.Func.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// AggregateExpr aggregates a vector, optionally grouped by labels
+type AggregateExpr struct {
+	Op       string
+	Expr     Expr
+	Param    Expr
+	Grouping []string
+	Without  bool
+}
+
+// Type returns ValueTypeVector
+func (*AggregateExpr) Type() ValueType { return ValueTypeVector }
+
+// String returns the aggregation rendered back into PromQL
+func (a *AggregateExpr) String() string {
+	s := a.Op
+	if a.Without {
+		s += " without (" + strings.Join(a.Grouping, ", ") + ") "
+	} else if len(a.Grouping) > 0 {
+		s += " by (" + strings.Join(a.Grouping, ", ") + ") "
+	}
+	if a.Param != nil {
+		return s + "(" + a.Param.String() + ", " + a.Expr.String() + ")"
+	}
+	return s + "(" + a.Expr.String() + ")"
+}
+
+// VectorMatchCardinality describes how samples of two vectors are paired
+type VectorMatchCardinality int
+
+const (
+	// CardOneToOne pairs each sample with at most one sample on the other side
+	CardOneToOne VectorMatchCardinality = iota
+	// CardManyToOne allows several left samples per right sample (group_left)
+	CardManyToOne
+	// CardOneToMany allows several right samples per left sample (group_right)
+	CardOneToMany
+	// CardManyToMany is used by the set operators
+	CardManyToMany
+)
+
+// VectorMatching describes the label matching of a binary operation between vectors
+type VectorMatching struct {
+	Card           VectorMatchCardinality
+	MatchingLabels []string
+	On             bool
+	Include        []string
+}
+
+// BinaryExpr is a binary operation
+type BinaryExpr struct {
+	Op             Token
+	LHS            Expr
+	RHS            Expr
+	VectorMatching *VectorMatching
+	ReturnBool     bool
+}
+
+// Type returns ValueTypeScalar if both sides are scalars, otherwise ValueTypeVector
+func (b *BinaryExpr) Type() ValueType {
+	if b.LHS.Type() == ValueTypeScalar && b.RHS.Type() == ValueTypeScalar {
+		return ValueTypeScalar
+	}
+	return ValueTypeVector
+}
+
+// String returns the operation rendered back into PromQL
+func (b *BinaryExpr) String() string {
+	op := b.Op.String()
+	if b.ReturnBool {
+		op += " bool"
+	}
+	if vm := b.VectorMatching; vm != nil && (len(vm.MatchingLabels) > 0 || vm.On || vm.Card == CardManyToOne || vm.Card == CardOneToMany) {
+		if vm.On {
+			op += " on (" + strings.Join(vm.MatchingLabels, ", ") + ")"
+		} else if len(vm.MatchingLabels) > 0 {
+			op += " ignoring (" + strings.Join(vm.MatchingLabels, ", ") + ")"
+		}
+		switch vm.Card {
+		case CardManyToOne:
+			op += " group_left (" + strings.Join(vm.Include, ", ") + ")"
+		case CardOneToMany:
+			op += " group_right (" + strings.Join(vm.Include, ", ") + ")"
+		}
+	}
+	return b.LHS.String() + " " + op + " " + b.RHS.String()
+}
+
+// ParenExpr is a parenthesized expression
+type ParenExpr struct {
+	Expr Expr
+}
+
+// Type returns the type of the inner expression
+func (p *ParenExpr) Type() ValueType { return p.Expr.Type() }
+
+// String returns the parenthesized expression
+func (p *ParenExpr) String() string {
+	return "(" + p.Expr.String() + ")"
+}
+
+// UnaryExpr is a negated or explicitly positive expression
+type UnaryExpr struct {
+	Op   Token
+	Expr Expr
+}
+
+// Type returns the type of the operand
+func (u *UnaryExpr) Type() ValueType { return u.Expr.Type() }
+
+// String returns the expression rendered back into PromQL
+func (u *UnaryExpr) String() string {
+	return u.Op.String() + u.Expr.String()
+}
+
+// walkSelectors calls fn for every vector selector in expr together with the
+// range of the enclosing matrix selector, if any
+func walkSelectors(expr Expr, fn func(vs *VectorSelector, rng time.Duration)) {
+	switch e := expr.(type) {
+	case *VectorSelector:
+		fn(e, 0)
+	case *MatrixSelector:
+		fn(e.VectorSelector, e.Range)
+	case *Call:
+		for _, arg := range e.Args {
+			walkSelectors(arg, fn)
+		}
+	case *AggregateExpr:
+		walkSelectors(e.Expr, fn)
+		if e.Param != nil {
+			walkSelectors(e.Param, fn)
+		}
+	case *BinaryExpr:
+		walkSelectors(e.LHS, fn)
+		walkSelectors(e.RHS, fn)
+	case *ParenExpr:
+		walkSelectors(e.Expr, fn)
+	case *UnaryExpr:
+		walkSelectors(e.Expr, fn)
+	}
+}
+
+// durationUnits lists the PromQL duration units from largest to smallest
+var durationUnits = []struct {
+	unit string
+	d    time.Duration
+}{
+	{"y", 365 * 24 * time.Hour},
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+}
+
+// ParseDuration parses a PromQL duration such as 30s, 5m, 1h30m or 2w
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	var total time.Duration
+	rest := s
+	lastUnit := -1
+	for rest != "" {
+		i := 0
+		for i < len(rest) && isDigit(rune(rest[i])) {
+			i++
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		n, err := strconv.ParseInt(rest[:i], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		rest = rest[i:]
+
+		unitIdx := -1
+		for idx, u := range durationUnits {
+			// Match "ms" before "m"
+			if strings.HasPrefix(rest, u.unit) && (unitIdx == -1 || len(u.unit) > len(durationUnits[unitIdx].unit)) {
+				unitIdx = idx
+			}
+		}
+		if unitIdx == -1 || unitIdx <= lastUnit {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		lastUnit = unitIdx
+		rest = rest[len(durationUnits[unitIdx].unit):]
+		total += time.Duration(n) * durationUnits[unitIdx].d
+	}
+
+	return total, nil
+}
+
+// formatDuration formats a duration in PromQL notation
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+
+	var buf strings.Builder
+	if d < 0 {
+		buf.WriteByte('-')
+		d = -d
+	}
+	for _, u := range durationUnits {
+		if n := d / u.d; n > 0 {
+			buf.WriteString(strconv.FormatInt(int64(n), 10))
+			buf.WriteString(u.unit)
+			d -= n * u.d
+		}
+	}
+	return buf.String()
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
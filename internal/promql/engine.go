@@ -0,0 +1,884 @@
+package promql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/storage"
+	"timeseriesdb/internal/types"
+)
+
+const (
+	// DefaultLookbackDelta is how far back an instant vector selector looks for the latest sample
+	DefaultLookbackDelta = 5 * time.Minute
+
+	// MaxRangeSteps is the maximum number of steps between the start and end
+	// of a range query
+	MaxRangeSteps = 11000
+)
+
+// MetricName returns the Prometheus metric name of a stored series. The
+// default "value" field maps to the bare measurement name; any other field
+// is appended to it as measurement_field.
+func MetricName(key storage.SeriesKey) string {
+	if key.Field == "" || key.Field == "value" {
+		return key.Measurement
+	}
+	return key.Measurement + "_" + key.Field
+}
+
+// SeriesLabels returns the Prometheus labels of a stored series: its tags plus the metric name
+func SeriesLabels(key storage.SeriesKey) Labels {
+	labels := make(Labels, len(key.Tags)+1)
+	for k, v := range key.Tags {
+		labels[k] = v
+	}
+	labels[MetricNameLabel] = MetricName(key)
+	return labels
+}
+
+// MatchesAll reports whether a label set satisfies every matcher
+func MatchesAll(matchers []*Matcher, labels Labels) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Engine evaluates PromQL expressions against one database
+type Engine struct {
+	storage       *storage.Database
+	lookbackDelta time.Duration
+}
+
+// NewEngine creates a new PromQL engine over a database
+func NewEngine(storage *storage.Database) *Engine {
+	return &Engine{
+		storage:       storage,
+		lookbackDelta: DefaultLookbackDelta,
+	}
+}
+
+// Instant evaluates an expression at a single point in time. Reads stop with
+// a timeout or cancellation error once ctx is done.
+func (e *Engine) Instant(ctx context.Context, query string, ts time.Time) (Value, error) {
+	expr, err := ParseExpr(query)
+	if err != nil {
+		return nil, err
+	}
+
+	ev, err := e.newEvaluator(ctx, expr, ts.UnixNano(), ts.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	ev.ts = ts.UnixNano()
+
+	val, err := ev.eval(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := val.(type) {
+	case Vector:
+		if !isTopK(expr) {
+			sortVector(v)
+		}
+	case Matrix:
+		sortMatrix(v)
+	}
+	return val, nil
+}
+
+// Range evaluates an expression at every step between start and end
+// inclusive. Evaluation stops with a timeout or cancellation error once ctx
+// is done.
+func (e *Engine) Range(ctx context.Context, query string, start, end time.Time, step time.Duration) (Matrix, error) {
+	if step <= 0 {
+		return nil, errors.NewValidationError("zero or negative query resolution step widths are not accepted")
+	}
+	if end.Before(start) {
+		return nil, errors.NewValidationError("end timestamp must not be before start time")
+	}
+	if end.Sub(start)/step > MaxRangeSteps {
+		return nil, errors.NewValidationError(fmt.Sprintf("exceeded maximum resolution of %d points per timeseries", MaxRangeSteps))
+	}
+
+	expr, err := ParseExpr(query)
+	if err != nil {
+		return nil, err
+	}
+	if t := expr.Type(); t != ValueTypeScalar && t != ValueTypeVector {
+		return nil, errors.NewValidationError(fmt.Sprintf("invalid expression type %q for range query, must be scalar or instant vector", t))
+	}
+
+	ev, err := e.newEvaluator(ctx, expr, start.UnixNano(), end.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+
+	series := make(map[string]*Series)
+	for ts := start.UnixNano(); ts <= end.UnixNano(); ts += int64(step) {
+		if err := storage.CheckContext(ctx); err != nil {
+			return nil, err
+		}
+
+		ev.ts = ts
+		val, err := ev.eval(expr)
+		if err != nil {
+			return nil, err
+		}
+
+		var samples Vector
+		switch v := val.(type) {
+		case Scalar:
+			samples = Vector{{Metric: Labels{}, T: ts, V: v.V}}
+		case Vector:
+			samples = v
+		}
+
+		for _, s := range samples {
+			key := s.Metric.String()
+			ss, ok := series[key]
+			if !ok {
+				ss = &Series{Metric: s.Metric}
+				series[key] = ss
+			}
+			ss.Points = append(ss.Points, Point{T: ts, V: s.V})
+		}
+	}
+
+	result := make(Matrix, 0, len(series))
+	for _, ss := range series {
+		result = append(result, *ss)
+	}
+	sortMatrix(result)
+	return result, nil
+}
+
+// isTopK reports whether the expression is a topk or bottomk aggregation,
+// whose result order is significant
+func isTopK(expr Expr) bool {
+	agg, ok := unwrapParens(expr).(*AggregateExpr)
+	return ok && (agg.Op == "topk" || agg.Op == "bottomk")
+}
+
+// loadedSeries is the data of one stored series read for a selector
+type loadedSeries struct {
+	metric Labels
+	points []Point
+}
+
+// evaluator evaluates an expression at a single timestamp over preloaded data
+type evaluator struct {
+	ts       int64
+	lookback int64
+	data     map[*VectorSelector][]*loadedSeries
+}
+
+// newEvaluator reads the data of every selector in expr needed to evaluate it
+// between start and end
+func (e *Engine) newEvaluator(ctx context.Context, expr Expr, start, end int64) (*evaluator, error) {
+	ev := &evaluator{
+		lookback: int64(e.lookbackDelta),
+		data:     make(map[*VectorSelector][]*loadedSeries),
+	}
+
+	var err error
+	walkSelectors(expr, func(vs *VectorSelector, rng time.Duration) {
+		if err != nil {
+			return
+		}
+		keys, ferr := e.FindSeries(vs.Matchers)
+		if ferr != nil {
+			err = ferr
+			return
+		}
+
+		window := rng
+		if window == 0 {
+			window = e.lookbackDelta
+		}
+		from := time.Unix(0, start-int64(vs.Offset)-int64(window))
+		to := time.Unix(0, end-int64(vs.Offset))
+
+		for _, key := range keys {
+			points, rerr := e.loadPoints(ctx, key, from, to)
+			if rerr != nil {
+				err = rerr
+				return
+			}
+			ev.data[vs] = append(ev.data[vs], &loadedSeries{metric: SeriesLabels(key), points: points})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ev, nil
+}
+
+// FindSeries returns the stored series matching all the matchers, sorted by
+// labels. The metric name and the other equality matchers are resolved
+// through the tag index, and the remaining matchers are applied to the
+// series it returns.
+func (e *Engine) FindSeries(matchers []*Matcher) ([]storage.SeriesKey, error) {
+	measurements := []string{""}
+	var tagMatchers []*storage.TagMatcher
+	for _, m := range matchers {
+		if m.Type != MatchEqual {
+			continue
+		}
+		if m.Name == MetricNameLabel {
+			measurements = metricMeasurements(m.Value)
+			continue
+		}
+		tm, err := storage.NewTagMatcher(storage.MatchEqual, m.Name, m.Value)
+		if err != nil {
+			return nil, err
+		}
+		tagMatchers = append(tagMatchers, tm)
+	}
+
+	var result []storage.SeriesKey
+	for _, measurement := range measurements {
+		keys, err := e.storage.FindSeries(measurement, tagMatchers...)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if MatchesAll(matchers, SeriesLabels(key)) {
+				result = append(result, key)
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return SeriesLabels(result[i]).String() < SeriesLabels(result[j]).String()
+	})
+	return result, nil
+}
+
+// metricMeasurements returns the measurements that may hold the series of a
+// metric name: the name itself, and every part of it before an underscore
+// for the series of a field other than value
+func metricMeasurements(name string) []string {
+	if name == "" {
+		return []string{""}
+	}
+	measurements := []string{name}
+	for i := 1; i < len(name); i++ {
+		if name[i] == '_' {
+			measurements = append(measurements, name[:i])
+		}
+	}
+	return measurements
+}
+
+// loadPoints reads the samples of a stored series between from and to
+// inclusive
+func (e *Engine) loadPoints(ctx context.Context, key storage.SeriesKey, from, to time.Time) ([]Point, error) {
+	points, err := e.storage.ReadSeries(ctx, key, from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Point, 0, len(points))
+	for _, p := range points {
+		// PromQL only has float samples, so boolean and string fields are skipped
+		v, ok := types.NumericValue(p.Fields[key.Field])
+		if !ok {
+			continue
+		}
+		pt := Point{T: p.Timestamp.UnixNano(), V: v}
+		// Points are sorted by time; keep the last value written for a timestamp
+		if n := len(result); n > 0 && result[n-1].T == pt.T {
+			result[n-1] = pt
+			continue
+		}
+		result = append(result, pt)
+	}
+	return result, nil
+}
+
+// eval evaluates an expression at the evaluator's current timestamp
+func (ev *evaluator) eval(expr Expr) (Value, error) {
+	switch e := expr.(type) {
+	case *NumberLiteral:
+		return Scalar{T: ev.ts, V: e.Val}, nil
+	case *StringLiteral:
+		return String{T: ev.ts, V: e.Val}, nil
+	case *ParenExpr:
+		return ev.eval(e.Expr)
+	case *VectorSelector:
+		return ev.evalVectorSelector(e), nil
+	case *MatrixSelector:
+		return ev.evalMatrixSelector(e), nil
+	case *UnaryExpr:
+		val, err := ev.eval(e.Expr)
+		if err != nil || e.Op != SUB {
+			return val, err
+		}
+		switch v := val.(type) {
+		case Scalar:
+			return Scalar{T: v.T, V: -v.V}, nil
+		case Vector:
+			return mapVector(v, func(f float64) float64 { return -f }), nil
+		}
+		return val, nil
+	case *Call:
+		args := make([]Value, len(e.Args))
+		for i, arg := range e.Args {
+			val, err := ev.eval(arg)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = val
+		}
+		return e.Func.call(ev, args, e.Args), nil
+	case *AggregateExpr:
+		return ev.evalAggregate(e)
+	case *BinaryExpr:
+		return ev.evalBinary(e)
+	}
+	return nil, fmt.Errorf("unhandled expression of type %T", expr)
+}
+
+// evalVectorSelector returns the latest sample of every series within the lookback window
+func (ev *evaluator) evalVectorSelector(vs *VectorSelector) Vector {
+	ref := ev.ts - int64(vs.Offset)
+	out := Vector{}
+	for _, ls := range ev.data[vs] {
+		// Index of the first point after the reference time
+		i := sort.Search(len(ls.points), func(i int) bool { return ls.points[i].T > ref })
+		if i == 0 {
+			continue
+		}
+		p := ls.points[i-1]
+		if p.T <= ref-ev.lookback {
+			continue
+		}
+		out = append(out, Sample{Metric: ls.metric, T: ev.ts, V: p.V})
+	}
+	return out
+}
+
+// evalMatrixSelector returns the points of every series within the range
+func (ev *evaluator) evalMatrixSelector(ms *MatrixSelector) Matrix {
+	end := ev.ts - int64(ms.VectorSelector.Offset)
+	start := end - int64(ms.Range)
+
+	out := Matrix{}
+	for _, ls := range ev.data[ms.VectorSelector] {
+		lo := sort.Search(len(ls.points), func(i int) bool { return ls.points[i].T > start })
+		hi := sort.Search(len(ls.points), func(i int) bool { return ls.points[i].T > end })
+		if lo >= hi {
+			continue
+		}
+		out = append(out, Series{Metric: ls.metric, Points: ls.points[lo:hi]})
+	}
+	return out
+}
+
+// aggregateGroup accumulates the samples of one output group
+type aggregateGroup struct {
+	labels  Labels
+	values  []float64
+	samples Vector
+}
+
+// evalAggregate evaluates an aggregation operator
+func (ev *evaluator) evalAggregate(agg *AggregateExpr) (Value, error) {
+	val, err := ev.eval(agg.Expr)
+	if err != nil {
+		return nil, err
+	}
+
+	var param float64
+	if agg.Param != nil {
+		p, err := ev.eval(agg.Param)
+		if err != nil {
+			return nil, err
+		}
+		param = p.(Scalar).V
+	}
+
+	groups := make(map[string]*aggregateGroup)
+	var order []string
+	for _, s := range val.(Vector) {
+		var key string
+		var labels Labels
+		if agg.Without {
+			names := append([]string{MetricNameLabel}, agg.Grouping...)
+			key = s.Metric.signature(names, false)
+			labels = s.Metric.Copy()
+			for _, n := range names {
+				delete(labels, n)
+			}
+		} else {
+			key = s.Metric.signature(agg.Grouping, true)
+			labels = Labels{}
+			for _, n := range agg.Grouping {
+				if v, ok := s.Metric[n]; ok {
+					labels[n] = v
+				}
+			}
+		}
+
+		g, ok := groups[key]
+		if !ok {
+			g = &aggregateGroup{labels: labels}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.values = append(g.values, s.V)
+		g.samples = append(g.samples, s)
+	}
+
+	out := Vector{}
+	for _, key := range order {
+		g := groups[key]
+		switch agg.Op {
+		case "topk", "bottomk":
+			k := int(param)
+			if k < 1 {
+				continue
+			}
+			samples := append(Vector(nil), g.samples...)
+			sort.SliceStable(samples, func(i, j int) bool {
+				if agg.Op == "topk" {
+					return samples[i].V > samples[j].V || (math.IsNaN(samples[j].V) && !math.IsNaN(samples[i].V))
+				}
+				return samples[i].V < samples[j].V || (math.IsNaN(samples[j].V) && !math.IsNaN(samples[i].V))
+			})
+			if len(samples) > k {
+				samples = samples[:k]
+			}
+			out = append(out, samples...)
+		default:
+			out = append(out, Sample{Metric: g.labels, T: ev.ts, V: aggregateValues(agg.Op, g.values, param)})
+		}
+	}
+	return out, nil
+}
+
+// aggregateValues reduces the values of a group with an aggregation operator
+func aggregateValues(op string, values []float64, param float64) float64 {
+	switch op {
+	case "sum":
+		return sumValues(values)
+	case "avg":
+		return sumValues(values) / float64(len(values))
+	case "count":
+		return float64(len(values))
+	case "group":
+		return 1
+	case "min":
+		min := values[0]
+		for _, v := range values[1:] {
+			if v < min || math.IsNaN(min) {
+				min = v
+			}
+		}
+		return min
+	case "max":
+		max := values[0]
+		for _, v := range values[1:] {
+			if v > max || math.IsNaN(max) {
+				max = v
+			}
+		}
+		return max
+	case "stddev", "stdvar":
+		mean := sumValues(values) / float64(len(values))
+		variance := 0.0
+		for _, v := range values {
+			variance += (v - mean) * (v - mean)
+		}
+		variance /= float64(len(values))
+		if op == "stddev" {
+			return math.Sqrt(variance)
+		}
+		return variance
+	case "quantile":
+		return quantile(param, values)
+	}
+	return math.NaN()
+}
+
+func sumValues(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+// quantile returns the phi-quantile of the values using linear interpolation
+// between the closest ranks
+func quantile(phi float64, values []float64) float64 {
+	switch {
+	case math.IsNaN(phi):
+		return math.NaN()
+	case phi < 0:
+		return math.Inf(-1)
+	case phi > 1:
+		return math.Inf(1)
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := phi * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	weight := rank - float64(lower)
+	return sorted[lower]*(1-weight) + sorted[upper]*weight
+}
+
+// evalBinary evaluates a binary operation
+func (ev *evaluator) evalBinary(b *BinaryExpr) (Value, error) {
+	lhs, err := ev.eval(b.LHS)
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := ev.eval(b.RHS)
+	if err != nil {
+		return nil, err
+	}
+
+	switch l := lhs.(type) {
+	case Scalar:
+		switch r := rhs.(type) {
+		case Scalar:
+			v, keep := binaryOp(b.Op, l.V, r.V)
+			if b.Op.IsComparison() {
+				v = boolValue(keep)
+			}
+			return Scalar{T: ev.ts, V: v}, nil
+		case Vector:
+			return vectorScalarOp(b, r, l.V, true), nil
+		}
+	case Vector:
+		switch r := rhs.(type) {
+		case Scalar:
+			return vectorScalarOp(b, l, r.V, false), nil
+		case Vector:
+			if b.Op.IsSetOperator() {
+				return vectorSetOp(b, l, r), nil
+			}
+			return vectorBinaryOp(b, l, r)
+		}
+	}
+	return nil, fmt.Errorf("unsupported operand types %s and %s", lhs.Type(), rhs.Type())
+}
+
+// binaryOp applies an arithmetic or comparison operator. For comparisons the
+// returned value is lhs and keep reports whether the comparison holds.
+func binaryOp(op Token, lhs, rhs float64) (float64, bool) {
+	switch op {
+	case ADD:
+		return lhs + rhs, true
+	case SUB:
+		return lhs - rhs, true
+	case MUL:
+		return lhs * rhs, true
+	case DIV:
+		return lhs / rhs, true
+	case MOD:
+		return math.Mod(lhs, rhs), true
+	case POW:
+		return math.Pow(lhs, rhs), true
+	case EQLC:
+		return lhs, lhs == rhs
+	case NEQ:
+		return lhs, lhs != rhs
+	case GTR:
+		return lhs, lhs > rhs
+	case LSS:
+		return lhs, lhs < rhs
+	case GTE:
+		return lhs, lhs >= rhs
+	case LTE:
+		return lhs, lhs <= rhs
+	}
+	return math.NaN(), false
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// resultLabels returns the labels of a binary operation result. Arithmetic
+// and bool comparisons drop the metric name since the value no longer has its meaning.
+func resultLabels(b *BinaryExpr, labels Labels) Labels {
+	if !b.Op.IsComparison() || b.ReturnBool {
+		return labels.WithoutName()
+	}
+	return labels
+}
+
+// vectorScalarOp applies an operator between every sample of a vector and a scalar
+func vectorScalarOp(b *BinaryExpr, v Vector, scalar float64, scalarLeft bool) Vector {
+	out := Vector{}
+	for _, s := range v {
+		lhs, rhs := s.V, scalar
+		if scalarLeft {
+			lhs, rhs = rhs, lhs
+		}
+
+		value, keep := binaryOp(b.Op, lhs, rhs)
+		if b.Op.IsComparison() {
+			// Filtering comparisons keep the value of the vector side
+			value = s.V
+			if b.ReturnBool {
+				value = boolValue(keep)
+				keep = true
+			}
+		}
+		if !keep {
+			continue
+		}
+		out = append(out, Sample{Metric: resultLabels(b, s.Metric), T: s.T, V: value})
+	}
+	return out
+}
+
+// matchSignature returns the label signature used to pair samples of two vectors
+func matchSignature(vm *VectorMatching, labels Labels) string {
+	if vm.On {
+		return labels.signature(vm.MatchingLabels, true)
+	}
+	return labels.signature(append([]string{MetricNameLabel}, vm.MatchingLabels...), false)
+}
+
+// vectorSetOp implements and, or and unless
+func vectorSetOp(b *BinaryExpr, lhs, rhs Vector) Vector {
+	vm := b.VectorMatching
+
+	rightSigs := make(map[string]bool, len(rhs))
+	for _, s := range rhs {
+		rightSigs[matchSignature(vm, s.Metric)] = true
+	}
+
+	out := Vector{}
+	switch b.Op {
+	case LAND:
+		for _, s := range lhs {
+			if rightSigs[matchSignature(vm, s.Metric)] {
+				out = append(out, s)
+			}
+		}
+	case LUNLESS:
+		for _, s := range lhs {
+			if !rightSigs[matchSignature(vm, s.Metric)] {
+				out = append(out, s)
+			}
+		}
+	case LOR:
+		leftSigs := make(map[string]bool, len(lhs))
+		for _, s := range lhs {
+			leftSigs[matchSignature(vm, s.Metric)] = true
+			out = append(out, s)
+		}
+		for _, s := range rhs {
+			if !leftSigs[matchSignature(vm, s.Metric)] {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// vectorBinaryOp applies an arithmetic or comparison operator between matching samples of two vectors
+func vectorBinaryOp(b *BinaryExpr, lhs, rhs Vector) (Vector, error) {
+	vm := b.VectorMatching
+
+	// group_right is evaluated as group_left with the operands swapped
+	many, one := lhs, rhs
+	if vm.Card == CardOneToMany {
+		many, one = rhs, lhs
+	}
+
+	oneSide := make(map[string]Sample, len(one))
+	for _, s := range one {
+		sig := matchSignature(vm, s.Metric)
+		if _, dup := oneSide[sig]; dup {
+			return nil, errors.NewValidationError(fmt.Sprintf(
+				"found duplicate series for the match group %s on the %s side of the operation: many-to-many matching not allowed: matching labels must be unique on one side",
+				s.Metric, sideName(vm.Card == CardOneToMany)))
+		}
+		oneSide[sig] = s
+	}
+
+	matched := make(map[string]bool)
+	out := Vector{}
+	for _, ms := range many {
+		sig := matchSignature(vm, ms.Metric)
+		os, ok := oneSide[sig]
+		if !ok {
+			continue
+		}
+
+		lv, rv := ms.V, os.V
+		if vm.Card == CardOneToMany {
+			lv, rv = rv, lv
+		}
+		value, keep := binaryOp(b.Op, lv, rv)
+		if b.ReturnBool {
+			value = boolValue(keep)
+			keep = true
+		}
+		if !keep {
+			continue
+		}
+
+		labels := resultLabels(b, ms.Metric)
+		if vm.Card == CardOneToOne {
+			if vm.On {
+				kept := Labels{}
+				for _, n := range vm.MatchingLabels {
+					if v, ok := labels[n]; ok {
+						kept[n] = v
+					}
+				}
+				labels = kept
+			} else {
+				labels = labels.Copy()
+				for _, n := range vm.MatchingLabels {
+					delete(labels, n)
+				}
+			}
+		} else {
+			labels = labels.Copy()
+			for _, n := range vm.Include {
+				if v, ok := os.Metric[n]; ok && v != "" {
+					labels[n] = v
+				} else {
+					delete(labels, n)
+				}
+			}
+		}
+
+		// Every output sample must have a distinct label set
+		key := sig
+		if vm.Card != CardOneToOne {
+			key = labels.String()
+		}
+		if matched[key] {
+			if vm.Card == CardOneToOne {
+				return nil, errors.NewValidationError("multiple matches for labels: many-to-one matching must be explicit (group_left/group_right)")
+			}
+			return nil, errors.NewValidationError("multiple matches for labels: grouping labels must ensure unique matches")
+		}
+		matched[key] = true
+
+		out = append(out, Sample{Metric: labels, T: ms.T, V: value})
+	}
+	return out, nil
+}
+
+func sideName(left bool) string {
+	if left {
+		return "left hand-side"
+	}
+	return "right hand-side"
+}
+
+// Select returns the samples between start and end inclusive of every stored
+// series matching all the matchers, sorted by labels. Series without samples
+// in the range are left out. Reads stop with a timeout or cancellation error
+// once ctx is done.
+func (e *Engine) Select(ctx context.Context, matchers []*Matcher, start, end time.Time) (Matrix, error) {
+	keys, err := e.FindSeries(matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	result := Matrix{}
+	for _, key := range keys {
+		points, err := e.loadPoints(ctx, key, start, end)
+		if err != nil {
+			return nil, err
+		}
+		if len(points) > 0 {
+			result = append(result, Series{Metric: SeriesLabels(key), Points: points})
+		}
+	}
+
+	sortMatrix(result)
+	return result, nil
+}
+
+// Series returns the label sets of all stored series matching any of the selectors
+func (e *Engine) Series(selectors [][]*Matcher) ([]Labels, error) {
+	var keys []storage.SeriesKey
+	if len(selectors) == 0 {
+		all, err := e.storage.ListSeries("")
+		if err != nil {
+			return nil, err
+		}
+		keys = all
+	}
+	for _, matchers := range selectors {
+		found, err := e.FindSeries(matchers)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, found...)
+	}
+
+	seen := make(map[string]bool)
+	var result []Labels
+	for _, key := range keys {
+		labels := SeriesLabels(key)
+		if id := labels.String(); !seen[id] {
+			seen[id] = true
+			result = append(result, labels)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].String() < result[j].String()
+	})
+	return result, nil
+}
+
+// LabelNames returns the sorted label names of the series matching the selectors
+func (e *Engine) LabelNames(selectors [][]*Matcher) ([]string, error) {
+	series, err := e.Series(selectors)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string)
+	for _, labels := range series {
+		for name := range labels {
+			names[name] = ""
+		}
+	}
+	return sortedKeys(names), nil
+}
+
+// LabelValues returns the sorted values of a label across the series matching the selectors
+func (e *Engine) LabelValues(name string, selectors [][]*Matcher) ([]string, error) {
+	series, err := e.Series(selectors)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for _, labels := range series {
+		if v, ok := labels[name]; ok && v != "" {
+			values[v] = ""
+		}
+	}
+	return sortedKeys(values), nil
+}
@@ -0,0 +1,471 @@
+package promql
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+	"timeseriesdb/internal/types"
+)
+
+func init() {
+	logger.Init()
+}
+
+// baseTime is the timestamp of the first sample written by newTestEngine
+var baseTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestEngine creates an engine over a storage holding, for two hosts, a
+// requests counter growing by 60 per minute (host b at twice the rate) and a
+// cpu gauge, both sampled every 15 seconds for ten minutes
+func newTestEngine(t *testing.T) *Engine {
+	t.Helper()
+
+	s := storage.NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	t.Cleanup(func() { s.Close() })
+
+	hosts := []struct {
+		host   string
+		factor float64
+		cpu    float64
+	}{
+		{"a", 1, 10},
+		{"b", 2, 30},
+	}
+	for _, h := range hosts {
+		for i := 0; i <= 40; i++ {
+			ts := baseTime.Add(time.Duration(i) * 15 * time.Second)
+			points := []types.Point{
+				{
+					Measurement: "requests",
+					Tags:        map[string]string{"host": h.host, "job": "api"},
+					Fields:      map[string]interface{}{"value": float64(i) * 15 * h.factor},
+					Timestamp:   ts,
+				},
+				{
+					Measurement: "node",
+					Tags:        map[string]string{"host": h.host},
+					Fields:      map[string]interface{}{"cpu": h.cpu},
+					Timestamp:   ts,
+				},
+			}
+			for _, p := range points {
+				if err := s.WritePoint(context.Background(), p); err != nil {
+					t.Fatalf("Failed to write point: %v", err)
+				}
+			}
+		}
+	}
+
+	return NewEngine(s.Database)
+}
+
+// instantVector runs an instant query expected to return a vector
+func instantVector(t *testing.T, e *Engine, query string, ts time.Time) Vector {
+	t.Helper()
+
+	val, err := e.Instant(context.Background(), query, ts)
+	if err != nil {
+		t.Fatalf("Instant(%q) failed: %v", query, err)
+	}
+	v, ok := val.(Vector)
+	if !ok {
+		t.Fatalf("Instant(%q) returned %s, want vector", query, val.Type())
+	}
+	return v
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestEngineInstantSelector(t *testing.T) {
+	e := newTestEngine(t)
+	ts := baseTime.Add(10 * time.Minute)
+
+	v := instantVector(t, e, `requests{host="b"}`, ts)
+	if len(v) != 1 {
+		t.Fatalf("Expected 1 sample, got %d", len(v))
+	}
+	if v[0].V != 1200 {
+		t.Errorf("Expected value 1200, got %v", v[0].V)
+	}
+	if v[0].Metric[MetricNameLabel] != "requests" || v[0].Metric["job"] != "api" {
+		t.Errorf("Unexpected labels %v", v[0].Metric)
+	}
+
+	// Fields other than value are exposed as measurement_field
+	v = instantVector(t, e, "node_cpu", ts)
+	if len(v) != 2 || v[0].V != 10 || v[1].V != 30 {
+		t.Errorf("Expected node_cpu samples [10 30], got %v", v)
+	}
+
+	// Offset reads older data
+	v = instantVector(t, e, `requests{host="a"} offset 5m`, ts)
+	if len(v) != 1 || v[0].V != 300 {
+		t.Errorf("Expected offset value 300, got %v", v)
+	}
+
+	// Nothing is returned once the lookback window has passed
+	v = instantVector(t, e, "requests", ts.Add(DefaultLookbackDelta+time.Second))
+	if len(v) != 0 {
+		t.Errorf("Expected no samples outside the lookback window, got %v", v)
+	}
+}
+
+func TestEngineRateFunctions(t *testing.T) {
+	e := newTestEngine(t)
+	ts := baseTime.Add(10 * time.Minute)
+
+	tests := []struct {
+		query string
+		want  []float64
+	}{
+		{"rate(requests[5m])", []float64{1, 2}},
+		{"irate(requests[1m])", []float64{1, 2}},
+		{"increase(requests[5m])", []float64{300, 600}},
+		{"delta(node_cpu[5m])", []float64{0, 0}},
+		{"avg_over_time(node_cpu[5m])", []float64{10, 30}},
+		{"count_over_time(node_cpu[1m])", []float64{4, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			v := instantVector(t, e, tt.query, ts)
+			if len(v) != len(tt.want) {
+				t.Fatalf("Expected %d samples, got %d", len(tt.want), len(v))
+			}
+			for i, s := range v {
+				if !almostEqual(s.V, tt.want[i]) {
+					t.Errorf("Sample %d: expected %v, got %v", i, tt.want[i], s.V)
+				}
+				if _, ok := s.Metric[MetricNameLabel]; ok {
+					t.Errorf("Expected the metric name to be dropped, got %v", s.Metric)
+				}
+			}
+		})
+	}
+}
+
+func TestEngineCounterReset(t *testing.T) {
+	s := storage.NewStorage(config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024})
+	defer s.Close()
+
+	for i, v := range []float64{10, 20, 30, 5, 15} {
+		err := s.WritePoint(context.Background(), types.Point{
+			Measurement: "counter",
+			Fields:      map[string]interface{}{"value": v},
+			Timestamp:   baseTime.Add(time.Duration(i) * 10 * time.Second),
+		})
+		if err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+
+	e := NewEngine(s.Database)
+	v := instantVector(t, e, "increase(counter[40s])", baseTime.Add(40*time.Second))
+	if len(v) != 1 {
+		t.Fatalf("Expected 1 sample, got %d", len(v))
+	}
+	// The range (0s, 40s] holds 20, 30, 5, 15: 10 before the reset and 15
+	// after it. The 30s sampled interval is extrapolated to the 40s range.
+	if want := 25.0 * 40 / 30; !almostEqual(v[0].V, want) {
+		t.Errorf("Expected increase %v across the counter reset, got %v", want, v[0].V)
+	}
+}
+
+func TestEngineAggregation(t *testing.T) {
+	e := newTestEngine(t)
+	ts := baseTime.Add(10 * time.Minute)
+
+	v := instantVector(t, e, "sum by (job) (rate(requests[5m]))", ts)
+	if len(v) != 1 || !almostEqual(v[0].V, 3) || v[0].Metric["job"] != "api" || len(v[0].Metric) != 1 {
+		t.Errorf("Expected {job=api} 3, got %v", v)
+	}
+
+	v = instantVector(t, e, "avg(node_cpu)", ts)
+	if len(v) != 1 || v[0].V != 20 || len(v[0].Metric) != 0 {
+		t.Errorf("Expected {} 20, got %v", v)
+	}
+
+	v = instantVector(t, e, "max without (host) (node_cpu)", ts)
+	if len(v) != 1 || v[0].V != 30 {
+		t.Errorf("Expected 30, got %v", v)
+	}
+
+	v = instantVector(t, e, "count(requests)", ts)
+	if len(v) != 1 || v[0].V != 2 {
+		t.Errorf("Expected count 2, got %v", v)
+	}
+
+	v = instantVector(t, e, "topk(1, node_cpu)", ts)
+	if len(v) != 1 || v[0].Metric["host"] != "b" || v[0].Metric[MetricNameLabel] != "node_cpu" {
+		t.Errorf("Expected topk to return host b with its labels, got %v", v)
+	}
+
+	v = instantVector(t, e, "quantile(0.5, node_cpu)", ts)
+	if len(v) != 1 || v[0].V != 20 {
+		t.Errorf("Expected median 20, got %v", v)
+	}
+}
+
+func TestEngineBinaryOperators(t *testing.T) {
+	e := newTestEngine(t)
+	ts := baseTime.Add(10 * time.Minute)
+
+	val, err := e.Instant(context.Background(), "2 * 3 + 4 ^ 0.5", ts)
+	if err != nil {
+		t.Fatalf("Instant failed: %v", err)
+	}
+	if s, ok := val.(Scalar); !ok || s.V != 8 {
+		t.Errorf("Expected scalar 8, got %v", val)
+	}
+
+	v := instantVector(t, e, "node_cpu * 2", ts)
+	if len(v) != 2 || v[0].V != 20 || v[1].V != 60 {
+		t.Errorf("Expected [20 60], got %v", v)
+	}
+
+	v = instantVector(t, e, "node_cpu > 20", ts)
+	if len(v) != 1 || v[0].V != 30 || v[0].Metric[MetricNameLabel] != "node_cpu" {
+		t.Errorf("Expected filtered sample 30 keeping its name, got %v", v)
+	}
+
+	v = instantVector(t, e, "node_cpu > bool 20", ts)
+	if len(v) != 2 || v[0].V != 0 || v[1].V != 1 {
+		t.Errorf("Expected [0 1], got %v", v)
+	}
+
+	// One-to-one matching ignoring the job label
+	v = instantVector(t, e, "requests / ignoring (job) node_cpu", ts)
+	if len(v) != 2 || v[0].V != 60 || v[1].V != 40 {
+		t.Errorf("Expected [60 40], got %v", v)
+	}
+
+	// Many-to-one matching with group_left copies the requested label
+	v = instantVector(t, e, `node_cpu * on () group_left (job) max(requests) by (job)`, ts)
+	if len(v) != 2 || v[0].Metric["job"] != "api" || v[0].V != 12000 {
+		t.Errorf("Expected group_left result with job label, got %v", v)
+	}
+
+	v = instantVector(t, e, `requests and on (host) node_cpu > 20`, ts)
+	if len(v) != 1 || v[0].Metric["host"] != "b" {
+		t.Errorf("Expected only host b, got %v", v)
+	}
+
+	v = instantVector(t, e, `requests{host="a"} or requests`, ts)
+	if len(v) != 2 {
+		t.Errorf("Expected 2 samples from or, got %v", v)
+	}
+
+	v = instantVector(t, e, `requests unless on (host) node_cpu > 20`, ts)
+	if len(v) != 1 || v[0].Metric["host"] != "a" {
+		t.Errorf("Expected only host a, got %v", v)
+	}
+
+	v = instantVector(t, e, "-node_cpu", ts)
+	if len(v) != 2 || v[0].V != -10 {
+		t.Errorf("Expected negated values, got %v", v)
+	}
+}
+
+func TestEngineManyToManyError(t *testing.T) {
+	e := newTestEngine(t)
+
+	_, err := e.Instant(context.Background(), "requests + on (job) node_cpu", baseTime.Add(10*time.Minute))
+	if err == nil {
+		t.Fatal("Expected a matching error")
+	}
+	if !errors.IsType(err, errors.ErrorTypeValidation) {
+		t.Errorf("Expected a validation error, got %v", err)
+	}
+}
+
+func TestEngineRange(t *testing.T) {
+	e := newTestEngine(t)
+
+	m, err := e.Range(context.Background(), "rate(requests[1m])", baseTime.Add(5*time.Minute), baseTime.Add(10*time.Minute), time.Minute)
+	if err != nil {
+		t.Fatalf("Range failed: %v", err)
+	}
+
+	if len(m) != 2 {
+		t.Fatalf("Expected 2 series, got %d", len(m))
+	}
+	for i, want := range []float64{1, 2} {
+		if len(m[i].Points) != 6 {
+			t.Fatalf("Expected 6 points, got %d", len(m[i].Points))
+		}
+		for _, p := range m[i].Points {
+			if !almostEqual(p.V, want) {
+				t.Errorf("Series %d: expected rate %v, got %v", i, want, p.V)
+			}
+		}
+	}
+
+	m, err = e.Range(context.Background(), "time()", baseTime, baseTime.Add(2*time.Second), time.Second)
+	if err != nil {
+		t.Fatalf("Range failed: %v", err)
+	}
+	if len(m) != 1 || len(m[0].Points) != 3 || m[0].Points[2].V != float64(baseTime.Unix()+2) {
+		t.Errorf("Unexpected time() range result %v", m)
+	}
+
+	m, err = e.Range(context.Background(), "time()", baseTime, baseTime.Add(MaxRangeSteps*time.Second), time.Second)
+	if err != nil {
+		t.Fatalf("Range of %d steps failed: %v", MaxRangeSteps, err)
+	}
+	if len(m) != 1 || len(m[0].Points) != MaxRangeSteps+1 {
+		t.Errorf("Expected %d points for %d steps", MaxRangeSteps+1, MaxRangeSteps)
+	}
+}
+
+func TestEngineRangeErrors(t *testing.T) {
+	e := newTestEngine(t)
+
+	tests := []struct {
+		name       string
+		query      string
+		start, end time.Time
+		step       time.Duration
+	}{
+		{"zero step", "requests", baseTime, baseTime.Add(time.Hour), 0},
+		{"end before start", "requests", baseTime.Add(time.Hour), baseTime, time.Minute},
+		{"too many steps", "requests", baseTime, baseTime.Add(24 * time.Hour), time.Second},
+		{"one step too many", "requests", baseTime, baseTime.Add((MaxRangeSteps + 1) * time.Second), time.Second},
+		{"matrix expression", "requests[5m]", baseTime, baseTime.Add(time.Hour), time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := e.Range(context.Background(), tt.query, tt.start, tt.end, tt.step)
+			if !errors.IsType(err, errors.ErrorTypeValidation) {
+				t.Errorf("Expected a validation error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEngineMetadata(t *testing.T) {
+	e := newTestEngine(t)
+
+	matchers, err := ParseMetricSelector(`{host="a"}`)
+	if err != nil {
+		t.Fatalf("ParseMetricSelector failed: %v", err)
+	}
+
+	series, err := e.Series([][]*Matcher{matchers})
+	if err != nil {
+		t.Fatalf("Series failed: %v", err)
+	}
+	if len(series) != 2 {
+		t.Errorf("Expected 2 series for host a, got %v", series)
+	}
+
+	names, err := e.LabelNames(nil)
+	if err != nil {
+		t.Fatalf("LabelNames failed: %v", err)
+	}
+	if len(names) != 3 || names[0] != MetricNameLabel || names[1] != "host" || names[2] != "job" {
+		t.Errorf("Unexpected label names %v", names)
+	}
+
+	values, err := e.LabelValues(MetricNameLabel, nil)
+	if err != nil {
+		t.Fatalf("LabelValues failed: %v", err)
+	}
+	if len(values) != 2 || values[0] != "node_cpu" || values[1] != "requests" {
+		t.Errorf("Unexpected metric names %v", values)
+	}
+}
+
+func TestEngineFindSeries(t *testing.T) {
+	e := newTestEngine(t)
+
+	// Three series named http_requests or http_requests_total in two measurements
+	for _, p := range []types.Point{
+		{Measurement: "http_requests", Tags: map[string]string{"code": "200"}, Fields: map[string]interface{}{"value": 1.0}},
+		{Measurement: "http_requests", Tags: map[string]string{"code": "500"}, Fields: map[string]interface{}{"total": 2.0}},
+		{Measurement: "http", Tags: map[string]string{"code": "200"}, Fields: map[string]interface{}{"requests": 3.0}},
+	} {
+		p.Timestamp = baseTime
+		if err := e.storage.WritePoint(context.Background(), p); err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+
+	tests := []struct {
+		selector string
+		want     []string
+	}{
+		{`http_requests`, []string{`{__name__="http_requests", code="200"}`, `{__name__="http_requests", code="200"}`}},
+		{`http_requests_total`, []string{`{__name__="http_requests_total", code="500"}`}},
+		{`{__name__=~"http_.*", code="500"}`, []string{`{__name__="http_requests_total", code="500"}`}},
+		{`requests{host="b", job=~"a.*"}`, []string{`{__name__="requests", host="b", job="api"}`}},
+		{`{host="a", __name__!="requests"}`, []string{`{__name__="node_cpu", host="a"}`}},
+		{`missing_metric`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			matchers, err := ParseMetricSelector(tt.selector)
+			if err != nil {
+				t.Fatalf("ParseMetricSelector failed: %v", err)
+			}
+			keys, err := e.FindSeries(matchers)
+			if err != nil {
+				t.Fatalf("FindSeries failed: %v", err)
+			}
+			var got []string
+			for _, key := range keys {
+				got = append(got, SeriesLabels(key).String())
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got series %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngineSelect(t *testing.T) {
+	e := newTestEngine(t)
+
+	matchers, err := ParseMetricSelector(`{__name__=~"requests|node_cpu", host!="b"}`)
+	if err != nil {
+		t.Fatalf("ParseMetricSelector failed: %v", err)
+	}
+	m, err := e.Select(context.Background(), matchers, baseTime.Add(time.Minute), baseTime.Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+
+	if len(m) != 2 {
+		t.Fatalf("Expected 2 series, got %d", len(m))
+	}
+	if m[0].Metric[MetricNameLabel] != "node_cpu" || m[1].Metric[MetricNameLabel] != "requests" || m[1].Metric["host"] != "a" {
+		t.Errorf("Unexpected series %v and %v", m[0].Metric, m[1].Metric)
+	}
+	// Both bounds are inclusive
+	if n := len(m[1].Points); n != 5 || m[1].Points[0].T != baseTime.Add(time.Minute).UnixNano() || m[1].Points[0].V != 60 || m[1].Points[n-1].V != 120 {
+		t.Errorf("Unexpected points %v", m[1].Points)
+	}
+
+	// Series without samples in the range are left out
+	m, err = e.Select(context.Background(), matchers, baseTime.Add(time.Hour), baseTime.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if len(m) != 0 {
+		t.Errorf("Expected no series, got %v", m)
+	}
+}
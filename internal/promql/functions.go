@@ -0,0 +1,289 @@
+package promql
+
+import (
+	"math"
+	"time"
+)
+
+// Function describes a PromQL function
+type Function struct {
+	Name       string
+	ArgTypes   []ValueType
+	Optional   int
+	ReturnType ValueType
+	call       func(ev *evaluator, args []Value, exprs []Expr) Value
+}
+
+// functions lists the supported PromQL functions by name
+var functions = map[string]*Function{
+	"rate": {
+		Name: "rate", ArgTypes: []ValueType{ValueTypeMatrix}, ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, exprs []Expr) Value {
+			return ev.extrapolatedRate(args[0].(Matrix), exprs[0].(*MatrixSelector), true, true)
+		},
+	},
+	"increase": {
+		Name: "increase", ArgTypes: []ValueType{ValueTypeMatrix}, ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, exprs []Expr) Value {
+			return ev.extrapolatedRate(args[0].(Matrix), exprs[0].(*MatrixSelector), true, false)
+		},
+	},
+	"delta": {
+		Name: "delta", ArgTypes: []ValueType{ValueTypeMatrix}, ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, exprs []Expr) Value {
+			return ev.extrapolatedRate(args[0].(Matrix), exprs[0].(*MatrixSelector), false, false)
+		},
+	},
+	"irate": {
+		Name: "irate", ArgTypes: []ValueType{ValueTypeMatrix}, ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, exprs []Expr) Value {
+			return ev.instantValue(args[0].(Matrix), true)
+		},
+	},
+	"idelta": {
+		Name: "idelta", ArgTypes: []ValueType{ValueTypeMatrix}, ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, exprs []Expr) Value {
+			return ev.instantValue(args[0].(Matrix), false)
+		},
+	},
+	"avg_over_time": overTime("avg_over_time", func(points []Point) float64 {
+		return sumPoints(points) / float64(len(points))
+	}),
+	"sum_over_time": overTime("sum_over_time", sumPoints),
+	"count_over_time": overTime("count_over_time", func(points []Point) float64 {
+		return float64(len(points))
+	}),
+	"min_over_time": overTime("min_over_time", func(points []Point) float64 {
+		min := points[0].V
+		for _, p := range points[1:] {
+			if p.V < min || math.IsNaN(min) {
+				min = p.V
+			}
+		}
+		return min
+	}),
+	"max_over_time": overTime("max_over_time", func(points []Point) float64 {
+		max := points[0].V
+		for _, p := range points[1:] {
+			if p.V > max || math.IsNaN(max) {
+				max = p.V
+			}
+		}
+		return max
+	}),
+	"last_over_time": overTime("last_over_time", func(points []Point) float64 {
+		return points[len(points)-1].V
+	}),
+	"stddev_over_time": overTime("stddev_over_time", func(points []Point) float64 {
+		mean := sumPoints(points) / float64(len(points))
+		variance := 0.0
+		for _, p := range points {
+			variance += (p.V - mean) * (p.V - mean)
+		}
+		return math.Sqrt(variance / float64(len(points)))
+	}),
+	"abs":   mathFunc("abs", math.Abs),
+	"ceil":  mathFunc("ceil", math.Ceil),
+	"floor": mathFunc("floor", math.Floor),
+	"sqrt":  mathFunc("sqrt", math.Sqrt),
+	"exp":   mathFunc("exp", math.Exp),
+	"ln":    mathFunc("ln", math.Log),
+	"log2":  mathFunc("log2", math.Log2),
+	"log10": mathFunc("log10", math.Log10),
+	"round": {
+		Name: "round", ArgTypes: []ValueType{ValueTypeVector, ValueTypeScalar}, Optional: 1, ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, exprs []Expr) Value {
+			toNearest := 1.0
+			if len(args) > 1 {
+				toNearest = args[1].(Scalar).V
+			}
+			// Rounding to the inverse avoids floating point errors for fractions
+			inv := 1 / toNearest
+			return mapVector(args[0].(Vector), func(v float64) float64 {
+				return math.Floor(v*inv+0.5) / inv
+			})
+		},
+	},
+	"clamp_min": {
+		Name: "clamp_min", ArgTypes: []ValueType{ValueTypeVector, ValueTypeScalar}, ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, exprs []Expr) Value {
+			min := args[1].(Scalar).V
+			return mapVector(args[0].(Vector), func(v float64) float64 { return math.Max(v, min) })
+		},
+	},
+	"clamp_max": {
+		Name: "clamp_max", ArgTypes: []ValueType{ValueTypeVector, ValueTypeScalar}, ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, exprs []Expr) Value {
+			max := args[1].(Scalar).V
+			return mapVector(args[0].(Vector), func(v float64) float64 { return math.Min(v, max) })
+		},
+	},
+	"time": {
+		Name: "time", ReturnType: ValueTypeScalar,
+		call: func(ev *evaluator, args []Value, exprs []Expr) Value {
+			return Scalar{T: ev.ts, V: float64(ev.ts) / float64(time.Second)}
+		},
+	},
+	"timestamp": {
+		Name: "timestamp", ArgTypes: []ValueType{ValueTypeVector}, ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, exprs []Expr) Value {
+			in := args[0].(Vector)
+			out := make(Vector, 0, len(in))
+			for _, s := range in {
+				out = append(out, Sample{Metric: s.Metric.WithoutName(), T: ev.ts, V: float64(s.T) / float64(time.Second)})
+			}
+			return out
+		},
+	},
+	"vector": {
+		Name: "vector", ArgTypes: []ValueType{ValueTypeScalar}, ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, exprs []Expr) Value {
+			return Vector{{Metric: Labels{}, T: ev.ts, V: args[0].(Scalar).V}}
+		},
+	},
+	"scalar": {
+		Name: "scalar", ArgTypes: []ValueType{ValueTypeVector}, ReturnType: ValueTypeScalar,
+		call: func(ev *evaluator, args []Value, exprs []Expr) Value {
+			v := args[0].(Vector)
+			if len(v) != 1 {
+				return Scalar{T: ev.ts, V: math.NaN()}
+			}
+			return Scalar{T: ev.ts, V: v[0].V}
+		},
+	},
+}
+
+// overTime creates a function that reduces the points of each series in a range
+func overTime(name string, fn func(points []Point) float64) *Function {
+	return &Function{
+		Name: name, ArgTypes: []ValueType{ValueTypeMatrix}, ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, exprs []Expr) Value {
+			out := Vector{}
+			for _, series := range args[0].(Matrix) {
+				if len(series.Points) == 0 {
+					continue
+				}
+				out = append(out, Sample{Metric: series.Metric.WithoutName(), T: ev.ts, V: fn(series.Points)})
+			}
+			return out
+		},
+	}
+}
+
+// mathFunc creates a function that applies fn to every sample of a vector
+func mathFunc(name string, fn func(float64) float64) *Function {
+	return &Function{
+		Name: name, ArgTypes: []ValueType{ValueTypeVector}, ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, exprs []Expr) Value {
+			return mapVector(args[0].(Vector), fn)
+		},
+	}
+}
+
+// mapVector applies fn to every sample value and drops the metric name
+func mapVector(in Vector, fn func(float64) float64) Vector {
+	out := make(Vector, 0, len(in))
+	for _, s := range in {
+		out = append(out, Sample{Metric: s.Metric.WithoutName(), T: s.T, V: fn(s.V)})
+	}
+	return out
+}
+
+// sumPoints returns the sum of the point values
+func sumPoints(points []Point) float64 {
+	sum := 0.0
+	for _, p := range points {
+		sum += p.V
+	}
+	return sum
+}
+
+// extrapolatedRate implements rate, increase and delta. The difference between
+// the first and last sample is extrapolated towards the boundaries of the range
+// when the samples are close enough to them. Counter resets are compensated
+// for when isCounter is set.
+func (ev *evaluator) extrapolatedRate(m Matrix, ms *MatrixSelector, isCounter, isRate bool) Vector {
+	rangeEnd := ev.ts - int64(ms.VectorSelector.Offset)
+	rangeStart := rangeEnd - int64(ms.Range)
+
+	out := Vector{}
+	for _, series := range m {
+		points := series.Points
+		if len(points) < 2 {
+			continue
+		}
+
+		first, last := points[0], points[len(points)-1]
+		result := last.V - first.V
+		if isCounter {
+			prev := first.V
+			for _, p := range points[1:] {
+				if p.V < prev {
+					result += prev
+				}
+				prev = p.V
+			}
+		}
+
+		durationToStart := float64(first.T-rangeStart) / float64(time.Second)
+		durationToEnd := float64(rangeEnd-last.T) / float64(time.Second)
+		sampledInterval := float64(last.T-first.T) / float64(time.Second)
+		averageInterval := sampledInterval / float64(len(points)-1)
+
+		// A counter cannot be extrapolated below zero
+		if isCounter && result > 0 && first.V >= 0 {
+			if durationToZero := sampledInterval * (first.V / result); durationToZero < durationToStart {
+				durationToStart = durationToZero
+			}
+		}
+
+		threshold := averageInterval * 1.1
+		extrapolateTo := sampledInterval
+		if durationToStart < threshold {
+			extrapolateTo += durationToStart
+		} else {
+			extrapolateTo += averageInterval / 2
+		}
+		if durationToEnd < threshold {
+			extrapolateTo += durationToEnd
+		} else {
+			extrapolateTo += averageInterval / 2
+		}
+
+		result *= extrapolateTo / sampledInterval
+		if isRate {
+			result /= ms.Range.Seconds()
+		}
+
+		out = append(out, Sample{Metric: series.Metric.WithoutName(), T: ev.ts, V: result})
+	}
+	return out
+}
+
+// instantValue implements irate and idelta from the last two samples of each series
+func (ev *evaluator) instantValue(m Matrix, isRate bool) Vector {
+	out := Vector{}
+	for _, series := range m {
+		points := series.Points
+		if len(points) < 2 {
+			continue
+		}
+
+		prev, last := points[len(points)-2], points[len(points)-1]
+		result := last.V - prev.V
+		if isRate {
+			if last.V < prev.V {
+				// Counter reset
+				result = last.V
+			}
+			interval := float64(last.T-prev.T) / float64(time.Second)
+			if interval == 0 {
+				continue
+			}
+			result /= interval
+		}
+
+		out = append(out, Sample{Metric: series.Metric.WithoutName(), T: ev.ts, V: result})
+	}
+	return out
+}
@@ -0,0 +1,438 @@
+// Package promql implements a PromQL evaluation engine over the
+// measurement/tag/field series model of the storage engine
+package promql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token represents a lexical token of PromQL
+type Token int
+
+const (
+	// ILLEGAL represents an unrecognised token
+	ILLEGAL Token = iota
+	// EOF marks the end of the input
+	EOF
+
+	// IDENT represents a metric name, label name, function or keyword
+	IDENT
+	// NUMBER represents a numeric literal
+	NUMBER
+	// STRING represents a quoted string literal
+	STRING
+	// DURATION represents a duration literal such as 5m
+	DURATION
+
+	// LPAREN is (
+	LPAREN
+	// RPAREN is )
+	RPAREN
+	// LBRACE is {
+	LBRACE
+	// RBRACE is }
+	RBRACE
+	// LBRACKET is [
+	LBRACKET
+	// RBRACKET is ]
+	RBRACKET
+	// COMMA is ,
+	COMMA
+	// ASSIGN is = inside a label matcher
+	ASSIGN
+
+	operatorBeg
+	// ADD is +
+	ADD
+	// SUB is -
+	SUB
+	// MUL is *
+	MUL
+	// DIV is /
+	DIV
+	// MOD is %
+	MOD
+	// POW is ^
+	POW
+	// EQLC is ==
+	EQLC
+	// NEQ is !=
+	NEQ
+	// LSS is <
+	LSS
+	// LTE is <=
+	LTE
+	// GTR is >
+	GTR
+	// GTE is >=
+	GTE
+	// EQLREGEX is =~
+	EQLREGEX
+	// NEQREGEX is !~
+	NEQREGEX
+	// LAND is the and set operator
+	LAND
+	// LOR is the or set operator
+	LOR
+	// LUNLESS is the unless set operator
+	LUNLESS
+	operatorEnd
+)
+
+var tokens = [...]string{
+	ILLEGAL:  "ILLEGAL",
+	EOF:      "EOF",
+	IDENT:    "IDENT",
+	NUMBER:   "NUMBER",
+	STRING:   "STRING",
+	DURATION: "DURATION",
+	LPAREN:   "(",
+	RPAREN:   ")",
+	LBRACE:   "{",
+	RBRACE:   "}",
+	LBRACKET: "[",
+	RBRACKET: "]",
+	COMMA:    ",",
+	ASSIGN:   "=",
+	ADD:      "+",
+	SUB:      "-",
+	MUL:      "*",
+	DIV:      "/",
+	MOD:      "%",
+	POW:      "^",
+	EQLC:     "==",
+	NEQ:      "!=",
+	LSS:      "<",
+	LTE:      "<=",
+	GTR:      ">",
+	GTE:      ">=",
+	EQLREGEX: "=~",
+	NEQREGEX: "!~",
+	LAND:     "and",
+	LOR:      "or",
+	LUNLESS:  "unless",
+}
+
+// String returns the string representation of the token
+func (t Token) String() string {
+	if t >= 0 && int(t) < len(tokens) && tokens[t] != "" {
+		return tokens[t]
+	}
+	return "token(" + strconv.Itoa(int(t)) + ")"
+}
+
+// IsOperator reports whether the token is a binary operator
+func (t Token) IsOperator() bool {
+	return t > operatorBeg && t < operatorEnd
+}
+
+// IsComparison reports whether the token is a comparison operator
+func (t Token) IsComparison() bool {
+	switch t {
+	case EQLC, NEQ, LSS, LTE, GTR, GTE:
+		return true
+	}
+	return false
+}
+
+// IsSetOperator reports whether the token is and, or or unless
+func (t Token) IsSetOperator() bool {
+	return t == LAND || t == LOR || t == LUNLESS
+}
+
+// Precedence returns the binding strength of a binary operator
+func (t Token) Precedence() int {
+	switch t {
+	case LOR:
+		return 1
+	case LAND, LUNLESS:
+		return 2
+	case EQLC, NEQ, LSS, LTE, GTR, GTE:
+		return 3
+	case ADD, SUB:
+		return 4
+	case MUL, DIV, MOD:
+		return 5
+	case POW:
+		return 6
+	}
+	return 0
+}
+
+// item is a scanned token with its position and literal value
+type item struct {
+	tok Token
+	pos int
+	lit string
+}
+
+// String returns a description of the item for error messages
+func (i item) String() string {
+	switch i.tok {
+	case EOF:
+		return "end of input"
+	case IDENT, NUMBER, DURATION:
+		return fmt.Sprintf("%q", i.lit)
+	case STRING:
+		return strconv.Quote(i.lit)
+	}
+	return fmt.Sprintf("%q", i.tok.String())
+}
+
+// lex splits the input into tokens
+func lex(input string) ([]item, error) {
+	var items []item
+	pos := 0
+
+	for pos < len(input) {
+		ch, width := utf8.DecodeRuneInString(input[pos:])
+		start := pos
+
+		switch {
+		case unicode.IsSpace(ch):
+			pos += width
+			continue
+		case ch == '#':
+			// Comments run to the end of the line
+			for pos < len(input) && input[pos] != '\n' {
+				pos++
+			}
+			continue
+		case isIdentStart(ch):
+			for pos < len(input) && isIdentChar(rune(input[pos])) {
+				pos++
+			}
+			lit := input[start:pos]
+			items = append(items, item{tok: lookupKeyword(lit), pos: start, lit: lit})
+			continue
+		case isDigit(ch) || (ch == '.' && pos+1 < len(input) && isDigit(rune(input[pos+1]))):
+			tok, end := scanNumber(input, pos)
+			items = append(items, item{tok: tok, pos: start, lit: input[start:end]})
+			pos = end
+			continue
+		case ch == '"' || ch == '\'' || ch == '`':
+			lit, end, err := scanString(input, pos, ch)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item{tok: STRING, pos: start, lit: lit})
+			pos = end
+			continue
+		}
+
+		tok := ILLEGAL
+		pos += width
+		next := byte(0)
+		if pos < len(input) {
+			next = input[pos]
+		}
+
+		switch ch {
+		case '(':
+			tok = LPAREN
+		case ')':
+			tok = RPAREN
+		case '{':
+			tok = LBRACE
+		case '}':
+			tok = RBRACE
+		case '[':
+			tok = LBRACKET
+		case ']':
+			tok = RBRACKET
+		case ',':
+			tok = COMMA
+		case '+':
+			tok = ADD
+		case '-':
+			tok = SUB
+		case '*':
+			tok = MUL
+		case '/':
+			tok = DIV
+		case '%':
+			tok = MOD
+		case '^':
+			tok = POW
+		case '=':
+			switch next {
+			case '=':
+				tok = EQLC
+				pos++
+			case '~':
+				tok = EQLREGEX
+				pos++
+			default:
+				tok = ASSIGN
+			}
+		case '!':
+			switch next {
+			case '=':
+				tok = NEQ
+				pos++
+			case '~':
+				tok = NEQREGEX
+				pos++
+			}
+		case '<':
+			tok = LSS
+			if next == '=' {
+				tok = LTE
+				pos++
+			}
+		case '>':
+			tok = GTR
+			if next == '=' {
+				tok = GTE
+				pos++
+			}
+		}
+
+		if tok == ILLEGAL {
+			return nil, &ParseError{Message: fmt.Sprintf("unexpected character %q", ch), Pos: start}
+		}
+		items = append(items, item{tok: tok, pos: start, lit: input[start:pos]})
+	}
+
+	return append(items, item{tok: EOF, pos: len(input)}), nil
+}
+
+// lookupKeyword returns the operator token for set operator keywords, or IDENT
+func lookupKeyword(lit string) Token {
+	switch strings.ToLower(lit) {
+	case "and":
+		return LAND
+	case "or":
+		return LOR
+	case "unless":
+		return LUNLESS
+	}
+	return IDENT
+}
+
+// scanNumber scans a number or, when it is directly followed by a unit, a duration
+func scanNumber(input string, pos int) (Token, int) {
+	start := pos
+	if strings.HasPrefix(input[pos:], "0x") || strings.HasPrefix(input[pos:], "0X") {
+		pos += 2
+		for pos < len(input) && isHexDigit(rune(input[pos])) {
+			pos++
+		}
+		return NUMBER, pos
+	}
+
+	for pos < len(input) && isDigit(rune(input[pos])) {
+		pos++
+	}
+
+	// A digit sequence followed by a duration unit is a duration such as 5m or 1h30m
+	if pos < len(input) && strings.ContainsRune("smhdwy", rune(input[pos])) {
+		for pos < len(input) && (isDigit(rune(input[pos])) || strings.ContainsRune("smhdwy", rune(input[pos]))) {
+			pos++
+		}
+		return DURATION, pos
+	}
+
+	if pos < len(input) && input[pos] == '.' {
+		pos++
+		for pos < len(input) && isDigit(rune(input[pos])) {
+			pos++
+		}
+	}
+	if pos < len(input) && (input[pos] == 'e' || input[pos] == 'E') {
+		end := pos + 1
+		if end < len(input) && (input[end] == '+' || input[end] == '-') {
+			end++
+		}
+		if end < len(input) && isDigit(rune(input[end])) {
+			pos = end
+			for pos < len(input) && isDigit(rune(input[pos])) {
+				pos++
+			}
+		}
+	}
+
+	if pos == start {
+		pos++
+	}
+	return NUMBER, pos
+}
+
+// scanString scans a string quoted with ", ' or `. Backquoted strings are raw.
+func scanString(input string, pos int, quote rune) (string, int, error) {
+	start := pos
+	pos++ // opening quote
+
+	for pos < len(input) {
+		switch rune(input[pos]) {
+		case '\\':
+			if quote != '`' {
+				pos++
+			}
+		case '\n':
+			if quote != '`' {
+				return "", 0, &ParseError{Message: "unterminated quoted string", Pos: start}
+			}
+		case quote:
+			raw := input[start : pos+1]
+			if quote == '`' {
+				return raw[1 : len(raw)-1], pos + 1, nil
+			}
+			if quote == '\'' {
+				raw = requoteSingle(raw[1 : len(raw)-1])
+			}
+			s, err := strconv.Unquote(raw)
+			if err != nil {
+				return "", 0, &ParseError{Message: "invalid escape sequence in string", Pos: start}
+			}
+			return s, pos + 1, nil
+		}
+		pos++
+	}
+
+	return "", 0, &ParseError{Message: "unterminated quoted string", Pos: start}
+}
+
+// requoteSingle converts the body of a single-quoted string into a
+// double-quoted string that strconv.Unquote accepts
+func requoteSingle(body string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			if i+1 < len(body) && body[i+1] == '\'' {
+				buf.WriteByte('\'')
+			} else if i+1 < len(body) {
+				buf.WriteString(body[i : i+2])
+			}
+			i++
+		case '"':
+			buf.WriteString(`\"`)
+		default:
+			buf.WriteByte(body[i])
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+func isIdentStart(ch rune) bool {
+	return ch == '_' || ch == ':' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isIdentChar(ch rune) bool {
+	return isIdentStart(ch) || isDigit(ch)
+}
+
+func isDigit(ch rune) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
@@ -0,0 +1,630 @@
+package promql
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"timeseriesdb/internal/errors"
+)
+
+// aggregators lists the supported aggregation operators and whether they take a parameter
+var aggregators = map[string]bool{
+	"sum":      false,
+	"avg":      false,
+	"min":      false,
+	"max":      false,
+	"count":    false,
+	"group":    false,
+	"stddev":   false,
+	"stdvar":   false,
+	"topk":     true,
+	"bottomk":  true,
+	"quantile": true,
+}
+
+// ParseError describes a syntax or type error in a PromQL expression
+type ParseError struct {
+	Message string
+	Pos     int
+}
+
+// Error returns the message with the 1-based character position
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse error at char %d: %s", e.Pos+1, e.Message)
+}
+
+// parser is a recursive descent parser over the lexed tokens
+type parser struct {
+	items []item
+	pos   int
+}
+
+// ParseExpr parses a PromQL expression
+func ParseExpr(input string) (Expr, error) {
+	items, err := lex(input)
+	if err != nil {
+		return nil, asValidationError(err)
+	}
+
+	p := &parser{items: items}
+	expr, err := p.parseExpr(0)
+	if err != nil {
+		return nil, asValidationError(err)
+	}
+	if next := p.peek(); next.tok != EOF {
+		return nil, asValidationError(p.unexpected(next, "end of input"))
+	}
+	return expr, nil
+}
+
+// asValidationError wraps a parse error as a validation AppError
+func asValidationError(err error) error {
+	return errors.WrapWithType(err, errors.ErrorTypeValidation, "invalid expression")
+}
+
+func (p *parser) peek() item {
+	return p.items[p.pos]
+}
+
+func (p *parser) next() item {
+	it := p.items[p.pos]
+	if it.tok != EOF {
+		p.pos++
+	}
+	return it
+}
+
+// expect consumes the next token, failing if it is not tok
+func (p *parser) expect(tok Token, context string) (item, error) {
+	it := p.next()
+	if it.tok != tok {
+		return it, p.unexpected(it, fmt.Sprintf("%q in %s", tok.String(), context))
+	}
+	return it, nil
+}
+
+func (p *parser) unexpected(it item, expected string) error {
+	return &ParseError{Message: fmt.Sprintf("unexpected %s, expected %s", it, expected), Pos: it.pos}
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) error {
+	return &ParseError{Message: fmt.Sprintf(format, args...), Pos: pos}
+}
+
+// parseExpr parses a binary expression whose operators bind at least as
+// strongly as minPrec
+func (p *parser) parseExpr(minPrec int) (Expr, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op := p.peek()
+		prec := op.tok.Precedence()
+		if !op.tok.IsOperator() || prec < minPrec {
+			return lhs, nil
+		}
+		p.next()
+
+		bin := &BinaryExpr{Op: op.tok, LHS: lhs}
+		if err := p.parseBinaryModifiers(bin); err != nil {
+			return nil, err
+		}
+
+		// ^ is right-associative; all other operators are left-associative
+		nextMin := prec + 1
+		if op.tok == POW {
+			nextMin = prec
+		}
+		bin.RHS, err = p.parseExpr(nextMin)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkBinaryExpr(bin, op.pos); err != nil {
+			return nil, err
+		}
+		lhs = bin
+	}
+}
+
+// parseBinaryModifiers parses bool, on/ignoring and group_left/group_right
+func (p *parser) parseBinaryModifiers(bin *BinaryExpr) error {
+	if it := p.peek(); it.tok == IDENT && strings.EqualFold(it.lit, "bool") {
+		if !bin.Op.IsComparison() {
+			return p.errorf(it.pos, "bool modifier can only be used on comparison operators")
+		}
+		p.next()
+		bin.ReturnBool = true
+	}
+
+	bin.VectorMatching = &VectorMatching{Card: CardOneToOne}
+	if bin.Op.IsSetOperator() {
+		bin.VectorMatching.Card = CardManyToMany
+	}
+
+	it := p.peek()
+	if it.tok != IDENT {
+		return nil
+	}
+	switch strings.ToLower(it.lit) {
+	case "on", "ignoring":
+		p.next()
+		bin.VectorMatching.On = strings.EqualFold(it.lit, "on")
+		labels, err := p.parseLabelList()
+		if err != nil {
+			return err
+		}
+		bin.VectorMatching.MatchingLabels = labels
+	default:
+		return nil
+	}
+
+	it = p.peek()
+	if it.tok != IDENT {
+		return nil
+	}
+	switch strings.ToLower(it.lit) {
+	case "group_left", "group_right":
+		if bin.Op.IsSetOperator() {
+			return p.errorf(it.pos, "no grouping allowed for %q operation", bin.Op.String())
+		}
+		p.next()
+		bin.VectorMatching.Card = CardManyToOne
+		if strings.EqualFold(it.lit, "group_right") {
+			bin.VectorMatching.Card = CardOneToMany
+		}
+		if p.peek().tok == LPAREN {
+			labels, err := p.parseLabelList()
+			if err != nil {
+				return err
+			}
+			bin.VectorMatching.Include = labels
+		}
+	}
+	return nil
+}
+
+// checkBinaryExpr validates the operand types of a binary expression
+func checkBinaryExpr(bin *BinaryExpr, pos int) error {
+	lt, rt := bin.LHS.Type(), bin.RHS.Type()
+	for _, t := range []ValueType{lt, rt} {
+		if t != ValueTypeScalar && t != ValueTypeVector {
+			return &ParseError{Message: fmt.Sprintf("binary expression must contain only scalar and instant vector types, got %s", t), Pos: pos}
+		}
+	}
+
+	if bin.Op.IsComparison() && lt == ValueTypeScalar && rt == ValueTypeScalar && !bin.ReturnBool {
+		return &ParseError{Message: "comparisons between scalars must use bool modifier", Pos: pos}
+	}
+	if bin.Op.IsSetOperator() && (lt != ValueTypeVector || rt != ValueTypeVector) {
+		return &ParseError{Message: fmt.Sprintf("set operator %q not allowed in binary scalar expression", bin.Op.String()), Pos: pos}
+	}
+
+	vm := bin.VectorMatching
+	if lt != ValueTypeVector || rt != ValueTypeVector {
+		if vm != nil && (len(vm.MatchingLabels) > 0 || vm.On || vm.Card == CardManyToOne || vm.Card == CardOneToMany) {
+			return &ParseError{Message: "vector matching only allowed between instant vectors", Pos: pos}
+		}
+		bin.VectorMatching = nil
+	}
+	return nil
+}
+
+// parseUnary parses an optionally signed primary expression
+func (p *parser) parseUnary() (Expr, error) {
+	it := p.peek()
+	if it.tok != ADD && it.tok != SUB {
+		return p.parsePrimary()
+	}
+	p.next()
+
+	// Unary operators bind more weakly than ^ so that -2^2 is -4
+	expr, err := p.parseExpr(POW.Precedence())
+	if err != nil {
+		return nil, err
+	}
+	if t := expr.Type(); t != ValueTypeScalar && t != ValueTypeVector {
+		return nil, p.errorf(it.pos, "unary expression only allowed on expressions of type scalar or instant vector, got %s", t)
+	}
+
+	if n, ok := expr.(*NumberLiteral); ok {
+		if it.tok == SUB {
+			n.Val = -n.Val
+		}
+		return n, nil
+	}
+	if it.tok == ADD {
+		return expr, nil
+	}
+	return &UnaryExpr{Op: it.tok, Expr: expr}, nil
+}
+
+// parsePrimary parses a literal, selector, call, aggregation or parenthesized expression
+// followed by an optional range and offset
+func (p *parser) parsePrimary() (Expr, error) {
+	it := p.next()
+
+	var expr Expr
+	var err error
+	switch it.tok {
+	case NUMBER:
+		expr, err = parseNumber(it)
+	case STRING:
+		expr = &StringLiteral{Val: it.lit}
+	case LPAREN:
+		inner, perr := p.parseExpr(0)
+		if perr != nil {
+			return nil, perr
+		}
+		if _, err := p.expect(RPAREN, "parenthesized expression"); err != nil {
+			return nil, err
+		}
+		expr = &ParenExpr{Expr: inner}
+	case LBRACE:
+		p.pos--
+		expr, err = p.parseVectorSelector("")
+	case IDENT:
+		expr, err = p.parseIdentExpr(it)
+	default:
+		return nil, p.unexpected(it, "expression")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return p.parsePostfix(expr)
+}
+
+// parseIdentExpr parses an expression that starts with an identifier
+func (p *parser) parseIdentExpr(it item) (Expr, error) {
+	name := it.lit
+	next := p.peek()
+
+	if _, ok := aggregators[strings.ToLower(name)]; ok {
+		if next.tok == LPAREN || (next.tok == IDENT && (strings.EqualFold(next.lit, "by") || strings.EqualFold(next.lit, "without"))) {
+			return p.parseAggregateExpr(it)
+		}
+	}
+
+	if next.tok == LPAREN {
+		return p.parseCall(it)
+	}
+
+	switch strings.ToLower(name) {
+	case "inf":
+		return &NumberLiteral{Val: math.Inf(1)}, nil
+	case "nan":
+		return &NumberLiteral{Val: math.NaN()}, nil
+	}
+
+	return p.parseVectorSelector(name)
+}
+
+// parseNumber converts a number token to a literal
+func parseNumber(it item) (Expr, error) {
+	var f float64
+	var err error
+	if strings.HasPrefix(strings.ToLower(it.lit), "0x") {
+		var n uint64
+		n, err = strconv.ParseUint(it.lit[2:], 16, 64)
+		f = float64(n)
+	} else {
+		f, err = strconv.ParseFloat(it.lit, 64)
+	}
+	if err != nil {
+		return nil, &ParseError{Message: fmt.Sprintf("invalid number %q", it.lit), Pos: it.pos}
+	}
+	return &NumberLiteral{Val: f}, nil
+}
+
+// parsePostfix parses an optional [range] and offset modifier
+func (p *parser) parsePostfix(expr Expr) (Expr, error) {
+	if p.peek().tok == LBRACKET {
+		open := p.next()
+		vs, ok := expr.(*VectorSelector)
+		if !ok || vs.Offset != 0 {
+			return nil, p.errorf(open.pos, "ranges only allowed for vector selectors")
+		}
+		d, err := p.parseDuration("range")
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, p.errorf(open.pos, "range must be positive")
+		}
+		if _, err := p.expect(RBRACKET, "range selector"); err != nil {
+			return nil, err
+		}
+		expr = &MatrixSelector{VectorSelector: vs, Range: d}
+	}
+
+	if it := p.peek(); it.tok == IDENT && strings.EqualFold(it.lit, "offset") {
+		p.next()
+		negative := false
+		if p.peek().tok == SUB {
+			p.next()
+			negative = true
+		}
+		d, err := p.parseDuration("offset")
+		if err != nil {
+			return nil, err
+		}
+		if negative {
+			d = -d
+		}
+
+		switch e := expr.(type) {
+		case *VectorSelector:
+			e.Offset = d
+		case *MatrixSelector:
+			e.VectorSelector.Offset = d
+		default:
+			return nil, p.errorf(it.pos, "offset modifier must be preceded by an instant or range selector")
+		}
+	}
+
+	return expr, nil
+}
+
+// parseDuration parses a duration token
+func (p *parser) parseDuration(context string) (time.Duration, error) {
+	it := p.next()
+	if it.tok != DURATION {
+		return 0, p.unexpected(it, "duration in "+context)
+	}
+	d, err := ParseDuration(it.lit)
+	if err != nil {
+		return 0, p.errorf(it.pos, "%v", err)
+	}
+	return d, nil
+}
+
+// parseVectorSelector parses name{matchers}
+func (p *parser) parseVectorSelector(name string) (Expr, error) {
+	vs := &VectorSelector{Name: name}
+	pos := p.peek().pos
+
+	if p.peek().tok == LBRACE {
+		p.next()
+		for p.peek().tok != RBRACE {
+			m, err := p.parseMatcher()
+			if err != nil {
+				return nil, err
+			}
+			vs.Matchers = append(vs.Matchers, m)
+
+			if p.peek().tok != COMMA {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expect(RBRACE, "label matching"); err != nil {
+			return nil, err
+		}
+	}
+
+	if name != "" {
+		for _, m := range vs.Matchers {
+			if m.Name == MetricNameLabel {
+				return nil, p.errorf(pos, "metric name must not be set twice: %q", name)
+			}
+		}
+		m, _ := NewMatcher(MatchEqual, MetricNameLabel, name)
+		vs.Matchers = append(vs.Matchers, m)
+	}
+
+	// A selector must not match every series
+	nonEmpty := false
+	for _, m := range vs.Matchers {
+		if !m.Matches("") {
+			nonEmpty = true
+			break
+		}
+	}
+	if !nonEmpty {
+		return nil, p.errorf(pos, "vector selector must contain at least one non-empty matcher")
+	}
+
+	return vs, nil
+}
+
+// parseMatcher parses a single label matcher
+func (p *parser) parseMatcher() (*Matcher, error) {
+	name, err := p.expect(IDENT, "label matching")
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.next()
+	var mt MatchType
+	switch op.tok {
+	case ASSIGN:
+		mt = MatchEqual
+	case NEQ:
+		mt = MatchNotEqual
+	case EQLREGEX:
+		mt = MatchRegexp
+	case NEQREGEX:
+		mt = MatchNotRegexp
+	default:
+		return nil, p.unexpected(op, "label matching operator")
+	}
+
+	value, err := p.expect(STRING, "label matching")
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := NewMatcher(mt, name.lit, value.lit)
+	if err != nil {
+		return nil, p.errorf(value.pos, "invalid regular expression %q: %v", value.lit, err)
+	}
+	return m, nil
+}
+
+// parseLabelList parses a parenthesized, comma separated list of label names
+func (p *parser) parseLabelList() ([]string, error) {
+	if _, err := p.expect(LPAREN, "grouping"); err != nil {
+		return nil, err
+	}
+
+	labels := []string{}
+	for p.peek().tok != RPAREN {
+		it, err := p.expect(IDENT, "grouping")
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, it.lit)
+
+		if p.peek().tok != COMMA {
+			break
+		}
+		p.next()
+	}
+
+	if _, err := p.expect(RPAREN, "grouping"); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// parseCall parses a function call
+func (p *parser) parseCall(name item) (Expr, error) {
+	fn, ok := functions[strings.ToLower(name.lit)]
+	if !ok {
+		return nil, p.errorf(name.pos, "unknown function with name %q", name.lit)
+	}
+
+	p.next() // (
+	var args []Expr
+	for p.peek().tok != RPAREN {
+		arg, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		if p.peek().tok != COMMA {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(RPAREN, "function call"); err != nil {
+		return nil, err
+	}
+
+	if len(args) > len(fn.ArgTypes) || len(args) < len(fn.ArgTypes)-fn.Optional {
+		return nil, p.errorf(name.pos, "wrong number of arguments for function %q: expected %d, got %d", fn.Name, len(fn.ArgTypes), len(args))
+	}
+	for i, arg := range args {
+		if arg.Type() != fn.ArgTypes[i] {
+			return nil, p.errorf(name.pos, "expected type %s in call to function %q, got %s", fn.ArgTypes[i], fn.Name, arg.Type())
+		}
+		if fn.ArgTypes[i] == ValueTypeMatrix {
+			if _, ok := unwrapParens(arg).(*MatrixSelector); !ok {
+				return nil, p.errorf(name.pos, "expected a range selector in call to function %q", fn.Name)
+			}
+			args[i] = unwrapParens(arg)
+		}
+	}
+
+	return &Call{Func: fn, Args: args}, nil
+}
+
+// parseAggregateExpr parses an aggregation with its optional grouping clause
+func (p *parser) parseAggregateExpr(op item) (Expr, error) {
+	agg := &AggregateExpr{Op: strings.ToLower(op.lit)}
+
+	parseGrouping := func() error {
+		it := p.peek()
+		if it.tok != IDENT || (!strings.EqualFold(it.lit, "by") && !strings.EqualFold(it.lit, "without")) {
+			return nil
+		}
+		p.next()
+		agg.Without = strings.EqualFold(it.lit, "without")
+		labels, err := p.parseLabelList()
+		if err != nil {
+			return err
+		}
+		agg.Grouping = labels
+		return nil
+	}
+
+	if err := parseGrouping(); err != nil {
+		return nil, err
+	}
+
+	if _, err := p.expect(LPAREN, "aggregation"); err != nil {
+		return nil, err
+	}
+	var args []Expr
+	for p.peek().tok != RPAREN {
+		arg, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek().tok != COMMA {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(RPAREN, "aggregation"); err != nil {
+		return nil, err
+	}
+
+	if agg.Grouping == nil {
+		if err := parseGrouping(); err != nil {
+			return nil, err
+		}
+	}
+
+	wantArgs := 1
+	if aggregators[agg.Op] {
+		wantArgs = 2
+	}
+	if len(args) != wantArgs {
+		return nil, p.errorf(op.pos, "wrong number of arguments for aggregate expression %q: expected %d, got %d", agg.Op, wantArgs, len(args))
+	}
+
+	agg.Expr = args[len(args)-1]
+	if wantArgs == 2 {
+		agg.Param = args[0]
+		if agg.Param.Type() != ValueTypeScalar {
+			return nil, p.errorf(op.pos, "expected type scalar in aggregation parameter, got %s", agg.Param.Type())
+		}
+	}
+	if agg.Expr.Type() != ValueTypeVector {
+		return nil, p.errorf(op.pos, "expected type instant vector in aggregation expression, got %s", agg.Expr.Type())
+	}
+
+	return agg, nil
+}
+
+// unwrapParens removes enclosing parentheses from an expression
+func unwrapParens(expr Expr) Expr {
+	for {
+		paren, ok := expr.(*ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.Expr
+	}
+}
+
+// ParseMetricSelector parses a series selector such as up{job="api"} into its label matchers
+func ParseMetricSelector(input string) ([]*Matcher, error) {
+	expr, err := ParseExpr(input)
+	if err != nil {
+		return nil, err
+	}
+	vs, ok := expr.(*VectorSelector)
+	if !ok || vs.Offset != 0 {
+		return nil, errors.NewValidationError("invalid series selector " + strconv.Quote(input))
+	}
+	return vs.Matchers, nil
+}
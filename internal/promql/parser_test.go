@@ -0,0 +1,153 @@
+package promql
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExpr(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+		typ   ValueType
+	}{
+		{"number", "42", "42", ValueTypeScalar},
+		{"negative number", "-1.5", "-1.5", ValueTypeScalar},
+		{"string", `'hello'`, `"hello"`, ValueTypeString},
+		{"metric name", "http_requests_total", "http_requests_total", ValueTypeVector},
+		{"matchers", `cpu{host="a", region=~"us-.*"}`, `cpu{host="a",region=~"us-.*"}`, ValueTypeVector},
+		{"matchers only", `{__name__="cpu"}`, `{__name__="cpu"}`, ValueTypeVector},
+		{"range", "cpu[5m]", "cpu[5m]", ValueTypeMatrix},
+		{"offset", "cpu offset 1h", "cpu offset 1h", ValueTypeVector},
+		{"range with offset", "cpu[1h30m] offset 1d", "cpu[1h30m] offset 1d", ValueTypeMatrix},
+		{"function", "rate(requests[5m])", "rate(requests[5m])", ValueTypeVector},
+		{"aggregation by", "sum by (host) (rate(requests[5m]))", "sum by (host) (rate(requests[5m]))", ValueTypeVector},
+		{"aggregation trailing by", "avg(cpu) by (region)", "avg by (region) (cpu)", ValueTypeVector},
+		{"aggregation without", "max without (host) (cpu)", "max without (host) (cpu)", ValueTypeVector},
+		{"topk", "topk(3, cpu)", "topk(3, cpu)", ValueTypeVector},
+		{"arithmetic precedence", "a + b * c", "a + b * c", ValueTypeVector},
+		{"power is right associative", "2 ^ 3 ^ 2", "2 ^ 3 ^ 2", ValueTypeScalar},
+		{"comparison bool", "cpu > bool 10", "cpu > bool 10", ValueTypeVector},
+		{"vector matching", "a / on (host) group_left (region) b", "a / on (host) group_left (region) b", ValueTypeVector},
+		{"set operator", "a and ignoring (job) b", "a and ignoring (job) b", ValueTypeVector},
+		{"parentheses", "(a + b) * 2", "(a + b) * 2", ValueTypeVector},
+		{"comment", "cpu # current usage", "cpu", ValueTypeVector},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := ParseExpr(tt.input)
+			if err != nil {
+				t.Fatalf("ParseExpr(%q) failed: %v", tt.input, err)
+			}
+			if got := expr.String(); got != tt.want {
+				t.Errorf("ParseExpr(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+			if expr.Type() != tt.typ {
+				t.Errorf("ParseExpr(%q) type = %s, want %s", tt.input, expr.Type(), tt.typ)
+			}
+		})
+	}
+}
+
+func TestParseExprPrecedence(t *testing.T) {
+	expr, err := ParseExpr("1 + 2 * 3 - 4")
+	if err != nil {
+		t.Fatalf("ParseExpr failed: %v", err)
+	}
+
+	// Expect (1 + (2 * 3)) - 4
+	sub, ok := expr.(*BinaryExpr)
+	if !ok || sub.Op != SUB {
+		t.Fatalf("Expected top-level subtraction, got %s", expr)
+	}
+	add, ok := sub.LHS.(*BinaryExpr)
+	if !ok || add.Op != ADD {
+		t.Fatalf("Expected addition on the left, got %s", sub.LHS)
+	}
+	if mul, ok := add.RHS.(*BinaryExpr); !ok || mul.Op != MUL {
+		t.Errorf("Expected multiplication nested in addition, got %s", add.RHS)
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", "unexpected end of input"},
+		{"cpu{", "expected"},
+		{`{host=~".*"}`, "at least one non-empty matcher"},
+		{"rate(cpu)", "expected type matrix"},
+		{"unknown_fn(cpu)", "unknown function"},
+		{"sum(cpu[5m])", "expected type instant vector"},
+		{"cpu[5m] + 1", "binary expression must contain only scalar and instant vector types"},
+		{"1 > 2", "must use bool modifier"},
+		{"1 and 2", "set operator"},
+		{"cpu[5x]", "expected duration"},
+		{`cpu{host="a}`, "unterminated quoted string"},
+		{`cpu{host=~"("}`, "invalid regular expression"},
+		{"topk(cpu)", "wrong number of arguments"},
+		{"cpu + on(host) 1", "vector matching only allowed between instant vectors"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := ParseExpr(tt.input)
+			if err == nil {
+				t.Fatalf("ParseExpr(%q) succeeded, want error", tt.input)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseExpr(%q) error = %q, want it to contain %q", tt.input, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"500ms", 500 * time.Millisecond},
+		{"30s", 30 * time.Second},
+		{"5m", 5 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"2d", 48 * time.Hour},
+		{"1w", 7 * 24 * time.Hour},
+		{"1y", 365 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.in)
+		if err != nil {
+			t.Errorf("ParseDuration(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "5", "m", "30m1h", "5x"} {
+		if _, err := ParseDuration(bad); err == nil {
+			t.Errorf("ParseDuration(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestParseMetricSelector(t *testing.T) {
+	matchers, err := ParseMetricSelector(`cpu{host!="a"}`)
+	if err != nil {
+		t.Fatalf("ParseMetricSelector failed: %v", err)
+	}
+	if len(matchers) != 2 {
+		t.Fatalf("Expected 2 matchers, got %d", len(matchers))
+	}
+
+	if _, err := ParseMetricSelector("rate(cpu[5m])"); err == nil {
+		t.Error("Expected an error for a non-selector expression")
+	}
+}
@@ -0,0 +1,134 @@
+package promql
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetricNameLabel is the label holding the metric name
+const MetricNameLabel = "__name__"
+
+// Labels is a set of label name/value pairs identifying a series
+type Labels map[string]string
+
+// Copy returns a copy of the label set
+func (l Labels) Copy() Labels {
+	c := make(Labels, len(l))
+	for k, v := range l {
+		c[k] = v
+	}
+	return c
+}
+
+// WithoutName returns a copy of the label set without the metric name
+func (l Labels) WithoutName() Labels {
+	c := l.Copy()
+	delete(c, MetricNameLabel)
+	return c
+}
+
+// String returns the labels in the {a="b", c="d"} notation with sorted names
+func (l Labels) String() string {
+	var buf strings.Builder
+	buf.WriteByte('{')
+	for i, k := range sortedKeys(l) {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(strconv.Quote(l[k]))
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+// signature returns a canonical key of the label set, restricted to names when
+// on is true or excluding names otherwise
+func (l Labels) signature(names []string, on bool) string {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+
+	var buf strings.Builder
+	for _, k := range sortedKeys(l) {
+		if on != set[k] {
+			continue
+		}
+		buf.WriteString(k)
+		buf.WriteByte(0xff)
+		buf.WriteString(l[k])
+		buf.WriteByte(0xff)
+	}
+	return buf.String()
+}
+
+// Point is a single timestamped value. T is in nanoseconds since the Unix epoch.
+type Point struct {
+	T int64
+	V float64
+}
+
+// Sample is a point belonging to a series
+type Sample struct {
+	Metric Labels
+	T      int64
+	V      float64
+}
+
+// Series is a labelled list of points in timestamp order
+type Series struct {
+	Metric Labels
+	Points []Point
+}
+
+// Value is the result of evaluating an expression
+type Value interface {
+	Type() ValueType
+}
+
+// Scalar is a single number
+type Scalar struct {
+	T int64
+	V float64
+}
+
+// Type returns ValueTypeScalar
+func (Scalar) Type() ValueType { return ValueTypeScalar }
+
+// String is a string value
+type String struct {
+	T int64
+	V string
+}
+
+// Type returns ValueTypeString
+func (String) Type() ValueType { return ValueTypeString }
+
+// Vector is a set of samples at a single evaluation timestamp
+type Vector []Sample
+
+// Type returns ValueTypeVector
+func (Vector) Type() ValueType { return ValueTypeVector }
+
+// Matrix is a set of series
+type Matrix []Series
+
+// Type returns ValueTypeMatrix
+func (Matrix) Type() ValueType { return ValueTypeMatrix }
+
+// sortVector orders samples by their labels for deterministic output
+func sortVector(v Vector) {
+	sort.SliceStable(v, func(i, j int) bool {
+		return v[i].Metric.String() < v[j].Metric.String()
+	})
+}
+
+// sortMatrix orders series by their labels for deterministic output
+func sortMatrix(m Matrix) {
+	sort.SliceStable(m, func(i, j int) bool {
+		return m[i].Metric.String() < m[j].Metric.String()
+	})
+}
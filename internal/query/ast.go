@@ -0,0 +1,643 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"timeseriesdb/internal/storage"
+)
+
+// Node represents a node in the query abstract syntax tree
+type Node interface {
+	String() string
+}
+
+// Statement represents a single executable query statement
+type Statement interface {
+	Node
+	stmt()
+}
+
+// Expr represents an expression that can be evaluated
+type Expr interface {
+	Node
+	expr()
+}
+
+// SelectStatement represents a SELECT query
+type SelectStatement struct {
+	// Fields are the expressions returned by the query
+	Fields []*Field
+
+	// Sources are the measurements the query reads from
+	Sources []string
+
+	// Aliases holds the AS name of each source, empty for a source without one
+	Aliases []string
+
+	// Condition is the WHERE clause, or nil
+	Condition Expr
+
+	// Dimensions are the GROUP BY expressions
+	Dimensions []*Dimension
+
+	// Fill decides what GROUP BY time returns for windows without points,
+	// empty when no fill clause is given. FillValue is the number given to
+	// fill(<number>).
+	Fill      storage.FillMode
+	FillValue float64
+
+	// Matching pairs the series of different sources joined by an
+	// expression, or is nil to pair series with identical tag sets
+	Matching *Matching
+
+	// Tolerance is how far apart the timestamps of raw points paired by an
+	// expression may be, zero to only pair points with equal timestamps
+	Tolerance time.Duration
+
+	// Limit and Offset restrict the number of rows returned per series
+	Limit  int
+	Offset int
+
+	// Ascending is false when ORDER BY time DESC is given
+	Ascending bool
+}
+
+func (*SelectStatement) stmt() {}
+
+// String returns the statement rendered back into the query language
+func (s *SelectStatement) String() string {
+	var buf strings.Builder
+	buf.WriteString("SELECT ")
+	for i, f := range s.Fields {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(f.String())
+	}
+
+	buf.WriteString(" FROM ")
+	for i, src := range s.Sources {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(QuoteIdent(src))
+		if i < len(s.Aliases) && s.Aliases[i] != "" {
+			buf.WriteString(" AS " + QuoteIdent(s.Aliases[i]))
+		}
+	}
+
+	if s.Condition != nil {
+		buf.WriteString(" WHERE ")
+		buf.WriteString(s.Condition.String())
+	}
+
+	if len(s.Dimensions) > 0 {
+		buf.WriteString(" GROUP BY ")
+		for i, d := range s.Dimensions {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(d.String())
+		}
+	}
+
+	switch s.Fill {
+	case "":
+	case storage.FillConstant:
+		buf.WriteString(" fill(" + strconv.FormatFloat(s.FillValue, 'g', -1, 64) + ")")
+	default:
+		buf.WriteString(" fill(" + string(s.Fill) + ")")
+	}
+
+	if s.Matching != nil {
+		buf.WriteString(" " + s.Matching.String())
+	}
+	if s.Tolerance > 0 {
+		buf.WriteString(" TOLERANCE " + FormatDuration(s.Tolerance))
+	}
+
+	if !s.Ascending {
+		buf.WriteString(" ORDER BY time DESC")
+	}
+	if s.Limit > 0 {
+		fmt.Fprintf(&buf, " LIMIT %d", s.Limit)
+	}
+	if s.Offset > 0 {
+		fmt.Fprintf(&buf, " OFFSET %d", s.Offset)
+	}
+
+	return buf.String()
+}
+
+// GroupByInterval returns the GROUP BY time() interval, or zero if there is none
+func (s *SelectStatement) GroupByInterval() time.Duration {
+	for _, d := range s.Dimensions {
+		if call, ok := d.Expr.(*Call); ok && call.Name == "time" && len(call.Args) > 0 {
+			if lit, ok := call.Args[0].(*DurationLiteral); ok {
+				return lit.Val
+			}
+		}
+	}
+	return 0
+}
+
+// GroupByTags returns the tag keys listed in GROUP BY and whether GROUP BY * was given
+func (s *SelectStatement) GroupByTags() (keys []string, all bool) {
+	for _, d := range s.Dimensions {
+		switch expr := d.Expr.(type) {
+		case *VarRef:
+			keys = append(keys, expr.Val)
+		case *Wildcard:
+			all = true
+		}
+	}
+	return keys, all
+}
+
+// Matching describes how the series of different sources are paired: on the
+// listed tags only, or on every tag but the listed ones
+type Matching struct {
+	Ignoring bool
+	Tags     []string
+}
+
+// String returns the MATCH clause rendered back into the query language
+func (m *Matching) String() string {
+	tags := make([]string, len(m.Tags))
+	for i, tag := range m.Tags {
+		tags[i] = QuoteIdent(tag)
+	}
+	if m.Ignoring {
+		return "MATCH IGNORING (" + strings.Join(tags, ", ") + ")"
+	}
+	return "MATCH ON (" + strings.Join(tags, ", ") + ")"
+}
+
+// ShowMeasurementsStatement represents a SHOW MEASUREMENTS query
+type ShowMeasurementsStatement struct {
+	// Condition restricts the measurements by time and tags, or is nil
+	Condition Expr
+
+	// Limit and Offset restrict the number of measurements returned
+	Limit  int
+	Offset int
+}
+
+func (*ShowMeasurementsStatement) stmt() {}
+
+// String returns the statement rendered back into the query language
+func (s *ShowMeasurementsStatement) String() string {
+	var buf strings.Builder
+	buf.WriteString("SHOW MEASUREMENTS")
+	writeShowClauses(&buf, nil, s.Condition, s.Limit, s.Offset)
+	return buf.String()
+}
+
+// ShowTagKeysStatement represents a SHOW TAG KEYS query
+type ShowTagKeysStatement struct {
+	// Sources are the measurements to inspect, all measurements when empty
+	Sources []string
+
+	// Condition restricts the series by time and tags, or is nil
+	Condition Expr
+
+	// Limit and Offset restrict the number of keys returned per measurement
+	Limit  int
+	Offset int
+}
+
+func (*ShowTagKeysStatement) stmt() {}
+
+// String returns the statement rendered back into the query language
+func (s *ShowTagKeysStatement) String() string {
+	var buf strings.Builder
+	buf.WriteString("SHOW TAG KEYS")
+	writeShowClauses(&buf, s.Sources, s.Condition, s.Limit, s.Offset)
+	return buf.String()
+}
+
+// ShowTagValuesStatement represents a SHOW TAG VALUES WITH KEY query
+type ShowTagValuesStatement struct {
+	// Sources are the measurements to inspect, all measurements when empty
+	Sources []string
+
+	// Op selects the tag keys: EQ, NEQ or IN compare against TagKeys,
+	// EQREGEX or NEQREGEX match TagKeyRegex
+	Op          Token
+	TagKeys     []string
+	TagKeyRegex *regexp.Regexp
+
+	// Condition restricts the series by time and tags, or is nil
+	Condition Expr
+
+	// Limit and Offset restrict the number of values returned per measurement
+	Limit  int
+	Offset int
+}
+
+func (*ShowTagValuesStatement) stmt() {}
+
+// String returns the statement rendered back into the query language
+func (s *ShowTagValuesStatement) String() string {
+	var buf strings.Builder
+	buf.WriteString("SHOW TAG VALUES")
+	writeShowClauses(&buf, s.Sources, nil, 0, 0)
+
+	buf.WriteString(" WITH KEY ")
+	switch s.Op {
+	case IN:
+		buf.WriteString("IN (")
+		for i, key := range s.TagKeys {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(QuoteIdent(key))
+		}
+		buf.WriteString(")")
+	case EQREGEX, NEQREGEX:
+		buf.WriteString(s.Op.String() + " " + (&RegexLiteral{Val: s.TagKeyRegex}).String())
+	default:
+		buf.WriteString(s.Op.String() + " " + QuoteIdent(s.TagKeys[0]))
+	}
+
+	writeShowClauses(&buf, nil, s.Condition, s.Limit, s.Offset)
+	return buf.String()
+}
+
+// MatchTagKey reports whether the WITH KEY clause selects a tag key
+func (s *ShowTagValuesStatement) MatchTagKey(key string) bool {
+	switch s.Op {
+	case EQ, IN:
+		for _, k := range s.TagKeys {
+			if k == key {
+				return true
+			}
+		}
+		return false
+	case NEQ:
+		return key != s.TagKeys[0]
+	case EQREGEX:
+		return s.TagKeyRegex.MatchString(key)
+	case NEQREGEX:
+		return !s.TagKeyRegex.MatchString(key)
+	}
+	return false
+}
+
+// ShowFieldKeysStatement represents a SHOW FIELD KEYS query
+type ShowFieldKeysStatement struct {
+	// Sources are the measurements to inspect, all measurements when empty
+	Sources []string
+
+	// Condition restricts the series by time and tags, or is nil
+	Condition Expr
+
+	// Limit and Offset restrict the number of keys returned per measurement
+	Limit  int
+	Offset int
+}
+
+func (*ShowFieldKeysStatement) stmt() {}
+
+// String returns the statement rendered back into the query language
+func (s *ShowFieldKeysStatement) String() string {
+	var buf strings.Builder
+	buf.WriteString("SHOW FIELD KEYS")
+	writeShowClauses(&buf, s.Sources, s.Condition, s.Limit, s.Offset)
+	return buf.String()
+}
+
+// ExplainStatement represents an EXPLAIN query, describing where the values
+// of a SELECT statement would be read from instead of reading them
+type ExplainStatement struct {
+	Statement *SelectStatement
+}
+
+func (*ExplainStatement) stmt() {}
+
+// String returns the statement rendered back into the query language
+func (s *ExplainStatement) String() string {
+	return "EXPLAIN " + s.Statement.String()
+}
+
+// ShowSeriesStatement represents a SHOW SERIES query
+type ShowSeriesStatement struct {
+	// Sources are the measurements to inspect, all measurements when empty
+	Sources []string
+
+	// Condition restricts the series by time and tags, or is nil
+	Condition Expr
+
+	// Limit and Offset restrict the number of series returned
+	Limit  int
+	Offset int
+}
+
+func (*ShowSeriesStatement) stmt() {}
+
+// String returns the statement rendered back into the query language
+func (s *ShowSeriesStatement) String() string {
+	var buf strings.Builder
+	buf.WriteString("SHOW SERIES")
+	writeShowClauses(&buf, s.Sources, s.Condition, s.Limit, s.Offset)
+	return buf.String()
+}
+
+// writeShowClauses renders the optional FROM, WHERE, LIMIT and OFFSET clauses of a SHOW statement
+func writeShowClauses(buf *strings.Builder, sources []string, cond Expr, limit, offset int) {
+	if len(sources) > 0 {
+		buf.WriteString(" FROM ")
+		for i, src := range sources {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(QuoteIdent(src))
+		}
+	}
+	if cond != nil {
+		buf.WriteString(" WHERE ")
+		buf.WriteString(cond.String())
+	}
+	if limit > 0 {
+		fmt.Fprintf(buf, " LIMIT %d", limit)
+	}
+	if offset > 0 {
+		fmt.Fprintf(buf, " OFFSET %d", offset)
+	}
+}
+
+// Field represents an expression in the SELECT list with an optional alias
+type Field struct {
+	Expr  Expr
+	Alias string
+}
+
+// String returns the field rendered back into the query language
+func (f *Field) String() string {
+	if f.Alias == "" {
+		return f.Expr.String()
+	}
+	return f.Expr.String() + " AS " + QuoteIdent(f.Alias)
+}
+
+// Name returns the column name of the field
+func (f *Field) Name() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	switch expr := f.Expr.(type) {
+	case *Call:
+		return expr.Name
+	case *VarRef:
+		if expr.Source != "" {
+			return expr.Source + "." + expr.Val
+		}
+		return expr.Val
+	case *ParenExpr:
+		return (&Field{Expr: expr.Expr}).Name()
+	}
+	return f.Expr.String()
+}
+
+// Dimension represents a GROUP BY expression
+type Dimension struct {
+	Expr Expr
+}
+
+// String returns the dimension rendered back into the query language
+func (d *Dimension) String() string {
+	return d.Expr.String()
+}
+
+// VarRef references a field, tag key or the time column. Source, if set,
+// names the measurement or source alias the reference is qualified with.
+type VarRef struct {
+	Source string
+	Val    string
+}
+
+func (*VarRef) expr() {}
+
+// String returns the quoted reference
+func (r *VarRef) String() string {
+	if r.Source != "" {
+		return QuoteIdent(r.Source) + "." + QuoteIdent(r.Val)
+	}
+	return QuoteIdent(r.Val)
+}
+
+// Call represents a function call such as mean(usage) or now()
+type Call struct {
+	Name string
+	Args []Expr
+}
+
+func (*Call) expr() {}
+
+// String returns the call rendered back into the query language
+func (c *Call) String() string {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = arg.String()
+	}
+	return c.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// NumberLiteral represents a floating point literal
+type NumberLiteral struct {
+	Val float64
+}
+
+func (*NumberLiteral) expr() {}
+
+// String returns the formatted number
+func (l *NumberLiteral) String() string {
+	return strconv.FormatFloat(l.Val, 'f', -1, 64)
+}
+
+// IntegerLiteral represents an integer literal
+type IntegerLiteral struct {
+	Val int64
+}
+
+func (*IntegerLiteral) expr() {}
+
+// String returns the formatted integer
+func (l *IntegerLiteral) String() string {
+	return strconv.FormatInt(l.Val, 10)
+}
+
+// StringLiteral represents a single-quoted string literal
+type StringLiteral struct {
+	Val string
+}
+
+func (*StringLiteral) expr() {}
+
+// String returns the quoted string
+func (l *StringLiteral) String() string {
+	return QuoteString(l.Val)
+}
+
+// DurationLiteral represents a duration literal such as 5m
+type DurationLiteral struct {
+	Val time.Duration
+}
+
+func (*DurationLiteral) expr() {}
+
+// String returns the duration in query language notation
+func (l *DurationLiteral) String() string {
+	return FormatDuration(l.Val)
+}
+
+// RegexLiteral represents a regular expression literal
+type RegexLiteral struct {
+	Val *regexp.Regexp
+}
+
+func (*RegexLiteral) expr() {}
+
+// String returns the regex delimited by slashes
+func (l *RegexLiteral) String() string {
+	return "/" + strings.ReplaceAll(l.Val.String(), "/", `\/`) + "/"
+}
+
+// BinaryExpr represents an operation between two expressions
+type BinaryExpr struct {
+	Op  Token
+	LHS Expr
+	RHS Expr
+}
+
+func (*BinaryExpr) expr() {}
+
+// String returns the expression rendered back into the query language
+func (e *BinaryExpr) String() string {
+	return e.LHS.String() + " " + e.Op.String() + " " + e.RHS.String()
+}
+
+// ParenExpr represents a parenthesized expression
+type ParenExpr struct {
+	Expr Expr
+}
+
+func (*ParenExpr) expr() {}
+
+// String returns the parenthesized expression
+func (e *ParenExpr) String() string {
+	return "(" + e.Expr.String() + ")"
+}
+
+// Wildcard represents * in a SELECT list or GROUP BY clause
+type Wildcard struct{}
+
+func (*Wildcard) expr() {}
+
+// String returns "*"
+func (*Wildcard) String() string {
+	return "*"
+}
+
+// identRegex matches identifiers that do not need quoting
+var identRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// QuoteIdent quotes an identifier if it is a keyword or contains special characters
+func QuoteIdent(ident string) string {
+	if identRegex.MatchString(ident) && Lookup(ident) == IDENT {
+		return ident
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(ident) + `"`
+}
+
+// QuoteString returns a single-quoted string literal
+func QuoteString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// durationUnits lists the supported duration units from largest to smallest
+var durationUnits = []struct {
+	unit string
+	d    time.Duration
+}{
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+	{"u", time.Microsecond},
+	{"ns", time.Nanosecond},
+}
+
+// ParseDuration parses a query language duration such as 90s, 1h30m, 2d or 1w
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("invalid duration: empty string")
+	}
+
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		i := 0
+		for i < len(rest) && isDigit(rune(rest[i])) {
+			i++
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		n, err := strconv.ParseInt(rest[:i], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		rest = rest[i:]
+
+		j := 0
+		for j < len(rest) && !isDigit(rune(rest[j])) {
+			j++
+		}
+		unit := rest[:j]
+		rest = rest[j:]
+
+		var d time.Duration
+		switch unit {
+		case "ns":
+			d = time.Nanosecond
+		case "u", "µ", "us":
+			d = time.Microsecond
+		case "ms":
+			d = time.Millisecond
+		case "s":
+			d = time.Second
+		case "m":
+			d = time.Minute
+		case "h":
+			d = time.Hour
+		case "d":
+			d = 24 * time.Hour
+		case "w":
+			d = 7 * 24 * time.Hour
+		default:
+			return 0, fmt.Errorf("invalid duration unit %q in %s", unit, s)
+		}
+		total += time.Duration(n) * d
+	}
+
+	return total, nil
+}
+
+// FormatDuration formats a duration using the largest unit that divides it exactly
+func FormatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+	for _, u := range durationUnits {
+		if d%u.d == 0 {
+			return strconv.FormatInt(int64(d/u.d), 10) + u.unit
+		}
+	}
+	return strconv.FormatInt(int64(d), 10) + "ns"
+}
@@ -0,0 +1,344 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"timeseriesdb/internal/storage"
+)
+
+var (
+	// MinTime is the lower bound used when a query has no time condition
+	MinTime = time.Unix(0, math.MinInt64).UTC()
+	// MaxTime is the upper bound used when a query has no time condition
+	MaxTime = time.Unix(0, math.MaxInt64).UTC()
+)
+
+// TimeRange is an inclusive time interval
+type TimeRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// IsZeroStart reports whether the range has no lower bound
+func (r TimeRange) IsZeroStart() bool {
+	return r.Start.Equal(MinTime)
+}
+
+// IsZeroEnd reports whether the range has no upper bound
+func (r TimeRange) IsZeroEnd() bool {
+	return r.End.Equal(MaxTime)
+}
+
+// splitCondition separates the top-level AND terms of a WHERE clause into the
+// time range they describe and the remaining tag condition
+func splitCondition(cond Expr, now time.Time) (TimeRange, Expr, error) {
+	tr := TimeRange{Start: MinTime, End: MaxTime}
+	if cond == nil {
+		return tr, nil, nil
+	}
+
+	var tagConds []Expr
+	for _, term := range andTerms(cond) {
+		bin, ok := term.(*BinaryExpr)
+		if !ok || !referencesTime(bin) {
+			if containsTimeRef(term) {
+				return tr, nil, fmt.Errorf("time conditions must be combined with AND: %s", term)
+			}
+			tagConds = append(tagConds, term)
+			continue
+		}
+
+		if err := applyTimeCondition(&tr, bin, now); err != nil {
+			return tr, nil, err
+		}
+	}
+
+	if tr.End.Before(tr.Start) {
+		return tr, nil, fmt.Errorf("invalid time range: end %s is before start %s",
+			tr.End.Format(time.RFC3339Nano), tr.Start.Format(time.RFC3339Nano))
+	}
+
+	var tagCond Expr
+	for _, c := range tagConds {
+		if tagCond == nil {
+			tagCond = c
+		} else {
+			tagCond = &BinaryExpr{Op: AND, LHS: tagCond, RHS: c}
+		}
+	}
+
+	return tr, tagCond, nil
+}
+
+// andTerms flattens a tree of AND expressions into its terms
+func andTerms(expr Expr) []Expr {
+	switch e := expr.(type) {
+	case *ParenExpr:
+		if bin, ok := e.Expr.(*BinaryExpr); ok && bin.Op == AND {
+			return andTerms(bin)
+		}
+	case *BinaryExpr:
+		if e.Op == AND {
+			return append(andTerms(e.LHS), andTerms(e.RHS)...)
+		}
+	}
+	return []Expr{expr}
+}
+
+// referencesTime reports whether a comparison has the time column on one side
+func referencesTime(bin *BinaryExpr) bool {
+	return isTimeRef(bin.LHS) || isTimeRef(bin.RHS)
+}
+
+// isTimeRef reports whether expr is a reference to the time column
+func isTimeRef(expr Expr) bool {
+	ref, ok := expr.(*VarRef)
+	return ok && strings.EqualFold(ref.Val, "time")
+}
+
+// containsTimeRef reports whether expr references the time column anywhere
+func containsTimeRef(expr Expr) bool {
+	switch e := expr.(type) {
+	case *VarRef:
+		return isTimeRef(e)
+	case *ParenExpr:
+		return containsTimeRef(e.Expr)
+	case *BinaryExpr:
+		return containsTimeRef(e.LHS) || containsTimeRef(e.RHS)
+	}
+	return false
+}
+
+// applyTimeCondition narrows the time range with a single time comparison
+func applyTimeCondition(tr *TimeRange, bin *BinaryExpr, now time.Time) error {
+	op := bin.Op
+	valueExpr := bin.RHS
+	if isTimeRef(bin.RHS) {
+		// Normalise "<value> op time" to "time op' <value>"
+		valueExpr = bin.LHS
+		switch op {
+		case LT:
+			op = GT
+		case LTE:
+			op = GTE
+		case GT:
+			op = LT
+		case GTE:
+			op = LTE
+		}
+	}
+
+	t, err := evalTime(valueExpr, now)
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case GT:
+		t = t.Add(time.Nanosecond)
+		fallthrough
+	case GTE:
+		if t.After(tr.Start) {
+			tr.Start = t
+		}
+	case LT:
+		t = t.Add(-time.Nanosecond)
+		fallthrough
+	case LTE:
+		if t.Before(tr.End) {
+			tr.End = t
+		}
+	case EQ:
+		if t.After(tr.Start) {
+			tr.Start = t
+		}
+		if t.Before(tr.End) {
+			tr.End = t
+		}
+	default:
+		return fmt.Errorf("unsupported time operator %s", bin.Op)
+	}
+
+	return nil
+}
+
+// timeLayouts are the accepted formats for time string literals
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// evalTime evaluates an expression to an absolute time
+func evalTime(expr Expr, now time.Time) (time.Time, error) {
+	switch e := expr.(type) {
+	case *ParenExpr:
+		return evalTime(e.Expr, now)
+	case *Call:
+		if e.Name == "now" && len(e.Args) == 0 {
+			return now, nil
+		}
+	case *StringLiteral:
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, e.Val); err == nil {
+				return t.UTC(), nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid time literal %s", e)
+	case *IntegerLiteral:
+		return time.Unix(0, e.Val).UTC(), nil
+	case *BinaryExpr:
+		if e.Op != ADD && e.Op != SUB {
+			break
+		}
+		base, err := evalTime(e.LHS, now)
+		if err != nil {
+			return time.Time{}, err
+		}
+		d, ok := e.RHS.(*DurationLiteral)
+		if !ok {
+			return time.Time{}, fmt.Errorf("expected duration in time expression %s", e)
+		}
+		if e.Op == SUB {
+			return base.Add(-d.Val), nil
+		}
+		return base.Add(d.Val), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time expression %s", expr)
+}
+
+// validateTagCondition checks that a condition only compares tags with strings or regexes
+func validateTagCondition(expr Expr, fields map[string]bool) error {
+	switch e := expr.(type) {
+	case nil:
+		return nil
+	case *ParenExpr:
+		return validateTagCondition(e.Expr, fields)
+	case *BinaryExpr:
+		switch e.Op {
+		case AND, OR:
+			if err := validateTagCondition(e.LHS, fields); err != nil {
+				return err
+			}
+			return validateTagCondition(e.RHS, fields)
+		case EQ, NEQ, EQREGEX, NEQREGEX:
+			ref, ok := e.LHS.(*VarRef)
+			if !ok {
+				return fmt.Errorf("expected tag key on the left of %s", e)
+			}
+			if fields[ref.Val] {
+				return fmt.Errorf("conditions on field %q are not supported", ref.Val)
+			}
+			switch e.RHS.(type) {
+			case *StringLiteral:
+				if e.Op == EQREGEX || e.Op == NEQREGEX {
+					return fmt.Errorf("expected regex on the right of %s", e)
+				}
+				return nil
+			case *RegexLiteral:
+				return nil
+			}
+			return fmt.Errorf("expected string or regex on the right of %s", e)
+		}
+	}
+	return fmt.Errorf("unsupported condition %s", expr)
+}
+
+// evalTagCondition evaluates a validated tag condition against a series tag set
+func evalTagCondition(expr Expr, tags map[string]string) bool {
+	switch e := expr.(type) {
+	case nil:
+		return true
+	case *ParenExpr:
+		return evalTagCondition(e.Expr, tags)
+	case *BinaryExpr:
+		switch e.Op {
+		case AND:
+			return evalTagCondition(e.LHS, tags) && evalTagCondition(e.RHS, tags)
+		case OR:
+			return evalTagCondition(e.LHS, tags) || evalTagCondition(e.RHS, tags)
+		}
+
+		value := tags[e.LHS.(*VarRef).Val]
+		switch rhs := e.RHS.(type) {
+		case *StringLiteral:
+			if e.Op == EQ {
+				return value == rhs.Val
+			}
+			return value != rhs.Val
+		case *RegexLiteral:
+			if e.Op == EQREGEX {
+				return rhs.Val.MatchString(value)
+			}
+			return !rhs.Val.MatchString(value)
+		}
+	}
+	return false
+}
+
+// tagMatchers converts the top-level AND terms of a validated tag condition
+// that compare a single tag into index matchers. Terms the index cannot
+// resolve, such as OR expressions, are returned as the residual condition.
+func tagMatchers(expr Expr) ([]*storage.TagMatcher, Expr) {
+	if expr == nil {
+		return nil, nil
+	}
+
+	var matchers []*storage.TagMatcher
+	var residual Expr
+	for _, term := range andTerms(expr) {
+		if m := tagMatcher(term); m != nil {
+			matchers = append(matchers, m)
+			continue
+		}
+		if residual == nil {
+			residual = term
+		} else {
+			residual = &BinaryExpr{Op: AND, LHS: residual, RHS: term}
+		}
+	}
+	return matchers, residual
+}
+
+// tagMatcher converts a single tag comparison into an index matcher, or
+// returns nil if the term is not a comparison
+func tagMatcher(term Expr) *storage.TagMatcher {
+	if paren, ok := term.(*ParenExpr); ok {
+		return tagMatcher(paren.Expr)
+	}
+	bin, ok := term.(*BinaryExpr)
+	if !ok {
+		return nil
+	}
+	ref, ok := bin.LHS.(*VarRef)
+	if !ok {
+		return nil
+	}
+
+	var m *storage.TagMatcher
+	var err error
+	switch rhs := bin.RHS.(type) {
+	case *StringLiteral:
+		switch bin.Op {
+		case EQ:
+			m, err = storage.NewTagMatcher(storage.MatchEqual, ref.Val, rhs.Val)
+		case NEQ:
+			m, err = storage.NewTagMatcher(storage.MatchNotEqual, ref.Val, rhs.Val)
+		}
+	case *RegexLiteral:
+		switch bin.Op {
+		case EQREGEX:
+			m, err = storage.NewTagMatcher(storage.MatchRegex, ref.Val, rhs.Val.String())
+		case NEQREGEX:
+			m, err = storage.NewTagMatcher(storage.MatchNotRegex, ref.Val, rhs.Val.String())
+		}
+	}
+	if err != nil {
+		return nil
+	}
+	return m
+}
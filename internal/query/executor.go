@@ -0,0 +1,485 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/storage"
+)
+
+// Result is the outcome of executing a statement
+type Result struct {
+	Series []*Row `json:"series"`
+}
+
+// Row is a set of result values for one measurement and group of tags
+type Row struct {
+	Name    string            `json:"name"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Columns []string          `json:"columns"`
+	Values  [][]interface{}   `json:"values"`
+}
+
+// Executor runs parsed statements against one database
+type Executor struct {
+	storage *storage.Database
+	now     func() time.Time
+}
+
+// NewExecutor creates a new query executor over a database
+func NewExecutor(storage *storage.Database) *Executor {
+	return &Executor{
+		storage: storage,
+		now:     time.Now,
+	}
+}
+
+// ExecuteQuery parses and executes a query string
+func (e *Executor) ExecuteQuery(ctx context.Context, query string) (*Result, error) {
+	stmt, err := ParseStatement(query)
+	if err != nil {
+		return nil, asValidationError(err)
+	}
+	return e.Execute(ctx, stmt)
+}
+
+// Execute executes a parsed statement. Reads stop with a timeout or
+// cancellation error once ctx is done.
+func (e *Executor) Execute(ctx context.Context, stmt Statement) (*Result, error) {
+	switch stmt := stmt.(type) {
+	case *SelectStatement:
+		return e.executeSelect(ctx, stmt)
+	case *ExplainStatement:
+		return e.executeExplain(stmt)
+	case *ShowMeasurementsStatement:
+		return e.executeShowMeasurements(stmt)
+	case *ShowTagKeysStatement:
+		return e.executeShowTagKeys(stmt)
+	case *ShowTagValuesStatement:
+		return e.executeShowTagValues(stmt)
+	case *ShowFieldKeysStatement:
+		return e.executeShowFieldKeys(stmt)
+	case *ShowSeriesStatement:
+		return e.executeShowSeries(stmt)
+	default:
+		return nil, errors.NewValidationError(fmt.Sprintf("unsupported statement: %s", stmt))
+	}
+}
+
+// column describes one selected value in the result
+type column struct {
+	name  string
+	field string
+	agg   storage.AggregateOptions
+	// rate is set for the functions over the changes of a series, which are
+	// computed instead of agg
+	rate *storage.RateOptions
+}
+
+// seriesGroup is the set of series that produce a single result row set
+type seriesGroup struct {
+	tags   map[string]string
+	id     string
+	series []storage.SeriesKey
+}
+
+// executeSelect runs a SELECT statement one source at a time
+func (e *Executor) executeSelect(ctx context.Context, stmt *SelectStatement) (*Result, error) {
+	now := e.now().UTC()
+
+	tr, tagCond, err := splitCondition(stmt.Condition, now)
+	if err != nil {
+		return nil, asValidationError(err)
+	}
+
+	interval := stmt.GroupByInterval()
+	if interval > 0 && tr.IsZeroEnd() {
+		tr.End = now
+	}
+
+	if hasExpressions(stmt) {
+		return e.executeExpressions(ctx, stmt, tr, tagCond, interval)
+	}
+	if stmt.Matching != nil || stmt.Tolerance > 0 {
+		return nil, errors.NewValidationError("MATCH and TOLERANCE require a field expression")
+	}
+
+	call, err := topCall(stmt)
+	if err != nil {
+		return nil, asValidationError(err)
+	}
+	if call != nil {
+		return e.executeTop(ctx, stmt, call, tr, tagCond, interval)
+	}
+
+	result := &Result{Series: []*Row{}}
+	for _, source := range stmt.Sources {
+		fields, err := e.sourceFields(source)
+		if err != nil {
+			return nil, err
+		}
+
+		columns, aggregate, err := resolveColumns(stmt, fields)
+		if err != nil {
+			return nil, asValidationError(err)
+		}
+		if err := validateTagCondition(tagCond, fields); err != nil {
+			return nil, asValidationError(err)
+		}
+
+		keys, err := e.findSeries(source, tagCond)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range groupSeries(stmt, keys) {
+			var row *Row
+			if aggregate {
+				row, err = e.aggregateRow(ctx, source, group, columns, tr, interval)
+			} else {
+				row, err = e.rawRow(ctx, source, group, columns, tr)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			applyOrderAndLimit(row, stmt)
+			if len(row.Values) > 0 {
+				result.Series = append(result.Series, row)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// sourceFields returns the set of fields of a source
+func (e *Executor) sourceFields(source string) (map[string]bool, error) {
+	names, err := e.storage.Fields(source)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]bool, len(names))
+	for _, name := range names {
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// findSeries returns the series of a source satisfying a validated tag
+// condition. Single tag comparisons are resolved through the tag index and
+// the rest of the condition is evaluated against each remaining series.
+func (e *Executor) findSeries(source string, tagCond Expr) ([]storage.SeriesKey, error) {
+	matchers, residual := tagMatchers(tagCond)
+	keys, err := e.storage.FindSeries(source, matchers...)
+	if err != nil || residual == nil {
+		return keys, err
+	}
+
+	filtered := keys[:0]
+	for _, key := range keys {
+		if evalTagCondition(residual, key.Tags) {
+			filtered = append(filtered, key)
+		}
+	}
+	return filtered, nil
+}
+
+// resolveColumns expands the SELECT list into columns and reports whether
+// the query aggregates
+func resolveColumns(stmt *SelectStatement, fields map[string]bool) ([]column, bool, error) {
+	var columns []column
+	var raw, aggregate bool
+
+	for _, f := range stmt.Fields {
+		switch expr := f.Expr.(type) {
+		case *Wildcard:
+			raw = true
+			names := make([]string, 0, len(fields))
+			for name := range fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				columns = append(columns, column{name: name, field: name})
+			}
+		case *VarRef:
+			if isTimeRef(expr) {
+				continue
+			}
+			raw = true
+			columns = append(columns, column{name: f.Name(), field: expr.Val})
+		case *Call:
+			aggregate = true
+			if _, ok := rateFuncs[expr.Name]; ok {
+				field, opts, err := rateOptions(expr)
+				if err != nil {
+					return nil, false, err
+				}
+				opts.Fill, opts.FillValue = stmt.Fill, stmt.FillValue
+				columns = append(columns, column{name: f.Name(), field: field, rate: &opts})
+				continue
+			}
+
+			field, opts, err := aggregateOptions(expr)
+			if err != nil {
+				return nil, false, err
+			}
+			opts.Fill, opts.FillValue = stmt.Fill, stmt.FillValue
+			columns = append(columns, column{name: f.Name(), field: field, agg: opts})
+		default:
+			return nil, false, fmt.Errorf("unsupported field expression %s", f.Expr)
+		}
+	}
+
+	if raw && aggregate {
+		return nil, false, fmt.Errorf("mixing aggregate and non-aggregate fields is not supported")
+	}
+	if stmt.GroupByInterval() > 0 && !aggregate {
+		return nil, false, fmt.Errorf("GROUP BY time requires an aggregate function")
+	}
+	if stmt.Fill != "" && stmt.GroupByInterval() == 0 {
+		return nil, false, fmt.Errorf("fill() requires GROUP BY time")
+	}
+	if len(columns) == 0 {
+		return nil, false, fmt.Errorf("at least one field must be selected")
+	}
+
+	return columns, aggregate, nil
+}
+
+// groupSeries groups series by the GROUP BY tags
+func groupSeries(stmt *SelectStatement, keys []storage.SeriesKey) []*seriesGroup {
+	groupKeys, all := stmt.GroupByTags()
+
+	groups := make(map[string]*seriesGroup)
+	for _, key := range keys {
+		var tags map[string]string
+		switch {
+		case all:
+			tags = key.Tags
+		case len(groupKeys) > 0:
+			tags = make(map[string]string, len(groupKeys))
+			for _, k := range groupKeys {
+				tags[k] = key.Tags[k]
+			}
+		}
+
+		id := tagSetID(tags)
+		group, ok := groups[id]
+		if !ok {
+			group = &seriesGroup{tags: tags, id: id}
+			groups[id] = group
+		}
+		group.series = append(group.series, key)
+	}
+
+	sorted := make([]*seriesGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].id < sorted[j].id
+	})
+
+	return sorted
+}
+
+// tagSetID returns a canonical string for a tag set
+func tagSetID(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf strings.Builder
+	for _, k := range keys {
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(tags[k])
+		buf.WriteByte(',')
+	}
+	return buf.String()
+}
+
+// readSamples reads the points of a single series within the time range
+func (e *Executor) readSamples(ctx context.Context, key storage.SeriesKey, tr TimeRange) ([]sample, error) {
+	points, err := e.storage.ReadSeries(ctx, key, tr.Start, tr.End, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]sample, 0, len(points))
+	for _, p := range points {
+		samples = append(samples, sample{Time: p.Timestamp.UTC(), Value: p.Fields[key.Field]})
+	}
+	return samples, nil
+}
+
+// newRow creates an empty row with the time column followed by the selected columns
+func newRow(name string, group *seriesGroup, columns []column) *Row {
+	row := &Row{
+		Name:    name,
+		Tags:    group.tags,
+		Columns: make([]string, 0, len(columns)+1),
+		Values:  [][]interface{}{},
+	}
+	row.Columns = append(row.Columns, "time")
+	for _, c := range columns {
+		row.Columns = append(row.Columns, c.name)
+	}
+	return row
+}
+
+// rawRow returns the selected field values of a group. Values of different
+// fields are merged into one row when they share a timestamp and tag set.
+func (e *Executor) rawRow(ctx context.Context, name string, group *seriesGroup, columns []column, tr TimeRange) (*Row, error) {
+	type rowKey struct {
+		ts   int64
+		tags string
+	}
+
+	rows := make(map[rowKey][]interface{})
+	for _, key := range group.series {
+		tags := tagSetID(key.Tags)
+		for i, c := range columns {
+			if key.Field != c.field {
+				continue
+			}
+
+			samples, err := e.readSamples(ctx, key, tr)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range samples {
+				rk := rowKey{ts: s.Time.UnixNano(), tags: tags}
+				values, ok := rows[rk]
+				if !ok {
+					values = make([]interface{}, len(columns)+1)
+					values[0] = s.Time
+					rows[rk] = values
+				}
+				values[i+1] = s.Value
+			}
+		}
+	}
+
+	keys := make([]rowKey, 0, len(rows))
+	for rk := range rows {
+		keys = append(keys, rk)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ts != keys[j].ts {
+			return keys[i].ts < keys[j].ts
+		}
+		return keys[i].tags < keys[j].tags
+	})
+
+	row := newRow(name, group, columns)
+	for _, rk := range keys {
+		row.Values = append(row.Values, rows[rk])
+	}
+	return row, nil
+}
+
+// aggregateRow applies the aggregate columns to a group, one row per time
+// window. The aggregation itself is pushed down to the storage engine.
+func (e *Executor) aggregateRow(ctx context.Context, name string, group *seriesGroup, columns []column, tr TimeRange, interval time.Duration) (*Row, error) {
+	windows := make(map[int64][]interface{})
+	for i, c := range columns {
+		var keys []storage.SeriesKey
+		for _, key := range group.series {
+			if key.Field == c.field {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		aggregates, err := e.aggregateColumn(ctx, keys, c.agg, c.rate, tr, interval)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, a := range aggregates {
+			ws := a.Start.UnixNano()
+			// Without GROUP BY time and a lower bound the single window starts at
+			// the epoch, derivatives keep the timestamps of their points
+			if interval == 0 && tr.IsZeroStart() && (c.rate == nil || c.rate.Function.Windowed()) {
+				ws = 0
+			}
+			values, ok := windows[ws]
+			if !ok {
+				values = make([]interface{}, len(columns)+1)
+				values[0] = time.Unix(0, ws).UTC()
+				windows[ws] = values
+			}
+			// Windows filled with null keep a nil value
+			if !a.Null {
+				values[i+1] = a.Value
+			}
+		}
+	}
+
+	starts := make([]int64, 0, len(windows))
+	for ws := range windows {
+		starts = append(starts, ws)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	row := newRow(name, group, columns)
+	for _, ws := range starts {
+		row.Values = append(row.Values, windows[ws])
+	}
+	return row, nil
+}
+
+// aggregateColumn computes an aggregate, or a rate function when rate is set,
+// over a set of series. Both are pushed down to the storage engine, and
+// aggregates are read from rollups where continuous queries computed them.
+func (e *Executor) aggregateColumn(ctx context.Context, keys []storage.SeriesKey, agg storage.AggregateOptions, rate *storage.RateOptions, tr TimeRange, interval time.Duration) ([]storage.WindowAggregate, error) {
+	if rate != nil {
+		opts := *rate
+		opts.Window = interval
+		return e.storage.RateSeries(ctx, keys, tr.Start, tr.End, opts)
+	}
+
+	agg.Window = interval
+	parts := planAggregate(e.storage.ContinuousQueries(), keys, agg, rate, tr, interval)
+	if len(parts) == 1 && parts[0].rollup == nil {
+		return e.storage.AggregateSeries(ctx, keys, tr.Start, tr.End, agg)
+	}
+	return e.readPlan(ctx, keys, agg, parts, tr)
+}
+
+// applyOrderAndLimit applies ORDER BY, OFFSET and LIMIT to a row set
+func applyOrderAndLimit(row *Row, stmt *SelectStatement) {
+	if !stmt.Ascending {
+		for i, j := 0, len(row.Values)-1; i < j; i, j = i+1, j-1 {
+			row.Values[i], row.Values[j] = row.Values[j], row.Values[i]
+		}
+	}
+
+	applyLimit(row, stmt.Limit, stmt.Offset)
+}
+
+// applyLimit skips the first offset values of a row and keeps at most limit of the rest
+func applyLimit(row *Row, limit, offset int) {
+	if offset > 0 {
+		if offset >= len(row.Values) {
+			row.Values = row.Values[:0]
+		} else {
+			row.Values = row.Values[offset:]
+		}
+	}
+
+	if limit > 0 && len(row.Values) > limit {
+		row.Values = row.Values[:limit]
+	}
+}
@@ -0,0 +1,915 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/storage"
+	"timeseriesdb/internal/types"
+)
+
+func init() {
+	logger.Init()
+}
+
+// baseTime is the timestamp of the first point written by newTestExecutor
+var baseTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestExecutor creates an executor over a storage seeded with cpu points
+// for two hosts, one point per minute for ten minutes
+func newTestExecutor(t *testing.T) *Executor {
+	t.Helper()
+
+	s := storage.NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	t.Cleanup(func() { s.Close() })
+
+	hosts := []struct {
+		host   string
+		region string
+		offset float64
+	}{
+		{"server01", "us-west", 0},
+		{"server02", "us-east", 100},
+	}
+	for _, h := range hosts {
+		for i := 0; i < 10; i++ {
+			err := s.WritePoint(context.Background(), types.Point{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host": h.host, "region": h.region},
+				Fields:      map[string]interface{}{"usage": h.offset + float64(i), "idle": 100 - float64(i)},
+				Timestamp:   baseTime.Add(time.Duration(i) * time.Minute),
+			})
+			if err != nil {
+				t.Fatalf("Failed to write point: %v", err)
+			}
+		}
+	}
+
+	e := NewExecutor(s.Database)
+	e.now = func() time.Time { return baseTime.Add(time.Hour) }
+	return e
+}
+
+func TestExecuteRawQuery(t *testing.T) {
+	e := newTestExecutor(t)
+
+	result, err := e.ExecuteQuery(context.Background(), "SELECT usage, idle FROM cpu WHERE host = 'server01' AND time >= '2024-01-01T00:05:00Z'")
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+
+	if len(result.Series) != 1 {
+		t.Fatalf("Expected 1 series, got %d", len(result.Series))
+	}
+	row := result.Series[0]
+	if row.Name != "cpu" {
+		t.Errorf("Expected name cpu, got %s", row.Name)
+	}
+	if len(row.Columns) != 3 || row.Columns[0] != "time" || row.Columns[1] != "usage" || row.Columns[2] != "idle" {
+		t.Errorf("Unexpected columns %v", row.Columns)
+	}
+	if len(row.Values) != 5 {
+		t.Fatalf("Expected 5 rows, got %d", len(row.Values))
+	}
+
+	first := row.Values[0]
+	if ts := first[0].(time.Time); !ts.Equal(baseTime.Add(5 * time.Minute)) {
+		t.Errorf("Expected first timestamp %v, got %v", baseTime.Add(5*time.Minute), ts)
+	}
+	if first[1] != 5.0 || first[2] != 95.0 {
+		t.Errorf("Expected values [5 95], got %v", first[1:])
+	}
+}
+
+func TestExecuteAggregateQuery(t *testing.T) {
+	e := newTestExecutor(t)
+
+	tests := []struct {
+		name  string
+		query string
+		want  float64
+	}{
+		{"count", "SELECT count(usage) FROM cpu", 20},
+		{"sum", "SELECT sum(usage) FROM cpu WHERE host = 'server01'", 45},
+		{"mean", "SELECT mean(usage) FROM cpu WHERE host = 'server01'", 4.5},
+		{"min", "SELECT min(usage) FROM cpu", 0},
+		{"max", "SELECT max(usage) FROM cpu", 109},
+		{"first", "SELECT first(usage) FROM cpu WHERE host = 'server02'", 100},
+		{"last", "SELECT last(usage) FROM cpu WHERE host = 'server02'", 109},
+		{"percentile", "SELECT percentile(usage, 90) FROM cpu WHERE host = 'server01'", 8},
+		{"percentile across series", "SELECT percentile(usage, 50) FROM cpu", 9},
+		{"regex condition", "SELECT count(usage) FROM cpu WHERE region =~ /^us-/", 20},
+		{"negated regex", "SELECT count(usage) FROM cpu WHERE host !~ /01$/", 10},
+		{"or condition", "SELECT count(usage) FROM cpu WHERE host = 'server01' OR host = 'server02'", 20},
+		{"indexed and residual condition", "SELECT count(usage) FROM cpu WHERE region =~ /^us-/ AND (host = 'server02' OR host = 'server03')", 10},
+		{"missing tag condition", "SELECT count(usage) FROM cpu WHERE zone = '' AND host != 'server02'", 10},
+		{"time bounds", "SELECT count(usage) FROM cpu WHERE time > '2024-01-01T00:02:00Z' AND time < '2024-01-01T00:04:00Z'", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := e.ExecuteQuery(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("ExecuteQuery failed: %v", err)
+			}
+			if len(result.Series) != 1 || len(result.Series[0].Values) != 1 {
+				t.Fatalf("Expected a single row, got %+v", result.Series)
+			}
+			if got := result.Series[0].Values[0][1]; got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExecuteStddev(t *testing.T) {
+	e := newTestExecutor(t)
+
+	result, err := e.ExecuteQuery(context.Background(), "SELECT stddev(usage) FROM cpu WHERE host = 'server01' GROUP BY time(5m)")
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(result.Series) != 1 || len(result.Series[0].Values) != 2 {
+		t.Fatalf("Expected 2 windows, got %+v", result.Series)
+	}
+
+	// Each window holds five consecutive integers
+	want := math.Sqrt(2.5)
+	for _, values := range result.Series[0].Values {
+		if got := values[1].(float64); math.Abs(got-want) > 1e-9 {
+			t.Errorf("Expected stddev %v, got %v", want, got)
+		}
+	}
+}
+
+func TestExecuteGroupBy(t *testing.T) {
+	e := newTestExecutor(t)
+
+	result, err := e.ExecuteQuery(context.Background(), "SELECT max(usage) AS peak FROM cpu WHERE time >= '2024-01-01T00:00:00Z' GROUP BY time(5m), host")
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+
+	if len(result.Series) != 2 {
+		t.Fatalf("Expected 2 series, got %d", len(result.Series))
+	}
+	for i, host := range []string{"server01", "server02"} {
+		row := result.Series[i]
+		if row.Tags["host"] != host {
+			t.Errorf("Expected series %d to have host %s, got %v", i, host, row.Tags)
+		}
+		if row.Columns[1] != "peak" {
+			t.Errorf("Expected column peak, got %s", row.Columns[1])
+		}
+		if len(row.Values) != 2 {
+			t.Fatalf("Expected 2 windows, got %d", len(row.Values))
+		}
+		if ts := row.Values[1][0].(time.Time); !ts.Equal(baseTime.Add(5 * time.Minute)) {
+			t.Errorf("Expected second window at %v, got %v", baseTime.Add(5*time.Minute), ts)
+		}
+	}
+
+	if got := result.Series[1].Values[0][1]; got != 104.0 {
+		t.Errorf("Expected server02 first window max 104, got %v", got)
+	}
+}
+
+func TestExecuteFill(t *testing.T) {
+	e := newTestExecutor(t)
+
+	// Leave a gap at minutes 4 and 5
+	if _, err := e.storage.Delete(context.Background(), storage.SeriesFilter{Measurement: "cpu", Start: baseTime.Add(4 * time.Minute), End: baseTime.Add(5 * time.Minute)}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	const selection = " FROM cpu WHERE host = 'server01' AND time >= '2023-12-31T23:59:00Z' AND time <= '2024-01-01T00:10:00Z' GROUP BY time(1m)"
+	tests := []struct {
+		query string
+		want  []interface{}
+	}{
+		{"SELECT mean(usage)" + selection, []interface{}{0.0, 1.0, 2.0, 3.0, 6.0, 7.0, 8.0, 9.0}},
+		{"SELECT mean(usage)" + selection + " fill(none)", []interface{}{0.0, 1.0, 2.0, 3.0, 6.0, 7.0, 8.0, 9.0}},
+		{"SELECT mean(usage)" + selection + " fill(null)", []interface{}{nil, 0.0, 1.0, 2.0, 3.0, nil, nil, 6.0, 7.0, 8.0, 9.0, nil}},
+		{"SELECT mean(usage)" + selection + " fill(-1)", []interface{}{-1.0, 0.0, 1.0, 2.0, 3.0, -1.0, -1.0, 6.0, 7.0, 8.0, 9.0, -1.0}},
+		{"SELECT mean(usage)" + selection + " fill(previous)", []interface{}{nil, 0.0, 1.0, 2.0, 3.0, 3.0, 3.0, 6.0, 7.0, 8.0, 9.0, 9.0}},
+		{"SELECT mean(usage)" + selection + " fill(linear)", []interface{}{nil, 0.0, 1.0, 2.0, 3.0, 4.0, 5.0, 6.0, 7.0, 8.0, 9.0, nil}},
+		{"SELECT count(usage)" + selection + " fill(null)", []interface{}{0.0, 1.0, 1.0, 1.0, 1.0, 0.0, 0.0, 1.0, 1.0, 1.0, 1.0, 0.0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result, err := e.ExecuteQuery(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("ExecuteQuery failed: %v", err)
+			}
+			if len(result.Series) != 1 {
+				t.Fatalf("Expected 1 series, got %d", len(result.Series))
+			}
+
+			var got []interface{}
+			for _, values := range result.Series[0].Values {
+				got = append(got, values[1])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got values %v, want %v", got, tt.want)
+			}
+			if ts := result.Series[0].Values[0][0].(time.Time); len(tt.want) == 12 && !ts.Equal(baseTime.Add(-time.Minute)) {
+				t.Errorf("Expected the first window at %v, got %v", baseTime.Add(-time.Minute), ts)
+			}
+		})
+	}
+}
+
+func TestExecuteRateFunctions(t *testing.T) {
+	e := newTestExecutor(t)
+
+	at := func(minutes int) time.Time { return baseTime.Add(time.Duration(minutes) * time.Minute) }
+	tests := []struct {
+		name      string
+		query     string
+		wantTimes []time.Time
+		want      []interface{}
+	}{
+		{
+			"derivative keeps the point timestamps",
+			"SELECT derivative(usage, 1m) FROM cpu WHERE host = 'server01' AND time <= '2024-01-01T00:03:00Z'",
+			[]time.Time{at(1), at(2), at(3)},
+			[]interface{}{1.0, 1.0, 1.0},
+		},
+		{
+			"increase over the range",
+			"SELECT increase(usage) FROM cpu WHERE host = 'server01' AND time >= '2024-01-01T00:00:00Z' AND time <= '2024-01-01T00:09:00Z'",
+			[]time.Time{at(0)},
+			[]interface{}{9.0},
+		},
+		{
+			"rate summed over hosts per window",
+			"SELECT rate(usage, 1m) FROM cpu WHERE time >= '2024-01-01T00:00:00Z' AND time <= '2024-01-01T00:10:00Z' GROUP BY time(5m)",
+			[]time.Time{at(0), at(5)},
+			[]interface{}{2.0, 2.0},
+		},
+		{
+			"rate in an expression",
+			"SELECT non_negative_derivative(usage, 1m) + 1 FROM cpu WHERE host = 'server01' AND time <= '2024-01-01T00:03:00Z'",
+			[]time.Time{at(1), at(2), at(3)},
+			[]interface{}{2.0, 2.0, 2.0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := e.ExecuteQuery(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("ExecuteQuery failed: %v", err)
+			}
+			if len(result.Series) != 1 {
+				t.Fatalf("Expected 1 series, got %s", formatRows(result.Series))
+			}
+			if got := columnValues(result.Series[0], 1); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got values %v, want %v", got, tt.want)
+			}
+			for i, values := range result.Series[0].Values {
+				if ts := values[0].(time.Time); i < len(tt.wantTimes) && !ts.Equal(tt.wantTimes[i]) {
+					t.Errorf("Row %d at %v, want %v", i, ts, tt.wantTimes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteTop(t *testing.T) {
+	e := newTestExecutor(t)
+
+	// A third host peaks above the others once, with a mean between theirs
+	for i, usage := range []float64{0, 200, 0} {
+		if err := e.storage.WritePoint(context.Background(), types.Point{
+			Measurement: "cpu",
+			Tags:        map[string]string{"host": "server03", "region": "us-west"},
+			Fields:      map[string]interface{}{"usage": usage},
+			Timestamp:   baseTime.Add(time.Duration(i) * time.Minute),
+		}); err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		columns []string
+		want    [][]interface{}
+	}{
+		{
+			"top points",
+			"SELECT top(usage, 3) FROM cpu",
+			[]string{"time", "top", "host", "region"},
+			[][]interface{}{
+				{baseTime.Add(time.Minute), 200.0, "server03", "us-west"},
+				{baseTime.Add(9 * time.Minute), 109.0, "server02", "us-east"},
+				{baseTime.Add(8 * time.Minute), 108.0, "server02", "us-east"},
+			},
+		},
+		{
+			"top point per host",
+			"SELECT top(usage, host, 2) AS peak FROM cpu",
+			[]string{"time", "peak", "host"},
+			[][]interface{}{
+				{baseTime.Add(time.Minute), 200.0, "server03"},
+				{baseTime.Add(9 * time.Minute), 109.0, "server02"},
+			},
+		},
+		{
+			"hosts by mean",
+			"SELECT top(mean(usage), host, 2) FROM cpu WHERE time >= '2024-01-01T00:00:00Z'",
+			[]string{"time", "top", "host"},
+			[][]interface{}{
+				{baseTime, 104.5, "server02"},
+				{baseTime, 200.0 / 3, "server03"},
+			},
+		},
+		{
+			"bottom hosts by max",
+			"SELECT bottom(max(usage), host, 1) FROM cpu",
+			[]string{"time", "bottom", "host"},
+			[][]interface{}{
+				{time.Unix(0, 0).UTC(), 9.0, "server01"},
+			},
+		},
+		{
+			"limit and offset",
+			"SELECT top(usage, host, 3) FROM cpu LIMIT 1 OFFSET 1",
+			[]string{"time", "top", "host"},
+			[][]interface{}{
+				{baseTime.Add(9 * time.Minute), 109.0, "server02"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := e.ExecuteQuery(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("ExecuteQuery failed: %v", err)
+			}
+			if len(result.Series) != 1 {
+				t.Fatalf("Expected 1 series, got %s", formatRows(result.Series))
+			}
+			row := result.Series[0]
+			if !reflect.DeepEqual(row.Columns, tt.columns) {
+				t.Errorf("Expected columns %v, got %v", tt.columns, row.Columns)
+			}
+			if !reflect.DeepEqual(row.Values, tt.want) {
+				t.Errorf("Got values %v, want %v", row.Values, tt.want)
+			}
+		})
+	}
+
+	// Each GROUP BY group is ranked on its own
+	result, err := e.ExecuteQuery(context.Background(), "SELECT top(usage, host, 1) FROM cpu GROUP BY region")
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(result.Series) != 2 || result.Series[0].Values[0][2] != "server02" || result.Series[1].Values[0][2] != "server03" {
+		t.Errorf("Unexpected series %s", formatRows(result.Series))
+	}
+}
+
+// columnValues returns the values of a column of a row
+func columnValues(row *Row, column int) []interface{} {
+	var values []interface{}
+	for _, v := range row.Values {
+		values = append(values, v[column])
+	}
+	return values
+}
+
+func TestExecuteExpressions(t *testing.T) {
+	e := newTestExecutor(t)
+
+	tests := []struct {
+		name    string
+		query   string
+		columns []string
+		want    []interface{}
+	}{
+		{
+			"field arithmetic",
+			"SELECT usage / (usage + idle) * 100 FROM cpu WHERE host = 'server01' AND time <= '2024-01-01T00:02:00Z'",
+			[]string{"time", "usage / (usage + idle) * 100"},
+			[]interface{}{0.0, 1.0, 2.0},
+		},
+		{
+			"alias and modulo",
+			"SELECT usage % 3 AS rest FROM cpu WHERE host = 'server01' AND time >= '2024-01-01T00:03:00Z' AND time <= '2024-01-01T00:05:00Z'",
+			[]string{"time", "rest"},
+			[]interface{}{0.0, 1.0, 2.0},
+		},
+		{
+			"math functions",
+			"SELECT pow(usage, 2) + sqrt(usage) FROM cpu WHERE host = 'server01' AND time >= '2024-01-01T00:04:00Z' AND time <= '2024-01-01T00:04:00Z'",
+			[]string{"time", "pow(usage, 2) + sqrt(usage)"},
+			[]interface{}{18.0},
+		},
+		{
+			"division by zero is null",
+			"SELECT idle / usage FROM cpu WHERE host = 'server01' AND time <= '2024-01-01T00:00:00Z'",
+			[]string{"time", "idle / usage"},
+			[]interface{}{nil},
+		},
+		{
+			"aggregate arithmetic",
+			"SELECT max(usage) - min(usage) AS spread FROM cpu WHERE host = 'server01' AND time >= '2024-01-01T00:00:00Z' AND time < '2024-01-01T00:10:00Z' GROUP BY time(5m)",
+			[]string{"time", "spread"},
+			[]interface{}{4.0, 4.0},
+		},
+		{
+			"aggregate with fill",
+			"SELECT sum(usage) * 2 FROM cpu WHERE host = 'server01' AND time >= '2024-01-01T00:00:00Z' AND time < '2024-01-01T00:15:00Z' GROUP BY time(5m) fill(null)",
+			[]string{"time", "sum(usage) * 2"},
+			[]interface{}{20.0, 70.0, nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := e.ExecuteQuery(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("ExecuteQuery failed: %v", err)
+			}
+			if len(result.Series) != 1 {
+				t.Fatalf("Expected 1 series, got %s", formatRows(result.Series))
+			}
+			row := result.Series[0]
+			if !reflect.DeepEqual(row.Columns, tt.columns) {
+				t.Errorf("Expected columns %v, got %v", tt.columns, row.Columns)
+			}
+			if got := columnValues(row, 1); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got values %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteJoin(t *testing.T) {
+	e := newTestExecutor(t)
+
+	// Difference between two hosts, paired on no tag at all
+	result, err := e.ExecuteQuery(context.Background(), "SELECT b.usage - a.usage AS diff FROM cpu AS a, cpu AS b WHERE a.host = 'server01' AND b.host = 'server02' AND time < '2024-01-01T00:03:00Z' MATCH ON ()")
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(result.Series) != 1 {
+		t.Fatalf("Expected 1 series, got %s", formatRows(result.Series))
+	}
+	row := result.Series[0]
+	if row.Name != "a,b" || len(row.Tags) != 0 {
+		t.Errorf("Expected series a,b without tags, got %s %v", row.Name, row.Tags)
+	}
+	if got, want := columnValues(row, 1), []interface{}{100.0, 100.0, 100.0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got values %v, want %v", got, want)
+	}
+
+	// Series are paired on their tags by default
+	if err := e.storage.WritePoint(context.Background(), types.Point{
+		Measurement: "disk",
+		Tags:        map[string]string{"host": "server01", "region": "us-west"},
+		Fields:      map[string]interface{}{"used": 25.0, "total": 200.0},
+		Timestamp:   baseTime,
+	}); err != nil {
+		t.Fatalf("Failed to write point: %v", err)
+	}
+	result, err = e.ExecuteQuery(context.Background(), "SELECT used / total * 100, usage FROM disk, cpu")
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(result.Series) != 1 {
+		t.Fatalf("Expected 1 series, got %s", formatRows(result.Series))
+	}
+	row = result.Series[0]
+	if row.Name != "disk,cpu" || row.Tags["host"] != "server01" {
+		t.Errorf("Expected series disk,cpu of server01, got %s %v", row.Name, row.Tags)
+	}
+	if len(row.Values) != 10 || row.Values[0][1] != 12.5 || row.Values[0][2] != 0.0 || row.Values[1][1] != nil {
+		t.Errorf("Unexpected values %v", row.Values)
+	}
+
+	// Tags that differ between the sources are ignored for pairing
+	result, err = e.ExecuteQuery(context.Background(), "SELECT a.usage + b.usage FROM cpu AS a, cpu AS b WHERE a.region = 'us-west' AND b.region = 'us-east' AND time < '2024-01-01T00:01:00Z' MATCH IGNORING (host, region)")
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(result.Series) != 1 || result.Series[0].Values[0][1] != 100.0 {
+		t.Errorf("Unexpected series %s", formatRows(result.Series))
+	}
+}
+
+func TestExecuteTolerance(t *testing.T) {
+	e := newTestExecutor(t)
+
+	// mem points lag the cpu points by ten seconds
+	for i := 0; i < 3; i++ {
+		if err := e.storage.WritePoint(context.Background(), types.Point{
+			Measurement: "mem",
+			Tags:        map[string]string{"host": "server01"},
+			Fields:      map[string]interface{}{"free": float64(i * 10)},
+			Timestamp:   baseTime.Add(time.Duration(i)*time.Minute + 10*time.Second),
+		}); err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+
+	const query = "SELECT c.usage + m.free FROM cpu AS c, mem AS m WHERE c.host = 'server01' MATCH ON (host)"
+	result, err := e.ExecuteQuery(context.Background(), query)
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(result.Series) != 0 {
+		t.Errorf("Expected no exact matches, got %s", formatRows(result.Series))
+	}
+
+	result, err = e.ExecuteQuery(context.Background(), query+" TOLERANCE 15s")
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(result.Series) != 1 {
+		t.Fatalf("Expected 1 series, got %s", formatRows(result.Series))
+	}
+	if got, want := columnValues(result.Series[0], 1), []interface{}{0.0, 11.0, 22.0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got values %v, want %v", got, want)
+	}
+	if ts := result.Series[0].Values[1][0].(time.Time); !ts.Equal(baseTime.Add(time.Minute)) {
+		t.Errorf("Expected rows at the timestamps of the first operand, got %v", ts)
+	}
+}
+
+func TestExecuteOrderAndLimit(t *testing.T) {
+	e := newTestExecutor(t)
+
+	result, err := e.ExecuteQuery(context.Background(), "SELECT usage FROM cpu WHERE host = 'server01' ORDER BY time DESC LIMIT 3 OFFSET 1")
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+
+	values := result.Series[0].Values
+	if len(values) != 3 {
+		t.Fatalf("Expected 3 rows, got %d", len(values))
+	}
+	for i, want := range []float64{8, 7, 6} {
+		if values[i][1] != want {
+			t.Errorf("Row %d: expected %v, got %v", i, want, values[i][1])
+		}
+	}
+}
+
+func TestExecuteNoData(t *testing.T) {
+	e := newTestExecutor(t)
+
+	result, err := e.ExecuteQuery(context.Background(), "SELECT usage FROM mem")
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(result.Series) != 0 {
+		t.Errorf("Expected no series, got %d", len(result.Series))
+	}
+}
+
+func TestExecuteTypedFields(t *testing.T) {
+	e := newTestExecutor(t)
+	for i, up := range []bool{true, false} {
+		err := e.storage.WritePoint(context.Background(), types.Point{
+			Measurement: "status",
+			Tags:        map[string]string{"host": "server01"},
+			Fields:      map[string]interface{}{"up": up, "code": int64(200 + i), "message": "ok"},
+			Timestamp:   baseTime.Add(time.Duration(i) * time.Minute),
+		})
+		if err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+
+	result, err := e.ExecuteQuery(context.Background(), "SELECT up, code, message FROM status")
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	wantValues := [][]interface{}{
+		{baseTime, true, int64(200), "ok"},
+		{baseTime.Add(time.Minute), false, int64(201), "ok"},
+	}
+	if len(result.Series) != 1 || !reflect.DeepEqual(result.Series[0].Values, wantValues) {
+		t.Errorf("Unexpected raw result %s", formatRows(result.Series))
+	}
+
+	result, err = e.ExecuteQuery(context.Background(), "SELECT count(message), sum(code) FROM status")
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	if len(result.Series) != 1 || !reflect.DeepEqual(result.Series[0].Values[0][1:], []interface{}{2.0, 401.0}) {
+		t.Errorf("Unexpected aggregate result %s", formatRows(result.Series))
+	}
+
+	result, err = e.ExecuteQuery(context.Background(), "SHOW FIELD KEYS FROM status")
+	if err != nil {
+		t.Fatalf("ExecuteQuery failed: %v", err)
+	}
+	want := []*Row{{Name: "status", Columns: []string{"fieldKey", "fieldType"}, Values: [][]interface{}{
+		{"code", "integer"}, {"message", "string"}, {"up", "boolean"},
+	}}}
+	if !reflect.DeepEqual(result.Series, want) {
+		t.Errorf("SHOW FIELD KEYS = %s, want %s", formatRows(result.Series), formatRows(want))
+	}
+
+	_, err = e.ExecuteQuery(context.Background(), "SELECT mean(message) FROM status")
+	if !errors.IsType(err, errors.ErrorTypeValidation) {
+		t.Errorf("mean(message) returned %v, want a validation error", err)
+	}
+}
+
+func TestExecuteShow(t *testing.T) {
+	e := newTestExecutor(t)
+	err := e.storage.WritePoint(context.Background(), types.Point{
+		Measurement: "mem",
+		Tags:        map[string]string{"host": "server01"},
+		Fields:      map[string]interface{}{"free": 1.0},
+		Timestamp:   baseTime.Add(30 * time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("Failed to write point: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []*Row
+	}{
+		{
+			name:  "measurements",
+			query: "SHOW MEASUREMENTS",
+			want:  []*Row{{Name: "measurements", Columns: []string{"name"}, Values: [][]interface{}{{"cpu"}, {"mem"}}}},
+		},
+		{
+			name:  "measurements by tag",
+			query: "SHOW MEASUREMENTS WHERE region = 'us-east'",
+			want:  []*Row{{Name: "measurements", Columns: []string{"name"}, Values: [][]interface{}{{"cpu"}}}},
+		},
+		{
+			name:  "measurements by time",
+			query: "SHOW MEASUREMENTS WHERE time >= '2024-01-01T00:20:00Z'",
+			want:  []*Row{{Name: "measurements", Columns: []string{"name"}, Values: [][]interface{}{{"mem"}}}},
+		},
+		{
+			name:  "tag keys",
+			query: "SHOW TAG KEYS",
+			want: []*Row{
+				{Name: "cpu", Columns: []string{"tagKey"}, Values: [][]interface{}{{"host"}, {"region"}}},
+				{Name: "mem", Columns: []string{"tagKey"}, Values: [][]interface{}{{"host"}}},
+			},
+		},
+		{
+			name:  "tag values",
+			query: `SHOW TAG VALUES FROM cpu WITH KEY = "host"`,
+			want: []*Row{
+				{Name: "cpu", Columns: []string{"key", "value"}, Values: [][]interface{}{{"host", "server01"}, {"host", "server02"}}},
+			},
+		},
+		{
+			name:  "tag values with condition",
+			query: "SHOW TAG VALUES WITH KEY IN (host, region) WHERE region =~ /west/ OR host = 'server01'",
+			want: []*Row{
+				{Name: "cpu", Columns: []string{"key", "value"}, Values: [][]interface{}{{"host", "server01"}, {"region", "us-west"}}},
+				{Name: "mem", Columns: []string{"key", "value"}, Values: [][]interface{}{{"host", "server01"}}},
+			},
+		},
+		{
+			name:  "field keys",
+			query: "SHOW FIELD KEYS FROM cpu",
+			want: []*Row{
+				{Name: "cpu", Columns: []string{"fieldKey", "fieldType"}, Values: [][]interface{}{{"idle", "float"}, {"usage", "float"}}},
+			},
+		},
+		{
+			name:  "series",
+			query: "SHOW SERIES WHERE host = 'server01'",
+			want: []*Row{
+				{Columns: []string{"key"}, Values: [][]interface{}{{"cpu,host=server01,region=us-west"}, {"mem,host=server01"}}},
+			},
+		},
+		{
+			name:  "series limit",
+			query: "SHOW SERIES FROM cpu LIMIT 1 OFFSET 1",
+			want: []*Row{
+				{Columns: []string{"key"}, Values: [][]interface{}{{"cpu,host=server02,region=us-east"}}},
+			},
+		},
+		{
+			name:  "no match",
+			query: "SHOW SERIES FROM disk",
+			want:  []*Row{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := e.ExecuteQuery(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("ExecuteQuery(%q) failed: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(result.Series, tt.want) {
+				t.Errorf("ExecuteQuery(%q) = %s, want %s", tt.query, formatRows(result.Series), formatRows(tt.want))
+			}
+		})
+	}
+}
+
+// formatRows renders rows for test failure messages
+func formatRows(rows []*Row) string {
+	parts := make([]string, len(rows))
+	for i, row := range rows {
+		parts[i] = fmt.Sprintf("%+v", *row)
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// newRollupExecutor returns a test executor whose cpu points of the first six
+// minutes are rolled up by 2m sum and count continuous queries, after which
+// the raw points of the first four minutes are deleted. Windows still
+// holding values there were read from the rollups.
+func newRollupExecutor(t *testing.T) *Executor {
+	t.Helper()
+
+	e := newTestExecutor(t)
+	ctx := context.Background()
+	for _, cq := range []storage.ContinuousQuery{
+		{Name: "cpu_2m_sum", Source: "cpu", Target: "cpu_2m_sum", Function: storage.AggregateSum, Interval: 2 * time.Minute, For: 10 * time.Minute},
+		{Name: "cpu_2m_count", Source: "cpu", Target: "cpu_2m_count", Function: storage.AggregateCount, Interval: 2 * time.Minute, For: 10 * time.Minute},
+	} {
+		if err := e.storage.CreateContinuousQuery(cq); err != nil {
+			t.Fatalf("CreateContinuousQuery failed: %v", err)
+		}
+	}
+	if _, err := e.storage.RunContinuousQueries(ctx, baseTime.Add(6*time.Minute)); err != nil {
+		t.Fatalf("RunContinuousQueries failed: %v", err)
+	}
+	if _, err := e.storage.Delete(ctx, storage.SeriesFilter{Measurement: "cpu", Start: baseTime, End: baseTime.Add(3 * time.Minute)}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	return e
+}
+
+func TestExecuteRollups(t *testing.T) {
+	e := newRollupExecutor(t)
+
+	const selection = " FROM cpu WHERE time >= '2024-01-01T00:00:00Z' AND time < '2024-01-01T00:10:00Z'"
+	tests := []struct {
+		query string
+		want  []interface{}
+	}{
+		// Windows before 6m are read from the sum and count rollups, the rest
+		// from raw points
+		{"SELECT mean(usage)" + selection + " AND host = 'server01' GROUP BY time(2m)", []interface{}{0.5, 2.5, 4.5, 6.5, 8.5}},
+		{"SELECT sum(usage)" + selection + " GROUP BY time(4m)", []interface{}{412.0, 444.0, 234.0}},
+		{"SELECT count(usage)" + selection + " GROUP BY time(4m)", []interface{}{8.0, 8.0, 4.0}},
+		{"SELECT sum(usage) * 2" + selection + " AND host = 'server01' GROUP BY time(4m)", []interface{}{12.0, 44.0, 34.0}},
+		// Windows narrower than the rollups, functions the rollups cannot
+		// compute and queries without GROUP BY time read raw points
+		{"SELECT sum(usage)" + selection + " AND host = 'server01' GROUP BY time(1m)", []interface{}{4.0, 5.0, 6.0, 7.0, 8.0, 9.0}},
+		{"SELECT max(usage)" + selection + " AND host = 'server01' GROUP BY time(2m)", []interface{}{5.0, 7.0, 9.0}},
+		{"SELECT sum(usage)" + selection + " AND host = 'server01'", []interface{}{39.0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result, err := e.ExecuteQuery(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("ExecuteQuery failed: %v", err)
+			}
+			if len(result.Series) != 1 {
+				t.Fatalf("Expected 1 series, got %d", len(result.Series))
+			}
+			if got := columnValues(result.Series[0], 1); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Got values %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteExplain(t *testing.T) {
+	e := newRollupExecutor(t)
+
+	at := func(d time.Duration) interface{} { return baseTime.Add(d) }
+	tests := []struct {
+		query string
+		want  [][]interface{}
+	}{
+		{
+			"EXPLAIN SELECT mean(usage) FROM cpu WHERE host = 'server01' AND time >= '2023-12-31T23:50:00Z' AND time < '2024-01-01T00:10:00Z' GROUP BY time(2m)",
+			[][]interface{}{
+				{"mean", "raw", "cpu", at(-10 * time.Minute), at(-4*time.Minute - 1), "before the rolled up range"},
+				{"mean", "rollup", "cpu_2m_sum, cpu_2m_count", at(-4 * time.Minute), at(6*time.Minute - 1), "mean of 2m sum and count rollups of cpu_2m_sum and cpu_2m_count"},
+				{"mean", "raw", "cpu", at(6 * time.Minute), at(10*time.Minute - 1), "not rolled up yet"},
+			},
+		},
+		{
+			"EXPLAIN SELECT count(usage) FROM cpu WHERE time >= '2024-01-01T00:00:00Z' AND time < '2024-01-01T00:04:00Z' GROUP BY time(4m)",
+			[][]interface{}{
+				{"count", "rollup", "cpu_2m_count", at(0), at(4*time.Minute - 1), "sum of 2m count rollup of cpu_2m_count"},
+			},
+		},
+		{
+			"EXPLAIN SELECT stddev(usage) FROM cpu WHERE time >= '2024-01-01T00:00:00Z' AND time < '2024-01-01T00:10:00Z' GROUP BY time(2m)",
+			[][]interface{}{
+				{"stddev", "raw", "cpu", at(0), at(10*time.Minute - 1), "no rollup of cpu can compute stddev(usage) in 2m windows"},
+			},
+		},
+		{
+			"EXPLAIN SELECT usage FROM cpu",
+			[][]interface{}{
+				{"usage", "raw", "cpu", nil, nil, "raw points"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result, err := e.ExecuteQuery(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("ExecuteQuery failed: %v", err)
+			}
+			if len(result.Series) == 0 {
+				t.Fatal("Expected at least 1 series")
+			}
+			row := result.Series[0]
+			if !reflect.DeepEqual(row.Columns, explainColumns) {
+				t.Errorf("Got columns %v, want %v", row.Columns, explainColumns)
+			}
+			if !reflect.DeepEqual(row.Values, tt.want) {
+				t.Errorf("Got rows %v, want %v", row.Values, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	e := newTestExecutor(t)
+
+	queries := []string{
+		"SELECT FROM cpu",
+		"SELECT usage, mean(idle) FROM cpu",
+		"SELECT usage FROM cpu GROUP BY time(1m)",
+		"SELECT mean(usage) FROM cpu fill(null)",
+		"SELECT mean(usage) FROM cpu WHERE time >= '1970-01-01T00:00:00Z' GROUP BY time(1s) fill(null)",
+		"SELECT median(usage) FROM cpu",
+		"SELECT percentile(usage) FROM cpu",
+		"SELECT percentile(usage, 101) FROM cpu",
+		"SELECT derivative(usage) FROM cpu WHERE time >= '2024-01-01T00:00:00Z' GROUP BY time(1m)",
+		"SELECT increase(usage, 1m) FROM cpu",
+		"SELECT rate(usage, 5) FROM cpu",
+		"SELECT rate(1) FROM cpu",
+		"SELECT top(usage) FROM cpu",
+		"SELECT top(usage, 0) FROM cpu",
+		"SELECT top(usage, 'host', 3) FROM cpu",
+		"SELECT top(median(usage), 3) FROM cpu",
+		"SELECT top(usage, 3), idle FROM cpu",
+		"SELECT top(mean(usage), host, 3) FROM cpu WHERE time >= '2024-01-01T00:00:00Z' GROUP BY time(1m)",
+		"SELECT usage FROM cpu WHERE usage > 5",
+		"SELECT usage FROM cpu WHERE time > now() - 1h OR host = 'a'",
+		"SELECT usage FROM cpu WHERE time > '2024-01-02' AND time < '2024-01-01'",
+		"SELECT usage FROM cpu MATCH ON (host)",
+		"SELECT usage FROM cpu TOLERANCE 1s",
+		"SELECT usage * 2, mean(idle) + 1 FROM cpu",
+		"SELECT *, usage * 2 FROM cpu",
+		"SELECT time * 2 FROM cpu",
+		"SELECT 1 + 2 FROM cpu",
+		"SELECT sqrt(usage, 2) FROM cpu",
+		"SELECT usage * 2 FROM cpu GROUP BY time(1m)",
+		"SELECT mean(usage) * 2 FROM cpu WHERE time >= '2024-01-01T00:00:00Z' GROUP BY time(1m) TOLERANCE 1s",
+		"SELECT usage - usage FROM cpu, cpu",
+		"SELECT usage FROM cpu AS a, cpu AS b WHERE a.host = 'server01'",
+		"SELECT a.usage - c.usage FROM cpu AS a, cpu AS b",
+		"SELECT a.usage - b.usage FROM cpu AS a, cpu AS b WHERE a.host = b.host",
+		"SELECT a.usage FROM cpu AS a MATCH ON (host)",
+		"EXPLAIN SELECT usage * 2 FROM cpu",
+		"EXPLAIN SELECT top(usage, 3) FROM cpu",
+		"SHOW TAG KEYS WHERE host > 'a'",
+		"SHOW SERIES WHERE time > now() - 1h OR host = 'a'",
+	}
+
+	for _, q := range queries {
+		_, err := e.ExecuteQuery(context.Background(), q)
+		if err == nil {
+			t.Errorf("ExecuteQuery(%q) succeeded, want error", q)
+			continue
+		}
+		if !errors.IsType(err, errors.ErrorTypeValidation) {
+			t.Errorf("ExecuteQuery(%q) returned %v, want a validation error", q, err)
+		}
+	}
+}
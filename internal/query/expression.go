@@ -0,0 +1,713 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"timeseriesdb/internal/storage"
+)
+
+// mathFunc is a math function usable in SELECT expressions
+type mathFunc struct {
+	argc int
+	fn   func(args []float64) float64
+}
+
+// unaryMath wraps a single-argument math function
+func unaryMath(fn func(float64) float64) mathFunc {
+	return mathFunc{argc: 1, fn: func(args []float64) float64 { return fn(args[0]) }}
+}
+
+// mathFuncs maps the math functions supported in SELECT expressions
+var mathFuncs = map[string]mathFunc{
+	"abs":   unaryMath(math.Abs),
+	"ceil":  unaryMath(math.Ceil),
+	"floor": unaryMath(math.Floor),
+	"round": unaryMath(math.Round),
+	"sqrt":  unaryMath(math.Sqrt),
+	"exp":   unaryMath(math.Exp),
+	"ln":    unaryMath(math.Log),
+	"log2":  unaryMath(math.Log2),
+	"log10": unaryMath(math.Log10),
+	"sin":   unaryMath(math.Sin),
+	"cos":   unaryMath(math.Cos),
+	"tan":   unaryMath(math.Tan),
+	"pow":   {argc: 2, fn: func(args []float64) float64 { return math.Pow(args[0], args[1]) }},
+	"log":   {argc: 2, fn: func(args []float64) float64 { return math.Log(args[0]) / math.Log(args[1]) }},
+}
+
+// hasExpressions reports whether a SELECT computes expressions over its
+// fields or names its sources, rather than returning plain fields and
+// aggregates of each source
+func hasExpressions(stmt *SelectStatement) bool {
+	if len(stmt.Aliases) > 0 {
+		return true
+	}
+	for _, f := range stmt.Fields {
+		switch expr := f.Expr.(type) {
+		case *Wildcard:
+		case *VarRef:
+			if expr.Source != "" {
+				return true
+			}
+		case *Call:
+			if _, ok := mathFuncs[expr.Name]; ok {
+				return true
+			}
+			if len(expr.Args) > 0 {
+				if ref, ok := expr.Args[0].(*VarRef); ok && ref.Source != "" {
+					return true
+				}
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// exprSource is a measurement read by an expression query
+type exprSource struct {
+	// ref is the name expressions and conditions qualify references with:
+	// the alias of the source, or its measurement
+	ref    string
+	name   string
+	keys   []storage.SeriesKey
+	fields map[string]bool
+	cond   Expr
+}
+
+// exprLeaf is an operand of an expression read from storage: the values of a
+// field, or of an aggregate or rate function over a field when aggregated is set
+type exprLeaf struct {
+	source     *exprSource
+	field      string
+	aggregated bool
+	agg        storage.AggregateOptions
+	rate       *storage.RateOptions
+}
+
+// exprColumn is one selected expression and the operands it reads, in the
+// order they appear
+type exprColumn struct {
+	name   string
+	expr   Expr
+	leaves []Expr
+}
+
+// exprUnit is a set of series of one source whose values are evaluated
+// together: one tag set for raw fields, one GROUP BY group for aggregates
+type exprUnit struct {
+	tags map[string]string
+	keys []storage.SeriesKey
+}
+
+// exprJoin is a unit of every source paired by the matching rules
+type exprJoin struct {
+	tags  map[string]string
+	units map[*exprSource]*exprUnit
+}
+
+// exprPlan is a SELECT with expressions resolved against its sources
+type exprPlan struct {
+	sources   []*exprSource
+	columns   []exprColumn
+	leaves    map[Expr]*exprLeaf
+	aggregate bool
+}
+
+// executeExpressions runs a SELECT whose fields are expressions. The series
+// of every source are paired by tags, their points aligned on timestamps,
+// or on window starts for aggregates, and each expression is evaluated at
+// every timestamp where all of its operands have a value.
+func (e *Executor) executeExpressions(ctx context.Context, stmt *SelectStatement, tr TimeRange, tagCond Expr, interval time.Duration) (*Result, error) {
+	plan, err := e.planExpressions(stmt, tagCond, interval)
+	if err != nil {
+		return nil, asValidationError(err)
+	}
+
+	joins, err := plan.join(stmt)
+	if err != nil {
+		return nil, asValidationError(err)
+	}
+
+	name := plan.sources[0].name
+	if len(plan.sources) > 1 {
+		refs := make([]string, len(plan.sources))
+		for i, src := range plan.sources {
+			refs[i] = src.ref
+		}
+		name = strings.Join(refs, ",")
+	}
+
+	result := &Result{Series: []*Row{}}
+	for _, join := range joins {
+		data := make(map[Expr][]sample, len(plan.leaves))
+		for expr, leaf := range plan.leaves {
+			samples, err := e.readLeaf(ctx, leaf, join.units[leaf.source], tr, interval)
+			if err != nil {
+				return nil, err
+			}
+			data[expr] = samples
+		}
+
+		row, err := plan.evaluate(name, join.tags, data, stmt.Tolerance)
+		if err != nil {
+			return nil, asValidationError(err)
+		}
+		applyOrderAndLimit(row, stmt)
+		if len(row.Values) > 0 {
+			result.Series = append(result.Series, row)
+		}
+	}
+
+	return result, nil
+}
+
+// planExpressions resolves the sources, conditions and operands of an expression query
+func (e *Executor) planExpressions(stmt *SelectStatement, tagCond Expr, interval time.Duration) (*exprPlan, error) {
+	plan := &exprPlan{leaves: make(map[Expr]*exprLeaf)}
+
+	refs := make(map[string]*exprSource)
+	for i, name := range stmt.Sources {
+		src := &exprSource{ref: name, name: name}
+		if i < len(stmt.Aliases) && stmt.Aliases[i] != "" {
+			src.ref = stmt.Aliases[i]
+		}
+		if _, ok := refs[src.ref]; ok {
+			return nil, fmt.Errorf("source %s is listed twice, give each an alias with AS", src.ref)
+		}
+		refs[src.ref] = src
+
+		fields, err := e.sourceFields(name)
+		if err != nil {
+			return nil, err
+		}
+		src.fields = fields
+		plan.sources = append(plan.sources, src)
+	}
+
+	if err := splitSourceConditions(tagCond, plan.sources, refs); err != nil {
+		return nil, err
+	}
+	for _, src := range plan.sources {
+		if err := validateTagCondition(src.cond, src.fields); err != nil {
+			return nil, err
+		}
+		keys, err := e.findSeries(src.name, src.cond)
+		if err != nil {
+			return nil, err
+		}
+		src.keys = keys
+	}
+
+	raw := false
+	for _, f := range stmt.Fields {
+		if _, ok := f.Expr.(*Wildcard); ok {
+			return nil, fmt.Errorf("* cannot be combined with expressions")
+		}
+		if isTimeRef(f.Expr) {
+			continue
+		}
+
+		column := exprColumn{name: f.Name(), expr: f.Expr}
+		if err := plan.collectLeaves(f.Expr, &column, refs); err != nil {
+			return nil, err
+		}
+		if len(column.leaves) == 0 {
+			return nil, fmt.Errorf("expression %s does not read any field", f.Expr)
+		}
+		for _, leaf := range column.leaves {
+			if plan.leaves[leaf].aggregated {
+				plan.aggregate = true
+			} else {
+				raw = true
+			}
+		}
+		plan.columns = append(plan.columns, column)
+	}
+
+	switch {
+	case raw && plan.aggregate:
+		return nil, fmt.Errorf("mixing aggregate and non-aggregate fields is not supported")
+	case len(plan.columns) == 0:
+		return nil, fmt.Errorf("at least one field must be selected")
+	case interval > 0 && !plan.aggregate:
+		return nil, fmt.Errorf("GROUP BY time requires an aggregate function")
+	case stmt.Fill != "" && interval == 0:
+		return nil, fmt.Errorf("fill() requires GROUP BY time")
+	case stmt.Tolerance > 0 && plan.aggregate:
+		return nil, fmt.Errorf("TOLERANCE only applies to raw fields, aggregates are aligned on their windows")
+	case stmt.Matching != nil && len(plan.sources) < 2:
+		return nil, fmt.Errorf("MATCH requires several sources")
+	}
+
+	for _, leaf := range plan.leaves {
+		leaf.agg.Fill, leaf.agg.FillValue = stmt.Fill, stmt.FillValue
+		if leaf.rate != nil {
+			leaf.rate.Fill, leaf.rate.FillValue = stmt.Fill, stmt.FillValue
+		}
+	}
+
+	return plan, nil
+}
+
+// splitSourceConditions assigns the top-level AND terms of a tag condition to
+// the sources they apply to. Terms whose tag keys are qualified with a source
+// apply to that source only, and unqualified terms to every source.
+func splitSourceConditions(cond Expr, sources []*exprSource, refs map[string]*exprSource) error {
+	if cond == nil {
+		return nil
+	}
+
+	for _, term := range andTerms(cond) {
+		qualifiers := make(map[string]bool)
+		unqualified := false
+		collectQualifiers(term, qualifiers, &unqualified)
+
+		var targets []*exprSource
+		switch {
+		case len(qualifiers) == 0:
+			targets = sources
+		case len(qualifiers) == 1 && !unqualified:
+			for ref := range qualifiers {
+				src, ok := refs[ref]
+				if !ok {
+					return fmt.Errorf("unknown source %s in condition %s", ref, term)
+				}
+				targets = []*exprSource{src}
+			}
+		default:
+			return fmt.Errorf("condition %s must refer to a single source", term)
+		}
+
+		term = unqualify(term)
+		for _, src := range targets {
+			if src.cond == nil {
+				src.cond = term
+			} else {
+				src.cond = &BinaryExpr{Op: AND, LHS: src.cond, RHS: term}
+			}
+		}
+	}
+	return nil
+}
+
+// collectQualifiers records the sources the references of expr are qualified
+// with, and whether any reference is unqualified
+func collectQualifiers(expr Expr, qualifiers map[string]bool, unqualified *bool) {
+	switch e := expr.(type) {
+	case *VarRef:
+		if e.Source != "" {
+			qualifiers[e.Source] = true
+		} else {
+			*unqualified = true
+		}
+	case *ParenExpr:
+		collectQualifiers(e.Expr, qualifiers, unqualified)
+	case *BinaryExpr:
+		collectQualifiers(e.LHS, qualifiers, unqualified)
+		collectQualifiers(e.RHS, qualifiers, unqualified)
+	}
+}
+
+// unqualify returns a copy of a condition with the source qualifiers removed
+func unqualify(expr Expr) Expr {
+	switch e := expr.(type) {
+	case *VarRef:
+		return &VarRef{Val: e.Val}
+	case *ParenExpr:
+		return &ParenExpr{Expr: unqualify(e.Expr)}
+	case *BinaryExpr:
+		return &BinaryExpr{Op: e.Op, LHS: unqualify(e.LHS), RHS: unqualify(e.RHS)}
+	}
+	return expr
+}
+
+// collectLeaves validates an expression and records the fields and
+// aggregates it reads as operands of the column
+func (p *exprPlan) collectLeaves(expr Expr, column *exprColumn, refs map[string]*exprSource) error {
+	switch e := expr.(type) {
+	case *NumberLiteral, *IntegerLiteral:
+		return nil
+	case *ParenExpr:
+		return p.collectLeaves(e.Expr, column, refs)
+	case *BinaryExpr:
+		switch e.Op {
+		case ADD, SUB, MUL, DIV, MOD:
+		default:
+			return fmt.Errorf("unsupported operator %s in %s", e.Op, expr)
+		}
+		if err := p.collectLeaves(e.LHS, column, refs); err != nil {
+			return err
+		}
+		return p.collectLeaves(e.RHS, column, refs)
+	case *VarRef:
+		if isTimeRef(e) {
+			return fmt.Errorf("time cannot be used in an expression")
+		}
+		src, err := p.resolveSource(e, refs)
+		if err != nil {
+			return err
+		}
+		p.leaves[e] = &exprLeaf{source: src, field: e.Val}
+		column.leaves = append(column.leaves, e)
+		return nil
+	case *Call:
+		if fn, ok := mathFuncs[e.Name]; ok {
+			if len(e.Args) != fn.argc {
+				return fmt.Errorf("%s() expects %d argument(s), got %d", e.Name, fn.argc, len(e.Args))
+			}
+			for _, arg := range e.Args {
+				if err := p.collectLeaves(arg, column, refs); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		leaf := &exprLeaf{aggregated: true}
+		var err error
+		if _, ok := rateFuncs[e.Name]; ok {
+			var opts storage.RateOptions
+			leaf.field, opts, err = rateOptions(e)
+			leaf.rate = &opts
+		} else {
+			leaf.field, leaf.agg, err = aggregateOptions(e)
+		}
+		if err != nil {
+			return err
+		}
+		if leaf.source, err = p.resolveSource(e.Args[0].(*VarRef), refs); err != nil {
+			return err
+		}
+		p.leaves[e] = leaf
+		column.leaves = append(column.leaves, e)
+		return nil
+	}
+	return fmt.Errorf("unsupported expression %s", expr)
+}
+
+// resolveSource returns the source a field reference reads from: the one it
+// is qualified with, or otherwise the only source holding the field
+func (p *exprPlan) resolveSource(ref *VarRef, refs map[string]*exprSource) (*exprSource, error) {
+	if ref.Source != "" {
+		src, ok := refs[ref.Source]
+		if !ok {
+			return nil, fmt.Errorf("unknown source %s in %s", ref.Source, ref)
+		}
+		return src, nil
+	}
+	if len(p.sources) == 1 {
+		return p.sources[0], nil
+	}
+
+	var found *exprSource
+	for _, src := range p.sources {
+		if src.fields[ref.Val] {
+			if found != nil {
+				return nil, fmt.Errorf("field %s is ambiguous, qualify it with its source", ref.Val)
+			}
+			found = src
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("field %s is not held by any source", ref.Val)
+	}
+	return found, nil
+}
+
+// units splits the series of a source selected by its condition into units:
+// one per tag set for raw fields, and one per GROUP BY group for aggregates
+func (p *exprPlan) units(stmt *SelectStatement, src *exprSource) []*exprUnit {
+	var units []*exprUnit
+	if p.aggregate {
+		for _, group := range groupSeries(stmt, src.keys) {
+			units = append(units, &exprUnit{tags: group.tags, keys: group.series})
+		}
+		return units
+	}
+
+	byTags := make(map[string]*exprUnit)
+	var ids []string
+	for _, key := range src.keys {
+		id := tagSetID(key.Tags)
+		unit, ok := byTags[id]
+		if !ok {
+			unit = &exprUnit{tags: key.Tags}
+			byTags[id] = unit
+			ids = append(ids, id)
+		}
+		unit.keys = append(unit.keys, key)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		units = append(units, byTags[id])
+	}
+	return units
+}
+
+// join pairs the units of every source. A single source needs no pairing;
+// otherwise units are paired on the tags selected by the MATCH clause, all of
+// them by default, and each pair must be unique within every source.
+func (p *exprPlan) join(stmt *SelectStatement) ([]exprJoin, error) {
+	if len(p.sources) == 1 {
+		src := p.sources[0]
+		var joins []exprJoin
+		for _, unit := range p.units(stmt, src) {
+			joins = append(joins, exprJoin{tags: unit.tags, units: map[*exprSource]*exprUnit{src: unit}})
+		}
+		return joins, nil
+	}
+
+	type signature struct {
+		tags  map[string]string
+		units map[*exprSource]*exprUnit
+	}
+	signatures := make(map[string]*signature)
+	var ids []string
+	for _, src := range p.sources {
+		for _, unit := range p.units(stmt, src) {
+			tags := matchTags(unit.tags, stmt.Matching)
+			id := tagSetID(tags)
+			sig, ok := signatures[id]
+			if !ok {
+				sig = &signature{tags: tags, units: make(map[*exprSource]*exprUnit)}
+				signatures[id] = sig
+				ids = append(ids, id)
+			}
+			if _, ok := sig.units[src]; ok {
+				return nil, fmt.Errorf("several series of source %s match {%s}, use MATCH ON or MATCH IGNORING to pair them one to one", src.ref, strings.TrimSuffix(id, ","))
+			}
+			sig.units[src] = unit
+		}
+	}
+
+	sort.Strings(ids)
+	var joins []exprJoin
+	for _, id := range ids {
+		sig := signatures[id]
+		if len(sig.units) == len(p.sources) {
+			joins = append(joins, exprJoin{tags: sig.tags, units: sig.units})
+		}
+	}
+	return joins, nil
+}
+
+// matchTags returns the tags units are paired on under a MATCH clause
+func matchTags(tags map[string]string, m *Matching) map[string]string {
+	if m == nil {
+		return tags
+	}
+
+	listed := make(map[string]bool, len(m.Tags))
+	for _, tag := range m.Tags {
+		listed[tag] = true
+	}
+	matched := make(map[string]string)
+	for k, v := range tags {
+		if listed[k] != m.Ignoring {
+			matched[k] = v
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	return matched
+}
+
+// readLeaf reads the values of an operand from a unit of its source, sorted
+// by time. Aggregates hold one value per window, nil for windows filled with
+// null, and derivatives one value per point.
+func (e *Executor) readLeaf(ctx context.Context, leaf *exprLeaf, unit *exprUnit, tr TimeRange, interval time.Duration) ([]sample, error) {
+	var keys []storage.SeriesKey
+	for _, key := range unit.keys {
+		if key.Field == leaf.field {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	if !leaf.aggregated {
+		// A raw unit holds a single tag set, so a single series per field
+		return e.readSamples(ctx, keys[0], tr)
+	}
+
+	aggregates, err := e.aggregateColumn(ctx, keys, leaf.agg, leaf.rate, tr, interval)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]sample, 0, len(aggregates))
+	for _, a := range aggregates {
+		ts := a.Start
+		// Without GROUP BY time and a lower bound the single window starts at
+		// the epoch, derivatives keep the timestamps of their points
+		if interval == 0 && tr.IsZeroStart() && (leaf.rate == nil || leaf.rate.Function.Windowed()) {
+			ts = time.Unix(0, 0)
+		}
+		s := sample{Time: ts.UTC()}
+		if !a.Null {
+			s.Value = a.Value
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// evaluate computes every column over the operands read for one join. Each
+// column is evaluated at the timestamps of its first operand, pairing the
+// other operands with the value closest in time within the tolerance.
+func (p *exprPlan) evaluate(name string, tags map[string]string, data map[Expr][]sample, tolerance time.Duration) (*Row, error) {
+	rows := make(map[int64][]interface{})
+	for i, column := range p.columns {
+		operands := make(map[Expr]interface{}, len(column.leaves))
+	samples:
+		for _, s := range data[column.leaves[0]] {
+			for _, leaf := range column.leaves {
+				value, ok := nearestSample(data[leaf], s.Time, tolerance)
+				if !ok {
+					continue samples
+				}
+				operands[leaf] = value
+			}
+
+			value, err := evalExpr(column.expr, operands)
+			if err != nil {
+				return nil, err
+			}
+
+			ts := s.Time.UnixNano()
+			values, ok := rows[ts]
+			if !ok {
+				values = make([]interface{}, len(p.columns)+1)
+				values[0] = s.Time
+				rows[ts] = values
+			}
+			values[i+1] = value
+		}
+	}
+
+	timestamps := make([]int64, 0, len(rows))
+	for ts := range rows {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	row := &Row{
+		Name:    name,
+		Tags:    tags,
+		Columns: make([]string, 0, len(p.columns)+1),
+		Values:  make([][]interface{}, 0, len(timestamps)),
+	}
+	row.Columns = append(row.Columns, "time")
+	for _, column := range p.columns {
+		row.Columns = append(row.Columns, column.name)
+	}
+	for _, ts := range timestamps {
+		row.Values = append(row.Values, rows[ts])
+	}
+	return row, nil
+}
+
+// nearestSample returns the value of the sorted sample closest to t, if it is
+// at most tolerance away
+func nearestSample(samples []sample, t time.Time, tolerance time.Duration) (interface{}, bool) {
+	i := sort.Search(len(samples), func(i int) bool { return !samples[i].Time.Before(t) })
+
+	best, found := time.Duration(0), -1
+	for _, j := range []int{i - 1, i} {
+		if j < 0 || j >= len(samples) {
+			continue
+		}
+		d := samples[j].Time.Sub(t)
+		if d < 0 {
+			d = -d
+		}
+		if d <= tolerance && (found < 0 || d < best) {
+			best, found = d, j
+		}
+	}
+	if found < 0 {
+		return nil, false
+	}
+	return samples[found].Value, true
+}
+
+// evalExpr evaluates an expression over its operand values. A null operand
+// makes the result null, as do results that are not finite numbers.
+func evalExpr(expr Expr, operands map[Expr]interface{}) (interface{}, error) {
+	value, ok, err := evalNumber(expr, operands)
+	if err != nil || !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, err
+	}
+	return value, nil
+}
+
+// evalNumber evaluates an expression, reporting false for a null result
+func evalNumber(expr Expr, operands map[Expr]interface{}) (float64, bool, error) {
+	switch e := expr.(type) {
+	case *NumberLiteral:
+		return e.Val, true, nil
+	case *IntegerLiteral:
+		return float64(e.Val), true, nil
+	case *ParenExpr:
+		return evalNumber(e.Expr, operands)
+	case *BinaryExpr:
+		lhs, ok, err := evalNumber(e.LHS, operands)
+		if err != nil || !ok {
+			return 0, false, err
+		}
+		rhs, ok, err := evalNumber(e.RHS, operands)
+		if err != nil || !ok {
+			return 0, false, err
+		}
+		switch e.Op {
+		case ADD:
+			return lhs + rhs, true, nil
+		case SUB:
+			return lhs - rhs, true, nil
+		case MUL:
+			return lhs * rhs, true, nil
+		case DIV:
+			return lhs / rhs, true, nil
+		case MOD:
+			return math.Mod(lhs, rhs), true, nil
+		}
+	case *Call:
+		if fn, ok := mathFuncs[e.Name]; ok {
+			args := make([]float64, len(e.Args))
+			for i, arg := range e.Args {
+				value, ok, err := evalNumber(arg, operands)
+				if err != nil || !ok {
+					return 0, false, err
+				}
+				args[i] = value
+			}
+			return fn.fn(args), true, nil
+		}
+		return operandNumber(e, operands[e])
+	case *VarRef:
+		return operandNumber(e, operands[e])
+	}
+	return 0, false, fmt.Errorf("unsupported expression %s", expr)
+}
+
+// operandNumber converts the value of an operand to a number
+func operandNumber(expr Expr, value interface{}) (float64, bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, false, nil
+	case float64:
+		return v, true, nil
+	case int64:
+		return float64(v), true, nil
+	case uint64:
+		return float64(v), true, nil
+	}
+	return 0, false, fmt.Errorf("%s holds %T values, which expressions cannot use", expr, value)
+}
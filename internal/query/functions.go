@@ -0,0 +1,111 @@
+package query
+
+import (
+	"fmt"
+	"time"
+	"timeseriesdb/internal/storage"
+)
+
+// sample is a single timestamped value read from a series
+type sample struct {
+	Time  time.Time
+	Value interface{}
+}
+
+// aggregateFuncs maps the aggregate functions supported in SELECT to the
+// storage aggregation they are pushed down to
+var aggregateFuncs = map[string]storage.AggregateFunction{
+	"count":      storage.AggregateCount,
+	"sum":        storage.AggregateSum,
+	"mean":       storage.AggregateMean,
+	"min":        storage.AggregateMin,
+	"max":        storage.AggregateMax,
+	"first":      storage.AggregateFirst,
+	"last":       storage.AggregateLast,
+	"stddev":     storage.AggregateStddev,
+	"percentile": storage.AggregatePercentile,
+}
+
+// aggregateOptions validates the arguments of an aggregate call and returns
+// the field it applies to along with the storage aggregation
+func aggregateOptions(call *Call) (string, storage.AggregateOptions, error) {
+	fn, ok := aggregateFuncs[call.Name]
+	if !ok {
+		return "", storage.AggregateOptions{}, fmt.Errorf("unsupported function %s()", call.Name)
+	}
+	opts := storage.AggregateOptions{Function: fn}
+
+	argc := 1
+	if fn == storage.AggregatePercentile {
+		argc = 2
+	}
+	if len(call.Args) != argc {
+		if argc == 1 {
+			return "", opts, fmt.Errorf("%s() expects exactly one argument", call.Name)
+		}
+		return "", opts, fmt.Errorf("%s() expects exactly %d arguments", call.Name, argc)
+	}
+
+	ref, ok := call.Args[0].(*VarRef)
+	if !ok {
+		return "", opts, fmt.Errorf("%s() expects a field name, got %s", call.Name, call.Args[0])
+	}
+
+	if fn == storage.AggregatePercentile {
+		switch arg := call.Args[1].(type) {
+		case *NumberLiteral:
+			opts.Percentile = arg.Val
+		case *IntegerLiteral:
+			opts.Percentile = float64(arg.Val)
+		default:
+			return "", opts, fmt.Errorf("%s() expects a number as its second argument, got %s", call.Name, call.Args[1])
+		}
+		if opts.Percentile < 0 || opts.Percentile > 100 {
+			return "", opts, fmt.Errorf("%s() percentile must be between 0 and 100", call.Name)
+		}
+	}
+
+	return ref.Val, opts, nil
+}
+
+// rateFuncs maps the functions over the changes of a series supported in
+// SELECT to the storage function they are pushed down to
+var rateFuncs = map[string]storage.RateFunction{
+	"derivative":              storage.RateDerivative,
+	"non_negative_derivative": storage.RateNonNegativeDerivative,
+	"rate":                    storage.RateRate,
+	"increase":                storage.RateIncrease,
+}
+
+// rateOptions validates the arguments of a rate function call and returns
+// the field it applies to along with the storage options. Every function but
+// increase takes the time unit of its result as an optional second argument.
+func rateOptions(call *Call) (string, storage.RateOptions, error) {
+	fn, ok := rateFuncs[call.Name]
+	if !ok {
+		return "", storage.RateOptions{}, fmt.Errorf("unsupported function %s()", call.Name)
+	}
+	opts := storage.RateOptions{Function: fn}
+
+	switch {
+	case fn == storage.RateIncrease && len(call.Args) != 1:
+		return "", opts, fmt.Errorf("%s() expects exactly one argument", call.Name)
+	case len(call.Args) < 1 || len(call.Args) > 2:
+		return "", opts, fmt.Errorf("%s() expects a field and an optional unit", call.Name)
+	}
+
+	ref, ok := call.Args[0].(*VarRef)
+	if !ok {
+		return "", opts, fmt.Errorf("%s() expects a field name, got %s", call.Name, call.Args[0])
+	}
+
+	if len(call.Args) == 2 {
+		unit, ok := call.Args[1].(*DurationLiteral)
+		if !ok || unit.Val <= 0 {
+			return "", opts, fmt.Errorf("%s() expects a duration as its unit, got %s", call.Name, call.Args[1])
+		}
+		opts.Unit = unit.Val
+	}
+
+	return ref.Val, opts, nil
+}
@@ -0,0 +1,853 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/storage"
+)
+
+// Parser parses query language statements into an abstract syntax tree
+type Parser struct {
+	s   *Scanner
+	buf struct {
+		tok Token
+		pos int
+		lit string
+		n   int
+	}
+}
+
+// NewParser returns a new parser for the given query string
+func NewParser(query string) *Parser {
+	return &Parser{s: NewScanner(query)}
+}
+
+// ParseStatement parses a single statement from a query string
+func ParseStatement(query string) (Statement, error) {
+	return NewParser(query).ParseStatement()
+}
+
+// ParseExpr parses a standalone expression
+func ParseExpr(expr string) (Expr, error) {
+	p := NewParser(expr)
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != EOF {
+		return nil, newParseError(tokstr(tok, lit), []string{"EOF"}, pos)
+	}
+	return e, nil
+}
+
+// ParseStatement parses the next statement and expects the input to end after it
+func (p *Parser) ParseStatement() (Statement, error) {
+	tok, pos, lit := p.scanIgnoreWhitespace()
+
+	var stmt Statement
+	var err error
+	switch tok {
+	case SELECT:
+		stmt, err = p.parseSelectStatement()
+	case SHOW:
+		stmt, err = p.parseShowStatement()
+	case EXPLAIN:
+		stmt, err = p.parseExplainStatement()
+	default:
+		return nil, newParseError(tokstr(tok, lit), []string{"SELECT", "SHOW", "EXPLAIN"}, pos)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Allow an optional trailing semicolon
+	tok, pos, lit = p.scanIgnoreWhitespace()
+	if tok == SEMICOLON {
+		tok, pos, lit = p.scanIgnoreWhitespace()
+	}
+	if tok != EOF {
+		return nil, newParseError(tokstr(tok, lit), []string{"EOF"}, pos)
+	}
+
+	return stmt, nil
+}
+
+// parseExplainStatement parses the remainder of an EXPLAIN statement
+func (p *Parser) parseExplainStatement() (*ExplainStatement, error) {
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != SELECT {
+		return nil, newParseError(tokstr(tok, lit), []string{"SELECT"}, pos)
+	}
+	stmt, err := p.parseSelectStatement()
+	if err != nil {
+		return nil, err
+	}
+	return &ExplainStatement{Statement: stmt}, nil
+}
+
+// parseSelectStatement parses the remainder of a SELECT statement
+func (p *Parser) parseSelectStatement() (*SelectStatement, error) {
+	stmt := &SelectStatement{Ascending: true}
+	var err error
+
+	if stmt.Fields, err = p.parseFields(); err != nil {
+		return nil, err
+	}
+
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != FROM {
+		return nil, newParseError(tokstr(tok, lit), []string{"FROM"}, pos)
+	}
+	if stmt.Sources, stmt.Aliases, err = p.parseSources(); err != nil {
+		return nil, err
+	}
+
+	if stmt.Condition, err = p.parseCondition(); err != nil {
+		return nil, err
+	}
+
+	if stmt.Dimensions, err = p.parseDimensions(); err != nil {
+		return nil, err
+	}
+
+	if stmt.Fill, stmt.FillValue, err = p.parseFill(); err != nil {
+		return nil, err
+	}
+
+	if stmt.Matching, err = p.parseMatching(); err != nil {
+		return nil, err
+	}
+
+	if stmt.Tolerance, err = p.parseTolerance(); err != nil {
+		return nil, err
+	}
+
+	if stmt.Ascending, err = p.parseOrderBy(); err != nil {
+		return nil, err
+	}
+
+	if stmt.Limit, err = p.parseOptionalInt(LIMIT); err != nil {
+		return nil, err
+	}
+
+	if stmt.Offset, err = p.parseOptionalInt(OFFSET); err != nil {
+		return nil, err
+	}
+
+	return stmt, nil
+}
+
+// parseShowStatement parses the remainder of a SHOW statement
+func (p *Parser) parseShowStatement() (Statement, error) {
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	switch tok {
+	case MEASUREMENTS:
+		return p.parseShowMeasurementsStatement()
+	case TAG:
+		tok, pos, lit := p.scanIgnoreWhitespace()
+		switch tok {
+		case KEYS:
+			return p.parseShowTagKeysStatement()
+		case VALUES:
+			return p.parseShowTagValuesStatement()
+		}
+		return nil, newParseError(tokstr(tok, lit), []string{"KEYS", "VALUES"}, pos)
+	case FIELD:
+		if tok, pos, lit := p.scanIgnoreWhitespace(); tok != KEYS {
+			return nil, newParseError(tokstr(tok, lit), []string{"KEYS"}, pos)
+		}
+		return p.parseShowFieldKeysStatement()
+	case SERIES:
+		return p.parseShowSeriesStatement()
+	}
+	return nil, newParseError(tokstr(tok, lit), []string{"MEASUREMENTS", "TAG", "FIELD", "SERIES"}, pos)
+}
+
+// parseShowMeasurementsStatement parses the remainder of a SHOW MEASUREMENTS statement
+func (p *Parser) parseShowMeasurementsStatement() (*ShowMeasurementsStatement, error) {
+	stmt := &ShowMeasurementsStatement{}
+	var err error
+
+	if stmt.Condition, err = p.parseCondition(); err != nil {
+		return nil, err
+	}
+	if stmt.Limit, stmt.Offset, err = p.parseLimitOffset(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseShowTagKeysStatement parses the remainder of a SHOW TAG KEYS statement
+func (p *Parser) parseShowTagKeysStatement() (*ShowTagKeysStatement, error) {
+	stmt := &ShowTagKeysStatement{}
+	var err error
+
+	if stmt.Sources, err = p.parseOptionalSources(); err != nil {
+		return nil, err
+	}
+	if stmt.Condition, err = p.parseCondition(); err != nil {
+		return nil, err
+	}
+	if stmt.Limit, stmt.Offset, err = p.parseLimitOffset(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseShowTagValuesStatement parses the remainder of a SHOW TAG VALUES statement
+func (p *Parser) parseShowTagValuesStatement() (*ShowTagValuesStatement, error) {
+	stmt := &ShowTagValuesStatement{}
+	var err error
+
+	if stmt.Sources, err = p.parseOptionalSources(); err != nil {
+		return nil, err
+	}
+	if err = p.parseTagKeyClause(stmt); err != nil {
+		return nil, err
+	}
+	if stmt.Condition, err = p.parseCondition(); err != nil {
+		return nil, err
+	}
+	if stmt.Limit, stmt.Offset, err = p.parseLimitOffset(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseTagKeyClause parses the WITH KEY clause of SHOW TAG VALUES
+func (p *Parser) parseTagKeyClause(stmt *ShowTagValuesStatement) error {
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != WITH {
+		return newParseError(tokstr(tok, lit), []string{"WITH"}, pos)
+	}
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != KEY {
+		return newParseError(tokstr(tok, lit), []string{"KEY"}, pos)
+	}
+
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	stmt.Op = tok
+	switch tok {
+	case EQ, NEQ:
+		key, err := p.parseIdent()
+		if err != nil {
+			return err
+		}
+		stmt.TagKeys = []string{key}
+	case IN:
+		if tok, pos, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+			return newParseError(tokstr(tok, lit), []string{"("}, pos)
+		}
+		keys, err := p.parseIdentList()
+		if err != nil {
+			return err
+		}
+		if tok, pos, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
+			return newParseError(tokstr(tok, lit), []string{")"}, pos)
+		}
+		stmt.TagKeys = keys
+	case EQREGEX, NEQREGEX:
+		re, err := p.parseRegex()
+		if err != nil {
+			return err
+		}
+		stmt.TagKeyRegex = re.(*RegexLiteral).Val
+	default:
+		return newParseError(tokstr(tok, lit), []string{"=", "!=", "=~", "!~", "IN"}, pos)
+	}
+	return nil
+}
+
+// parseShowFieldKeysStatement parses the remainder of a SHOW FIELD KEYS statement
+func (p *Parser) parseShowFieldKeysStatement() (*ShowFieldKeysStatement, error) {
+	stmt := &ShowFieldKeysStatement{}
+	var err error
+
+	if stmt.Sources, err = p.parseOptionalSources(); err != nil {
+		return nil, err
+	}
+	if stmt.Condition, err = p.parseCondition(); err != nil {
+		return nil, err
+	}
+	if stmt.Limit, stmt.Offset, err = p.parseLimitOffset(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseShowSeriesStatement parses the remainder of a SHOW SERIES statement
+func (p *Parser) parseShowSeriesStatement() (*ShowSeriesStatement, error) {
+	stmt := &ShowSeriesStatement{}
+	var err error
+
+	if stmt.Sources, err = p.parseOptionalSources(); err != nil {
+		return nil, err
+	}
+	if stmt.Condition, err = p.parseCondition(); err != nil {
+		return nil, err
+	}
+	if stmt.Limit, stmt.Offset, err = p.parseLimitOffset(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// parseOptionalSources parses an optional FROM clause
+func (p *Parser) parseOptionalSources() ([]string, error) {
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok != FROM {
+		p.unscan()
+		return nil, nil
+	}
+	return p.parseIdentList()
+}
+
+// parseLimitOffset parses optional LIMIT and OFFSET clauses
+func (p *Parser) parseLimitOffset() (limit, offset int, err error) {
+	if limit, err = p.parseOptionalInt(LIMIT); err != nil {
+		return 0, 0, err
+	}
+	if offset, err = p.parseOptionalInt(OFFSET); err != nil {
+		return 0, 0, err
+	}
+	return limit, offset, nil
+}
+
+// parseFields parses the SELECT field list
+func (p *Parser) parseFields() ([]*Field, error) {
+	var fields []*Field
+	for {
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+
+		if tok, _, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			return fields, nil
+		}
+	}
+}
+
+// parseField parses a single field with an optional alias
+func (p *Parser) parseField() (*Field, error) {
+	field := &Field{}
+
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == MUL {
+		field.Expr = &Wildcard{}
+	} else {
+		p.unscan()
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		field.Expr = expr
+	}
+
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == AS {
+		alias, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		field.Alias = alias
+	} else {
+		p.unscan()
+	}
+
+	return field, nil
+}
+
+// parseCondition parses an optional WHERE clause
+func (p *Parser) parseCondition() (Expr, error) {
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok != WHERE {
+		p.unscan()
+		return nil, nil
+	}
+	return p.parseExpr()
+}
+
+// parseDimensions parses an optional GROUP BY clause
+func (p *Parser) parseDimensions() ([]*Dimension, error) {
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok != GROUP {
+		p.unscan()
+		return nil, nil
+	}
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != BY {
+		return nil, newParseError(tokstr(tok, lit), []string{"BY"}, pos)
+	}
+
+	var dims []*Dimension
+	for {
+		tok, pos, lit := p.scanIgnoreWhitespace()
+		switch tok {
+		case MUL:
+			dims = append(dims, &Dimension{Expr: &Wildcard{}})
+		case IDENT:
+			if strings.EqualFold(lit, "time") {
+				call, err := p.parseTimeDimension()
+				if err != nil {
+					return nil, err
+				}
+				dims = append(dims, &Dimension{Expr: call})
+			} else {
+				dims = append(dims, &Dimension{Expr: &VarRef{Val: lit}})
+			}
+		default:
+			return nil, newParseError(tokstr(tok, lit), []string{"identifier", "*"}, pos)
+		}
+
+		if tok, _, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			return dims, nil
+		}
+	}
+}
+
+// parseTimeDimension parses the argument list of GROUP BY time(<duration>)
+func (p *Parser) parseTimeDimension() (*Call, error) {
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+		return nil, newParseError(tokstr(tok, lit), []string{"("}, pos)
+	}
+
+	tok, dpos, lit := p.scanIgnoreWhitespace()
+	if tok != DURATION {
+		return nil, newParseError(tokstr(tok, lit), []string{"duration"}, dpos)
+	}
+	d, err := ParseDuration(lit)
+	if err != nil {
+		return nil, &ParseError{Message: err.Error(), Pos: dpos}
+	}
+	if d <= 0 {
+		return nil, &ParseError{Message: "GROUP BY time interval must be positive", Pos: dpos}
+	}
+
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
+		return nil, newParseError(tokstr(tok, lit), []string{")"}, pos)
+	}
+
+	return &Call{Name: "time", Args: []Expr{&DurationLiteral{Val: d}}}, nil
+}
+
+// parseFill parses an optional fill(none|null|previous|linear|<number>) clause
+func (p *Parser) parseFill() (storage.FillMode, float64, error) {
+	if tok, _, lit := p.scanIgnoreWhitespace(); tok != IDENT || !strings.EqualFold(lit, "fill") {
+		p.unscan()
+		return "", 0, nil
+	}
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+		return "", 0, newParseError(tokstr(tok, lit), []string{"("}, pos)
+	}
+
+	var mode storage.FillMode
+	var value float64
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok == IDENT {
+		var err error
+		mode, err = storage.ParseFillMode(lit)
+		if err != nil || mode == storage.FillConstant {
+			return "", 0, newParseError(tokstr(tok, lit), []string{"none", "null", "previous", "linear", "number"}, pos)
+		}
+	} else {
+		p.unscan()
+		expr, err := p.parseUnaryExpr()
+		if err != nil {
+			return "", 0, err
+		}
+		switch lit := expr.(type) {
+		case *IntegerLiteral:
+			value = float64(lit.Val)
+		case *NumberLiteral:
+			value = lit.Val
+		default:
+			return "", 0, newParseError(expr.String(), []string{"none", "null", "previous", "linear", "number"}, pos)
+		}
+		mode = storage.FillConstant
+	}
+
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
+		return "", 0, newParseError(tokstr(tok, lit), []string{")"}, pos)
+	}
+	return mode, value, nil
+}
+
+// parseMatching parses an optional MATCH ON (<tag>, ...) or MATCH IGNORING
+// (<tag>, ...) clause
+func (p *Parser) parseMatching() (*Matching, error) {
+	if tok, _, lit := p.scanIgnoreWhitespace(); tok != IDENT || !strings.EqualFold(lit, "match") {
+		p.unscan()
+		return nil, nil
+	}
+
+	m := &Matching{}
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	switch {
+	case tok == IDENT && strings.EqualFold(lit, "on"):
+	case tok == IDENT && strings.EqualFold(lit, "ignoring"):
+		m.Ignoring = true
+	default:
+		return nil, newParseError(tokstr(tok, lit), []string{"ON", "IGNORING"}, pos)
+	}
+
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != LPAREN {
+		return nil, newParseError(tokstr(tok, lit), []string{"("}, pos)
+	}
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == RPAREN {
+		return m, nil
+	}
+	p.unscan()
+
+	tags, err := p.parseIdentList()
+	if err != nil {
+		return nil, err
+	}
+	m.Tags = tags
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
+		return nil, newParseError(tokstr(tok, lit), []string{")"}, pos)
+	}
+	return m, nil
+}
+
+// parseTolerance parses an optional TOLERANCE <duration> clause
+func (p *Parser) parseTolerance() (time.Duration, error) {
+	if tok, _, lit := p.scanIgnoreWhitespace(); tok != IDENT || !strings.EqualFold(lit, "tolerance") {
+		p.unscan()
+		return 0, nil
+	}
+
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != DURATION {
+		return 0, newParseError(tokstr(tok, lit), []string{"duration"}, pos)
+	}
+	d, err := ParseDuration(lit)
+	if err != nil {
+		return 0, &ParseError{Message: err.Error(), Pos: pos}
+	}
+	return d, nil
+}
+
+// parseOrderBy parses an optional ORDER BY time [ASC|DESC] clause
+func (p *Parser) parseOrderBy() (bool, error) {
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok != ORDER {
+		p.unscan()
+		return true, nil
+	}
+	if tok, pos, lit := p.scanIgnoreWhitespace(); tok != BY {
+		return true, newParseError(tokstr(tok, lit), []string{"BY"}, pos)
+	}
+
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT || !strings.EqualFold(lit, "time") {
+		return true, &ParseError{Message: "only ORDER BY time is supported", Pos: pos}
+	}
+
+	switch tok, _, _ := p.scanIgnoreWhitespace(); tok {
+	case ASC:
+		return true, nil
+	case DESC:
+		return false, nil
+	default:
+		p.unscan()
+		return true, nil
+	}
+}
+
+// parseOptionalInt parses "<keyword> <n>" if the keyword is present
+func (p *Parser) parseOptionalInt(keyword Token) (int, error) {
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok != keyword {
+		p.unscan()
+		return 0, nil
+	}
+
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != INTEGER {
+		return 0, newParseError(tokstr(tok, lit), []string{"integer"}, pos)
+	}
+	n, err := strconv.Atoi(lit)
+	if err != nil || n < 0 {
+		return 0, &ParseError{Message: fmt.Sprintf("invalid %s value: %s", keyword, lit), Pos: pos}
+	}
+	return n, nil
+}
+
+// parseSources parses the comma-separated measurements of a FROM clause, each
+// with an optional AS alias. The aliases are nil when none is given.
+func (p *Parser) parseSources() ([]string, []string, error) {
+	var sources, aliases []string
+	hasAlias := false
+	for {
+		source, err := p.parseIdent()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		alias := ""
+		if tok, _, _ := p.scanIgnoreWhitespace(); tok == AS {
+			if alias, err = p.parseIdent(); err != nil {
+				return nil, nil, err
+			}
+			hasAlias = true
+		} else {
+			p.unscan()
+		}
+		sources = append(sources, source)
+		aliases = append(aliases, alias)
+
+		if tok, _, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			if !hasAlias {
+				aliases = nil
+			}
+			return sources, aliases, nil
+		}
+	}
+}
+
+// parseIdentList parses a comma-separated list of identifiers
+func (p *Parser) parseIdentList() ([]string, error) {
+	var idents []string
+	for {
+		ident, err := p.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+		idents = append(idents, ident)
+
+		if tok, _, _ := p.scanIgnoreWhitespace(); tok != COMMA {
+			p.unscan()
+			return idents, nil
+		}
+	}
+}
+
+// parseIdent parses a single identifier
+func (p *Parser) parseIdent() (string, error) {
+	tok, pos, lit := p.scanIgnoreWhitespace()
+	if tok != IDENT {
+		return "", newParseError(tokstr(tok, lit), []string{"identifier"}, pos)
+	}
+	return lit, nil
+}
+
+// parseExpr parses an expression using operator precedence climbing
+func (p *Parser) parseExpr() (Expr, error) {
+	return p.parseBinaryExpr(1)
+}
+
+// parseBinaryExpr parses binary operators with a precedence of at least minPrec
+func (p *Parser) parseBinaryExpr(minPrec int) (Expr, error) {
+	lhs, err := p.parseUnaryExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, _, _ := p.scanIgnoreWhitespace()
+		if !op.isOperator() || op.Precedence() < minPrec {
+			p.unscan()
+			return lhs, nil
+		}
+
+		var rhs Expr
+		if op == EQREGEX || op == NEQREGEX {
+			rhs, err = p.parseRegex()
+		} else {
+			rhs, err = p.parseBinaryExpr(op.Precedence() + 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		lhs = &BinaryExpr{Op: op, LHS: lhs, RHS: rhs}
+	}
+}
+
+// parseRegex parses the regex literal on the right side of =~ or !~
+func (p *Parser) parseRegex() (Expr, error) {
+	tok, pos, lit := p.s.ScanRegex()
+	if tok != REGEX {
+		return nil, newParseError(tokstr(tok, lit), []string{"regex"}, pos)
+	}
+	re, err := regexp.Compile(lit)
+	if err != nil {
+		return nil, &ParseError{Message: "invalid regex: " + err.Error(), Pos: pos}
+	}
+	return &RegexLiteral{Val: re}, nil
+}
+
+// parseUnaryExpr parses a literal, reference, call or parenthesized expression
+func (p *Parser) parseUnaryExpr() (Expr, error) {
+	tok, pos, lit := p.scanIgnoreWhitespace()
+
+	switch tok {
+	case LPAREN:
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if tok, pos, lit := p.scanIgnoreWhitespace(); tok != RPAREN {
+			return nil, newParseError(tokstr(tok, lit), []string{")"}, pos)
+		}
+		return &ParenExpr{Expr: expr}, nil
+	case IDENT:
+		switch next, _, _ := p.scan(); next {
+		case LPAREN:
+			return p.parseCall(lit)
+		case DOT:
+			// A reference qualified with its source, such as a.usage
+			name, err := p.parseIdent()
+			if err != nil {
+				return nil, err
+			}
+			return &VarRef{Source: lit, Val: name}, nil
+		}
+		p.unscan()
+		return &VarRef{Val: lit}, nil
+	case STRING:
+		return &StringLiteral{Val: lit}, nil
+	case BADSTRING:
+		return nil, &ParseError{Message: "unterminated string", Pos: pos}
+	case INTEGER:
+		n, err := strconv.ParseInt(lit, 10, 64)
+		if err != nil {
+			// Fall back to a float for integers that overflow int64
+			f, ferr := strconv.ParseFloat(lit, 64)
+			if ferr != nil {
+				return nil, &ParseError{Message: "invalid integer: " + lit, Pos: pos}
+			}
+			return &NumberLiteral{Val: f}, nil
+		}
+		return &IntegerLiteral{Val: n}, nil
+	case NUMBER:
+		f, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			return nil, &ParseError{Message: "invalid number: " + lit, Pos: pos}
+		}
+		return &NumberLiteral{Val: f}, nil
+	case DURATION:
+		d, err := ParseDuration(lit)
+		if err != nil {
+			return nil, &ParseError{Message: err.Error(), Pos: pos}
+		}
+		return &DurationLiteral{Val: d}, nil
+	case SUB:
+		// Negative numeric and duration literals
+		expr, err := p.parseUnaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		switch e := expr.(type) {
+		case *IntegerLiteral:
+			e.Val = -e.Val
+			return e, nil
+		case *NumberLiteral:
+			e.Val = -e.Val
+			return e, nil
+		case *DurationLiteral:
+			e.Val = -e.Val
+			return e, nil
+		}
+		return &BinaryExpr{Op: MUL, LHS: &IntegerLiteral{Val: -1}, RHS: expr}, nil
+	}
+
+	return nil, newParseError(tokstr(tok, lit), []string{"identifier", "string", "number", "duration", "("}, pos)
+}
+
+// parseCall parses the argument list of a function call after the opening paren
+func (p *Parser) parseCall(name string) (*Call, error) {
+	call := &Call{Name: strings.ToLower(name)}
+
+	if tok, _, _ := p.scanIgnoreWhitespace(); tok == RPAREN {
+		return call, nil
+	}
+	p.unscan()
+
+	for {
+		var arg Expr
+		if tok, _, _ := p.scanIgnoreWhitespace(); tok == MUL {
+			arg = &Wildcard{}
+		} else {
+			p.unscan()
+			var err error
+			if arg, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+		}
+		call.Args = append(call.Args, arg)
+
+		tok, pos, lit := p.scanIgnoreWhitespace()
+		switch tok {
+		case COMMA:
+			continue
+		case RPAREN:
+			return call, nil
+		default:
+			return nil, newParseError(tokstr(tok, lit), []string{",", ")"}, pos)
+		}
+	}
+}
+
+// scan returns the next token, honouring a previously unscanned token
+func (p *Parser) scan() (Token, int, string) {
+	if p.buf.n != 0 {
+		p.buf.n = 0
+		return p.buf.tok, p.buf.pos, p.buf.lit
+	}
+
+	tok, pos, lit := p.s.Scan()
+	p.buf.tok, p.buf.pos, p.buf.lit = tok, pos, lit
+	return tok, pos, lit
+}
+
+// scanIgnoreWhitespace returns the next non-whitespace token
+func (p *Parser) scanIgnoreWhitespace() (Token, int, string) {
+	tok, pos, lit := p.scan()
+	if tok == WS {
+		tok, pos, lit = p.scan()
+	}
+	return tok, pos, lit
+}
+
+// unscan pushes the previously read token back onto the buffer
+func (p *Parser) unscan() {
+	p.buf.n = 1
+}
+
+// ParseError describes a syntax error in a query
+type ParseError struct {
+	Message  string
+	Found    string
+	Expected []string
+	Pos      int
+}
+
+// Error returns a human readable error message including the character position
+func (e *ParseError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s at position %d", e.Message, e.Pos+1)
+	}
+	return fmt.Sprintf("found %s, expected %s at position %d", e.Found, strings.Join(e.Expected, ", "), e.Pos+1)
+}
+
+// newParseError creates a parse error for an unexpected token
+func newParseError(found string, expected []string, pos int) *ParseError {
+	return &ParseError{Found: found, Expected: expected, Pos: pos}
+}
+
+// tokstr returns a literal if provided, otherwise the token string
+func tokstr(tok Token, lit string) string {
+	if lit != "" && tok != WS {
+		return lit
+	}
+	if tok == EOF {
+		return "EOF"
+	}
+	return tok.String()
+}
+
+// asValidationError wraps a parse or planning error as a validation AppError
+func asValidationError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return errors.WrapWithType(err, errors.ErrorTypeValidation, "invalid query")
+}
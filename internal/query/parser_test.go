@@ -0,0 +1,275 @@
+package query
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStatement(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "raw field",
+			query: "SELECT value FROM cpu",
+			want:  "SELECT value FROM cpu",
+		},
+		{
+			name:  "wildcard",
+			query: "select * from cpu",
+			want:  "SELECT * FROM cpu",
+		},
+		{
+			name:  "aggregate with alias",
+			query: `SELECT MEAN(value) AS avg, max("value") FROM "cpu"`,
+			want:  "SELECT mean(value) AS avg, max(value) FROM cpu",
+		},
+		{
+			name:  "where clause",
+			query: "SELECT value FROM cpu WHERE host = 'a' AND time > now() - 1h",
+			want:  "SELECT value FROM cpu WHERE host = 'a' AND time > now() - 1h",
+		},
+		{
+			name:  "operator precedence",
+			query: "SELECT value FROM cpu WHERE host = 'a' OR host = 'b' AND region = 'x'",
+			want:  "SELECT value FROM cpu WHERE host = 'a' OR host = 'b' AND region = 'x'",
+		},
+		{
+			name:  "regex",
+			query: "SELECT value FROM cpu WHERE host =~ /^server\\/0[12]$/",
+			want:  "SELECT value FROM cpu WHERE host =~ /^server\\/0[12]$/",
+		},
+		{
+			name:  "group by, order, limit and offset",
+			query: "SELECT count(value) FROM cpu GROUP BY time(5m), host ORDER BY time DESC LIMIT 10 OFFSET 2",
+			want:  "SELECT count(value) FROM cpu GROUP BY time(5m), host ORDER BY time DESC LIMIT 10 OFFSET 2",
+		},
+		{
+			name:  "fill mode",
+			query: "SELECT mean(value) FROM cpu GROUP BY time(1m) FILL(previous)",
+			want:  "SELECT mean(value) FROM cpu GROUP BY time(1m) fill(previous)",
+		},
+		{
+			name:  "fill value",
+			query: "SELECT mean(value) FROM cpu GROUP BY time(1m) fill(-1.5) LIMIT 5",
+			want:  "SELECT mean(value) FROM cpu GROUP BY time(1m) fill(-1.5) LIMIT 5",
+		},
+		{
+			name:  "field arithmetic",
+			query: "SELECT disk_used / disk_total * 100 AS pct, usage % 2, -idle FROM disk",
+			want:  "SELECT disk_used / disk_total * 100 AS pct, usage % 2, -1 * idle FROM disk",
+		},
+		{
+			name:  "math functions",
+			query: "SELECT round(sqrt(value)), pow(value, 2) FROM cpu",
+			want:  "SELECT round(sqrt(value)), pow(value, 2) FROM cpu",
+		},
+		{
+			name:  "top selector",
+			query: "SELECT top(mean(usage), host, region, 10) FROM cpu",
+			want:  "SELECT top(mean(usage), host, region, 10) FROM cpu",
+		},
+		{
+			name:  "qualified sources",
+			query: "SELECT b.usage - a.usage FROM cpu AS a, cpu AS b WHERE a.host = 'server01' AND b.host = 'server02' MATCH ON () TOLERANCE 5s",
+			want:  "SELECT b.usage - a.usage FROM cpu AS a, cpu AS b WHERE a.host = 'server01' AND b.host = 'server02' MATCH ON () TOLERANCE 5s",
+		},
+		{
+			name:  "match ignoring",
+			query: "SELECT mean(used) / mean(total) FROM disk, mem GROUP BY time(1m), host fill(null) MATCH IGNORING (device, path) LIMIT 2",
+			want:  "SELECT mean(used) / mean(total) FROM disk, mem GROUP BY time(1m), host fill(null) MATCH IGNORING (device, path) LIMIT 2",
+		},
+		{
+			name:  "trailing semicolon",
+			query: "SELECT value FROM cpu;",
+			want:  "SELECT value FROM cpu",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := ParseStatement(tt.query)
+			if err != nil {
+				t.Fatalf("ParseStatement(%q) failed: %v", tt.query, err)
+			}
+			if got := stmt.String(); got != tt.want {
+				t.Errorf("ParseStatement(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStatementGroupBy(t *testing.T) {
+	stmt, err := ParseStatement("SELECT mean(value) FROM cpu GROUP BY time(90s), host, region")
+	if err != nil {
+		t.Fatalf("ParseStatement failed: %v", err)
+	}
+
+	sel := stmt.(*SelectStatement)
+	if got := sel.GroupByInterval(); got != 90*time.Second {
+		t.Errorf("GroupByInterval() = %v, want 90s", got)
+	}
+	keys, all := sel.GroupByTags()
+	if all || len(keys) != 2 || keys[0] != "host" || keys[1] != "region" {
+		t.Errorf("GroupByTags() = %v, %v, want [host region], false", keys, all)
+	}
+}
+
+func TestParseShowStatement(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SHOW MEASUREMENTS", "SHOW MEASUREMENTS"},
+		{"show measurements where host = 'a' limit 2 offset 1", "SHOW MEASUREMENTS WHERE host = 'a' LIMIT 2 OFFSET 1"},
+		{"SHOW TAG KEYS FROM cpu, mem", "SHOW TAG KEYS FROM cpu, mem"},
+		{"SHOW TAG KEYS WHERE time > now() - 1h", "SHOW TAG KEYS WHERE time > now() - 1h"},
+		{`SHOW TAG VALUES FROM cpu WITH KEY = "host"`, "SHOW TAG VALUES FROM cpu WITH KEY = host"},
+		{"SHOW TAG VALUES WITH KEY IN (host, region) WHERE region =~ /^eu/", "SHOW TAG VALUES WITH KEY IN (host, region) WHERE region =~ /^eu/"},
+		{"SHOW TAG VALUES WITH KEY !~ /^h/ LIMIT 5", "SHOW TAG VALUES WITH KEY !~ /^h/ LIMIT 5"},
+		{"SHOW FIELD KEYS FROM cpu;", "SHOW FIELD KEYS FROM cpu"},
+		{"SHOW SERIES FROM cpu WHERE host != 'a'", "SHOW SERIES FROM cpu WHERE host != 'a'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			stmt, err := ParseStatement(tt.query)
+			if err != nil {
+				t.Fatalf("ParseStatement(%q) failed: %v", tt.query, err)
+			}
+			if got := stmt.String(); got != tt.want {
+				t.Errorf("ParseStatement(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExplainStatement(t *testing.T) {
+	query := "explain select mean(value) from cpu where time > now() - 90d group by time(1h), host;"
+	stmt, err := ParseStatement(query)
+	if err != nil {
+		t.Fatalf("ParseStatement(%q) failed: %v", query, err)
+	}
+	explain, ok := stmt.(*ExplainStatement)
+	if !ok {
+		t.Fatalf("Expected an EXPLAIN statement, got %T", stmt)
+	}
+	if explain.Statement.GroupByInterval() != time.Hour {
+		t.Errorf("Expected the explained statement to group by 1h, got %s", explain.Statement.GroupByInterval())
+	}
+	if want := "EXPLAIN SELECT mean(value) FROM cpu WHERE time > now() - 90d GROUP BY time(1h), host"; stmt.String() != want {
+		t.Errorf("Got %q, want %q", stmt.String(), want)
+	}
+}
+
+func TestShowTagValuesMatchTagKey(t *testing.T) {
+	tests := []struct {
+		query string
+		match []string
+		skip  []string
+	}{
+		{"SHOW TAG VALUES WITH KEY = host", []string{"host"}, []string{"region"}},
+		{"SHOW TAG VALUES WITH KEY != host", []string{"region"}, []string{"host"}},
+		{"SHOW TAG VALUES WITH KEY IN (host, dc)", []string{"host", "dc"}, []string{"region"}},
+		{"SHOW TAG VALUES WITH KEY =~ /^h/", []string{"host"}, []string{"region"}},
+		{"SHOW TAG VALUES WITH KEY !~ /^h/", []string{"region"}, []string{"host"}},
+	}
+
+	for _, tt := range tests {
+		stmt, err := ParseStatement(tt.query)
+		if err != nil {
+			t.Fatalf("ParseStatement(%q) failed: %v", tt.query, err)
+		}
+		show := stmt.(*ShowTagValuesStatement)
+		for _, key := range tt.match {
+			if !show.MatchTagKey(key) {
+				t.Errorf("%q should select tag key %q", tt.query, key)
+			}
+		}
+		for _, key := range tt.skip {
+			if show.MatchTagKey(key) {
+				t.Errorf("%q should not select tag key %q", tt.query, key)
+			}
+		}
+	}
+}
+
+func TestParseStatementErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "empty", query: "", want: "expected SELECT"},
+		{name: "unsupported statement", query: "DROP cpu", want: "expected SELECT"},
+		{name: "missing from", query: "SELECT value", want: "expected FROM"},
+		{name: "missing measurement", query: "SELECT value FROM", want: "expected identifier"},
+		{name: "unterminated string", query: "SELECT value FROM cpu WHERE host = 'a", want: "unterminated"},
+		{name: "bad group by interval", query: "SELECT mean(value) FROM cpu GROUP BY time(abc)", want: "expected duration"},
+		{name: "unknown fill mode", query: "SELECT mean(value) FROM cpu GROUP BY time(1m) fill(zero)", want: "found zero"},
+		{name: "unterminated fill", query: "SELECT mean(value) FROM cpu GROUP BY time(1m) fill(null", want: "expected )"},
+		{name: "match without on", query: "SELECT a.v FROM cpu AS a MATCH (host)", want: "expected ON, IGNORING"},
+		{name: "bad tolerance", query: "SELECT a.v FROM cpu AS a TOLERANCE 5", want: "expected duration"},
+		{name: "missing alias", query: "SELECT v FROM cpu AS", want: "expected identifier"},
+		{name: "missing qualified field", query: "SELECT a. FROM cpu", want: "expected identifier"},
+		{name: "bad limit", query: "SELECT value FROM cpu LIMIT x", want: "expected integer"},
+		{name: "trailing tokens", query: "SELECT value FROM cpu extra", want: "found extra"},
+		{name: "unknown show", query: "SHOW DATABASES", want: "expected MEASUREMENTS"},
+		{name: "show tag without keys", query: "SHOW TAG host", want: "expected KEYS, VALUES"},
+		{name: "show tag values without key", query: "SHOW TAG VALUES FROM cpu", want: "expected WITH"},
+		{name: "show tag values bad operator", query: "SHOW TAG VALUES WITH KEY > host", want: "expected =, !="},
+		{name: "show tag values bad regex", query: "SHOW TAG VALUES WITH KEY =~ /(/", want: "invalid regex"},
+		{name: "explain show", query: "EXPLAIN SHOW MEASUREMENTS", want: "found SHOW, expected SELECT"},
+		{name: "explain without statement", query: "EXPLAIN", want: "expected SELECT"},
+		{name: "invalid UTF-8 after number", query: "0\xfe", want: "expected SELECT"},
+		{name: "invalid UTF-8", query: "SELECT value FROM cpu WHERE host = 0\xfe", want: "found \ufffd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseStatement(tt.query)
+			if err == nil {
+				t.Fatalf("ParseStatement(%q) succeeded, want error", tt.query)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseStatement(%q) error = %q, want it to contain %q", tt.query, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"10ns", 10 * time.Nanosecond},
+		{"5u", 5 * time.Microsecond},
+		{"250ms", 250 * time.Millisecond},
+		{"30s", 30 * time.Second},
+		{"5m", 5 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"2d", 48 * time.Hour},
+		{"1w", 7 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.in)
+		if err != nil {
+			t.Errorf("ParseDuration(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "m", "5x", "1.5h"} {
+		if _, err := ParseDuration(bad); err == nil {
+			t.Errorf("ParseDuration(%q) succeeded, want error", bad)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/storage"
+)
+
+// rollupReaggregates maps the aggregate functions computed exactly from the
+// rollups of finer windows, across any number of series, to the function
+// aggregating the rollup points again
+var rollupReaggregates = map[storage.AggregateFunction]storage.AggregateFunction{
+	storage.AggregateCount: storage.AggregateSum,
+	storage.AggregateSum:   storage.AggregateSum,
+	storage.AggregateMin:   storage.AggregateMin,
+	storage.AggregateMax:   storage.AggregateMax,
+}
+
+// rollupRead reads the windows of an aggregate from the points continuous
+// queries wrote to their rollup measurements
+type rollupRead struct {
+	// queries are the continuous queries read: one, or the sum and the count
+	// rollups a mean is computed from
+	queries []storage.ContinuousQuery
+	// function aggregates the rollup points of each window
+	function storage.AggregateFunction
+	// from and until bound the windows rolled up by every query
+	from, until time.Time
+}
+
+// interval returns the width of the rollup windows
+func (r *rollupRead) interval() time.Duration {
+	return r.queries[0].Interval
+}
+
+// measurements returns the rollup measurements read
+func (r *rollupRead) measurements() string {
+	targets := make([]string, len(r.queries))
+	for i, cq := range r.queries {
+		targets[i] = cq.Target
+	}
+	return strings.Join(targets, ", ")
+}
+
+// String describes how the rollups are read
+func (r *rollupRead) String() string {
+	names := make([]string, len(r.queries))
+	for i, cq := range r.queries {
+		names[i] = cq.Name
+	}
+	width := FormatDuration(r.interval())
+	switch {
+	case len(r.queries) == 2:
+		return fmt.Sprintf("mean of %s sum and count rollups of %s", width, strings.Join(names, " and "))
+	case r.function == storage.AggregateFirst:
+		return fmt.Sprintf("%s %s rollup of %s", width, r.queries[0].Function, names[0])
+	}
+	return fmt.Sprintf("%s of %s %s rollup of %s", r.function, width, r.queries[0].Function, names[0])
+}
+
+// planPart is a time range of an aggregate column, read from rollups when
+// rollup is set and from raw points otherwise
+type planPart struct {
+	start, end time.Time
+	rollup     *rollupRead
+	// detail explains the choice
+	detail string
+}
+
+// planAggregate decides where the windows of an aggregate column over a set
+// of series of one field are read from. The coarsest rollup sufficient to
+// compute the windows is read for the whole windows it covers, and the rest
+// of the range is read from raw points.
+func planAggregate(queries []storage.ContinuousQuery, keys []storage.SeriesKey, agg storage.AggregateOptions, rate *storage.RateOptions, tr TimeRange, interval time.Duration) []planPart {
+	raw := func(detail string) []planPart {
+		return []planPart{{start: tr.Start, end: tr.End, detail: detail}}
+	}
+	switch {
+	case rate != nil:
+		return raw("rate functions read raw points")
+	case interval == 0:
+		return raw("rollups require GROUP BY time")
+	case len(keys) == 0:
+		return raw("")
+	}
+
+	read := bestRollup(queries, keys, agg, interval)
+	if read == nil {
+		return raw(fmt.Sprintf("no rollup of %s can compute %s(%s) in %s windows", keys[0].Measurement, agg.Function, keys[0].Field, FormatDuration(interval)))
+	}
+
+	// Only the whole windows rolled up are read from rollups
+	from := read.from
+	if tr.Start.After(from) {
+		from = tr.Start
+	}
+	start := alignWindow(from, interval)
+	if start.Before(from) {
+		start = start.Add(interval)
+	}
+	until := read.until
+	if tr.End.Before(until) {
+		until = tr.End.Add(time.Nanosecond)
+	}
+	end := alignWindow(until, interval)
+	if !start.Before(end) {
+		return raw(fmt.Sprintf("the range is not rolled up yet by %s", read))
+	}
+
+	var parts []planPart
+	if tr.Start.Before(start) {
+		parts = append(parts, planPart{start: tr.Start, end: start.Add(-time.Nanosecond), detail: "before the rolled up range"})
+	}
+	parts = append(parts, planPart{start: start, end: end.Add(-time.Nanosecond), rollup: read, detail: read.String()})
+	if !tr.End.Before(end) {
+		parts = append(parts, planPart{start: end, end: tr.End, detail: "not rolled up yet"})
+	}
+	return parts
+}
+
+// bestRollup returns the coarsest rollup of the series of a field computing
+// an aggregate exactly in windows of the given interval, or nil if there is
+// none. Counts, sums, minimums and maximums are computed from rollups whose
+// windows divide the interval, and means from a sum and a count rollup. Other
+// functions are only read from rollups of the same function and interval
+// when a single series is aggregated.
+func bestRollup(queries []storage.ContinuousQuery, keys []storage.SeriesKey, agg storage.AggregateOptions, interval time.Duration) *rollupRead {
+	source, field := keys[0].Measurement, keys[0].Field
+
+	var candidates []*rollupRead
+	var sums, counts []storage.ContinuousQuery
+	for _, cq := range queries {
+		if cq.Source != source || cq.ComputedUntil.IsZero() || interval%cq.Interval != 0 || !rollsUpField(cq, field) {
+			continue
+		}
+
+		switch {
+		case cq.Function == agg.Function && rollupReaggregates[agg.Function] != "":
+			candidates = append(candidates, &rollupRead{queries: []storage.ContinuousQuery{cq}, function: rollupReaggregates[agg.Function]})
+		case cq.Function == agg.Function && cq.Percentile == agg.Percentile && cq.Interval == interval && len(keys) == 1:
+			// Each window holds the single rollup point of the series
+			candidates = append(candidates, &rollupRead{queries: []storage.ContinuousQuery{cq}, function: storage.AggregateFirst})
+		}
+
+		switch cq.Function {
+		case storage.AggregateSum:
+			sums = append(sums, cq)
+		case storage.AggregateCount:
+			counts = append(counts, cq)
+		}
+	}
+	if agg.Function == storage.AggregateMean {
+		for _, sum := range sums {
+			for _, count := range counts {
+				if sum.Interval == count.Interval {
+					candidates = append(candidates, &rollupRead{queries: []storage.ContinuousQuery{sum, count}, function: storage.AggregateSum})
+				}
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	for _, c := range candidates {
+		c.from, c.until = c.queries[0].ComputedFrom, c.queries[0].ComputedUntil
+		for _, cq := range c.queries[1:] {
+			if cq.ComputedFrom.After(c.from) {
+				c.from = cq.ComputedFrom
+			}
+			if cq.ComputedUntil.Before(c.until) {
+				c.until = cq.ComputedUntil
+			}
+		}
+	}
+
+	// The coarsest windows are read first, then the rollup covering the most
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.interval() != b.interval() {
+			return a.interval() > b.interval()
+		}
+		if !a.from.Equal(b.from) {
+			return a.from.Before(b.from)
+		}
+		return a.String() < b.String()
+	})
+	return candidates[0]
+}
+
+// rollsUpField reports whether a continuous query rolls up a field
+func rollsUpField(cq storage.ContinuousQuery, field string) bool {
+	if len(cq.Fields) == 0 {
+		return true
+	}
+	for _, f := range cq.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// alignWindow returns the start of the window of width d containing t,
+// aligned to the Unix epoch
+func alignWindow(t time.Time, d time.Duration) time.Time {
+	ns, step := t.UnixNano(), int64(d)
+	start := ns - ns%step
+	if ns%step < 0 {
+		start -= step
+	}
+	return time.Unix(0, start).UTC()
+}
+
+// readPlan computes the windows of an aggregate column part by part as
+// planned, and fills in the missing windows once they are merged
+func (e *Executor) readPlan(ctx context.Context, keys []storage.SeriesKey, agg storage.AggregateOptions, parts []planPart, tr TimeRange) ([]storage.WindowAggregate, error) {
+	opts := agg
+	opts.Fill = ""
+
+	var result []storage.WindowAggregate
+	for _, part := range parts {
+		var windows []storage.WindowAggregate
+		var err error
+		if part.rollup != nil {
+			windows, err = e.readRollup(ctx, keys, part, agg.Window)
+		} else {
+			windows, err = e.storage.AggregateSeries(ctx, keys, part.start, part.end, opts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, windows...)
+	}
+
+	filled, err := storage.FillWindows(result, tr.Start, tr.End, agg)
+	if err != nil {
+		return nil, asValidationError(err)
+	}
+	return filled, nil
+}
+
+// readRollup computes the windows of a part from the rollups of the series
+func (e *Executor) readRollup(ctx context.Context, keys []storage.SeriesKey, part planPart, interval time.Duration) ([]storage.WindowAggregate, error) {
+	opts := storage.AggregateOptions{Function: part.rollup.function, Window: interval}
+
+	var results [][]storage.WindowAggregate
+	for _, cq := range part.rollup.queries {
+		rollupKeys := make([]storage.SeriesKey, len(keys))
+		for i, key := range keys {
+			rollupKeys[i] = storage.SeriesKey{Measurement: cq.Target, Tags: key.Tags, Field: key.Field}
+		}
+		windows, err := e.storage.AggregateSeries(ctx, rollupKeys, part.start, part.end, opts)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, windows)
+	}
+	if len(results) == 1 {
+		return results[0], nil
+	}
+
+	// A mean divides the sum of each window by its count
+	counts := make(map[int64]float64, len(results[1]))
+	for _, w := range results[1] {
+		counts[w.Start.UnixNano()] = w.Value
+	}
+	means := make([]storage.WindowAggregate, 0, len(results[0]))
+	for _, w := range results[0] {
+		if n := counts[w.Start.UnixNano()]; n > 0 {
+			means = append(means, storage.WindowAggregate{Start: w.Start, Value: w.Value / n, Count: int(n)})
+		}
+	}
+	return means, nil
+}
+
+// explainColumns are the columns of the rows returned by EXPLAIN
+var explainColumns = []string{"column", "read", "measurement", "start", "end", "detail"}
+
+// executeExplain describes where each column of a SELECT statement is read
+// from, for each source and group, without reading any value. Aggregates
+// return one row per part of the time range read from rollups or raw points.
+func (e *Executor) executeExplain(stmt *ExplainStatement) (*Result, error) {
+	sel := stmt.Statement
+	now := e.now().UTC()
+
+	tr, tagCond, err := splitCondition(sel.Condition, now)
+	if err != nil {
+		return nil, asValidationError(err)
+	}
+	interval := sel.GroupByInterval()
+	if interval > 0 && tr.IsZeroEnd() {
+		tr.End = now
+	}
+
+	call, err := topCall(sel)
+	if err != nil {
+		return nil, asValidationError(err)
+	}
+	if hasExpressions(sel) || call != nil {
+		return nil, errors.NewValidationError("EXPLAIN does not support field expressions or selectors")
+	}
+
+	queries := e.storage.ContinuousQueries()
+	result := &Result{Series: []*Row{}}
+	for _, source := range sel.Sources {
+		fields, err := e.sourceFields(source)
+		if err != nil {
+			return nil, err
+		}
+
+		columns, aggregate, err := resolveColumns(sel, fields)
+		if err != nil {
+			return nil, asValidationError(err)
+		}
+		if err := validateTagCondition(tagCond, fields); err != nil {
+			return nil, asValidationError(err)
+		}
+
+		keys, err := e.findSeries(source, tagCond)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range groupSeries(sel, keys) {
+			row := &Row{Name: source, Tags: group.tags, Columns: explainColumns, Values: [][]interface{}{}}
+			for _, c := range columns {
+				var fieldKeys []storage.SeriesKey
+				for _, key := range group.series {
+					if key.Field == c.field {
+						fieldKeys = append(fieldKeys, key)
+					}
+				}
+				if len(fieldKeys) == 0 {
+					continue
+				}
+
+				if !aggregate {
+					row.Values = append(row.Values, explainRow(c.name, source, planPart{start: tr.Start, end: tr.End, detail: "raw points"}))
+					continue
+				}
+				for _, part := range planAggregate(queries, fieldKeys, c.agg, c.rate, tr, interval) {
+					row.Values = append(row.Values, explainRow(c.name, source, part))
+				}
+			}
+			if len(row.Values) > 0 {
+				result.Series = append(result.Series, row)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// explainRow returns the EXPLAIN values of one part of a column. Unbounded
+// sides of the range are null.
+func explainRow(name, source string, part planPart) []interface{} {
+	read, measurement := "raw", source
+	if part.rollup != nil {
+		read, measurement = "rollup", part.rollup.measurements()
+	}
+
+	var start, end interface{}
+	if !part.start.Equal(MinTime) {
+		start = part.start.UTC()
+	}
+	if !part.end.Equal(MaxTime) {
+		end = part.end.UTC()
+	}
+	return []interface{}{name, read, measurement, start, end, part.detail}
+}
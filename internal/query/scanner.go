@@ -0,0 +1,294 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Scanner is a lexical scanner for the query language
+type Scanner struct {
+	input string
+	pos   int
+	// width is the number of bytes taken by the last rune read, one for an
+	// invalid UTF-8 byte
+	width int
+}
+
+// NewScanner returns a new scanner over the given input
+func NewScanner(input string) *Scanner {
+	return &Scanner{input: input}
+}
+
+// read returns the next rune, or eof when the input is exhausted
+func (s *Scanner) read() rune {
+	if s.pos >= len(s.input) {
+		s.pos++
+		s.width = 1
+		return eof
+	}
+	ch, width := utf8.DecodeRuneInString(s.input[s.pos:])
+	s.pos += width
+	s.width = width
+	return ch
+}
+
+// unread moves the scanner back by the last rune read
+func (s *Scanner) unread() {
+	s.pos -= s.width
+}
+
+// peek returns the next rune without consuming it
+func (s *Scanner) peek() rune {
+	ch := s.read()
+	s.unread()
+	return ch
+}
+
+// Scan returns the next token, its starting position and its literal value
+func (s *Scanner) Scan() (tok Token, pos int, lit string) {
+	pos = s.pos
+	ch := s.read()
+
+	switch {
+	case ch == eof:
+		return EOF, pos, ""
+	case isWhitespace(ch):
+		s.unread()
+		return s.scanWhitespace()
+	case isLetter(ch) || ch == '_':
+		s.unread()
+		return s.scanIdent()
+	case isDigit(ch) || (ch == '.' && isDigit(s.peek())):
+		s.unread()
+		return s.scanNumber()
+	}
+
+	switch ch {
+	case '"':
+		s.unread()
+		return s.scanQuotedIdent()
+	case '\'':
+		s.unread()
+		return s.scanString()
+	case '+':
+		return ADD, pos, ""
+	case '-':
+		return SUB, pos, ""
+	case '*':
+		return MUL, pos, ""
+	case '/':
+		return DIV, pos, ""
+	case '%':
+		return MOD, pos, ""
+	case '.':
+		return DOT, pos, ""
+	case '=':
+		if s.peek() == '~' {
+			s.read()
+			return EQREGEX, pos, ""
+		}
+		return EQ, pos, ""
+	case '!':
+		switch s.peek() {
+		case '=':
+			s.read()
+			return NEQ, pos, ""
+		case '~':
+			s.read()
+			return NEQREGEX, pos, ""
+		}
+	case '<':
+		switch s.peek() {
+		case '=':
+			s.read()
+			return LTE, pos, ""
+		case '>':
+			s.read()
+			return NEQ, pos, ""
+		}
+		return LT, pos, ""
+	case '>':
+		if s.peek() == '=' {
+			s.read()
+			return GTE, pos, ""
+		}
+		return GT, pos, ""
+	case '(':
+		return LPAREN, pos, ""
+	case ')':
+		return RPAREN, pos, ""
+	case ',':
+		return COMMA, pos, ""
+	case ';':
+		return SEMICOLON, pos, ""
+	}
+
+	return ILLEGAL, pos, string(ch)
+}
+
+// ScanRegex scans a regular expression delimited by slashes.
+// The parser calls it after an =~ or !~ operator.
+func (s *Scanner) ScanRegex() (tok Token, pos int, lit string) {
+	// Skip leading whitespace
+	for isWhitespace(s.peek()) {
+		s.read()
+	}
+
+	pos = s.pos
+	if ch := s.read(); ch != '/' {
+		s.unread()
+		return ILLEGAL, pos, string(ch)
+	}
+
+	var buf strings.Builder
+	for {
+		ch := s.read()
+		switch ch {
+		case eof:
+			return ILLEGAL, pos, buf.String()
+		case '\\':
+			// Only an escaped slash loses its backslash; other escapes belong to the regex
+			if next := s.read(); next == '/' {
+				buf.WriteRune('/')
+			} else {
+				s.unread()
+				buf.WriteRune('\\')
+			}
+		case '/':
+			return REGEX, pos, buf.String()
+		default:
+			buf.WriteRune(ch)
+		}
+	}
+}
+
+// scanWhitespace consumes a run of whitespace
+func (s *Scanner) scanWhitespace() (Token, int, string) {
+	pos := s.pos
+	for {
+		ch := s.read()
+		if !isWhitespace(ch) {
+			s.unread()
+			break
+		}
+	}
+	return WS, pos, s.input[pos:s.pos]
+}
+
+// scanIdent consumes an identifier or keyword
+func (s *Scanner) scanIdent() (Token, int, string) {
+	pos := s.pos
+	for {
+		ch := s.read()
+		if !isIdentChar(ch) {
+			s.unread()
+			break
+		}
+	}
+
+	lit := s.input[pos:s.pos]
+	return Lookup(lit), pos, lit
+}
+
+// scanQuotedIdent consumes a double-quoted identifier
+func (s *Scanner) scanQuotedIdent() (Token, int, string) {
+	pos := s.pos
+	lit, ok := s.scanDelimited('"')
+	if !ok {
+		return BADSTRING, pos, lit
+	}
+	return IDENT, pos, lit
+}
+
+// scanString consumes a single-quoted string literal
+func (s *Scanner) scanString() (Token, int, string) {
+	pos := s.pos
+	lit, ok := s.scanDelimited('\'')
+	if !ok {
+		return BADSTRING, pos, lit
+	}
+	return STRING, pos, lit
+}
+
+// scanDelimited reads a literal enclosed in the given quote character.
+// Backslash escapes the quote character and backslash itself.
+func (s *Scanner) scanDelimited(quote rune) (string, bool) {
+	s.read() // opening quote
+
+	var buf strings.Builder
+	for {
+		ch := s.read()
+		switch ch {
+		case eof, '\n':
+			return buf.String(), false
+		case quote:
+			return buf.String(), true
+		case '\\':
+			next := s.read()
+			if next == quote || next == '\\' {
+				buf.WriteRune(next)
+			} else {
+				s.unread()
+				buf.WriteRune('\\')
+			}
+		default:
+			buf.WriteRune(ch)
+		}
+	}
+}
+
+// scanNumber consumes an integer, float or duration literal
+func (s *Scanner) scanNumber() (Token, int, string) {
+	pos := s.pos
+	isFloat := false
+
+	for {
+		ch := s.read()
+		if isDigit(ch) {
+			continue
+		}
+		if ch == '.' && !isFloat {
+			isFloat = true
+			continue
+		}
+		s.unread()
+		break
+	}
+
+	// A number directly followed by letters is a duration such as 10s or 1h30m
+	if isLetter(s.peek()) || s.peek() == 'µ' {
+		for {
+			ch := s.read()
+			if !isLetter(ch) && !isDigit(ch) && ch != 'µ' {
+				s.unread()
+				break
+			}
+		}
+		return DURATION, pos, s.input[pos:s.pos]
+	}
+
+	if isFloat {
+		return NUMBER, pos, s.input[pos:s.pos]
+	}
+	return INTEGER, pos, s.input[pos:s.pos]
+}
+
+// eof is returned by read when the input is exhausted
+const eof = rune(0)
+
+func isWhitespace(ch rune) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
+func isLetter(ch rune) bool {
+	return ch != 'µ' && unicode.IsLetter(ch)
+}
+
+func isDigit(ch rune) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isIdentChar(ch rune) bool {
+	return isLetter(ch) || isDigit(ch) || ch == '_'
+}
@@ -0,0 +1,226 @@
+package query
+
+import (
+	"sort"
+	"timeseriesdb/internal/storage"
+)
+
+// executeShowMeasurements lists the measurements with series matching the condition
+func (e *Executor) executeShowMeasurements(stmt *ShowMeasurementsStatement) (*Result, error) {
+	filter, err := e.seriesFilter("", stmt.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := e.storage.Measurements(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	row := &Row{Name: "measurements", Columns: []string{"name"}}
+	for _, name := range names {
+		row.Values = append(row.Values, []interface{}{name})
+	}
+	applyLimit(row, stmt.Limit, stmt.Offset)
+
+	return showResult(row), nil
+}
+
+// executeShowTagKeys lists the tag keys of each measurement
+func (e *Executor) executeShowTagKeys(stmt *ShowTagKeysStatement) (*Result, error) {
+	keys := make(map[string][]string)
+	for _, source := range showSources(stmt.Sources) {
+		filter, err := e.seriesFilter(source, stmt.Condition)
+		if err != nil {
+			return nil, err
+		}
+
+		sourceKeys, err := e.storage.TagKeys(filter)
+		if err != nil {
+			return nil, err
+		}
+		for measurement, tagKeys := range sourceKeys {
+			keys[measurement] = tagKeys
+		}
+	}
+
+	var rows []*Row
+	for _, measurement := range sortedKeys(keys) {
+		row := &Row{Name: measurement, Columns: []string{"tagKey"}}
+		for _, key := range keys[measurement] {
+			row.Values = append(row.Values, []interface{}{key})
+		}
+		applyLimit(row, stmt.Limit, stmt.Offset)
+		rows = append(rows, row)
+	}
+
+	return showResult(rows...), nil
+}
+
+// executeShowTagValues lists the values of the tag keys selected by WITH KEY
+func (e *Executor) executeShowTagValues(stmt *ShowTagValuesStatement) (*Result, error) {
+	values := make(map[string][]storage.TagKeyValue)
+	for _, source := range showSources(stmt.Sources) {
+		filter, err := e.seriesFilter(source, stmt.Condition)
+		if err != nil {
+			return nil, err
+		}
+
+		// Resolve the WITH KEY clause against the tag keys that exist
+		tagKeys, err := e.storage.TagKeys(filter)
+		if err != nil {
+			return nil, err
+		}
+		selected := make(map[string]bool)
+		for _, keys := range tagKeys {
+			for _, key := range keys {
+				if stmt.MatchTagKey(key) {
+					selected[key] = true
+				}
+			}
+		}
+		if len(selected) == 0 {
+			continue
+		}
+
+		sourceValues, err := e.storage.TagValues(filter, sortedKeys(selected))
+		if err != nil {
+			return nil, err
+		}
+		for measurement, pairs := range sourceValues {
+			values[measurement] = pairs
+		}
+	}
+
+	var rows []*Row
+	for _, measurement := range sortedKeys(values) {
+		row := &Row{Name: measurement, Columns: []string{"key", "value"}}
+		for _, pair := range values[measurement] {
+			row.Values = append(row.Values, []interface{}{pair.Key, pair.Value})
+		}
+		applyLimit(row, stmt.Limit, stmt.Offset)
+		rows = append(rows, row)
+	}
+
+	return showResult(rows...), nil
+}
+
+// executeShowFieldKeys lists the field keys of each measurement with their type
+func (e *Executor) executeShowFieldKeys(stmt *ShowFieldKeysStatement) (*Result, error) {
+	keys := make(map[string][]storage.FieldKey)
+	for _, source := range showSources(stmt.Sources) {
+		filter, err := e.seriesFilter(source, stmt.Condition)
+		if err != nil {
+			return nil, err
+		}
+
+		sourceKeys, err := e.storage.FieldKeys(filter)
+		if err != nil {
+			return nil, err
+		}
+		for measurement, fieldKeys := range sourceKeys {
+			keys[measurement] = fieldKeys
+		}
+	}
+
+	var rows []*Row
+	for _, measurement := range sortedKeys(keys) {
+		row := &Row{Name: measurement, Columns: []string{"fieldKey", "fieldType"}}
+		for _, key := range keys[measurement] {
+			row.Values = append(row.Values, []interface{}{key.Name, key.Type.String()})
+		}
+		applyLimit(row, stmt.Limit, stmt.Offset)
+		rows = append(rows, row)
+	}
+
+	return showResult(rows...), nil
+}
+
+// executeShowSeries lists the line protocol keys of the matching series
+func (e *Executor) executeShowSeries(stmt *ShowSeriesStatement) (*Result, error) {
+	seen := make(map[string]bool)
+	for _, source := range showSources(stmt.Sources) {
+		filter, err := e.seriesFilter(source, stmt.Condition)
+		if err != nil {
+			return nil, err
+		}
+
+		series, err := e.storage.Series(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range series {
+			seen[key] = true
+		}
+	}
+
+	row := &Row{Columns: []string{"key"}}
+	for _, key := range sortedKeys(seen) {
+		row.Values = append(row.Values, []interface{}{key})
+	}
+	applyLimit(row, stmt.Limit, stmt.Offset)
+
+	return showResult(row), nil
+}
+
+// seriesFilter translates the WHERE clause of a SHOW statement into a storage
+// filter. Single tag comparisons are resolved through the tag index and the
+// rest of the condition is evaluated against each remaining series.
+func (e *Executor) seriesFilter(measurement string, cond Expr) (storage.SeriesFilter, error) {
+	filter := storage.SeriesFilter{Measurement: measurement}
+
+	tr, tagCond, err := splitCondition(cond, e.now().UTC())
+	if err != nil {
+		return filter, asValidationError(err)
+	}
+	if err := validateTagCondition(tagCond, nil); err != nil {
+		return filter, asValidationError(err)
+	}
+
+	if !tr.IsZeroStart() {
+		filter.Start = tr.Start
+	}
+	if !tr.IsZeroEnd() {
+		filter.End = tr.End
+	}
+
+	matchers, residual := tagMatchers(tagCond)
+	filter.Matchers = matchers
+	if residual != nil {
+		filter.Predicate = func(tags map[string]string) bool {
+			return evalTagCondition(residual, tags)
+		}
+	}
+
+	return filter, nil
+}
+
+// showSources returns the measurements a SHOW statement inspects, where the
+// empty name stands for every measurement
+func showSources(sources []string) []string {
+	if len(sources) == 0 {
+		return []string{""}
+	}
+	return sources
+}
+
+// showResult builds a result from the rows that have values
+func showResult(rows ...*Row) *Result {
+	result := &Result{Series: []*Row{}}
+	for _, row := range rows {
+		if len(row.Values) > 0 {
+			result.Series = append(result.Series, row)
+		}
+	}
+	return result
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,237 @@
+// Package query implements a practical subset of the InfluxQL query language
+// together with an executor that evaluates statements against the storage engine
+package query
+
+import "strings"
+
+// Token represents a lexical token of the query language
+type Token int
+
+const (
+	// ILLEGAL represents an unrecognised token
+	ILLEGAL Token = iota
+	// EOF marks the end of the input
+	EOF
+	// WS represents whitespace
+	WS
+	// BADSTRING represents an unterminated string or quoted identifier
+	BADSTRING
+
+	literalBeg
+	// IDENT represents an identifier such as a measurement, field or tag key
+	IDENT
+	// NUMBER represents a floating point number
+	NUMBER
+	// INTEGER represents an integer number
+	INTEGER
+	// DURATION represents a duration literal such as 5m
+	DURATION
+	// STRING represents a single-quoted string
+	STRING
+	// REGEX represents a regular expression delimited by slashes
+	REGEX
+	literalEnd
+
+	operatorBeg
+	// ADD is the + operator
+	ADD
+	// SUB is the - operator
+	SUB
+	// MUL is the * operator
+	MUL
+	// DIV is the / operator
+	DIV
+	// MOD is the % operator
+	MOD
+
+	// AND is the AND operator
+	AND
+	// OR is the OR operator
+	OR
+
+	// EQ is the = operator
+	EQ
+	// NEQ is the != or <> operator
+	NEQ
+	// EQREGEX is the =~ operator
+	EQREGEX
+	// NEQREGEX is the !~ operator
+	NEQREGEX
+	// LT is the < operator
+	LT
+	// LTE is the <= operator
+	LTE
+	// GT is the > operator
+	GT
+	// GTE is the >= operator
+	GTE
+	operatorEnd
+
+	// LPAREN is (
+	LPAREN
+	// RPAREN is )
+	RPAREN
+	// COMMA is ,
+	COMMA
+	// SEMICOLON is ;
+	SEMICOLON
+	// DOT is the . separating a source from a field or tag key
+	DOT
+
+	keywordBeg
+	// AS is the AS keyword
+	AS
+	// ASC is the ASC keyword
+	ASC
+	// BY is the BY keyword
+	BY
+	// DESC is the DESC keyword
+	DESC
+	// EXPLAIN is the EXPLAIN keyword
+	EXPLAIN
+	// FIELD is the FIELD keyword
+	FIELD
+	// FROM is the FROM keyword
+	FROM
+	// GROUP is the GROUP keyword
+	GROUP
+	// IN is the IN keyword
+	IN
+	// KEY is the KEY keyword
+	KEY
+	// KEYS is the KEYS keyword
+	KEYS
+	// LIMIT is the LIMIT keyword
+	LIMIT
+	// MEASUREMENTS is the MEASUREMENTS keyword
+	MEASUREMENTS
+	// OFFSET is the OFFSET keyword
+	OFFSET
+	// ORDER is the ORDER keyword
+	ORDER
+	// SELECT is the SELECT keyword
+	SELECT
+	// SERIES is the SERIES keyword
+	SERIES
+	// SHOW is the SHOW keyword
+	SHOW
+	// TAG is the TAG keyword
+	TAG
+	// VALUES is the VALUES keyword
+	VALUES
+	// WHERE is the WHERE keyword
+	WHERE
+	// WITH is the WITH keyword
+	WITH
+	keywordEnd
+)
+
+var tokens = [...]string{
+	ILLEGAL:   "ILLEGAL",
+	EOF:       "EOF",
+	WS:        "WS",
+	BADSTRING: "BADSTRING",
+
+	IDENT:    "IDENT",
+	NUMBER:   "NUMBER",
+	INTEGER:  "INTEGER",
+	DURATION: "DURATION",
+	STRING:   "STRING",
+	REGEX:    "REGEX",
+
+	ADD: "+",
+	SUB: "-",
+	MUL: "*",
+	DIV: "/",
+	MOD: "%",
+
+	AND: "AND",
+	OR:  "OR",
+
+	EQ:       "=",
+	NEQ:      "!=",
+	EQREGEX:  "=~",
+	NEQREGEX: "!~",
+	LT:       "<",
+	LTE:      "<=",
+	GT:       ">",
+	GTE:      ">=",
+
+	LPAREN:    "(",
+	RPAREN:    ")",
+	COMMA:     ",",
+	SEMICOLON: ";",
+	DOT:       ".",
+
+	AS:           "AS",
+	ASC:          "ASC",
+	BY:           "BY",
+	DESC:         "DESC",
+	EXPLAIN:      "EXPLAIN",
+	FIELD:        "FIELD",
+	FROM:         "FROM",
+	GROUP:        "GROUP",
+	IN:           "IN",
+	KEY:          "KEY",
+	KEYS:         "KEYS",
+	LIMIT:        "LIMIT",
+	MEASUREMENTS: "MEASUREMENTS",
+	OFFSET:       "OFFSET",
+	ORDER:        "ORDER",
+	SELECT:       "SELECT",
+	SERIES:       "SERIES",
+	SHOW:         "SHOW",
+	TAG:          "TAG",
+	VALUES:       "VALUES",
+	WHERE:        "WHERE",
+	WITH:         "WITH",
+}
+
+var keywords map[string]Token
+
+func init() {
+	keywords = make(map[string]Token)
+	for tok := keywordBeg + 1; tok < keywordEnd; tok++ {
+		keywords[strings.ToLower(tokens[tok])] = tok
+	}
+	keywords["and"] = AND
+	keywords["or"] = OR
+}
+
+// String returns the string representation of the token
+func (tok Token) String() string {
+	if tok >= 0 && int(tok) < len(tokens) {
+		return tokens[tok]
+	}
+	return ""
+}
+
+// Precedence returns the operator precedence of a binary operator token
+func (tok Token) Precedence() int {
+	switch tok {
+	case OR:
+		return 1
+	case AND:
+		return 2
+	case EQ, NEQ, EQREGEX, NEQREGEX, LT, LTE, GT, GTE:
+		return 4
+	case ADD, SUB:
+		return 5
+	case MUL, DIV, MOD:
+		return 6
+	}
+	return 0
+}
+
+// isOperator reports whether the token is a binary operator
+func (tok Token) isOperator() bool {
+	return tok > operatorBeg && tok < operatorEnd
+}
+
+// Lookup returns the keyword token for ident, or IDENT if it is not a keyword
+func Lookup(ident string) Token {
+	if tok, ok := keywords[strings.ToLower(ident)]; ok {
+		return tok
+	}
+	return IDENT
+}
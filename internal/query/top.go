@@ -0,0 +1,182 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"timeseriesdb/internal/storage"
+)
+
+// topFuncs lists the selector functions returning the highest or lowest
+// ranked points or series
+var topFuncs = map[string]bool{"top": true, "bottom": true}
+
+// topCall returns the top() or bottom() call of a SELECT, if any. Selectors
+// decide which rows are returned, so they must be the only selected field.
+func topCall(stmt *SelectStatement) (*Call, error) {
+	var call *Call
+	for _, f := range stmt.Fields {
+		if c, ok := f.Expr.(*Call); ok && topFuncs[c.Name] {
+			call = c
+		}
+	}
+	if call == nil {
+		return nil, nil
+	}
+
+	for _, f := range stmt.Fields {
+		if f.Expr != call && !isTimeRef(f.Expr) {
+			return nil, fmt.Errorf("%s() cannot be combined with other fields", call.Name)
+		}
+	}
+	return call, nil
+}
+
+// topOptions validates the arguments of a top() or bottom() call and returns
+// the field it applies to along with the storage options. The first argument
+// is a field, ranking points, or an aggregate of a field, ranking series. It
+// is followed by the tags series are ranked by, if any, and the number of
+// values to return.
+func topOptions(call *Call) (string, storage.TopOptions, error) {
+	opts := storage.TopOptions{Bottom: call.Name == "bottom"}
+	if len(call.Args) < 2 {
+		return "", opts, fmt.Errorf("%s() expects a field, optional tags and a count", call.Name)
+	}
+
+	k, ok := call.Args[len(call.Args)-1].(*IntegerLiteral)
+	if !ok || k.Val < 1 {
+		return "", opts, fmt.Errorf("%s() expects a positive integer as its last argument, got %s", call.Name, call.Args[len(call.Args)-1])
+	}
+	opts.K = int(k.Val)
+
+	for _, arg := range call.Args[1 : len(call.Args)-1] {
+		tag, ok := arg.(*VarRef)
+		if !ok || tag.Source != "" || isTimeRef(tag) {
+			return "", opts, fmt.Errorf("%s() expects tag names, got %s", call.Name, arg)
+		}
+		opts.By = append(opts.By, tag.Val)
+	}
+
+	switch arg := call.Args[0].(type) {
+	case *VarRef:
+		if arg.Source != "" || isTimeRef(arg) {
+			return "", opts, fmt.Errorf("%s() expects a field name, got %s", call.Name, arg)
+		}
+		return arg.Val, opts, nil
+	case *Call:
+		field, agg, err := aggregateOptions(arg)
+		if err != nil {
+			return "", opts, err
+		}
+		opts.Aggregate = &agg
+		return field, opts, nil
+	}
+	return "", opts, fmt.Errorf("%s() expects a field or an aggregate, got %s", call.Name, call.Args[0])
+}
+
+// executeTop runs a SELECT of top() or bottom(), ranking the series of each
+// group. Rows are returned in rank order, with a column per tag of the
+// ranked series.
+func (e *Executor) executeTop(ctx context.Context, stmt *SelectStatement, call *Call, tr TimeRange, tagCond Expr, interval time.Duration) (*Result, error) {
+	field, opts, err := topOptions(call)
+	if err != nil {
+		return nil, asValidationError(err)
+	}
+	if interval > 0 {
+		return nil, asValidationError(fmt.Errorf("%s() does not support GROUP BY time", call.Name))
+	}
+	if stmt.Fill != "" {
+		return nil, asValidationError(fmt.Errorf("fill() requires GROUP BY time"))
+	}
+
+	name := call.Name
+	for _, f := range stmt.Fields {
+		if f.Expr == call {
+			name = f.Name()
+		}
+	}
+
+	result := &Result{Series: []*Row{}}
+	for _, source := range stmt.Sources {
+		fields, err := e.sourceFields(source)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateTagCondition(tagCond, fields); err != nil {
+			return nil, asValidationError(err)
+		}
+
+		keys, err := e.findSeries(source, tagCond)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range groupSeries(stmt, keys) {
+			var fieldKeys []storage.SeriesKey
+			for _, key := range group.series {
+				if key.Field == field {
+					fieldKeys = append(fieldKeys, key)
+				}
+			}
+			if len(fieldKeys) == 0 {
+				continue
+			}
+
+			ranked, err := e.storage.Top(ctx, fieldKeys, tr.Start, tr.End, opts)
+			if err != nil {
+				return nil, err
+			}
+
+			row := topRow(source, group, name, ranked, opts, tr)
+			applyLimit(row, stmt.Limit, stmt.Offset)
+			if len(row.Values) > 0 {
+				result.Series = append(result.Series, row)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// topRow returns the ranked values of a group in rank order. The tag columns
+// are the tags ranked by, or every tag of the ranked series.
+func topRow(name string, group *seriesGroup, column string, ranked []storage.RankedValue, opts storage.TopOptions, tr TimeRange) *Row {
+	tagKeys := opts.By
+	if len(tagKeys) == 0 {
+		seen := make(map[string]bool)
+		for _, r := range ranked {
+			for k := range r.Tags {
+				if !seen[k] {
+					seen[k] = true
+					tagKeys = append(tagKeys, k)
+				}
+			}
+		}
+		sort.Strings(tagKeys)
+	}
+
+	row := &Row{
+		Name:    name,
+		Tags:    group.tags,
+		Columns: append([]string{"time", column}, tagKeys...),
+		Values:  make([][]interface{}, 0, len(ranked)),
+	}
+	for _, r := range ranked {
+		ts := r.Timestamp.UTC()
+		// Aggregates over a range without a lower bound start at the epoch
+		if opts.Aggregate != nil && tr.IsZeroStart() {
+			ts = time.Unix(0, 0).UTC()
+		}
+		values := []interface{}{ts, r.Value}
+		for _, k := range tagKeys {
+			if v, ok := r.Tags[k]; ok {
+				values = append(values, v)
+			} else {
+				values = append(values, nil)
+			}
+		}
+		row.Values = append(row.Values, values)
+	}
+	return row
+}
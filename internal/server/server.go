@@ -2,13 +2,16 @@ package server
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"runtime"
 	"strconv"
 	"time"
 	aphttp "timeseriesdb/internal/api/http"
+	"timeseriesdb/internal/api/opentsdb"
 	"timeseriesdb/internal/config"
 	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/ingestion"
 	"timeseriesdb/internal/logger"
 	"timeseriesdb/internal/metrics"
 	"timeseriesdb/internal/storage"
@@ -22,6 +25,10 @@ type Server struct {
 	startTime  time.Time
 	status     int   // 0=stopped, 1=starting, 2=running, 3=shutting_down, 4=stopped
 	connCount  int64 // active connection count
+
+	// telnetServer accepts OpenTSDB telnet connections when a bind address
+	// is configured
+	telnetServer *opentsdb.TelnetServer
 }
 
 // NewServer creates a new server instance
@@ -37,11 +44,23 @@ func NewServer(cfg *config.Config) (*Server, error) {
 	// Initialize metrics system
 	metrics.Init()
 
+	// An unset write precision keeps the nanosecond default
+	var writePrecision time.Duration
+	if cfg.Server.WritePrecision != "" {
+		var err error
+		if writePrecision, err = ingestion.ParsePrecision(cfg.Server.WritePrecision); err != nil {
+			return nil, errors.Wrap(err, "invalid write precision")
+		}
+	}
+
 	// Initialize storage with configuration
 	storageInstance := storage.NewStorage(cfg.Storage)
 
 	// Initialize API router
-	router := aphttp.NewRouter(storageInstance)
+	router := aphttp.NewRouterWithOptions(storageInstance, aphttp.RouterOptions{
+		WritePrecision: writePrecision,
+		QueryTimeout:   cfg.Server.QueryTimeout,
+	})
 
 	// Use custom mux for testing isolation
 	mux := router.GetMux()
@@ -57,11 +76,12 @@ func NewServer(cfg *config.Config) (*Server, error) {
 
 	// Create server instance
 	server := &Server{
-		httpServer: httpServer,
-		storage:    storageInstance,
-		config:     cfg,
-		startTime:  time.Now(),
-		status:     1, // starting
+		httpServer:   httpServer,
+		telnetServer: opentsdb.NewTelnetServer(storageInstance),
+		storage:      storageInstance,
+		config:       cfg,
+		startTime:    time.Now(),
+		status:       1, // starting
 	}
 
 	// Initialize server metrics
@@ -86,6 +106,20 @@ func (s *Server) Start() error {
 	// Start metrics collection goroutine
 	go s.collectMetrics()
 
+	if addr := s.config.Server.OpenTSDBBindAddress; addr != "" {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return errors.WrapWithType(err, errors.ErrorTypeNetwork, "failed to listen for OpenTSDB telnet connections")
+		}
+		logger.Infof("OpenTSDB telnet listener on %s", ln.Addr())
+		go func() {
+			if err := s.telnetServer.Serve(ln); err != nil {
+				logger.Errorf("OpenTSDB telnet listener error: %v", err)
+				metrics.ServerErrors.WithLabelValues("serve_error", "opentsdb_telnet").Inc()
+			}
+		}()
+	}
+
 	return s.httpServer.ListenAndServe()
 }
 
@@ -95,6 +129,11 @@ func (s *Server) Close() error {
 	s.status = 4 // stopped
 	metrics.ServerStatus.WithLabelValues().Set(float64(s.status))
 
+	// Stop writes from telnet clients before the storage closes
+	if s.telnetServer != nil {
+		s.telnetServer.Close()
+	}
+
 	if s.storage != nil {
 		s.storage.Close()
 		// Update storage connection status
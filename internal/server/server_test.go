@@ -1,9 +1,13 @@
 package server
 
 import (
+	"bufio"
 	"context"
+	"fmt"
+	"net"
 	"net/http"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 	"timeseriesdb/internal/config"
@@ -205,6 +209,13 @@ func TestServerWithInvalidConfig(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error when creating server with nil config")
 	}
+
+	// Test with an unknown write precision
+	cfg := helpers.Config.CreateTestConfig(t)
+	cfg.Server.WritePrecision = "days"
+	if _, err := NewServer(cfg); err == nil {
+		t.Error("Expected error when creating server with an invalid write precision")
+	}
 }
 
 func TestServerConfigurationValidation(t *testing.T) {
@@ -1106,3 +1117,100 @@ func TestServerShutdownWithStorageErrors(t *testing.T) {
 		t.Error("Server goroutine did not finish in time")
 	}
 }
+
+func TestServerOpenTSDBTelnet(t *testing.T) {
+	defer metrics.Reset()
+
+	// Create test configuration with the telnet listener enabled
+	cfg := helpers.Config.CreateTestConfig(t)
+	cfg.Server = config.ServerConfig{
+		Port:                "8104",
+		ReadTimeout:         5 * time.Second,
+		WriteTimeout:        5 * time.Second,
+		IdleTimeout:         10 * time.Second,
+		OpenTSDBBindAddress: "127.0.0.1:14242",
+	}
+
+	// Create server
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	// Start server in background
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+
+	// Wait for the telnet listener to accept connections
+	var conn net.Conn
+	for i := 0; i < 50; i++ {
+		if conn, err = net.Dial("tcp", "127.0.0.1:14242"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Failed to connect to the telnet listener: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprint(conn, "put sys.load 1700000000 0.5 host=web01\nput sys.load 1700000010 x\n")
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read reply: %v", err)
+	}
+	if !strings.HasPrefix(reply, "put: line 2, column 25: invalid value 'x'") {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+
+	points, err := server.storage.ReadPoints(context.Background(), "sys.load", nil, "value", time.Unix(1700000000, 0), time.Unix(1700000060, 0), 0)
+	if err != nil {
+		t.Fatalf("ReadPoints failed: %v", err)
+	}
+	if len(points) != 1 || points[0].Fields["value"] != 0.5 {
+		t.Errorf("Unexpected points %+v", points)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+
+	select {
+	case err := <-errChan:
+		if err != nil && err != http.ErrServerClosed {
+			t.Errorf("Unexpected server error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Server goroutine did not finish in time")
+	}
+}
+
+func TestServerOpenTSDBTelnetInvalidAddress(t *testing.T) {
+	defer metrics.Reset()
+
+	cfg := helpers.Config.CreateTestConfig(t)
+	cfg.Server = config.ServerConfig{
+		Port:                "8105",
+		ReadTimeout:         5 * time.Second,
+		WriteTimeout:        5 * time.Second,
+		IdleTimeout:         10 * time.Second,
+		OpenTSDBBindAddress: "127.0.0.1:invalid",
+	}
+
+	server, err := NewServer(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Close()
+
+	// The listener fails before the HTTP server starts
+	if err := server.Start(); err == nil || !strings.Contains(err.Error(), "OpenTSDB telnet") {
+		t.Errorf("Expected a telnet listener error, got %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AggregateFunction names a function applied to the points of a time window
+type AggregateFunction string
+
+const (
+	// AggregateCount counts the points in a window
+	AggregateCount AggregateFunction = "count"
+	// AggregateSum sums the point values
+	AggregateSum AggregateFunction = "sum"
+	// AggregateMean averages the point values
+	AggregateMean AggregateFunction = "mean"
+	// AggregateMin returns the smallest value
+	AggregateMin AggregateFunction = "min"
+	// AggregateMax returns the largest value
+	AggregateMax AggregateFunction = "max"
+	// AggregateFirst returns the value of the oldest point
+	AggregateFirst AggregateFunction = "first"
+	// AggregateLast returns the value of the newest point
+	AggregateLast AggregateFunction = "last"
+	// AggregateStddev returns the sample standard deviation
+	AggregateStddev AggregateFunction = "stddev"
+	// AggregatePercentile returns the nearest-rank percentile given by AggregateOptions.Percentile
+	AggregatePercentile AggregateFunction = "percentile"
+)
+
+// aggregateFunctions lists the valid aggregate functions
+var aggregateFunctions = []AggregateFunction{
+	AggregateCount, AggregateSum, AggregateMean, AggregateMin, AggregateMax,
+	AggregateFirst, AggregateLast, AggregateStddev, AggregatePercentile,
+}
+
+// ParseAggregateFunction returns the aggregate function with the given name
+func ParseAggregateFunction(name string) (AggregateFunction, error) {
+	for _, fn := range aggregateFunctions {
+		if strings.EqualFold(name, string(fn)) {
+			return fn, nil
+		}
+	}
+	return "", fmt.Errorf("unknown aggregate function %q", name)
+}
+
+// AggregateOptions configures a windowed aggregation
+type AggregateOptions struct {
+	Function AggregateFunction
+	// Window is the width of the time windows, aligned to the Unix epoch.
+	// Zero aggregates the whole range into a single window starting at Start.
+	Window time.Duration
+	// Percentile is the percentile in the range [0, 100] for AggregatePercentile
+	Percentile float64
+	// Fill decides what is returned for the windows without points when
+	// Window is set. Empty means FillNone.
+	Fill FillMode
+	// FillValue is the value of the windows without points for FillConstant
+	FillValue float64
+}
+
+// Validate checks that the options describe a supported aggregation
+func (o AggregateOptions) Validate() error {
+	if _, err := ParseAggregateFunction(string(o.Function)); err != nil {
+		return err
+	}
+	if o.Window < 0 {
+		return fmt.Errorf("window must not be negative")
+	}
+	if o.Function == AggregatePercentile && (o.Percentile < 0 || o.Percentile > 100) {
+		return fmt.Errorf("percentile must be between 0 and 100, got %g", o.Percentile)
+	}
+	if o.Fill != "" {
+		if _, err := ParseFillMode(string(o.Fill)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AggregateRequest represents a windowed aggregation over one or more series of a shard
+type AggregateRequest struct {
+	SeriesIDs []string
+	Start     time.Time
+	End       time.Time
+	AggregateOptions
+}
+
+// WindowAggregate is the aggregated value of a single time window. Windows
+// filled in by a fill mode have a Count of zero, and Null is set for those
+// left without a value.
+type WindowAggregate struct {
+	Start time.Time
+	Value float64
+	Count int
+	Null  bool
+}
+
+// contains reports whether a timestamp falls within the request range
+func (r *AggregateRequest) contains(t time.Time) bool {
+	return !t.Before(r.Start) && !t.After(r.End)
+}
+
+// windowStart returns the start in nanoseconds of the window containing t
+func (r *AggregateRequest) windowStart(t time.Time) int64 {
+	if r.Window <= 0 {
+		return r.Start.UnixNano()
+	}
+	ns := t.UnixNano()
+	step := int64(r.Window)
+	start := ns - ns%step
+	if ns%step < 0 {
+		start -= step
+	}
+	return start
+}
+
+// seriesSet returns the requested series IDs as a set
+func (r *AggregateRequest) seriesSet() map[string]bool {
+	set := make(map[string]bool, len(r.SeriesIDs))
+	for _, id := range r.SeriesIDs {
+		set[id] = true
+	}
+	return set
+}
+
+// windowState is the partial aggregate of one window. States of the same
+// window computed over different points can be merged, so memstores,
+// segments and shards each only hand back one state per window.
+type windowState struct {
+	count     int
+	sum       float64
+	mean      float64
+	m2        float64
+	min       float64
+	max       float64
+	firstTime time.Time
+	first     float64
+	lastTime  time.Time
+	last      float64
+	// values is only kept for percentiles, which cannot be merged otherwise
+	values []float64
+}
+
+// add folds a single point into the state
+func (w *windowState) add(p DataPoint, keepValues bool) {
+	w.count++
+	w.sum += p.Value
+
+	// Welford's online update of the mean and sum of squared deviations
+	delta := p.Value - w.mean
+	w.mean += delta / float64(w.count)
+	w.m2 += delta * (p.Value - w.mean)
+
+	if w.count == 1 || p.Value < w.min {
+		w.min = p.Value
+	}
+	if w.count == 1 || p.Value > w.max {
+		w.max = p.Value
+	}
+	if w.count == 1 || p.Timestamp.Before(w.firstTime) {
+		w.firstTime, w.first = p.Timestamp, p.Value
+	}
+	if w.count == 1 || !p.Timestamp.Before(w.lastTime) {
+		w.lastTime, w.last = p.Timestamp, p.Value
+	}
+	if keepValues {
+		w.values = append(w.values, p.Value)
+	}
+}
+
+// merge combines another partial state of the same window into w
+func (w *windowState) merge(o *windowState) {
+	if o.count == 0 {
+		return
+	}
+	if w.count == 0 {
+		*w = *o
+		w.values = append([]float64(nil), o.values...)
+		return
+	}
+
+	// Chan et al. parallel combination of mean and squared deviations
+	n := float64(w.count + o.count)
+	delta := o.mean - w.mean
+	w.m2 += o.m2 + delta*delta*float64(w.count)*float64(o.count)/n
+	w.mean += delta * float64(o.count) / n
+
+	w.count += o.count
+	w.sum += o.sum
+	w.min = math.Min(w.min, o.min)
+	w.max = math.Max(w.max, o.max)
+	if o.firstTime.Before(w.firstTime) {
+		w.firstTime, w.first = o.firstTime, o.first
+	}
+	if !o.lastTime.Before(w.lastTime) {
+		w.lastTime, w.last = o.lastTime, o.last
+	}
+	w.values = append(w.values, o.values...)
+}
+
+// result computes the final value of the window. It reports false when the
+// function is undefined for the window, such as stddev over a single point.
+func (w *windowState) result(opts AggregateOptions) (float64, bool) {
+	if w.count == 0 {
+		return 0, false
+	}
+
+	switch opts.Function {
+	case AggregateCount:
+		return float64(w.count), true
+	case AggregateSum:
+		return w.sum, true
+	case AggregateMean:
+		return w.sum / float64(w.count), true
+	case AggregateMin:
+		return w.min, true
+	case AggregateMax:
+		return w.max, true
+	case AggregateFirst:
+		return w.first, true
+	case AggregateLast:
+		return w.last, true
+	case AggregateStddev:
+		if w.count < 2 {
+			return 0, false
+		}
+		return math.Sqrt(w.m2 / float64(w.count-1)), true
+	case AggregatePercentile:
+		sorted := append([]float64(nil), w.values...)
+		sort.Float64s(sorted)
+		i := int(math.Floor(float64(len(sorted))*opts.Percentile/100+0.5)) - 1
+		if i < 0 {
+			i = 0
+		} else if i >= len(sorted) {
+			i = len(sorted) - 1
+		}
+		return sorted[i], true
+	}
+	return 0, false
+}
+
+// windowAggregates maps window start times in nanoseconds to partial states
+type windowAggregates map[int64]*windowState
+
+// add folds a point into the state of its window
+func (wa windowAggregates) add(req *AggregateRequest, p DataPoint) {
+	start := req.windowStart(p.Timestamp)
+	state, ok := wa[start]
+	if !ok {
+		state = &windowState{}
+		wa[start] = state
+	}
+	state.add(p, req.Function == AggregatePercentile)
+}
+
+// merge combines the windows of another set of partial states into wa
+func (wa windowAggregates) merge(o windowAggregates) {
+	for start, state := range o {
+		if existing, ok := wa[start]; ok {
+			existing.merge(state)
+		} else {
+			wa[start] = state
+		}
+	}
+}
+
+// results finalizes the windows in time order
+func (wa windowAggregates) results(opts AggregateOptions) []WindowAggregate {
+	starts := make([]int64, 0, len(wa))
+	for start := range wa {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	results := make([]WindowAggregate, 0, len(starts))
+	for _, start := range starts {
+		state := wa[start]
+		value, ok := state.result(opts)
+		if !ok {
+			continue
+		}
+		results = append(results, WindowAggregate{
+			Start: time.Unix(0, start).UTC(),
+			Value: value,
+			Count: state.count,
+		})
+	}
+	return results
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// aggregatePoints returns points one second apart with the given values
+func aggregatePoints(base time.Time, values ...float64) []DataPoint {
+	points := make([]DataPoint, 0, len(values))
+	for i, v := range values {
+		points = append(points, DataPoint{Timestamp: base.Add(time.Duration(i) * time.Second), Value: v})
+	}
+	return points
+}
+
+func TestParseAggregateFunction(t *testing.T) {
+	fn, err := ParseAggregateFunction("StdDev")
+	if err != nil {
+		t.Fatalf("ParseAggregateFunction failed: %v", err)
+	}
+	if fn != AggregateStddev {
+		t.Errorf("Expected %s, got %s", AggregateStddev, fn)
+	}
+
+	if _, err := ParseAggregateFunction("median"); err == nil {
+		t.Error("Expected an error for an unknown function")
+	}
+}
+
+func TestAggregateOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  AggregateOptions
+		valid bool
+	}{
+		{"count", AggregateOptions{Function: AggregateCount}, true},
+		{"unknown function", AggregateOptions{Function: "median"}, false},
+		{"negative window", AggregateOptions{Function: AggregateSum, Window: -time.Second}, false},
+		{"percentile", AggregateOptions{Function: AggregatePercentile, Percentile: 99.9}, true},
+		{"percentile out of range", AggregateOptions{Function: AggregatePercentile, Percentile: 120}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("Expected valid options, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestWindowStateResult(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	state := &windowState{}
+	for _, p := range aggregatePoints(base, 4, 2, 9, 5) {
+		state.add(p, true)
+	}
+
+	tests := []struct {
+		opts AggregateOptions
+		want float64
+	}{
+		{AggregateOptions{Function: AggregateCount}, 4},
+		{AggregateOptions{Function: AggregateSum}, 20},
+		{AggregateOptions{Function: AggregateMean}, 5},
+		{AggregateOptions{Function: AggregateMin}, 2},
+		{AggregateOptions{Function: AggregateMax}, 9},
+		{AggregateOptions{Function: AggregateFirst}, 4},
+		{AggregateOptions{Function: AggregateLast}, 5},
+		{AggregateOptions{Function: AggregateStddev}, math.Sqrt(26.0 / 3)},
+		{AggregateOptions{Function: AggregatePercentile, Percentile: 50}, 4},
+		{AggregateOptions{Function: AggregatePercentile, Percentile: 100}, 9},
+		{AggregateOptions{Function: AggregatePercentile, Percentile: 0}, 2},
+	}
+
+	for _, tt := range tests {
+		got, ok := state.result(tt.opts)
+		if !ok {
+			t.Errorf("%s: expected a result", tt.opts.Function)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: expected %v, got %v", tt.opts.Function, tt.want, got)
+		}
+	}
+
+	single := &windowState{}
+	single.add(DataPoint{Timestamp: base, Value: 1}, false)
+	if _, ok := single.result(AggregateOptions{Function: AggregateStddev}); ok {
+		t.Error("Expected stddev of a single point to be undefined")
+	}
+}
+
+func TestWindowStateMerge(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	points := aggregatePoints(base, 3, 8, 1, 7, 6, 2)
+
+	whole := &windowState{}
+	for _, p := range points {
+		whole.add(p, true)
+	}
+
+	// Split the points out of order so first and last come from different parts
+	left, right := &windowState{}, &windowState{}
+	for _, p := range points[3:] {
+		left.add(p, true)
+	}
+	for _, p := range points[:3] {
+		right.add(p, true)
+	}
+	merged := &windowState{}
+	merged.merge(left)
+	merged.merge(right)
+
+	for _, fn := range aggregateFunctions {
+		opts := AggregateOptions{Function: fn, Percentile: 75}
+		want, _ := whole.result(opts)
+		got, ok := merged.result(opts)
+		if !ok || math.Abs(got-want) > 1e-9 {
+			t.Errorf("%s: expected %v after merge, got %v", fn, want, got)
+		}
+	}
+}
+
+func TestWindowAggregatesResults(t *testing.T) {
+	base := time.Unix(1700000000, 0).UTC()
+	req := &AggregateRequest{
+		Start:            base,
+		End:              base.Add(time.Minute),
+		AggregateOptions: AggregateOptions{Function: AggregateSum, Window: 2 * time.Second},
+	}
+
+	windows := make(windowAggregates)
+	for _, p := range aggregatePoints(base, 1, 2, 3, 4, 5) {
+		windows.add(req, p)
+	}
+
+	results := windows.results(req.AggregateOptions)
+	want := []WindowAggregate{
+		{Start: base, Value: 3, Count: 2},
+		{Start: base.Add(2 * time.Second), Value: 7, Count: 2},
+		{Start: base.Add(4 * time.Second), Value: 5, Count: 1},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Expected %d windows, got %d", len(want), len(results))
+	}
+	for i := range want {
+		if !results[i].Start.Equal(want[i].Start) || results[i].Value != want[i].Value || results[i].Count != want[i].Count {
+			t.Errorf("Window %d: expected %+v, got %+v", i, want[i], results[i])
+		}
+	}
+
+	// Without a window every point falls into a single window at the range start
+	req.Window = 0
+	single := make(windowAggregates)
+	for _, p := range aggregatePoints(base.Add(10*time.Second), 1, 2) {
+		single.add(req, p)
+	}
+	if results := single.results(req.AggregateOptions); len(results) != 1 || !results[0].Start.Equal(base) {
+		t.Errorf("Expected one window starting at %v, got %+v", base, results)
+	}
+}
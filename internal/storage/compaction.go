@@ -20,6 +20,10 @@ type CompactionManager struct {
 	stopChan       chan struct{}
 	running        bool
 	metrics        *StorageMetrics
+	retention      RetentionFunc
+	tombstones     *TombstoneSet
+	// seriesDropped, if set, is given the series a compaction left without points
+	seriesDropped func(seriesIDs []string)
 }
 
 // compactionTask represents a compaction job
@@ -38,6 +42,10 @@ type CompactionConfig struct {
 	MaxSegmentSize      int64
 	CompactionInterval  time.Duration
 	MaxConcurrent       int
+	// Retention, if set, drops expired points from compacted segments
+	Retention RetentionFunc
+	// Tombstones, if set, are applied to the points of compacted segments
+	Tombstones *TombstoneSet
 }
 
 // NewCompactionManager creates a new compaction manager
@@ -62,9 +70,18 @@ func NewCompactionManager(config CompactionConfig, reader SegmentReaderInterface
 		stopChan:       make(chan struct{}),
 		running:        false,
 		metrics:        metrics,
+		retention:      config.Retention,
+		tombstones:     config.Tombstones,
 	}
 }
 
+// SetSeriesDropped sets a function called after each compaction with the
+// series that had points in the compacted segments but none in the result.
+// The series may still have points in other segments or in the memstore.
+func (cm *CompactionManager) SetSeriesDropped(fn func(seriesIDs []string)) {
+	cm.seriesDropped = fn
+}
+
 // Start starts the compaction manager
 func (cm *CompactionManager) Start() error {
 	cm.mu.Lock()
@@ -234,9 +251,17 @@ func (cm *CompactionManager) processCompactionTask(task compactionTask) error {
 		cm.metrics.RecordCompactionStart()
 	}
 
+	// Tombstones recorded from here on are not applied by this compaction,
+	// so the new segment only records those recorded so far
+	tombstoneSeq := cm.tombstones.Seq()
+
 	// Read all segments in the task
 	var allPoints map[string][]DataPoint
 	allPoints = make(map[string][]DataPoint)
+	compacted := make(map[string]bool)
+	// Points and bytes read, from which the bytes of expired points are estimated
+	readPoints := 0
+	readBytes := int64(0)
 
 	for _, segment := range task.Segments {
 		_, results, err := cm.segmentReader.ReadSegment(segment.Path)
@@ -246,18 +271,54 @@ func (cm *CompactionManager) processCompactionTask(task compactionTask) error {
 			}
 			return fmt.Errorf("failed to read segment %s: %w", segment.Path, err)
 		}
+		readBytes += segment.Size
 
 		// Merge points from all segments
 		for _, result := range results {
 			if result.Error != nil {
 				continue
 			}
+			compacted[result.SeriesID] = true
+			readPoints += len(result.Points)
+
+			// Drop the points deleted since the segment was written
+			points := cm.tombstones.Filter(result.SeriesID, result.Points, segment.TombstoneSeq)
+			if len(points) == 0 {
+				continue
+			}
 
 			if allPoints[result.SeriesID] == nil {
 				allPoints[result.SeriesID] = make([]DataPoint, 0)
 			}
-			allPoints[result.SeriesID] = append(allPoints[result.SeriesID], result.Points...)
+			allPoints[result.SeriesID] = append(allPoints[result.SeriesID], points...)
+		}
+	}
+
+	// Drop the points past the retention horizon
+	if cm.retention != nil {
+		points := dropExpiredPoints(allPoints, cm.retention)
+		if points > 0 && cm.metrics != nil {
+			// The expired points are assumed to take their share of the
+			// segments read
+			bytes := readBytes * int64(points) / int64(readPoints)
+			cm.metrics.RecordRetentionReclaimed("compaction", points, bytes)
+		}
+	}
+
+	// Every point expired or was deleted, so the segments are removed without a replacement
+	if len(allPoints) == 0 {
+		if err := cm.replaceSegments(task.Level, task.Segments, nil); err != nil {
+			if cm.metrics != nil {
+				cm.metrics.RecordCompactionError()
+			}
+			return fmt.Errorf("failed to replace segments: %w", err)
+		}
+		cm.pruneTombstones()
+		cm.reportDropped(compacted, allPoints)
+		if cm.metrics != nil {
+			cm.metrics.RecordCompactionComplete(startTime, nil)
 		}
+		return nil
 	}
 
 	// Sort points by timestamp for each series
@@ -276,6 +337,8 @@ func (cm *CompactionManager) processCompactionTask(task compactionTask) error {
 		MaxSize:   cm.levels[task.Level].MaxSize,
 		CreatedAt: time.Now(),
 		IsFlushed: false,
+		// The merged points have every tombstone recorded so far applied
+		TombstoneSeq: tombstoneSeq,
 	}
 
 	// Calculate size
@@ -300,6 +363,9 @@ func (cm *CompactionManager) processCompactionTask(task compactionTask) error {
 		return fmt.Errorf("failed to replace segments: %w", err)
 	}
 
+	cm.pruneTombstones()
+	cm.reportDropped(compacted, allPoints)
+
 	// Try to promote to next level if possible
 	if task.Level < len(cm.levels)-1 {
 		cm.tryPromoteSegment(task.Level, newSegment)
@@ -313,7 +379,51 @@ func (cm *CompactionManager) processCompactionTask(task compactionTask) error {
 	return nil
 }
 
-// replaceSegments replaces old segments with a new one
+// reportDropped passes the compacted series left without points to the
+// seriesDropped function
+func (cm *CompactionManager) reportDropped(compacted map[string]bool, kept map[string][]DataPoint) {
+	if cm.seriesDropped == nil {
+		return
+	}
+
+	var dropped []string
+	for seriesID := range compacted {
+		if _, ok := kept[seriesID]; !ok {
+			dropped = append(dropped, seriesID)
+		}
+	}
+	if len(dropped) > 0 {
+		sort.Strings(dropped)
+		cm.seriesDropped(dropped)
+	}
+}
+
+// pruneTombstones drops the tombstones that every segment has already applied
+func (cm *CompactionManager) pruneTombstones() {
+	if cm.tombstones == nil {
+		return
+	}
+
+	// Segments written from here on apply every tombstone recorded so far
+	applied := cm.tombstones.Seq()
+	segments, err := cm.segmentReader.ListSegments()
+	if err != nil {
+		logger.Warnf("Failed to list segments to prune tombstones: %v", err)
+		return
+	}
+	for _, segment := range segments {
+		if segment.TombstoneSeq < applied {
+			applied = segment.TombstoneSeq
+		}
+	}
+
+	if err := cm.tombstones.Prune(applied); err != nil {
+		logger.Warnf("Failed to prune tombstones: %v", err)
+	}
+}
+
+// replaceSegments replaces old segments with a new one, or removes them if
+// newSegment is nil
 func (cm *CompactionManager) replaceSegments(level int, oldSegments []*Segment, newSegment *Segment) error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
@@ -336,7 +446,9 @@ func (cm *CompactionManager) replaceSegments(level int, oldSegments []*Segment,
 	}
 
 	// Add new segment
-	newSegments = append(newSegments, newSegment)
+	if newSegment != nil {
+		newSegments = append(newSegments, newSegment)
+	}
 
 	// Sort by creation time
 	sort.Slice(newSegments, func(i, j int) bool {
@@ -367,6 +479,32 @@ func (cm *CompactionManager) replaceSegments(level int, oldSegments []*Segment,
 	return nil
 }
 
+// RemoveSegment drops a segment whose file was deleted from the level holding it
+func (cm *CompactionManager) RemoveSegment(id uint64) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for i, level := range cm.levels {
+		for j, segment := range level.Segments {
+			if segment.ID != id {
+				continue
+			}
+			level.Segments = append(level.Segments[:j:j], level.Segments[j+1:]...)
+
+			if cm.metrics != nil {
+				cm.metrics.RecordSegmentCount(i, len(level.Segments))
+
+				totalSize := int64(0)
+				for _, seg := range level.Segments {
+					totalSize += seg.Size
+				}
+				cm.metrics.RecordSegmentSize(i, totalSize)
+			}
+			return
+		}
+	}
+}
+
 // tryPromoteSegment tries to promote a segment to the next level
 func (cm *CompactionManager) tryPromoteSegment(currentLevel int, segment *Segment) {
 	if currentLevel >= len(cm.levels)-1 {
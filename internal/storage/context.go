@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+	stderrors "errors"
+	"timeseriesdb/internal/errors"
+)
+
+// contextCheckInterval is the number of points scanned between checks for a
+// canceled context
+const contextCheckInterval = 1024
+
+// contextError converts the error of a done context into an AppError: a
+// timeout error once the deadline has passed, and otherwise an error wrapping
+// context.Canceled. Other errors are returned unchanged.
+func contextError(err error) error {
+	switch {
+	case stderrors.Is(err, context.DeadlineExceeded):
+		return errors.WrapWithType(context.DeadlineExceeded, errors.ErrorTypeTimeout, "query timed out")
+	case stderrors.Is(err, context.Canceled):
+		return errors.WrapWithType(context.Canceled, errors.ErrorTypeInternal, "query canceled")
+	default:
+		return err
+	}
+}
+
+// CheckContext returns nil while ctx is live, and the AppError for its error
+// once it is done
+func CheckContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(err)
+	}
+	return nil
+}
+
+// isContextError reports whether err was caused by a done context
+func isContextError(err error) bool {
+	return stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded)
+}
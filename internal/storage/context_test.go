@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/types"
+)
+
+func TestCheckContext(t *testing.T) {
+	if err := CheckContext(context.Background()); err != nil {
+		t.Errorf("Expected a live context to pass, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := CheckContext(ctx)
+	if !stderrors.Is(err, context.Canceled) || errors.IsType(err, errors.ErrorTypeTimeout) {
+		t.Errorf("Expected a canceled error, got %v", err)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if err := CheckContext(ctx); !errors.IsType(err, errors.ErrorTypeTimeout) {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+}
+
+func TestStorageContext(t *testing.T) {
+	s := NewStorage(config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024})
+	defer s.Close()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		err := s.WritePoint(context.Background(), types.Point{Measurement: "cpu", Fields: map[string]interface{}{"value": float64(i)}, Timestamp: base.Add(time.Duration(i) * time.Minute)})
+		if err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+	// Spread the points over a segment and the memstore
+	if err := s.shards["default"].ForceFlush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := s.ReadPoints(ctx, "cpu", nil, "value", base, base.Add(time.Hour), 0); !stderrors.Is(err, context.Canceled) {
+		t.Errorf("Expected ReadPoints to be canceled, got %v", err)
+	}
+	if _, err := s.AggregateSeries(ctx, []SeriesKey{{Measurement: "cpu", Field: "value"}}, base, base.Add(time.Hour), AggregateOptions{Function: AggregateMean, Window: time.Minute}); !stderrors.Is(err, context.Canceled) {
+		t.Errorf("Expected AggregateSeries to be canceled, got %v", err)
+	}
+	if _, err := s.ReadRows(ctx, "cpu", nil, nil, base, base.Add(time.Hour), 0); !stderrors.Is(err, context.Canceled) {
+		t.Errorf("Expected ReadRows to be canceled, got %v", err)
+	}
+	if err := s.WritePoint(ctx, types.Point{Measurement: "cpu", Fields: map[string]interface{}{"value": 9.0}, Timestamp: base}); !stderrors.Is(err, context.Canceled) {
+		t.Errorf("Expected WritePoint to be canceled, got %v", err)
+	}
+
+	// The canceled write left the data untouched
+	points, err := s.ReadPoints(context.Background(), "cpu", nil, "value", base, base.Add(time.Hour), 0)
+	if err != nil || len(points) != 5 {
+		t.Errorf("Expected 5 points, got %d (err %v)", len(points), err)
+	}
+}
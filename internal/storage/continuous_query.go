@@ -0,0 +1,550 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/types"
+)
+
+// continuousQueriesFileName is the file in a database directory holding its
+// continuous queries
+const continuousQueriesFileName = "continuous_queries.json"
+
+// continuousQueryNamePattern restricts continuous query names
+var continuousQueryNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ContinuousQuery periodically aggregates the points of a source measurement
+// into windows written to a rollup measurement. Every series of the source
+// is rolled up into the series of the target with the same tags and field,
+// holding one point per window at the start of the window.
+type ContinuousQuery struct {
+	Name   string
+	Source string
+	Target string
+	// Fields lists the fields rolled up, empty for every field the function
+	// applies to
+	Fields     []string
+	Function   AggregateFunction
+	Percentile float64
+	// Interval is the width of the windows, aligned to the Unix epoch
+	Interval time.Duration
+	// Every is the time between runs, aligned to the Unix epoch. Zero runs
+	// once per Interval.
+	Every time.Duration
+	// For is how far back each run recomputes windows, so points arriving
+	// late are rolled up. Zero only computes the last completed window.
+	For time.Duration
+
+	// ComputedFrom and ComputedUntil bound the windows rolled up so far. The
+	// windows within For of the last run may still be recomputed.
+	ComputedFrom  time.Time
+	ComputedUntil time.Time
+	// LastRun is the time of the last successful run
+	LastRun time.Time
+}
+
+// withDefaults returns the query with Every and For set
+func (cq ContinuousQuery) withDefaults() ContinuousQuery {
+	if cq.Every == 0 {
+		cq.Every = cq.Interval
+	}
+	if cq.For == 0 {
+		cq.For = cq.Interval
+	}
+	return cq
+}
+
+// Validate checks that the query describes a supported rollup
+func (cq ContinuousQuery) Validate() error {
+	if !continuousQueryNamePattern.MatchString(cq.Name) {
+		return fmt.Errorf("invalid continuous query name %q: use 1 to 64 letters, digits, '_' or '-'", cq.Name)
+	}
+	if cq.Source == "" || cq.Target == "" {
+		return fmt.Errorf("a continuous query requires a source and a target measurement")
+	}
+	if cq.Source == cq.Target {
+		return fmt.Errorf("the target measurement must differ from the source measurement %q", cq.Source)
+	}
+	if cq.Interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %s", cq.Interval)
+	}
+	if cq.Every < 0 {
+		return fmt.Errorf("every must not be negative, got %s", cq.Every)
+	}
+	if cq.For != 0 && cq.For < cq.Interval {
+		return fmt.Errorf("for must be at least the interval %s, got %s", cq.Interval, cq.For)
+	}
+	return cq.aggregateOptions().Validate()
+}
+
+// overlaps reports whether both queries may write the same field of the same
+// target measurement, no fields standing for every field
+func (cq ContinuousQuery) overlaps(other ContinuousQuery) bool {
+	if cq.Target != other.Target {
+		return false
+	}
+	if len(cq.Fields) == 0 || len(other.Fields) == 0 {
+		return true
+	}
+	for _, field := range cq.Fields {
+		for _, otherField := range other.Fields {
+			if field == otherField {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// aggregateOptions returns the aggregation computing the windows of the query
+func (cq ContinuousQuery) aggregateOptions() AggregateOptions {
+	return AggregateOptions{Function: cq.Function, Window: cq.Interval, Percentile: cq.Percentile}
+}
+
+// due reports whether the query has not run yet within the Every period of now
+func (cq ContinuousQuery) due(now time.Time) bool {
+	return cq.LastRun.IsZero() || alignTime(now, cq.Every).After(alignTime(cq.LastRun, cq.Every))
+}
+
+// alignTime returns the start of the period of width d containing t, aligned
+// to the Unix epoch
+func alignTime(t time.Time, d time.Duration) time.Time {
+	req := AggregateRequest{AggregateOptions: AggregateOptions{Window: d}}
+	return time.Unix(0, req.windowStart(t)).UTC()
+}
+
+// continuousQueries holds the continuous queries of a database, persisted as JSON
+type continuousQueries struct {
+	mu      sync.RWMutex
+	path    string
+	queries map[string]*ContinuousQuery
+}
+
+// continuousQueriesFile is the persisted form of the continuous queries of a database
+type continuousQueriesFile struct {
+	Queries []continuousQueryFileEntry `json:"queries"`
+}
+
+// continuousQueryFileEntry is one persisted continuous query, with its
+// durations in Go syntax and its times in RFC3339
+type continuousQueryFileEntry struct {
+	Name          string   `json:"name"`
+	Source        string   `json:"source"`
+	Target        string   `json:"target"`
+	Fields        []string `json:"fields,omitempty"`
+	Function      string   `json:"function"`
+	Percentile    float64  `json:"percentile,omitempty"`
+	Interval      string   `json:"interval"`
+	Every         string   `json:"every"`
+	For           string   `json:"for"`
+	ComputedFrom  string   `json:"computed_from,omitempty"`
+	ComputedUntil string   `json:"computed_until,omitempty"`
+	LastRun       string   `json:"last_run,omitempty"`
+}
+
+// loadContinuousQueries reads the queries persisted at path. A missing file
+// means no queries.
+func loadContinuousQueries(path string) (*continuousQueries, error) {
+	cqs := &continuousQueries{
+		path:    path,
+		queries: make(map[string]*ContinuousQuery),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cqs, nil
+		}
+		return nil, fmt.Errorf("failed to read continuous queries: %w", err)
+	}
+
+	var file continuousQueriesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal continuous queries: %w", err)
+	}
+	for _, entry := range file.Queries {
+		cq, err := entry.query()
+		if err != nil {
+			return nil, fmt.Errorf("invalid continuous query %q: %w", entry.Name, err)
+		}
+		cqs.queries[cq.Name] = cq
+	}
+
+	return cqs, nil
+}
+
+// query parses a persisted continuous query
+func (e continuousQueryFileEntry) query() (*ContinuousQuery, error) {
+	cq := &ContinuousQuery{
+		Name:       e.Name,
+		Source:     e.Source,
+		Target:     e.Target,
+		Fields:     e.Fields,
+		Function:   AggregateFunction(e.Function),
+		Percentile: e.Percentile,
+	}
+
+	var err error
+	for _, d := range []struct {
+		raw string
+		dst *time.Duration
+	}{{e.Interval, &cq.Interval}, {e.Every, &cq.Every}, {e.For, &cq.For}} {
+		if *d.dst, err = time.ParseDuration(d.raw); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range []struct {
+		raw string
+		dst *time.Time
+	}{{e.ComputedFrom, &cq.ComputedFrom}, {e.ComputedUntil, &cq.ComputedUntil}, {e.LastRun, &cq.LastRun}} {
+		if t.raw == "" {
+			continue
+		}
+		if *t.dst, err = time.Parse(time.RFC3339Nano, t.raw); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cq.Validate(); err != nil {
+		return nil, err
+	}
+	return cq, nil
+}
+
+// add registers a new query and persists the queries. It returns instead the
+// query of the same name, or the first one writing a field of the same
+// target, if there is one.
+func (cqs *continuousQueries) add(cq ContinuousQuery) (*ContinuousQuery, error) {
+	cqs.mu.Lock()
+	defer cqs.mu.Unlock()
+
+	if existing, ok := cqs.queries[cq.Name]; ok {
+		return existing, nil
+	}
+	for _, existing := range cqs.listLocked() {
+		if existing.overlaps(cq) {
+			return &existing, nil
+		}
+	}
+	cqs.queries[cq.Name] = &cq
+	return nil, cqs.persist()
+}
+
+// remove deletes a query, reporting false if there was none
+func (cqs *continuousQueries) remove(name string) (bool, error) {
+	cqs.mu.Lock()
+	defer cqs.mu.Unlock()
+
+	if _, ok := cqs.queries[name]; !ok {
+		return false, nil
+	}
+	delete(cqs.queries, name)
+	return true, cqs.persist()
+}
+
+// list returns copies of the queries sorted by name
+func (cqs *continuousQueries) list() []ContinuousQuery {
+	cqs.mu.RLock()
+	defer cqs.mu.RUnlock()
+	return cqs.listLocked()
+}
+
+// listLocked returns the queries sorted by name, the caller must hold the lock
+func (cqs *continuousQueries) listLocked() []ContinuousQuery {
+	queries := make([]ContinuousQuery, 0, len(cqs.queries))
+	for _, cq := range cqs.queries {
+		queries = append(queries, *cq)
+	}
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Name < queries[j].Name })
+	return queries
+}
+
+// recordRun records a successful run of a query over the windows between
+// start and end, unless the query was dropped or replaced meanwhile
+func (cqs *continuousQueries) recordRun(ran ContinuousQuery, start, end, now time.Time) error {
+	cqs.mu.Lock()
+	defer cqs.mu.Unlock()
+
+	cq, ok := cqs.queries[ran.Name]
+	if !ok || cq.Source != ran.Source || cq.Target != ran.Target || cq.Interval != ran.Interval {
+		return nil
+	}
+
+	if cq.ComputedFrom.IsZero() || start.Before(cq.ComputedFrom) {
+		cq.ComputedFrom = start
+	}
+	if end.After(cq.ComputedUntil) {
+		cq.ComputedUntil = end
+	}
+	cq.LastRun = now
+	return cqs.persist()
+}
+
+// persist writes the queries to disk, the caller must hold the lock
+func (cqs *continuousQueries) persist() error {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+
+	var file continuousQueriesFile
+	for _, cq := range cqs.listLocked() {
+		file.Queries = append(file.Queries, continuousQueryFileEntry{
+			Name:          cq.Name,
+			Source:        cq.Source,
+			Target:        cq.Target,
+			Fields:        cq.Fields,
+			Function:      string(cq.Function),
+			Percentile:    cq.Percentile,
+			Interval:      cq.Interval.String(),
+			Every:         cq.Every.String(),
+			For:           cq.For.String(),
+			ComputedFrom:  formatTime(cq.ComputedFrom),
+			ComputedUntil: formatTime(cq.ComputedUntil),
+			LastRun:       formatTime(cq.LastRun),
+		})
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to marshal continuous queries: %w", err)
+	}
+
+	// Write to a temporary file and rename it so a crash never leaves partial queries
+	tmpPath := cqs.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write continuous queries: %w", err)
+	}
+	if err := os.Rename(tmpPath, cqs.path); err != nil {
+		return fmt.Errorf("failed to replace continuous queries: %w", err)
+	}
+
+	return nil
+}
+
+// CreateContinuousQuery registers a continuous query, which first runs at the
+// next check of the continuous query job. Queries writing the same field of
+// the same target measurement are rejected.
+func (db *Database) CreateContinuousQuery(cq ContinuousQuery) error {
+	cq = cq.withDefaults()
+	cq.ComputedFrom, cq.ComputedUntil, cq.LastRun = time.Time{}, time.Time{}, time.Time{}
+	if err := cq.Validate(); err != nil {
+		return errors.NewValidationError(err.Error())
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "continuous query change on closed database")
+	}
+
+	existing, err := db.continuousQueries.add(cq)
+	if err != nil {
+		return errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to save continuous query")
+	}
+	switch {
+	case existing == nil:
+		return nil
+	case existing.Name == cq.Name:
+		return errors.NewValidationError(fmt.Sprintf("continuous query %q already exists", cq.Name))
+	default:
+		// Both queries would overwrite each other's windows
+		return errors.NewValidationError(fmt.Sprintf("continuous query %q already writes the fields of target measurement %q", existing.Name, cq.Target))
+	}
+}
+
+// DropContinuousQuery removes a continuous query. The rollup points it wrote
+// are kept.
+func (db *Database) DropContinuousQuery(name string) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "continuous query change on closed database")
+	}
+
+	removed, err := db.continuousQueries.remove(name)
+	if err != nil {
+		return errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to save continuous queries")
+	}
+	if !removed {
+		return errors.NewNotFoundError(fmt.Sprintf("continuous query %q not found", name))
+	}
+	return nil
+}
+
+// ContinuousQueries returns the continuous queries of the database sorted by name
+func (db *Database) ContinuousQueries() []ContinuousQuery {
+	return db.continuousQueries.list()
+}
+
+// RunContinuousQueries runs the continuous queries of the database that are
+// due at now, returning the number of rollup windows written. A failed query
+// is retried at the next call.
+func (db *Database) RunContinuousQueries(ctx context.Context, now time.Time) (int, error) {
+	written := 0
+	var lastError error
+	for _, cq := range db.continuousQueries.list() {
+		if !cq.due(now) {
+			continue
+		}
+
+		n, err := db.runContinuousQuery(ctx, cq, now)
+		written += n
+		if db.metrics != nil {
+			db.metrics.RecordContinuousQueryRun(db.name, n, err)
+		}
+		if err != nil {
+			logger.Warnf("Continuous query %s of database %s failed: %v", cq.Name, db.name, err)
+			lastError = err
+		}
+	}
+	return written, lastError
+}
+
+// runContinuousQuery computes the completed windows within For of now, and
+// every window since the last computed one if runs were missed. Windows are
+// written again only when their value changed, so recomputing them is
+// idempotent.
+func (db *Database) runContinuousQuery(ctx context.Context, cq ContinuousQuery, now time.Time) (int, error) {
+	end := alignTime(now, cq.Interval)
+	start := alignTime(now.Add(-cq.For), cq.Interval)
+	if !cq.ComputedUntil.IsZero() && cq.ComputedUntil.Before(start) {
+		start = cq.ComputedUntil
+	}
+
+	written := 0
+	if start.Before(end) {
+		keys, err := db.continuousQuerySeries(cq)
+		if err != nil {
+			return 0, err
+		}
+		for _, key := range keys {
+			n, err := db.rollupSeries(ctx, cq, key, start, end)
+			written += n
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+
+	if err := db.continuousQueries.recordRun(cq, start, end, now); err != nil {
+		return written, errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to save continuous queries")
+	}
+	return written, nil
+}
+
+// continuousQuerySeries returns the source series rolled up by a query
+func (db *Database) continuousQuerySeries(cq ContinuousQuery) ([]SeriesKey, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "continuous query on closed database")
+	}
+
+	fields := make(map[string]bool, len(cq.Fields))
+	for _, f := range cq.Fields {
+		fields[f] = true
+	}
+
+	var keys []SeriesKey
+	for _, key := range db.findSeries(cq.Source, nil) {
+		if len(fields) > 0 && !fields[key.Field] {
+			continue
+		}
+		// Only counting applies to boolean and string values
+		if t, ok := db.seriesType(key); ok && !t.Numeric() && cq.Function != AggregateCount {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// rollupSeries aggregates the windows of one source series between start and
+// end, and replaces the rollup points of that range when they differ
+func (db *Database) rollupSeries(ctx context.Context, cq ContinuousQuery, key SeriesKey, start, end time.Time) (int, error) {
+	last := end.Add(-time.Nanosecond)
+	windows, err := db.AggregateSeries(ctx, []SeriesKey{key}, start, last, cq.aggregateOptions())
+	if err != nil {
+		return 0, err
+	}
+
+	target := SeriesKey{Measurement: cq.Target, Tags: key.Tags, Field: key.Field}
+	existing, err := db.ReadSeries(ctx, target, start, last, 0)
+	if err != nil {
+		return 0, err
+	}
+	if rollupCurrent(existing, windows, key.Field) {
+		return 0, nil
+	}
+
+	if len(existing) > 0 {
+		if err := db.deleteSeriesRange(target.String(), start, last); err != nil {
+			return 0, err
+		}
+	}
+
+	for i, w := range windows {
+		err := db.WritePoint(ctx, types.Point{
+			Measurement: target.Measurement,
+			Tags:        target.Tags,
+			Fields:      map[string]interface{}{target.Field: w.Value},
+			Timestamp:   w.Start,
+		})
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(windows), nil
+}
+
+// rollupCurrent reports whether the rollup points hold exactly the windows
+func rollupCurrent(existing []types.Point, windows []WindowAggregate, field string) bool {
+	if len(existing) != len(windows) {
+		return false
+	}
+	sort.SliceStable(existing, func(i, j int) bool {
+		return existing[i].Timestamp.Before(existing[j].Timestamp)
+	})
+	for i, p := range existing {
+		if !p.Timestamp.Equal(windows[i].Start) || p.Fields[field] != windows[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+// deleteSeriesRange deletes the points of one series between start and end
+// inclusive from every shard holding points in that range
+func (db *Database) deleteSeriesRange(seriesID string, start, end time.Time) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "delete operation on closed database")
+	}
+
+	for _, shard := range db.shards {
+		ids, err := shard.SeriesInRange(Postings{seriesID}, start, end)
+		if err != nil {
+			return errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to select series to delete")
+		}
+		if err := shard.Delete(ids, start, end); err != nil {
+			return errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to delete points")
+		}
+	}
+	return nil
+}
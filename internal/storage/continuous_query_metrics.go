@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Continuous query metrics
+	ContinuousQueryRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tsdb_continuous_query_runs_total",
+			Help: "Total number of continuous query runs",
+		},
+		[]string{"database", "status"},
+	)
+
+	ContinuousQueryWindowsWritten = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tsdb_continuous_query_windows_written_total",
+			Help: "Total number of rollup windows written by continuous queries",
+		},
+		[]string{"database"},
+	)
+)
+
+func init() {
+	// Register all continuous query metrics
+	prometheus.MustRegister(ContinuousQueryRuns)
+	prometheus.MustRegister(ContinuousQueryWindowsWritten)
+}
+
+// RecordContinuousQueryRun records a continuous query run and the rollup
+// windows it wrote
+func (m *StorageMetrics) RecordContinuousQueryRun(database string, windows int, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	ContinuousQueryRuns.WithLabelValues(database, status).Inc()
+	ContinuousQueryWindowsWritten.WithLabelValues(database).Add(float64(windows))
+}
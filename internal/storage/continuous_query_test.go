@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/types"
+)
+
+func TestContinuousQueries(t *testing.T) {
+	cfg := config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024}
+	s := NewStorage(cfg)
+	defer func() { s.Close() }()
+
+	ctx := context.Background()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return base.Add(time.Duration(seconds) * time.Second) }
+	write := func(host string, ts time.Time, usage float64) {
+		t.Helper()
+		err := s.WritePoint(ctx, types.Point{Measurement: "cpu", Tags: map[string]string{"host": host}, Fields: map[string]interface{}{"usage": usage, "state": "ok"}, Timestamp: ts})
+		if err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+	// rollup returns the rollup points of a host by window start in seconds
+	rollup := func(t *testing.T, host string) map[int]float64 {
+		t.Helper()
+		points, err := s.ReadPoints(ctx, "cpu_1m", map[string]string{"host": host}, "usage", base, at(3600), 0)
+		if err != nil {
+			t.Fatalf("ReadPoints failed: %v", err)
+		}
+		values := make(map[int]float64)
+		for _, p := range points {
+			sec := int(p.Timestamp.Sub(base) / time.Second)
+			if _, ok := values[sec]; ok {
+				t.Errorf("Duplicate rollup point at %ds", sec)
+			}
+			values[sec] = p.Fields["usage"].(float64)
+		}
+		return values
+	}
+	run := func(t *testing.T, now time.Time, want int) {
+		t.Helper()
+		written, err := s.RunContinuousQueries(ctx, now)
+		if err != nil {
+			t.Fatalf("RunContinuousQueries failed: %v", err)
+		}
+		if written != want {
+			t.Errorf("Expected %d windows written, got %d", want, written)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		write("a", at(i*60), float64(i))
+		write("a", at(i*60+30), float64(i+10))
+		write("b", at(i*60+15), 100)
+	}
+
+	err := s.CreateContinuousQuery(ContinuousQuery{Name: "cpu_1m", Source: "cpu", Target: "cpu_1m", Function: AggregateMean, Interval: time.Minute, For: 3 * time.Minute})
+	if err != nil {
+		t.Fatalf("CreateContinuousQuery failed: %v", err)
+	}
+
+	t.Run("first run", func(t *testing.T) {
+		// Only the completed windows within For are computed
+		run(t, at(5*60+10), 6)
+		if got := rollup(t, "a"); len(got) != 3 || got[120] != 7 || got[240] != 9 {
+			t.Errorf("Unexpected rollup of a: %v", got)
+		}
+		if got := rollup(t, "b"); len(got) != 3 || got[180] != 100 {
+			t.Errorf("Unexpected rollup of b: %v", got)
+		}
+
+		cq := s.ContinuousQueries()[0]
+		if !cq.ComputedFrom.Equal(at(120)) || !cq.ComputedUntil.Equal(at(300)) || cq.Every != time.Minute {
+			t.Errorf("Unexpected state %+v", cq)
+		}
+
+		// String fields are not averaged
+		if keys, _ := s.FindSeries("cpu_1m"); len(keys) != 2 {
+			t.Errorf("Expected only the usage series rolled up, got %v", keys)
+		}
+	})
+
+	t.Run("not due", func(t *testing.T) {
+		run(t, at(5*60+50), 0)
+	})
+
+	t.Run("late points", func(t *testing.T) {
+		// Both a flush and a late point are followed by a recomputation
+		if err := s.shards["default"].ForceFlush(); err != nil {
+			t.Fatalf("Failed to flush: %v", err)
+		}
+		write("a", at(4*60+45), 19)
+
+		// The recomputed windows of a are replaced, and the unchanged ones
+		// of b are not written again
+		run(t, at(6*60+5), 2)
+		if got := rollup(t, "a"); len(got) != 3 || got[240] != float64(4+14+19)/3 || got[180] != 8 || got[120] != 7 {
+			t.Errorf("Unexpected rollup of a: %v", got)
+		}
+		if got := rollup(t, "b"); len(got) != 3 {
+			t.Errorf("Unexpected rollup of b: %v", got)
+		}
+	})
+
+	t.Run("missed runs", func(t *testing.T) {
+		write("b", at(10*60), 50)
+		// Windows since the last computed one are caught up
+		run(t, at(30*60), 1)
+		if got := rollup(t, "b"); len(got) != 4 || got[600] != 50 {
+			t.Errorf("Unexpected rollup of b: %v", got)
+		}
+	})
+
+	t.Run("persisted", func(t *testing.T) {
+		s.Close()
+		s = NewStorage(cfg)
+
+		queries := s.ContinuousQueries()
+		if len(queries) != 1 {
+			t.Fatalf("Expected 1 continuous query, got %+v", queries)
+		}
+		cq := queries[0]
+		if cq.Source != "cpu" || cq.Function != AggregateMean || cq.For != 3*time.Minute || !cq.ComputedUntil.Equal(at(30*60)) || !cq.LastRun.Equal(at(30*60)) {
+			t.Errorf("Unexpected continuous query after reopening: %+v", cq)
+		}
+		run(t, at(30*60+30), 0)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		invalid := []ContinuousQuery{
+			{Name: "cpu_1m", Source: "cpu", Target: "other", Function: AggregateMax, Interval: time.Minute},
+			{Name: "bad name", Source: "cpu", Target: "other", Function: AggregateMax, Interval: time.Minute},
+			{Name: "same", Source: "cpu", Target: "cpu", Function: AggregateMax, Interval: time.Minute},
+			{Name: "no_interval", Source: "cpu", Target: "other", Function: AggregateMax},
+			{Name: "short_for", Source: "cpu", Target: "other", Function: AggregateMax, Interval: time.Hour, For: time.Minute},
+			{Name: "function", Source: "cpu", Target: "other", Function: "median", Interval: time.Minute},
+			{Name: "same_target", Source: "cpu", Target: "cpu_1m", Fields: []string{"usage"}, Function: AggregateMax, Interval: time.Minute},
+			{Name: "every_field", Source: "mem", Target: "cpu_1m", Function: AggregateMax, Interval: time.Hour},
+		}
+		for _, cq := range invalid {
+			if err := s.CreateContinuousQuery(cq); !errors.IsType(err, errors.ErrorTypeValidation) {
+				t.Errorf("CreateContinuousQuery(%+v) returned %v, want a validation error", cq, err)
+			}
+		}
+
+		// Queries may share a target when they write different fields
+		fields := []string{"usage", "idle"}
+		for _, field := range fields {
+			cq := ContinuousQuery{Name: "cpu_" + field, Source: "cpu", Target: "cpu_fields", Fields: []string{field}, Function: AggregateMax, Interval: time.Minute}
+			if err := s.CreateContinuousQuery(cq); err != nil {
+				t.Fatalf("CreateContinuousQuery(%+v) failed: %v", cq, err)
+			}
+		}
+		for _, field := range fields {
+			if err := s.DropContinuousQuery("cpu_" + field); err != nil {
+				t.Fatalf("DropContinuousQuery failed: %v", err)
+			}
+		}
+
+		if err := s.DropContinuousQuery("missing"); !errors.IsType(err, errors.ErrorTypeNotFound) {
+			t.Errorf("Expected a not found error, got %v", err)
+		}
+		if err := s.DropContinuousQuery("cpu_1m"); err != nil {
+			t.Fatalf("DropContinuousQuery failed: %v", err)
+		}
+		if queries := s.ContinuousQueries(); len(queries) != 0 {
+			t.Errorf("Expected no continuous queries, got %+v", queries)
+		}
+	})
+}
@@ -0,0 +1,574 @@
+package storage
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/types"
+)
+
+// DefaultDatabase is the database used when a request does not name one. Its
+// shards live directly in the data directory, where all data was kept before
+// named databases existed.
+const DefaultDatabase = "default"
+
+// databasesDir is the directory under the data directory holding one
+// directory per named database
+const databasesDir = "databases"
+
+// databaseNamePattern restricts database names to ones safe to use as a
+// directory name
+var databaseNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidateDatabaseName checks that a database name can be created
+func ValidateDatabaseName(name string) error {
+	if !databaseNamePattern.MatchString(name) {
+		return errors.NewValidationError(fmt.Sprintf("invalid database name %q: use 1 to 64 letters, digits, underscores or hyphens", name))
+	}
+	return nil
+}
+
+// Database is an isolated namespace of series with its own shards. Points
+// written to one database are never visible from another.
+type Database struct {
+	mu      sync.RWMutex
+	name    string
+	dir     string
+	config  config.StorageConfig
+	shards  map[string]*Shard
+	metrics *StorageMetrics
+	closed  bool
+
+	retention         *retentionPolicies
+	continuousQueries *continuousQueries
+}
+
+// openDatabase opens the database stored in dir, creating its default shard
+func openDatabase(name, dir string, cfg config.StorageConfig, metrics *StorageMetrics) (*Database, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	retention, err := loadRetentionPolicies(filepath.Join(dir, retentionFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	continuousQueries, err := loadContinuousQueries(filepath.Join(dir, continuousQueriesFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	db := &Database{
+		name:              name,
+		dir:               dir,
+		config:            cfg,
+		shards:            make(map[string]*Shard),
+		metrics:           metrics,
+		retention:         retention,
+		continuousQueries: continuousQueries,
+	}
+
+	if err := db.createShard("default"); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Name returns the name of the database
+func (db *Database) Name() string {
+	return db.name
+}
+
+// shardCount returns the number of open shards in the database
+func (db *Database) shardCount() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return len(db.shards)
+}
+
+// stats returns the statistics of the database and its shards
+func (db *Database) stats() map[string]interface{} {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	shards := make(map[string]interface{}, len(db.shards))
+	for shardID, shard := range db.shards {
+		shards[shardID] = shard.GetStats()
+	}
+
+	return map[string]interface{}{
+		"shard_count": len(db.shards),
+		"data_dir":    db.dir,
+		"shards":      shards,
+	}
+}
+
+// forceCompaction forces compaction on every shard of the database
+func (db *Database) forceCompaction() error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "compaction on closed database")
+	}
+
+	var lastError error
+	for shardID, shard := range db.shards {
+		// Force compaction on level 0 (most common)
+		if err := shard.ForceCompaction(0); err != nil {
+			logger.Warnf("Failed to force compaction on shard %s of database %s: %v", shardID, db.name, err)
+			lastError = err
+		}
+	}
+
+	return lastError
+}
+
+// close closes every shard of the database
+func (db *Database) close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+
+	var lastError error
+	for shardID, shard := range db.shards {
+		if err := shard.Close(); err != nil {
+			logger.Warnf("Failed to close shard %s of database %s: %v", shardID, db.name, err)
+			lastError = err
+		}
+	}
+	db.shards = make(map[string]*Shard)
+
+	return lastError
+}
+
+// clear closes every shard of the database and opens a fresh default shard
+func (db *Database) clear() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "clear operation on closed database")
+	}
+
+	for shardID, shard := range db.shards {
+		if err := shard.Close(); err != nil {
+			logger.Warnf("Failed to close shard %s of database %s during clear: %v", shardID, db.name, err)
+		}
+	}
+	db.shards = make(map[string]*Shard)
+
+	return db.createShard("default")
+}
+
+// WritePoint writes a time-series point to the appropriate shard. A point is
+// not written once ctx is done.
+func (db *Database) WritePoint(ctx context.Context, p types.Point) error {
+	startTime := time.Now()
+
+	if err := CheckContext(ctx); err != nil {
+		return err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "write operation on closed database")
+	}
+
+	// Determine which shard to use (for now, use default or create based on measurement)
+	shardID := db.determineShardID(p.Measurement)
+
+	shard, exists := db.shards[shardID]
+	if !exists {
+		// Need to upgrade to write lock to create shard
+		db.mu.RUnlock()
+		db.mu.Lock()
+
+		// Double-check that shard still doesn't exist after acquiring write lock
+		shard, exists = db.shards[shardID]
+		if !exists {
+			// Create new shard if it doesn't exist
+			if err := db.createShard(shardID); err != nil {
+				db.mu.Unlock()
+				return errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to create shard")
+			}
+			shard = db.shards[shardID]
+		}
+
+		db.mu.Unlock()
+		db.mu.RLock() // Re-acquire read lock for the rest of the function
+	}
+
+	// Convert types.Point to storage.DataPoint, checking every field's type
+	// before anything is written so a conflicting point is rejected as a whole
+	dataPoints := make(map[string]DataPoint, len(p.Fields))
+	for fieldName, fieldValue := range p.Fields {
+		dataPoint, err := NewDataPoint(p.Timestamp, fieldValue)
+		if err != nil {
+			return errors.NewValidationError(fmt.Sprintf("field %q: %v", fieldName, err))
+		}
+		dataPoint.Labels = p.Tags
+
+		if existing, ok := shard.FieldType(p.Measurement, fieldName); ok && existing != dataPoint.Type {
+			return errors.NewValidationError(fieldTypeConflict(p.Measurement, fieldName, existing, dataPoint.Type).Error())
+		}
+		dataPoints[fieldName] = dataPoint
+	}
+
+	for fieldName, dataPoint := range dataPoints {
+		// Create a unique series ID combining measurement, tags, and field
+		seriesID := db.createSeriesID(p.Measurement, p.Tags, fieldName)
+
+		// Write to the specific series
+		writeReq := WriteRequest{
+			SeriesID: seriesID,
+			Points:   []DataPoint{dataPoint},
+		}
+
+		if err := shard.Write(writeReq); err != nil {
+			if stderrors.Is(err, ErrFieldTypeConflict) {
+				return errors.NewValidationError(err.Error())
+			}
+			return errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to write point to shard")
+		}
+	}
+
+	// Update metrics
+	if db.metrics != nil {
+		db.metrics.RecordStorageWriteOperation("storage", "write_point")
+		db.metrics.RecordDataPointsWritten("storage", len(dataPoints))
+		db.metrics.RecordStorageWriteLatency("storage", "write_point", time.Since(startTime))
+	}
+
+	return nil
+}
+
+// ReadPoints reads the points of a field from every series of a measurement
+// that carries the given tags. Series may have tags beyond the ones requested,
+// so host=a selects both cpu,host=a and cpu,host=a,region=eu.
+func (db *Database) ReadPoints(ctx context.Context, measurement string, tags map[string]string, field string, start, end time.Time, limit int) ([]types.Point, error) {
+	startTime := time.Now()
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "read operation on closed database")
+	}
+
+	matchers := make([]*TagMatcher, 0, len(tags))
+	for k, v := range tags {
+		matchers = append(matchers, &TagMatcher{Type: MatchEqual, Key: k, Value: v})
+	}
+
+	var result []types.Point
+	for _, key := range db.findSeries(measurement, matchers) {
+		if key.Field != field {
+			continue
+		}
+		points, err := db.readSeries(ctx, key, start, end, limit)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, points...)
+	}
+
+	// Merge the series in time order before applying the limit
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Timestamp.Before(result[j].Timestamp)
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	if result == nil {
+		result = []types.Point{}
+	}
+
+	// Update metrics
+	if db.metrics != nil {
+		db.metrics.RecordStorageReadOperation("storage", "read_points")
+		db.metrics.RecordDataPointsRead("storage", len(result))
+		db.metrics.RecordStorageReadLatency("storage", "read_points", time.Since(startTime))
+	}
+
+	return result, nil
+}
+
+// ReadSeries reads the points of exactly one series
+func (db *Database) ReadSeries(ctx context.Context, key SeriesKey, start, end time.Time, limit int) ([]types.Point, error) {
+	startTime := time.Now()
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "read operation on closed database")
+	}
+
+	result, err := db.readSeries(ctx, key, start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update metrics
+	if db.metrics != nil {
+		db.metrics.RecordStorageReadOperation("storage", "read_series")
+		db.metrics.RecordDataPointsRead("storage", len(result))
+		db.metrics.RecordStorageReadLatency("storage", "read_series", time.Since(startTime))
+	}
+
+	return result, nil
+}
+
+// readSeries reads one series from every shard, the caller must hold the read
+// lock. Only a done context fails the read, other shard errors are logged.
+func (db *Database) readSeries(ctx context.Context, key SeriesKey, start, end time.Time, limit int) ([]types.Point, error) {
+	allPoints, err := db.readDataPoints(ctx, key.String(), start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert DataPoints back to types.Point
+	result := make([]types.Point, 0, len(allPoints))
+	for _, dp := range allPoints {
+		point := types.Point{
+			Measurement: key.Measurement,
+			Tags:        key.Tags,
+			Fields:      map[string]interface{}{key.Field: dp.FieldValue()},
+			Timestamp:   dp.Timestamp,
+		}
+		result = append(result, point)
+	}
+
+	return result, nil
+}
+
+// readDataPoints reads the stored points of one series from every shard, the
+// caller must hold the read lock. The points of each shard are sorted, but
+// shards are read in no particular order.
+func (db *Database) readDataPoints(ctx context.Context, seriesID string, start, end time.Time, limit int) ([]DataPoint, error) {
+	var allPoints []DataPoint
+	for _, shard := range db.shards {
+		readReq := ReadRequest{
+			SeriesID: seriesID,
+			Start:    start,
+			End:      end,
+			Limit:    limit,
+		}
+
+		points, err := shard.Read(ctx, readReq)
+		if err != nil {
+			if isContextError(err) {
+				return nil, contextError(err)
+			}
+			logger.Warnf("Failed to read from shard %s: %v", shard.GetID(), err)
+			continue
+		}
+
+		allPoints = append(allPoints, points...)
+	}
+
+	return allPoints, nil
+}
+
+// FindSeries returns the keys of the series of a measurement whose tags
+// satisfy every matcher. An empty measurement searches all measurements.
+func (db *Database) FindSeries(measurement string, matchers ...*TagMatcher) ([]SeriesKey, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "find series on closed database")
+	}
+
+	return db.findSeries(measurement, matchers), nil
+}
+
+// Fields returns the sorted fields of a measurement, read from the tag index
+// of every shard without listing its series
+func (db *Database) Fields(measurement string) ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "list fields on closed database")
+	}
+
+	set := make(map[string]bool)
+	for _, shard := range db.shards {
+		for _, field := range shard.Fields(measurement) {
+			set[field] = true
+		}
+	}
+	return sortedSet(set), nil
+}
+
+// findSeries resolves matchers through the tag index of every shard, the
+// caller must hold the read lock
+func (db *Database) findSeries(measurement string, matchers []*TagMatcher) []SeriesKey {
+	return db.seriesKeys(SeriesFilter{Measurement: measurement, Matchers: matchers})
+}
+
+// AggregateSeries computes windowed aggregates over the union of the given
+// series. Each shard aggregates its own points and only hands back one partial
+// result per window, which are then merged into the final values. Windows
+// without points are left out or filled in as opts.Fill decides.
+func (db *Database) AggregateSeries(ctx context.Context, keys []SeriesKey, start, end time.Time, opts AggregateOptions) ([]WindowAggregate, error) {
+	startTime := time.Now()
+
+	if err := opts.Validate(); err != nil {
+		return nil, errors.NewValidationError(err.Error())
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "aggregate operation on closed database")
+	}
+
+	// Only counting applies to boolean and string values
+	if opts.Function != AggregateCount {
+		for _, key := range keys {
+			if t, ok := db.seriesType(key); ok && !t.Numeric() {
+				return nil, errors.NewValidationError(fmt.Sprintf("%s() is not supported for %s field %q", opts.Function, t, key.Field))
+			}
+		}
+	}
+
+	req := &AggregateRequest{
+		SeriesIDs:        make([]string, 0, len(keys)),
+		Start:            start,
+		End:              end,
+		AggregateOptions: opts,
+	}
+	for _, key := range keys {
+		req.SeriesIDs = append(req.SeriesIDs, key.String())
+	}
+
+	windows := make(windowAggregates)
+	for _, shard := range db.shards {
+		shardWindows, err := shard.aggregate(ctx, req)
+		if err != nil {
+			if isContextError(err) {
+				return nil, contextError(err)
+			}
+			logger.Warnf("Failed to aggregate in shard %s: %v", shard.GetID(), err)
+			continue
+		}
+		windows.merge(shardWindows)
+	}
+
+	// Windows without points are filled in once every shard is merged, so
+	// only the windows empty across the whole database are filled
+	result, err := FillWindows(windows.results(opts), start, end, opts)
+	if err != nil {
+		return nil, errors.NewValidationError(err.Error())
+	}
+
+	// Update metrics
+	if db.metrics != nil {
+		db.metrics.RecordStorageReadOperation("storage", "aggregate_series")
+		db.metrics.RecordStorageReadLatency("storage", "aggregate_series", time.Since(startTime))
+	}
+
+	return result, nil
+}
+
+// seriesType returns the field type of a series from the first shard that
+// holds it, the caller must hold the read lock
+func (db *Database) seriesType(key SeriesKey) (types.FieldType, bool) {
+	seriesID := key.String()
+	for _, shard := range db.shards {
+		if t, ok := shard.SeriesType(seriesID); ok {
+			return t, true
+		}
+	}
+	return types.FieldTypeFloat, false
+}
+
+// ListSeries returns the keys of all series stored for a measurement.
+// An empty measurement lists the series of every measurement.
+func (db *Database) ListSeries(measurement string) ([]SeriesKey, error) {
+	return db.FindSeries(measurement)
+}
+
+// createShard creates a new storage shard
+func (db *Database) createShard(shardID string) error {
+	// Use existing config fields and provide sensible defaults for LSM tree
+	shardConfig := ShardConfig{
+		ID:                  shardID,
+		DataDir:             filepath.Join(db.dir, "shard_"+shardID),
+		MaxMemTableSize:     64 * 1024 * 1024, // 64MB default
+		MaxWALSize:          db.config.MaxFileSize,
+		MaxLevels:           7, // Standard LSM tree levels
+		MaxSegmentsPerLevel: 10,
+		MaxSegmentSize:      256 * 1024 * 1024, // 256MB default
+		CompactionInterval:  30 * time.Second,
+		Retention:           db.retentionCutoff,
+	}
+
+	shard, err := NewShard(shardConfig, db.metrics)
+	if err != nil {
+		return fmt.Errorf("failed to create shard %s: %w", shardID, err)
+	}
+
+	// Open the shard
+	if err := shard.Open(); err != nil {
+		return fmt.Errorf("failed to open shard %s: %w", shardID, err)
+	}
+
+	db.shards[shardID] = shard
+
+	logger.Infof("Created and opened shard %s of database %s", shardID, db.name)
+
+	return nil
+}
+
+// determineShardID determines which shard should store the data
+// This is a simple hash-based approach that can be enhanced with more sophisticated routing
+func (db *Database) determineShardID(measurement string) string {
+	// For now, use a simple approach - could be enhanced with consistent hashing
+	if len(db.shards) == 0 {
+		return "default"
+	}
+
+	// Simple hash-based shard selection
+	hash := 0
+	for _, char := range measurement {
+		hash = (hash*31 + int(char)) % len(db.shards)
+	}
+
+	// Get shard IDs and return the selected one
+	shardIDs := make([]string, 0, len(db.shards))
+	for id := range db.shards {
+		shardIDs = append(shardIDs, id)
+	}
+
+	if len(shardIDs) > 0 {
+		return shardIDs[hash%len(shardIDs)]
+	}
+
+	return "default"
+}
+
+// createSeriesID creates a unique series identifier from measurement, tags, and field
+func (db *Database) createSeriesID(measurement string, tags map[string]string, field string) string {
+	return SeriesKey{Measurement: measurement, Field: field, Tags: tags}.String()
+}
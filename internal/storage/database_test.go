@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/types"
+)
+
+func TestStorageDatabases(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.StorageConfig{DataDir: dir, MaxFileSize: 1024 * 1024}
+	s := NewStorage(cfg)
+
+	created, err := s.CreateDatabase("team_a")
+	if err != nil || !created {
+		t.Fatalf("CreateDatabase = %v, %v", created, err)
+	}
+	if created, err := s.CreateDatabase("team_a"); err != nil || created {
+		t.Errorf("Creating an existing database = %v, %v, want false", created, err)
+	}
+
+	teamA, err := s.GetDatabase("team_a")
+	if err != nil {
+		t.Fatalf("GetDatabase failed: %v", err)
+	}
+	if db, err := s.GetDatabase(""); err != nil || db != s.Database {
+		t.Errorf("GetDatabase(\"\") = %v, %v, want the default database", db, err)
+	}
+
+	// The same measurement in two databases stays separate
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	write := func(db *Database, value float64) {
+		t.Helper()
+		err := db.WritePoint(context.Background(), types.Point{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: map[string]interface{}{"usage": value}, Timestamp: base})
+		if err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+	write(s.Database, 1)
+	write(teamA, 2)
+
+	for db, want := range map[*Database]float64{s.Database: 1, teamA: 2} {
+		points, err := db.ReadPoints(context.Background(), "cpu", nil, "usage", base, base, 0)
+		if err != nil {
+			t.Fatalf("ReadPoints failed: %v", err)
+		}
+		if len(points) != 1 || points[0].Fields["usage"] != want {
+			t.Errorf("Database %s read %+v, want one point of %v", db.Name(), points, want)
+		}
+	}
+
+	names, err := s.ListDatabases()
+	if err != nil {
+		t.Fatalf("ListDatabases failed: %v", err)
+	}
+	if want := []string{"default", "team_a"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ListDatabases = %v, want %v", names, want)
+	}
+
+	stats := s.GetStats()
+	if stats["database_count"] != 2 || stats["shard_count"] != 2 {
+		t.Errorf("Unexpected stats %v", stats)
+	}
+	if _, ok := stats["databases"].(map[string]interface{})["team_a"]; !ok {
+		t.Errorf("Expected stats for team_a, got %v", stats["databases"])
+	}
+
+	// Databases are reopened from disk
+	s.Close()
+	s = NewStorage(cfg)
+	teamA, err = s.GetDatabase("team_a")
+	if err != nil {
+		t.Fatalf("GetDatabase after reopen failed: %v", err)
+	}
+	if points, err := teamA.ReadPoints(context.Background(), "cpu", nil, "usage", base, base, 0); err != nil || len(points) != 1 {
+		t.Errorf("Expected the point to survive a reopen, got %+v, %v", points, err)
+	}
+
+	if err := s.DropDatabase("team_a"); err != nil {
+		t.Fatalf("DropDatabase failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, databasesDir, "team_a")); !os.IsNotExist(err) {
+		t.Errorf("Expected the database directory to be removed, got %v", err)
+	}
+	if _, err := s.GetDatabase("team_a"); !errors.IsType(err, errors.ErrorTypeNotFound) {
+		t.Errorf("Expected a not found error after drop, got %v", err)
+	}
+	if err := teamA.WritePoint(context.Background(), types.Point{Measurement: "cpu", Fields: map[string]interface{}{"usage": 1.0}, Timestamp: base}); err == nil {
+		t.Error("Expected writes to a dropped database to fail")
+	}
+	s.Close()
+}
+
+func TestStorageDatabaseErrors(t *testing.T) {
+	s := NewStorage(config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024})
+	defer s.Close()
+
+	for _, name := range []string{"", "../escape", "a/b", "has space", string(make([]byte, 65))} {
+		if _, err := s.CreateDatabase(name); !errors.IsType(err, errors.ErrorTypeValidation) {
+			t.Errorf("CreateDatabase(%q) returned %v, want a validation error", name, err)
+		}
+	}
+	if err := s.DropDatabase(DefaultDatabase); !errors.IsType(err, errors.ErrorTypeValidation) {
+		t.Errorf("Dropping the default database returned %v, want a validation error", err)
+	}
+	if err := s.DropDatabase("missing"); !errors.IsType(err, errors.ErrorTypeNotFound) {
+		t.Errorf("Dropping a missing database returned %v, want a not found error", err)
+	}
+	if _, err := s.GetDatabase("missing"); !errors.IsType(err, errors.ErrorTypeNotFound) {
+		t.Errorf("GetDatabase of a missing database returned %v, want a not found error", err)
+	}
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+)
+
+// Delete deletes the points of the series of a measurement selected by the
+// filter's matchers and predicate, with timestamps within the filter's time
+// range, and returns the number of series affected. A zero Start or End
+// leaves that side of the range unbounded. Deleted points disappear from
+// reads at once and are removed from disk when their segments are compacted,
+// while the series themselves stay in the tag index. Nothing is deleted once
+// ctx is done.
+func (db *Database) Delete(ctx context.Context, filter SeriesFilter) (int, error) {
+	startTime := time.Now()
+
+	if err := CheckContext(ctx); err != nil {
+		return 0, err
+	}
+
+	if filter.Measurement == "" {
+		return 0, errors.NewValidationError("delete requires a measurement")
+	}
+	start, end := filter.timeRange()
+	if end.Before(start) {
+		return 0, errors.NewValidationError(fmt.Sprintf("invalid delete range: end %s is before start %s", end.Format(time.RFC3339Nano), start.Format(time.RFC3339Nano)))
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return 0, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "delete operation on closed database")
+	}
+
+	affected := 0
+	for _, shard := range db.shards {
+		ids, err := shard.Select(filter.Measurement, filter.Matchers...)
+		if err != nil {
+			return affected, errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to select series to delete")
+		}
+		if filter.bounded() && len(ids) > 0 {
+			if ids, err = shard.SeriesInRange(ids, start, end); err != nil {
+				return affected, errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to select series to delete")
+			}
+		}
+
+		seriesIDs := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if filter.Predicate != nil {
+				key, err := ParseSeriesKey(id)
+				if err != nil || !filter.Predicate(key.Tags) {
+					continue
+				}
+			}
+			seriesIDs = append(seriesIDs, id)
+		}
+		if len(seriesIDs) == 0 {
+			continue
+		}
+
+		if err := shard.Delete(seriesIDs, start, end); err != nil {
+			return affected, errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to delete points")
+		}
+		affected += len(seriesIDs)
+	}
+
+	if affected > 0 {
+		logger.Infof("Deleted points of %d series of measurement %s in database %s", affected, filter.Measurement, db.name)
+	}
+
+	// Update metrics
+	if db.metrics != nil {
+		db.metrics.RecordStorageWriteOperation("storage", "delete")
+		db.metrics.RecordStorageWriteLatency("storage", "delete", time.Since(startTime))
+	}
+
+	return affected, nil
+}
@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/types"
+)
+
+func TestStorageDelete(t *testing.T) {
+	cfg := config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024}
+	s := NewStorage(cfg)
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	write := func(s *Storage, host string, minutes int) {
+		t.Helper()
+		err := s.WritePoint(context.Background(), types.Point{Measurement: "cpu", Tags: map[string]string{"host": host}, Fields: map[string]interface{}{"value": float64(minutes)}, Timestamp: at(minutes)})
+		if err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+
+	// Host a has points in a segment and in the memstore, host b only in a segment
+	for i := 0; i < 6; i++ {
+		write(s, "a", i)
+		write(s, "b", i)
+	}
+	if err := s.shards["default"].ForceFlush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	for i := 6; i < 10; i++ {
+		write(s, "a", i)
+	}
+
+	hostA, _ := NewTagMatcher(MatchEqual, "host", "a")
+	count, err := s.Delete(context.Background(), SeriesFilter{Measurement: "cpu", Matchers: []*TagMatcher{hostA}, Start: at(2), End: at(7)})
+	if err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected one series to be affected, got %d", count)
+	}
+
+	// A point written after the delete within its range is kept
+	write(s, "a", 4)
+
+	check := func(t *testing.T, s *Storage) {
+		t.Helper()
+		points, err := s.ReadPoints(context.Background(), "cpu", map[string]string{"host": "a"}, "value", at(0), at(10), 0)
+		if err != nil {
+			t.Fatalf("ReadPoints failed: %v", err)
+		}
+		var got []float64
+		for _, p := range points {
+			got = append(got, p.Fields["value"].(float64))
+		}
+		want := []float64{0, 1, 4, 8, 9}
+		if len(got) != len(want) {
+			t.Fatalf("Read values %v, want %v", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("Read values %v, want %v", got, want)
+			}
+		}
+
+		keys := []SeriesKey{{Measurement: "cpu", Field: "value", Tags: map[string]string{"host": "a"}}}
+		results, err := s.AggregateSeries(context.Background(), keys, at(0), at(10), AggregateOptions{Function: AggregateCount})
+		if err != nil || len(results) != 1 || results[0].Value != 5 {
+			t.Errorf("Expected a count of 5, got %+v, %v", results, err)
+		}
+
+		if points, _ := s.ReadPoints(context.Background(), "cpu", map[string]string{"host": "b"}, "value", at(0), at(10), 0); len(points) != 6 {
+			t.Errorf("Expected host b to keep 6 points, got %d", len(points))
+		}
+	}
+	t.Run("before compaction", func(t *testing.T) { check(t, s) })
+
+	// The tombstones and the emptied WAL survive a restart
+	s.Close()
+	s = NewStorage(cfg)
+	defer s.Close()
+	t.Run("reopened", func(t *testing.T) { check(t, s) })
+
+	// Compaction removes the deleted points from disk and drops the tombstones
+	shard := s.shards["default"]
+	if err := shard.ForceFlush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	segments, err := shard.segmentReader.ListSegments()
+	if err != nil {
+		t.Fatalf("ListSegments failed: %v", err)
+	}
+	if err := shard.compactionMgr.processCompactionTask(compactionTask{Level: 0, Segments: segments}); err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+	if n := shard.tombstones.Len(); n != 0 {
+		t.Errorf("Expected the applied tombstones to be pruned, %d left", n)
+	}
+	segments, _ = shard.segmentReader.ListSegments()
+	stored := 0
+	for _, segment := range segments {
+		_, results, err := shard.segmentReader.ReadSegment(segment.Path)
+		if err != nil {
+			t.Fatalf("ReadSegment failed: %v", err)
+		}
+		for _, r := range results {
+			if r.SeriesID == "cpu:value:host=a" {
+				stored += len(r.Points)
+			}
+		}
+	}
+	if stored != 5 {
+		t.Errorf("Expected 5 points of host a on disk after compaction, got %d", stored)
+	}
+	t.Run("compacted", func(t *testing.T) { check(t, s) })
+}
+
+func TestStorageDeleteErrors(t *testing.T) {
+	s := NewStorage(config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024})
+	defer s.Close()
+
+	if _, err := s.Delete(context.Background(), SeriesFilter{}); !errors.IsType(err, errors.ErrorTypeValidation) {
+		t.Errorf("Expected a validation error without a measurement, got %v", err)
+	}
+	start := time.Unix(100, 0)
+	if _, err := s.Delete(context.Background(), SeriesFilter{Measurement: "cpu", Start: start, End: start.Add(-time.Second)}); !errors.IsType(err, errors.ErrorTypeValidation) {
+		t.Errorf("Expected a validation error for an inverted range, got %v", err)
+	}
+	if count, err := s.Delete(context.Background(), SeriesFilter{Measurement: "missing"}); err != nil || count != 0 {
+		t.Errorf("Expected no series to be affected, got %d, %v", count, err)
+	}
+}
+
+func TestStorageDeleteAfterPrunedRestart(t *testing.T) {
+	cfg := config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024}
+	s := NewStorage(cfg)
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	write := func(s *Storage, minutes int) {
+		t.Helper()
+		err := s.WritePoint(context.Background(), types.Point{Measurement: "cpu", Fields: map[string]interface{}{"value": float64(minutes)}, Timestamp: at(minutes)})
+		if err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+	flush := func(s *Storage) {
+		t.Helper()
+		if err := s.shards["default"].ForceFlush(); err != nil {
+			t.Fatalf("Failed to flush: %v", err)
+		}
+	}
+	deleteMinute := func(s *Storage, minutes int) {
+		t.Helper()
+		if _, err := s.Delete(context.Background(), SeriesFilter{Measurement: "cpu", Start: at(minutes), End: at(minutes)}); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+	}
+
+	// A compaction applying the only tombstone prunes the whole log
+	write(s, 0)
+	flush(s)
+	deleteMinute(s, 0)
+	shard := s.shards["default"]
+	segments, err := shard.segmentReader.ListSegments()
+	if err != nil {
+		t.Fatalf("ListSegments failed: %v", err)
+	}
+	if err := shard.compactionMgr.processCompactionTask(compactionTask{Level: 0, Segments: segments}); err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+	if n := shard.tombstones.Len(); n != 0 {
+		t.Fatalf("Expected the tombstone log to be emptied, %d left", n)
+	}
+
+	// A segment written now has applied that tombstone
+	write(s, 1)
+	flush(s)
+
+	// After a restart a new delete must still hide the points of that segment
+	s.Close()
+	s = NewStorage(cfg)
+	defer s.Close()
+	deleteMinute(s, 1)
+
+	points, err := s.ReadPoints(context.Background(), "cpu", nil, "value", at(0), at(10), 0)
+	if err != nil {
+		t.Fatalf("ReadPoints failed: %v", err)
+	}
+	if len(points) != 0 {
+		t.Errorf("Expected every point to be deleted, got %+v", points)
+	}
+}
+
+func TestStorageDeleteDropsEmptySeries(t *testing.T) {
+	cfg := config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024}
+	s := NewStorage(cfg)
+	defer func() { s.Close() }()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	write := func(measurement, host string) {
+		t.Helper()
+		err := s.WritePoint(context.Background(), types.Point{Measurement: measurement, Tags: map[string]string{"host": host}, Fields: map[string]interface{}{"value": 1.0}, Timestamp: base})
+		if err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+	listed := func(measurement string) []string {
+		t.Helper()
+		keys, err := s.ListSeries(measurement)
+		if err != nil {
+			t.Fatalf("ListSeries failed: %v", err)
+		}
+		var hosts []string
+		for _, key := range keys {
+			hosts = append(hosts, key.Tags["host"])
+		}
+		return hosts
+	}
+
+	// Host a of cpu is flushed to a segment, mem only ever in the memstore
+	write("cpu", "a")
+	write("cpu", "b")
+	if err := s.shards["default"].ForceFlush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	write("mem", "a")
+
+	// A series whose points were all in the memstore goes at once
+	if _, err := s.Delete(context.Background(), SeriesFilter{Measurement: "mem"}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if hosts := listed("mem"); len(hosts) != 0 {
+		t.Errorf("Expected no mem series after delete, got %v", hosts)
+	}
+
+	// A series in a segment goes once compaction drops its last point
+	hostA, _ := NewTagMatcher(MatchEqual, "host", "a")
+	if _, err := s.Delete(context.Background(), SeriesFilter{Measurement: "cpu", Matchers: []*TagMatcher{hostA}}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	shard := s.shards["default"]
+	segments, err := shard.segmentReader.ListSegments()
+	if err != nil {
+		t.Fatalf("ListSegments failed: %v", err)
+	}
+	if err := shard.compactionMgr.processCompactionTask(compactionTask{Level: 0, Segments: segments}); err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+	if hosts := listed("cpu"); !reflect.DeepEqual(hosts, []string{"b"}) {
+		t.Errorf("Expected only cpu host b after compaction, got %v", hosts)
+	}
+
+	// The removal is persisted with the index
+	s.Close()
+	s = NewStorage(cfg)
+	if hosts := listed(""); !reflect.DeepEqual(hosts, []string{"b"}) {
+		t.Errorf("Expected only cpu host b after restart, got %v", hosts)
+	}
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"timeseriesdb/internal/types"
+)
+
+// ErrFieldTypeConflict is returned when a write gives a field a different type
+// from the one already recorded for it
+var ErrFieldTypeConflict = errors.New("field type conflict")
+
+// NewDataPoint creates a data point holding a typed field value
+func NewDataPoint(timestamp time.Time, value interface{}) (DataPoint, error) {
+	point := DataPoint{Timestamp: timestamp}
+
+	switch v := value.(type) {
+	case float64:
+		point.Value = v
+	case int64:
+		point.Type = types.FieldTypeInteger
+		point.Integer = v
+		point.Value = float64(v)
+	case uint64:
+		point.Type = types.FieldTypeUnsigned
+		point.Unsigned = v
+		point.Value = float64(v)
+	case bool:
+		point.Type = types.FieldTypeBoolean
+		if v {
+			point.Value = 1
+		}
+	case string:
+		point.Type = types.FieldTypeString
+		point.Text = v
+	default:
+		return point, fmt.Errorf("unsupported field value type %T", value)
+	}
+
+	return point, nil
+}
+
+// FieldValue returns the point's value as float64, int64, uint64, bool or string
+func (p DataPoint) FieldValue() interface{} {
+	switch p.Type {
+	case types.FieldTypeInteger:
+		return p.Integer
+	case types.FieldTypeUnsigned:
+		return p.Unsigned
+	case types.FieldTypeBoolean:
+		return p.Value != 0
+	case types.FieldTypeString:
+		return p.Text
+	}
+	return p.Value
+}
+
+// MarshalJSON encodes the point for the WAL and segments. JSON has no numbers
+// for NaN and the infinities, so such values are written as the strings "NaN",
+// "+Inf" and "-Inf".
+func (p DataPoint) MarshalJSON() ([]byte, error) {
+	type plain DataPoint
+	if !math.IsNaN(p.Value) && !math.IsInf(p.Value, 0) {
+		return json.Marshal(plain(p))
+	}
+	return json.Marshal(struct {
+		plain
+		Value string
+	}{plain(p), strconv.FormatFloat(p.Value, 'g', -1, 64)})
+}
+
+// UnmarshalJSON decodes a point written by MarshalJSON
+func (p *DataPoint) UnmarshalJSON(data []byte) error {
+	type plain DataPoint
+	raw := struct {
+		*plain
+		Value json.RawMessage
+	}{plain: (*plain)(p)}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw.Value) == 0 || string(raw.Value) == "null" {
+		return nil
+	}
+
+	text := string(raw.Value)
+	if raw.Value[0] == '"' {
+		if err := json.Unmarshal(raw.Value, &text); err != nil {
+			return err
+		}
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return fmt.Errorf("invalid point value %s: %w", raw.Value, err)
+	}
+	p.Value = value
+	return nil
+}
+
+// fieldTypeConflict describes a write whose type differs from the recorded one
+func fieldTypeConflict(measurement, field string, existing, got types.FieldType) error {
+	return fmt.Errorf("%w: field %q of measurement %q is %s, got %s",
+		ErrFieldTypeConflict, field, measurement, existing, got)
+}
+
+// pointsType returns the field type shared by a batch of points of one series
+func pointsType(points []DataPoint) (types.FieldType, error) {
+	if len(points) == 0 {
+		return types.FieldTypeFloat, nil
+	}
+	t := points[0].Type
+	for _, p := range points[1:] {
+		if p.Type != t {
+			return t, fmt.Errorf("%w: batch mixes %s and %s values", ErrFieldTypeConflict, t, p.Type)
+		}
+	}
+	return t, nil
+}
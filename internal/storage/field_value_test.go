@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/types"
+)
+
+func TestNewDataPoint(t *testing.T) {
+	ts := time.Unix(0, 1434055562000000000)
+
+	tests := []struct {
+		value     interface{}
+		wantType  types.FieldType
+		wantValue float64
+	}{
+		{1.5, types.FieldTypeFloat, 1.5},
+		{int64(-3), types.FieldTypeInteger, -3},
+		{uint64(7), types.FieldTypeUnsigned, 7},
+		{true, types.FieldTypeBoolean, 1},
+		{false, types.FieldTypeBoolean, 0},
+		{"ok", types.FieldTypeString, 0},
+	}
+
+	for _, tt := range tests {
+		p, err := NewDataPoint(ts, tt.value)
+		if err != nil {
+			t.Fatalf("NewDataPoint(%v) failed: %v", tt.value, err)
+		}
+		if p.Type != tt.wantType || p.Value != tt.wantValue {
+			t.Errorf("NewDataPoint(%v) = %s %v, want %s %v", tt.value, p.Type, p.Value, tt.wantType, tt.wantValue)
+		}
+		if got := p.FieldValue(); got != tt.value {
+			t.Errorf("FieldValue() = %v (%T), want %v (%T)", got, got, tt.value, tt.value)
+		}
+	}
+
+	if _, err := NewDataPoint(ts, 1); err == nil {
+		t.Error("Expected an error for an int value")
+	}
+}
+
+func TestPointsType(t *testing.T) {
+	ts := time.Unix(0, 0)
+	integer, _ := NewDataPoint(ts, int64(1))
+	float, _ := NewDataPoint(ts, 1.0)
+
+	if got, err := pointsType(nil); err != nil || got != types.FieldTypeFloat {
+		t.Errorf("pointsType(nil) = %s, %v", got, err)
+	}
+	if got, err := pointsType([]DataPoint{integer, integer}); err != nil || got != types.FieldTypeInteger {
+		t.Errorf("pointsType(integers) = %s, %v", got, err)
+	}
+	if _, err := pointsType([]DataPoint{integer, float}); !errors.Is(err, ErrFieldTypeConflict) {
+		t.Errorf("Expected a field type conflict, got %v", err)
+	}
+}
+
+func TestDataPointJSON(t *testing.T) {
+	ts := time.Unix(1700000000, 5).UTC()
+	integer, _ := NewDataPoint(ts, int64(-3))
+
+	for _, p := range []DataPoint{
+		{Timestamp: ts, Value: 1.5},
+		{Timestamp: ts, Value: math.NaN()},
+		{Timestamp: ts, Value: math.Inf(1)},
+		{Timestamp: ts, Value: math.Inf(-1), Labels: map[string]string{"k": "v"}},
+		integer,
+	} {
+		data, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("Marshal(%v) failed: %v", p.Value, err)
+		}
+		var got DataPoint
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal(%s) failed: %v", data, err)
+		}
+		if math.Float64bits(got.Value) != math.Float64bits(p.Value) && !(math.IsNaN(got.Value) && math.IsNaN(p.Value)) {
+			t.Errorf("Value of %s = %v, want %v", data, got.Value, p.Value)
+		}
+		if !got.Timestamp.Equal(p.Timestamp) || got.Type != p.Type || got.Integer != p.Integer || got.Labels["k"] != p.Labels["k"] {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", data, got, p)
+		}
+	}
+}
+
+func TestStorageNonFiniteValues(t *testing.T) {
+	cfg := config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024}
+	s := NewStorage(cfg)
+	defer func() { s.Close() }()
+
+	ctx := context.Background()
+	base := time.Unix(1700000000, 0)
+	values := []float64{math.NaN(), math.Inf(1), math.Inf(-1)}
+	for i, v := range values {
+		err := s.WritePoint(ctx, types.Point{Measurement: "quantile", Fields: map[string]interface{}{"value": v}, Timestamp: base.Add(time.Duration(i) * time.Second)})
+		if err != nil {
+			t.Fatalf("Failed to write %v: %v", v, err)
+		}
+	}
+
+	// The points are replayed from the WAL, then read back from a segment
+	s.Close()
+	s = NewStorage(cfg)
+	if err := s.shards["default"].ForceFlush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+
+	points, err := s.ReadPoints(ctx, "quantile", nil, "value", base, base.Add(time.Minute), 0)
+	if err != nil {
+		t.Fatalf("ReadPoints failed: %v", err)
+	}
+	if len(points) != 3 {
+		t.Fatalf("Expected 3 points, got %+v", points)
+	}
+	got0, got1, got2 := points[0].Fields["value"].(float64), points[1].Fields["value"].(float64), points[2].Fields["value"].(float64)
+	if !math.IsNaN(got0) || !math.IsInf(got1, 1) || !math.IsInf(got2, -1) {
+		t.Errorf("Got values %v %v %v, want NaN +Inf -Inf", got0, got1, got2)
+	}
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// FillMode decides what a windowed aggregation returns for the windows of its
+// range that hold no points
+type FillMode string
+
+const (
+	// FillNone leaves out windows without points
+	FillNone FillMode = "none"
+	// FillNull returns windows without points without a value, and with a
+	// value of zero for AggregateCount
+	FillNull FillMode = "null"
+	// FillConstant gives windows without points the value of AggregateOptions.FillValue
+	FillConstant FillMode = "constant"
+	// FillPrevious repeats the value of the previous window holding points
+	FillPrevious FillMode = "previous"
+	// FillLinear interpolates between the windows holding points on either side
+	FillLinear FillMode = "linear"
+)
+
+// fillModes lists the valid fill modes
+var fillModes = []FillMode{FillNone, FillNull, FillConstant, FillPrevious, FillLinear}
+
+// maxFillWindows bounds the number of windows a filled aggregation returns
+const maxFillWindows = 1000000
+
+// ParseFillMode returns the fill mode with the given name
+func ParseFillMode(name string) (FillMode, error) {
+	for _, mode := range fillModes {
+		if strings.EqualFold(name, string(mode)) {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown fill mode %q", name)
+}
+
+// FillWindows fills in the windows between start and end missing from the
+// sorted aggregates of a windowed aggregation, for aggregates computed without
+// a fill mode. A side of the range at the smallest or largest representable
+// time is unbounded, and filling stops at the first or last window holding
+// points.
+func FillWindows(aggregates []WindowAggregate, start, end time.Time, opts AggregateOptions) ([]WindowAggregate, error) {
+	if opts.Window <= 0 || opts.Fill == "" || opts.Fill == FillNone {
+		return aggregates, nil
+	}
+
+	req := &AggregateRequest{Start: start, End: end, AggregateOptions: opts}
+	step := int64(opts.Window)
+
+	var first, last int64
+	switch {
+	case start.UnixNano() != math.MinInt64:
+		first = req.windowStart(start)
+	case len(aggregates) > 0:
+		first = aggregates[0].Start.UnixNano()
+	default:
+		return aggregates, nil
+	}
+	switch {
+	case end.UnixNano() != math.MaxInt64:
+		last = req.windowStart(end)
+	case len(aggregates) > 0:
+		last = aggregates[len(aggregates)-1].Start.UnixNano()
+	default:
+		return aggregates, nil
+	}
+	if last < first {
+		return aggregates, nil
+	}
+	if (last-first)/step >= maxFillWindows {
+		return nil, fmt.Errorf("fill(%s) would return more than %d windows, narrow the time range or widen the window", opts.Fill, maxFillWindows)
+	}
+
+	filled := make([]WindowAggregate, 0, (last-first)/step+1)
+	next := 0
+	for ws := first; ws <= last; ws += step {
+		for next < len(aggregates) && aggregates[next].Start.UnixNano() < ws {
+			next++
+		}
+		if next < len(aggregates) && aggregates[next].Start.UnixNano() == ws {
+			filled = append(filled, aggregates[next])
+			continue
+		}
+
+		window := WindowAggregate{Start: time.Unix(0, ws).UTC(), Null: true}
+		switch opts.Fill {
+		case FillNull:
+			if opts.Function == AggregateCount {
+				window.Null = false
+			}
+		case FillConstant:
+			window.Value, window.Null = opts.FillValue, false
+		case FillPrevious:
+			if next > 0 {
+				window.Value, window.Null = aggregates[next-1].Value, false
+			}
+		case FillLinear:
+			if next > 0 && next < len(aggregates) {
+				prev, after := aggregates[next-1], aggregates[next]
+				ratio := float64(ws-prev.Start.UnixNano()) / float64(after.Start.UnixNano()-prev.Start.UnixNano())
+				window.Value, window.Null = prev.Value+(after.Value-prev.Value)*ratio, false
+			}
+		}
+		filled = append(filled, window)
+	}
+
+	return filled, nil
+}
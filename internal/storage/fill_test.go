@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseFillMode(t *testing.T) {
+	for _, name := range []string{"none", "NULL", "constant", "Previous", "linear"} {
+		if _, err := ParseFillMode(name); err != nil {
+			t.Errorf("ParseFillMode(%q) failed: %v", name, err)
+		}
+	}
+	if _, err := ParseFillMode("zero"); err == nil {
+		t.Error("Expected an unknown fill mode to be rejected")
+	}
+	if err := (AggregateOptions{Function: AggregateMean, Fill: "zero"}).Validate(); err == nil {
+		t.Error("Expected options with an unknown fill mode to be invalid")
+	}
+}
+
+func TestFillWindows(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	aggregates := []WindowAggregate{
+		{Start: at(1), Value: 10, Count: 1},
+		{Start: at(4), Value: 40, Count: 2},
+	}
+	values := func(windows []WindowAggregate) []interface{} {
+		var result []interface{}
+		for _, w := range windows {
+			if w.Null {
+				result = append(result, nil)
+			} else {
+				result = append(result, w.Value)
+			}
+		}
+		return result
+	}
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		opts       AggregateOptions
+		want       []interface{}
+	}{
+		{"none", at(0), at(5), AggregateOptions{Fill: FillNone}, []interface{}{10.0, 40.0}},
+		{"null", at(0), at(5), AggregateOptions{Fill: FillNull}, []interface{}{nil, 10.0, nil, nil, 40.0, nil}},
+		{"null count", at(0), at(5), AggregateOptions{Function: AggregateCount, Fill: FillNull}, []interface{}{0.0, 10.0, 0.0, 0.0, 40.0, 0.0}},
+		{"constant", at(0), at(5), AggregateOptions{Fill: FillConstant, FillValue: 7}, []interface{}{7.0, 10.0, 7.0, 7.0, 40.0, 7.0}},
+		{"previous", at(0), at(5), AggregateOptions{Fill: FillPrevious}, []interface{}{nil, 10.0, 10.0, 10.0, 40.0, 40.0}},
+		{"linear", at(0), at(5), AggregateOptions{Fill: FillLinear}, []interface{}{nil, 10.0, 20.0, 30.0, 40.0, nil}},
+		{"unaligned range", at(0).Add(30 * time.Second), at(4).Add(30 * time.Second), AggregateOptions{Fill: FillNull}, []interface{}{nil, 10.0, nil, nil, 40.0}},
+		{"unbounded", time.Unix(0, math.MinInt64), time.Unix(0, math.MaxInt64), AggregateOptions{Fill: FillNull}, []interface{}{10.0, nil, nil, 40.0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Window = time.Minute
+			filled, err := FillWindows(aggregates, tt.start, tt.end, tt.opts)
+			if err != nil {
+				t.Fatalf("FillWindows failed: %v", err)
+			}
+			got := values(filled)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Got %v, want %v", got, tt.want)
+				}
+			}
+			for i := 1; i < len(filled) && tt.opts.Fill != FillNone; i++ {
+				if filled[i].Start.Sub(filled[i-1].Start) != time.Minute {
+					t.Fatalf("Windows %v and %v are not evenly spaced", filled[i-1].Start, filled[i].Start)
+				}
+			}
+		})
+	}
+
+	if _, err := FillWindows(aggregates, time.Unix(0, 0), base, AggregateOptions{Window: time.Second, Fill: FillNull}); err == nil {
+		t.Error("Expected filling too many windows to fail")
+	}
+	if filled, err := FillWindows(nil, time.Unix(0, math.MinInt64), at(5), AggregateOptions{Window: time.Minute, Fill: FillNull}); err != nil || len(filled) != 0 {
+		t.Errorf("Expected nothing to fill without points and a lower bound, got %v, %v", filled, err)
+	}
+}
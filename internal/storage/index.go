@@ -0,0 +1,516 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"timeseriesdb/internal/types"
+)
+
+// IndexFileName is the name of the tag index file kept in a shard's segments directory
+const IndexFileName = "tags.idx"
+
+// Postings is a sorted list of unique series IDs
+type Postings []string
+
+// Intersect returns the series IDs present in both p and o
+func (p Postings) Intersect(o Postings) Postings {
+	result := make(Postings, 0, min(len(p), len(o)))
+	i, j := 0, 0
+	for i < len(p) && j < len(o) {
+		switch {
+		case p[i] < o[j]:
+			i++
+		case p[i] > o[j]:
+			j++
+		default:
+			result = append(result, p[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// Union returns the series IDs present in either p or o
+func (p Postings) Union(o Postings) Postings {
+	result := make(Postings, 0, len(p)+len(o))
+	i, j := 0, 0
+	for i < len(p) && j < len(o) {
+		switch {
+		case p[i] < o[j]:
+			result = append(result, p[i])
+			i++
+		case p[i] > o[j]:
+			result = append(result, o[j])
+			j++
+		default:
+			result = append(result, p[i])
+			i++
+			j++
+		}
+	}
+	result = append(result, p[i:]...)
+	return append(result, o[j:]...)
+}
+
+// Difference returns the series IDs of p that are not in o
+func (p Postings) Difference(o Postings) Postings {
+	result := make(Postings, 0, len(p))
+	j := 0
+	for _, id := range p {
+		for j < len(o) && o[j] < id {
+			j++
+		}
+		if j < len(o) && o[j] == id {
+			continue
+		}
+		result = append(result, id)
+	}
+	return result
+}
+
+// insert adds a series ID keeping the list sorted and reports whether it was new
+func (p *Postings) insert(id string) bool {
+	i := sort.SearchStrings(*p, id)
+	if i < len(*p) && (*p)[i] == id {
+		return false
+	}
+	*p = append(*p, "")
+	copy((*p)[i+1:], (*p)[i:])
+	(*p)[i] = id
+	return true
+}
+
+// remove deletes a series ID from the list and reports whether it was there
+func (p *Postings) remove(id string) bool {
+	i := sort.SearchStrings(*p, id)
+	if i == len(*p) || (*p)[i] != id {
+		return false
+	}
+	*p = append((*p)[:i], (*p)[i+1:]...)
+	return true
+}
+
+// MatchType is the comparison applied by a TagMatcher
+type MatchType int
+
+const (
+	// MatchEqual selects series whose tag equals the value
+	MatchEqual MatchType = iota
+	// MatchNotEqual selects series whose tag differs from the value
+	MatchNotEqual
+	// MatchRegex selects series whose tag matches the regular expression
+	MatchRegex
+	// MatchNotRegex selects series whose tag does not match the regular expression
+	MatchNotRegex
+)
+
+// TagMatcher is a predicate on a single tag. A series without the tag is
+// treated as having an empty value, so an equality match against the empty
+// value selects the series without the tag.
+type TagMatcher struct {
+	Type  MatchType
+	Key   string
+	Value string
+	re    *regexp.Regexp
+}
+
+// NewTagMatcher creates a tag predicate. Regular expressions are unanchored.
+func NewTagMatcher(t MatchType, key, value string) (*TagMatcher, error) {
+	m := &TagMatcher{Type: t, Key: key, Value: value}
+	switch t {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegex, MatchNotRegex:
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", value, err)
+		}
+		m.re = re
+	default:
+		return nil, fmt.Errorf("unknown match type %d", t)
+	}
+	return m, nil
+}
+
+// Matches reports whether a tag value satisfies the matcher
+func (m *TagMatcher) Matches(value string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegex:
+		return m.re.MatchString(value)
+	case MatchNotRegex:
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+// fieldRef identifies a field of a measurement across all its tag sets
+type fieldRef struct {
+	measurement string
+	field       string
+}
+
+// TagIndex is an inverted index from measurements and tag key/value pairs to
+// the series IDs that carry them. It also records the field type of every
+// series, which must agree for all series of a measurement sharing a field.
+type TagIndex struct {
+	mu           sync.RWMutex
+	path         string
+	series       map[string]SeriesKey
+	all          Postings
+	measurements map[string]Postings
+	tags         map[string]map[string]Postings
+	types        map[string]types.FieldType
+	fields       map[fieldRef]types.FieldType
+	dirty        bool
+}
+
+// indexFile is the persisted form of a TagIndex. Only series whose type is
+// not float are listed in Types, so indexes written before types were
+// recorded load with every series as float.
+type indexFile struct {
+	Series       Postings                       `json:"series"`
+	Measurements map[string]Postings            `json:"measurements"`
+	Tags         map[string]map[string]Postings `json:"tags"`
+	Types        map[string]types.FieldType     `json:"types,omitempty"`
+}
+
+// NewTagIndex creates an empty tag index persisted at path
+func NewTagIndex(path string) *TagIndex {
+	return &TagIndex{
+		path:         path,
+		series:       make(map[string]SeriesKey),
+		measurements: make(map[string]Postings),
+		tags:         make(map[string]map[string]Postings),
+		types:        make(map[string]types.FieldType),
+		fields:       make(map[fieldRef]types.FieldType),
+	}
+}
+
+// Add indexes a series ID holding values of type t and reports whether it was
+// not indexed before. It fails with ErrFieldTypeConflict if the series, or
+// another series of the measurement with the same field, has a different type.
+// IDs that are not valid series keys are tracked but not indexed by tag.
+func (idx *TagIndex) Add(seriesID string, t types.FieldType) (bool, error) {
+	idx.mu.RLock()
+	_, exists := idx.series[seriesID]
+	existing := idx.types[seriesID]
+	key := idx.series[seriesID]
+	idx.mu.RUnlock()
+	if exists {
+		if existing != t {
+			return false, fieldTypeConflict(key.Measurement, key.Field, existing, t)
+		}
+		return false, nil
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.add(seriesID, t)
+}
+
+// add indexes a series ID, the caller must hold the write lock
+func (idx *TagIndex) add(seriesID string, t types.FieldType) (bool, error) {
+	key, err := ParseSeriesKey(seriesID)
+	if _, exists := idx.series[seriesID]; exists {
+		if existing := idx.types[seriesID]; existing != t {
+			return false, fieldTypeConflict(key.Measurement, key.Field, existing, t)
+		}
+		return false, nil
+	}
+
+	ref := fieldRef{measurement: key.Measurement, field: key.Field}
+	if err == nil {
+		if existing, ok := idx.fields[ref]; ok && existing != t {
+			return false, fieldTypeConflict(key.Measurement, key.Field, existing, t)
+		}
+	}
+
+	idx.series[seriesID] = key
+	idx.types[seriesID] = t
+	idx.all.insert(seriesID)
+	idx.dirty = true
+	if err != nil {
+		return true, nil
+	}
+	idx.fields[ref] = t
+
+	postings := idx.measurements[key.Measurement]
+	postings.insert(seriesID)
+	idx.measurements[key.Measurement] = postings
+
+	for k, v := range key.Tags {
+		values, ok := idx.tags[k]
+		if !ok {
+			values = make(map[string]Postings)
+			idx.tags[k] = values
+		}
+		postings := values[v]
+		postings.insert(seriesID)
+		values[v] = postings
+	}
+	return true, nil
+}
+
+// Remove drops series IDs from the index and returns the number that were
+// indexed. Postings left empty are dropped with them, as is the type of a
+// field no remaining series of its measurement has.
+func (idx *TagIndex) Remove(seriesIDs ...string) int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	removed := 0
+	for _, seriesID := range seriesIDs {
+		key, exists := idx.series[seriesID]
+		if !exists {
+			continue
+		}
+		delete(idx.series, seriesID)
+		delete(idx.types, seriesID)
+		idx.all.remove(seriesID)
+		idx.dirty = true
+		removed++
+
+		postings, ok := idx.measurements[key.Measurement]
+		if !ok || !postings.remove(seriesID) {
+			continue
+		}
+		if len(postings) == 0 {
+			delete(idx.measurements, key.Measurement)
+		} else {
+			idx.measurements[key.Measurement] = postings
+		}
+
+		for k, v := range key.Tags {
+			values := idx.tags[k]
+			postings := values[v]
+			postings.remove(seriesID)
+			switch {
+			case len(postings) > 0:
+				values[v] = postings
+			case len(values) > 1:
+				delete(values, v)
+			default:
+				delete(idx.tags, k)
+			}
+		}
+
+		if !idx.hasField(key.Measurement, key.Field) {
+			delete(idx.fields, fieldRef{measurement: key.Measurement, field: key.Field})
+		}
+	}
+	return removed
+}
+
+// hasField reports whether a series of the measurement has the field, the
+// caller holding the lock
+func (idx *TagIndex) hasField(measurement, field string) bool {
+	for _, id := range idx.measurements[measurement] {
+		if idx.series[id].Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of indexed series
+func (idx *TagIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.all)
+}
+
+// SeriesIDs returns every indexed series ID in sorted order
+func (idx *TagIndex) SeriesIDs() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return append([]string(nil), idx.all...)
+}
+
+// Key returns the parsed key of an indexed series
+func (idx *TagIndex) Key(seriesID string) (SeriesKey, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	key, ok := idx.series[seriesID]
+	return key, ok
+}
+
+// SeriesType returns the field type recorded for an indexed series
+func (idx *TagIndex) SeriesType(seriesID string) (types.FieldType, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	t, ok := idx.types[seriesID]
+	return t, ok
+}
+
+// FieldType returns the type recorded for a field of a measurement
+func (idx *TagIndex) FieldType(measurement, field string) (types.FieldType, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	t, ok := idx.fields[fieldRef{measurement: measurement, field: field}]
+	return t, ok
+}
+
+// Fields returns the fields of the series of a measurement in no particular
+// order
+func (idx *TagIndex) Fields(measurement string) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var fields []string
+	for ref := range idx.fields {
+		if ref.measurement == measurement {
+			fields = append(fields, ref.field)
+		}
+	}
+	return fields
+}
+
+// Select returns the series of a measurement that satisfy every matcher.
+// An empty measurement selects across all measurements.
+func (idx *TagIndex) Select(measurement string, matchers ...*TagMatcher) Postings {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var result Postings
+	if measurement == "" {
+		result = idx.validSeries()
+	} else {
+		result = idx.measurements[measurement]
+	}
+
+	for _, m := range matchers {
+		if len(result) == 0 {
+			break
+		}
+		result = idx.apply(result, m)
+	}
+	return append(Postings(nil), result...)
+}
+
+// validSeries returns the series that have a parseable key
+func (idx *TagIndex) validSeries() Postings {
+	var result Postings
+	for _, postings := range idx.measurements {
+		result = result.Union(postings)
+	}
+	return result
+}
+
+// apply narrows a candidate set to the series satisfying a matcher
+func (idx *TagIndex) apply(candidates Postings, m *TagMatcher) Postings {
+	values := idx.tags[m.Key]
+
+	// Series with a value for the key that satisfies the matcher
+	var matched Postings
+	for value, postings := range values {
+		if m.Matches(value) {
+			matched = matched.Union(postings)
+		}
+	}
+
+	// Series without the key behave as if the value were empty
+	if m.Matches("") {
+		var withKey Postings
+		for _, postings := range values {
+			withKey = withKey.Union(postings)
+		}
+		matched = matched.Union(candidates.Difference(withKey))
+	}
+
+	return candidates.Intersect(matched)
+}
+
+// Load reads the persisted index, reporting false if no index file exists
+func (idx *TagIndex) Load() (bool, error) {
+	data, err := os.ReadFile(idx.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read tag index: %w", err)
+	}
+
+	var file indexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return false, fmt.Errorf("failed to unmarshal tag index: %w", err)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.series = make(map[string]SeriesKey, len(file.Series))
+	idx.types = make(map[string]types.FieldType, len(file.Series))
+	idx.fields = make(map[fieldRef]types.FieldType)
+	for _, id := range file.Series {
+		key, err := ParseSeriesKey(id)
+		t := file.Types[id]
+		idx.series[id] = key
+		idx.types[id] = t
+		if err == nil {
+			idx.fields[fieldRef{measurement: key.Measurement, field: key.Field}] = t
+		}
+	}
+	idx.all = file.Series
+	idx.measurements = file.Measurements
+	if idx.measurements == nil {
+		idx.measurements = make(map[string]Postings)
+	}
+	idx.tags = file.Tags
+	if idx.tags == nil {
+		idx.tags = make(map[string]map[string]Postings)
+	}
+	idx.dirty = false
+
+	return true, nil
+}
+
+// Persist writes the index to disk if it changed since it was last loaded or persisted
+func (idx *TagIndex) Persist() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.dirty {
+		return nil
+	}
+
+	file := indexFile{
+		Series:       idx.all,
+		Measurements: idx.measurements,
+		Tags:         idx.tags,
+		Types:        make(map[string]types.FieldType),
+	}
+	for id, t := range idx.types {
+		if t != types.FieldTypeFloat {
+			file.Types[id] = t
+		}
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tag index: %w", err)
+	}
+
+	// Write to a temporary file and rename it so a crash never leaves a partial index
+	tmpPath := idx.path + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0755); err != nil {
+		return fmt.Errorf("failed to create tag index directory: %w", err)
+	}
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write tag index: %w", err)
+	}
+	if err := os.Rename(tmpPath, idx.path); err != nil {
+		return fmt.Errorf("failed to replace tag index: %w", err)
+	}
+
+	idx.dirty = false
+	return nil
+}
@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"timeseriesdb/internal/types"
+)
+
+// newTestIndex returns an index over cpu and mem series with varying tag sets
+func newTestIndex(t *testing.T) *TagIndex {
+	t.Helper()
+
+	idx := NewTagIndex(filepath.Join(t.TempDir(), IndexFileName))
+	for _, key := range []SeriesKey{
+		{Measurement: "cpu", Field: "usage", Tags: map[string]string{"host": "a", "region": "eu"}},
+		{Measurement: "cpu", Field: "usage", Tags: map[string]string{"host": "b", "region": "us"}},
+		{Measurement: "cpu", Field: "usage", Tags: map[string]string{"host": "c"}},
+		{Measurement: "mem", Field: "free", Tags: map[string]string{"host": "a"}},
+	} {
+		if added, err := idx.Add(key.String(), types.FieldTypeFloat); !added || err != nil {
+			t.Fatalf("Expected %s to be newly indexed, got added=%v err=%v", key, added, err)
+		}
+	}
+	return idx
+}
+
+// mustMatcher creates a tag matcher or fails the test
+func mustMatcher(t *testing.T, mt MatchType, key, value string) *TagMatcher {
+	t.Helper()
+
+	m, err := NewTagMatcher(mt, key, value)
+	if err != nil {
+		t.Fatalf("NewTagMatcher failed: %v", err)
+	}
+	return m
+}
+
+func TestPostingsSetOperations(t *testing.T) {
+	a := Postings{"a", "c", "d", "f"}
+	b := Postings{"b", "c", "f", "g"}
+
+	if got, want := a.Intersect(b), (Postings{"c", "f"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Intersect = %v, want %v", got, want)
+	}
+	if got, want := a.Union(b), (Postings{"a", "b", "c", "d", "f", "g"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Union = %v, want %v", got, want)
+	}
+	if got, want := a.Difference(b), (Postings{"a", "d"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Difference = %v, want %v", got, want)
+	}
+}
+
+func TestTagIndexSelect(t *testing.T) {
+	idx := newTestIndex(t)
+
+	tests := []struct {
+		name        string
+		measurement string
+		matchers    func(t *testing.T) []*TagMatcher
+		want        Postings
+	}{
+		{
+			name:        "measurement only",
+			measurement: "cpu",
+			matchers:    func(t *testing.T) []*TagMatcher { return nil },
+			want:        Postings{"cpu:usage:host=a:region=eu", "cpu:usage:host=b:region=us", "cpu:usage:host=c"},
+		},
+		{
+			name:        "equality on a subset of tags",
+			measurement: "cpu",
+			matchers: func(t *testing.T) []*TagMatcher {
+				return []*TagMatcher{mustMatcher(t, MatchEqual, "host", "a")}
+			},
+			want: Postings{"cpu:usage:host=a:region=eu"},
+		},
+		{
+			name:        "negation includes series without the tag",
+			measurement: "cpu",
+			matchers: func(t *testing.T) []*TagMatcher {
+				return []*TagMatcher{mustMatcher(t, MatchNotEqual, "region", "eu")}
+			},
+			want: Postings{"cpu:usage:host=b:region=us", "cpu:usage:host=c"},
+		},
+		{
+			name:        "empty value selects series without the tag",
+			measurement: "cpu",
+			matchers: func(t *testing.T) []*TagMatcher {
+				return []*TagMatcher{mustMatcher(t, MatchEqual, "region", "")}
+			},
+			want: Postings{"cpu:usage:host=c"},
+		},
+		{
+			name:        "regex",
+			measurement: "cpu",
+			matchers: func(t *testing.T) []*TagMatcher {
+				return []*TagMatcher{mustMatcher(t, MatchRegex, "host", "^[ab]$")}
+			},
+			want: Postings{"cpu:usage:host=a:region=eu", "cpu:usage:host=b:region=us"},
+		},
+		{
+			name:        "negated regex",
+			measurement: "cpu",
+			matchers: func(t *testing.T) []*TagMatcher {
+				return []*TagMatcher{mustMatcher(t, MatchNotRegex, "region", "^e")}
+			},
+			want: Postings{"cpu:usage:host=b:region=us", "cpu:usage:host=c"},
+		},
+		{
+			name:        "intersection of matchers",
+			measurement: "cpu",
+			matchers: func(t *testing.T) []*TagMatcher {
+				return []*TagMatcher{
+					mustMatcher(t, MatchRegex, "host", "."),
+					mustMatcher(t, MatchNotEqual, "host", "b"),
+					mustMatcher(t, MatchRegex, "region", "."),
+				}
+			},
+			want: Postings{"cpu:usage:host=a:region=eu"},
+		},
+		{
+			name:        "all measurements",
+			measurement: "",
+			matchers: func(t *testing.T) []*TagMatcher {
+				return []*TagMatcher{mustMatcher(t, MatchEqual, "host", "a")}
+			},
+			want: Postings{"cpu:usage:host=a:region=eu", "mem:free:host=a"},
+		},
+		{
+			name:        "unknown measurement",
+			measurement: "disk",
+			matchers:    func(t *testing.T) []*TagMatcher { return nil },
+			want:        Postings{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := idx.Select(tt.measurement, tt.matchers(t)...)
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("Select = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagIndexAddDuplicate(t *testing.T) {
+	idx := newTestIndex(t)
+
+	if added, err := idx.Add("cpu:usage:host=c", types.FieldTypeFloat); added || err != nil {
+		t.Errorf("Expected re-adding an indexed series to report false, got added=%v err=%v", added, err)
+	}
+	if idx.Len() != 4 {
+		t.Errorf("Expected 4 series, got %d", idx.Len())
+	}
+}
+
+func TestTagIndexPersistLoad(t *testing.T) {
+	idx := newTestIndex(t)
+	if err := idx.Persist(); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+
+	loaded := NewTagIndex(idx.path)
+	found, err := loaded.Load()
+	if err != nil || !found {
+		t.Fatalf("Load returned found=%v err=%v", found, err)
+	}
+
+	if !reflect.DeepEqual(loaded.SeriesIDs(), idx.SeriesIDs()) {
+		t.Errorf("Expected series %v after load, got %v", idx.SeriesIDs(), loaded.SeriesIDs())
+	}
+	got := loaded.Select("cpu", mustMatcher(t, MatchEqual, "region", "us"))
+	if !reflect.DeepEqual(got, Postings{"cpu:usage:host=b:region=us"}) {
+		t.Errorf("Unexpected selection after load: %v", got)
+	}
+
+	missing := NewTagIndex(filepath.Join(t.TempDir(), IndexFileName))
+	if found, err := missing.Load(); found || err != nil {
+		t.Errorf("Expected a missing index to load as not found, got found=%v err=%v", found, err)
+	}
+}
+
+func TestTagIndexFieldTypes(t *testing.T) {
+	idx := newTestIndex(t)
+
+	if _, err := idx.Add("cpu:usage:host=c", types.FieldTypeInteger); !errors.Is(err, ErrFieldTypeConflict) {
+		t.Errorf("Expected a conflict re-adding a series with another type, got %v", err)
+	}
+	if _, err := idx.Add("cpu:usage:host=d", types.FieldTypeString); !errors.Is(err, ErrFieldTypeConflict) {
+		t.Errorf("Expected a conflict for a new series of an existing field, got %v", err)
+	}
+	if added, err := idx.Add("cpu:status:host=a", types.FieldTypeString); !added || err != nil {
+		t.Fatalf("Expected a new field to be indexed, got added=%v err=%v", added, err)
+	}
+
+	if got, ok := idx.FieldType("cpu", "status"); !ok || got != types.FieldTypeString {
+		t.Errorf("FieldType(cpu, status) = %v, %v, want string", got, ok)
+	}
+	if got, ok := idx.SeriesType("cpu:usage:host=a:region=eu"); !ok || got != types.FieldTypeFloat {
+		t.Errorf("SeriesType = %v, %v, want float", got, ok)
+	}
+
+	// Types survive a persist and load
+	if err := idx.Persist(); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+	loaded := NewTagIndex(idx.path)
+	if _, err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got, _ := loaded.SeriesType("cpu:status:host=a"); got != types.FieldTypeString {
+		t.Errorf("Expected string type after load, got %v", got)
+	}
+	if _, err := loaded.Add("cpu:status:host=b", types.FieldTypeBoolean); !errors.Is(err, ErrFieldTypeConflict) {
+		t.Errorf("Expected a conflict after load, got %v", err)
+	}
+}
+
+func TestTagIndexRemove(t *testing.T) {
+	idx := newTestIndex(t)
+
+	if n := idx.Remove("mem:free:host=a", "cpu:usage:host=b:region=us", "missing"); n != 2 {
+		t.Errorf("Expected 2 series removed, got %d", n)
+	}
+	if idx.Len() != 2 {
+		t.Errorf("Expected 2 series, got %d", idx.Len())
+	}
+	if got := idx.Select("mem"); len(got) != 0 {
+		t.Errorf("Expected no mem series, got %v", got)
+	}
+	if got := idx.Select("", mustMatcher(t, MatchEqual, "region", "us")); len(got) != 0 {
+		t.Errorf("Expected no series in region us, got %v", got)
+	}
+	if _, ok := idx.tags["region"]["us"]; ok {
+		t.Error("Expected the empty region=us postings to be dropped")
+	}
+	if _, ok := idx.FieldType("mem", "free"); ok {
+		t.Error("Expected the type of mem.free to be dropped with its last series")
+	}
+
+	// A field without series takes any type again
+	if added, err := idx.Add("mem:free:host=b", types.FieldTypeInteger); !added || err != nil {
+		t.Errorf("Expected mem.free to be indexed as an integer, got added=%v err=%v", added, err)
+	}
+
+	// Removals survive a persist and load
+	if err := idx.Persist(); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+	loaded := NewTagIndex(idx.path)
+	if _, err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := []string{"cpu:usage:host=a:region=eu", "cpu:usage:host=c", "mem:free:host=b"}
+	if !reflect.DeepEqual(loaded.SeriesIDs(), want) {
+		t.Errorf("Expected series %v after load, got %v", want, loaded.SeriesIDs())
+	}
+}
+
+func TestNewTagMatcherInvalidRegex(t *testing.T) {
+	if _, err := NewTagMatcher(MatchRegex, "host", "("); err == nil {
+		t.Error("Expected an error for an invalid regular expression")
+	}
+}
@@ -1,12 +1,15 @@
 package storage
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // SegmentReaderInterface defines the interface for reading segments
 type SegmentReaderInterface interface {
 	ListSegments() ([]*Segment, error)
 	ReadSegment(segmentPath string) (*Segment, []SegmentReadResult, error)
-	ReadSegmentRange(segmentPath string, start, end time.Time) ([]SegmentReadResult, error)
+	ReadSegmentRange(ctx context.Context, segmentPath string, start, end time.Time) ([]SegmentReadResult, error)
 	GetSegmentsDir() string
 }
 
@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/types"
+)
+
+// iteratorChunkPoints is the number of points each series of a PointIterator
+// aims to read from the shards at a time
+const iteratorChunkPoints = 1024
+
+// iteratorFirstChunk is the time span of the first chunk read from a series,
+// before its chunks are sized after the density of its points
+const iteratorFirstChunk = time.Minute
+
+// PointIterator streams the points of a field from the series of a
+// measurement in time order, like ReadPoints returns them. Each series is
+// read from the shards one time chunk at a time, sized to hold about
+// iteratorChunkPoints points, so memory grows with the number of series
+// rather than with the number of points. The database is only locked while
+// a chunk is read.
+type PointIterator struct {
+	db      *Database
+	ctx     context.Context
+	field   string
+	limit   int
+	tagKeys []string
+
+	cursors []*pointCursor
+	queue   cursorQueue
+	started bool
+	emitted int
+	point   types.Point
+	err     error
+}
+
+// pointCursor is the read position within one series
+type pointCursor struct {
+	key SeriesKey
+	// order is the position of the series, breaking timestamp ties
+	order  int
+	points []DataPoint
+	pos    int
+	// next is the start of the next chunk and end the last time to read
+	next  time.Time
+	end   time.Time
+	chunk time.Duration
+}
+
+// IteratePoints returns an iterator over the points of a field from every
+// series of a measurement that carries the given tags, between start and end
+// inclusive. A positive limit stops the iteration after that many points.
+func (db *Database) IteratePoints(ctx context.Context, measurement string, tags map[string]string, field string, start, end time.Time, limit int) (*PointIterator, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "read operation on closed database")
+	}
+
+	matchers := make([]*TagMatcher, 0, len(tags))
+	for k, v := range tags {
+		matchers = append(matchers, &TagMatcher{Type: MatchEqual, Key: k, Value: v})
+	}
+
+	it := &PointIterator{db: db, ctx: ctx, field: field, limit: limit}
+	tagKeys := make(map[string]bool)
+	for _, key := range db.findSeries(measurement, matchers) {
+		if key.Field != field {
+			continue
+		}
+		if !it.addSeries(key, start, end) {
+			continue
+		}
+		for k := range key.Tags {
+			tagKeys[k] = true
+		}
+	}
+
+	for k := range tagKeys {
+		it.tagKeys = append(it.tagKeys, k)
+	}
+	sort.Strings(it.tagKeys)
+
+	if db.metrics != nil {
+		db.metrics.RecordStorageReadOperation("storage", "iterate_points")
+	}
+
+	return it, nil
+}
+
+// IterateSeries returns an iterator over the points of one series between
+// start and end inclusive, read one time chunk at a time like those of
+// IteratePoints
+func (db *Database) IterateSeries(ctx context.Context, key SeriesKey, start, end time.Time) (*PointIterator, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "read operation on closed database")
+	}
+
+	it := &PointIterator{db: db, ctx: ctx, field: key.Field}
+	it.addSeries(key, start, end)
+	for k := range key.Tags {
+		it.tagKeys = append(it.tagKeys, k)
+	}
+	sort.Strings(it.tagKeys)
+
+	if db.metrics != nil {
+		db.metrics.RecordStorageReadOperation("storage", "iterate_series")
+	}
+
+	return it, nil
+}
+
+// addSeries adds a cursor over a series, reporting false when it holds no
+// points between start and end. The caller must hold the read lock.
+func (it *PointIterator) addSeries(key SeriesKey, start, end time.Time) bool {
+	// Chunks only cover the time the series holds points in
+	var min, max time.Time
+	found := false
+	for _, shard := range it.db.shards {
+		shardMin, shardMax, ok, err := shard.seriesBounds(key.String())
+		if err != nil {
+			logger.Warnf("Failed to read series bounds from shard %s: %v", shard.GetID(), err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if !found || shardMin.Before(min) {
+			min = shardMin
+		}
+		if !found || shardMax.After(max) {
+			max = shardMax
+		}
+		found = true
+	}
+	if !found {
+		return false
+	}
+	if min.Before(start) {
+		min = start
+	}
+	if max.After(end) {
+		max = end
+	}
+	if min.After(max) {
+		return false
+	}
+
+	it.cursors = append(it.cursors, &pointCursor{key: key, order: len(it.cursors), next: min, end: max, chunk: iteratorFirstChunk})
+	return true
+}
+
+// TagKeys returns the sorted keys of the tags of the iterated series
+func (it *PointIterator) TagKeys() []string {
+	return it.tagKeys
+}
+
+// Next advances to the next point, reporting false once the points are
+// exhausted, the limit is reached or a read failed
+func (it *PointIterator) Next() bool {
+	if it.err != nil || (it.limit > 0 && it.emitted >= it.limit) {
+		return false
+	}
+
+	if !it.started {
+		it.started = true
+		for _, c := range it.cursors {
+			if it.fill(c) {
+				it.queue = append(it.queue, c)
+			}
+			if it.err != nil {
+				return false
+			}
+		}
+		heap.Init(&it.queue)
+	}
+
+	if len(it.queue) == 0 {
+		return false
+	}
+
+	c := it.queue[0]
+	p := c.points[c.pos]
+	c.pos++
+	it.point = types.Point{
+		Measurement: c.key.Measurement,
+		Tags:        c.key.Tags,
+		Fields:      map[string]interface{}{it.field: p.FieldValue()},
+		Timestamp:   p.Timestamp,
+	}
+	it.emitted++
+
+	if c.pos < len(c.points) || it.fill(c) {
+		heap.Fix(&it.queue, 0)
+	} else {
+		heap.Pop(&it.queue)
+	}
+	return true
+}
+
+// Point returns the current point
+func (it *PointIterator) Point() types.Point {
+	return it.point
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *PointIterator) Err() error {
+	return it.err
+}
+
+// fill reads the next chunks of a series until one holds points, reporting
+// false once the series is exhausted or a read failed. Each chunk is sized
+// after the density of the points of the previous one.
+func (it *PointIterator) fill(c *pointCursor) bool {
+	for !c.next.After(c.end) {
+		chunkEnd := c.end
+		if c.end.Sub(c.next) >= c.chunk {
+			chunkEnd = c.next.Add(c.chunk - 1)
+		}
+
+		points, err := it.readChunk(c.key, c.next, chunkEnd)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		span := chunkEnd.Sub(c.next) + 1
+		if len(points) == 0 {
+			if c.chunk < math.MaxInt64/8 {
+				c.chunk *= 8
+			}
+		} else {
+			c.chunk = time.Duration(float64(span) * iteratorChunkPoints / float64(len(points)))
+			if c.chunk < time.Microsecond {
+				c.chunk = time.Microsecond
+			}
+		}
+
+		c.next = chunkEnd.Add(1)
+		if len(points) > 0 {
+			c.points, c.pos = points, 0
+			return true
+		}
+	}
+
+	c.points, c.pos = nil, 0
+	return false
+}
+
+// readChunk reads the points of a series between start and end inclusive
+// from every shard, sorted by time
+func (it *PointIterator) readChunk(key SeriesKey, start, end time.Time) ([]DataPoint, error) {
+	it.db.mu.RLock()
+	defer it.db.mu.RUnlock()
+
+	if it.db.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("database %s is closed", it.db.name), errors.ErrorTypeStorage, "read operation on closed database")
+	}
+
+	points, err := it.db.readDataPoints(it.ctx, key.String(), start, end, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Shards are read in no particular order
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Timestamp.Before(points[j].Timestamp)
+	})
+
+	if it.db.metrics != nil {
+		it.db.metrics.RecordDataPointsRead("storage", len(points))
+	}
+	return points, nil
+}
+
+// cursorQueue orders series cursors by the time of their current point, and
+// then by series order
+type cursorQueue []*pointCursor
+
+func (q cursorQueue) Len() int { return len(q) }
+func (q cursorQueue) Less(i, j int) bool {
+	ti, tj := q[i].points[q[i].pos].Timestamp, q[j].points[q[j].pos].Timestamp
+	if !ti.Equal(tj) {
+		return ti.Before(tj)
+	}
+	return q[i].order < q[j].order
+}
+func (q cursorQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *cursorQueue) Push(x interface{}) { *q = append(*q, x.(*pointCursor)) }
+func (q *cursorQueue) Pop() interface{} {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return last
+}
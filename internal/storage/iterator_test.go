@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/types"
+)
+
+// collectPoints drains an iterator
+func collectPoints(t *testing.T, it *PointIterator) []types.Point {
+	t.Helper()
+	var points []types.Point
+	for it.Next() {
+		points = append(points, it.Point())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Iteration failed: %v", err)
+	}
+	return points
+}
+
+func TestIteratePoints(t *testing.T) {
+	cfg := config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024}
+	s := NewStorage(cfg)
+	defer s.Close()
+
+	db, err := s.GetDatabase("")
+	if err != nil {
+		t.Fatalf("GetDatabase failed: %v", err)
+	}
+
+	// Hosts write at different rates, sharing some timestamps, so chunks
+	// are sized differently for each series
+	base := time.Now().Add(-time.Hour).Truncate(time.Hour)
+	write := func(from, to int) {
+		t.Helper()
+		for i := from; i < to; i++ {
+			for host, every := range map[string]int{"a": 1, "b": 3, "c": 500} {
+				if i%every != 0 {
+					continue
+				}
+				err := s.WritePoint(context.Background(), types.Point{Measurement: "cpu", Tags: map[string]string{"host": host}, Fields: map[string]interface{}{"usage": float64(i)}, Timestamp: base.Add(time.Duration(i) * 100 * time.Millisecond)})
+				if err != nil {
+					t.Fatalf("Failed to write point: %v", err)
+				}
+			}
+		}
+	}
+
+	// Part of the points are read from a segment
+	write(0, 2000)
+	if err := s.shards["default"].ForceFlush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	write(2000, 3000)
+
+	ctx := context.Background()
+	start, end := base.Add(time.Second), base.Add(250*time.Second)
+
+	t.Run("matches ReadPoints", func(t *testing.T) {
+		for _, limit := range []int{0, 1, 100, 2500} {
+			want, err := db.ReadPoints(ctx, "cpu", nil, "usage", start, end, limit)
+			if err != nil {
+				t.Fatalf("ReadPoints failed: %v", err)
+			}
+			it, err := db.IteratePoints(ctx, "cpu", nil, "usage", start, end, limit)
+			if err != nil {
+				t.Fatalf("IteratePoints failed: %v", err)
+			}
+			got := collectPoints(t, it)
+
+			if len(got) != len(want) {
+				t.Fatalf("limit %d: got %d points, want %d", limit, len(got), len(want))
+			}
+			for i := range got {
+				if !got[i].Timestamp.Equal(want[i].Timestamp) || got[i].Fields["usage"] != want[i].Fields["usage"] {
+					t.Fatalf("limit %d: point %d is %+v, want %+v", limit, i, got[i], want[i])
+				}
+			}
+		}
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		it, err := db.IteratePoints(ctx, "cpu", map[string]string{"host": "c"}, "usage", start, end, 0)
+		if err != nil {
+			t.Fatalf("IteratePoints failed: %v", err)
+		}
+		if keys := it.TagKeys(); len(keys) != 1 || keys[0] != "host" {
+			t.Errorf("Expected the host tag key, got %v", keys)
+		}
+		points := collectPoints(t, it)
+		// c writes every 50s between 1s and 250s
+		if len(points) != 5 {
+			t.Fatalf("Expected 5 points of c, got %d", len(points))
+		}
+		for _, p := range points {
+			if p.Tags["host"] != "c" || p.Measurement != "cpu" {
+				t.Errorf("Unexpected point %+v", p)
+			}
+		}
+	})
+
+	t.Run("one series", func(t *testing.T) {
+		key := SeriesKey{Measurement: "cpu", Field: "usage", Tags: map[string]string{"host": "b"}}
+		want, err := db.ReadSeries(ctx, key, start, end, 0)
+		if err != nil {
+			t.Fatalf("ReadSeries failed: %v", err)
+		}
+		it, err := db.IterateSeries(ctx, key, start, end)
+		if err != nil {
+			t.Fatalf("IterateSeries failed: %v", err)
+		}
+		got := collectPoints(t, it)
+
+		if len(got) != len(want) {
+			t.Fatalf("Got %d points, want %d", len(got), len(want))
+		}
+		for i := range got {
+			if !got[i].Timestamp.Equal(want[i].Timestamp) || got[i].Fields["usage"] != want[i].Fields["usage"] || got[i].Tags["host"] != "b" {
+				t.Fatalf("Point %d is %+v, want %+v", i, got[i], want[i])
+			}
+		}
+	})
+
+	t.Run("no series", func(t *testing.T) {
+		it, err := db.IteratePoints(ctx, "cpu", nil, "missing", start, end, 0)
+		if err != nil {
+			t.Fatalf("IteratePoints failed: %v", err)
+		}
+		if points := collectPoints(t, it); len(points) != 0 {
+			t.Errorf("Expected no points, got %d", len(points))
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		it, err := db.IteratePoints(cancelled, "cpu", nil, "usage", start, end, 0)
+		if err != nil {
+			t.Fatalf("IteratePoints failed: %v", err)
+		}
+		if it.Next() {
+			t.Error("Expected no points after cancellation")
+		}
+		if it.Err() == nil {
+			t.Error("Expected a context error")
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+)
+
+// LastPoint is the newest point of a series
+type LastPoint struct {
+	Key       SeriesKey
+	Timestamp time.Time
+	Value     interface{}
+}
+
+// LastPoints returns the newest point of every series of a measurement
+// selected by the filter, served from the last-value cache of each shard. An
+// empty field returns the newest point of every field. Series without a point,
+// such as those whose points were all deleted, are left out. The points are
+// ordered by series and then by field.
+func (db *Database) LastPoints(ctx context.Context, filter SeriesFilter, field string) ([]LastPoint, error) {
+	startTime := time.Now()
+
+	if filter.Measurement == "" {
+		return nil, errors.NewValidationError("last requires a measurement")
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "last operation on closed database")
+	}
+
+	result := []LastPoint{}
+	for _, key := range db.seriesKeys(filter) {
+		if field != "" && key.Field != field {
+			continue
+		}
+
+		point, found, err := db.lastPoint(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			result = append(result, point)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		si, sj := result[i].Key.Series(), result[j].Key.Series()
+		if si != sj {
+			return si < sj
+		}
+		return result[i].Key.Field < result[j].Key.Field
+	})
+
+	// Update metrics
+	if db.metrics != nil {
+		db.metrics.RecordStorageReadOperation("storage", "last_points")
+		db.metrics.RecordDataPointsRead("storage", len(result))
+		db.metrics.RecordStorageReadLatency("storage", "last_points", time.Since(startTime))
+	}
+
+	return result, nil
+}
+
+// LastPoint returns the newest point of exactly one series, reporting false
+// when the series has no point
+func (db *Database) LastPoint(ctx context.Context, key SeriesKey) (LastPoint, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return LastPoint{}, false, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "last operation on closed database")
+	}
+
+	point, found, err := db.lastPoint(ctx, key)
+	if db.metrics != nil {
+		db.metrics.RecordStorageReadOperation("storage", "last_point")
+	}
+	return point, found, err
+}
+
+// lastPoint returns the newest point of one series across the shards, the
+// caller must hold the read lock. Only a done context fails the lookup, other
+// shard errors are logged.
+func (db *Database) lastPoint(ctx context.Context, key SeriesKey) (LastPoint, bool, error) {
+	seriesID := key.String()
+	var newest DataPoint
+	found := false
+	for _, shard := range db.shards {
+		point, ok, err := shard.Last(ctx, seriesID)
+		if err != nil {
+			if isContextError(err) {
+				return LastPoint{}, false, contextError(err)
+			}
+			logger.Warnf("Failed to read last point from shard %s: %v", shard.GetID(), err)
+			continue
+		}
+		if ok && (!found || point.Timestamp.After(newest.Timestamp)) {
+			newest, found = point, true
+		}
+	}
+	if !found {
+		return LastPoint{}, false, nil
+	}
+	return LastPoint{Key: key, Timestamp: newest.Timestamp, Value: newest.FieldValue()}, true, nil
+}
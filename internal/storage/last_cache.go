@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// LastCache holds the newest point of every series of a shard, so the current
+// value of a series is served without scanning the memstore and segments. The
+// memstore keeps it up to date as points are written, and series missing from
+// it are read from storage and cached on first use. A nil cache holds nothing.
+type LastCache struct {
+	mu     sync.RWMutex
+	points map[string]DataPoint
+	// generation changes whenever an entry is invalidated, so a point read
+	// from storage before a delete is not cached after it
+	generation uint64
+}
+
+// NewLastCache creates an empty last-value cache
+func NewLastCache() *LastCache {
+	return &LastCache{
+		points: make(map[string]DataPoint),
+	}
+}
+
+// Get returns the newest point cached for a series
+func (c *LastCache) Get(seriesID string) (DataPoint, bool) {
+	if c == nil {
+		return DataPoint{}, false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	point, ok := c.points[seriesID]
+	return point, ok
+}
+
+// Update records the newest of the given points if it is at least as new as
+// the cached one. Of several points sharing a timestamp the last one written wins.
+func (c *LastCache) Update(seriesID string, points []DataPoint) {
+	if c == nil || len(points) == 0 {
+		return
+	}
+
+	newest := points[0]
+	for _, point := range points[1:] {
+		if !point.Timestamp.Before(newest.Timestamp) {
+			newest = point
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.points[seriesID]; ok && newest.Timestamp.Before(cached.Timestamp) {
+		return
+	}
+	c.points[seriesID] = newest
+}
+
+// Generation returns the current generation, to be passed to Fill
+func (c *LastCache) Generation() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.generation
+}
+
+// Fill caches a point read from storage for a series missing from the cache.
+// It is ignored if an entry was invalidated since the given generation, as
+// the point may have been deleted since it was read.
+func (c *LastCache) Fill(seriesID string, point DataPoint, generation uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation != generation {
+		return
+	}
+	if cached, ok := c.points[seriesID]; ok && point.Timestamp.Before(cached.Timestamp) {
+		return
+	}
+	c.points[seriesID] = point
+}
+
+// Invalidate drops the cached point of a series if its timestamp is between
+// min and max inclusive, so the next lookup reads the series from storage
+func (c *LastCache) Invalidate(seriesID string, min, max time.Time) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.points[seriesID]
+	if !ok || cached.Timestamp.Before(min) || cached.Timestamp.After(max) {
+		return
+	}
+	delete(c.points, seriesID)
+	c.generation++
+}
+
+// Len returns the number of cached series
+func (c *LastCache) Len() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.points)
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLastCache(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	point := func(minutes int, value float64) DataPoint {
+		return DataPoint{Timestamp: base.Add(time.Duration(minutes) * time.Minute), Value: value}
+	}
+
+	c := NewLastCache()
+	if _, ok := c.Get("cpu:value"); ok {
+		t.Fatal("Expected an empty cache")
+	}
+
+	// The newest point of a write is kept, whatever the order of the points
+	c.Update("cpu:value", []DataPoint{point(5, 5), point(9, 9), point(7, 7)})
+	if got, ok := c.Get("cpu:value"); !ok || got.Value != 9 {
+		t.Errorf("Expected the point at 9 minutes, got %+v", got)
+	}
+	// Older points do not replace it, a later write of the same timestamp does
+	c.Update("cpu:value", []DataPoint{point(3, 3)})
+	c.Update("cpu:value", []DataPoint{point(9, 90)})
+	if got, _ := c.Get("cpu:value"); got.Value != 90 {
+		t.Errorf("Expected the rewritten point, got %+v", got)
+	}
+
+	// Invalidation only drops a point within the range
+	c.Invalidate("cpu:value", base, base.Add(8*time.Minute))
+	if _, ok := c.Get("cpu:value"); !ok {
+		t.Error("Expected the point outside the range to be kept")
+	}
+	generation := c.Generation()
+	c.Invalidate("cpu:value", base, base.Add(10*time.Minute))
+	if _, ok := c.Get("cpu:value"); ok || c.Len() != 0 {
+		t.Error("Expected the point to be invalidated")
+	}
+
+	// A point read before the invalidation is not cached
+	c.Fill("cpu:value", point(9, 90), generation)
+	if _, ok := c.Get("cpu:value"); ok {
+		t.Error("Expected a stale fill to be ignored")
+	}
+	c.Fill("cpu:value", point(4, 4), c.Generation())
+	if got, ok := c.Get("cpu:value"); !ok || got.Value != 4 {
+		t.Errorf("Expected the filled point, got %+v", got)
+	}
+}
+
+func TestLastCache_Nil(t *testing.T) {
+	var c *LastCache
+	c.Update("cpu:value", []DataPoint{{Timestamp: time.Unix(0, 0)}})
+	c.Fill("cpu:value", DataPoint{}, 0)
+	c.Invalidate("cpu:value", time.Unix(0, 0), time.Unix(1, 0))
+	if _, ok := c.Get("cpu:value"); ok || c.Len() != 0 || c.Generation() != 0 {
+		t.Error("Expected a nil cache to hold nothing")
+	}
+}
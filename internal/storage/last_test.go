@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/types"
+)
+
+func TestStorageLastPoints(t *testing.T) {
+	cfg := config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024}
+	s := NewStorage(cfg)
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	write := func(s *Storage, host string, minutes int) {
+		t.Helper()
+		err := s.WritePoint(context.Background(), types.Point{Measurement: "cpu", Tags: map[string]string{"host": host}, Fields: map[string]interface{}{"value": float64(minutes), "idle": int64(100 - minutes)}, Timestamp: at(minutes)})
+		if err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+
+	// Host a has its newest points in the memstore, host b only in a segment
+	for i := 0; i < 5; i++ {
+		write(s, "a", i)
+		write(s, "b", i)
+	}
+	if err := s.shards["default"].ForceFlush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	write(s, "a", 8)
+	write(s, "a", 6)
+
+	last := func(t *testing.T, s *Storage, host, field string) []LastPoint {
+		t.Helper()
+		filter := SeriesFilter{Measurement: "cpu"}
+		if host != "" {
+			matcher, _ := NewTagMatcher(MatchEqual, "host", host)
+			filter.Matchers = []*TagMatcher{matcher}
+		}
+		points, err := s.LastPoints(context.Background(), filter, field)
+		if err != nil {
+			t.Fatalf("LastPoints failed: %v", err)
+		}
+		return points
+	}
+	check := func(t *testing.T, s *Storage, wantA, wantB float64) {
+		t.Helper()
+		points := last(t, s, "", "value")
+		if len(points) != 2 {
+			t.Fatalf("Expected 2 series, got %+v", points)
+		}
+		if points[0].Key.Tags["host"] != "a" || points[0].Value != wantA || !points[0].Timestamp.Equal(at(int(wantA))) {
+			t.Errorf("Host a last point %+v, want %v", points[0], wantA)
+		}
+		if points[1].Key.Tags["host"] != "b" || points[1].Value != wantB {
+			t.Errorf("Host b last point %+v, want %v", points[1], wantB)
+		}
+	}
+	check(t, s, 8, 4)
+
+	// Without a field every field is returned, ordered by series and field
+	points := last(t, s, "a", "")
+	if len(points) != 2 || points[0].Key.Field != "idle" || points[0].Value != int64(92) || points[1].Key.Field != "value" {
+		t.Errorf("Unexpected last points of every field %+v", points)
+	}
+
+	// The cache is warmed from the segments on startup
+	s.Close()
+	s = NewStorage(cfg)
+	defer s.Close()
+	if n := s.shards["default"].lastCache.Len(); n != 4 {
+		t.Errorf("Expected 4 series to be cached on startup, got %d", n)
+	}
+	check(t, s, 8, 4)
+
+	// Deleting the newest point falls back to the one before it
+	hostA, _ := NewTagMatcher(MatchEqual, "host", "a")
+	if _, err := s.Delete(context.Background(), SeriesFilter{Measurement: "cpu", Matchers: []*TagMatcher{hostA}, Start: at(7)}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	check(t, s, 6, 4)
+
+	// A series with every point deleted has no last point
+	if _, err := s.Delete(context.Background(), SeriesFilter{Measurement: "cpu", Matchers: []*TagMatcher{hostA}}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if points := last(t, s, "", "value"); len(points) != 1 || points[0].Key.Tags["host"] != "b" {
+		t.Errorf("Expected only host b to have a last point, got %+v", points)
+	}
+
+	// Neither does one whose newest point has expired
+	if err := s.SetRetentionPolicy("cpu", time.Minute); err != nil {
+		t.Fatalf("SetRetentionPolicy failed: %v", err)
+	}
+	if points := last(t, s, "", "value"); len(points) != 0 {
+		t.Errorf("Expected the expired points to be left out, got %+v", points)
+	}
+}
+
+func TestStorageLastPointsErrors(t *testing.T) {
+	s := NewStorage(config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024})
+	defer s.Close()
+
+	if _, err := s.LastPoints(context.Background(), SeriesFilter{}, "value"); !errors.IsType(err, errors.ErrorTypeValidation) {
+		t.Errorf("Expected a validation error without a measurement, got %v", err)
+	}
+	if points, err := s.LastPoints(context.Background(), SeriesFilter{Measurement: "missing"}, "value"); err != nil || len(points) != 0 {
+		t.Errorf("Expected no points, got %+v, %v", points, err)
+	}
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"math"
 	"sync"
 	"time"
 )
@@ -9,54 +10,86 @@ import (
 type MemStore struct {
 	mu       sync.RWMutex
 	memTable *MemTable
-	maxSize  int64
-	wal      WALInterface
-	onFlush  func(*MemTable) error
-	metrics  *StorageMetrics
-	shardID  string
+	// flushing is the memtable being written to a segment, still read until
+	// the flush completes
+	flushing *MemTable
+	// flushMu serializes flushes
+	flushMu sync.Mutex
+	maxSize int64
+	wal     WALInterface
+	onFlush func(*MemTable) error
+	metrics *StorageMetrics
+	shardID string
+	// lastCache, if set, is given the newest point of every write
+	lastCache *LastCache
 }
 
 // WALInterface defines the interface for WAL operations
 type WALInterface interface {
 	Write(entry WALEntry) error
 	Flush() error
+	Seal() ([]string, error)
+	RemoveSealed(paths []string) error
 }
 
 // NewMemStore creates a new memory store
 func NewMemStore(maxSize int64, wal WALInterface, onFlush func(*MemTable) error, metrics *StorageMetrics, shardID string) *MemStore {
 	return &MemStore{
-		memTable: &MemTable{
-			ID:        uint64(time.Now().UnixNano()),
-			Data:      make(map[string][]DataPoint),
-			Size:      0,
-			MaxSize:   maxSize,
-			CreatedAt: time.Now(),
-			IsFlushed: false,
-		},
-		maxSize: maxSize,
-		wal:     wal,
-		onFlush: onFlush,
-		metrics: metrics,
-		shardID: shardID,
+		memTable: newMemTable(maxSize),
+		maxSize:  maxSize,
+		wal:      wal,
+		onFlush:  onFlush,
+		metrics:  metrics,
+		shardID:  shardID,
+	}
+}
+
+// newMemTable creates an empty memtable
+func newMemTable(maxSize int64) *MemTable {
+	return &MemTable{
+		ID:        uint64(time.Now().UnixNano()),
+		Data:      make(map[string][]DataPoint),
+		Size:      0,
+		MaxSize:   maxSize,
+		CreatedAt: time.Now(),
+		IsFlushed: false,
 	}
 }
 
+// SetLastCache sets the cache keeping the newest point of every series written
+func (ms *MemStore) SetLastCache(cache *LastCache) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.lastCache = cache
+}
+
 // Write writes data points to the memory store
 func (ms *MemStore) Write(seriesID string, points []DataPoint) error {
 	startTime := time.Now()
 
 	ms.mu.Lock()
-	defer ms.mu.Unlock()
 
-	// Add points to memtable
-	if ms.memTable.Data[seriesID] == nil {
-		ms.memTable.Data[seriesID] = make([]DataPoint, 0)
-	}
+	// Write to WAL for durability before the points become visible, so that
+	// the WAL files sealed with a memtable hold all of its points
+	for _, point := range points {
+		entry := WALEntry{
+			ID:        uint64(time.Now().UnixNano()),
+			Timestamp: time.Now(),
+			SeriesID:  seriesID,
+			Points:    []DataPoint{point},
+			Checksum:  calculateChecksum(seriesID, point),
+		}
 
-	ms.memTable.Data[seriesID] = append(ms.memTable.Data[seriesID], points...)
+		if err := ms.wal.Write(entry); err != nil {
+			ms.mu.Unlock()
+			if ms.metrics != nil {
+				ms.metrics.RecordWALError()
+			}
+			return err
+		}
+	}
 
-	// Update size estimate (rough calculation)
-	ms.memTable.Size += int64(len(points) * 64) // Approximate size per point
+	ms.add(seriesID, points)
 
 	// Update metrics
 	if ms.metrics != nil {
@@ -66,43 +99,62 @@ func (ms *MemStore) Write(seriesID string, points []DataPoint) error {
 		ms.metrics.RecordStorageWriteLatency(ms.shardID, "memtable_write", time.Since(startTime))
 	}
 
-	// Check if we need to flush the current memtable after updating size
-	if ms.memTable.Size >= ms.maxSize {
-		// Release lock temporarily to avoid deadlock during flush
-		ms.mu.Unlock()
+	full := ms.memTable.Size >= ms.maxSize
+	ms.mu.Unlock()
 
-		if err := ms.flushMemTable(); err != nil {
+	// Flush the memtable once it is full, without blocking the writes that
+	// go to the next one meanwhile
+	if full {
+		if err := ms.flushMemTable(false); err != nil {
 			if ms.metrics != nil {
 				ms.metrics.RecordStorageWriteError(ms.shardID, "memtable_flush")
 			}
-			// Re-acquire lock before returning
-			ms.mu.Lock()
 			return err
 		}
+	}
 
-		// Re-acquire lock for WAL operations
-		ms.mu.Lock()
+	return nil
+}
+
+// Load adds points recovered from the WAL to the memtable without logging
+// them again. The WAL files holding them are removed by the next flush.
+func (ms *MemStore) Load(seriesID string, points []DataPoint) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.add(seriesID, points)
+}
+
+// add appends points to the current memtable, the caller holding ms.mu
+func (ms *MemStore) add(seriesID string, points []DataPoint) {
+	if ms.memTable.Data[seriesID] == nil {
+		ms.memTable.Data[seriesID] = make([]DataPoint, 0)
 	}
 
-	// Write to WAL for durability
-	for _, point := range points {
-		entry := WALEntry{
-			ID:        uint64(time.Now().UnixNano()),
-			Timestamp: time.Now(),
-			SeriesID:  seriesID,
-			Points:    []DataPoint{point},
-			Checksum:  calculateChecksum(seriesID, point),
-		}
+	ms.memTable.Data[seriesID] = append(ms.memTable.Data[seriesID], points...)
+	ms.lastCache.Update(seriesID, points)
 
-		if err := ms.wal.Write(entry); err != nil {
-			if ms.metrics != nil {
-				ms.metrics.RecordWALError()
-			}
-			return err
-		}
+	// Update size estimate (rough calculation)
+	ms.memTable.Size += int64(len(points) * 64) // Approximate size per point
+}
+
+// points returns the points of a series in the memtable being flushed, if
+// any, followed by those in the current one, the caller holding ms.mu
+func (ms *MemStore) points(seriesID string) []DataPoint {
+	current := ms.memTable.Data[seriesID]
+	if ms.flushing == nil || len(ms.flushing.Data[seriesID]) == 0 {
+		return current
 	}
+	flushing := ms.flushing.Data[seriesID]
+	return append(flushing[:len(flushing):len(flushing)], current...)
+}
 
-	return nil
+// tables returns the memtable being flushed, if any, and the current one,
+// the caller holding ms.mu
+func (ms *MemStore) tables() []*MemTable {
+	if ms.flushing == nil {
+		return []*MemTable{ms.memTable}
+	}
+	return []*MemTable{ms.flushing, ms.memTable}
 }
 
 // Read reads data points from the memory store
@@ -112,7 +164,8 @@ func (ms *MemStore) Read(seriesID string, start, end time.Time) ([]DataPoint, er
 	ms.mu.RLock()
 	defer ms.mu.RUnlock()
 
-	if ms.memTable.Data[seriesID] == nil {
+	points := ms.points(seriesID)
+	if points == nil {
 		// Record read operation even for empty series
 		if ms.metrics != nil {
 			ms.metrics.RecordStorageReadOperation(ms.shardID, "memtable_read")
@@ -122,7 +175,7 @@ func (ms *MemStore) Read(seriesID string, start, end time.Time) ([]DataPoint, er
 	}
 
 	var result []DataPoint
-	for _, point := range ms.memTable.Data[seriesID] {
+	for _, point := range points {
 		if (point.Timestamp.Equal(start) || point.Timestamp.After(start)) &&
 			(point.Timestamp.Equal(end) || point.Timestamp.Before(end)) {
 			result = append(result, point)
@@ -139,6 +192,126 @@ func (ms *MemStore) Read(seriesID string, start, end time.Time) ([]DataPoint, er
 	return result, nil
 }
 
+// Aggregate folds the points of the requested series into per-window partial
+// aggregates without copying them out of the memtable
+func (ms *MemStore) Aggregate(req *AggregateRequest) windowAggregates {
+	startTime := time.Now()
+
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	windows := make(windowAggregates)
+	scanned := 0
+	for _, seriesID := range req.SeriesIDs {
+		for _, point := range ms.points(seriesID) {
+			if req.contains(point.Timestamp) {
+				windows.add(req, point)
+				scanned++
+			}
+		}
+	}
+
+	// Update metrics
+	if ms.metrics != nil {
+		ms.metrics.RecordStorageReadOperation(ms.shardID, "memtable_aggregate")
+		ms.metrics.RecordDataPointsRead(ms.shardID, scanned)
+		ms.metrics.RecordStorageReadLatency(ms.shardID, "memtable_aggregate", time.Since(startTime))
+	}
+
+	return windows
+}
+
+// Delete removes the points of a series with timestamps between min and max
+// inclusive, returning the number of points removed. The points stay in the
+// WAL until the memtable is flushed.
+func (ms *MemStore) Delete(seriesID string, min, max time.Time) int {
+	// Wait for any flush in progress, whose memtable is no longer modified
+	ms.flushMu.Lock()
+	defer ms.flushMu.Unlock()
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	points, ok := ms.memTable.Data[seriesID]
+	if !ok {
+		return 0
+	}
+
+	kept := points[:0]
+	for _, point := range points {
+		if point.Timestamp.Before(min) || point.Timestamp.After(max) {
+			kept = append(kept, point)
+		}
+	}
+	removed := len(points) - len(kept)
+
+	if len(kept) == 0 {
+		delete(ms.memTable.Data, seriesID)
+	} else {
+		ms.memTable.Data[seriesID] = kept
+	}
+	ms.memTable.Size -= int64(removed * 64)
+
+	return removed
+}
+
+// SeriesIDs returns the IDs of all series in the memtables
+func (ms *MemStore) SeriesIDs() []string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	seen := make(map[string]bool, len(ms.memTable.Data))
+	seriesIDs := make([]string, 0, len(ms.memTable.Data))
+	for _, table := range ms.tables() {
+		for seriesID := range table.Data {
+			if !seen[seriesID] {
+				seen[seriesID] = true
+				seriesIDs = append(seriesIDs, seriesID)
+			}
+		}
+	}
+	return seriesIDs
+}
+
+// SeriesInRange returns the IDs of the memtable series with at least one point
+// between start and end
+func (ms *MemStore) SeriesInRange(start, end time.Time) map[string]bool {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	result := make(map[string]bool)
+	for _, table := range ms.tables() {
+		for seriesID, points := range table.Data {
+			for _, point := range points {
+				if !point.Timestamp.Before(start) && !point.Timestamp.After(end) {
+					result[seriesID] = true
+					break
+				}
+			}
+		}
+	}
+	return result
+}
+
+// Bounds returns the times of the oldest and newest memtable points of a
+// series, reporting false when the memtable holds none
+func (ms *MemStore) Bounds(seriesID string) (time.Time, time.Time, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var min, max time.Time
+	points := ms.points(seriesID)
+	for i, point := range points {
+		if i == 0 || point.Timestamp.Before(min) {
+			min = point.Timestamp
+		}
+		if i == 0 || point.Timestamp.After(max) {
+			max = point.Timestamp
+		}
+	}
+	return min, max, len(points) > 0
+}
+
 // GetMemTable returns the current memtable
 func (ms *MemStore) GetMemTable() *MemTable {
 	ms.mu.RLock()
@@ -146,8 +319,30 @@ func (ms *MemStore) GetMemTable() *MemTable {
 	return ms.memTable
 }
 
-// flushMemTable flushes the current memtable and creates a new one
-func (ms *MemStore) flushMemTable() error {
+// flushMemTable writes the current memtable to a segment through onFlush and
+// starts a new one. Unless force is set, nothing is flushed once another
+// flush has emptied the memtable that filled up.
+func (ms *MemStore) flushMemTable(force bool) error {
+	ms.flushMu.Lock()
+	defer ms.flushMu.Unlock()
+
+	// Seal the WAL as the memtable is swapped, so that the sealed files hold
+	// the entries of the flushed memtable and none written after it
+	ms.mu.Lock()
+	if !force && ms.memTable.Size < ms.maxSize {
+		ms.mu.Unlock()
+		return nil
+	}
+	sealed, err := ms.wal.Seal()
+	if err != nil {
+		ms.mu.Unlock()
+		return err
+	}
+	memTable := ms.memTable
+	ms.flushing = memTable
+	ms.memTable = newMemTable(ms.maxSize)
+	ms.mu.Unlock()
+
 	startTime := time.Now()
 
 	// Record flush start
@@ -156,31 +351,43 @@ func (ms *MemStore) flushMemTable() error {
 	}
 
 	if ms.onFlush != nil {
-		if err := ms.onFlush(ms.memTable); err != nil {
-			if ms.metrics != nil {
-				ms.metrics.RecordMemTableFlushComplete(startTime, err)
-			}
-			return err
+		err = ms.onFlush(memTable)
+	}
+
+	ms.mu.Lock()
+	ms.flushing = nil
+	if err != nil {
+		// Put the points back ahead of those written during the flush. The
+		// sealed WAL files are kept, and removed by the next flush.
+		for seriesID, points := range memTable.Data {
+			ms.memTable.Data[seriesID] = append(points, ms.memTable.Data[seriesID]...)
 		}
+		ms.memTable.Size += memTable.Size
+		ms.mu.Unlock()
+
+		if ms.metrics != nil {
+			ms.metrics.RecordMemTableFlushComplete(startTime, err)
+		}
+		return err
 	}
 
-	// Mark current memtable as flushed
-	ms.memTable.IsFlushed = true
+	// Mark the memtable as flushed
+	memTable.IsFlushed = true
+	size := ms.memTable.Size
+	ms.mu.Unlock()
 
-	// Create new memtable
-	ms.memTable = &MemTable{
-		ID:        uint64(time.Now().UnixNano()),
-		Data:      make(map[string][]DataPoint),
-		Size:      0,
-		MaxSize:   ms.maxSize,
-		CreatedAt: time.Now(),
-		IsFlushed: false,
+	// The flushed points are durable, so the WAL no longer needs to replay them
+	if err := ms.wal.RemoveSealed(sealed); err != nil {
+		if ms.metrics != nil {
+			ms.metrics.RecordMemTableFlushComplete(startTime, err)
+		}
+		return err
 	}
 
 	// Record flush completion
 	if ms.metrics != nil {
 		ms.metrics.RecordMemTableFlushComplete(startTime, nil)
-		ms.metrics.RecordMemTableSize(0) // Reset size metric
+		ms.metrics.RecordMemTableSize(size)
 	}
 
 	return nil
@@ -188,9 +395,7 @@ func (ms *MemStore) flushMemTable() error {
 
 // ForceFlush forces a flush of the current memtable
 func (ms *MemStore) ForceFlush() error {
-	ms.mu.Lock()
-	defer ms.mu.Unlock()
-	return ms.flushMemTable()
+	return ms.flushMemTable(true)
 }
 
 // GetSize returns the current size of the memtable
@@ -208,6 +413,11 @@ func calculateChecksum(seriesID string, point DataPoint) uint32 {
 		sum += uint32(b)
 	}
 	sum += uint32(point.Timestamp.Unix())
-	sum += uint32(point.Value * 1000) // Convert float to int for checksum
+	if math.IsNaN(point.Value) || math.IsInf(point.Value, 0) {
+		// Converting them to an integer is implementation-specific
+		sum += uint32(math.Float64bits(point.Value))
+	} else {
+		sum += uint32(point.Value * 1000) // Convert float to int for checksum
+	}
 	return sum
 }
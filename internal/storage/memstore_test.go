@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -28,6 +29,14 @@ func (m *MockWAL) Flush() error {
 	return nil
 }
 
+func (m *MockWAL) Seal() ([]string, error) {
+	return nil, nil
+}
+
+func (m *MockWAL) RemoveSealed(paths []string) error {
+	return nil
+}
+
 func TestNewMemStore(t *testing.T) {
 	t.Run("create new memstore", func(t *testing.T) {
 		mockWAL := &MockWAL{}
@@ -341,6 +350,78 @@ func TestMemStoreFlush(t *testing.T) {
 		if err.Error() != "flush failed" {
 			t.Errorf("Expected error 'flush failed', got %v", err)
 		}
+
+		// The points are kept for the next flush
+		read, err := memStore.Read("test_series", time.Unix(0, 0), time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("Failed to read points: %v", err)
+		}
+		if len(read) != 2 {
+			t.Errorf("Expected 2 points after a failed flush, got %d", len(read))
+		}
+	})
+
+	t.Run("flush keeps the WAL entries of later writes", func(t *testing.T) {
+		walDir := t.TempDir()
+		wal, err := NewWAL(WALConfig{Path: filepath.Join(walDir, "shard.wal"), MaxFileSize: 1024 * 1024})
+		if err != nil {
+			t.Fatalf("Failed to create WAL: %v", err)
+		}
+		defer wal.Close()
+
+		var memStore *MemStore
+		fail := true
+		onFlush := func(memTable *MemTable) error {
+			// A write racing the flush goes to the next memtable
+			if err := memStore.Write("later", []DataPoint{{Timestamp: time.Now(), Value: 3}}); err != nil {
+				return err
+			}
+			read, err := memStore.Read("test_series", time.Unix(0, 0), time.Now().Add(time.Hour))
+			if err != nil || len(read) != 2 {
+				t.Errorf("Expected the flushing points to be read, got %v (%v)", read, err)
+			}
+			if fail {
+				return fmt.Errorf("flush failed")
+			}
+			return nil
+		}
+		memStore = NewMemStore(100, wal, onFlush, nil, "test_shard")
+
+		points := []DataPoint{
+			{Timestamp: time.Now(), Value: 1.0},
+			{Timestamp: time.Now().Add(time.Second), Value: 2.0},
+		}
+		if err := memStore.Write("test_series", points); err == nil {
+			t.Fatal("Expected error when flush fails")
+		}
+
+		// A failed flush leaves every entry in the WAL
+		wal.Flush()
+		result, err := NewWALReplay(walDir, nil).Replay()
+		if err != nil {
+			t.Fatalf("Failed to replay WAL: %v", err)
+		}
+		if result.TotalCount != 3 {
+			t.Errorf("Expected 3 WAL entries after a failed flush, got %d", result.TotalCount)
+		}
+
+		fail = false
+		if err := memStore.ForceFlush(); err != nil {
+			t.Fatalf("Force flush failed: %v", err)
+		}
+
+		// Only the entry written during the last flush is left
+		wal.Flush()
+		result, err = NewWALReplay(walDir, nil).Replay()
+		if err != nil {
+			t.Fatalf("Failed to replay WAL: %v", err)
+		}
+		if result.TotalCount != 1 || len(result.SeriesData["later"]) != 1 {
+			t.Errorf("Expected only the entry written during the flush, got %d entries: %v", result.TotalCount, result.SeriesData)
+		}
+		if read, _ := memStore.Read("later", time.Unix(0, 0), time.Now().Add(time.Hour)); len(read) != 1 {
+			t.Errorf("Expected the point written during the flush to be kept, got %v", read)
+		}
 	})
 
 	t.Run("force flush", func(t *testing.T) {
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"time"
 )
 
@@ -34,7 +35,7 @@ func (m *MockSegmentReader) ReadSegment(segmentPath string) (*Segment, []Segment
 	return &Segment{}, []SegmentReadResult{}, nil
 }
 
-func (m *MockSegmentReader) ReadSegmentRange(segmentPath string, start, end time.Time) ([]SegmentReadResult, error) {
+func (m *MockSegmentReader) ReadSegmentRange(ctx context.Context, segmentPath string, start, end time.Time) ([]SegmentReadResult, error) {
 	if m.ReadSegmentRangeFunc != nil {
 		return m.ReadSegmentRangeFunc(segmentPath, start, end)
 	}
@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"timeseriesdb/internal/errors"
+)
+
+// RateFunction names a function computing how fast a series changes. Unlike
+// aggregates, these need the points of each series in time order, so they are
+// computed per series once its points are read from every shard.
+type RateFunction string
+
+const (
+	// RateDerivative returns the change between consecutive points per Unit
+	RateDerivative RateFunction = "derivative"
+	// RateNonNegativeDerivative is RateDerivative without the negative
+	// results, such as those of counter resets
+	RateNonNegativeDerivative RateFunction = "non_negative_derivative"
+	// RateRate returns the average increase per Unit of a counter over each window
+	RateRate RateFunction = "rate"
+	// RateIncrease returns the increase of a counter over each window
+	RateIncrease RateFunction = "increase"
+)
+
+// rateFunctions lists the valid rate functions
+var rateFunctions = []RateFunction{RateDerivative, RateNonNegativeDerivative, RateRate, RateIncrease}
+
+// ParseRateFunction returns the rate function with the given name
+func ParseRateFunction(name string) (RateFunction, error) {
+	for _, fn := range rateFunctions {
+		if strings.EqualFold(name, string(fn)) {
+			return fn, nil
+		}
+	}
+	return "", fmt.Errorf("unknown rate function %q", name)
+}
+
+// Windowed reports whether the function returns one value per window, rather
+// than one per point
+func (f RateFunction) Windowed() bool {
+	return f == RateRate || f == RateIncrease
+}
+
+// RateOptions configures a rate computation
+type RateOptions struct {
+	Function RateFunction
+	// Unit is the time unit of derivatives and rates, one second when zero
+	Unit time.Duration
+	// Window is the width of the windows of RateRate and RateIncrease,
+	// aligned to the Unix epoch. Zero computes them over the whole range.
+	Window time.Duration
+	// Fill decides what is returned for windows without a value when Window
+	// is set. Empty means FillNone.
+	Fill FillMode
+	// FillValue is the value of the windows without a value for FillConstant
+	FillValue float64
+}
+
+// Validate checks that the options describe a supported rate computation
+func (o RateOptions) Validate() error {
+	if _, err := ParseRateFunction(string(o.Function)); err != nil {
+		return err
+	}
+	if o.Unit < 0 {
+		return fmt.Errorf("unit must not be negative")
+	}
+	if o.Window < 0 {
+		return fmt.Errorf("window must not be negative")
+	}
+	if !o.Function.Windowed() && (o.Window > 0 || o.Fill != "") {
+		return fmt.Errorf("%s() returns one value per point and does not support windows", o.Function)
+	}
+	if o.Fill != "" {
+		if _, err := ParseFillMode(string(o.Fill)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unit returns the time unit of the results in nanoseconds
+func (o RateOptions) unit() float64 {
+	if o.Unit <= 0 {
+		return float64(time.Second)
+	}
+	return float64(o.Unit)
+}
+
+// RateSeries computes a rate function over each of the given series and sums
+// the results sharing a timestamp, so the rate of a group of counters is the
+// rate of their total. Derivatives are timestamped with the later point of
+// each pair, and windowed functions with the start of their window.
+func (db *Database) RateSeries(ctx context.Context, keys []SeriesKey, start, end time.Time, opts RateOptions) ([]WindowAggregate, error) {
+	startTime := time.Now()
+
+	if err := opts.Validate(); err != nil {
+		return nil, errors.NewValidationError(err.Error())
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "rate operation on closed database")
+	}
+
+	for _, key := range keys {
+		if t, ok := db.seriesType(key); ok && !t.Numeric() {
+			return nil, errors.NewValidationError(fmt.Sprintf("%s() is not supported for %s field %q", opts.Function, t, key.Field))
+		}
+	}
+
+	req := &AggregateRequest{Start: start, End: end, AggregateOptions: AggregateOptions{Window: opts.Window}}
+	sums := make(map[int64]*WindowAggregate)
+	pointsRead := 0
+	for _, key := range keys {
+		points, err := db.readDataPoints(ctx, key.String(), start, end, 0)
+		if err != nil {
+			return nil, err
+		}
+		pointsRead += len(points)
+
+		// Shards are read in no particular order
+		sort.SliceStable(points, func(i, j int) bool {
+			return points[i].Timestamp.Before(points[j].Timestamp)
+		})
+
+		for _, r := range seriesRates(req, points, opts) {
+			ts := r.Start.UnixNano()
+			if sum, ok := sums[ts]; ok {
+				sum.Value += r.Value
+				sum.Count += r.Count
+			} else {
+				r := r
+				sums[ts] = &r
+			}
+		}
+	}
+
+	result := make([]WindowAggregate, 0, len(sums))
+	for _, sum := range sums {
+		result = append(result, *sum)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Start.Before(result[j].Start) })
+
+	result, err := FillWindows(result, start, end, AggregateOptions{Window: opts.Window, Fill: opts.Fill, FillValue: opts.FillValue})
+	if err != nil {
+		return nil, errors.NewValidationError(err.Error())
+	}
+
+	// Update metrics
+	if db.metrics != nil {
+		db.metrics.RecordStorageReadOperation("storage", "rate_series")
+		db.metrics.RecordDataPointsRead("storage", pointsRead)
+		db.metrics.RecordStorageReadLatency("storage", "rate_series", time.Since(startTime))
+	}
+
+	return result, nil
+}
+
+// seriesRates computes a rate function over the points of one series sorted by time
+func seriesRates(req *AggregateRequest, points []DataPoint, opts RateOptions) []WindowAggregate {
+	var result []WindowAggregate
+
+	if !opts.Function.Windowed() {
+		for i := 1; i < len(points); i++ {
+			prev, p := points[i-1], points[i]
+			elapsed := p.Timestamp.Sub(prev.Timestamp)
+			if elapsed <= 0 {
+				continue
+			}
+			value := (p.Value - prev.Value) * opts.unit() / float64(elapsed)
+			if opts.Function == RateNonNegativeDerivative && value < 0 {
+				continue
+			}
+			result = append(result, WindowAggregate{Start: p.Timestamp, Value: value, Count: 2})
+		}
+		return result
+	}
+
+	for i := 0; i < len(points); {
+		ws := req.windowStart(points[i].Timestamp)
+		j := i + 1
+		for j < len(points) && req.windowStart(points[j].Timestamp) == ws {
+			j++
+		}
+		window := points[i:j]
+		i = j
+
+		if len(window) < 2 {
+			continue
+		}
+
+		// The window covers the requested range, or its part of it. Sides
+		// of the range left unbounded end at the first or last point.
+		rangeStart, rangeEnd := req.Start.UnixNano(), req.End.UnixNano()
+		if req.Window > 0 {
+			rangeStart = max(rangeStart, ws)
+			if ws <= math.MaxInt64-int64(req.Window) {
+				rangeEnd = min(rangeEnd, ws+int64(req.Window))
+			}
+		}
+		if rangeStart == math.MinInt64 {
+			rangeStart = window[0].Timestamp.UnixNano()
+		}
+		if rangeEnd == math.MaxInt64 {
+			rangeEnd = window[len(window)-1].Timestamp.UnixNano()
+		}
+		if rangeEnd <= rangeStart {
+			continue
+		}
+
+		value := extrapolatedIncrease(window, rangeStart, rangeEnd)
+		if opts.Function == RateRate {
+			value = value * opts.unit() / float64(rangeEnd-rangeStart)
+		}
+		result = append(result, WindowAggregate{Start: time.Unix(0, ws).UTC(), Value: value, Count: len(window)})
+	}
+	return result
+}
+
+// extrapolatedIncrease returns the increase of a counter from its sorted
+// points within [rangeStart, rangeEnd]. A value lower than the previous one is
+// a counter reset, after which the counter started over from zero. Like
+// Prometheus, the increase between the first and last point is extrapolated
+// towards the boundaries of the range when the points reach close enough to
+// them, and never below a counter value of zero.
+func extrapolatedIncrease(points []DataPoint, rangeStart, rangeEnd int64) float64 {
+	first, last := points[0], points[len(points)-1]
+
+	result := last.Value - first.Value
+	prev := first.Value
+	for _, p := range points[1:] {
+		if p.Value < prev {
+			result += prev
+		}
+		prev = p.Value
+	}
+
+	sampled := float64(last.Timestamp.UnixNano() - first.Timestamp.UnixNano())
+	if sampled <= 0 {
+		return result
+	}
+	toStart := float64(first.Timestamp.UnixNano() - rangeStart)
+	toEnd := float64(rangeEnd - last.Timestamp.UnixNano())
+	average := sampled / float64(len(points)-1)
+
+	if result > 0 && first.Value >= 0 {
+		if toZero := sampled * (first.Value / result); toZero < toStart {
+			toStart = toZero
+		}
+	}
+
+	threshold := average * 1.1
+	extrapolated := sampled
+	if toStart < threshold {
+		extrapolated += toStart
+	} else {
+		extrapolated += average / 2
+	}
+	if toEnd < threshold {
+		extrapolated += toEnd
+	} else {
+		extrapolated += average / 2
+	}
+
+	return result * extrapolated / sampled
+}
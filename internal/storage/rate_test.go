@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/types"
+)
+
+func TestRateOptionsValidate(t *testing.T) {
+	valid := []RateOptions{
+		{Function: RateDerivative},
+		{Function: RateNonNegativeDerivative, Unit: time.Minute},
+		{Function: RateRate, Window: time.Minute, Fill: FillNull},
+		{Function: RateIncrease},
+	}
+	for _, opts := range valid {
+		if err := opts.Validate(); err != nil {
+			t.Errorf("Validate(%+v) failed: %v", opts, err)
+		}
+	}
+
+	invalid := []RateOptions{
+		{Function: "irate"},
+		{Function: RateRate, Unit: -time.Second},
+		{Function: RateRate, Window: -time.Second},
+		{Function: RateDerivative, Window: time.Minute},
+		{Function: RateIncrease, Window: time.Minute, Fill: "zero"},
+	}
+	for _, opts := range invalid {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded, want error", opts)
+		}
+	}
+
+	if fn, err := ParseRateFunction("NON_NEGATIVE_DERIVATIVE"); err != nil || fn != RateNonNegativeDerivative {
+		t.Errorf("ParseRateFunction returned %q, %v", fn, err)
+	}
+}
+
+func TestSeriesRates(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time { return base.Add(time.Duration(seconds) * time.Second) }
+	// The counter resets between the third and fourth point
+	points := aggregatePoints(base, 0, 10, 20, 5, 15)
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		opts       RateOptions
+		wantTimes  []time.Time
+		wantValues []float64
+	}{
+		{"derivative", at(0), at(4), RateOptions{Function: RateDerivative}, []time.Time{at(1), at(2), at(3), at(4)}, []float64{10, 10, -15, 10}},
+		{"derivative per minute", at(0), at(4), RateOptions{Function: RateDerivative, Unit: time.Minute}, []time.Time{at(1), at(2), at(3), at(4)}, []float64{600, 600, -900, 600}},
+		{"non-negative derivative", at(0), at(4), RateOptions{Function: RateNonNegativeDerivative}, []time.Time{at(1), at(2), at(4)}, []float64{10, 10, 10}},
+		{"increase over the range", at(0), at(4), RateOptions{Function: RateIncrease}, []time.Time{at(0)}, []float64{35}},
+		{"rate over the range", at(0), at(4), RateOptions{Function: RateRate}, []time.Time{at(0)}, []float64{8.75}},
+		// Extrapolated to the start, where the counter was zero, and by half
+		// an interval towards the distant end
+		{"extrapolated increase", at(-1), at(14), RateOptions{Function: RateIncrease}, []time.Time{at(-1)}, []float64{39.375}},
+		{"extrapolated rate", at(-1), at(14), RateOptions{Function: RateRate}, []time.Time{at(-1)}, []float64{2.625}},
+		// The last window only holds a single point
+		{"windowed increase", at(0), at(4), RateOptions{Function: RateIncrease, Window: 2 * time.Second}, []time.Time{at(0), at(2)}, []float64{20, 10}},
+		{"windowed rate", at(0), at(4), RateOptions{Function: RateRate, Window: 2 * time.Second}, []time.Time{at(0), at(2)}, []float64{10, 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &AggregateRequest{Start: tt.start, End: tt.end, AggregateOptions: AggregateOptions{Window: tt.opts.Window}}
+			results := seriesRates(req, points, tt.opts)
+			if len(results) != len(tt.wantValues) {
+				t.Fatalf("Got %+v, want values %v", results, tt.wantValues)
+			}
+			for i, r := range results {
+				if !r.Start.Equal(tt.wantTimes[i]) || r.Value != tt.wantValues[i] {
+					t.Errorf("Result %d is %v at %v, want %v at %v", i, r.Value, r.Start, tt.wantValues[i], tt.wantTimes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStorageRateSeries(t *testing.T) {
+	cfg := config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024}
+	s := NewStorage(cfg)
+	defer s.Close()
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	counters := map[string][]float64{
+		"a": {0, 60, 120, 180, 240},
+		"b": {0, 120, 240, 60, 180},
+	}
+	write := func(from, to int) {
+		t.Helper()
+		for host, values := range counters {
+			for i := from; i < to; i++ {
+				err := s.WritePoint(context.Background(), types.Point{Measurement: "net", Tags: map[string]string{"host": host}, Fields: map[string]interface{}{"bytes": values[i], "iface": "eth0"}, Timestamp: at(i)})
+				if err != nil {
+					t.Fatalf("Failed to write point: %v", err)
+				}
+			}
+		}
+	}
+
+	// The first points of each series are read from a segment
+	write(0, 3)
+	if err := s.shards["default"].ForceFlush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	write(3, 5)
+
+	keys, err := s.FindSeries("net")
+	if err != nil {
+		t.Fatalf("FindSeries failed: %v", err)
+	}
+	var counterKeys []SeriesKey
+	for _, key := range keys {
+		if key.Field == "bytes" {
+			counterKeys = append(counterKeys, key)
+		}
+	}
+
+	// Rates of the group are summed: 1/s for a and 1.75/s for b
+	rates, err := s.RateSeries(context.Background(), counterKeys, at(0), at(4), RateOptions{Function: RateRate})
+	if err != nil {
+		t.Fatalf("RateSeries failed: %v", err)
+	}
+	if len(rates) != 1 || rates[0].Value != 2.75 || rates[0].Count != 10 {
+		t.Errorf("Expected a rate of 2.75 over 10 points, got %+v", rates)
+	}
+
+	derivatives, err := s.RateSeries(context.Background(), counterKeys, at(0), at(4), RateOptions{Function: RateDerivative, Unit: time.Minute})
+	if err != nil {
+		t.Fatalf("RateSeries failed: %v", err)
+	}
+	want := []float64{180, 180, -120, 180}
+	if len(derivatives) != len(want) {
+		t.Fatalf("Got %+v, want values %v", derivatives, want)
+	}
+	for i, d := range derivatives {
+		if d.Value != want[i] || !d.Start.Equal(at(i+1)) {
+			t.Errorf("Derivative %d is %v at %v, want %v at %v", i, d.Value, d.Start, want[i], at(i+1))
+		}
+	}
+
+	increases, err := s.RateSeries(context.Background(), counterKeys[:1], at(0), at(5), RateOptions{Function: RateIncrease, Window: 2 * time.Minute, Fill: FillNull})
+	if err != nil {
+		t.Fatalf("RateSeries failed: %v", err)
+	}
+	if len(increases) == 0 || increases[len(increases)-1].Null != true {
+		t.Errorf("Expected the last window to be filled with null, got %+v", increases)
+	}
+
+	for _, key := range keys {
+		if key.Field != "iface" {
+			continue
+		}
+		_, err := s.RateSeries(context.Background(), []SeriesKey{key}, at(0), at(4), RateOptions{Function: RateRate})
+		if !errors.IsType(err, errors.ErrorTypeValidation) {
+			t.Errorf("Expected a validation error for a string field, got %v", err)
+		}
+	}
+	if _, err := s.RateSeries(context.Background(), counterKeys, at(0), at(4), RateOptions{Function: RateDerivative, Window: time.Minute}); !errors.IsType(err, errors.ErrorTypeValidation) {
+		t.Errorf("Expected a validation error for a windowed derivative, got %v", err)
+	}
+}
@@ -0,0 +1,324 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+)
+
+// retentionFileName is the file in a database directory holding its retention policies
+const retentionFileName = "retention.json"
+
+// RetentionPolicy keeps the points of a database, or of one of its
+// measurements, for Duration after their timestamp. A policy without a
+// measurement applies to every measurement that has no policy of its own.
+type RetentionPolicy struct {
+	Measurement string
+	Duration    time.Duration
+}
+
+// RetentionFunc returns the time before which the points of a series have
+// expired, or the zero time if the series is kept forever
+type RetentionFunc func(seriesID string) time.Time
+
+// RetentionResult summarizes the data reclaimed by enforcing retention
+type RetentionResult struct {
+	SegmentsDeleted int
+	PointsReclaimed int
+	BytesReclaimed  int64
+}
+
+// add accumulates the data reclaimed by another run
+func (r *RetentionResult) add(o RetentionResult) {
+	r.SegmentsDeleted += o.SegmentsDeleted
+	r.PointsReclaimed += o.PointsReclaimed
+	r.BytesReclaimed += o.BytesReclaimed
+}
+
+// retentionPolicies holds the retention policies of a database, persisted as JSON
+type retentionPolicies struct {
+	mu           sync.RWMutex
+	path         string
+	database     time.Duration
+	measurements map[string]time.Duration
+}
+
+// retentionFile is the persisted form of the retention policies of a database
+type retentionFile struct {
+	Policies []retentionFilePolicy `json:"policies"`
+}
+
+// retentionFilePolicy is one persisted policy, with its duration in Go syntax
+type retentionFilePolicy struct {
+	Measurement string `json:"measurement,omitempty"`
+	Duration    string `json:"duration"`
+}
+
+// loadRetentionPolicies reads the policies persisted at path. A missing file
+// means no policies.
+func loadRetentionPolicies(path string) (*retentionPolicies, error) {
+	rp := &retentionPolicies{
+		path:         path,
+		measurements: make(map[string]time.Duration),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rp, nil
+		}
+		return nil, fmt.Errorf("failed to read retention policies: %w", err)
+	}
+
+	var file retentionFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal retention policies: %w", err)
+	}
+	for _, p := range file.Policies {
+		d, err := time.ParseDuration(p.Duration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid retention duration %q", p.Duration)
+		}
+		if p.Measurement == "" {
+			rp.database = d
+		} else {
+			rp.measurements[p.Measurement] = d
+		}
+	}
+
+	return rp, nil
+}
+
+// set adds or replaces the policy of a measurement, or of the whole database
+// for an empty measurement, and persists the policies
+func (rp *retentionPolicies) set(measurement string, d time.Duration) error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if measurement == "" {
+		rp.database = d
+	} else {
+		rp.measurements[measurement] = d
+	}
+	return rp.persist()
+}
+
+// remove deletes a policy, reporting false if there was none
+func (rp *retentionPolicies) remove(measurement string) (bool, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if measurement == "" {
+		if rp.database == 0 {
+			return false, nil
+		}
+		rp.database = 0
+	} else {
+		if _, ok := rp.measurements[measurement]; !ok {
+			return false, nil
+		}
+		delete(rp.measurements, measurement)
+	}
+	return true, rp.persist()
+}
+
+// list returns the policies, the database-wide one first and the others
+// sorted by measurement
+func (rp *retentionPolicies) list() []RetentionPolicy {
+	rp.mu.RLock()
+	defer rp.mu.RUnlock()
+	return rp.listLocked()
+}
+
+// listLocked returns the policies, the caller must hold the lock
+func (rp *retentionPolicies) listLocked() []RetentionPolicy {
+	policies := make([]RetentionPolicy, 0, len(rp.measurements)+1)
+	if rp.database > 0 {
+		policies = append(policies, RetentionPolicy{Duration: rp.database})
+	}
+
+	measurements := make([]string, 0, len(rp.measurements))
+	for m := range rp.measurements {
+		measurements = append(measurements, m)
+	}
+	sort.Strings(measurements)
+	for _, m := range measurements {
+		policies = append(policies, RetentionPolicy{Measurement: m, Duration: rp.measurements[m]})
+	}
+
+	return policies
+}
+
+// cutoff returns the time before which the points of a series have expired at
+// now, or the zero time if no policy applies to it
+func (rp *retentionPolicies) cutoff(seriesID string, now time.Time) time.Time {
+	rp.mu.RLock()
+	defer rp.mu.RUnlock()
+
+	d := rp.database
+	if key, err := ParseSeriesKey(seriesID); err == nil {
+		if md, ok := rp.measurements[key.Measurement]; ok {
+			d = md
+		}
+	}
+	if d == 0 {
+		return time.Time{}
+	}
+	return now.Add(-d)
+}
+
+// persist writes the policies to disk, the caller must hold the lock
+func (rp *retentionPolicies) persist() error {
+	var file retentionFile
+	for _, p := range rp.listLocked() {
+		file.Policies = append(file.Policies, retentionFilePolicy{Measurement: p.Measurement, Duration: p.Duration.String()})
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to marshal retention policies: %w", err)
+	}
+
+	// Write to a temporary file and rename it so a crash never leaves partial policies
+	tmpPath := rp.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write retention policies: %w", err)
+	}
+	if err := os.Rename(tmpPath, rp.path); err != nil {
+		return fmt.Errorf("failed to replace retention policies: %w", err)
+	}
+
+	return nil
+}
+
+// segmentExpired reports whether every point of a segment is past the
+// retention horizon of its series
+func segmentExpired(segment *Segment, retention RetentionFunc) bool {
+	if len(segment.SeriesIDs) == 0 {
+		return false
+	}
+	for _, seriesID := range segment.SeriesIDs {
+		cutoff := retention(seriesID)
+		if cutoff.IsZero() || !segment.MaxTime.Before(cutoff) {
+			return false
+		}
+	}
+	return true
+}
+
+// dropExpiredPoints removes the points past the retention horizon from every
+// series, returning the number of points removed
+func dropExpiredPoints(data map[string][]DataPoint, retention RetentionFunc) int {
+	points := 0
+	for seriesID, series := range data {
+		cutoff := retention(seriesID)
+		if cutoff.IsZero() {
+			continue
+		}
+
+		kept := series[:0]
+		for _, p := range series {
+			if !p.Timestamp.Before(cutoff) {
+				kept = append(kept, p)
+				continue
+			}
+			points++
+		}
+
+		if len(kept) == 0 {
+			delete(data, seriesID)
+		} else {
+			data[seriesID] = kept
+		}
+	}
+	return points
+}
+
+// SetRetentionPolicy keeps the points of a measurement, or of the whole
+// database for an empty measurement, for the given duration. A measurement
+// policy takes precedence over the database policy.
+func (db *Database) SetRetentionPolicy(measurement string, duration time.Duration) error {
+	if duration <= 0 {
+		return errors.NewValidationError(fmt.Sprintf("invalid retention duration %s: must be positive", duration))
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "retention policy change on closed database")
+	}
+
+	if err := db.retention.set(measurement, duration); err != nil {
+		return errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to save retention policy")
+	}
+	return nil
+}
+
+// DeleteRetentionPolicy removes the policy of a measurement, or of the whole
+// database for an empty measurement
+func (db *Database) DeleteRetentionPolicy(measurement string) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "retention policy change on closed database")
+	}
+
+	removed, err := db.retention.remove(measurement)
+	if err != nil {
+		return errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to save retention policies")
+	}
+	if !removed {
+		if measurement == "" {
+			return errors.NewNotFoundError(fmt.Sprintf("database %s has no retention policy", db.name))
+		}
+		return errors.NewNotFoundError(fmt.Sprintf("measurement %q has no retention policy", measurement))
+	}
+	return nil
+}
+
+// RetentionPolicies returns the retention policies of the database, the
+// database-wide one first and the others sorted by measurement
+func (db *Database) RetentionPolicies() []RetentionPolicy {
+	return db.retention.list()
+}
+
+// retentionCutoff returns the time before which the points of a series have expired
+func (db *Database) retentionCutoff(seriesID string) time.Time {
+	return db.retention.cutoff(seriesID, time.Now())
+}
+
+// enforceRetention deletes the expired segments of every shard of the database
+func (db *Database) enforceRetention() (RetentionResult, error) {
+	var result RetentionResult
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return result, nil
+	}
+
+	var lastError error
+	for shardID, shard := range db.shards {
+		shardResult, err := shard.EnforceRetention()
+		if err != nil {
+			logger.Warnf("Failed to enforce retention on shard %s of database %s: %v", shardID, db.name, err)
+			lastError = err
+		}
+		result.add(shardResult)
+	}
+
+	if db.metrics != nil && result.SegmentsDeleted > 0 {
+		db.metrics.RecordRetentionSegmentsDeleted(db.name, result.SegmentsDeleted)
+		db.metrics.RecordRetentionReclaimed("segment", result.PointsReclaimed, result.BytesReclaimed)
+	}
+
+	return result, lastError
+}
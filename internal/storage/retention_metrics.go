@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// Retention metrics
+	RetentionRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tsdb_retention_runs_total",
+			Help: "Total number of retention enforcement runs",
+		},
+		[]string{"status"},
+	)
+
+	RetentionLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "tsdb_retention_latency_seconds",
+			Help:    "Retention enforcement latency in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{},
+	)
+
+	RetentionSegmentsDeleted = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tsdb_retention_segments_deleted_total",
+			Help: "Total number of segments deleted because all their points expired",
+		},
+		[]string{"database"},
+	)
+
+	RetentionPointsReclaimed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tsdb_retention_points_reclaimed_total",
+			Help: "Total number of expired data points removed, by segment deletion or compaction",
+		},
+		[]string{"source"},
+	)
+
+	RetentionBytesReclaimed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tsdb_retention_bytes_reclaimed_total",
+			Help: "Total number of bytes of expired data removed, by segment deletion or compaction",
+		},
+		[]string{"source"},
+	)
+)
+
+func init() {
+	// Register all retention metrics
+	prometheus.MustRegister(RetentionRuns)
+	prometheus.MustRegister(RetentionLatency)
+	prometheus.MustRegister(RetentionSegmentsDeleted)
+	prometheus.MustRegister(RetentionPointsReclaimed)
+	prometheus.MustRegister(RetentionBytesReclaimed)
+}
+
+// RecordRetentionRun records the completion of a retention enforcement run
+func (m *StorageMetrics) RecordRetentionRun(startTime time.Time, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	RetentionRuns.WithLabelValues(status).Inc()
+
+	if err == nil {
+		RetentionLatency.WithLabelValues().Observe(time.Since(startTime).Seconds())
+	}
+}
+
+// RecordRetentionSegmentsDeleted records the expired segments deleted from a database
+func (m *StorageMetrics) RecordRetentionSegmentsDeleted(database string, count int) {
+	RetentionSegmentsDeleted.WithLabelValues(database).Add(float64(count))
+}
+
+// RecordRetentionReclaimed records the expired points and bytes removed, where
+// source is "segment" for deleted segments and "compaction" for points
+// filtered out while compacting
+func (m *StorageMetrics) RecordRetentionReclaimed(source string, points int, bytes int64) {
+	RetentionPointsReclaimed.WithLabelValues(source).Add(float64(points))
+	RetentionBytesReclaimed.WithLabelValues(source).Add(float64(bytes))
+}
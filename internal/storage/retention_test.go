@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/types"
+)
+
+func TestRetentionPolicies(t *testing.T) {
+	cfg := config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024}
+	s := NewStorage(cfg)
+
+	if err := s.SetRetentionPolicy("", 7*24*time.Hour); err != nil {
+		t.Fatalf("SetRetentionPolicy failed: %v", err)
+	}
+	if err := s.SetRetentionPolicy("cpu", time.Hour); err != nil {
+		t.Fatalf("SetRetentionPolicy failed: %v", err)
+	}
+	if err := s.SetRetentionPolicy("cpu", 0); !errors.IsType(err, errors.ErrorTypeValidation) {
+		t.Errorf("Expected a validation error for a zero duration, got %v", err)
+	}
+	if err := s.DeleteRetentionPolicy("mem"); !errors.IsType(err, errors.ErrorTypeNotFound) {
+		t.Errorf("Expected a not found error for a missing policy, got %v", err)
+	}
+
+	want := []RetentionPolicy{{Duration: 7 * 24 * time.Hour}, {Measurement: "cpu", Duration: time.Hour}}
+	if got := s.RetentionPolicies(); !reflect.DeepEqual(got, want) {
+		t.Errorf("RetentionPolicies = %v, want %v", got, want)
+	}
+
+	now := time.Now()
+	if got := s.retention.cutoff("cpu:value:host=a", now); !got.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Measurement policy cutoff = %v, want an hour ago", got)
+	}
+	if got := s.retention.cutoff("mem:free", now); !got.Equal(now.Add(-7 * 24 * time.Hour)) {
+		t.Errorf("Database policy cutoff = %v, want a week ago", got)
+	}
+
+	// Policies are persisted with the database
+	s.Close()
+	s = NewStorage(cfg)
+	defer s.Close()
+	if got := s.RetentionPolicies(); !reflect.DeepEqual(got, want) {
+		t.Errorf("RetentionPolicies after reopen = %v, want %v", got, want)
+	}
+
+	if err := s.DeleteRetentionPolicy(""); err != nil {
+		t.Fatalf("DeleteRetentionPolicy failed: %v", err)
+	}
+	if got := s.retention.cutoff("mem:free", now); !got.IsZero() {
+		t.Errorf("Expected no cutoff without a policy, got %v", got)
+	}
+}
+
+func TestEnforceRetention(t *testing.T) {
+	s := NewStorage(config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024})
+	defer s.Close()
+
+	if err := s.SetRetentionPolicy("cpu", time.Hour); err != nil {
+		t.Fatalf("SetRetentionPolicy failed: %v", err)
+	}
+
+	now := time.Now()
+	old := now.Add(-3 * time.Hour)
+	shard := s.shards["default"]
+	write := func(measurement string, ts time.Time) {
+		t.Helper()
+		err := s.WritePoint(context.Background(), types.Point{Measurement: measurement, Tags: map[string]string{"host": "a"}, Fields: map[string]interface{}{"value": 1.0}, Timestamp: ts})
+		if err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+	flush := func() {
+		t.Helper()
+		if err := shard.ForceFlush(); err != nil {
+			t.Fatalf("Failed to flush: %v", err)
+		}
+	}
+
+	// An expired cpu segment, a mem segment without a policy, a segment mixing
+	// expired and live cpu points, and live points still in the memstore
+	write("cpu", old)
+	write("cpu", old.Add(time.Minute))
+	flush()
+	write("mem", old)
+	flush()
+	write("cpu", old.Add(2*time.Minute))
+	write("cpu", now)
+	flush()
+	write("cpu", now.Add(time.Second))
+
+	result, err := s.EnforceRetention()
+	if err != nil {
+		t.Fatalf("EnforceRetention failed: %v", err)
+	}
+	if result.SegmentsDeleted != 1 || result.PointsReclaimed != 2 || result.BytesReclaimed <= 0 {
+		t.Errorf("Unexpected retention result %+v", result)
+	}
+
+	segments, err := shard.segmentReader.ListSegments()
+	if err != nil {
+		t.Fatalf("ListSegments failed: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Errorf("Expected 2 segments to remain, got %d", len(segments))
+	}
+
+	points, err := s.ReadPoints(context.Background(), "cpu", nil, "value", old.Add(-time.Hour), now.Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("ReadPoints failed: %v", err)
+	}
+	if len(points) != 3 {
+		t.Errorf("Expected the partially expired segment and memstore to keep 3 cpu points, got %d", len(points))
+	}
+	if points, _ := s.ReadPoints(context.Background(), "mem", nil, "value", old, old, 0); len(points) != 1 {
+		t.Errorf("Expected the mem point without a policy to be kept, got %+v", points)
+	}
+
+	// Nothing is left to delete on a second run
+	if result, err := s.EnforceRetention(); err != nil || result.SegmentsDeleted != 0 {
+		t.Errorf("Second EnforceRetention = %+v, %v", result, err)
+	}
+}
+
+func TestCompactionRetention(t *testing.T) {
+	tempDir := t.TempDir()
+	reader := createTestSegmentReader(tempDir)
+	writer, err := createTestSegmentWriter(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create segment writer: %v", err)
+	}
+
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	retention := func(seriesID string) time.Time {
+		if seriesID == "kept:value" {
+			return time.Time{}
+		}
+		return cutoff
+	}
+
+	manager := NewCompactionManager(CompactionConfig{
+		SegmentsDir:         tempDir,
+		MaxLevels:           3,
+		MaxSegmentsPerLevel: 5,
+		MaxSegmentSize:      1024 * 1024,
+		MaxConcurrent:       1,
+		Retention:           retention,
+	}, reader, writer, nil)
+
+	writeSegment := func(data map[string][]DataPoint) *Segment {
+		t.Helper()
+		segment, err := writer.WriteMemTable(&MemTable{Data: data, CreatedAt: time.Now()})
+		if err != nil {
+			t.Fatalf("Failed to write segment: %v", err)
+		}
+		if err := manager.AddSegment(segment); err != nil {
+			t.Fatalf("Failed to add segment: %v", err)
+		}
+		return segment
+	}
+	point := func(ts time.Time) DataPoint {
+		return DataPoint{Timestamp: ts, Value: 1.0, Type: types.FieldTypeFloat}
+	}
+
+	first := writeSegment(map[string][]DataPoint{
+		"cpu:value": {point(cutoff.Add(-time.Hour)), point(cutoff.Add(time.Hour))},
+		"old:value": {point(cutoff.Add(-time.Hour))},
+	})
+	second := writeSegment(map[string][]DataPoint{
+		"kept:value": {point(cutoff.Add(-48 * time.Hour))},
+	})
+
+	if err := manager.processCompactionTask(compactionTask{Level: 0, Segments: []*Segment{first, second}}); err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+
+	segments, err := reader.ListSegments()
+	if err != nil {
+		t.Fatalf("ListSegments failed: %v", err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("Expected one compacted segment, got %d", len(segments))
+	}
+	_, results, err := reader.ReadSegment(segments[0].Path)
+	if err != nil {
+		t.Fatalf("ReadSegment failed: %v", err)
+	}
+	got := make(map[string]int)
+	for _, r := range results {
+		got[r.SeriesID] = len(r.Points)
+	}
+	if want := map[string]int{"cpu:value": 1, "kept:value": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Compacted series = %v, want %v", got, want)
+	}
+
+	// A compaction in which every point expired leaves no segment behind
+	expired := writeSegment(map[string][]DataPoint{"old:value": {point(cutoff.Add(-time.Minute))}})
+	if err := manager.processCompactionTask(compactionTask{Level: 0, Segments: []*Segment{expired}}); err != nil {
+		t.Fatalf("Compaction failed: %v", err)
+	}
+	if segments, _ := reader.ListSegments(); len(segments) != 1 {
+		t.Errorf("Expected the expired segment to be removed, got %d segments", len(segments))
+	}
+}
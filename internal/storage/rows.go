@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"timeseriesdb/internal/errors"
+)
+
+// Row is one point of a measurement with the values of several fields merged.
+// Values holds one value per field of the enclosing RowSet, nil where the
+// point has no value for that field.
+type Row struct {
+	Timestamp time.Time
+	Tags      map[string]string
+	Values    []interface{}
+}
+
+// RowSet is the result of a multi-field read: the fields read, in the order
+// of each row's values, and the rows in time order
+type RowSet struct {
+	Measurement string
+	Fields      []string
+	Rows        []Row
+}
+
+// ReadRows reads several fields of every series of a measurement that carries
+// the given tags and merges the values written by the same point into one
+// row. Rows are keyed by timestamp and tag set, so two series written at the
+// same time stay separate. Empty fields reads every field of the measurement,
+// sorted by name. The limit applies to rows.
+func (db *Database) ReadRows(ctx context.Context, measurement string, tags map[string]string, fields []string, start, end time.Time, limit int) (*RowSet, error) {
+	startTime := time.Now()
+
+	if measurement == "" {
+		return nil, errors.NewValidationError("read requires a measurement")
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "read operation on closed database")
+	}
+
+	matchers := make([]*TagMatcher, 0, len(tags))
+	for k, v := range tags {
+		matchers = append(matchers, &TagMatcher{Type: MatchEqual, Key: k, Value: v})
+	}
+	keys := db.findSeries(measurement, matchers)
+
+	if len(fields) == 0 {
+		seen := make(map[string]bool)
+		for _, key := range keys {
+			if !seen[key.Field] {
+				seen[key.Field] = true
+				fields = append(fields, key.Field)
+			}
+		}
+		sort.Strings(fields)
+	}
+	columns := make(map[string]int, len(fields))
+	for i, field := range fields {
+		if _, ok := columns[field]; ok {
+			return nil, errors.NewValidationError(fmt.Sprintf("field %q is requested more than once", field))
+		}
+		columns[field] = i
+	}
+
+	type rowKey struct {
+		ts     int64
+		series string
+	}
+	rows := make(map[rowKey]*Row)
+	for _, key := range keys {
+		column, ok := columns[key.Field]
+		if !ok {
+			continue
+		}
+
+		points, err := db.readSeries(ctx, key, start, end, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		series := key.Series()
+		for _, p := range points {
+			rk := rowKey{ts: p.Timestamp.UnixNano(), series: series}
+			row, ok := rows[rk]
+			if !ok {
+				row = &Row{Timestamp: p.Timestamp, Tags: key.Tags, Values: make([]interface{}, len(fields))}
+				rows[rk] = row
+			}
+			row.Values[column] = p.Fields[key.Field]
+		}
+	}
+
+	sorted := make([]rowKey, 0, len(rows))
+	for rk := range rows {
+		sorted = append(sorted, rk)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ts != sorted[j].ts {
+			return sorted[i].ts < sorted[j].ts
+		}
+		return sorted[i].series < sorted[j].series
+	})
+	if limit > 0 && len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+
+	result := &RowSet{
+		Measurement: measurement,
+		Fields:      fields,
+		Rows:        make([]Row, 0, len(sorted)),
+	}
+	for _, rk := range sorted {
+		result.Rows = append(result.Rows, *rows[rk])
+	}
+	if result.Fields == nil {
+		result.Fields = []string{}
+	}
+
+	// Update metrics
+	if db.metrics != nil {
+		db.metrics.RecordStorageReadOperation("storage", "read_rows")
+		db.metrics.RecordDataPointsRead("storage", len(result.Rows))
+		db.metrics.RecordStorageReadLatency("storage", "read_rows", time.Since(startTime))
+	}
+
+	return result, nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/types"
+)
+
+func TestStorageReadRows(t *testing.T) {
+	s := NewStorage(config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024})
+	defer s.Close()
+
+	base := time.Unix(0, 1434055562000000000)
+	points := []types.Point{
+		{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: map[string]interface{}{"usage_user": 1.0, "usage_system": 2.0}, Timestamp: base},
+		{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: map[string]interface{}{"usage_user": 3.0}, Timestamp: base.Add(time.Second)},
+		{Measurement: "cpu", Tags: map[string]string{"host": "b"}, Fields: map[string]interface{}{"usage_system": 4.0, "state": "busy"}, Timestamp: base},
+	}
+	for _, p := range points {
+		if err := s.WritePoint(context.Background(), p); err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+
+	t.Run("selected fields", func(t *testing.T) {
+		rows, err := s.ReadRows(context.Background(), "cpu", nil, []string{"usage_user", "usage_system"}, base, base.Add(time.Minute), 0)
+		if err != nil {
+			t.Fatalf("ReadRows failed: %v", err)
+		}
+		want := []Row{
+			{Timestamp: base, Tags: map[string]string{"host": "a"}, Values: []interface{}{1.0, 2.0}},
+			{Timestamp: base, Tags: map[string]string{"host": "b"}, Values: []interface{}{nil, 4.0}},
+			{Timestamp: base.Add(time.Second), Tags: map[string]string{"host": "a"}, Values: []interface{}{3.0, nil}},
+		}
+		if !reflect.DeepEqual(rows.Rows, want) {
+			t.Errorf("Rows = %+v, want %+v", rows.Rows, want)
+		}
+	})
+
+	t.Run("all fields of a tag set", func(t *testing.T) {
+		rows, err := s.ReadRows(context.Background(), "cpu", map[string]string{"host": "b"}, nil, base, base.Add(time.Minute), 0)
+		if err != nil {
+			t.Fatalf("ReadRows failed: %v", err)
+		}
+		if want := []string{"state", "usage_system"}; !reflect.DeepEqual(rows.Fields, want) {
+			t.Errorf("Fields = %v, want %v", rows.Fields, want)
+		}
+		if len(rows.Rows) != 1 || !reflect.DeepEqual(rows.Rows[0].Values, []interface{}{"busy", 4.0}) {
+			t.Errorf("Unexpected rows %+v", rows.Rows)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		rows, err := s.ReadRows(context.Background(), "cpu", nil, []string{"usage_user"}, base, base.Add(time.Minute), 1)
+		if err != nil || len(rows.Rows) != 1 || rows.Rows[0].Values[0] != 1.0 {
+			t.Errorf("Expected the first row only, got %+v, %v", rows, err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := s.ReadRows(context.Background(), "", nil, nil, base, base, 0); !errors.IsType(err, errors.ErrorTypeValidation) {
+			t.Errorf("Expected a validation error without a measurement, got %v", err)
+		}
+		if _, err := s.ReadRows(context.Background(), "cpu", nil, []string{"a", "a"}, base, base, 0); !errors.IsType(err, errors.ErrorTypeValidation) {
+			t.Errorf("Expected a validation error for a repeated field, got %v", err)
+		}
+		rows, err := s.ReadRows(context.Background(), "missing", nil, nil, base, base, 0)
+		if err != nil || len(rows.Rows) != 0 || len(rows.Fields) != 0 {
+			t.Errorf("Expected no rows for a missing measurement, got %+v, %v", rows, err)
+		}
+	})
+}
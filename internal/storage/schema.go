@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/types"
+)
+
+// SeriesFilter selects the series examined by the schema exploration methods
+type SeriesFilter struct {
+	// Measurement restricts the series to one measurement, empty means all
+	Measurement string
+	// Matchers are tag predicates that every series must satisfy
+	Matchers []*TagMatcher
+	// Predicate, if set, is evaluated against the tags of every series left by
+	// the matchers, for conditions the index cannot resolve such as OR
+	Predicate func(tags map[string]string) bool
+	// Start and End restrict the series to those holding data in the range.
+	// A zero value leaves that side of the range unbounded.
+	Start time.Time
+	End   time.Time
+}
+
+// bounded reports whether the filter restricts the time range
+func (f SeriesFilter) bounded() bool {
+	return !f.Start.IsZero() || !f.End.IsZero()
+}
+
+// timeRange returns the filter's time range with unbounded sides opened up
+func (f SeriesFilter) timeRange() (time.Time, time.Time) {
+	start, end := f.Start, f.End
+	if start.IsZero() {
+		start = time.Unix(0, math.MinInt64)
+	}
+	if end.IsZero() {
+		end = time.Unix(0, math.MaxInt64)
+	}
+	return start, end
+}
+
+// TagKeyValue is one tag key and value pair of a measurement
+type TagKeyValue struct {
+	Key   string
+	Value string
+}
+
+// FieldKey is one field key of a measurement and the type of its values
+type FieldKey struct {
+	Name string
+	Type types.FieldType
+}
+
+// SeriesKeys returns the keys of every stored series that satisfies the filter,
+// one per measurement, field and tag set
+func (db *Database) SeriesKeys(filter SeriesFilter) ([]SeriesKey, error) {
+	startTime := time.Now()
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "schema query on closed database")
+	}
+
+	keys := db.seriesKeys(filter)
+
+	// Update metrics
+	if db.metrics != nil {
+		db.metrics.RecordStorageReadOperation("storage", "series_keys")
+		db.metrics.RecordStorageReadLatency("storage", "series_keys", time.Since(startTime))
+	}
+
+	return keys, nil
+}
+
+// Measurements returns the sorted names of the measurements with a series
+// satisfying the filter
+func (db *Database) Measurements(filter SeriesFilter) ([]string, error) {
+	keys, err := db.SeriesKeys(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		seen[key.Measurement] = true
+	}
+	return sortedSet(seen), nil
+}
+
+// TagKeys returns the sorted tag keys of each measurement, considering only
+// the series that satisfy the filter
+func (db *Database) TagKeys(filter SeriesFilter) (map[string][]string, error) {
+	keys, err := db.SeriesKeys(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := make(map[string]map[string]bool)
+	for _, key := range keys {
+		set := measurementSet(sets, key.Measurement)
+		for k := range key.Tags {
+			set[k] = true
+		}
+	}
+	return sortedSets(sets), nil
+}
+
+// TagValues returns the values of the given tag keys for each measurement,
+// sorted by key and then value, considering only the series that satisfy the filter
+func (db *Database) TagValues(filter SeriesFilter, tagKeys []string) (map[string][]TagKeyValue, error) {
+	keys, err := db.SeriesKeys(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := make(map[string]map[TagKeyValue]bool)
+	for _, key := range keys {
+		for _, tagKey := range tagKeys {
+			value, ok := key.Tags[tagKey]
+			if !ok {
+				continue
+			}
+			set, ok := sets[key.Measurement]
+			if !ok {
+				set = make(map[TagKeyValue]bool)
+				sets[key.Measurement] = set
+			}
+			set[TagKeyValue{Key: tagKey, Value: value}] = true
+		}
+	}
+
+	result := make(map[string][]TagKeyValue, len(sets))
+	for measurement, set := range sets {
+		pairs := make([]TagKeyValue, 0, len(set))
+		for pair := range set {
+			pairs = append(pairs, pair)
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			if pairs[i].Key != pairs[j].Key {
+				return pairs[i].Key < pairs[j].Key
+			}
+			return pairs[i].Value < pairs[j].Value
+		})
+		result[measurement] = pairs
+	}
+	return result, nil
+}
+
+// FieldKeys returns the sorted field keys of each measurement with their
+// types, considering only the series satisfying the filter
+func (db *Database) FieldKeys(filter SeriesFilter) (map[string][]FieldKey, error) {
+	keys, err := db.SeriesKeys(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	fields := make(map[string]map[string]types.FieldType)
+	for _, key := range keys {
+		if fields[key.Measurement] == nil {
+			fields[key.Measurement] = make(map[string]types.FieldType)
+		}
+		if _, ok := fields[key.Measurement][key.Field]; ok {
+			continue
+		}
+		t, _ := db.seriesType(key)
+		fields[key.Measurement][key.Field] = t
+	}
+
+	result := make(map[string][]FieldKey, len(fields))
+	for measurement, set := range fields {
+		for field, t := range set {
+			result[measurement] = append(result[measurement], FieldKey{Name: field, Type: t})
+		}
+		sort.Slice(result[measurement], func(i, j int) bool {
+			return result[measurement][i].Name < result[measurement][j].Name
+		})
+	}
+	return result, nil
+}
+
+// Series returns the sorted line protocol keys, such as cpu,host=a, of the
+// series satisfying the filter. Fields sharing a tag set share one key.
+func (db *Database) Series(filter SeriesFilter) ([]string, error) {
+	keys, err := db.SeriesKeys(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		seen[key.Series()] = true
+	}
+	return sortedSet(seen), nil
+}
+
+// seriesKeys resolves a filter through the tag index of every shard and, when
+// the filter has a time range, the data each shard holds in it. The caller
+// must hold the read lock.
+func (db *Database) seriesKeys(filter SeriesFilter) []SeriesKey {
+	var ids Postings
+	for _, shard := range db.shards {
+		shardIDs, err := shard.Select(filter.Measurement, filter.Matchers...)
+		if err != nil {
+			logger.Warnf("Failed to search series in shard %s: %v", shard.GetID(), err)
+			continue
+		}
+
+		if filter.bounded() && len(shardIDs) > 0 {
+			start, end := filter.timeRange()
+			if shardIDs, err = shard.SeriesInRange(shardIDs, start, end); err != nil {
+				logger.Warnf("Failed to filter series by time in shard %s: %v", shard.GetID(), err)
+				continue
+			}
+		}
+
+		ids = ids.Union(shardIDs)
+	}
+
+	keys := make([]SeriesKey, 0, len(ids))
+	for _, id := range ids {
+		key, err := ParseSeriesKey(id)
+		if err != nil {
+			continue
+		}
+		if filter.Predicate != nil && !filter.Predicate(key.Tags) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// measurementSet returns the set of names collected for a measurement, creating it if needed
+func measurementSet(sets map[string]map[string]bool, measurement string) map[string]bool {
+	set, ok := sets[measurement]
+	if !ok {
+		set = make(map[string]bool)
+		sets[measurement] = set
+	}
+	return set
+}
+
+// sortedSets converts per-measurement sets into sorted slices
+func sortedSets(sets map[string]map[string]bool) map[string][]string {
+	result := make(map[string][]string, len(sets))
+	for measurement, set := range sets {
+		result[measurement] = sortedSet(set)
+	}
+	return result
+}
+
+// sortedSet returns the members of a set in sorted order
+func sortedSet(set map[string]bool) []string {
+	result := make([]string, 0, len(set))
+	for member := range set {
+		result = append(result, member)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/types"
+)
+
+// newSchemaTestStorage writes cpu and mem points an hour apart, flushing the
+// older ones into a segment so both the memstore and segments are consulted
+func newSchemaTestStorage(t *testing.T) (*Storage, time.Time) {
+	t.Helper()
+
+	s := NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	t.Cleanup(func() { s.Close() })
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	write := func(p types.Point) {
+		t.Helper()
+		if err := s.WritePoint(context.Background(), p); err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+
+	write(types.Point{Measurement: "cpu", Tags: map[string]string{"host": "a", "region": "eu"}, Fields: map[string]interface{}{"usage": 1.0, "idle": 2.0}, Timestamp: base})
+	write(types.Point{Measurement: "mem", Tags: map[string]string{"host": "a"}, Fields: map[string]interface{}{"free": int64(3)}, Timestamp: base})
+	if err := s.shards["default"].memStore.ForceFlush(); err != nil {
+		t.Fatalf("Failed to flush memstore: %v", err)
+	}
+
+	write(types.Point{Measurement: "cpu", Tags: map[string]string{"host": "b", "region": "us"}, Fields: map[string]interface{}{"usage": 4.0}, Timestamp: base.Add(time.Hour)})
+
+	return s, base
+}
+
+func TestStorageSchemaExploration(t *testing.T) {
+	s, _ := newSchemaTestStorage(t)
+
+	measurements, err := s.Measurements(SeriesFilter{})
+	if err != nil {
+		t.Fatalf("Measurements failed: %v", err)
+	}
+	if want := []string{"cpu", "mem"}; !reflect.DeepEqual(measurements, want) {
+		t.Errorf("Measurements = %v, want %v", measurements, want)
+	}
+
+	tagKeys, err := s.TagKeys(SeriesFilter{})
+	if err != nil {
+		t.Fatalf("TagKeys failed: %v", err)
+	}
+	if want := map[string][]string{"cpu": {"host", "region"}, "mem": {"host"}}; !reflect.DeepEqual(tagKeys, want) {
+		t.Errorf("TagKeys = %v, want %v", tagKeys, want)
+	}
+
+	tagValues, err := s.TagValues(SeriesFilter{Measurement: "cpu"}, []string{"region", "host"})
+	if err != nil {
+		t.Fatalf("TagValues failed: %v", err)
+	}
+	wantValues := map[string][]TagKeyValue{"cpu": {
+		{Key: "host", Value: "a"}, {Key: "host", Value: "b"},
+		{Key: "region", Value: "eu"}, {Key: "region", Value: "us"},
+	}}
+	if !reflect.DeepEqual(tagValues, wantValues) {
+		t.Errorf("TagValues = %v, want %v", tagValues, wantValues)
+	}
+
+	fieldKeys, err := s.FieldKeys(SeriesFilter{})
+	if err != nil {
+		t.Fatalf("FieldKeys failed: %v", err)
+	}
+	wantFields := map[string][]FieldKey{
+		"cpu": {{Name: "idle", Type: types.FieldTypeFloat}, {Name: "usage", Type: types.FieldTypeFloat}},
+		"mem": {{Name: "free", Type: types.FieldTypeInteger}},
+	}
+	if want := wantFields; !reflect.DeepEqual(fieldKeys, want) {
+		t.Errorf("FieldKeys = %v, want %v", fieldKeys, want)
+	}
+
+	fields, err := s.Fields("cpu")
+	if err != nil {
+		t.Fatalf("Fields failed: %v", err)
+	}
+	if want := []string{"idle", "usage"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("Fields = %v, want %v", fields, want)
+	}
+
+	series, err := s.Series(SeriesFilter{})
+	if err != nil {
+		t.Fatalf("Series failed: %v", err)
+	}
+	if want := []string{"cpu,host=a,region=eu", "cpu,host=b,region=us", "mem,host=a"}; !reflect.DeepEqual(series, want) {
+		t.Errorf("Series = %v, want %v", series, want)
+	}
+}
+
+func TestStorageSchemaFilters(t *testing.T) {
+	s, base := newSchemaTestStorage(t)
+
+	tests := []struct {
+		name   string
+		filter SeriesFilter
+		want   []string
+	}{
+		{
+			name:   "tag predicate",
+			filter: SeriesFilter{Matchers: []*TagMatcher{mustMatcher(t, MatchEqual, "host", "a")}},
+			want:   []string{"cpu,host=a,region=eu", "mem,host=a"},
+		},
+		{
+			name:   "measurement and regex",
+			filter: SeriesFilter{Measurement: "cpu", Matchers: []*TagMatcher{mustMatcher(t, MatchRegex, "region", "^u")}},
+			want:   []string{"cpu,host=b,region=us"},
+		},
+		{
+			name: "predicate",
+			filter: SeriesFilter{Predicate: func(tags map[string]string) bool {
+				return tags["host"] == "b" || tags["region"] == ""
+			}},
+			want: []string{"cpu,host=b,region=us", "mem,host=a"},
+		},
+		{
+			name:   "start only sees the memstore",
+			filter: SeriesFilter{Start: base.Add(30 * time.Minute)},
+			want:   []string{"cpu,host=b,region=us"},
+		},
+		{
+			name:   "end only sees the segment",
+			filter: SeriesFilter{End: base.Add(30 * time.Minute)},
+			want:   []string{"cpu,host=a,region=eu", "mem,host=a"},
+		},
+		{
+			name:   "range without data",
+			filter: SeriesFilter{Start: base.Add(2 * time.Hour), End: base.Add(3 * time.Hour)},
+			want:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Series(tt.filter)
+			if err != nil {
+				t.Fatalf("Series failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Series = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStorageSchemaClosed(t *testing.T) {
+	s := NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	s.Close()
+
+	if _, err := s.Measurements(SeriesFilter{}); err == nil {
+		t.Error("Expected an error from closed storage")
+	}
+}
@@ -2,8 +2,10 @@ package storage
 
 import (
 	"bufio"
+	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -17,6 +19,7 @@ import (
 type SegmentReader struct {
 	mu          sync.Mutex
 	segmentsDir string
+	tombstones  *TombstoneSet
 }
 
 // SegmentReadResult contains the result of reading from a segment
@@ -33,6 +36,13 @@ func NewSegmentReader(segmentsDir string) *SegmentReader {
 	}
 }
 
+// SetTombstones makes range reads and aggregations hide the points deleted by
+// tombstones recorded after each segment was written. ReadSegment still
+// returns the points as stored.
+func (sr *SegmentReader) SetTombstones(tombstones *TombstoneSet) {
+	sr.tombstones = tombstones
+}
+
 // ReadSegment reads all data from a specific segment
 func (sr *SegmentReader) ReadSegment(segmentPath string) (*Segment, []SegmentReadResult, error) {
 	if segmentPath == "" {
@@ -59,13 +69,14 @@ func (sr *SegmentReader) ReadSegment(segmentPath string) (*Segment, []SegmentRea
 
 	// Create segment object
 	segment := &Segment{
-		ID:        header.ID,
-		Path:      segmentPath,
-		Size:      0, // Will be updated below
-		MinTime:   header.MinTime,
-		MaxTime:   header.MaxTime,
-		SeriesIDs: make([]string, 0),
-		CreatedAt: header.CreatedAt,
+		ID:           header.ID,
+		Path:         segmentPath,
+		Size:         0, // Will be updated below
+		MinTime:      header.MinTime,
+		MaxTime:      header.MaxTime,
+		SeriesIDs:    make([]string, 0),
+		CreatedAt:    header.CreatedAt,
+		TombstoneSeq: header.TombstoneSeq,
 	}
 
 	// Get file size
@@ -89,8 +100,13 @@ func (sr *SegmentReader) ReadSegment(segmentPath string) (*Segment, []SegmentRea
 	return segment, results, nil
 }
 
-// ReadSegmentRange reads data from a segment within a specific time range
-func (sr *SegmentReader) ReadSegmentRange(segmentPath string, start, end time.Time) ([]SegmentReadResult, error) {
+// ReadSegmentRange reads data from a segment within a specific time range.
+// The scan stops with the context's error once ctx is done.
+func (sr *SegmentReader) ReadSegmentRange(ctx context.Context, segmentPath string, start, end time.Time) ([]SegmentReadResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	file, err := os.Open(segmentPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open segment file: %w", err)
@@ -111,7 +127,89 @@ func (sr *SegmentReader) ReadSegmentRange(segmentPath string, start, end time.Ti
 	}
 
 	// Read series data with time filtering
-	return sr.readSeriesDataFiltered(reader, header, start, end)
+	return sr.readSeriesDataFiltered(ctx, reader, header, start, end)
+}
+
+// AggregateSegmentRange folds the points of the requested series within the
+// request range into per-window partial aggregates. Points are aggregated as
+// they are decoded and other series are skipped without being decoded. The
+// scan stops with the context's error once ctx is done.
+func (sr *SegmentReader) AggregateSegmentRange(ctx context.Context, segmentPath string, req *AggregateRequest) (windowAggregates, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(segmentPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment file: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	header, err := sr.readHeader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read segment header: %w", err)
+	}
+
+	windows := make(windowAggregates)
+
+	// Check if segment overlaps with time range
+	if header.MaxTime.Before(req.Start) || header.MinTime.After(req.End) {
+		return windows, nil
+	}
+
+	wanted := req.seriesSet()
+	for i := 0; i < header.SeriesCount && len(wanted) > 0; i++ {
+		seriesHeader, err := sr.readSeriesHeader(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		if !wanted[seriesHeader.SeriesID] {
+			if err := sr.skipPoints(reader, seriesHeader.PointCount); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		delete(wanted, seriesHeader.SeriesID)
+
+		tombstones := sr.tombstones.forSeries(seriesHeader.SeriesID, header.TombstoneSeq)
+		for j := 0; j < seriesHeader.PointCount; j++ {
+			if j%contextCheckInterval == contextCheckInterval-1 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+			point, err := sr.readPoint(reader)
+			if err != nil {
+				return nil, err
+			}
+			if req.contains(point.Timestamp) && !deletedBy(tombstones, point.Timestamp) {
+				windows.add(req, point)
+			}
+		}
+	}
+
+	return windows, nil
+}
+
+// skipPoints advances the reader past the given number of points without decoding them
+func (sr *SegmentReader) skipPoints(reader *bufio.Reader, count int) error {
+	pointLenBytes := make([]byte, 4)
+	for i := 0; i < count; i++ {
+		if _, err := io.ReadFull(reader, pointLenBytes); err != nil {
+			return fmt.Errorf("failed to read point length: %w", err)
+		}
+		pointLen := int(binary.LittleEndian.Uint32(pointLenBytes))
+		if _, err := reader.Discard(pointLen); err != nil {
+			return fmt.Errorf("failed to skip point data: %w", err)
+		}
+	}
+	return nil
 }
 
 // readHeader reads the segment header from the file
@@ -158,18 +256,27 @@ func (sr *SegmentReader) readSeriesData(reader *bufio.Reader, header *SegmentHea
 }
 
 // readSeriesDataFiltered reads series data with time filtering
-func (sr *SegmentReader) readSeriesDataFiltered(reader *bufio.Reader, header *SegmentHeader, start, end time.Time) ([]SegmentReadResult, error) {
+func (sr *SegmentReader) readSeriesDataFiltered(ctx context.Context, reader *bufio.Reader, header *SegmentHeader, start, end time.Time) ([]SegmentReadResult, error) {
 	var results []SegmentReadResult
 
 	for i := 0; i < header.SeriesCount; i++ {
-		result, err := sr.readSeriesFiltered(reader, start, end)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		result, err := sr.readSeriesFiltered(ctx, reader, start, end)
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
+			if isContextError(err) {
+				return nil, err
+			}
 			result.Error = err
 		}
 
+		result.Points = sr.tombstones.Filter(result.SeriesID, result.Points, header.TombstoneSeq)
+
 		// Only include results with points
 		if len(result.Points) > 0 {
 			results = append(results, result)
@@ -202,7 +309,7 @@ func (sr *SegmentReader) readSeries(reader *bufio.Reader) (SegmentReadResult, er
 }
 
 // readSeriesFiltered reads a single series with time filtering
-func (sr *SegmentReader) readSeriesFiltered(reader *bufio.Reader, start, end time.Time) (SegmentReadResult, error) {
+func (sr *SegmentReader) readSeriesFiltered(ctx context.Context, reader *bufio.Reader, start, end time.Time) (SegmentReadResult, error) {
 	result := SegmentReadResult{}
 
 	// Read series header
@@ -214,7 +321,7 @@ func (sr *SegmentReader) readSeriesFiltered(reader *bufio.Reader, start, end tim
 	result.SeriesID = seriesHeader.SeriesID
 
 	// Read points with filtering
-	points, err := sr.readPointsFiltered(reader, seriesHeader.PointCount, start, end)
+	points, err := sr.readPointsFiltered(ctx, reader, seriesHeader.PointCount, start, end)
 	if err != nil {
 		return result, err
 	}
@@ -271,10 +378,16 @@ func (sr *SegmentReader) readPoints(reader *bufio.Reader, count int) ([]DataPoin
 }
 
 // readPointsFiltered reads points with time filtering
-func (sr *SegmentReader) readPointsFiltered(reader *bufio.Reader, count int, start, end time.Time) ([]DataPoint, error) {
+func (sr *SegmentReader) readPointsFiltered(ctx context.Context, reader *bufio.Reader, count int, start, end time.Time) ([]DataPoint, error) {
 	var points []DataPoint
 
 	for i := 0; i < count; i++ {
+		if i%contextCheckInterval == contextCheckInterval-1 {
+			if err := ctx.Err(); err != nil {
+				return points, err
+			}
+		}
+
 		point, err := sr.readPoint(reader)
 		if err != nil {
 			return points, err
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -173,7 +174,7 @@ func TestReadSegmentRange(t *testing.T) {
 		start := now.Add(30 * time.Minute)
 		end := now.Add(90 * time.Minute)
 
-		results, err := reader.ReadSegmentRange(segment.Path, start, end)
+		results, err := reader.ReadSegmentRange(context.Background(), segment.Path, start, end)
 		if err != nil {
 			t.Fatalf("Failed to read segment range: %v", err)
 		}
@@ -229,7 +230,7 @@ func TestReadSegmentRange(t *testing.T) {
 		start := now.Add(24 * time.Hour) // 24 hours later
 		end := start.Add(time.Hour)
 
-		results, err := reader.ReadSegmentRange(segment.Path, start, end)
+		results, err := reader.ReadSegmentRange(context.Background(), segment.Path, start, end)
 		if err != nil {
 			t.Fatalf("Failed to read segment range: %v", err)
 		}
@@ -275,7 +276,7 @@ func TestReadSegmentRange(t *testing.T) {
 
 		// Read with exact start and end times
 		reader := NewSegmentReader(tempDir)
-		results, err := reader.ReadSegmentRange(segment.Path, now, now.Add(time.Second))
+		results, err := reader.ReadSegmentRange(context.Background(), segment.Path, now, now.Add(time.Second))
 		if err != nil {
 			t.Fatalf("Failed to read segment range: %v", err)
 		}
@@ -460,3 +461,59 @@ func TestSegmentReaderErrorHandling(t *testing.T) {
 		}
 	})
 }
+
+func TestAggregateSegmentRange(t *testing.T) {
+	tempDir := t.TempDir()
+
+	writer, err := NewSegmentWriter(SegmentWriterConfig{
+		SegmentsDir: tempDir,
+		Compression: false,
+		BufferSize:  64 * 1024,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create segment writer: %v", err)
+	}
+
+	base := time.Unix(1700000000, 0).UTC()
+	memTable := &MemTable{
+		ID: 3,
+		Data: map[string][]DataPoint{
+			"series1": aggregatePoints(base, 1, 2, 3, 4),
+			"series2": aggregatePoints(base, 10, 20, 30, 40),
+			"series3": aggregatePoints(base, 100, 200, 300, 400),
+		},
+		Size:      512,
+		MaxSize:   1024,
+		CreatedAt: base,
+	}
+
+	segment, err := writer.WriteMemTable(memTable)
+	if err != nil {
+		t.Fatalf("Failed to write memtable: %v", err)
+	}
+
+	reader := NewSegmentReader(tempDir)
+	req := &AggregateRequest{
+		SeriesIDs:        []string{"series1", "series3"},
+		Start:            base.Add(time.Second),
+		End:              base.Add(3 * time.Second),
+		AggregateOptions: AggregateOptions{Function: AggregateSum, Window: 2 * time.Second},
+	}
+
+	windows, err := reader.AggregateSegmentRange(context.Background(), segment.Path, req)
+	if err != nil {
+		t.Fatalf("Failed to aggregate segment range: %v", err)
+	}
+
+	// series2 is skipped and the first point of each series is out of range
+	results := windows.results(req.AggregateOptions)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 windows, got %+v", results)
+	}
+	if results[0].Value != 202 || results[0].Count != 2 {
+		t.Errorf("Expected first window sum 202 over 2 points, got %+v", results[0])
+	}
+	if results[1].Value != 707 || results[1].Count != 4 {
+		t.Errorf("Expected second window sum 707 over 4 points, got %+v", results[1])
+	}
+}
@@ -29,6 +29,8 @@ type SegmentHeader struct {
 	MaxTime     time.Time              `json:"max_time"`
 	Checksum    uint32                 `json:"checksum"`
 	Metadata    map[string]interface{} `json:"metadata"`
+	// TombstoneSeq is the last tombstone already applied to the segment's points
+	TombstoneSeq uint64 `json:"tombstone_seq,omitempty"`
 }
 
 // SegmentWriterConfig holds configuration for segment writing
@@ -108,13 +110,14 @@ func (sw *SegmentWriter) WriteMemTable(memTable *MemTable) (*Segment, error) {
 
 	// Create segment object
 	segment := &Segment{
-		ID:        segmentID,
-		Path:      segmentPath,
-		Size:      stat.Size(),
-		MinTime:   header.MinTime,
-		MaxTime:   header.MaxTime,
-		SeriesIDs: sw.getSeriesIDs(memTable),
-		CreatedAt: header.CreatedAt,
+		ID:           segmentID,
+		Path:         segmentPath,
+		Size:         stat.Size(),
+		MinTime:      header.MinTime,
+		MaxTime:      header.MaxTime,
+		SeriesIDs:    sw.getSeriesIDs(memTable),
+		CreatedAt:    header.CreatedAt,
+		TombstoneSeq: header.TombstoneSeq,
 	}
 
 	return segment, nil
@@ -123,13 +126,14 @@ func (sw *SegmentWriter) WriteMemTable(memTable *MemTable) (*Segment, error) {
 // calculateHeader calculates the segment header from memtable data
 func (sw *SegmentWriter) calculateHeader(memTable *MemTable, segmentID uint64) (*SegmentHeader, error) {
 	header := &SegmentHeader{
-		ID:          segmentID,
-		CreatedAt:   time.Now(),
-		SeriesCount: len(memTable.Data),
-		PointCount:  0,
-		MinTime:     time.Time{},
-		MaxTime:     time.Time{},
-		Metadata:    make(map[string]interface{}),
+		ID:           segmentID,
+		CreatedAt:    time.Now(),
+		SeriesCount:  len(memTable.Data),
+		PointCount:   0,
+		MinTime:      time.Time{},
+		MaxTime:      time.Time{},
+		Metadata:     make(map[string]interface{}),
+		TombstoneSeq: memTable.TombstoneSeq,
 	}
 
 	// Calculate point count and time range
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SeriesKey identifies a single stored series: one field of a measurement with a fixed tag set
+type SeriesKey struct {
+	Measurement string
+	Field       string
+	Tags        map[string]string
+}
+
+// seriesKeyEscaper escapes the separator characters used in series IDs
+var seriesKeyEscaper = strings.NewReplacer(`\`, `\\`, `:`, `\:`, `=`, `\=`)
+
+// String encodes the key as a series ID of the form measurement:field:k1=v1:k2=v2
+// with tag keys sorted. Separator characters inside names are escaped with a backslash.
+func (k SeriesKey) String() string {
+	var buf strings.Builder
+	buf.WriteString(seriesKeyEscaper.Replace(k.Measurement))
+	buf.WriteByte(':')
+	buf.WriteString(seriesKeyEscaper.Replace(k.Field))
+
+	if len(k.Tags) > 0 {
+		// Sort tags for consistent ordering
+		tagKeys := make([]string, 0, len(k.Tags))
+		for key := range k.Tags {
+			tagKeys = append(tagKeys, key)
+		}
+		sort.Strings(tagKeys)
+
+		for _, key := range tagKeys {
+			buf.WriteByte(':')
+			buf.WriteString(seriesKeyEscaper.Replace(key))
+			buf.WriteByte('=')
+			buf.WriteString(seriesKeyEscaper.Replace(k.Tags[key]))
+		}
+	}
+
+	return buf.String()
+}
+
+// Escapers for the measurement and tag components of a line protocol series key
+var (
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+	tagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+)
+
+// Series returns the line protocol series key of k, such as cpu,host=a,region=eu.
+// It identifies the tag set without the field, so every field of a point shares it.
+func (k SeriesKey) Series() string {
+	var buf strings.Builder
+	buf.WriteString(measurementEscaper.Replace(k.Measurement))
+
+	tagKeys := make([]string, 0, len(k.Tags))
+	for key := range k.Tags {
+		tagKeys = append(tagKeys, key)
+	}
+	sort.Strings(tagKeys)
+
+	for _, key := range tagKeys {
+		buf.WriteByte(',')
+		buf.WriteString(tagEscaper.Replace(key))
+		buf.WriteByte('=')
+		buf.WriteString(tagEscaper.Replace(k.Tags[key]))
+	}
+
+	return buf.String()
+}
+
+// ParseSeriesKey decodes a series ID produced by SeriesKey.String
+func ParseSeriesKey(seriesID string) (SeriesKey, error) {
+	parts := splitUnescaped(seriesID, ':')
+	if len(parts) < 2 {
+		return SeriesKey{}, fmt.Errorf("invalid series ID %q: missing field", seriesID)
+	}
+
+	key := SeriesKey{
+		Measurement: unescapeSeriesKeyPart(parts[0]),
+		Field:       unescapeSeriesKeyPart(parts[1]),
+		Tags:        make(map[string]string, len(parts)-2),
+	}
+
+	for _, part := range parts[2:] {
+		kv := splitUnescaped(part, '=')
+		if len(kv) != 2 {
+			return SeriesKey{}, fmt.Errorf("invalid series ID %q: malformed tag %q", seriesID, part)
+		}
+		key.Tags[unescapeSeriesKeyPart(kv[0])] = unescapeSeriesKeyPart(kv[1])
+	}
+
+	return key, nil
+}
+
+// splitUnescaped splits s on sep, ignoring separators preceded by a backslash
+func splitUnescaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++ // skip the escaped character
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unescapeSeriesKeyPart removes backslash escapes from a series ID component
+func unescapeSeriesKeyPart(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSeriesKeyRoundTrip(t *testing.T) {
+	keys := []SeriesKey{
+		{Measurement: "cpu", Field: "value", Tags: map[string]string{}},
+		{Measurement: "cpu", Field: "usage", Tags: map[string]string{"region": "us-west", "host": "server01"}},
+		{Measurement: "disk:io", Field: "a=b", Tags: map[string]string{"path": `C:\data`, "k=v": "x:y"}},
+	}
+
+	for _, key := range keys {
+		id := key.String()
+		parsed, err := ParseSeriesKey(id)
+		if err != nil {
+			t.Fatalf("ParseSeriesKey(%q) failed: %v", id, err)
+		}
+		if !reflect.DeepEqual(parsed, key) {
+			t.Errorf("ParseSeriesKey(%q) = %+v, want %+v", id, parsed, key)
+		}
+	}
+}
+
+func TestSeriesKeyStringSortsTags(t *testing.T) {
+	key := SeriesKey{Measurement: "cpu", Field: "value", Tags: map[string]string{"region": "us-west", "host": "server01"}}
+
+	want := "cpu:value:host=server01:region=us-west"
+	if got := key.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestParseSeriesKeyErrors(t *testing.T) {
+	for _, id := range []string{"cpu", "cpu:value:host", "cpu:value:a=b=c"} {
+		if _, err := ParseSeriesKey(id); err == nil {
+			t.Errorf("ParseSeriesKey(%q) succeeded, want error", id)
+		}
+	}
+}
+
+func TestSeriesKeySeries(t *testing.T) {
+	tests := []struct {
+		key  SeriesKey
+		want string
+	}{
+		{SeriesKey{Measurement: "cpu", Field: "usage"}, "cpu"},
+		{SeriesKey{Measurement: "cpu", Field: "usage", Tags: map[string]string{"region": "eu", "host": "a"}}, "cpu,host=a,region=eu"},
+		{SeriesKey{Measurement: "disk io", Field: "x", Tags: map[string]string{"path": "a,b=c d"}}, `disk\ io,path=a\,b\=c\ d`},
+	}
+
+	for _, tt := range tests {
+		if got := tt.key.Series(); got != tt.want {
+			t.Errorf("Series() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -1,13 +1,16 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
 	"sync"
 	"time"
 	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/types"
 )
 
 // Shard represents a storage shard with LSM tree architecture
@@ -25,6 +28,9 @@ type Shard struct {
 	segmentWriter *SegmentWriter
 	segmentReader *SegmentReader
 	compactionMgr *CompactionManager
+	index         *TagIndex
+	tombstones    *TombstoneSet
+	lastCache     *LastCache
 
 	// Configuration
 	config ShardConfig
@@ -47,6 +53,8 @@ type ShardConfig struct {
 	MaxSegmentsPerLevel int
 	MaxSegmentSize      int64
 	CompactionInterval  time.Duration
+	// Retention, if set, decides when the points of each series expire
+	Retention RetentionFunc
 }
 
 // NewShard creates a new storage shard
@@ -86,8 +94,12 @@ func NewShard(config ShardConfig, metrics *StorageMetrics) (*Shard, error) {
 		return nil, fmt.Errorf("failed to create segment writer: %w", err)
 	}
 
+	// Create the tombstone log, applied by segment reads and compaction
+	tombstones := NewTombstoneSet(filepath.Join(segmentsDir, TombstoneFileName))
+
 	// Create segment reader
 	segmentReader := NewSegmentReader(segmentsDir)
+	segmentReader.SetTombstones(tombstones)
 
 	// Create compaction manager
 	compactionMgr := NewCompactionManager(CompactionConfig{
@@ -97,11 +109,19 @@ func NewShard(config ShardConfig, metrics *StorageMetrics) (*Shard, error) {
 		MaxSegmentSize:      config.MaxSegmentSize,
 		CompactionInterval:  config.CompactionInterval,
 		MaxConcurrent:       1,
+		Retention:           config.Retention,
+		Tombstones:          tombstones,
 	}, segmentReader, segmentWriter, metrics)
 
+	// Create tag index, persisted alongside the segments
+	index := NewTagIndex(filepath.Join(segmentsDir, IndexFileName))
+
 	// Create memstore with flush callback
 	memStore := NewMemStore(config.MaxMemTableSize, wal, func(memTable *MemTable) error {
-		// Flush callback: write memtable to segment and add to compaction manager
+		// Flush callback: write memtable to segment and add to compaction manager.
+		// Deletes remove their points from the memtable, so it has every
+		// tombstone recorded so far applied.
+		memTable.TombstoneSeq = tombstones.Seq()
 		segment, err := segmentWriter.WriteMemTable(memTable)
 		if err != nil {
 			return fmt.Errorf("failed to write memtable to segment: %w", err)
@@ -112,9 +132,18 @@ func NewShard(config ShardConfig, metrics *StorageMetrics) (*Shard, error) {
 			return fmt.Errorf("failed to add segment to compaction manager: %w", err)
 		}
 
+		// Persist the index so it covers every series now held in segments
+		if err := index.Persist(); err != nil {
+			return fmt.Errorf("failed to persist tag index: %w", err)
+		}
+
 		return nil
 	}, metrics, config.ID)
 
+	// Create the last-value cache, kept up to date by the memstore
+	lastCache := NewLastCache()
+	memStore.SetLastCache(lastCache)
+
 	shard := &Shard{
 		id:            config.ID,
 		dataDir:       config.DataDir,
@@ -126,11 +155,15 @@ func NewShard(config ShardConfig, metrics *StorageMetrics) (*Shard, error) {
 		segmentWriter: segmentWriter,
 		segmentReader: segmentReader,
 		compactionMgr: compactionMgr,
+		index:         index,
+		tombstones:    tombstones,
+		lastCache:     lastCache,
 		config:        config,
 		closed:        false,
 		recovering:    false,
 		metrics:       metrics,
 	}
+	compactionMgr.SetSeriesDropped(shard.dropEmptySeries)
 
 	return shard, nil
 }
@@ -149,6 +182,22 @@ func (s *Shard) Open() error {
 		return fmt.Errorf("failed to start compaction manager: %w", err)
 	}
 
+	// Load the tombstones before anything reads the segments they apply to
+	if err := s.tombstones.Load(); err != nil {
+		return fmt.Errorf("failed to load tombstones: %w", err)
+	}
+
+	// Load the tag index before the WAL adds the series written since it was persisted
+	if err := s.loadIndex(); err != nil {
+		return fmt.Errorf("failed to load tag index: %w", err)
+	}
+
+	// Warm the last-value cache from the segments, the WAL recovery then
+	// updates it with the newer points it replays
+	if err := s.warmLastCache(); err != nil {
+		return fmt.Errorf("failed to warm last-value cache: %w", err)
+	}
+
 	// Perform WAL recovery
 	if err := s.performRecovery(); err != nil {
 		return fmt.Errorf("failed to perform recovery: %w", err)
@@ -178,6 +227,11 @@ func (s *Shard) Close() error {
 		return fmt.Errorf("failed to flush memstore: %w", err)
 	}
 
+	// Persist tag index
+	if err := s.index.Persist(); err != nil {
+		return fmt.Errorf("failed to persist tag index: %w", err)
+	}
+
 	// Close WAL
 	if err := s.wal.Close(); err != nil {
 		return fmt.Errorf("failed to close WAL: %w", err)
@@ -188,17 +242,29 @@ func (s *Shard) Close() error {
 
 // Write writes data points to the shard
 func (s *Shard) Write(req WriteRequest) error {
+	added, err := s.write(req)
+	if err != nil && added {
+		// The series indexed by the failed write is dropped again, unless a
+		// concurrent write stored points of it
+		s.dropEmptySeries([]string{req.SeriesID})
+	}
+	return err
+}
+
+// write indexes the series of a write and stores its points, reporting
+// whether the series was not indexed before
+func (s *Shard) write(req WriteRequest) (bool, error) {
 	startTime := time.Now()
 
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	if s.closed {
-		return fmt.Errorf("shard is closed")
+		return false, fmt.Errorf("shard is closed")
 	}
 
 	if s.recovering {
-		return fmt.Errorf("shard is recovering")
+		return false, fmt.Errorf("shard is recovering")
 	}
 
 	// Record write operation
@@ -207,7 +273,16 @@ func (s *Shard) Write(req WriteRequest) error {
 		s.metrics.RecordDataPointsWritten(s.id, len(req.Points))
 	}
 
-	err := s.memStore.Write(req.SeriesID, req.Points)
+	// Index the series first so a flush triggered by this write persists it,
+	// rejecting points whose type differs from the one recorded for the field
+	added := false
+	fieldType, err := pointsType(req.Points)
+	if err == nil {
+		added, err = s.index.Add(req.SeriesID, fieldType)
+	}
+	if err == nil {
+		err = s.memStore.Write(req.SeriesID, req.Points)
+	}
 
 	// Record write completion
 	if s.metrics != nil {
@@ -217,11 +292,12 @@ func (s *Shard) Write(req WriteRequest) error {
 		}
 	}
 
-	return err
+	return added, err
 }
 
-// Read reads data points from the shard
-func (s *Shard) Read(req ReadRequest) ([]DataPoint, error) {
+// Read reads data points from the shard, stopping with the context's error
+// once ctx is done
+func (s *Shard) Read(ctx context.Context, req ReadRequest) ([]DataPoint, error) {
 	startTime := time.Now()
 
 	s.mu.RLock()
@@ -230,6 +306,9 @@ func (s *Shard) Read(req ReadRequest) ([]DataPoint, error) {
 	if s.closed {
 		return nil, fmt.Errorf("shard is closed")
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	// Record read operation
 	if s.metrics != nil {
@@ -258,6 +337,10 @@ func (s *Shard) Read(req ReadRequest) ([]DataPoint, error) {
 	}
 
 	for _, segment := range segments {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		// Check if segment contains the series
 		containsSeries := false
 		for _, seriesID := range segment.SeriesIDs {
@@ -277,8 +360,11 @@ func (s *Shard) Read(req ReadRequest) ([]DataPoint, error) {
 		}
 
 		// Read from segment
-		results, err := s.segmentReader.ReadSegmentRange(segment.Path, req.Start, req.End)
+		results, err := s.segmentReader.ReadSegmentRange(ctx, segment.Path, req.Start, req.End)
 		if err != nil {
+			if isContextError(err) {
+				return nil, err
+			}
 			continue // Skip corrupted segments
 		}
 
@@ -310,6 +396,484 @@ func (s *Shard) Read(req ReadRequest) ([]DataPoint, error) {
 	return allPoints, nil
 }
 
+// aggregate computes the per-window partial aggregates of the requested series
+// over the memstore and every overlapping segment of the shard, stopping with
+// the context's error once ctx is done
+func (s *Shard) aggregate(ctx context.Context, req *AggregateRequest) (windowAggregates, error) {
+	startTime := time.Now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("shard is closed")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if s.metrics != nil {
+		s.metrics.RecordStorageReadOperation(s.id, "shard_aggregate")
+	}
+
+	windows := s.memStore.Aggregate(req)
+
+	segments, err := s.segmentReader.ListSegments()
+	if err != nil {
+		if s.metrics != nil {
+			s.metrics.RecordStorageReadError(s.id, "shard_aggregate")
+		}
+		return nil, fmt.Errorf("failed to list segments: %w", err)
+	}
+
+	wanted := req.seriesSet()
+	for _, segment := range segments {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// Check if segment overlaps with time range
+		if segment.MaxTime.Before(req.Start) || segment.MinTime.After(req.End) {
+			continue
+		}
+
+		// Check if segment contains any of the series
+		containsSeries := false
+		for _, seriesID := range segment.SeriesIDs {
+			if wanted[seriesID] {
+				containsSeries = true
+				break
+			}
+		}
+		if !containsSeries {
+			continue
+		}
+
+		segmentWindows, err := s.segmentReader.AggregateSegmentRange(ctx, segment.Path, req)
+		if err != nil {
+			if isContextError(err) {
+				return nil, err
+			}
+			continue // Skip corrupted segments
+		}
+		windows.merge(segmentWindows)
+	}
+
+	if s.metrics != nil {
+		s.metrics.RecordStorageReadLatency(s.id, "shard_aggregate", time.Since(startTime))
+	}
+
+	return windows, nil
+}
+
+// Aggregate computes windowed aggregates of the requested series within the shard
+func (s *Shard) Aggregate(ctx context.Context, req AggregateRequest) ([]WindowAggregate, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	windows, err := s.aggregate(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+	return windows.results(req.AggregateOptions), nil
+}
+
+// Last returns the newest point of a series, served from the last-value cache.
+// A series missing from the cache is read from the memstore and segments and
+// cached for the next lookup. A series whose newest point has passed its
+// retention period has no last point.
+func (s *Shard) Last(ctx context.Context, seriesID string) (DataPoint, bool, error) {
+	s.mu.RLock()
+	closed := s.closed
+	s.mu.RUnlock()
+	if closed {
+		return DataPoint{}, false, fmt.Errorf("shard is closed")
+	}
+	if err := ctx.Err(); err != nil {
+		return DataPoint{}, false, err
+	}
+
+	point, ok := s.lastCache.Get(seriesID)
+	if s.metrics != nil {
+		s.metrics.RecordStorageReadOperation(s.id, "shard_last")
+	}
+	if !ok {
+		generation := s.lastCache.Generation()
+		points, err := s.Read(ctx, ReadRequest{
+			SeriesID: seriesID,
+			Start:    time.Unix(0, math.MinInt64),
+			End:      time.Unix(0, math.MaxInt64),
+		})
+		if err != nil {
+			return DataPoint{}, false, err
+		}
+		if len(points) == 0 {
+			return DataPoint{}, false, nil
+		}
+		point = points[len(points)-1]
+		s.lastCache.Fill(seriesID, point, generation)
+	}
+
+	if s.config.Retention != nil {
+		if cutoff := s.config.Retention(seriesID); !cutoff.IsZero() && point.Timestamp.Before(cutoff) {
+			return DataPoint{}, false, nil
+		}
+	}
+	return point, true, nil
+}
+
+// warmLastCache caches the newest point of every series stored in segments.
+// Segments are read newest first, skipping those that cannot hold a newer
+// point for any of their series than the ones already cached.
+func (s *Shard) warmLastCache() error {
+	segments, err := s.segmentReader.ListSegments()
+	if err != nil {
+		return fmt.Errorf("failed to list segments: %w", err)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].MaxTime.After(segments[j].MaxTime)
+	})
+
+	for _, segment := range segments {
+		stale := false
+		for _, seriesID := range segment.SeriesIDs {
+			if cached, ok := s.lastCache.Get(seriesID); !ok || !cached.Timestamp.After(segment.MaxTime) {
+				stale = true
+				break
+			}
+		}
+		if !stale {
+			continue
+		}
+
+		results, err := s.segmentReader.ReadSegmentRange(context.Background(), segment.Path, segment.MinTime, segment.MaxTime)
+		if err != nil {
+			logger.Warnf("Skipping unreadable segment %s while warming the last-value cache: %v", segment.Path, err)
+			continue
+		}
+		for _, result := range results {
+			if result.Error == nil {
+				s.lastCache.Update(result.SeriesID, result.Points)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Delete deletes the points of the given series with timestamps between min
+// and max inclusive. The deletion is recorded as a durable tombstone that
+// hides the points from segment reads until compaction removes them, while
+// the points held in the memstore are removed at once.
+func (s *Shard) Delete(seriesIDs []string, min, max time.Time) error {
+	// Writes are blocked so that no flush records the new tombstone as applied
+	// before its points are removed from the memstore
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return fmt.Errorf("shard is closed")
+	}
+	if len(seriesIDs) == 0 {
+		return nil
+	}
+
+	if _, err := s.tombstones.Add(seriesIDs, min, max); err != nil {
+		return fmt.Errorf("failed to record tombstones: %w", err)
+	}
+
+	removed := 0
+	for _, seriesID := range seriesIDs {
+		removed += s.memStore.Delete(seriesID, min, max)
+		s.lastCache.Invalidate(seriesID, min, max)
+	}
+
+	// The WAL still holds the removed points, so flush the memstore to keep
+	// recovery from bringing them back
+	if removed > 0 {
+		if err := s.memStore.ForceFlush(); err != nil {
+			return fmt.Errorf("failed to flush memstore: %w", err)
+		}
+
+		// Series whose points were all in the memstore are gone, while those
+		// with points in segments are dropped once compaction empties them
+		if err := s.removeEmptySeries(seriesIDs); err != nil {
+			return fmt.Errorf("failed to remove empty series: %w", err)
+		}
+	}
+
+	if s.metrics != nil {
+		s.metrics.RecordStorageWriteOperation(s.id, "shard_delete")
+	}
+
+	return nil
+}
+
+// EnforceRetention deletes the segments whose points have all expired.
+// Segments holding some unexpired points are kept, and their expired points
+// are dropped when they are compacted.
+func (s *Shard) EnforceRetention() (RetentionResult, error) {
+	if s.config.Retention == nil {
+		return RetentionResult{}, nil
+	}
+
+	result, dropped, err := s.deleteExpiredSegments()
+	if len(dropped) > 0 {
+		s.dropEmptySeries(dropped)
+	}
+	return result, err
+}
+
+// deleteExpiredSegments deletes the segments whose points have all expired,
+// returning the series they held
+func (s *Shard) deleteExpiredSegments() (RetentionResult, []string, error) {
+	var result RetentionResult
+	var dropped []string
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return result, nil, fmt.Errorf("shard is closed")
+	}
+
+	segments, err := s.segmentReader.ListSegments()
+	if err != nil {
+		return result, nil, fmt.Errorf("failed to list segments: %w", err)
+	}
+
+	for _, segment := range segments {
+		if !segmentExpired(segment, s.config.Retention) {
+			continue
+		}
+
+		_, results, err := s.segmentReader.ReadSegment(segment.Path)
+		if err != nil {
+			logger.Warnf("Skipping unreadable expired segment %s: %v", segment.Path, err)
+			continue
+		}
+		if err := os.Remove(segment.Path); err != nil {
+			return result, dropped, fmt.Errorf("failed to remove expired segment %s: %w", segment.Path, err)
+		}
+		s.compactionMgr.RemoveSegment(segment.ID)
+		for _, seriesID := range segment.SeriesIDs {
+			s.lastCache.Invalidate(seriesID, segment.MinTime, segment.MaxTime)
+		}
+		dropped = append(dropped, segment.SeriesIDs...)
+
+		result.SegmentsDeleted++
+		result.BytesReclaimed += segment.Size
+		for _, r := range results {
+			result.PointsReclaimed += len(r.Points)
+		}
+	}
+
+	return result, dropped, nil
+}
+
+// dropEmptySeries removes from the tag index those of the given series that
+// no longer have points in the memstore or in any segment
+func (s *Shard) dropEmptySeries(seriesIDs []string) {
+	// Writes are blocked so that none indexes one of the series again
+	// between the check and its removal
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	if err := s.removeEmptySeries(seriesIDs); err != nil {
+		logger.Warnf("Failed to remove empty series from the tag index of shard %s: %v", s.id, err)
+	}
+}
+
+// removeEmptySeries removes from the tag index those of the given series that
+// no longer have points in the memstore or in any segment, the caller holding
+// the write lock
+func (s *Shard) removeEmptySeries(seriesIDs []string) error {
+	live := make(map[string]bool)
+	for _, seriesID := range s.memStore.SeriesIDs() {
+		live[seriesID] = true
+	}
+
+	segments, err := s.segmentReader.ListSegments()
+	if err != nil {
+		return fmt.Errorf("failed to list segments: %w", err)
+	}
+	for _, segment := range segments {
+		for _, seriesID := range segment.SeriesIDs {
+			live[seriesID] = true
+		}
+	}
+
+	var empty []string
+	for _, seriesID := range seriesIDs {
+		if !live[seriesID] {
+			empty = append(empty, seriesID)
+		}
+	}
+	if s.index.Remove(empty...) == 0 {
+		return nil
+	}
+	return s.index.Persist()
+}
+
+// SeriesIDs returns the IDs of all series held in the memstore or in segments
+func (s *Shard) SeriesIDs() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("shard is closed")
+	}
+
+	return s.index.SeriesIDs(), nil
+}
+
+// Select returns the IDs of the series of a measurement whose tags satisfy
+// every matcher, resolved through the tag index
+func (s *Shard) Select(measurement string, matchers ...*TagMatcher) (Postings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("shard is closed")
+	}
+
+	return s.index.Select(measurement, matchers...), nil
+}
+
+// FieldType returns the type recorded for a field of a measurement in the shard
+func (s *Shard) FieldType(measurement, field string) (types.FieldType, bool) {
+	return s.index.FieldType(measurement, field)
+}
+
+// Fields returns the fields of a measurement recorded in the shard
+func (s *Shard) Fields(measurement string) []string {
+	return s.index.Fields(measurement)
+}
+
+// SeriesType returns the field type recorded for a series in the shard
+func (s *Shard) SeriesType(seriesID string) (types.FieldType, bool) {
+	return s.index.SeriesType(seriesID)
+}
+
+// SeriesInRange narrows ids to the series with data between start and end.
+// Memstore points are checked individually, while segments are matched on
+// their time bounds and the series IDs recorded in their header, so a series
+// whose segment overlaps the range is kept even if its own points do not.
+func (s *Shard) SeriesInRange(ids Postings, start, end time.Time) (Postings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("shard is closed")
+	}
+
+	active := s.memStore.SeriesInRange(start, end)
+
+	segments, err := s.segmentReader.ListSegments()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list segments: %w", err)
+	}
+	for _, segment := range segments {
+		if segment.MaxTime.Before(start) || segment.MinTime.After(end) {
+			continue
+		}
+		for _, seriesID := range segment.SeriesIDs {
+			active[seriesID] = true
+		}
+	}
+
+	result := make(Postings, 0, len(ids))
+	for _, id := range ids {
+		if active[id] {
+			result = append(result, id)
+		}
+	}
+	return result, nil
+}
+
+// seriesBounds returns times at or before the oldest and at or after the
+// newest point of a series, from the memtable and the time range of the
+// segments holding the series. It reports false when the shard holds no point
+// of the series.
+func (s *Shard) seriesBounds(seriesID string) (time.Time, time.Time, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return time.Time{}, time.Time{}, false, fmt.Errorf("shard is closed")
+	}
+
+	min, max, found := s.memStore.Bounds(seriesID)
+
+	segments, err := s.segmentReader.ListSegments()
+	if err != nil {
+		return time.Time{}, time.Time{}, false, fmt.Errorf("failed to list segments: %w", err)
+	}
+	for _, segment := range segments {
+		holds := false
+		for _, id := range segment.SeriesIDs {
+			if id == seriesID {
+				holds = true
+				break
+			}
+		}
+		if !holds {
+			continue
+		}
+		if !found || segment.MinTime.Before(min) {
+			min = segment.MinTime
+		}
+		if !found || segment.MaxTime.After(max) {
+			max = segment.MaxTime
+		}
+		found = true
+	}
+
+	return min, max, found, nil
+}
+
+// loadIndex loads the persisted tag index. Shards written before the index
+// existed have it rebuilt from the series stored in their segments.
+func (s *Shard) loadIndex() error {
+	found, err := s.index.Load()
+	if err != nil {
+		logger.Warnf("Rebuilding unreadable tag index of shard %s: %v", s.id, err)
+	}
+	if found {
+		return nil
+	}
+
+	segments, err := s.segmentReader.ListSegments()
+	if err != nil {
+		return fmt.Errorf("failed to list segments: %w", err)
+	}
+	for _, segment := range segments {
+		_, results, err := s.segmentReader.ReadSegment(segment.Path)
+		if err != nil {
+			logger.Warnf("Skipping unreadable segment %s while rebuilding tag index: %v", segment.Path, err)
+			continue
+		}
+		for _, result := range results {
+			fieldType, err := pointsType(result.Points)
+			if err == nil {
+				_, err = s.index.Add(result.SeriesID, fieldType)
+			}
+			if err != nil {
+				logger.Warnf("Skipping series %s while rebuilding tag index: %v", result.SeriesID, err)
+			}
+		}
+	}
+
+	if s.index.Len() > 0 {
+		logger.Infof("Rebuilt tag index of shard %s from segments: %d series", s.id, s.index.Len())
+	}
+	return s.index.Persist()
+}
+
 // performRecovery performs WAL recovery on startup
 func (s *Shard) performRecovery() error {
 	s.recovering = true
@@ -342,19 +906,19 @@ func (s *Shard) performRecovery() error {
 	logger.Infof("Recovering shard %s: %d entries, %d errors",
 		s.id, result.TotalCount, result.ErrorCount)
 
-	// Reconstruct memstore from recovered data
+	// Reconstruct memstore and tag index from recovered data. The points are
+	// not logged again: the replayed WAL files are kept until the next flush
+	// writes them to a segment.
 	for seriesID, points := range result.SeriesData {
-		if err := s.memStore.Write(seriesID, points); err != nil {
-			if s.metrics != nil {
-				s.metrics.RecordRecoveryComplete(startTime, err)
-			}
-			return fmt.Errorf("failed to write recovered data for series %s: %w", seriesID, err)
+		fieldType, err := pointsType(points)
+		if err == nil {
+			_, err = s.index.Add(seriesID, fieldType)
 		}
-	}
-
-	// Clean up old WAL files
-	if err := s.walReplay.CleanupOldWALs(24 * time.Hour); err != nil {
-		logger.Warnf("Failed to cleanup old WAL files: %v", err)
+		if err != nil {
+			logger.Warnf("Skipping recovered series %s: %v", seriesID, err)
+			continue
+		}
+		s.memStore.Load(seriesID, points)
 	}
 
 	// Record successful recovery completion
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -209,6 +211,43 @@ func TestShardWrite(t *testing.T) {
 		}
 	})
 
+	t.Run("failed write of a new series", func(t *testing.T) {
+		config := ShardConfig{
+			ID:                  "test_shard",
+			DataDir:             t.TempDir(),
+			MaxMemTableSize:     1024 * 1024,
+			MaxWALSize:          64 * 1024,
+			MaxLevels:           3,
+			MaxSegmentsPerLevel: 5,
+			MaxSegmentSize:      1024 * 1024,
+			CompactionInterval:  30 * time.Second,
+		}
+
+		shard, err := NewShard(config, nil)
+		if err != nil {
+			t.Fatalf("Failed to create shard: %v", err)
+		}
+		defer shard.Close()
+
+		stored := SeriesKey{Measurement: "cpu", Field: "usage", Tags: map[string]string{"host": "a"}}.String()
+		if err := shard.Write(WriteRequest{SeriesID: stored, Points: []DataPoint{{Timestamp: time.Now(), Value: 1}}}); err != nil {
+			t.Fatalf("Failed to write data: %v", err)
+		}
+
+		// Every write fails from here on
+		shard.memStore.wal = &MockWAL{errors: []error{errors.New("disk full"), errors.New("disk full")}}
+		failed := SeriesKey{Measurement: "cpu", Field: "usage", Tags: map[string]string{"host": "b"}}.String()
+		for _, seriesID := range []string{stored, failed} {
+			if err := shard.Write(WriteRequest{SeriesID: seriesID, Points: []DataPoint{{Timestamp: time.Now(), Value: 2}}}); err == nil {
+				t.Fatalf("Expected the write of %s to fail", seriesID)
+			}
+		}
+
+		if ids := shard.index.SeriesIDs(); len(ids) != 1 || ids[0] != stored {
+			t.Errorf("Expected only %s indexed, got %v", stored, ids)
+		}
+	})
+
 	t.Run("write to closed shard", func(t *testing.T) {
 		tempDir := t.TempDir()
 
@@ -324,7 +363,7 @@ func TestShardRead(t *testing.T) {
 			Limit:    10,
 		}
 
-		points, err := shard.Read(readReq)
+		points, err := shard.Read(context.Background(), readReq)
 		if err != nil {
 			t.Fatalf("Failed to read data: %v", err)
 		}
@@ -393,7 +432,7 @@ func TestShardRead(t *testing.T) {
 			Limit:    10,
 		}
 
-		points, err := shard.Read(readReq)
+		points, err := shard.Read(context.Background(), readReq)
 		if err != nil {
 			t.Fatalf("Failed to read data: %v", err)
 		}
@@ -436,7 +475,7 @@ func TestShardRead(t *testing.T) {
 			Limit:    10,
 		}
 
-		_, err = shard.Read(readReq)
+		_, err = shard.Read(context.Background(), readReq)
 		if err == nil {
 			t.Error("Expected error when reading from closed shard")
 		}
@@ -596,3 +635,192 @@ func TestShardGetters(t *testing.T) {
 		}
 	})
 }
+
+func TestShardAggregate(t *testing.T) {
+	config := ShardConfig{
+		ID:                  "test_shard",
+		DataDir:             t.TempDir(),
+		MaxMemTableSize:     1024 * 1024,
+		MaxWALSize:          64 * 1024,
+		MaxLevels:           3,
+		MaxSegmentsPerLevel: 5,
+		MaxSegmentSize:      1024 * 1024,
+		CompactionInterval:  30 * time.Second,
+	}
+
+	shard, err := NewShard(config, nil)
+	if err != nil {
+		t.Fatalf("Failed to create shard: %v", err)
+	}
+	defer shard.Close()
+
+	if err := shard.Open(); err != nil {
+		t.Fatalf("Failed to open shard: %v", err)
+	}
+
+	// Flush the first half to a segment and keep the second half in the memstore
+	base := time.Unix(1700000000, 0).UTC()
+	points := aggregatePoints(base, 1, 2, 3, 4, 5, 6)
+	if err := shard.Write(WriteRequest{SeriesID: "cpu:value:", Points: points[:3]}); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+	if err := shard.ForceFlush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if err := shard.Write(WriteRequest{SeriesID: "cpu:value:", Points: points[3:]}); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+
+	results, err := shard.Aggregate(context.Background(), AggregateRequest{
+		SeriesIDs:        []string{"cpu:value:"},
+		Start:            base,
+		End:              base.Add(time.Minute),
+		AggregateOptions: AggregateOptions{Function: AggregateMean, Window: 4 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("Failed to aggregate: %v", err)
+	}
+
+	// The first window spans the segment and the memstore
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 windows, got %+v", results)
+	}
+	if results[0].Value != 2.5 || results[0].Count != 4 {
+		t.Errorf("Expected first window mean 2.5 over 4 points, got %+v", results[0])
+	}
+	if results[1].Value != 5.5 || results[1].Count != 2 {
+		t.Errorf("Expected second window mean 5.5 over 2 points, got %+v", results[1])
+	}
+
+	if _, err := shard.Aggregate(context.Background(), AggregateRequest{AggregateOptions: AggregateOptions{Function: "median"}}); err == nil {
+		t.Error("Expected an error for an unknown function")
+	}
+}
+
+func TestShardTagIndexRecovery(t *testing.T) {
+	dataDir := t.TempDir()
+	config := ShardConfig{
+		ID:                  "test_shard",
+		DataDir:             dataDir,
+		MaxMemTableSize:     1024 * 1024,
+		MaxWALSize:          64 * 1024,
+		MaxLevels:           3,
+		MaxSegmentsPerLevel: 5,
+		MaxSegmentSize:      1024 * 1024,
+		CompactionInterval:  30 * time.Second,
+	}
+
+	shard, err := NewShard(config, nil)
+	if err != nil {
+		t.Fatalf("Failed to create shard: %v", err)
+	}
+
+	seriesIDs := []string{"cpu:usage:host=a:region=eu", "cpu:usage:host=b:region=us"}
+	for _, id := range seriesIDs {
+		if err := shard.Write(WriteRequest{SeriesID: id, Points: []DataPoint{{Timestamp: time.Now(), Value: 1}}}); err != nil {
+			t.Fatalf("Failed to write data: %v", err)
+		}
+	}
+
+	// Simulate a crash: the WAL reaches disk but the memstore and index are never persisted
+	if err := shard.wal.Close(); err != nil {
+		t.Fatalf("Failed to close WAL: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "segments", IndexFileName)); err == nil {
+		t.Fatal("Expected no persisted index before the shard is flushed")
+	}
+
+	recovered, err := NewShard(config, nil)
+	if err != nil {
+		t.Fatalf("Failed to create shard: %v", err)
+	}
+	defer recovered.Close()
+	if err := recovered.Open(); err != nil {
+		t.Fatalf("Failed to open shard: %v", err)
+	}
+
+	matcher, _ := NewTagMatcher(MatchEqual, "host", "b")
+	ids, err := recovered.Select("cpu", matcher)
+	if err != nil {
+		t.Fatalf("Failed to select series: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != seriesIDs[1] {
+		t.Errorf("Expected [%s] after WAL recovery, got %v", seriesIDs[1], ids)
+	}
+
+	// Closing persists the index alongside the segments
+	if err := recovered.Close(); err != nil {
+		t.Fatalf("Failed to close shard: %v", err)
+	}
+	persisted := NewTagIndex(filepath.Join(dataDir, "segments", IndexFileName))
+	if found, err := persisted.Load(); !found || err != nil {
+		t.Fatalf("Expected a persisted index, got found=%v err=%v", found, err)
+	}
+	if persisted.Len() != len(seriesIDs) {
+		t.Errorf("Expected %d persisted series, got %d", len(seriesIDs), persisted.Len())
+	}
+
+	// A clean restart reads the flushed points once instead of replaying them again
+	reopened, err := NewShard(config, nil)
+	if err != nil {
+		t.Fatalf("Failed to create shard: %v", err)
+	}
+	defer reopened.Close()
+	if err := reopened.Open(); err != nil {
+		t.Fatalf("Failed to open shard: %v", err)
+	}
+	points, err := reopened.Read(context.Background(), ReadRequest{SeriesID: seriesIDs[0], Start: time.Unix(0, 0), End: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("Failed to read data: %v", err)
+	}
+	if len(points) != 1 {
+		t.Errorf("Expected 1 point after restart, got %d", len(points))
+	}
+}
+
+func TestShardRecoveryCrash(t *testing.T) {
+	dataDir := t.TempDir()
+	config := ShardConfig{
+		ID:                  "test_shard",
+		DataDir:             dataDir,
+		MaxMemTableSize:     1024 * 1024,
+		MaxWALSize:          64 * 1024,
+		MaxLevels:           3,
+		MaxSegmentsPerLevel: 5,
+		MaxSegmentSize:      1024 * 1024,
+		CompactionInterval:  30 * time.Second,
+	}
+
+	shard, err := NewShard(config, nil)
+	if err != nil {
+		t.Fatalf("Failed to create shard: %v", err)
+	}
+	if err := shard.Write(WriteRequest{SeriesID: "cpu:usage:host=a", Points: []DataPoint{{Timestamp: time.Now(), Value: 1}}}); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+	if err := shard.wal.Close(); err != nil {
+		t.Fatalf("Failed to close WAL: %v", err)
+	}
+
+	// Crashing again right after each recovery neither loses the recovered
+	// points nor replays them twice
+	for i := 0; i < 2; i++ {
+		recovered, err := NewShard(config, nil)
+		if err != nil {
+			t.Fatalf("Failed to create shard: %v", err)
+		}
+		if err := recovered.Open(); err != nil {
+			t.Fatalf("Failed to open shard: %v", err)
+		}
+		points, err := recovered.Read(context.Background(), ReadRequest{SeriesID: "cpu:usage:host=a", Start: time.Unix(0, 0), End: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatalf("Failed to read data: %v", err)
+		}
+		if len(points) != 1 {
+			t.Errorf("Expected 1 point after recovery %d, got %d", i+1, len(points))
+		}
+		if err := recovered.wal.Close(); err != nil {
+			t.Fatalf("Failed to close WAL: %v", err)
+		}
+	}
+}
@@ -2,25 +2,41 @@
 package storage
 
 import (
+	"context"
 	"fmt"
-	"strconv"
+	"os"
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 	"timeseriesdb/internal/config"
 	"timeseriesdb/internal/errors"
 	"timeseriesdb/internal/logger"
-	"timeseriesdb/internal/types"
 )
 
 // Storage represents the main storage engine using LSM tree architecture
-// This struct coordinates multiple shards, compaction, and provides a unified interface
+// This struct coordinates the databases, each with its own shards, and provides
+// a unified interface. It embeds the default database, so its read and write
+// methods act on that database.
 type Storage struct {
+	*Database
+
 	mu            sync.RWMutex
 	config        config.StorageConfig
-	shards        map[string]*Shard
+	databases     map[string]*Database
 	compactionMgr *CompactionManager
 	metrics       *StorageMetrics
 	closed        bool
+
+	// Background retention enforcement
+	retentionStop chan struct{}
+	retentionDone sync.WaitGroup
+	retentionOnce sync.Once
+
+	// Background continuous queries
+	continuousQueryStop chan struct{}
+	continuousQueryDone sync.WaitGroup
+	continuousQueryOnce sync.Once
 }
 
 // NewStorage creates a new storage engine with LSM tree architecture
@@ -31,273 +47,301 @@ func NewStorage(cfg config.StorageConfig) *Storage {
 
 	// Create storage instance
 	storage := &Storage{
-		config:  cfg,
-		shards:  make(map[string]*Shard),
-		metrics: metrics,
-		closed:  false,
+		config:    cfg,
+		databases: make(map[string]*Database),
+		metrics:   metrics,
+		closed:    false,
 	}
 
-	// Initialize default shard
-	if err := storage.createShard("default"); err != nil {
-		logger.Fatalf("Error creating default shard: %v", err)
+	// Initialize the default database in the data directory
+	db, err := openDatabase(DefaultDatabase, cfg.DataDir, cfg, metrics)
+	if err != nil {
+		logger.Fatalf("Error opening default database: %v", err)
 	}
+	storage.Database = db
+	storage.databases[DefaultDatabase] = db
 
-	return storage
-}
+	// Reopen the named databases created earlier
+	entries, err := os.ReadDir(filepath.Join(cfg.DataDir, databasesDir))
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warnf("Failed to list databases: %v", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || name == DefaultDatabase || ValidateDatabaseName(name) != nil {
+			continue
+		}
+		db, err := openDatabase(name, storage.databaseDir(name), cfg, metrics)
+		if err != nil {
+			logger.Errorf("Failed to open database %s: %v", name, err)
+			continue
+		}
+		storage.databases[name] = db
+	}
 
-// WritePoint writes a time-series point to the appropriate shard
-func (s *Storage) WritePoint(p types.Point) error {
-	startTime := time.Now()
+	storage.recordShardCount()
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	// Start the retention job
+	if cfg.RetentionCheckInterval > 0 {
+		storage.retentionStop = make(chan struct{})
+		storage.retentionDone.Add(1)
+		go storage.retentionLoop(cfg.RetentionCheckInterval)
+	}
 
-	if s.closed {
-		return errors.WrapWithType(fmt.Errorf("storage is closed"), errors.ErrorTypeStorage, "write operation on closed storage")
+	// Start the continuous query job
+	if cfg.ContinuousQueryInterval > 0 {
+		storage.continuousQueryStop = make(chan struct{})
+		storage.continuousQueryDone.Add(1)
+		go storage.continuousQueryLoop(cfg.ContinuousQueryInterval)
 	}
 
-	// Determine which shard to use (for now, use default or create based on measurement)
-	shardID := s.determineShardID(p.Measurement)
+	return storage
+}
 
-	shard, exists := s.shards[shardID]
-	if !exists {
-		// Need to upgrade to write lock to create shard
-		s.mu.RUnlock()
-		s.mu.Lock()
-
-		// Double-check that shard still doesn't exist after acquiring write lock
-		shard, exists = s.shards[shardID]
-		if !exists {
-			// Create new shard if it doesn't exist
-			if err := s.createShard(shardID); err != nil {
-				s.mu.Unlock()
-				return errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to create shard")
+// retentionLoop periodically deletes expired data until the storage is closed
+func (s *Storage) retentionLoop(interval time.Duration) {
+	defer s.retentionDone.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			result, err := s.EnforceRetention()
+			if err != nil {
+				logger.Errorf("Retention enforcement failed: %v", err)
 			}
-			shard = s.shards[shardID]
+			if result.SegmentsDeleted > 0 {
+				logger.Infof("Retention deleted %d segments: %d points, %d bytes reclaimed",
+					result.SegmentsDeleted, result.PointsReclaimed, result.BytesReclaimed)
+			}
+		case <-s.retentionStop:
+			return
 		}
-
-		s.mu.Unlock()
-		s.mu.RLock() // Re-acquire read lock for the rest of the function
 	}
+}
 
-	// Convert types.Point to storage.DataPoint
-	dataPoints := make([]DataPoint, 0, len(p.Fields))
-	for fieldName, fieldValue := range p.Fields {
-		// Create a unique series ID combining measurement, tags, and field
-		seriesID := s.createSeriesID(p.Measurement, p.Tags, fieldName)
-
-		// Convert field value to float64
-		value, err := s.convertToFloat64(fieldValue)
-		if err != nil {
-			logger.Warnf("Skipping field %s with invalid value %v: %v", fieldName, fieldValue, err)
-			continue
+// stopRetention stops the retention job and waits for a running pass to finish
+func (s *Storage) stopRetention() {
+	s.retentionOnce.Do(func() {
+		if s.retentionStop != nil {
+			close(s.retentionStop)
+			s.retentionDone.Wait()
 		}
+	})
+}
 
-		dataPoint := DataPoint{
-			Timestamp: p.Timestamp,
-			Value:     value,
-			Labels:    p.Tags,
-		}
-		dataPoints = append(dataPoints, dataPoint)
+// continuousQueryLoop periodically runs the due continuous queries until the
+// storage is closed
+func (s *Storage) continuousQueryLoop(interval time.Duration) {
+	defer s.continuousQueryDone.Done()
 
-		// Write to the specific series
-		writeReq := WriteRequest{
-			SeriesID: seriesID,
-			Points:   []DataPoint{dataPoint},
-		}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-		if err := shard.Write(writeReq); err != nil {
-			return errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to write point to shard")
+	for {
+		select {
+		case <-ticker.C:
+			written, err := s.RunContinuousQueries(context.Background(), time.Now())
+			if err != nil {
+				logger.Errorf("Continuous queries failed: %v", err)
+			}
+			if written > 0 {
+				logger.Debugf("Continuous queries wrote %d rollup windows", written)
+			}
+		case <-s.continuousQueryStop:
+			return
 		}
 	}
+}
 
-	// Update metrics
-	if s.metrics != nil {
-		s.metrics.RecordShardCount(len(s.shards))
-		s.metrics.RecordStorageWriteOperation("storage", "write_point")
-		s.metrics.RecordDataPointsWritten("storage", len(dataPoints))
-		s.metrics.RecordStorageWriteLatency("storage", "write_point", time.Since(startTime))
+// stopContinuousQueries stops the continuous query job and waits for a
+// running pass to finish
+func (s *Storage) stopContinuousQueries() {
+	s.continuousQueryOnce.Do(func() {
+		if s.continuousQueryStop != nil {
+			close(s.continuousQueryStop)
+			s.continuousQueryDone.Wait()
+		}
+	})
+}
+
+// RunContinuousQueries runs the continuous queries of every database that are
+// due at now, returning the number of rollup windows written
+func (s *Storage) RunContinuousQueries(ctx context.Context, now time.Time) (int, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return 0, errors.WrapWithType(fmt.Errorf("storage is closed"), errors.ErrorTypeStorage, "continuous queries on closed storage")
+	}
+	databases := make([]*Database, 0, len(s.databases))
+	for _, db := range s.databases {
+		databases = append(databases, db)
 	}
+	s.mu.RUnlock()
 
-	return nil
+	written := 0
+	var lastError error
+	for _, db := range databases {
+		n, err := db.RunContinuousQueries(ctx, now)
+		written += n
+		if err != nil {
+			lastError = err
+		}
+	}
+	return written, lastError
 }
 
-// ReadPoints reads time-series points from the storage engine
-func (s *Storage) ReadPoints(measurement string, tags map[string]string, field string, start, end time.Time, limit int) ([]types.Point, error) {
+// EnforceRetention deletes the segments of every database whose points have
+// all expired under the retention policies. Partially expired segments are
+// cleaned up as they are compacted.
+func (s *Storage) EnforceRetention() (RetentionResult, error) {
 	startTime := time.Now()
+	var result RetentionResult
 
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	if s.closed {
-		return nil, errors.WrapWithType(fmt.Errorf("storage is closed"), errors.ErrorTypeStorage, "read operation on closed storage")
+		return result, errors.WrapWithType(fmt.Errorf("storage is closed"), errors.ErrorTypeStorage, "retention on closed storage")
 	}
 
-	// Create series ID for the query
-	seriesID := s.createSeriesID(measurement, tags, field)
-
-	// Try to find the series in any shard
-	var allPoints []DataPoint
-	for _, shard := range s.shards {
-		readReq := ReadRequest{
-			SeriesID: seriesID,
-			Start:    start,
-			End:      end,
-			Limit:    limit,
-		}
-
-		points, err := shard.Read(readReq)
+	var lastError error
+	for _, db := range s.databases {
+		dbResult, err := db.enforceRetention()
 		if err != nil {
-			logger.Warnf("Failed to read from shard %s: %v", shard.GetID(), err)
-			continue
-		}
-
-		allPoints = append(allPoints, points...)
-	}
-
-	// Convert DataPoints back to types.Point
-	result := make([]types.Point, 0, len(allPoints))
-	for _, dp := range allPoints {
-		point := types.Point{
-			Measurement: measurement,
-			Tags:        dp.Labels,
-			Fields:      map[string]float64{field: dp.Value},
-			Timestamp:   dp.Timestamp,
+			lastError = err
 		}
-		result = append(result, point)
+		result.add(dbResult)
 	}
 
-	// Update metrics
 	if s.metrics != nil {
-		s.metrics.RecordStorageReadOperation("storage", "read_points")
-		s.metrics.RecordDataPointsRead("storage", len(result))
-		s.metrics.RecordStorageReadLatency("storage", "read_points", time.Since(startTime))
+		s.metrics.RecordRetentionRun(startTime, lastError)
 	}
 
-	return result, nil
+	return result, lastError
 }
 
-// createShard creates a new storage shard
-func (s *Storage) createShard(shardID string) error {
-	// Use existing config fields and provide sensible defaults for LSM tree
-	shardConfig := ShardConfig{
-		ID:                  shardID,
-		DataDir:             fmt.Sprintf("%s/shard_%s", s.config.DataDir, shardID),
-		MaxMemTableSize:     64 * 1024 * 1024, // 64MB default
-		MaxWALSize:          s.config.MaxFileSize,
-		MaxLevels:           7, // Standard LSM tree levels
-		MaxSegmentsPerLevel: 10,
-		MaxSegmentSize:      256 * 1024 * 1024, // 256MB default
-		CompactionInterval:  30 * time.Second,
-	}
-
-	shard, err := NewShard(shardConfig, s.metrics)
-	if err != nil {
-		return fmt.Errorf("failed to create shard %s: %w", shardID, err)
+// GetDatabase returns the named database, or the default database for an
+// empty name
+func (s *Storage) GetDatabase(name string) (*Database, error) {
+	if name == "" {
+		name = DefaultDatabase
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("storage is closed"), errors.ErrorTypeStorage, "database lookup on closed storage")
 	}
 
-	// Open the shard
-	if err := shard.Open(); err != nil {
-		return fmt.Errorf("failed to open shard %s: %w", shardID, err)
+	db, ok := s.databases[name]
+	if !ok {
+		return nil, errors.NewNotFoundError(fmt.Sprintf("database %q not found", name))
 	}
+	return db, nil
+}
 
-	s.shards[shardID] = shard
+// CreateDatabase creates a named database, reporting false if it already existed
+func (s *Storage) CreateDatabase(name string) (bool, error) {
+	if err := ValidateDatabaseName(name); err != nil {
+		return false, err
+	}
 
-	// Update metrics
-	if s.metrics != nil {
-		s.metrics.RecordShardCount(len(s.shards))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false, errors.WrapWithType(fmt.Errorf("storage is closed"), errors.ErrorTypeStorage, "create database on closed storage")
+	}
+	if _, ok := s.databases[name]; ok {
+		return false, nil
 	}
 
-	logger.Infof("Created and opened shard: %s", shardID)
+	db, err := openDatabase(name, s.databaseDir(name), s.config, s.metrics)
+	if err != nil {
+		return false, errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to create database "+name)
+	}
+	s.databases[name] = db
+	s.recordShardCountLocked()
 
-	return nil
+	logger.Infof("Created database %s", name)
+	return true, nil
 }
 
-// determineShardID determines which shard should store the data
-// This is a simple hash-based approach that can be enhanced with more sophisticated routing
-func (s *Storage) determineShardID(measurement string) string {
-	// For now, use a simple approach - could be enhanced with consistent hashing
-	if len(s.shards) == 0 {
-		return "default"
+// DropDatabase closes a named database and deletes all of its data. The
+// default database cannot be dropped.
+func (s *Storage) DropDatabase(name string) error {
+	if name == DefaultDatabase {
+		return errors.NewValidationError("the default database cannot be dropped")
 	}
 
-	// Simple hash-based shard selection
-	hash := 0
-	for _, char := range measurement {
-		hash = (hash*31 + int(char)) % len(s.shards)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errors.WrapWithType(fmt.Errorf("storage is closed"), errors.ErrorTypeStorage, "drop database on closed storage")
 	}
 
-	// Get shard IDs and return the selected one
-	shardIDs := make([]string, 0, len(s.shards))
-	for id := range s.shards {
-		shardIDs = append(shardIDs, id)
+	db, ok := s.databases[name]
+	if !ok {
+		return errors.NewNotFoundError(fmt.Sprintf("database %q not found", name))
 	}
+	delete(s.databases, name)
+	s.recordShardCountLocked()
 
-	if len(shardIDs) > 0 {
-		return shardIDs[hash%len(shardIDs)]
+	if err := db.close(); err != nil {
+		logger.Warnf("Failed to close database %s while dropping it: %v", name, err)
+	}
+	if err := os.RemoveAll(db.dir); err != nil {
+		return errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to remove data of database "+name)
 	}
 
-	return "default"
+	logger.Infof("Dropped database %s", name)
+	return nil
 }
 
-// createSeriesID creates a unique series identifier from measurement, tags, and field
-func (s *Storage) createSeriesID(measurement string, tags map[string]string, field string) string {
-	// Simple concatenation approach - could be enhanced with more sophisticated encoding
-	seriesID := measurement + ":" + field
-
-	// Add tags if present
-	if len(tags) > 0 {
-		// Sort tags for consistent ordering
-		tagKeys := make([]string, 0, len(tags))
-		for k := range tags {
-			tagKeys = append(tagKeys, k)
-		}
+// ListDatabases returns the sorted names of all databases
+func (s *Storage) ListDatabases() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-		for _, key := range tagKeys {
-			seriesID += ":" + key + "=" + tags[key]
-		}
+	if s.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("storage is closed"), errors.ErrorTypeStorage, "list databases on closed storage")
 	}
 
-	return seriesID
+	names := make([]string, 0, len(s.databases))
+	for name := range s.databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
 }
 
-// convertToFloat64 converts various field values to float64
-func (s *Storage) convertToFloat64(value interface{}) (float64, error) {
-	switch v := value.(type) {
-	case float64:
-		return v, nil
-	case float32:
-		return float64(v), nil
-	case int:
-		return float64(v), nil
-	case int64:
-		return float64(v), nil
-	case int32:
-		return float64(v), nil
-	case string:
-		// Try to parse as float
-		if f, err := parseFloat(v); err == nil {
-			return f, nil
-		}
-		// If not a number, hash the string to a float
-		return float64(hashString(v)), nil
-	default:
-		return 0, fmt.Errorf("unsupported value type: %T", value)
-	}
+// databaseDir returns the directory holding the shards of a named database
+func (s *Storage) databaseDir(name string) string {
+	return filepath.Join(s.config.DataDir, databasesDir, name)
 }
 
-// parseFloat attempts to parse a string as a float
-func parseFloat(s string) (float64, error) {
-	return strconv.ParseFloat(s, 64)
+// recordShardCount records the number of shards across all databases
+func (s *Storage) recordShardCount() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.recordShardCountLocked()
 }
 
-// hashString creates a simple hash of a string
-func hashString(s string) uint32 {
-	var hash uint32
-	for _, char := range s {
-		hash = hash*31 + uint32(char)
+// recordShardCountLocked records the shard count, the caller must hold the lock
+func (s *Storage) recordShardCountLocked() {
+	if s.metrics == nil {
+		return
+	}
+	count := 0
+	for _, db := range s.databases {
+		count += db.shardCount()
 	}
-	return hash
+	s.metrics.RecordShardCount(count)
 }
 
 // GetStats returns comprehensive statistics about the storage engine
@@ -305,21 +349,26 @@ func (s *Storage) GetStats() map[string]interface{} {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	databases := make(map[string]interface{}, len(s.databases))
+	shardCount := 0
+	for name, db := range s.databases {
+		dbStats := db.stats()
+		databases[name] = dbStats
+		shardCount += dbStats["shard_count"].(int)
+	}
+
 	stats := map[string]interface{}{
-		"shard_count": len(s.shards),
-		"closed":      s.closed,
+		"shard_count":    shardCount,
+		"database_count": len(s.databases),
+		"closed":         s.closed,
 		"config": map[string]interface{}{
 			"data_file":     s.config.DataFile,
 			"max_file_size": s.config.MaxFileSize,
 			"backup_dir":    s.config.BackupDir,
 			"compression":   s.config.Compression,
 		},
-		"shards": make(map[string]interface{}),
-	}
-
-	// Collect stats from each shard
-	for shardID, shard := range s.shards {
-		stats["shards"].(map[string]interface{})[shardID] = shard.GetStats()
+		"databases": databases,
+		"shards":    s.Database.stats()["shards"],
 	}
 
 	// Add metrics
@@ -332,7 +381,7 @@ func (s *Storage) GetStats() map[string]interface{} {
 	return stats
 }
 
-// ForceCompaction forces compaction on all shards
+// ForceCompaction forces compaction on the shards of every database
 func (s *Storage) ForceCompaction() error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -342,10 +391,8 @@ func (s *Storage) ForceCompaction() error {
 	}
 
 	var lastError error
-	for shardID, shard := range s.shards {
-		// Force compaction on level 0 (most common)
-		if err := shard.ForceCompaction(0); err != nil {
-			logger.Warnf("Failed to force compaction on shard %s: %v", shardID, err)
+	for _, db := range s.databases {
+		if err := db.forceCompaction(); err != nil {
 			lastError = err
 		}
 	}
@@ -353,8 +400,11 @@ func (s *Storage) ForceCompaction() error {
 	return lastError
 }
 
-// Close closes the storage engine and all its shards
+// Close closes the storage engine and all its databases
 func (s *Storage) Close() error {
+	s.stopRetention()
+	s.stopContinuousQueries()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -364,18 +414,15 @@ func (s *Storage) Close() error {
 
 	s.closed = true
 
-	// Close all shards
+	// Close all databases
 	var lastError error
-	for shardID, shard := range s.shards {
-		if err := shard.Close(); err != nil {
-			logger.Warnf("Failed to close shard %s: %v", shardID, err)
+	for name, db := range s.databases {
+		if err := db.close(); err != nil {
+			logger.Warnf("Failed to close database %s: %v", name, err)
 			lastError = err
 		}
 	}
 
-	// Clear shards map
-	s.shards = make(map[string]*Shard)
-
 	logger.Infof("Storage engine closed")
 	return lastError
 }
@@ -389,20 +436,12 @@ func (s *Storage) Clear() error {
 		return errors.WrapWithType(fmt.Errorf("storage is closed"), errors.ErrorTypeStorage, "clear operation on closed storage")
 	}
 
-	// Close and remove all shards
-	for shardID, shard := range s.shards {
-		if err := shard.Close(); err != nil {
-			logger.Warnf("Failed to close shard %s during clear: %v", shardID, err)
+	for name, db := range s.databases {
+		if err := db.clear(); err != nil {
+			return errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to recreate default shard of database "+name+" after clear")
 		}
 	}
-
-	// Clear shards map
-	s.shards = make(map[string]*Shard)
-
-	// Create default shard
-	if err := s.createShard("default"); err != nil {
-		return errors.WrapWithType(err, errors.ErrorTypeStorage, "failed to recreate default shard after clear")
-	}
+	s.recordShardCountLocked()
 
 	logger.Infof("Storage engine cleared")
 	return nil
@@ -1,9 +1,277 @@
 package storage
 
 import (
+	"context"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/errors"
 	"timeseriesdb/internal/logger"
+	"timeseriesdb/internal/types"
 )
 
 func init() {
 	logger.Init()
 }
+
+func TestStorageReadPoints(t *testing.T) {
+	s := NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	defer s.Close()
+
+	tags := map[string]string{"host": "server01", "region": "us-west", "dc": "dc1"}
+	base := time.Unix(0, 1434055562000000000)
+
+	for i := 0; i < 5; i++ {
+		err := s.WritePoint(context.Background(), types.Point{
+			Measurement: "cpu",
+			Tags:        tags,
+			Fields:      map[string]interface{}{"value": float64(i), "load": float64(i * 10)},
+			Timestamp:   base.Add(time.Duration(i) * time.Second),
+		})
+		if err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+
+	t.Run("read full range", func(t *testing.T) {
+		points, err := s.ReadPoints(context.Background(), "cpu", tags, "load", base, base.Add(time.Minute), 0)
+		if err != nil {
+			t.Fatalf("Failed to read points: %v", err)
+		}
+		if len(points) != 5 {
+			t.Fatalf("Expected 5 points, got %d", len(points))
+		}
+		for i, p := range points {
+			if p.Fields["load"] != float64(i*10) {
+				t.Errorf("Expected load %d at index %d, got %f", i*10, i, p.Fields["load"])
+			}
+		}
+	})
+
+	t.Run("read with limit and sub range", func(t *testing.T) {
+		points, err := s.ReadPoints(context.Background(), "cpu", tags, "value", base.Add(time.Second), base.Add(4*time.Second), 2)
+		if err != nil {
+			t.Fatalf("Failed to read points: %v", err)
+		}
+		if len(points) != 2 {
+			t.Fatalf("Expected 2 points, got %d", len(points))
+		}
+		if points[0].Fields["value"] != 1.0 {
+			t.Errorf("Expected first value 1, got %v", points[0].Fields["value"])
+		}
+	})
+}
+
+func TestStorageReadPointsTagSubset(t *testing.T) {
+	s := NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	defer s.Close()
+
+	base := time.Unix(1700000000, 0)
+	series := []map[string]string{
+		{"host": "a", "region": "eu"},
+		{"host": "a", "region": "us"},
+		{"host": "b", "region": "eu"},
+	}
+	for i, tags := range series {
+		err := s.WritePoint(context.Background(), types.Point{
+			Measurement: "cpu",
+			Tags:        tags,
+			Fields:      map[string]interface{}{"usage": float64(i)},
+			Timestamp:   base.Add(time.Duration(i) * time.Second),
+		})
+		if err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+
+	points, err := s.ReadPoints(context.Background(), "cpu", map[string]string{"host": "a"}, "usage", base, base.Add(time.Minute), 0)
+	if err != nil {
+		t.Fatalf("Failed to read points: %v", err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("Expected 2 points, got %d", len(points))
+	}
+	for i, region := range []string{"eu", "us"} {
+		if points[i].Tags["region"] != region || points[i].Fields["usage"] != float64(i) {
+			t.Errorf("Unexpected point %d: %+v", i, points[i])
+		}
+	}
+
+	exact, err := s.ReadSeries(context.Background(), SeriesKey{Measurement: "cpu", Field: "usage", Tags: series[2]}, base, base.Add(time.Minute), 0)
+	if err != nil {
+		t.Fatalf("Failed to read series: %v", err)
+	}
+	if len(exact) != 1 || exact[0].Fields["usage"] != 2.0 {
+		t.Errorf("Expected the single point of host b, got %+v", exact)
+	}
+}
+
+func TestStorageListSeries(t *testing.T) {
+	s := NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	defer s.Close()
+
+	points := []types.Point{
+		{Measurement: "cpu", Tags: map[string]string{"host": "a"}, Fields: map[string]interface{}{"usage": 1.0, "idle": 2.0}},
+		{Measurement: "cpu", Tags: map[string]string{"host": "b"}, Fields: map[string]interface{}{"usage": 3.0}},
+		{Measurement: "mem", Tags: map[string]string{"host": "a"}, Fields: map[string]interface{}{"free": 4.0}},
+	}
+	for _, p := range points {
+		p.Timestamp = time.Now()
+		if err := s.WritePoint(context.Background(), p); err != nil {
+			t.Fatalf("Failed to write point: %v", err)
+		}
+	}
+
+	keys, err := s.ListSeries("cpu")
+	if err != nil {
+		t.Fatalf("Failed to list series: %v", err)
+	}
+
+	want := []string{"cpu:idle:host=a", "cpu:usage:host=a", "cpu:usage:host=b"}
+	if len(keys) != len(want) {
+		t.Fatalf("Expected %d series, got %d: %v", len(want), len(keys), keys)
+	}
+	for i, key := range keys {
+		if key.String() != want[i] {
+			t.Errorf("Expected series %d to be %s, got %s", i, want[i], key.String())
+		}
+	}
+
+	all, err := s.ListSeries("")
+	if err != nil {
+		t.Fatalf("Failed to list series: %v", err)
+	}
+	if len(all) != 4 {
+		t.Errorf("Expected 4 series across measurements, got %d", len(all))
+	}
+}
+
+func TestStorageAggregateSeries(t *testing.T) {
+	s := NewStorage(config.StorageConfig{
+		DataDir:     t.TempDir(),
+		MaxFileSize: 1024 * 1024,
+	})
+	defer s.Close()
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		for _, host := range []string{"a", "b"} {
+			err := s.WritePoint(context.Background(), types.Point{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host": host},
+				Fields:      map[string]interface{}{"usage": float64(i)},
+				Timestamp:   base.Add(time.Duration(i) * time.Minute),
+			})
+			if err != nil {
+				t.Fatalf("Failed to write point: %v", err)
+			}
+		}
+	}
+
+	keys, err := s.ListSeries("cpu")
+	if err != nil {
+		t.Fatalf("Failed to list series: %v", err)
+	}
+
+	results, err := s.AggregateSeries(context.Background(), keys, base, base.Add(time.Hour), AggregateOptions{Function: AggregateMax, Window: 3 * time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to aggregate series: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 windows, got %+v", results)
+	}
+	if results[0].Value != 2 || results[0].Count != 6 {
+		t.Errorf("Expected first window max 2 over 6 points, got %+v", results[0])
+	}
+	if results[1].Value != 5 || results[1].Count != 6 {
+		t.Errorf("Expected second window max 5 over 6 points, got %+v", results[1])
+	}
+
+	_, err = s.AggregateSeries(context.Background(), keys, base, base.Add(time.Hour), AggregateOptions{Function: AggregatePercentile, Percentile: -1})
+	if !errors.IsType(err, errors.ErrorTypeValidation) {
+		t.Errorf("Expected a validation error, got %v", err)
+	}
+}
+
+func TestStorageTypedFields(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.StorageConfig{DataDir: dir, MaxFileSize: 1024 * 1024}
+	s := NewStorage(cfg)
+
+	tags := map[string]string{"host": "a"}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fields := map[string]interface{}{
+		"float":    1.5,
+		"integer":  int64(-3),
+		"unsigned": uint64(1 << 63),
+		"boolean":  true,
+		"string":   "hello, world",
+	}
+	if err := s.WritePoint(context.Background(), types.Point{Measurement: "status", Tags: tags, Fields: fields, Timestamp: base}); err != nil {
+		t.Fatalf("Failed to write point: %v", err)
+	}
+
+	check := func(t *testing.T, s *Storage) {
+		t.Helper()
+		for field, want := range fields {
+			points, err := s.ReadPoints(context.Background(), "status", tags, field, base, base.Add(time.Minute), 0)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", field, err)
+			}
+			if len(points) != 1 || points[0].Fields[field] != want {
+				t.Errorf("Read %s = %+v, want %v (%T)", field, points, want, want)
+			}
+		}
+	}
+
+	t.Run("memstore", func(t *testing.T) { check(t, s) })
+
+	t.Run("conflicting type", func(t *testing.T) {
+		err := s.WritePoint(context.Background(), types.Point{
+			Measurement: "status",
+			Tags:        map[string]string{"host": "b"},
+			Fields:      map[string]interface{}{"integer": 2.5},
+			Timestamp:   base,
+		})
+		if !errors.IsType(err, errors.ErrorTypeValidation) {
+			t.Errorf("Expected a validation error, got %v", err)
+		}
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		err := s.WritePoint(context.Background(), types.Point{Measurement: "status", Tags: tags, Fields: map[string]interface{}{"bad": 1}, Timestamp: base})
+		if !errors.IsType(err, errors.ErrorTypeValidation) {
+			t.Errorf("Expected a validation error, got %v", err)
+		}
+	})
+
+	t.Run("aggregate", func(t *testing.T) {
+		keys := []SeriesKey{{Measurement: "status", Field: "string", Tags: tags}}
+		if _, err := s.AggregateSeries(context.Background(), keys, base, base.Add(time.Minute), AggregateOptions{Function: AggregateMean}); !errors.IsType(err, errors.ErrorTypeValidation) {
+			t.Errorf("Expected a validation error, got %v", err)
+		}
+		results, err := s.AggregateSeries(context.Background(), keys, base, base.Add(time.Minute), AggregateOptions{Function: AggregateCount})
+		if err != nil || len(results) != 1 || results[0].Value != 1 {
+			t.Errorf("Expected a count of 1, got %+v, %v", results, err)
+		}
+	})
+
+	if err := s.shards["default"].memStore.ForceFlush(); err != nil {
+		t.Fatalf("Failed to flush memstore: %v", err)
+	}
+	t.Run("segment", func(t *testing.T) { check(t, s) })
+	s.Close()
+
+	reopened := NewStorage(cfg)
+	defer reopened.Close()
+	t.Run("reopened", func(t *testing.T) { check(t, reopened) })
+}
@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"timeseriesdb/internal/logger"
+)
+
+// TombstoneFileName is the name of the tombstone log kept in a shard's segments directory
+const TombstoneFileName = "tombstones.log"
+
+// Tombstone deletes the points of a series with timestamps between Min and
+// Max inclusive. Tombstones are numbered in the order they were recorded, and
+// every segment notes the last tombstone already applied to its points, so a
+// tombstone only hides points of segments written before it.
+type Tombstone struct {
+	Seq      uint64    `json:"seq"`
+	SeriesID string    `json:"series_id"`
+	Min      time.Time `json:"min"`
+	Max      time.Time `json:"max"`
+}
+
+// covers reports whether the tombstone deletes a point at ts
+func (t Tombstone) covers(ts time.Time) bool {
+	return !ts.Before(t.Min) && !ts.After(t.Max)
+}
+
+// TombstoneSet holds the tombstones of a shard in an append-only log. A nil
+// set holds no tombstones.
+//
+// Pruning rewrites the log starting with a marker line, a tombstone without a
+// series, carrying the last sequence number recorded. Sequence numbers then
+// keep increasing across restarts even once every tombstone is pruned, so a
+// new tombstone is never mistaken for one that segments already applied.
+type TombstoneSet struct {
+	mu     sync.RWMutex
+	path   string
+	series map[string][]Tombstone
+	seq    uint64
+}
+
+// NewTombstoneSet creates an empty tombstone set persisted at path
+func NewTombstoneSet(path string) *TombstoneSet {
+	return &TombstoneSet{
+		path:   path,
+		series: make(map[string][]Tombstone),
+	}
+}
+
+// Load reads the tombstone log. A line left incomplete by a crash while it was
+// appended is ignored.
+func (ts *TombstoneSet) Load() error {
+	file, err := os.Open(ts.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open tombstone log: %w", err)
+	}
+	defer file.Close()
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var t Tombstone
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil {
+			logger.Warnf("Skipping unreadable tombstone in %s: %v", ts.path, err)
+			continue
+		}
+		if t.Seq > ts.seq {
+			ts.seq = t.Seq
+		}
+		if t.SeriesID == "" {
+			// The marker line of a pruned log only carries the sequence number
+			continue
+		}
+		ts.series[t.SeriesID] = append(ts.series[t.SeriesID], t)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read tombstone log: %w", err)
+	}
+
+	return nil
+}
+
+// Add records one tombstone per series for the range between min and max,
+// all with the same new sequence number, and syncs them to disk before
+// returning that number
+func (ts *TombstoneSet) Add(seriesIDs []string, min, max time.Time) (uint64, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	seq := ts.seq + 1
+	tombstones := make([]Tombstone, 0, len(seriesIDs))
+	var data []byte
+	for _, seriesID := range seriesIDs {
+		t := Tombstone{Seq: seq, SeriesID: seriesID, Min: min, Max: max}
+		line, err := json.Marshal(t)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal tombstone: %w", err)
+		}
+		data = append(append(data, line...), '\n')
+		tombstones = append(tombstones, t)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(ts.path), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create tombstone directory: %w", err)
+	}
+	file, err := os.OpenFile(ts.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open tombstone log: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return 0, fmt.Errorf("failed to write tombstones: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to sync tombstones: %w", err)
+	}
+
+	ts.seq = seq
+	for _, t := range tombstones {
+		ts.series[t.SeriesID] = append(ts.series[t.SeriesID], t)
+	}
+	return seq, nil
+}
+
+// Seq returns the sequence number of the last recorded tombstone
+func (ts *TombstoneSet) Seq() uint64 {
+	if ts == nil {
+		return 0
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.seq
+}
+
+// Len returns the number of tombstones held
+func (ts *TombstoneSet) Len() int {
+	if ts == nil {
+		return 0
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	count := 0
+	for _, tombstones := range ts.series {
+		count += len(tombstones)
+	}
+	return count
+}
+
+// forSeries returns the tombstones of a series recorded after the given sequence number
+func (ts *TombstoneSet) forSeries(seriesID string, after uint64) []Tombstone {
+	if ts == nil {
+		return nil
+	}
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	var result []Tombstone
+	for _, t := range ts.series[seriesID] {
+		if t.Seq > after {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// Deleted reports whether a point of a series at ts is hidden by a tombstone
+// recorded after the given sequence number
+func (ts *TombstoneSet) Deleted(seriesID string, timestamp time.Time, after uint64) bool {
+	return deletedBy(ts.forSeries(seriesID, after), timestamp)
+}
+
+// Filter removes from points, in place, those hidden by a tombstone of the
+// series recorded after the given sequence number
+func (ts *TombstoneSet) Filter(seriesID string, points []DataPoint, after uint64) []DataPoint {
+	tombstones := ts.forSeries(seriesID, after)
+	if len(tombstones) == 0 {
+		return points
+	}
+
+	kept := points[:0]
+	for _, p := range points {
+		if !deletedBy(tombstones, p.Timestamp) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// deletedBy reports whether any of the tombstones covers ts
+func deletedBy(tombstones []Tombstone, ts time.Time) bool {
+	for _, t := range tombstones {
+		if t.covers(ts) {
+			return true
+		}
+	}
+	return false
+}
+
+// Prune drops the tombstones up to the given sequence number, which every
+// segment has already applied, and rewrites the log without them after a
+// marker line keeping the last sequence number
+func (ts *TombstoneSet) Prune(upTo uint64) error {
+	if ts == nil {
+		return nil
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	pruned := false
+	data, err := json.Marshal(Tombstone{Seq: ts.seq})
+	if err != nil {
+		return fmt.Errorf("failed to marshal tombstone marker: %w", err)
+	}
+	data = append(data, '\n')
+	for seriesID, tombstones := range ts.series {
+		kept := tombstones[:0]
+		for _, t := range tombstones {
+			if t.Seq <= upTo {
+				pruned = true
+				continue
+			}
+			line, err := json.Marshal(t)
+			if err != nil {
+				return fmt.Errorf("failed to marshal tombstone: %w", err)
+			}
+			data = append(append(data, line...), '\n')
+			kept = append(kept, t)
+		}
+		if len(kept) == 0 {
+			delete(ts.series, seriesID)
+		} else {
+			ts.series[seriesID] = kept
+		}
+	}
+	if !pruned {
+		return nil
+	}
+
+	// Write to a temporary file and rename it so a crash never leaves a partial log
+	tmpPath := ts.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write tombstone log: %w", err)
+	}
+	if err := os.Rename(tmpPath, ts.path); err != nil {
+		return fmt.Errorf("failed to replace tombstone log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"timeseriesdb/internal/types"
+)
+
+func TestTombstoneSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), TombstoneFileName)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	point := func(minutes int) DataPoint {
+		return DataPoint{Timestamp: base.Add(time.Duration(minutes) * time.Minute), Value: 1.0, Type: types.FieldTypeFloat}
+	}
+
+	ts := NewTombstoneSet(path)
+	if err := ts.Load(); err != nil {
+		t.Fatalf("Load of a missing log failed: %v", err)
+	}
+
+	first, err := ts.Add([]string{"cpu:value:host=a", "cpu:value:host=b"}, base, base.Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	second, err := ts.Add([]string{"cpu:value:host=a"}, base.Add(30*time.Minute), base.Add(40*time.Minute))
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if first != 1 || second != 2 || ts.Seq() != 2 || ts.Len() != 3 {
+		t.Fatalf("Unexpected sequence numbers %d, %d, seq %d, len %d", first, second, ts.Seq(), ts.Len())
+	}
+
+	// Both range ends are deleted
+	if !ts.Deleted("cpu:value:host=a", base.Add(10*time.Minute), 0) || ts.Deleted("cpu:value:host=a", base.Add(11*time.Minute), 0) {
+		t.Error("Expected the tombstone range to be inclusive")
+	}
+	// Tombstones already applied do not apply again
+	if ts.Deleted("cpu:value:host=a", base, 1) || !ts.Deleted("cpu:value:host=a", base.Add(35*time.Minute), 1) {
+		t.Error("Expected only tombstones newer than the given sequence number to apply")
+	}
+	if ts.Deleted("mem:free", base, 0) {
+		t.Error("Expected other series to be unaffected")
+	}
+
+	points := ts.Filter("cpu:value:host=a", []DataPoint{point(5), point(20), point(35), point(50)}, 0)
+	if len(points) != 2 || !points[0].Timestamp.Equal(base.Add(20*time.Minute)) {
+		t.Errorf("Filter kept %+v, want the points at 20 and 50 minutes", points)
+	}
+
+	// The log is durable
+	reloaded := NewTombstoneSet(path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if reloaded.Seq() != 2 || reloaded.Len() != 3 {
+		t.Errorf("Reloaded seq %d, len %d, want 2 and 3", reloaded.Seq(), reloaded.Len())
+	}
+
+	// Pruning drops the tombstones every segment has applied, also from disk
+	if err := reloaded.Prune(1); err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if reloaded.Len() != 1 || reloaded.Deleted("cpu:value:host=b", base, 0) {
+		t.Errorf("Expected only the second tombstone to remain, got %d", reloaded.Len())
+	}
+	pruned := NewTombstoneSet(path)
+	if err := pruned.Load(); err != nil || pruned.Len() != 1 || pruned.Seq() != 2 {
+		t.Errorf("Pruned log reloaded with len %d, seq %d, err %v", pruned.Len(), pruned.Seq(), err)
+	}
+
+	// The sequence number survives pruning every tombstone
+	if err := pruned.Prune(2); err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	emptied := NewTombstoneSet(path)
+	if err := emptied.Load(); err != nil || emptied.Len() != 0 || emptied.Seq() != 2 {
+		t.Fatalf("Emptied log reloaded with len %d, seq %d, err %v", emptied.Len(), emptied.Seq(), err)
+	}
+	if seq, err := emptied.Add([]string{"cpu:value:host=a"}, base, base); err != nil || seq != 3 {
+		t.Errorf("Expected the next tombstone to get seq 3, got %d, %v", seq, err)
+	}
+}
+
+func TestTombstoneSet_PartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), TombstoneFileName)
+	ts := NewTombstoneSet(path)
+	if _, err := ts.Add([]string{"cpu:value"}, time.Unix(0, 0), time.Unix(60, 0)); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	// Simulate a crash while a tombstone was being appended
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	file.WriteString(`{"seq":2,"series_id":"cpu:va`)
+	file.Close()
+
+	reloaded := NewTombstoneSet(path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if reloaded.Len() != 1 || reloaded.Seq() != 1 {
+		t.Errorf("Expected the partial tombstone to be skipped, got len %d, seq %d", reloaded.Len(), reloaded.Seq())
+	}
+}
+
+func TestTombstoneSet_Nil(t *testing.T) {
+	var ts *TombstoneSet
+	points := []DataPoint{{Timestamp: time.Unix(0, 0)}}
+	if ts.Seq() != 0 || ts.Len() != 0 || ts.Deleted("cpu:value", time.Unix(0, 0), 0) || len(ts.Filter("cpu:value", points, 0)) != 1 {
+		t.Error("Expected a nil tombstone set to hold no tombstones")
+	}
+	if err := ts.Prune(1); err != nil {
+		t.Errorf("Prune on a nil set failed: %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/logger"
+)
+
+// TopOptions configures the selection of the highest or lowest ranked series
+// or points
+type TopOptions struct {
+	// K is the number of values returned
+	K int
+	// Bottom selects the lowest values instead of the highest
+	Bottom bool
+	// By lists the tags series are ranked by. Series sharing the values of
+	// these tags are ranked as one, and only the best value of each is
+	// returned. Empty ranks points across every series when Aggregate is
+	// nil, and each series on its own otherwise.
+	By []string
+	// Aggregate ranks series by the aggregate of their points over the whole
+	// range. Nil ranks points by their own value.
+	Aggregate *AggregateOptions
+}
+
+// Validate checks that the options describe a supported selection
+func (o TopOptions) Validate() error {
+	if o.K < 1 {
+		return fmt.Errorf("k must be at least 1, got %d", o.K)
+	}
+	if o.Aggregate != nil {
+		if err := o.Aggregate.Validate(); err != nil {
+			return err
+		}
+		if o.Aggregate.Window != 0 {
+			return fmt.Errorf("series are ranked over the whole range, windows are not supported")
+		}
+	}
+	return nil
+}
+
+// RankedValue is one of the values selected by Top
+type RankedValue struct {
+	// Tags are the By tags of the ranked series, or all of their tags when
+	// By is empty
+	Tags map[string]string
+	// Field is the field of the ranked series when By is empty
+	Field string
+	// Timestamp is the time of the ranked point, or the start of the range
+	// for aggregates
+	Timestamp time.Time
+	Value     float64
+	// Count is the number of points the value was computed from
+	Count int
+
+	// id identifies the ranked series to break ties deterministically
+	id string
+}
+
+// Top returns the K highest or lowest values among the given series, in rank
+// order. Series are read one ranked set at a time and only the current best K
+// values are kept, so memory does not grow with the number of series.
+func (db *Database) Top(ctx context.Context, keys []SeriesKey, start, end time.Time, opts TopOptions) ([]RankedValue, error) {
+	startTime := time.Now()
+
+	if err := opts.Validate(); err != nil {
+		return nil, errors.NewValidationError(err.Error())
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, errors.WrapWithType(fmt.Errorf("database %s is closed", db.name), errors.ErrorTypeStorage, "top operation on closed database")
+	}
+
+	function := "top"
+	if opts.Bottom {
+		function = "bottom"
+	}
+	for _, key := range keys {
+		if t, ok := db.seriesType(key); ok && !t.Numeric() && (opts.Aggregate == nil || opts.Aggregate.Function != AggregateCount) {
+			return nil, errors.NewValidationError(fmt.Sprintf("%s() is not supported for %s field %q", function, t, key.Field))
+		}
+	}
+
+	best := &rankedHeap{bottom: opts.Bottom}
+	for _, set := range rankedSets(keys, opts.By) {
+		if opts.Aggregate != nil {
+			value, ok, err := db.rankAggregate(ctx, set, start, end, *opts.Aggregate)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				best.offer(value, opts.K)
+			}
+			continue
+		}
+
+		// Without By every point competes on its own, otherwise only the
+		// best point of each set does
+		if len(opts.By) == 0 {
+			if err := db.rankPoints(ctx, set, start, end, func(value RankedValue) { best.offer(value, opts.K) }); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		setBest := &rankedHeap{bottom: opts.Bottom}
+		if err := db.rankPoints(ctx, set, start, end, func(value RankedValue) { setBest.offer(value, 1) }); err != nil {
+			return nil, err
+		}
+		if setBest.Len() > 0 {
+			best.offer(setBest.values[0], opts.K)
+		}
+	}
+
+	result := best.sorted()
+
+	// Update metrics
+	if db.metrics != nil {
+		db.metrics.RecordStorageReadOperation("storage", "top")
+		db.metrics.RecordStorageReadLatency("storage", "top", time.Since(startTime))
+	}
+
+	return result, nil
+}
+
+// rankPoints offers every point of a ranked set, reading one series at a time
+func (db *Database) rankPoints(ctx context.Context, set *rankedSet, start, end time.Time, offer func(RankedValue)) error {
+	for _, key := range set.keys {
+		points, err := db.readDataPoints(ctx, key.String(), start, end, 0)
+		if err != nil {
+			return err
+		}
+		for _, p := range points {
+			offer(set.value(key, p.Timestamp, p.Value, 1))
+		}
+	}
+	return nil
+}
+
+// rankAggregate aggregates the points of a ranked set over the whole range
+// across every shard. It reports false when the set holds no points.
+func (db *Database) rankAggregate(ctx context.Context, set *rankedSet, start, end time.Time, opts AggregateOptions) (RankedValue, bool, error) {
+	req := &AggregateRequest{Start: start, End: end, AggregateOptions: opts}
+	for _, key := range set.keys {
+		req.SeriesIDs = append(req.SeriesIDs, key.String())
+	}
+
+	windows := make(windowAggregates)
+	for _, shard := range db.shards {
+		shardWindows, err := shard.aggregate(ctx, req)
+		if err != nil {
+			if isContextError(err) {
+				return RankedValue{}, false, contextError(err)
+			}
+			logger.Warnf("Failed to aggregate in shard %s: %v", shard.GetID(), err)
+			continue
+		}
+		windows.merge(shardWindows)
+	}
+
+	results := windows.results(opts)
+	if len(results) == 0 {
+		return RankedValue{}, false, nil
+	}
+	return set.value(set.keys[0], start, results[0].Value, results[0].Count), true, nil
+}
+
+// rankedSet is a set of series ranked as one
+type rankedSet struct {
+	id   string
+	tags map[string]string
+	keys []SeriesKey
+	// perSeries is set when each series is ranked on its own
+	perSeries bool
+}
+
+// value returns a ranked value of the set read from one of its series
+func (s *rankedSet) value(key SeriesKey, ts time.Time, value float64, count int) RankedValue {
+	if s.perSeries {
+		return RankedValue{Tags: key.Tags, Field: key.Field, Timestamp: ts, Value: value, Count: count, id: key.String()}
+	}
+	return RankedValue{Tags: s.tags, Timestamp: ts, Value: value, Count: count, id: s.id}
+}
+
+// rankedSets groups series by the values of the By tags, sorted by those
+// values. Without By tags every series is a set of its own.
+func rankedSets(keys []SeriesKey, by []string) []*rankedSet {
+	sets := make(map[string]*rankedSet)
+	for _, key := range keys {
+		var set *rankedSet
+		if len(by) == 0 {
+			set = &rankedSet{id: key.String(), keys: []SeriesKey{key}, perSeries: true}
+			sets[set.id] = set
+			continue
+		}
+
+		tags := make(map[string]string, len(by))
+		var id strings.Builder
+		for _, tag := range by {
+			tags[tag] = key.Tags[tag]
+			id.WriteString(tag)
+			id.WriteByte('=')
+			id.WriteString(key.Tags[tag])
+			id.WriteByte(',')
+		}
+		set, ok := sets[id.String()]
+		if !ok {
+			set = &rankedSet{id: id.String(), tags: tags}
+			sets[set.id] = set
+		}
+		set.keys = append(set.keys, key)
+	}
+
+	sorted := make([]*rankedSet, 0, len(sets))
+	for _, set := range sets {
+		sorted = append(sorted, set)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].id < sorted[j].id })
+	return sorted
+}
+
+// rankedHeap keeps the best values offered to it, with the worst of them at
+// the root so it is the one replaced by a better value
+type rankedHeap struct {
+	values []RankedValue
+	bottom bool
+}
+
+// worse reports whether a ranks below b. Ties go to the earlier point, and
+// then to the series that sorts first.
+func (h *rankedHeap) worse(a, b RankedValue) bool {
+	if a.Value != b.Value {
+		if h.bottom {
+			return a.Value > b.Value
+		}
+		return a.Value < b.Value
+	}
+	if !a.Timestamp.Equal(b.Timestamp) {
+		return a.Timestamp.After(b.Timestamp)
+	}
+	return a.id > b.id
+}
+
+func (h *rankedHeap) Len() int           { return len(h.values) }
+func (h *rankedHeap) Less(i, j int) bool { return h.worse(h.values[i], h.values[j]) }
+func (h *rankedHeap) Swap(i, j int)      { h.values[i], h.values[j] = h.values[j], h.values[i] }
+func (h *rankedHeap) Push(x interface{}) { h.values = append(h.values, x.(RankedValue)) }
+func (h *rankedHeap) Pop() interface{} {
+	last := h.values[len(h.values)-1]
+	h.values = h.values[:len(h.values)-1]
+	return last
+}
+
+// offer keeps a value if it is among the k best offered so far
+func (h *rankedHeap) offer(value RankedValue, k int) {
+	if h.Len() < k {
+		heap.Push(h, value)
+		return
+	}
+	if h.worse(h.values[0], value) {
+		h.values[0] = value
+		heap.Fix(h, 0)
+	}
+}
+
+// sorted returns the kept values from best to worst
+func (h *rankedHeap) sorted() []RankedValue {
+	result := append([]RankedValue{}, h.values...)
+	sort.Slice(result, func(i, j int) bool { return h.worse(result[j], result[i]) })
+	return result
+}
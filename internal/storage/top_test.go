@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+	"timeseriesdb/internal/config"
+	"timeseriesdb/internal/errors"
+	"timeseriesdb/internal/types"
+)
+
+func TestRankedHeap(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	values := []RankedValue{
+		{Value: 3, Timestamp: base, id: "a"},
+		{Value: 7, Timestamp: base, id: "b"},
+		{Value: 5, Timestamp: base, id: "c"},
+		{Value: 7, Timestamp: base.Add(-time.Second), id: "d"},
+		{Value: 1, Timestamp: base, id: "e"},
+		{Value: 5, Timestamp: base, id: "b"},
+	}
+
+	tests := []struct {
+		bottom bool
+		want   []string
+	}{
+		// Ties go to the earlier point, then to the series sorting first
+		{false, []string{"d", "b", "b"}},
+		{true, []string{"e", "a", "b"}},
+	}
+	for _, tt := range tests {
+		h := &rankedHeap{bottom: tt.bottom}
+		for _, v := range values {
+			h.offer(v, 3)
+		}
+		sorted := h.sorted()
+		if len(sorted) != len(tt.want) {
+			t.Fatalf("Got %+v, want %v", sorted, tt.want)
+		}
+		for i, v := range sorted {
+			if v.id != tt.want[i] {
+				t.Errorf("bottom=%v: value %d is %s (%v), want %s", tt.bottom, i, v.id, v.Value, tt.want[i])
+			}
+		}
+	}
+	if sorted := (&rankedHeap{}).sorted(); len(sorted) != 0 {
+		t.Errorf("Expected an empty heap to hold nothing, got %+v", sorted)
+	}
+}
+
+func TestStorageTop(t *testing.T) {
+	cfg := config.StorageConfig{DataDir: t.TempDir(), MaxFileSize: 1024 * 1024}
+	s := NewStorage(cfg)
+	defer s.Close()
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	usage := map[string][]float64{
+		"a": {10, 90, 20},
+		"b": {50, 60, 70},
+		"c": {5, 15, 95},
+		"d": {1, 2, 3},
+	}
+	write := func(from, to int) {
+		t.Helper()
+		for host, values := range usage {
+			for i := from; i < to; i++ {
+				err := s.WritePoint(context.Background(), types.Point{Measurement: "cpu", Tags: map[string]string{"host": host, "dc": "dc1"}, Fields: map[string]interface{}{"usage": values[i], "state": "ok"}, Timestamp: at(i)})
+				if err != nil {
+					t.Fatalf("Failed to write point: %v", err)
+				}
+			}
+		}
+	}
+
+	// Part of the points are read from a segment
+	write(0, 2)
+	if err := s.shards["default"].ForceFlush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	write(2, 3)
+
+	keys, err := s.FindSeries("cpu")
+	if err != nil {
+		t.Fatalf("FindSeries failed: %v", err)
+	}
+	var usageKeys []SeriesKey
+	for _, key := range keys {
+		if key.Field == "usage" {
+			usageKeys = append(usageKeys, key)
+		}
+	}
+
+	top := func(t *testing.T, opts TopOptions) []RankedValue {
+		t.Helper()
+		ranked, err := s.Top(context.Background(), usageKeys, at(0), at(2), opts)
+		if err != nil {
+			t.Fatalf("Top failed: %v", err)
+		}
+		return ranked
+	}
+	check := func(t *testing.T, ranked []RankedValue, hosts []string, values []float64) {
+		t.Helper()
+		if len(ranked) != len(hosts) {
+			t.Fatalf("Got %+v, want hosts %v", ranked, hosts)
+		}
+		for i, r := range ranked {
+			if r.Tags["host"] != hosts[i] || r.Value != values[i] {
+				t.Errorf("Rank %d is %s with %v, want %s with %v", i, r.Tags["host"], r.Value, hosts[i], values[i])
+			}
+		}
+	}
+
+	t.Run("points", func(t *testing.T) {
+		ranked := top(t, TopOptions{K: 3})
+		check(t, ranked, []string{"c", "a", "b"}, []float64{95, 90, 70})
+		if !ranked[0].Timestamp.Equal(at(2)) || ranked[0].Field != "usage" || ranked[0].Tags["dc"] == "" {
+			t.Errorf("Expected the point of c at %v with all of its tags, got %+v", at(2), ranked[0])
+		}
+	})
+
+	t.Run("points by host", func(t *testing.T) {
+		// Only the highest point of each host competes
+		check(t, top(t, TopOptions{K: 3, By: []string{"host"}}), []string{"c", "a", "b"}, []float64{95, 90, 70})
+		check(t, top(t, TopOptions{K: 2, Bottom: true, By: []string{"host"}}), []string{"d", "c"}, []float64{1, 5})
+		if ranked := top(t, TopOptions{K: 1, By: []string{"host"}}); len(ranked[0].Tags) != 1 {
+			t.Errorf("Expected only the host tag, got %v", ranked[0].Tags)
+		}
+	})
+
+	t.Run("series by aggregate", func(t *testing.T) {
+		ranked := top(t, TopOptions{K: 2, By: []string{"host"}, Aggregate: &AggregateOptions{Function: AggregateMean}})
+		check(t, ranked, []string{"b", "a"}, []float64{60, 40})
+		if ranked[0].Count != 3 || !ranked[0].Timestamp.Equal(at(0)) {
+			t.Errorf("Expected a mean over 3 points at the start of the range, got %+v", ranked[0])
+		}
+
+		check(t, top(t, TopOptions{K: 1, Bottom: true, Aggregate: &AggregateOptions{Function: AggregateMax}}), []string{"d"}, []float64{3})
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		invalid := []TopOptions{
+			{K: 0},
+			{K: 1, Aggregate: &AggregateOptions{Function: "median"}},
+			{K: 1, Aggregate: &AggregateOptions{Function: AggregateMean, Window: time.Minute}},
+		}
+		for _, opts := range invalid {
+			if _, err := s.Top(context.Background(), usageKeys, at(0), at(2), opts); !errors.IsType(err, errors.ErrorTypeValidation) {
+				t.Errorf("Top(%+v) returned %v, want a validation error", opts, err)
+			}
+		}
+
+		for _, key := range keys {
+			if key.Field != "state" {
+				continue
+			}
+			if _, err := s.Top(context.Background(), []SeriesKey{key}, at(0), at(2), TopOptions{K: 1}); !errors.IsType(err, errors.ErrorTypeValidation) {
+				t.Errorf("Expected a validation error for a string field, got %v", err)
+			}
+		}
+	})
+}
@@ -2,12 +2,19 @@ package storage
 
 import (
 	"time"
+	"timeseriesdb/internal/types"
 )
 
-// DataPoint represents a single time series data point
+// DataPoint represents a single time series data point. Value holds float
+// values and the numeric value of integer, unsigned and boolean points so
+// they can be aggregated; the exact value of other types is kept alongside.
 type DataPoint struct {
 	Timestamp time.Time
 	Value     float64
+	Type      types.FieldType `json:",omitempty"`
+	Integer   int64           `json:",omitempty"`
+	Unsigned  uint64          `json:",omitempty"`
+	Text      string          `json:",omitempty"`
 	Labels    map[string]string
 }
 
@@ -35,6 +42,8 @@ type MemTable struct {
 	MaxSize   int64
 	CreatedAt time.Time
 	IsFlushed bool
+	// TombstoneSeq is the last tombstone already applied to the data
+	TombstoneSeq uint64
 }
 
 // Segment represents an immutable on-disk segment
@@ -46,6 +55,8 @@ type Segment struct {
 	MaxTime   time.Time
 	SeriesIDs []string
 	CreatedAt time.Time
+	// TombstoneSeq is the last tombstone already applied to the segment's points
+	TombstoneSeq uint64
 }
 
 // WALEntry represents a write-ahead log entry
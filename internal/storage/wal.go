@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -179,6 +180,56 @@ func (w *WAL) Close() error {
 	return nil
 }
 
+// Seal rotates the current file, if it holds entries, and returns the paths
+// of the rotated files. Those hold every entry written so far, and can be
+// removed with RemoveSealed once the data they protect is durable elsewhere.
+func (w *WAL) Seal() ([]string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil, fmt.Errorf("WAL is closed")
+	}
+
+	if w.currentSize > 0 {
+		if err := w.rotateFile(); err != nil {
+			return nil, fmt.Errorf("failed to rotate WAL file: %w", err)
+		}
+	}
+
+	return w.rotatedFiles()
+}
+
+// RemoveSealed removes rotated files returned by Seal
+func (w *WAL) RemoveSealed(paths []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove rotated WAL file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// rotatedFiles lists the rotated files of the WAL
+func (w *WAL) rotatedFiles() ([]string, error) {
+	matches, err := filepath.Glob(w.path + ".*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rotated WAL files: %w", err)
+	}
+
+	rotated := make([]string, 0, len(matches))
+	for _, path := range matches {
+		if !strings.HasSuffix(path, ".tmp") {
+			rotated = append(rotated, path)
+		}
+	}
+	return rotated, nil
+}
+
 // rotateFile rotates the current WAL file and creates a new one
 func (w *WAL) rotateFile() error {
 	// Close current file
@@ -190,9 +241,16 @@ func (w *WAL) rotateFile() error {
 		return fmt.Errorf("failed to close WAL file: %w", err)
 	}
 
-	// Rename current file with timestamp
+	// Rename current file with timestamp, numbering files rotated within the
+	// same millisecond so that none replaces a file not yet removed
 	timestamp := time.Now().Format("20060102-150405.000")
 	oldPath := w.path + "." + timestamp
+	for n := 1; ; n++ {
+		if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+			break
+		}
+		oldPath = fmt.Sprintf("%s.%s-%d", w.path, timestamp, n)
+	}
 	if err := os.Rename(w.path, oldPath); err != nil {
 		return fmt.Errorf("failed to rename old WAL file: %w", err)
 	}
@@ -152,6 +152,7 @@ func (wr *WALReplay) replayFile(filePath string, result *ReplayResult) error {
 
 		// Add to result
 		result.Entries = append(result.Entries, entry)
+		result.TotalCount++
 
 		// Reconstruct series data
 		for _, point := range entry.Points {
@@ -167,15 +168,24 @@ func (wr *WALReplay) replayFile(filePath string, result *ReplayResult) error {
 
 // deserializeEntry deserializes a WAL entry from bytes
 func (wr *WALReplay) deserializeEntry(data []byte) (WALEntry, error) {
-	var entry WALEntry
+	// The WAL writes the series ID under series_id, which does not match the
+	// field name case-insensitively like the other keys do
+	var raw struct {
+		WALEntry
+		SnakeSeriesID string `json:"series_id"`
+	}
 
 	// Try to deserialize as JSON first
-	if err := json.Unmarshal(data, &entry); err == nil {
+	if err := json.Unmarshal(data, &raw); err == nil {
+		entry := raw.WALEntry
+		if entry.SeriesID == "" {
+			entry.SeriesID = raw.SnakeSeriesID
+		}
 		return entry, nil
 	}
 
 	// If JSON fails, try legacy format or return error
-	return entry, fmt.Errorf("failed to deserialize WAL entry")
+	return WALEntry{}, fmt.Errorf("failed to deserialize WAL entry")
 }
 
 // ValidateEntry validates a WAL entry for integrity
@@ -267,6 +267,55 @@ func TestWALFlush(t *testing.T) {
 	})
 }
 
+func TestWALSeal(t *testing.T) {
+	tempDir := t.TempDir()
+	walPath := filepath.Join(tempDir, "test.wal")
+
+	// A tiny max size rotates the file on every write
+	wal, err := NewWAL(WALConfig{Path: walPath, MaxFileSize: 1})
+	if err != nil {
+		t.Fatalf("Failed to create WAL: %v", err)
+	}
+	defer wal.Close()
+
+	for i := 0; i < 3; i++ {
+		entry := WALEntry{SeriesID: "test_series", Points: []DataPoint{{Timestamp: time.Now(), Value: float64(i)}}}
+		if err := wal.Write(entry); err != nil {
+			t.Fatalf("Failed to write entry: %v", err)
+		}
+	}
+
+	sealed, err := wal.Seal()
+	if err != nil {
+		t.Fatalf("Failed to seal WAL: %v", err)
+	}
+	if len(sealed) != 3 {
+		t.Errorf("Expected 3 sealed files, got %v", sealed)
+	}
+	if wal.GetSize() != 0 {
+		t.Errorf("Expected size 0 after seal, got %d", wal.GetSize())
+	}
+
+	// Entries written after the seal survive the removal of the sealed files
+	if err := wal.Write(WALEntry{SeriesID: "after", Points: []DataPoint{{Timestamp: time.Now(), Value: 1}}}); err != nil {
+		t.Fatalf("Failed to write entry: %v", err)
+	}
+	if err := wal.Flush(); err != nil {
+		t.Fatalf("Failed to flush WAL: %v", err)
+	}
+	if err := wal.RemoveSealed(sealed); err != nil {
+		t.Fatalf("Failed to remove sealed files: %v", err)
+	}
+
+	result, err := NewWALReplay(tempDir, nil).Replay()
+	if err != nil {
+		t.Fatalf("Failed to replay WAL: %v", err)
+	}
+	if result.TotalCount != 1 || len(result.SeriesData["after"]) != 1 {
+		t.Errorf("Expected only the entry written after the seal, got %d entries: %v", result.TotalCount, result.SeriesData)
+	}
+}
+
 func TestWALClose(t *testing.T) {
 	t.Run("close WAL", func(t *testing.T) {
 		tempDir := t.TempDir()
@@ -1,11 +1,85 @@
 package types
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
-// Point represents a time-series data point
+// Point represents a time-series data point. Field values are float64, int64,
+// uint64, bool or string.
 type Point struct {
 	Measurement string
 	Tags        map[string]string
-	Fields      map[string]float64
+	Fields      map[string]interface{}
 	Timestamp   time.Time
 }
+
+// FieldType is the data type of a field value
+type FieldType int
+
+const (
+	// FieldTypeFloat is a 64-bit floating point value
+	FieldTypeFloat FieldType = iota
+	// FieldTypeInteger is a signed 64-bit integer value
+	FieldTypeInteger
+	// FieldTypeUnsigned is an unsigned 64-bit integer value
+	FieldTypeUnsigned
+	// FieldTypeBoolean is a boolean value
+	FieldTypeBoolean
+	// FieldTypeString is a string value
+	FieldTypeString
+)
+
+// fieldTypeNames are the names used for field types in query results
+var fieldTypeNames = [...]string{
+	FieldTypeFloat:    "float",
+	FieldTypeInteger:  "integer",
+	FieldTypeUnsigned: "unsigned",
+	FieldTypeBoolean:  "boolean",
+	FieldTypeString:   "string",
+}
+
+// String returns the name of the field type
+func (t FieldType) String() string {
+	if t >= 0 && int(t) < len(fieldTypeNames) {
+		return fieldTypeNames[t]
+	}
+	return fmt.Sprintf("FieldType(%d)", int(t))
+}
+
+// Numeric reports whether values of the type can be aggregated arithmetically
+func (t FieldType) Numeric() bool {
+	return t == FieldTypeFloat || t == FieldTypeInteger || t == FieldTypeUnsigned
+}
+
+// FieldTypeOf returns the type of a field value, reporting false for
+// unsupported Go types
+func FieldTypeOf(value interface{}) (FieldType, bool) {
+	switch value.(type) {
+	case float64:
+		return FieldTypeFloat, true
+	case int64:
+		return FieldTypeInteger, true
+	case uint64:
+		return FieldTypeUnsigned, true
+	case bool:
+		return FieldTypeBoolean, true
+	case string:
+		return FieldTypeString, true
+	}
+	return 0, false
+}
+
+// NumericValue converts a float, integer or unsigned field value to float64,
+// reporting false for booleans, strings and unsupported types
+func NumericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -1,6 +1,7 @@
 package benchmark
 
 import (
+	"context"
 	"net/http/httptest"
 	"os"
 	"strings"
@@ -47,7 +48,7 @@ func BenchmarkHTTPWriteSinglePoint(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		// Write directly to storage instead of HTTP for accurate benchmarking
 		for _, point := range points {
-			err := storageInstance.WritePoint(point)
+			err := storageInstance.WritePoint(context.Background(), point)
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -94,7 +95,7 @@ func BenchmarkHTTPWriteMultiplePoints(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		// Write directly to storage instead of HTTP for accurate benchmarking
 		for _, point := range points {
-			err := storageInstance.WritePoint(point)
+			err := storageInstance.WritePoint(context.Background(), point)
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -134,7 +135,7 @@ func BenchmarkHTTPWriteLargeDataset(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		// Write directly to storage instead of HTTP for accurate benchmarking
 		for _, point := range points {
-			err := storageInstance.WritePoint(point)
+			err := storageInstance.WritePoint(context.Background(), point)
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -177,7 +178,7 @@ func BenchmarkEndToEndWrite(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		for _, point := range points {
-			err := storageInstance.WritePoint(point)
+			err := storageInstance.WritePoint(context.Background(), point)
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -154,7 +154,7 @@ func BenchmarkParseTagCounts(b *testing.B) {
 		point := types.Point{
 			Measurement: "cpu",
 			Tags:        tags,
-			Fields:      map[string]float64{"value": 0.64},
+			Fields:      map[string]interface{}{"value": 0.64},
 			Timestamp:   time.Unix(0, 1434055562000000000),
 		}
 
@@ -185,7 +185,7 @@ func BenchmarkParseFieldCounts(b *testing.B) {
 	}
 
 	for _, bm := range benchmarks {
-		fields := make(map[string]float64, bm.fields)
+		fields := make(map[string]interface{}, bm.fields)
 		for i := 0; i < bm.fields; i++ {
 			fields[fmt.Sprintf("field%d", i)] = float64(i)
 		}
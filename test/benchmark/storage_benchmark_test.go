@@ -1,6 +1,7 @@
 package benchmark
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -34,13 +35,13 @@ func BenchmarkWriteSinglePoint(b *testing.B) {
 	point := types.Point{
 		Measurement: "cpu",
 		Tags:        map[string]string{"host": "server01", "region": "us-west"},
-		Fields:      map[string]float64{"value": 0.64},
+		Fields:      map[string]interface{}{"value": 0.64},
 		Timestamp:   time.Unix(0, 1434055562000000000),
 	}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		err := storageInstance.WritePoint(point)
+		err := storageInstance.WritePoint(context.Background(), point)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -73,7 +74,7 @@ func BenchmarkWriteMultiplePoints(b *testing.B) {
 		points[i] = types.Point{
 			Measurement: "cpu",
 			Tags:        map[string]string{"host": "server01", "region": "us-west"},
-			Fields:      map[string]float64{"value": float64(i)},
+			Fields:      map[string]interface{}{"value": float64(i)},
 			Timestamp:   time.Unix(0, 1434055562000000000+int64(i)),
 		}
 	}
@@ -81,7 +82,7 @@ func BenchmarkWriteMultiplePoints(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		for _, point := range points {
-			err := storageInstance.WritePoint(point)
+			err := storageInstance.WritePoint(context.Background(), point)
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -110,7 +111,7 @@ func BenchmarkWritePointWithManyFields(b *testing.B) {
 	storageInstance := storage.NewStorage(storageConfig)
 	defer storageInstance.Close()
 
-	fields := make(map[string]float64, 50)
+	fields := make(map[string]interface{}, 50)
 	for i := 0; i < 50; i++ {
 		fields[fmt.Sprintf("field%d", i)] = float64(i)
 	}
@@ -124,7 +125,7 @@ func BenchmarkWritePointWithManyFields(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		err := storageInstance.WritePoint(point)
+		err := storageInstance.WritePoint(context.Background(), point)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -160,13 +161,13 @@ func BenchmarkWritePointWithManyTags(b *testing.B) {
 	point := types.Point{
 		Measurement: "cpu",
 		Tags:        tags,
-		Fields:      map[string]float64{"value": 0.64},
+		Fields:      map[string]interface{}{"value": 0.64},
 		Timestamp:   time.Unix(0, 1434055562000000000),
 	}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		err := storageInstance.WritePoint(point)
+		err := storageInstance.WritePoint(context.Background(), point)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -199,7 +200,7 @@ func BenchmarkConcurrentWrites(b *testing.B) {
 		points[i] = types.Point{
 			Measurement: "cpu",
 			Tags:        map[string]string{"host": "server01", "region": "us-west"},
-			Fields:      map[string]float64{"value": float64(i)},
+			Fields:      map[string]interface{}{"value": float64(i)},
 			Timestamp:   time.Unix(0, 1434055562000000000+int64(i)),
 		}
 	}
@@ -209,7 +210,7 @@ func BenchmarkConcurrentWrites(b *testing.B) {
 		i := 0
 		for pb.Next() {
 			point := points[i%len(points)]
-			err := storageInstance.WritePoint(point)
+			err := storageInstance.WritePoint(context.Background(), point)
 			if err != nil {
 				b.Fatal(err)
 			}
@@ -246,7 +247,7 @@ func BenchmarkMemoryUsage(b *testing.B) {
 		points[i] = types.Point{
 			Measurement: "cpu",
 			Tags:        map[string]string{"host": "server01", "region": "us-west"},
-			Fields:      map[string]float64{"value": float64(i)},
+			Fields:      map[string]interface{}{"value": float64(i)},
 			Timestamp:   time.Unix(0, 1434055562000000000+int64(i)),
 		}
 	}
@@ -254,7 +255,7 @@ func BenchmarkMemoryUsage(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		for _, point := range points {
-			err := storageInstance.WritePoint(point)
+			err := storageInstance.WritePoint(context.Background(), point)
 			if err != nil {
 				b.Fatal(err)
 			}
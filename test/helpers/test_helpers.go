@@ -16,12 +16,12 @@ import (
 type TestHelpers struct{}
 
 // CreateTestPoint creates a test point with default values
-func (h *TestHelpers) CreateTestPoint(measurement string, tags map[string]string, fields map[string]float64) types.Point {
+func (h *TestHelpers) CreateTestPoint(measurement string, tags map[string]string, fields map[string]interface{}) types.Point {
 	if tags == nil {
 		tags = map[string]string{"host": "server01", "region": "us-west"}
 	}
 	if fields == nil {
-		fields = map[string]float64{"value": 0.64}
+		fields = map[string]interface{}{"value": 0.64}
 	}
 
 	return types.Point{
@@ -33,7 +33,7 @@ func (h *TestHelpers) CreateTestPoint(measurement string, tags map[string]string
 }
 
 // CreateTestPoints creates multiple test points
-func (h *TestHelpers) CreateTestPoints(count int, measurement string, tags map[string]string, fields map[string]float64) []types.Point {
+func (h *TestHelpers) CreateTestPoints(count int, measurement string, tags map[string]string, fields map[string]interface{}) []types.Point {
 	points := make([]types.Point, count)
 	for i := 0; i < count; i++ {
 		points[i] = h.CreateTestPoint(measurement, tags, fields)
@@ -46,7 +46,7 @@ func (h *ValidationHelpers) ValidateTags(t *testing.T, tags map[string]string, e
 }
 
 // ValidateFields validates that fields contain expected key-value pairs
-func (h *ValidationHelpers) ValidateFields(t *testing.T, fields map[string]float64, expected map[string]float64) {
+func (h *ValidationHelpers) ValidateFields(t *testing.T, fields map[string]interface{}, expected map[string]interface{}) {
 	if len(fields) != len(expected) {
 		t.Errorf("Expected %d fields, got %d", len(expected), len(fields))
 		return
@@ -56,7 +56,7 @@ func (h *ValidationHelpers) ValidateFields(t *testing.T, fields map[string]float
 		if actualValue, exists := fields[key]; !exists {
 			t.Errorf("Expected field '%s' not found", key)
 		} else if actualValue != expectedValue {
-			t.Errorf("Expected field '%s' to be %g, got %g", key, expectedValue, actualValue)
+			t.Errorf("Expected field '%s' to be %v, got %v", key, expectedValue, actualValue)
 		}
 	}
 }
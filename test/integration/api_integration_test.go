@@ -343,11 +343,11 @@ func TestErrorHandling(t *testing.T) {
 
 	t.Run("Malformed Line Protocol", func(t *testing.T) {
 		malformedData := []string{
-			"cpu,host=server01 value",                    // Missing field value
-			"cpu,host=server01 value=0.64 invalid",       // Invalid timestamp
-			"cpu,host=server01 value=0.64 1434055562000", // Invalid timestamp format
-			"cpu,host=server01, value=0.64",              // Empty tag key
-			"cpu,host=server01,=value value=0.64",        // Empty tag value
+			"cpu,host=server01 value",                   // Missing field value
+			"cpu,host=server01 value=0.64 invalid",      // Invalid timestamp
+			"cpu,host=server01 value=0.64 1434055562e3", // Invalid timestamp format
+			"cpu,host=server01, value=0.64",             // Empty tag key
+			"cpu,host=server01,=value value=0.64",       // Empty tag value
 		}
 
 		for i, data := range malformedData {
@@ -15,7 +15,7 @@ func (f *TestDataFactory) SimplePoint() types.Point {
 	return types.Point{
 		Measurement: "cpu",
 		Tags:        map[string]string{"host": "server01", "region": "us-west"},
-		Fields:      map[string]float64{"value": 0.64},
+		Fields:      map[string]interface{}{"value": 0.64},
 		Timestamp:   time.Unix(0, 1434055562000000000),
 	}
 }
@@ -29,7 +29,7 @@ func (f *TestDataFactory) ComplexPoint() types.Point {
 	tags["rack"] = "r1"
 	tags["zone"] = "z1"
 
-	fields := make(map[string]float64, 6)
+	fields := make(map[string]interface{}, 6)
 	fields["user"] = 0.64
 	fields["system"] = 0.23
 	fields["idle"] = 0.12
@@ -52,7 +52,7 @@ func (f *TestDataFactory) MultiPoint(count int) []types.Point {
 		points[i] = types.Point{
 			Measurement: "cpu",
 			Tags:        map[string]string{"host": "server01", "region": "us-west"},
-			Fields:      map[string]float64{"value": float64(i)},
+			Fields:      map[string]interface{}{"value": float64(i)},
 			Timestamp:   time.Unix(0, 1434055562000000000+int64(i)),
 		}
 	}
@@ -97,7 +97,7 @@ func (f *TestDataFactory) GenerateLargeDataset(size int) string {
 		point := types.Point{
 			Measurement: "cpu",
 			Tags:        map[string]string{"host": "server01", "region": "us-west", "datacenter": "dc1", "rack": "r1", "zone": "z1"},
-			Fields:      map[string]float64{"user": 0.64, "system": 0.23, "idle": 0.12, "wait": 0.01, "steal": 0.0, "guest": 0.0},
+			Fields:      map[string]interface{}{"user": 0.64, "system": 0.23, "idle": 0.12, "wait": 0.01, "steal": 0.0, "guest": 0.0},
 			Timestamp:   time.Unix(0, 1434055562000000000+int64(i)*1000000000),
 		}
 		lines = append(lines, f.pointToLineProtocol(point))